@@ -0,0 +1,75 @@
+package res
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errApplyIndexOutOfRange is returned by slice apply handlers for add and
+// remove events with an index out of range for the collection.
+var errApplyIndexOutOfRange = errors.New("index out of range")
+
+// ApplyAddSlice sets a handler for applying add events to collections stored
+// as a []T. The handler loads the collection with get, inserts the value at
+// the event's index, and stores the result with set:
+//
+//	s.Handle("books",
+//		res.ApplyAddSlice(
+//			func(r res.Resource) ([]res.Ref, error) { return db.Books, nil },
+//			func(r res.Resource, books []res.Ref) error { db.Books = books; return nil },
+//		),
+//	)
+//
+// A value of type T is inserted as is. Any other value is converted into T by
+// its JSON encoding. An index greater than the length of the collection, or a
+// value that cannot be converted, is returned as an internal error.
+//
+// The slice returned by get may be modified.
+func ApplyAddSlice[T any](get func(r Resource) ([]T, error), set func(r Resource, items []T) error) Option {
+	return ApplyAdd(func(r Resource, value interface{}, idx int) error {
+		items, err := get(r)
+		if err != nil {
+			return err
+		}
+		if idx < 0 || idx > len(items) {
+			return InternalError(errApplyIndexOutOfRange)
+		}
+		v, err := decodePayload[T](value)
+		if err != nil {
+			return InternalError(fmt.Errorf("invalid add event value: %s", err))
+		}
+		var zero T
+		items = append(items, zero)
+		copy(items[idx+1:], items[idx:])
+		items[idx] = v
+		return set(r, items)
+	})
+}
+
+// ApplyRemoveSlice sets a handler for applying remove events to collections
+// stored as a []T. The handler loads the collection with get, removes the
+// value at the event's index, and stores the result with set. The removed
+// value is returned to the event listeners.
+//
+// An index not within the collection is returned as an internal error.
+//
+// The slice returned by get may be modified.
+func ApplyRemoveSlice[T any](get func(r Resource) ([]T, error), set func(r Resource, items []T) error) Option {
+	return ApplyRemove(func(r Resource, idx int) (interface{}, error) {
+		items, err := get(r)
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || idx >= len(items) {
+			return nil, InternalError(errApplyIndexOutOfRange)
+		}
+		v := items[idx]
+		copy(items[idx:], items[idx+1:])
+		var zero T
+		items[len(items)-1] = zero
+		if err := set(r, items[:len(items)-1]); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
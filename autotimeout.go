@@ -0,0 +1,84 @@
+package res
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// autoTimeout sends a timeout pre-response for a request that has not been
+// replied to within the service's auto timeout threshold.
+type autoTimeout struct {
+	mu      sync.Mutex
+	stopped bool // Flag telling if the request is replied to, or its timeout set manually
+	timer   Timer
+}
+
+// SetAutoTimeout sets a threshold after which a timeout pre-response is sent
+// automatically for requests that have not yet been replied to, extending the
+// timeout to the extension duration. Default is 0, meaning no automatic
+// pre-response is sent.
+//
+// It prevents the gateway from timing out requests to occasionally slow
+// handlers, without calling Timeout in every handler. No automatic pre-response
+// is sent if the handler calls Timeout itself.
+//
+// The threshold should be less than the gateway's request timeout, and the
+// extension should be greater than the threshold. If threshold is zero or less,
+// automatic pre-responses are disabled.
+//
+// Panics if service is already started, or if extension is not greater than a
+// positive threshold.
+func (s *Service) SetAutoTimeout(threshold, extension time.Duration) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if threshold > 0 && extension <= threshold {
+		panic("res: auto timeout extension must be greater than threshold")
+	}
+	s.autoTimeout = threshold
+	s.autoTimeoutExt = extension
+	return s
+}
+
+// startAutoTimeout starts the timer sending a timeout pre-response unless the
+// request is replied to in time.
+func (r *Request) startAutoTimeout() {
+	at := &autoTimeout{}
+	r.autoTimeout = at
+	ext := r.s.autoTimeoutExt
+	at.timer = r.s.clock.AfterFunc(r.s.autoTimeout, func() {
+		at.mu.Lock()
+		defer at.mu.Unlock()
+		if at.stopped {
+			return
+		}
+		at.stopped = true
+		r.sendTimeout(ext)
+	})
+}
+
+// stopAutoTimeout prevents any automatic timeout pre-response from being sent.
+// If a pre-response is being sent, it waits for it to complete, so that it is
+// never sent after the response.
+func (r *Request) stopAutoTimeout() {
+	at := r.autoTimeout
+	if at == nil {
+		return
+	}
+	at.mu.Lock()
+	if !at.stopped {
+		at.stopped = true
+		at.timer.Stop()
+	}
+	at.mu.Unlock()
+}
+
+// sendTimeout sends a timeout pre-response with the duration d.
+func (r *Request) sendTimeout(d time.Duration) {
+	if r.capture != nil || r.msg.Reply == "" {
+		return
+	}
+	out := []byte(`timeout:"` + strconv.FormatInt(int64(d/time.Millisecond), 10) + `"`)
+	r.s.rawEvent(r.msg.Reply, out)
+}
@@ -0,0 +1,142 @@
+package bench_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/bench"
+)
+
+type model struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+var testModel = model{ID: 42, Name: "foo", Admin: true}
+
+func newService() *res.Service {
+	s := res.NewService("bench")
+	s.Handle("model.$id",
+		res.GetModel(func(r res.ModelRequest) { r.Model(testModel) }),
+		res.Call("set", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"name": "bar"})
+			r.OK(nil)
+		}),
+	)
+	return s
+}
+
+func TestHarness_Get_ReturnsResponse(t *testing.T) {
+	h, err := bench.NewHarness(newService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	resp, err := h.Get("bench.model.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != `{"result":{"model":{"id":42,"name":"foo","admin":true}}}` {
+		t.Fatalf("unexpected response: %s", resp)
+	}
+}
+
+func TestHarness_Call_CountsEvents(t *testing.T) {
+	h, err := bench.NewHarness(newService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if _, err = h.Call("bench.model.1", "set", nil); err != nil {
+		t.Fatal(err)
+	}
+	if h.Events() != 1 {
+		t.Fatalf("expected 1 event, but got %d", h.Events())
+	}
+}
+
+func BenchmarkMuxGetHandler(b *testing.B) {
+	m := res.NewMux("bench")
+	for i := 0; i < 100; i++ {
+		m.Handle("static"+strconv.Itoa(i)+".model", res.GetResource(func(r res.GetRequest) {}))
+	}
+	m.Handle("user.$userId.book.$bookId.chapter.$chapterId", res.GetResource(func(r res.GetRequest) {}))
+	m.Handle("any.>", res.GetResource(func(r res.GetRequest) {}))
+
+	for _, rname := range []string{
+		"bench.static50.model",
+		"bench.user.1.book.2.chapter.3",
+		"bench.any.foo.bar.baz",
+		"bench.missing.model",
+	} {
+		b.Run(rname, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.GetHandler(rname)
+			}
+		})
+	}
+}
+
+func BenchmarkGetModel(b *testing.B) {
+	bench.RunGet(b, newService(), "bench.model.1")
+}
+
+func BenchmarkGetModel_Parallel(b *testing.B) {
+	bench.RunParallelGet(b, newService(), "bench.model.1")
+}
+
+func BenchmarkCall_ChangeEventWithListeners(b *testing.B) {
+	for _, n := range []int{0, 10, 100} {
+		b.Run(fmt.Sprintf("listeners=%d", n), func(b *testing.B) {
+			s := newService()
+			for i := 0; i < n; i++ {
+				s.AddListener("model.$id", func(ev *res.Event) {})
+			}
+			bench.RunCall(b, s, "bench.model.1", "set", nil)
+		})
+	}
+}
+
+func BenchmarkGetCollection_Large(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			col := make([]interface{}, n)
+			for i := range col {
+				col[i] = res.Ref("bench.model." + strconv.Itoa(i))
+			}
+			s := res.NewService("bench")
+			s.Handle("collection", res.GetCollection(func(r res.CollectionRequest) { r.Collection(col) }))
+			bench.RunGet(b, s, "bench.collection")
+		})
+	}
+}
+
+func BenchmarkGetManyResources_Parallel(b *testing.B) {
+	for _, shards := range []int{1, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := newService().SetWorkShards(shards)
+			h, err := bench.NewHarness(s)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer h.Close()
+			var n uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					rid := "bench.model." + strconv.FormatUint(atomic.AddUint64(&n, 1)%1000, 10)
+					if _, err := h.Get(rid); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
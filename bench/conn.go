@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// conn is an in-memory connection routing requests to the service, and
+// replies back to the awaiting requester.
+type conn struct {
+	mu      sync.Mutex
+	subs    []subscription
+	replies map[string]chan []byte
+	inbox   uint64
+	events  uint64
+	ready   chan struct{}
+	closed  bool
+}
+
+type subscription struct {
+	pattern res.Pattern
+	ch      chan *nats.Msg
+}
+
+// Assert *conn implements the res.Conn interface.
+var _ res.Conn = &conn{}
+
+func newConn() *conn {
+	return &conn{
+		replies: make(map[string]chan []byte),
+		ready:   make(chan struct{}),
+	}
+}
+
+// Publish delivers replies to awaiting requests, and counts any other
+// message as an event.
+func (c *conn) Publish(subject string, payload []byte) error {
+	c.mu.Lock()
+	ch, ok := c.replies[subject]
+	if ok && len(payload) > 0 && payload[0] == '{' {
+		delete(c.replies, subject)
+	}
+	c.mu.Unlock()
+	if ok {
+		// Ignore pre-responses
+		if len(payload) > 0 && payload[0] == '{' {
+			ch <- payload
+		}
+		return nil
+	}
+	if subject == "system.reset" {
+		select {
+		case <-c.ready:
+		default:
+			close(c.ready)
+		}
+		return nil
+	}
+	atomic.AddUint64(&c.events, 1)
+	return nil
+}
+
+// PublishRequest is not used by the benchmarks, and discards the message.
+func (c *conn) PublishRequest(subject, reply string, data []byte) error {
+	return nil
+}
+
+// ChanSubscribe subscribes to messages matching the subject pattern.
+func (c *conn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return c.ChanQueueSubscribe(subject, "", ch)
+}
+
+// ChanQueueSubscribe subscribes to messages matching the subject pattern.
+func (c *conn) ChanQueueSubscribe(subject, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{pattern: res.Pattern(subject), ch: ch})
+	c.mu.Unlock()
+	return &nats.Subscription{Subject: subject, Queue: queue}, nil
+}
+
+// Close closes the connection.
+func (c *conn) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+}
+
+// request sends a request message to the matching subscription, and returns a
+// channel on which the response will be sent.
+func (c *conn) request(subject string, data []byte) (chan []byte, bool) {
+	inbox := "_INBOX." + strconv.FormatUint(atomic.AddUint64(&c.inbox, 1), 10)
+	rch := make(chan []byte, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false
+	}
+	var ch chan *nats.Msg
+	for _, sub := range c.subs {
+		if sub.pattern.Matches(subject) {
+			ch = sub.ch
+			break
+		}
+	}
+	if ch == nil {
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.replies[inbox] = rch
+	c.mu.Unlock()
+	ch <- &nats.Msg{Subject: subject, Reply: inbox, Data: data}
+	return rch, true
+}
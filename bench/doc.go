@@ -0,0 +1,26 @@
+/*
+Package bench provides a harness for benchmarking res services end-to-end,
+without a NATS server.
+
+The harness serves the service on an in-memory connection, and sends requests
+the same way Resgate would, awaiting the response. It is used by the benchmarks
+in this package, and may be used to benchmark custom handler stacks under the
+same conditions.
+
+# Usage
+
+Benchmark a get request to a resource:
+
+	func BenchmarkGetBook(b *testing.B) {
+		s := res.NewService("library")
+		s.Handle("book.$id", res.GetModel(func(r res.ModelRequest) {
+			r.Model(Book{ID: r.PathParam("id")})
+		}))
+		bench.RunGet(b, s, "library.book.1")
+	}
+
+Run the benchmarks with:
+
+	go test -bench . ./bench/
+*/
+package bench
@@ -0,0 +1,196 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// DefaultTimeout is the duration the harness awaits a response or the service
+// to start before failing.
+const DefaultTimeout = 5 * time.Second
+
+// Harness serves a res.Service on an in-memory connection for benchmarking.
+//
+// All methods are safe for concurrent use, and may be called from within
+// testing.B.RunParallel.
+type Harness struct {
+	s    *res.Service
+	c    *conn
+	done chan error
+}
+
+// request is the request payload sent to the service.
+type request struct {
+	Params interface{} `json:"params,omitempty"`
+	Token  interface{} `json:"token,omitempty"`
+	Query  string      `json:"query,omitempty"`
+}
+
+// NewHarness starts serving the service on an in-memory connection, and
+// returns once the service is ready to handle requests.
+//
+// The service logger is disabled to avoid measuring logging.
+func NewHarness(s *res.Service) (*Harness, error) {
+	s.SetLogger(nil)
+	h := &Harness{
+		s:    s,
+		c:    newConn(),
+		done: make(chan error, 1),
+	}
+	go func() {
+		h.done <- s.Serve(h.c)
+	}()
+	select {
+	case <-h.c.ready:
+	case err := <-h.done:
+		if err == nil {
+			err = errors.New("bench: service stopped before ready")
+		}
+		return nil, err
+	case <-time.After(DefaultTimeout):
+		return nil, errors.New("bench: timeout waiting for service to start")
+	}
+	return h, nil
+}
+
+// Service returns the served service.
+func (h *Harness) Service() *res.Service {
+	return h.s
+}
+
+// Request sends a raw request to the service and returns the response
+// payload.
+func (h *Harness) Request(subject string, data []byte) ([]byte, error) {
+	ch, ok := h.c.request(subject, data)
+	if !ok {
+		return nil, errors.New("bench: no subscription for " + subject)
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-time.After(DefaultTimeout):
+		return nil, errors.New("bench: timeout waiting for response on " + subject)
+	}
+}
+
+// Get sends a get request for the resource ID and returns the response payload.
+//
+// The resource ID, rid, may contain a query part:
+//
+//	example.model?q=foo
+func (h *Harness) Get(rid string) ([]byte, error) {
+	rname, q := parseRID(rid)
+	return h.send("get."+rname, request{Query: q})
+}
+
+// Call sends a call request for the resource ID and method, and returns the
+// response payload.
+func (h *Harness) Call(rid, method string, params interface{}) ([]byte, error) {
+	rname, q := parseRID(rid)
+	return h.send("call."+rname+"."+method, request{Params: params, Query: q})
+}
+
+// Events returns the number of events published by the service.
+func (h *Harness) Events() uint64 {
+	return atomic.LoadUint64(&h.c.events)
+}
+
+// Close stops the service.
+func (h *Harness) Close() error {
+	return h.s.Shutdown()
+}
+
+func (h *Harness) send(subject string, req request) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return h.Request(subject, data)
+}
+
+// RunGet benchmarks get requests for the resource ID, rid, on the service.
+func RunGet(b *testing.B, s *res.Service, rid string) {
+	run(b, s, func(h *Harness) ([]byte, error) { return h.Get(rid) })
+}
+
+// RunCall benchmarks call requests for the resource ID, rid, and method on the
+// service.
+func RunCall(b *testing.B, s *res.Service, rid, method string, params interface{}) {
+	run(b, s, func(h *Harness) ([]byte, error) { return h.Call(rid, method, params) })
+}
+
+// RunParallelGet benchmarks get requests for the resource ID, rid, on the
+// service, sent in parallel by multiple goroutines.
+func RunParallelGet(b *testing.B, s *res.Service, rid string) {
+	h := start(b, s)
+	defer h.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if resp, err := h.Get(rid); err != nil {
+				b.Error(err)
+				return
+			} else if err = checkResponse(resp); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func run(b *testing.B, s *res.Service, req func(h *Harness) ([]byte, error)) {
+	h := start(b, s)
+	defer h.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := req(h)
+		if err == nil {
+			err = checkResponse(resp)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func start(b *testing.B, s *res.Service) *Harness {
+	h, err := NewHarness(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return h
+}
+
+// checkResponse returns an error if the response is an error response.
+func checkResponse(resp []byte) error {
+	if !bytes.HasPrefix(resp, []byte(`{"error":`)) {
+		return nil
+	}
+	var r struct {
+		Error *res.Error `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	return nil
+}
+
+func parseRID(rid string) (name string, query string) {
+	i := strings.IndexByte(rid, '?')
+	if i == -1 {
+		return rid, ""
+	}
+	return rid[:i], rid[i+1:]
+}
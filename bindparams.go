@@ -0,0 +1,162 @@
+package res
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// textUnmarshalerType is the reflect type of encoding.TextUnmarshaler.
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// BindParams binds the path parameters and query parameters of the resource
+// into the struct pointed to by v, converting the values to the field types.
+// Fields are bound using the path and query struct tags:
+//
+//	var p struct {
+//		ID    int      `path:"id"`
+//		Org   string   `path:"org"`
+//		Limit int      `query:"limit"`
+//		Tags  []string `query:"tag"`
+//	}
+//	if !r.BindParams(&p) {
+//		return
+//	}
+//
+// Fields may be of type string, bool, any integer or float type, or
+// implement encoding.TextUnmarshaler. Query fields may also be slices of
+// those types, binding all values of a repeated query parameter. Query
+// parameters missing from the query leave the field unchanged.
+//
+// If a path parameter cannot be converted, a system.notFound response is
+// sent, as no such resource exists. If the query is malformed, or a query
+// parameter cannot be converted, a system.invalidQuery response is sent, in
+// the same way as with QueryValues. In both cases, BindParams returns false.
+//
+// Panics if v is not a pointer to a struct, or if a path tag refers to a
+// placeholder not in the handler's pattern.
+func (r *Request) BindParams(v interface{}) bool {
+	if err := r.bindParams(v); err != nil {
+		r.Error(err)
+		return false
+	}
+	return true
+}
+
+// BindParams binds the path and query parameters into the struct pointed to
+// by v. See Request.BindParams.
+func (r *getRequest) BindParams(v interface{}) bool {
+	if err := r.bindParams(v); err != nil {
+		r.Error(err)
+		return false
+	}
+	return true
+}
+
+// bindParams binds the path and query parameters into the struct pointed to
+// by v, and returns the error to respond with on conversion failure.
+func (r *resource) bindParams(v interface{}) *Error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		panic("res: BindParams requires a non-nil pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	pathParams := r.PathParams()
+	var query url.Values
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if key, ok := f.Tag.Lookup("path"); ok {
+			s, ok := pathParams[key]
+			if !ok {
+				panic(fmt.Sprintf("res: BindParams field %s refers to missing path parameter %#v", f.Name, key))
+			}
+			if err := setParamValue(rv.Field(i), s); err != nil {
+				return ErrNotFound
+			}
+			continue
+		}
+		if key, ok := f.Tag.Lookup("query"); ok {
+			if query == nil {
+				var err error
+				if query, err = url.ParseQuery(r.query); err != nil {
+					return &Error{Code: CodeInvalidQuery, Message: "Invalid query: " + err.Error()}
+				}
+			}
+			vals, ok := query[key]
+			if !ok || len(vals) == 0 {
+				continue
+			}
+			if err := setQueryValue(rv.Field(i), vals); err != nil {
+				return &Error{Code: CodeInvalidQuery, Message: fmt.Sprintf("Invalid query parameter %#v: %s", key, err)}
+			}
+		}
+	}
+	return nil
+}
+
+// setQueryValue sets the field to the query parameter values. Slice fields,
+// other than []byte, are set to all values. Other fields are set to the last
+// value.
+func setQueryValue(fv reflect.Value, vals []string) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !isTextUnmarshaler(fv) {
+		sv := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := setParamValue(sv.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(sv)
+		return nil
+	}
+	return setParamValue(fv, vals[len(vals)-1])
+}
+
+// setParamValue converts the string into the type of the field, and sets it.
+func setParamValue(fv reflect.Value, s string) error {
+	if isTextUnmarshaler(fv) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		panic(fmt.Sprintf("res: BindParams unsupported field type %s", fv.Type()))
+	}
+	return nil
+}
+
+// isTextUnmarshaler returns true if a pointer to the field implements
+// encoding.TextUnmarshaler.
+func isTextUnmarshaler(fv reflect.Value) bool {
+	return reflect.PtrTo(fv.Type()).Implements(textUnmarshalerType)
+}
@@ -0,0 +1,174 @@
+package res
+
+import (
+	"sync"
+	"time"
+)
+
+// CappedValue is a value in a capped collection, with the time it was added.
+type CappedValue struct {
+	Value interface{} `json:"value"`
+	Time  time.Time   `json:"time"`
+}
+
+// CappedCollection is an Option setting a get handler for append-only
+// collections with retention, such as the last 100 log lines, or the last 24
+// hours of data points. It is created with NewCappedCollection:
+//
+//	feed := res.NewCappedCollection(100, 0)
+//	s.Handle("feed", feed)
+//
+//	s.With("example.feed", func(r res.Resource) {
+//		feed.AddCapped(r, "New log line")
+//	})
+//
+// Values are held in memory, and may be persisted by setting Load and Save.
+type CappedCollection struct {
+	// Load is an optional function loading the values of a collection the
+	// first time it is used. Expired values are trimmed after loading.
+	Load func(rname string) ([]CappedValue, error)
+	// Save is an optional function persisting the values of a collection after
+	// each change.
+	Save func(rname string, values []CappedValue) error
+
+	maxLen int
+	maxAge time.Duration
+	mu     sync.Mutex
+	colls  map[string][]CappedValue
+}
+
+var _ Option = &CappedCollection{}
+
+// NewCappedCollection returns a new CappedCollection keeping at most maxLen
+// values, no older than maxAge. A maxLen or maxAge of zero means no limit.
+//
+// Panics if maxLen or maxAge is less than zero.
+func NewCappedCollection(maxLen int, maxAge time.Duration) *CappedCollection {
+	if maxLen < 0 {
+		panic("res: negative capped collection length")
+	}
+	if maxAge < 0 {
+		panic("res: negative capped collection age")
+	}
+	return &CappedCollection{
+		maxLen: maxLen,
+		maxAge: maxAge,
+		colls:  make(map[string][]CappedValue),
+	}
+}
+
+// SetOption is to implement the Option interface.
+func (cc *CappedCollection) SetOption(h *Handler) {
+	if cc.colls == nil {
+		panic("res: CappedCollection not created with NewCappedCollection")
+	}
+	h.Option(GetCollection(cc.getCollection))
+}
+
+// AddCapped adds a value to the end of the collection, sending an add event,
+// and removes any values exceeding the length or age limit from its head,
+// sending a remove event for each.
+//
+// Must be called on the resource's worker goroutine, such as from a request
+// handler or a With callback.
+func (cc *CappedCollection) AddCapped(r Resource, v interface{}) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	rname := r.ResourceName()
+	now := r.Service().Clock().Now()
+	vals, err := cc.values(rname, now)
+	if err != nil {
+		return err
+	}
+	vals = append(vals, CappedValue{Value: v, Time: now})
+	r.AddEvent(v, len(vals)-1)
+	vals = cc.trim(r, vals, now)
+	return cc.set(rname, vals)
+}
+
+// Trim removes any values exceeding the age limit from the head of the
+// collection, sending a remove event for each. It may be called periodically to
+// expire values of collections that are not added to.
+//
+// Must be called on the resource's worker goroutine.
+func (cc *CappedCollection) Trim(r Resource) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	rname := r.ResourceName()
+	now := r.Service().Clock().Now()
+	vals, err := cc.values(rname, now)
+	if err != nil {
+		return err
+	}
+	l := len(vals)
+	vals = cc.trim(r, vals, now)
+	if len(vals) == l {
+		return nil
+	}
+	return cc.set(rname, vals)
+}
+
+func (cc *CappedCollection) getCollection(r CollectionRequest) {
+	cc.mu.Lock()
+	vals, err := cc.values(r.ResourceName(), r.Service().Clock().Now())
+	if err != nil {
+		cc.mu.Unlock()
+		r.Error(err)
+		return
+	}
+	coll := make([]interface{}, 0, len(vals))
+	for _, cv := range vals {
+		coll = append(coll, cv.Value)
+	}
+	cc.mu.Unlock()
+	r.Collection(coll)
+}
+
+// values returns the values of the collection, loading them if needed. Loaded
+// values are trimmed using now as current time.
+func (cc *CappedCollection) values(rname string, now time.Time) ([]CappedValue, error) {
+	if vals, ok := cc.colls[rname]; ok {
+		return vals, nil
+	}
+	var vals []CappedValue
+	if cc.Load != nil {
+		var err error
+		vals, err = cc.Load(rname)
+		if err != nil {
+			return nil, err
+		}
+		vals = cc.trim(nil, vals, now)
+	}
+	cc.colls[rname] = vals
+	return vals, nil
+}
+
+// trim removes values exceeding the limits from the head, using now as current
+// time, sending remove events on r, unless r is nil.
+func (cc *CappedCollection) trim(r Resource, vals []CappedValue, now time.Time) []CappedValue {
+	n := 0
+	if cc.maxLen > 0 && len(vals) > cc.maxLen {
+		n = len(vals) - cc.maxLen
+	}
+	if cc.maxAge > 0 {
+		limit := now.Add(-cc.maxAge)
+		for n < len(vals) && vals[n].Time.Before(limit) {
+			n++
+		}
+	}
+	if r != nil {
+		for i := 0; i < n; i++ {
+			r.RemoveEvent(0)
+		}
+	}
+	return vals[n:]
+}
+
+// set stores the values, and saves them if Save is set.
+func (cc *CappedCollection) set(rname string, vals []CappedValue) error {
+	cc.colls[rname] = vals
+	if cc.Save != nil {
+		return cc.Save(rname, vals)
+	}
+	return nil
+}
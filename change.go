@@ -0,0 +1,259 @@
+package res
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var errNotStructPointer = errors.New("res: model must be a non-nil pointer to a struct")
+
+// deletedSentinels holds the sentinel pointers returned by Deleted, keyed by
+// their element type.
+var deletedSentinels sync.Map
+
+// Deleted returns a sentinel pointer for the type T. When set as the value of
+// a pointer field in a struct passed to ChangeValues, the property is set to
+// DeleteAction in the resulting change map.
+//
+//	type BookChange struct {
+//		Title  *string `json:"title,omitempty"`
+//		Author *string `json:"author,omitempty"`
+//	}
+//	ch, _ := res.ChangeValues(BookChange{Author: res.Deleted[string]()})
+//	r.ChangeEvent(ch) // {"author":{"action":"delete"}}
+//
+// The sentinel must never be dereferenced or modified. T must not be a zero
+// sized type.
+func Deleted[T any]() *T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if v, ok := deletedSentinels.Load(t); ok {
+		return v.(*T)
+	}
+	v, _ := deletedSentinels.LoadOrStore(t, new(T))
+	return v.(*T)
+}
+
+// isDeleted returns true if the pointer value is the sentinel returned by
+// Deleted for its element type.
+func isDeleted(v reflect.Value) bool {
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	s, ok := deletedSentinels.Load(v.Type().Elem())
+	return ok && reflect.ValueOf(s).Pointer() == v.Pointer()
+}
+
+// ChangeValues converts a struct, or a pointer to a struct, into a change map
+// that may be passed to ChangeEvent. The map keys are the json names of the
+// fields.
+//
+// Pointer fields that are nil are left out, as unchanged, while pointer fields
+// set to the sentinel returned by Deleted are set to DeleteAction. Other
+// pointer fields are set to the value they point to. Fields of other types are
+// always included. Unexported fields, fields with the json tag "-", and fields
+// tagged `res:"private"`, are ignored.
+func ChangeValues(v interface{}) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, errors.New("res: change value is nil")
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("res: change value of type %s is not a struct", rv.Type())
+	}
+	ch := make(map[string]interface{})
+	for _, f := range structFields(rv.Type()) {
+		if f.private {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			if isDeleted(fv) {
+				ch[f.name] = DeleteAction
+				continue
+			}
+			fv = fv.Elem()
+		}
+		ch[f.name] = fv.Interface()
+	}
+	return ch, nil
+}
+
+// ApplyModelChange applies the changes to the model, which must be a pointer to
+// a struct, and returns a map with the values to apply to revert the changes.
+// It is intended to be used within ApplyChange handlers:
+//
+//	res.ApplyChange(func(r res.Resource, ch map[string]interface{}) (map[string]interface{}, error) {
+//		book := getBook(r.PathParam("id"))
+//		return res.ApplyModelChange(book, ch)
+//	})
+//
+// The change map keys are matched against the json names of the fields.
+// Fields tagged `res:"private"` are not part of the model, and cannot be
+// changed. A pointer field that is nil is considered a missing property. Changing it
+// produces a DeleteAction revert value, and applying a DeleteAction sets it to
+// nil. Applying a DeleteAction to a field of any other type sets it to its zero
+// value. Values that are equal to the current values are not applied, and not
+// included in the returned map.
+//
+// Values that are not assignable to the field type are converted by marshaling
+// them into json, and unmarshaling into the field.
+func ApplyModelChange(model interface{}, changes map[string]interface{}) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, errNotStructPointer
+	}
+	rv = rv.Elem()
+	fields := structFields(rv.Type())
+	byName := make(map[string][]int, len(fields))
+	for _, f := range fields {
+		if !f.private {
+			byName[f.name] = f.index
+		}
+	}
+
+	// Validate and convert all values before applying any of them.
+	type fieldChange struct {
+		name string
+		fv   reflect.Value
+		nv   reflect.Value // Invalid on delete
+	}
+	fcs := make([]fieldChange, 0, len(changes))
+	for k, v := range changes {
+		idx, ok := byName[k]
+		if !ok {
+			return nil, fmt.Errorf("res: unknown property %#v", k)
+		}
+		fc := fieldChange{name: k, fv: rv.FieldByIndex(idx)}
+		if v != DeleteAction {
+			nv, err := convertValue(v, fc.fv.Type())
+			if err != nil {
+				return nil, fmt.Errorf("res: invalid value for property %#v: %s", k, err)
+			}
+			fc.nv = nv
+		}
+		fcs = append(fcs, fc)
+	}
+
+	rev := make(map[string]interface{}, len(fcs))
+	for _, fc := range fcs {
+		isPtr := fc.fv.Kind() == reflect.Ptr
+		exists := !isPtr || !fc.fv.IsNil()
+		var old interface{}
+		if exists {
+			if isPtr {
+				old = fc.fv.Elem().Interface()
+			} else {
+				old = fc.fv.Interface()
+			}
+		}
+
+		if !fc.nv.IsValid() {
+			// Delete action
+			if !exists {
+				continue
+			}
+			fc.fv.Set(reflect.Zero(fc.fv.Type()))
+			rev[fc.name] = old
+			continue
+		}
+
+		if exists && valueEqual(fc.fv, fc.nv) {
+			continue
+		}
+		fc.fv.Set(fc.nv)
+		if exists {
+			rev[fc.name] = old
+		} else {
+			rev[fc.name] = DeleteAction
+		}
+	}
+	return rev, nil
+}
+
+// convertValue converts v into a value of type t. For pointer types, a new
+// pointer to the converted value is returned.
+func convertValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+	if t.Kind() == reflect.Ptr && rv.Type().AssignableTo(t.Elem()) {
+		p := reflect.New(t.Elem())
+		p.Elem().Set(rv)
+		return p, nil
+	}
+	dta, err := json.Marshal(v)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	p := reflect.New(t)
+	if err := json.Unmarshal(dta, p.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return p.Elem(), nil
+}
+
+// valueEqual returns true if the field value, fv, equals the new value, nv, of
+// the same type. Pointers are compared by the values they point to.
+func valueEqual(fv, nv reflect.Value) bool {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() || nv.IsNil() {
+			return fv.IsNil() == nv.IsNil()
+		}
+		fv, nv = fv.Elem(), nv.Elem()
+	}
+	return reflect.DeepEqual(fv.Interface(), nv.Interface())
+}
+
+// structField is a struct field with its json name.
+type structField struct {
+	name    string
+	index   []int
+	private bool // Field is tagged `res:"private"`
+}
+
+// structFields returns the exported fields of the struct type with their json
+// names. Fields of embedded structs without a json name are included as if
+// they were fields of the outer struct.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name = tag[:idx]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, ef := range structFields(f.Type) {
+				ef.index = append([]int{i}, ef.index...)
+				fields = append(fields, ef)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, index: []int{i}, private: isPrivateTag(f.Tag.Get("res"))})
+	}
+	return fields
+}
@@ -0,0 +1,145 @@
+package res
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ChangeBuilder builds a change map, validating each value as it is added.
+// It is created with NewChange:
+//
+//	err := res.NewChange().
+//		Set("title", "Dracula").
+//		Delete("author").
+//		SoftRef("owner", "library.user.42").
+//		Send(r)
+//
+// Once an invalid property or value is added, the builder keeps the first
+// error, ignores any further changes, and returns the error on Build or Send.
+type ChangeBuilder struct {
+	changes map[string]interface{}
+	err     error
+}
+
+// NewChange returns a new ChangeBuilder.
+func NewChange() *ChangeBuilder {
+	return &ChangeBuilder{changes: make(map[string]interface{})}
+}
+
+// Set sets the property key to the value v.
+//
+// The value must marshal into a json primitive, a resource reference, or a data
+// value. Objects and arrays must be wrapped in a DataValue. Use Delete to
+// delete a property.
+func (b *ChangeBuilder) Set(key string, v interface{}) *ChangeBuilder {
+	if b.err != nil {
+		return b
+	}
+	if err := validateChangeValue(v); err != nil {
+		b.setError(key, err)
+		return b
+	}
+	return b.set(key, v)
+}
+
+// Delete deletes the property key.
+func (b *ChangeBuilder) Delete(key string) *ChangeBuilder {
+	return b.set(key, DeleteAction)
+}
+
+// Ref sets the property key to a resource reference to rid.
+func (b *ChangeBuilder) Ref(key string, rid string) *ChangeBuilder {
+	if b.err == nil && !IsValidRID(rid) {
+		b.setError(key, fmt.Errorf("invalid resource ID %#v", rid))
+	}
+	return b.set(key, Ref(rid))
+}
+
+// SoftRef sets the property key to a soft resource reference to rid.
+func (b *ChangeBuilder) SoftRef(key string, rid string) *ChangeBuilder {
+	if b.err == nil && !IsValidRID(rid) {
+		b.setError(key, fmt.Errorf("invalid resource ID %#v", rid))
+	}
+	return b.set(key, SoftRef(rid))
+}
+
+// Err returns the first error encountered while building, or nil.
+func (b *ChangeBuilder) Err() error {
+	return b.err
+}
+
+// Build returns the change map, or the first error encountered while building.
+func (b *ChangeBuilder) Build() (map[string]interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.changes, nil
+}
+
+// Send builds the change map and sends it as a change event on the resource.
+// If no properties are changed, no event is sent. The event is not sent if an
+// error was encountered while building.
+//
+// Only valid for a model resource.
+func (b *ChangeBuilder) Send(r Resource) error {
+	ch, err := b.Build()
+	if err != nil {
+		return err
+	}
+	r.ChangeEvent(ch)
+	return nil
+}
+
+// set sets the property key to v, unless an error has been encountered.
+func (b *ChangeBuilder) set(key string, v interface{}) *ChangeBuilder {
+	if b.err != nil {
+		return b
+	}
+	if key == "" {
+		b.err = errors.New("res: change property key must not be empty")
+		return b
+	}
+	b.changes[key] = v
+	return b
+}
+
+// setError sets the builder error for the property key.
+func (b *ChangeBuilder) setError(key string, err error) {
+	b.err = fmt.Errorf("res: invalid value for property %#v: %s", key, err)
+}
+
+// validateChangeValue returns an error if v is not a valid change event value.
+func validateChangeValue(v interface{}) error {
+	if v == DeleteAction {
+		return nil
+	}
+	dta, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	switch dta[0] {
+	case '[':
+		return errors.New("arrays must be wrapped in a DataValue")
+	case '{':
+	default:
+		return nil
+	}
+	var o map[string]json.RawMessage
+	if err := json.Unmarshal(dta, &o); err != nil {
+		return err
+	}
+	if _, ok := o["data"]; ok && len(o) == 1 {
+		return nil
+	}
+	if rid, ok := o["rid"]; ok {
+		var s string
+		if json.Unmarshal(rid, &s) != nil || !IsValidRID(s) {
+			return fmt.Errorf("invalid resource reference %s", dta)
+		}
+		if soft, ok := o["soft"]; len(o) == 1 || (len(o) == 2 && ok && string(soft) == "true") {
+			return nil
+		}
+	}
+	return errors.New("objects must be wrapped in a DataValue")
+}
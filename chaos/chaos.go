@@ -0,0 +1,266 @@
+package chaos
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// Rule describes failures to inject for requests matching a resource pattern.
+type Rule struct {
+	// Pattern is the resource pattern to match. An empty pattern matches all
+	// resources.
+	Pattern res.Pattern
+
+	// Types is a list of request types ("access", "get", "call", or "auth") to
+	// match. If empty, all request types are matched.
+	Types []string
+
+	// Latency is the delay added before the request is passed to the service.
+	Latency time.Duration
+
+	// LatencyProbability is the probability, between 0 and 1, that Latency is
+	// added to a matching request.
+	LatencyProbability float64
+
+	// DropProbability is the probability, between 0 and 1, that the reply to a
+	// matching request is dropped after the request is handled.
+	DropProbability float64
+
+	// ErrorProbability is the probability, between 0 and 1, that a matching
+	// request is responded to with Error without being passed to the service.
+	ErrorProbability float64
+
+	// Error is the error response used for forced errors. If nil,
+	// res.ErrInternalError is used.
+	Error *res.Error
+}
+
+// Conn wraps a res.Conn and injects failures for incoming requests matching
+// the rules.
+//
+// It implements the res.Conn interface, and is used by passing it to
+// Service.Serve.
+type Conn struct {
+	res.Conn
+	rules  []Rule
+	mu     sync.Mutex
+	drops  map[string]struct{}
+	done   chan struct{}
+	fwdMu  sync.RWMutex // Held for reading while forwarding, and for writing when setting closed
+	closed bool
+	rndMu  sync.Mutex
+	rnd    func() float64
+}
+
+// Assert *Conn implements the res.Conn interface.
+var _ res.Conn = &Conn{}
+
+// NewConn creates a new Conn wrapping conn, injecting failures according to
+// the rules. For each request, the first matching rule is used.
+func NewConn(conn res.Conn, rules ...Rule) *Conn {
+	return &Conn{
+		Conn:  conn,
+		rules: rules,
+		drops: make(map[string]struct{}),
+		done:  make(chan struct{}),
+		rnd:   rand.Float64,
+	}
+}
+
+// SetRandom sets the function used to generate random numbers in the half-open
+// interval [0.0,1.0). Default is rand.Float64.
+//
+// Calls to rnd are serialized, and it need not be safe for concurrent use.
+func (c *Conn) SetRandom(rnd func() float64) *Conn {
+	c.rndMu.Lock()
+	c.rnd = rnd
+	c.rndMu.Unlock()
+	return c
+}
+
+// ChanSubscribe subscribes to messages matching the subject pattern.
+func (c *Conn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return c.ChanQueueSubscribe(subject, "", ch)
+}
+
+// ChanQueueSubscribe subscribes to messages matching the subject pattern.
+//
+// Subscriptions for request subjects are intercepted to inject failures. All
+// other subscriptions are passed to the underlying connection as is.
+func (c *Conn) ChanQueueSubscribe(subject, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	if !isRequestSubject(subject) {
+		if queue == "" {
+			return c.Conn.ChanSubscribe(subject, ch)
+		}
+		return c.Conn.ChanQueueSubscribe(subject, queue, ch)
+	}
+	in := make(chan *nats.Msg, cap(ch))
+	var sub *nats.Subscription
+	var err error
+	if queue == "" {
+		sub, err = c.Conn.ChanSubscribe(subject, in)
+	} else {
+		sub, err = c.Conn.ChanQueueSubscribe(subject, queue, in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	go c.listen(in, ch)
+	return sub, nil
+}
+
+// Publish publishes the data argument to the given subject. Replies to
+// requests flagged to be dropped are discarded.
+func (c *Conn) Publish(subject string, payload []byte) error {
+	c.mu.Lock()
+	_, drop := c.drops[subject]
+	// Only drop the final response, and not any pre-response.
+	if drop && len(payload) > 0 && payload[0] == '{' {
+		delete(c.drops, subject)
+	}
+	c.mu.Unlock()
+	if drop {
+		return nil
+	}
+	return c.Conn.Publish(subject, payload)
+}
+
+// Close closes the underlying connection, and stops intercepting requests.
+// Requests delayed by latency are discarded.
+func (c *Conn) Close() {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	c.mu.Unlock()
+	// Wait for any ongoing forward to return, as the service closes its
+	// channel once the connection is closed.
+	c.fwdMu.Lock()
+	c.closed = true
+	c.fwdMu.Unlock()
+	c.Conn.Close()
+}
+
+// listen forwards incoming messages from in to out, injecting failures.
+func (c *Conn) listen(in, out chan *nats.Msg) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case m := <-in:
+			c.handle(m, out)
+		}
+	}
+}
+
+// handle injects failures for a single request before forwarding it.
+func (c *Conn) handle(m *nats.Msg, out chan *nats.Msg) {
+	rule := c.match(m.Subject)
+	if rule == nil {
+		c.forward(m, out)
+		return
+	}
+	if c.hit(rule.ErrorProbability) {
+		rerr := rule.Error
+		if rerr == nil {
+			rerr = res.ErrInternalError
+		}
+		data, err := json.Marshal(struct {
+			Error *res.Error `json:"error"`
+		}{rerr})
+		if err == nil && m.Reply != "" {
+			c.Conn.Publish(m.Reply, data)
+		}
+		return
+	}
+	if m.Reply != "" && c.hit(rule.DropProbability) {
+		c.mu.Lock()
+		c.drops[m.Reply] = struct{}{}
+		c.mu.Unlock()
+	}
+	if rule.Latency > 0 && c.hit(rule.LatencyProbability) {
+		time.AfterFunc(rule.Latency, func() { c.forward(m, out) })
+		return
+	}
+	c.forward(m, out)
+}
+
+// forward passes the message to the service channel unless the connection is
+// closed.
+func (c *Conn) forward(m *nats.Msg, out chan *nats.Msg) {
+	c.fwdMu.RLock()
+	defer c.fwdMu.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case <-c.done:
+	case out <- m:
+	}
+}
+
+// hit returns true with the probability p.
+func (c *Conn) hit(p float64) bool {
+	if p >= 1 {
+		return true
+	}
+	if p <= 0 {
+		return false
+	}
+	c.rndMu.Lock()
+	defer c.rndMu.Unlock()
+	return c.rnd() < p
+}
+
+// match returns the first rule matching the request subject, or nil if no rule
+// matches.
+func (c *Conn) match(subject string) *Rule {
+	idx := strings.IndexByte(subject, '.')
+	if idx < 0 {
+		return nil
+	}
+	rtype := subject[:idx]
+	rname := subject[idx+1:]
+	if rtype == res.RequestTypeCall || rtype == res.RequestTypeAuth {
+		if idx = strings.LastIndexByte(rname, '.'); idx >= 0 {
+			rname = rname[:idx]
+		}
+	}
+	for i := range c.rules {
+		r := &c.rules[i]
+		if r.Pattern != "" && !r.Pattern.Matches(rname) {
+			continue
+		}
+		if len(r.Types) > 0 && !containsString(r.Types, rtype) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func isRequestSubject(subject string) bool {
+	for _, t := range []string{res.RequestTypeAccess, res.RequestTypeGet, res.RequestTypeCall, res.RequestTypeAuth} {
+		if strings.HasPrefix(subject, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
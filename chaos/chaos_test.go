@@ -0,0 +1,94 @@
+package chaos_test
+
+import (
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/chaos"
+	"github.com/jirenius/go-res/restest"
+)
+
+func serve(t *testing.T, rules ...chaos.Rule) (*restest.MockConn, func()) {
+	s := res.NewService("test")
+	s.SetLogger(nil)
+	s.Handle("model", res.Call("method", func(r res.CallRequest) { r.OK(nil) }))
+	c := restest.NewMockConn(t, nil)
+	go s.Serve(chaos.NewConn(c, rules...))
+	c.GetMsg().AssertSubject("system.reset")
+	return c, func() { s.Shutdown() }
+}
+
+func TestConn_WithoutMatchingRule_PassesRequest(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Pattern: "test.other", ErrorProbability: 1})
+	defer stop()
+	c.Call("test.model", "method", nil).
+		Response().
+		AssertResult(nil)
+}
+
+func TestConn_WithErrorProbability_RespondsWithError(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Pattern: "test.model", ErrorProbability: 1, Error: res.ErrTimeout})
+	defer stop()
+	c.Call("test.model", "method", nil).
+		Response().
+		AssertError(res.ErrTimeout)
+}
+
+func TestConn_WithNonMatchingType_PassesRequest(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Types: []string{"get"}, ErrorProbability: 1})
+	defer stop()
+	c.Call("test.model", "method", nil).
+		Response().
+		AssertResult(nil)
+}
+
+func TestConn_WithDropProbability_DropsReply(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Pattern: "test.>", DropProbability: 1})
+	defer stop()
+	c.Call("test.model", "method", nil)
+	c.AssertNoMsg(50 * time.Millisecond)
+}
+
+func TestConn_WithLatency_DelaysRequest(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Latency: 50 * time.Millisecond, LatencyProbability: 1})
+	defer stop()
+	start := time.Now()
+	c.Call("test.model", "method", nil).
+		Response().
+		AssertResult(nil)
+	restest.AssertTrue(t, "response to be delayed", time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestConn_ClosedDuringLatency_DiscardsRequest(t *testing.T) {
+	c, stop := serve(t, chaos.Rule{Latency: 50 * time.Millisecond, LatencyProbability: 1})
+	c.Call("test.model", "method", nil)
+	stop()
+	// Wait for the delayed request to be forwarded after the service has
+	// closed its channel.
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestConn_SetRandom_WithConcurrentRequests_SerializesCalls(t *testing.T) {
+	calls := 0
+	s := res.NewService("test")
+	s.SetLogger(nil)
+	s.Handle("model", res.Access(res.AccessGranted), res.Call("method", func(r res.CallRequest) { r.OK(nil) }))
+	c := restest.NewMockConn(t, nil)
+	cc := chaos.NewConn(c, chaos.Rule{ErrorProbability: 0.5}).SetRandom(func() float64 {
+		calls++
+		return 0.9
+	})
+	go s.Serve(cc)
+	c.GetMsg().AssertSubject("system.reset")
+	defer s.Shutdown()
+	// Access and call requests are intercepted by different listeners
+	for i := 0; i < 10; i++ {
+		c.Request("access.test.model", nil)
+		c.Call("test.model", "method", nil)
+	}
+	for i := 0; i < 20; i++ {
+		c.GetMsg()
+	}
+	restest.AssertEqualJSON(t, "random calls", calls, 20)
+}
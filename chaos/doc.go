@@ -0,0 +1,30 @@
+/*
+Package chaos provides failure injection for res services, to be used in test
+and staging environments to validate client retry behavior and gateway timeout
+handling.
+
+Failures are injected by wrapping the NATS connection used by the service.
+Incoming requests matching a rule may be delayed, have their replies dropped,
+or be responded to with an error without reaching the service.
+
+# Usage
+
+Wrap the connection and serve the service:
+
+	nc, _ := nats.Connect("nats://127.0.0.1:4222")
+	conn := chaos.NewConn(nc,
+		chaos.Rule{
+			Pattern:            "example.slow.>",
+			Latency:            2 * time.Second,
+			LatencyProbability: 0.1,
+		},
+		chaos.Rule{
+			Pattern:          "example.>",
+			Types:            []string{"call"},
+			DropProbability:  0.01,
+			ErrorProbability: 0.01,
+		},
+	)
+	s.Serve(conn)
+*/
+package chaos
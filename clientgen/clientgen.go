@@ -0,0 +1,293 @@
+package clientgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+
+	res "github.com/jirenius/go-res"
+)
+
+// Config holds the client generation configuration.
+type Config struct {
+	// Package is the package name of the generated code. Required.
+	Package string
+
+	// Include is a list of full resource patterns, including service name, to
+	// generate methods for. If empty, methods are generated for all resources.
+	Include []string
+
+	// Types maps full resource patterns to a value of the Go type of the
+	// resource. Resources without type metadata are returned as
+	// json.RawMessage.
+	Types map[string]interface{}
+
+	// Params maps full resource patterns, followed by a dot and the method
+	// name, to a value of the Go type of the call or auth params. Methods
+	// without type metadata take params of type interface{}.
+	Params map[string]interface{}
+
+	// Results maps full resource patterns, followed by a dot and the method
+	// name, to a value of the Go type of the call or auth result. Methods
+	// without type metadata return json.RawMessage.
+	Results map[string]interface{}
+}
+
+// generator holds the state of the code being generated.
+type generator struct {
+	cfg     Config
+	methods bytes.Buffer
+	types   *typeSet
+	names   map[string]bool
+	json    bool // Flag telling if encoding/json is used
+}
+
+// handlerPattern is a registered handler with its full resource pattern.
+type handlerPattern struct {
+	pattern string
+	h       res.Handler
+}
+
+// Generate generates the source of a typed client package for the service,
+// formatted with gofmt.
+//
+// It must be called after all handlers are registered.
+func Generate(s *res.Service, cfg Config) ([]byte, error) {
+	if !token.IsIdentifier(cfg.Package) {
+		return nil, errors.New("clientgen: invalid package name")
+	}
+	g := &generator{
+		cfg:   cfg,
+		types: newTypeSet(),
+		names: make(map[string]bool),
+	}
+
+	include := make(map[string]bool, len(cfg.Include))
+	for _, p := range cfg.Include {
+		include[p] = true
+	}
+	var hps []handlerPattern
+	s.Walk(func(p res.Pattern, h res.Handler) {
+		if len(include) > 0 && !include[string(p)] {
+			return
+		}
+		hps = append(hps, handlerPattern{pattern: string(p), h: h})
+	})
+	sort.Slice(hps, func(i, j int) bool { return hps[i].pattern < hps[j].pattern })
+
+	fp := s.FullPath()
+	for _, hp := range hps {
+		name, args, ok := resourceName(hp.pattern, fp)
+		if !ok {
+			continue
+		}
+		if hp.h.Get != nil {
+			g.getMethod(hp, name, args)
+		}
+		for _, m := range sortedKeys(hp.h.Call) {
+			if m != "*" {
+				g.requestMethod("Call", "call", "calls", hp.pattern, name, args, m)
+			}
+		}
+		for _, m := range sortedKeys(hp.h.Auth) {
+			if m != "*" {
+				g.requestMethod("Auth", "auth", "sends an auth request to", hp.pattern, name, args, m)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by clientgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", cfg.Package)
+	b.WriteString("import (\n")
+	if g.json {
+		b.WriteString("\t\"encoding/json\"\n")
+	}
+	b.WriteString("\t\"time\"\n\n\tres \"github.com/jirenius/go-res\"\n\t\"github.com/jirenius/go-res/resprot\"\n)\n\n")
+	b.WriteString("// Client is a client for sending requests to the " + fp + " service.\n")
+	b.WriteString("type Client struct {\n\tconn    res.Conn\n\ttimeout time.Duration\n}\n\n")
+	b.WriteString("// NewClient returns a new Client sending requests on the connection, with\n// the timeout duration for each request.\n")
+	b.WriteString("func NewClient(conn res.Conn, timeout time.Duration) *Client {\n\treturn &Client{conn: conn, timeout: timeout}\n}\n")
+	b.Write(g.methods.Bytes())
+	b.WriteString(g.types.String())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("clientgen: error formatting generated code: %s", err)
+	}
+	return src, nil
+}
+
+// getMethod generates a method for a get request.
+func (g *generator) getMethod(hp handlerPattern, name string, args []string) {
+	mname := g.methodName("Get" + name)
+	typ := g.typeOf(name, g.cfg.Types[hp.pattern])
+	parse := "ParseModel"
+	if hp.h.Type == res.TypeCollection {
+		parse = "ParseCollection"
+	}
+	fmt.Fprintf(&g.methods, "\n// %s gets the resource %s.\n", mname, hp.pattern)
+	fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) (%s, error) {\n", mname, argList(args), typ)
+	fmt.Fprintf(&g.methods, "\tvar v %s\n", typ)
+	fmt.Fprintf(&g.methods, "\t_, err := resprot.SendRequest(c.conn, %s, nil, c.timeout).%s(&v)\n", subjectExpr("get", hp.pattern, args, ""), parse)
+	g.methods.WriteString("\treturn v, err\n}\n")
+}
+
+// requestMethod generates a method for a call or auth request.
+func (g *generator) requestMethod(prefix, rtype, desc, pattern, name string, args []string, method string) {
+	mname := g.methodName(prefix + name + exportName(goIdent(method)))
+	key := pattern + "." + method
+	ptyp := "interface{}"
+	if v, ok := g.cfg.Params[key]; ok {
+		ptyp = g.typeOf(name+exportName(goIdent(method))+"Params", v)
+	}
+	rtyp := g.typeOf(name+exportName(goIdent(method))+"Result", g.cfg.Results[key])
+	fmt.Fprintf(&g.methods, "\n// %s %s the method %s on the resource %s.\n", mname, desc, method, pattern)
+	fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) (%s, error) {\n", mname, argList(append(args[:len(args):len(args)], "params "+ptyp)), rtyp)
+	fmt.Fprintf(&g.methods, "\tvar v %s\n", rtyp)
+	fmt.Fprintf(&g.methods, "\terr := resprot.SendRequest(c.conn, %s, resprot.Request{Params: params}, c.timeout).ParseResult(&v)\n", subjectExpr(rtype, pattern, args, method))
+	g.methods.WriteString("\treturn v, err\n}\n")
+}
+
+// typeOf returns the Go type expression for the value v, or json.RawMessage if
+// v is nil.
+func (g *generator) typeOf(name string, v interface{}) string {
+	if v == nil {
+		g.json = true
+		return "json.RawMessage"
+	}
+	typ := g.types.typeOf(name, v)
+	if g.types.json {
+		g.json = true
+	}
+	return typ
+}
+
+// methodName returns a unique method name.
+func (g *generator) methodName(name string) string {
+	if g.names[name] {
+		for i := 2; ; i++ {
+			if n := fmt.Sprintf("%s%d", name, i); !g.names[n] {
+				name = n
+				break
+			}
+		}
+	}
+	g.names[name] = true
+	return name
+}
+
+// resourceName returns the exported name and argument names for a full
+// pattern, or false if the pattern contains wildcards.
+func resourceName(p, fp string) (string, []string, bool) {
+	if fp != "" {
+		if p == fp {
+			p = ""
+		} else if !strings.HasPrefix(p, fp+".") {
+			return "", nil, false
+		} else {
+			p = p[len(fp)+1:]
+		}
+	}
+	var sb strings.Builder
+	var args []string
+	if p != "" {
+		for _, t := range strings.Split(p, ".") {
+			switch {
+			case t == "*" || t == ">":
+				return "", nil, false
+			case t[0] == '$':
+				args = append(args, t[1:])
+			default:
+				sb.WriteString(exportName(goIdent(t)))
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Root")
+	}
+	return sb.String(), args, true
+}
+
+// subjectExpr returns a Go expression building the request subject for the
+// pattern, with tags replaced by the arguments of the same name.
+func subjectExpr(rtype, pattern string, args []string, method string) string {
+	var parts []string
+	lit := rtype
+	for _, t := range strings.Split(pattern, ".") {
+		if t[0] == '$' {
+			parts = append(parts, fmt.Sprintf("%q", lit+"."), argName(t[1:]))
+			lit = ""
+			continue
+		}
+		if lit != "" {
+			lit += "."
+		} else {
+			lit = "."
+		}
+		lit += t
+	}
+	if method != "" {
+		lit += "." + method
+	}
+	if lit != "" {
+		parts = append(parts, fmt.Sprintf("%q", lit))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// argList returns the argument list for the tag arguments, with the extra
+// arguments appended.
+func argList(args []string) string {
+	l := make([]string, len(args))
+	for i, a := range args {
+		if strings.Contains(a, " ") {
+			l[i] = a
+		} else {
+			l[i] = argName(a) + " string"
+		}
+	}
+	return strings.Join(l, ", ")
+}
+
+// argName returns a valid Go argument name for a tag.
+func argName(tag string) string {
+	n := goIdent(tag)
+	if token.IsKeyword(n) || n == "c" || n == "v" || n == "err" || n == "params" {
+		n += "Arg"
+	}
+	return n
+}
+
+// goIdent replaces characters not valid in a Go identifier with underscores.
+func goIdent(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// exportName returns the name with the first letter in upper case.
+func exportName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
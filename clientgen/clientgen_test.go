@@ -0,0 +1,133 @@
+package clientgen_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/clientgen"
+)
+
+type book struct {
+	ID     int      `json:"id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Author author   `json:"author"`
+	secret string
+}
+
+type author struct {
+	Name string `json:"name"`
+}
+
+type setParams struct {
+	Title string `json:"title,omitempty"`
+}
+
+func newService() *res.Service {
+	s := res.NewService("library")
+	s.Handle("book.$id",
+		res.GetModel(func(r res.ModelRequest) { r.NotFound() }),
+		res.Call("set", func(r res.CallRequest) { r.OK(nil) }),
+		res.Call("delete", func(r res.CallRequest) { r.OK(nil) }),
+	)
+	s.Handle("books", res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }))
+	s.Handle("user.$type", res.Auth("login", func(r res.AuthRequest) { r.OK(nil) }))
+	s.Handle("other.>", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	return s
+}
+
+// srcImporter imports the packages used by generated code from source. It is
+// shared by the tests to type-check each dependency only once.
+var srcImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// typeCheck asserts that the generated code parses and type-checks.
+func typeCheck(t *testing.T, src []byte) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "client.go", src, 0)
+	if err != nil {
+		t.Fatalf("expected generated code to parse, but got error: %s\n%s", err, src)
+	}
+	conf := types.Config{Importer: srcImporter}
+	if _, err := conf.Check("client", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("expected generated code to type-check, but got error: %s\n%s", err, src)
+	}
+}
+
+func TestGenerate_GeneratesClient(t *testing.T) {
+	src, err := clientgen.Generate(newService(), clientgen.Config{
+		Package: "libraryclient",
+		Types: map[string]interface{}{
+			"library.book.$id": book{},
+			"library.books":    []res.Ref{},
+		},
+		Params: map[string]interface{}{
+			"library.book.$id.set": setParams{},
+		},
+		Results: map[string]interface{}{
+			"library.user.$type.login": "",
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	typeCheck(t, src)
+	code := string(src)
+	for _, exp := range []string{
+		"// Code generated by clientgen. DO NOT EDIT.",
+		"package libraryclient",
+		"\"encoding/json\"",
+		"func NewClient(conn res.Conn, timeout time.Duration) *Client",
+		"func (c *Client) GetBook(id string) (Book, error)",
+		"resprot.SendRequest(c.conn, \"get.library.book.\"+id, nil, c.timeout).ParseModel(&v)",
+		"func (c *Client) CallBookSet(id string, params SetParams) (json.RawMessage, error)",
+		"resprot.SendRequest(c.conn, \"call.library.book.\"+id+\".set\", resprot.Request{Params: params}, c.timeout).ParseResult(&v)",
+		"func (c *Client) CallBookDelete(id string, params interface{}) (json.RawMessage, error)",
+		"func (c *Client) GetBooks() ([]res.Ref, error)",
+		").ParseCollection(&v)",
+		"func (c *Client) AuthUserLogin(typeArg string, params interface{}) (string, error)",
+		"\"auth.library.user.\"+typeArg+\".login\"",
+		"type Book struct {",
+		"Author Author",
+		"type Author struct {",
+		"Title string `json:\"title,omitempty\"`",
+	} {
+		if !strings.Contains(code, exp) {
+			t.Errorf("expected generated code to contain:\n\t%s\nbut got:\n%s", exp, code)
+		}
+	}
+	for _, unexp := range []string{"secret", "Other"} {
+		if strings.Contains(code, unexp) {
+			t.Errorf("expected generated code not to contain %q, but got:\n%s", unexp, code)
+		}
+	}
+}
+
+func TestGenerate_WithInclude_GeneratesIncludedOnly(t *testing.T) {
+	src, err := clientgen.Generate(newService(), clientgen.Config{
+		Package: "libraryclient",
+		Include: []string{"library.books"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	typeCheck(t, src)
+	code := string(src)
+	if !strings.Contains(code, "func (c *Client) GetBooks() (json.RawMessage, error)") {
+		t.Errorf("expected GetBooks method, but got:\n%s", code)
+	}
+	if strings.Contains(code, "GetBook(") {
+		t.Errorf("expected GetBook to be excluded, but got:\n%s", code)
+	}
+}
+
+func TestGenerate_InvalidPackage_ReturnsError(t *testing.T) {
+	if _, err := clientgen.Generate(newService(), clientgen.Config{Package: "not valid"}); err == nil {
+		t.Errorf("expected an error, but got none")
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Package clientgen generates typed Go clients for res services, for other
+services to use when making requests to them.
+
+The client is generated from the handlers registered to a service, with a
+method for each get handler, call method, and auth method. The methods send
+requests using the resprot package, and parse the responses into the types
+provided in the configuration. Resources, params, and results without type
+metadata use json.RawMessage or interface{}.
+
+Method names are made from the request type and the static parts of the
+resource pattern, with an argument for each placeholder tag. Patterns with
+anonymous (*) or full (>) wildcards are skipped.
+
+# Usage
+
+Write a program that registers the handlers, and writes the generated client
+to a file:
+
+	s := res.NewService("library")
+	s.Handle("book.$id",
+		res.GetModel(getBook),
+		res.Call("set", setBook),
+	)
+	src, err := clientgen.Generate(s, clientgen.Config{
+		Package: "libraryclient",
+		Types: map[string]interface{}{
+			"library.book.$id": Book{},
+		},
+		Params: map[string]interface{}{
+			"library.book.$id.set": BookParams{},
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.WriteFile("libraryclient/client.go", src, 0644)
+
+The generated client is used by other services:
+
+	c := libraryclient.NewClient(conn, 5*time.Second)
+	book, err := c.GetBook("42")
+	_, err = c.CallBookSet("42", libraryclient.BookParams{Title: "Dracula"})
+*/
+package clientgen
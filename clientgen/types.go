@@ -0,0 +1,154 @@
+package clientgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	res "github.com/jirenius/go-res"
+)
+
+var (
+	refType        = reflect.TypeOf(res.Ref(""))
+	softRefType    = reflect.TypeOf(res.SoftRef(""))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// typeSet holds the struct type definitions of the generated code.
+type typeSet struct {
+	defs  map[string]string
+	order []string
+	named map[reflect.Type]string
+	json  bool // Flag telling if json.RawMessage is used
+}
+
+func newTypeSet() *typeSet {
+	return &typeSet{
+		defs:  make(map[string]string),
+		named: make(map[reflect.Type]string),
+	}
+}
+
+// typeOf returns the Go type expression for the value v, generating struct
+// types using name as type name for anonymous structs.
+func (ts *typeSet) typeOf(name string, v interface{}) string {
+	return ts.goType(name, reflect.TypeOf(v))
+}
+
+func (ts *typeSet) goType(name string, t reflect.Type) string {
+	switch t {
+	case nil, rawMessageType:
+		return ts.rawMessage()
+	case refType:
+		return "res.Ref"
+	case softRefType:
+		return "res.SoftRef"
+	}
+	if t.Kind() == reflect.Ptr {
+		return "*" + ts.goType(name, t.Elem())
+	}
+	// Types with custom marshaling have unknown JSON structure.
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return ts.rawMessage()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.Kind().String()
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "[]byte"
+		}
+		return "[]" + ts.goType(name+"Item", t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), ts.goType(name+"Item", t.Elem()))
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return "map[string]" + ts.goType(name+"Value", t.Elem())
+		}
+	case reflect.Interface:
+		return "interface{}"
+	case reflect.Struct:
+		return ts.structType(name, t)
+	}
+	return ts.rawMessage()
+}
+
+func (ts *typeSet) rawMessage() string {
+	ts.json = true
+	return "json.RawMessage"
+}
+
+// structType generates a struct type definition for the struct type, and
+// returns its name. Named struct types keep their name.
+func (ts *typeSet) structType(name string, t reflect.Type) string {
+	if n, ok := ts.named[t]; ok {
+		return n
+	}
+	if t.Name() != "" {
+		name = exportName(goIdent(t.Name()))
+	}
+	if _, ok := ts.defs[name]; ok {
+		for i := 2; ; i++ {
+			n := fmt.Sprintf("%s%d", name, i)
+			if _, ok := ts.defs[n]; !ok {
+				name = n
+				break
+			}
+		}
+	}
+	// Reserve the name to handle recursive types.
+	ts.named[t] = name
+	ts.defs[name] = ""
+	ts.order = append(ts.order, name)
+	var sb strings.Builder
+	sb.WriteString("\ntype " + name + " struct {\n")
+	ts.writeFields(&sb, name, t)
+	sb.WriteString("}\n")
+	ts.defs[name] = sb.String()
+	return name
+}
+
+// writeFields writes the exported fields of the struct type, flattening
+// embedded structs without a JSON name.
+func (ts *typeSet) writeFields(sb *strings.Builder, name string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && (!hasTag || strings.Split(tag, ",")[0] == "") {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(marshalerType) {
+				ts.writeFields(sb, name, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		sb.WriteString("\t" + f.Name + " " + ts.goType(name+f.Name, f.Type))
+		if hasTag {
+			sb.WriteString(" `json:" + strconv.Quote(tag) + "`")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// String returns the type definitions in the order they were generated.
+func (ts *typeSet) String() string {
+	var sb strings.Builder
+	for _, n := range ts.order {
+		sb.WriteString(ts.defs[n])
+	}
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package res
+
+import "time"
+
+// Clock is the source of time used by the service for query event
+// expiration, automatic timeouts, access deduplication, throttling,
+// resource expiry, and other scheduling. It may be replaced with
+// Service.SetClock, such as with a restest.MockClock, to make time dependent
+// behavior deterministic in tests and simulation runs.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc waits for the duration to elapse and then calls f in its own
+	// goroutine. It returns a Timer that can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a scheduled call created by Clock.AfterFunc. It is implemented by
+// time.Timer.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns true if the call stops
+	// the timer, or false if the timer has already fired or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock using the system time, as provided by the time
+// package. It is the default clock of a service.
+var SystemClock Clock = systemClock{}
+
+// systemClock implements Clock using the time package.
+type systemClock struct{}
+
+// Now returns time.Now().
+func (systemClock) Now() time.Time { return time.Now() }
+
+// AfterFunc calls time.AfterFunc.
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// SetClock sets the clock used by the service. Default is SystemClock.
+//
+// Panics if service is already started.
+func (s *Service) SetClock(c Clock) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if c == nil {
+		panic("res: nil clock")
+	}
+	s.clock = c
+	return s
+}
+
+// Clock returns the clock used by the service. It lets handlers and other
+// subsystems schedule work using the same clock as the service.
+func (s *Service) Clock() Clock {
+	return s.clock
+}
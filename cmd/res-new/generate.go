@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Store backends.
+const (
+	storeMemory = "memory"
+	storeBadger = "badger"
+)
+
+var nameRegexp = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// config holds the settings for generating a project.
+type config struct {
+	Name      string
+	Module    string
+	Resources []string
+	Store     string
+	Dir       string
+}
+
+// resource is a resource as used in the templates.
+type resource struct {
+	Name string // Resource name part, eg. "book"
+	Type string // Go type name, eg. "Book"
+}
+
+// project is the data passed to the templates.
+type project struct {
+	Name      string
+	Module    string
+	Resources []resource
+	Badger    bool
+}
+
+// file is a file to generate.
+type file struct {
+	name string
+	tmpl *template.Template
+	data interface{}
+}
+
+func (cfg config) dir() string {
+	if cfg.Dir != "" {
+		return cfg.Dir
+	}
+	return cfg.Name
+}
+
+// validate returns an error if the configuration is invalid.
+func (cfg config) validate() error {
+	if !nameRegexp.MatchString(cfg.Name) {
+		return fmt.Errorf("invalid service name %q: must start with a lower case letter and contain only letters and digits", cfg.Name)
+	}
+	if len(cfg.Resources) == 0 {
+		return errors.New("no resources")
+	}
+	seen := make(map[string]bool, len(cfg.Resources))
+	for _, r := range cfg.Resources {
+		if !nameRegexp.MatchString(r) {
+			return fmt.Errorf("invalid resource name %q: must start with a lower case letter and contain only letters and digits", r)
+		}
+		if seen[r] {
+			return fmt.Errorf("duplicate resource name %q", r)
+		}
+		// Resource files must not collide with the fixed files.
+		if r == "main" || r == "service" {
+			return fmt.Errorf("reserved resource name %q", r)
+		}
+		seen[r] = true
+	}
+	if cfg.Store != storeMemory && cfg.Store != storeBadger {
+		return fmt.Errorf("unknown store %q: must be %s or %s", cfg.Store, storeMemory, storeBadger)
+	}
+	return nil
+}
+
+// generate writes the project files to the output directory, and returns the
+// paths of the created files. It fails without writing anything if any of the
+// files already exists.
+func generate(cfg config) ([]string, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	p := project{
+		Name:   cfg.Name,
+		Module: cfg.Module,
+		Badger: cfg.Store == storeBadger,
+	}
+	if p.Module == "" {
+		p.Module = cfg.Name
+	}
+	for _, r := range cfg.Resources {
+		p.Resources = append(p.Resources, resource{
+			Name: r,
+			Type: strings.ToUpper(r[:1]) + r[1:],
+		})
+	}
+
+	files := []file{
+		{"go.mod", goModTemplate, p},
+		{"main.go", mainTemplate, p},
+		{"service.go", serviceTemplate, p},
+		{"service_test.go", serviceTestTemplate, p},
+		{"Dockerfile", dockerfileTemplate, p},
+	}
+	for _, r := range p.Resources {
+		files = append(files, file{r.Name + ".go", resourceTemplate, r})
+	}
+
+	// Render all files before writing, so that a template error leaves no
+	// partial project behind.
+	dir := cfg.dir()
+	paths := make([]string, len(files))
+	contents := make([][]byte, len(files))
+	for i, f := range files {
+		b, err := f.render()
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = filepath.Join(dir, f.name)
+		contents[i] = b
+		if _, err := os.Stat(paths[i]); err == nil {
+			return nil, fmt.Errorf("file %s already exists", paths[i])
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for i, path := range paths {
+		if err := os.WriteFile(path, contents[i], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// render executes the file template, and formats the result if it is a Go
+// source file.
+func (f file) render() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, f.data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %s", f.name, err)
+	}
+	if !strings.HasSuffix(f.name, ".go") {
+		return buf.Bytes(), nil
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %s: %s", f.name, err)
+	}
+	return b, nil
+}
+
+// splitList splits a comma separated list, trimming spaces and dropping empty
+// items.
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
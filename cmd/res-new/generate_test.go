@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate_CreatesProjectFiles(t *testing.T) {
+	for _, st := range []string{storeMemory, storeBadger} {
+		dir := filepath.Join(t.TempDir(), "library")
+		files, err := generate(config{
+			Name:      "library",
+			Module:    "example.com/library",
+			Resources: []string{"book", "author"},
+			Store:     st,
+			Dir:       dir,
+		})
+		if err != nil {
+			t.Fatalf("store %s: unexpected error: %s", st, err)
+		}
+		expected := []string{"go.mod", "main.go", "service.go", "service_test.go", "Dockerfile", "book.go", "author.go"}
+		if len(files) != len(expected) {
+			t.Fatalf("store %s: expected %d files, but got %v", st, len(expected), files)
+		}
+		for i, name := range expected {
+			if files[i] != filepath.Join(dir, name) {
+				t.Errorf("store %s: expected file %s, but got %s", st, filepath.Join(dir, name), files[i])
+			}
+		}
+
+		mustContain(t, filepath.Join(dir, "go.mod"), "module example.com/library")
+		mustContain(t, filepath.Join(dir, "service.go"), `s.Handle("book.$id", &BookHandler{Store: st.Book})`)
+		mustContain(t, filepath.Join(dir, "service_test.go"), `s.Get("library.author.1")`)
+		mustContain(t, filepath.Join(dir, "author.go"), "type AuthorHandler struct")
+		if st == storeBadger {
+			mustContain(t, filepath.Join(dir, "main.go"), `badgerstore.NewStore(db).SetType(Book{}).SetPrefix("book")`)
+		} else {
+			mustContain(t, filepath.Join(dir, "main.go"), "mockstore.NewStore()")
+		}
+	}
+}
+
+func TestGenerate_ExistingFile_ReturnsError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := generate(config{Name: "library", Resources: []string{"book"}, Store: storeMemory, Dir: dir})
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		t.Error("expected no files to be written")
+	}
+}
+
+func TestGenerate_InvalidConfig_ReturnsError(t *testing.T) {
+	tbl := []config{
+		{Name: "", Resources: []string{"book"}, Store: storeMemory},
+		{Name: "my-service", Resources: []string{"book"}, Store: storeMemory},
+		{Name: "library", Resources: nil, Store: storeMemory},
+		{Name: "library", Resources: []string{"Book"}, Store: storeMemory},
+		{Name: "library", Resources: []string{"book", "book"}, Store: storeMemory},
+		{Name: "library", Resources: []string{"main"}, Store: storeMemory},
+		{Name: "library", Resources: []string{"book"}, Store: "mongo"},
+	}
+	for i, cfg := range tbl {
+		cfg.Dir = t.TempDir()
+		if _, err := generate(cfg); err == nil {
+			t.Errorf("test %d: expected an error, but got none", i)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	l := splitList(" book, ,author,")
+	if len(l) != 2 || l[0] != "book" || l[1] != "author" {
+		t.Errorf("expected [book author], but got %v", l)
+	}
+}
+
+func mustContain(t *testing.T, path, s string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), s) {
+		t.Errorf("expected %s to contain:\n%s\nbut got:\n%s", path, s, b)
+	}
+}
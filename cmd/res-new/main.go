@@ -0,0 +1,72 @@
+/*
+Res-new is a command line tool that scaffolds a new RES service project.
+
+The generated project contains:
+
+	main.go          Service setup with signal handling and graceful shutdown
+	service.go       Service constructor registering all resource handlers
+	<resource>.go    Model type and handler for each resource
+	service_test.go  Tests using the restest package
+	Dockerfile       Multi-stage build of the service
+	go.mod           Module file
+
+Each resource is served as a model, "<service>.<resource>.$id", backed by a
+store. The memory store keeps the models in memory, while the badger store
+persists them in a badgerDB database.
+
+Usage:
+
+	res-new [flags] <service name>
+
+Flags:
+
+	-module string      Module path (default is the service name)
+	-resources string   Comma separated list of resource names (default "item")
+	-store string       Store backend: memory or badger (default "memory")
+	-o string           Output directory (default is the service name)
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var cfg config
+	var resources string
+	fs := flag.NewFlagSet("res-new", flag.ExitOnError)
+	fs.StringVar(&cfg.Module, "module", "", "Module path (default is the service name)")
+	fs.StringVar(&resources, "resources", "item", "Comma separated list of resource names")
+	fs.StringVar(&cfg.Store, "store", storeMemory, "Store backend: memory or badger")
+	fs.StringVar(&cfg.Dir, "o", "", "Output directory (default is the service name)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg.Name = fs.Arg(0)
+	cfg.Resources = splitList(resources)
+
+	files, err := generate(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "res-new: %s\n", err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fmt.Println("created", f)
+	}
+	fmt.Printf("\nRun the following to get started:\n\n\tcd %s\n\tgo mod tidy\n\tgo test ./...\n", cfg.dir())
+}
+
+const usage = `Usage: res-new [flags] <service name>
+
+Scaffolds a new RES service project.
+
+Flags:`
@@ -0,0 +1,166 @@
+package main
+
+import "text/template"
+
+var goModTemplate = template.Must(template.New("go.mod").Parse(`module {{.Module}}
+
+go 1.18
+`))
+
+var mainTemplate = template.Must(template.New("main.go").Parse(`// The {{.Name}} service.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+{{if .Badger}}
+	"github.com/dgraph-io/badger"
+	"github.com/jirenius/go-res/store/badgerstore"
+{{else}}
+	"github.com/jirenius/go-res/store/mockstore"
+{{end}})
+
+func main() {
+	natsURL := flag.String("nats", "nats://127.0.0.1:4222", "NATS server URL")
+{{- if .Badger}}
+	dbPath := flag.String("db", "./db", "BadgerDB directory")
+{{- end}}
+	flag.Parse()
+{{if .Badger}}
+	// Open the badger DB
+	db, err := badger.Open(badger.DefaultOptions(*dbPath).WithTruncate(true))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// Create stores persisted in the badger DB
+	st := Stores{
+{{- range .Resources}}
+		{{.Type}}: badgerstore.NewStore(db).SetType({{.Type}}{}).SetPrefix("{{.Name}}"),
+{{- end}}
+	}
+{{else}}
+	// Create in-memory stores. Replace them with a persistent store
+	// implementation, such as badgerstore, to keep data between restarts.
+	st := Stores{
+{{- range .Resources}}
+		{{.Type}}: mockstore.NewStore(),
+{{- end}}
+	}
+{{end}}
+	s := newService(st)
+
+	// Serve until an interrupt or termination signal, and shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Run(ctx, *natsURL); err != nil {
+		log.Fatal(err)
+	}
+}
+`))
+
+var serviceTemplate = template.Must(template.New("service.go").Parse(`package main
+
+import (
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/store"
+)
+
+// Stores holds the stores used by the service.
+type Stores struct {
+{{- range .Resources}}
+	{{.Type}} store.Store
+{{- end}}
+}
+
+// newService creates the {{.Name}} service and registers its handlers.
+func newService(st Stores) *res.Service {
+	s := res.NewService("{{.Name}}")
+{{- range .Resources}}
+	s.Handle("{{.Name}}.$id", &{{.Type}}Handler{Store: st.{{.Type}}})
+{{- end}}
+	return s
+}
+`))
+
+var resourceTemplate = template.Must(template.New("resource.go").Parse(`package main
+
+import (
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/store"
+)
+
+// {{.Type}} represents a {{.Name}} model.
+type {{.Type}} struct {
+	ID string ` + "`json:\"id\"`" + `
+}
+
+// {{.Type}}Handler is a handler for {{.Name}} requests.
+type {{.Type}}Handler struct {
+	Store store.Store
+}
+
+// SetOption sets the res.Handler options.
+func (h *{{.Type}}Handler) SetOption(rh *res.Handler) {
+	rh.Option(
+		res.Model,
+		res.Access(res.AccessGranted),
+		store.Handler{Store: h.Store, Transformer: store.IDTransformer("id", nil)},
+	)
+}
+`))
+
+var serviceTestTemplate = template.Must(template.New("service_test.go").Parse(`package main
+
+import (
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/store/mockstore"
+)
+
+func newTestStores() Stores {
+	return Stores{
+{{- range .Resources}}
+		{{.Type}}: mockstore.NewStore().Add("1", {{.Type}}{ID: "1"}),
+{{- end}}
+	}
+}
+{{range .Resources}}
+func TestGet{{.Type}}_ReturnsModel(t *testing.T) {
+	s := restest.NewSession(t, newService(newTestStores()))
+	defer s.Close()
+
+	s.Get("{{$.Name}}.{{.Name}}.1").
+		Response().
+		AssertModel({{.Type}}{ID: "1"})
+}
+
+func TestGet{{.Type}}_NotFound(t *testing.T) {
+	s := restest.NewSession(t, newService(newTestStores()))
+	defer s.Close()
+
+	s.Get("{{$.Name}}.{{.Name}}.missing").
+		Response().
+		AssertError(res.ErrNotFound)
+}
+{{end}}`))
+
+var dockerfileTemplate = template.Must(template.New("Dockerfile").Parse(`FROM golang:1.18-alpine AS build
+WORKDIR /src
+COPY go.mod go.sum ./
+RUN go mod download
+COPY . .
+RUN CGO_ENABLED=0 go build -o /{{.Name}} .
+
+FROM alpine
+COPY --from=build /{{.Name}} /{{.Name}}
+ENTRYPOINT ["/{{.Name}}"]
+CMD ["-nats", "nats://nats:4222"]
+`))
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+	nats "github.com/nats-io/nats.go"
+)
+
+// config holds the command configuration.
+type config struct {
+	url     string
+	token   string
+	cid     string
+	timeout time.Duration
+	raw     bool
+	out     io.Writer
+	stop    chan os.Signal
+}
+
+// run executes the command given by args.
+func run(nc res.Conn, cfg config, args []string) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		if len(args) != 1 {
+			return errors.New("usage: get <rid>")
+		}
+		rname, q := parseRID(args[0])
+		return request(nc, cfg, "get."+rname, resprot.Request{Query: q})
+	case "call", "auth":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: %s <rid> <method> [params]", cmd)
+		}
+		req, err := newRequest(cfg, args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			if !json.Valid([]byte(args[2])) {
+				return errors.New("params is not valid JSON")
+			}
+			req.Params = json.RawMessage(args[2])
+		}
+		rname, _ := parseRID(args[0])
+		return request(nc, cfg, cmd+"."+rname+"."+args[1], req)
+	case "access":
+		if len(args) != 1 {
+			return errors.New("usage: access <rid>")
+		}
+		req, err := newRequest(cfg, args[0])
+		if err != nil {
+			return err
+		}
+		rname, _ := parseRID(args[0])
+		return request(nc, cfg, "access."+rname, req)
+	case "watch":
+		if len(args) != 1 {
+			return errors.New("usage: watch <rid>")
+		}
+		return watch(nc, cfg, args[0])
+	case "reset":
+		if len(args) > 2 {
+			return errors.New("usage: reset [resources] [access]")
+		}
+		var ev resprot.ResetEvent
+		if len(args) > 0 {
+			ev.Resources = splitList(args[0])
+		}
+		if len(args) > 1 {
+			ev.Access = splitList(args[1])
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return nc.Publish("system.reset", data)
+	}
+	return fmt.Errorf("unknown command %#v", cmd)
+}
+
+// newRequest creates a request with the configured token and connection ID.
+func newRequest(cfg config, rid string) (resprot.Request, error) {
+	_, q := parseRID(rid)
+	req := resprot.Request{CID: cfg.cid, Query: q}
+	if cfg.token != "" {
+		if !json.Valid([]byte(cfg.token)) {
+			return req, errors.New("token is not valid JSON")
+		}
+		req.Token = json.RawMessage(cfg.token)
+	}
+	return req, nil
+}
+
+// request sends a request and prints the response.
+func request(nc res.Conn, cfg config, subject string, req resprot.Request) error {
+	resp := resprot.SendRequest(nc, subject, req, cfg.timeout)
+	if cfg.raw {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cfg.out, "%s\n", data)
+		return nil
+	}
+	return printResponse(cfg.out, resp)
+}
+
+// printResponse pretty-prints a response.
+func printResponse(w io.Writer, resp resprot.Response) error {
+	if resp.HasError() {
+		fmt.Fprintf(w, "Error: %s (%s)\n", resp.Error.Message, resp.Error.Code)
+		if resp.Error.Data != nil {
+			if data, err := json.MarshalIndent(resp.Error.Data, "", "  "); err == nil {
+				fmt.Fprintf(w, "%s\n", data)
+			}
+		}
+		return nil
+	}
+	if resp.HasResource() {
+		fmt.Fprintf(w, "Resource: %s\n", resp.Resource)
+		return nil
+	}
+	var gr resprot.GetResult
+	if err := json.Unmarshal(resp.Result, &gr); err == nil && (gr.Model != nil || gr.Collection != nil) {
+		if gr.Model != nil {
+			fmt.Fprintln(w, "Model:")
+			return printIndented(w, gr.Model)
+		}
+		var col []json.RawMessage
+		if err := json.Unmarshal(gr.Collection, &col); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "Collection:")
+		for i, v := range col {
+			fmt.Fprintf(w, "  [%d] %s\n", i, v)
+		}
+		return nil
+	}
+	if len(resp.Result) == 0 || string(resp.Result) == "null" {
+		fmt.Fprintln(w, "Result: null")
+		return nil
+	}
+	fmt.Fprintln(w, "Result:")
+	return printIndented(w, resp.Result)
+}
+
+// watch subscribes to events for the resource, and prints them until
+// interrupted.
+func watch(nc res.Conn, cfg config, rid string) error {
+	rname, _ := parseRID(rid)
+	ch := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe("event."+rname+".>", ch)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	fmt.Fprintf(cfg.out, "Watching events for %s\n", rname)
+	for {
+		select {
+		case <-cfg.stop:
+			return nil
+		case m := <-ch:
+			printEvent(cfg.out, rname, m)
+		}
+	}
+}
+
+// printEvent prints an event message.
+func printEvent(w io.Writer, rname string, m *nats.Msg) {
+	ev := strings.TrimPrefix(m.Subject, "event."+rname+".")
+	var buf bytes.Buffer
+	if len(m.Data) == 0 || json.Compact(&buf, m.Data) != nil {
+		fmt.Fprintf(w, "%s %s\n", time.Now().Format("15:04:05.000"), ev)
+		return
+	}
+	fmt.Fprintf(w, "%s %s %s\n", time.Now().Format("15:04:05.000"), ev, buf.Bytes())
+}
+
+func printIndented(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func parseRID(rid string) (name string, query string) {
+	i := strings.IndexByte(rid, '?')
+	if i == -1 {
+		return rid, ""
+	}
+	return rid[:i], rid[i+1:]
+}
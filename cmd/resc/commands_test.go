@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jirenius/go-res/resprot"
+	nats "github.com/nats-io/nats.go"
+)
+
+// publishConn is a connection recording published messages.
+type publishConn struct {
+	subject string
+	data    []byte
+}
+
+func (c *publishConn) Publish(subject string, payload []byte) error {
+	c.subject, c.data = subject, payload
+	return nil
+}
+func (c *publishConn) PublishRequest(subject, reply string, data []byte) error { return nil }
+func (c *publishConn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return &nats.Subscription{}, nil
+}
+func (c *publishConn) ChanQueueSubscribe(subject, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return &nats.Subscription{}, nil
+}
+func (c *publishConn) Close() {}
+
+func TestPrintResponse(t *testing.T) {
+	tbl := []struct {
+		Response string
+		Expected string
+	}{
+		{`{"result":{"model":{"foo":"bar"}}}`, "Model:\n{\n  \"foo\": \"bar\"\n}\n"},
+		{`{"result":{"collection":["foo",{"rid":"test.model"}]}}`, "Collection:\n  [0] \"foo\"\n  [1] {\"rid\":\"test.model\"}\n"},
+		{`{"result":{"foo":42}}`, "Result:\n{\n  \"foo\": 42\n}\n"},
+		{`{"result":null}`, "Result: null\n"},
+		{`{"resource":{"rid":"test.model"}}`, "Resource: test.model\n"},
+		{`{"error":{"code":"system.notFound","message":"Not found"}}`, "Error: Not found (system.notFound)\n"},
+	}
+	for i, l := range tbl {
+		var buf bytes.Buffer
+		if err := printResponse(&buf, resprot.ParseResponse([]byte(l.Response))); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", i, err)
+		}
+		if buf.String() != l.Expected {
+			t.Errorf("test %d: expected:\n%s\nbut got:\n%s", i, l.Expected, buf.String())
+		}
+	}
+}
+
+func TestRunReset_PublishesSystemReset(t *testing.T) {
+	c := &publishConn{}
+	if err := run(c, config{}, []string{"reset", "test.>,other.>", "test.>"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.subject != "system.reset" {
+		t.Errorf("expected subject system.reset, but got %s", c.subject)
+	}
+	if string(c.data) != `{"resources":["test.\u003e","other.\u003e"],"access":["test.\u003e"]}` {
+		t.Errorf("unexpected payload: %s", c.data)
+	}
+}
+
+func TestRun_WithInvalidArguments_ReturnsError(t *testing.T) {
+	for _, args := range [][]string{
+		{"unknown"},
+		{"get"},
+		{"call", "test.model"},
+		{"call", "test.model", "method", "{invalid"},
+		{"access"},
+		{"watch"},
+		{"reset", "a", "b", "c"},
+	} {
+		if err := run(&publishConn{}, config{}, args); err == nil {
+			t.Errorf("expected error for arguments %v, but got none", args)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Resc is a command line tool for sending requests to RES services over NATS,
+and watching resource events.
+
+Usage:
+
+	resc [flags] <command> [arguments]
+
+Commands:
+
+	get <rid>                        Get a resource
+	call <rid> <method> [params]     Call a method on a resource
+	auth <rid> <method> [params]     Send an auth request to a resource
+	access <rid>                     Get access for a resource
+	watch <rid>                      Print events for a resource
+	reset [resources] [access]       Send a system.reset event with comma
+	                                 separated lists of resource patterns
+
+Flags:
+
+	-s string        NATS server URL (default "nats://127.0.0.1:4222")
+	-token string    Access token as JSON
+	-cid string      Connection ID (default "resc")
+	-timeout value   Request timeout (default 5s)
+	-raw             Print the raw response
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func main() {
+	cfg := config{out: os.Stdout}
+	fs := flag.NewFlagSet("resc", flag.ExitOnError)
+	fs.StringVar(&cfg.url, "s", nats.DefaultURL, "NATS server URL")
+	fs.StringVar(&cfg.token, "token", "", "Access token as JSON")
+	fs.StringVar(&cfg.cid, "cid", "resc", "Connection ID")
+	fs.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "Request timeout")
+	fs.BoolVar(&cfg.raw, "raw", false, "Print the raw response")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	nc, err := nats.Connect(cfg.url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resc: failed to connect to %s: %s\n", cfg.url, err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	cfg.stop = stop
+
+	if err := run(nc, cfg, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "resc: %s\n", err)
+		nc.Close()
+		os.Exit(1)
+	}
+}
+
+const usage = `Usage: resc [flags] <command> [arguments]
+
+Commands:
+  get <rid>                        Get a resource
+  call <rid> <method> [params]     Call a method on a resource
+  auth <rid> <method> [params]     Send an auth request to a resource
+  access <rid>                     Get access for a resource
+  watch <rid>                      Print events for a resource
+  reset [resources] [access]       Send a system.reset event
+
+Flags:`
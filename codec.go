@@ -29,15 +29,22 @@ type resourceResponse struct {
 	Meta     *metaObject `json:"meta,omitempty"`
 }
 
+type resourceResultResponse struct {
+	Resource Ref         `json:"resource"`
+	Result   interface{} `json:"result"`
+	Meta     *metaObject `json:"meta,omitempty"`
+}
+
 type errorResponse struct {
 	Error *Error      `json:"error"`
 	Meta  *metaObject `json:"meta,omitempty"`
 }
 
 type accessResponse struct {
-	Get  bool        `json:"get,omitempty"`
-	Call string      `json:"call,omitempty"`
-	Meta *metaObject `json:"meta,omitempty"`
+	Get      bool        `json:"get,omitempty"`
+	Call     string      `json:"call,omitempty"`
+	Duration int64       `json:"duration,omitempty"`
+	Meta     *metaObject `json:"meta,omitempty"`
 }
 
 type modelResponse struct {
@@ -0,0 +1,133 @@
+package res
+
+import "sync"
+
+// SourcePolicy is the policy for handling a model source that fails to fetch
+// its properties.
+type SourcePolicy int
+
+// Source failure policies.
+const (
+	// SourceRequired responds to the get request with the source error.
+	SourceRequired SourcePolicy = iota
+	// SourceOptional omits the properties of the source from the model.
+	SourceOptional
+	// SourceNullable sets the properties listed in the source's Props to nil.
+	SourceNullable
+)
+
+// ModelSource is a backend providing a subset of the properties of a composed
+// model.
+type ModelSource struct {
+	// Name of the source, used in logs.
+	Name string
+
+	// Fetch returns the properties provided by the source for the requested
+	// model. If a nil map is returned without error, the source has no
+	// properties for the model.
+	Fetch func(r ModelRequest) (map[string]interface{}, error)
+
+	// OnFailure is the policy used when Fetch returns an error.
+	OnFailure SourcePolicy
+
+	// Props lists the properties provided by the source. Used by the
+	// SourceNullable policy.
+	Props []string
+
+	// Watch is an optional function called the first time the service is
+	// ready, with an update function that the source calls whenever properties
+	// of a model changes in the backend. Each update results in a change event.
+	// Watch is not called again if the service is served again.
+	Watch func(update func(rid string, props map[string]interface{}))
+}
+
+// ComposedModel is an Option setting a get handler for a model resource
+// whose properties are assembled from multiple sources, such as a profile
+// fetched from a database and a status fetched from a cache:
+//
+//	s.Handle("user.$id", res.ComposedModel{
+//		{Name: "profile", Fetch: fetchProfile},
+//		{Name: "status", Fetch: fetchStatus, OnFailure: res.SourceOptional},
+//	})
+//
+// Sources are fetched in order, and properties of a later source overwrite
+// those of an earlier one. If no source has any properties, the model is not
+// found.
+type ComposedModel []ModelSource
+
+var _ Option = ComposedModel{}
+
+// SetOption is to implement the Option interface.
+func (cm ComposedModel) SetOption(h *Handler) {
+	for _, src := range cm {
+		if src.Fetch == nil {
+			panic("res: no Fetch set for model source " + src.Name)
+		}
+	}
+	h.Option(
+		GetModel(cm.getModel),
+		OnRegister(cm.onRegister),
+	)
+}
+
+func (cm ComposedModel) getModel(r ModelRequest) {
+	var model map[string]interface{}
+	for _, src := range cm {
+		props, err := src.Fetch(r)
+		if err != nil {
+			switch src.OnFailure {
+			case SourceOptional:
+				r.Service().errorf("Error fetching source %s for model %s: %s", src.Name, r.ResourceName(), err)
+				continue
+			case SourceNullable:
+				r.Service().errorf("Error fetching source %s for model %s: %s", src.Name, r.ResourceName(), err)
+				props = make(map[string]interface{}, len(src.Props))
+				for _, p := range src.Props {
+					props[p] = nil
+				}
+			default:
+				r.Error(err)
+				return
+			}
+		}
+		if props == nil {
+			continue
+		}
+		if model == nil {
+			model = make(map[string]interface{}, len(props))
+		}
+		for k, v := range props {
+			model[k] = v
+		}
+	}
+	if model == nil {
+		r.NotFound()
+		return
+	}
+	r.Model(model)
+}
+
+func (cm ComposedModel) onRegister(s *Service, p Pattern, h Handler) {
+	update := func(rid string, props map[string]interface{}) {
+		if len(props) == 0 {
+			return
+		}
+		if !p.Matches(rid) {
+			s.errorf("Composed model update for %s not matching pattern %s", rid, p)
+			return
+		}
+		if err := s.With(rid, func(r Resource) { r.ChangeEvent(props) }); err != nil {
+			s.errorf("Error sending composed model update for %s: %s", rid, err)
+		}
+	}
+	for _, src := range cm {
+		if src.Watch != nil {
+			watch := src.Watch
+			var once sync.Once
+			s.OnReady(func(*Service) error {
+				once.Do(func() { watch(update) })
+				return nil
+			})
+		}
+	}
+}
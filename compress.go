@@ -0,0 +1,126 @@
+package res
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// maxDecompressedSize is the maximum size of a decompressed request payload.
+const maxDecompressedSize = 64 << 20
+
+// NATS message headers used to negotiate payload compression.
+const (
+	headerContentEncoding = "Content-Encoding"
+	headerAcceptEncoding  = "Accept-Encoding"
+	encodingGzip          = "gzip"
+)
+
+var errDecompressedTooLarge = errors.New("res: decompressed payload too large")
+
+// msgPublisher is implemented by connections able to publish messages with
+// headers, such as nats.Conn.
+type msgPublisher interface {
+	PublishMsg(m *nats.Msg) error
+}
+
+// SetCompression sets the minimum size in bytes of a response payload to
+// compress with gzip, when replying to a request accepting a compressed
+// response. Default is 0, meaning responses are never compressed.
+//
+// Compression is negotiated using NATS message headers. A request with the
+// header "Content-Encoding: gzip" is decompressed before being handled, and a
+// request with the header "Accept-Encoding: gzip" may be replied to with a
+// gzip compressed response, flagged with the "Content-Encoding: gzip" header.
+// Requests are compressed by other services, such as when using
+// resprot.SendCompressedRequest, to reduce NATS bandwidth for large payloads.
+// Compressed requests are always decompressed, regardless of this setting,
+// while requests from Resgate are never compressed.
+//
+// Responses are only compressed if the connection supports publishing
+// messages with headers, as nats.Conn does.
+//
+// If minSize is less than zero, 0 is used.
+func (s *Service) SetCompression(minSize int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if minSize < 0 {
+		minSize = 0
+	}
+	s.compressMin = minSize
+	return s
+}
+
+// acceptsGzip returns true if the header has an Accept-Encoding value listing
+// gzip.
+func acceptsGzip(h nats.Header) bool {
+	for _, v := range h.Values(headerAcceptEncoding) {
+		for _, enc := range strings.Split(v, ",") {
+			if strings.TrimSpace(enc) == encodingGzip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gunzip decompresses gzip compressed data, returning an error if it is
+// invalid or exceeds the limit. A limit of 0 means maxDecompressedSize is used.
+func gunzip(data []byte, limit int) ([]byte, error) {
+	if limit <= 0 || limit > maxDecompressedSize {
+		limit = maxDecompressedSize
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, errDecompressedTooLarge
+	}
+	return out, nil
+}
+
+// wireData returns the payload as published in the reply, and true if it is
+// compressed. The payload is compressed if the request accepts a compressed
+// response, the connection supports headers, and the payload is large enough.
+func (r *Request) wireData(payload []byte) ([]byte, bool) {
+	if r.acceptGzip && r.s.compressMin > 0 && len(payload) >= r.s.compressMin {
+		if _, ok := r.s.nc.(msgPublisher); ok {
+			return gzipPayload(payload), true
+		}
+	}
+	return payload, false
+}
+
+// gzipPayload compresses the payload with gzip.
+func gzipPayload(payload []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	// Writing to a bytes.Buffer never fails.
+	_, _ = zw.Write(payload)
+	_ = zw.Close()
+	return b.Bytes()
+}
+
+// publishReply publishes the reply data, flagging it with a Content-Encoding
+// header if it is compressed.
+func (s *Service) publishReply(reply string, data []byte, compressed bool) error {
+	if compressed {
+		return s.nc.(msgPublisher).PublishMsg(&nats.Msg{
+			Subject: reply,
+			Header:  nats.Header{headerContentEncoding: []string{encodingGzip}},
+			Data:    data,
+		})
+	}
+	return s.nc.Publish(reply, data)
+}
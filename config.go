@@ -0,0 +1,257 @@
+package res
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jirenius/go-res/logger"
+	nats "github.com/nats-io/nats.go"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvServiceName   = "RES_SERVICE_NAME"
+	EnvNatsURL       = "RES_NATS_URL"
+	EnvNatsCreds     = "RES_NATS_CREDS"
+	EnvWorkerCount   = "RES_WORKER_COUNT"
+	EnvQueryDuration = "RES_QUERY_DURATION"
+	EnvLogLevel      = "RES_LOG_LEVEL"
+	EnvResources     = "RES_RESOURCES"
+	EnvAccess        = "RES_ACCESS"
+)
+
+// Log levels used in Config.
+const (
+	LogLevelTrace = "trace"
+	LogLevelInfo  = "info"
+	LogLevelError = "error"
+	LogLevelNone  = "none"
+)
+
+// Config holds operational settings for a service, allowing deployments to
+// tune a service without code changes. A Config is usually loaded with
+// ConfigFromEnv or LoadConfig, and used with NewServiceFromConfig:
+//
+//	cfg, err := res.ConfigFromEnv()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	s, err := res.NewServiceFromConfig(cfg)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	// Add handlers
+//	s.ListenAndServe(cfg.NatsURL, cfg.NatsOptions()...)
+//
+// Zero values leave the service defaults unchanged.
+type Config struct {
+	// Name is the service name. See NewService.
+	Name string `json:"name"`
+	// NatsURL is the URL of the NATS server. Set to nats.DefaultURL by
+	// ConfigFromEnv and LoadConfig, unless provided.
+	NatsURL string `json:"natsUrl"`
+	// NatsCreds is the path to a NATS user credentials file.
+	NatsCreds string `json:"natsCreds"`
+	// WorkerCount is the number of workers. See Service.SetWorkerCount.
+	WorkerCount int `json:"workerCount"`
+	// QueryDuration is the duration to listen for query requests on a query
+	// event. See Service.SetQueryEventDuration. In JSON, it is a duration
+	// string, such as "3s".
+	QueryDuration time.Duration `json:"-"`
+	// LogLevel is the lowest level of entries to log. It is one of "trace",
+	// "info", "error", or "none". Defaults to "info".
+	LogLevel string `json:"logLevel"`
+	// Resources are the resource patterns owned by the service. See
+	// Service.SetOwnedResources.
+	Resources []string `json:"resources"`
+	// Access are the access patterns owned by the service. See
+	// Service.SetOwnedResources.
+	Access []string `json:"access"`
+}
+
+// configJSON is the JSON representation of Config.
+type configJSON struct {
+	*configAlias
+	QueryDuration string `json:"queryDuration,omitempty"`
+}
+
+type configAlias Config
+
+// UnmarshalJSON is to implement the json.Unmarshaler interface.
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	v := configJSON{configAlias: (*configAlias)(cfg)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.QueryDuration != "" {
+		d, err := time.ParseDuration(v.QueryDuration)
+		if err != nil {
+			return fmt.Errorf("invalid queryDuration: %s", err)
+		}
+		cfg.QueryDuration = d
+	}
+	return nil
+}
+
+// MarshalJSON is to implement the json.Marshaler interface.
+func (cfg Config) MarshalJSON() ([]byte, error) {
+	v := configJSON{configAlias: (*configAlias)(&cfg)}
+	if cfg.QueryDuration != 0 {
+		v.QueryDuration = cfg.QueryDuration.String()
+	}
+	return json.Marshal(v)
+}
+
+// LoadConfig reads a JSON encoded Config from the file at path.
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{NatsURL: nats.DefaultURL}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// ConfigFromEnv returns a Config read from the environment variables:
+//
+//	RES_SERVICE_NAME    Service name
+//	RES_NATS_URL        NATS server URL
+//	RES_NATS_CREDS      NATS user credentials file
+//	RES_WORKER_COUNT    Number of workers
+//	RES_QUERY_DURATION  Query event duration, such as "3s"
+//	RES_LOG_LEVEL       Log level: trace, info, error, or none
+//	RES_RESOURCES       Comma separated owned resource patterns
+//	RES_ACCESS          Comma separated owned access patterns
+//
+// Unset variables leave the corresponding fields unchanged.
+func ConfigFromEnv() (Config, error) {
+	return Config{NatsURL: nats.DefaultURL}.WithEnv()
+}
+
+// WithEnv returns a copy of the Config with the values of any set environment
+// variables read by ConfigFromEnv overriding the existing values. It may be
+// used to let the environment override a loaded config file.
+func (cfg Config) WithEnv() (Config, error) {
+	if v, ok := os.LookupEnv(EnvServiceName); ok {
+		cfg.Name = v
+	}
+	if v, ok := os.LookupEnv(EnvNatsURL); ok {
+		cfg.NatsURL = v
+	}
+	if v, ok := os.LookupEnv(EnvNatsCreds); ok {
+		cfg.NatsCreds = v
+	}
+	if v, ok := os.LookupEnv(EnvWorkerCount); ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %s", EnvWorkerCount, err)
+		}
+		cfg.WorkerCount = n
+	}
+	if v, ok := os.LookupEnv(EnvQueryDuration); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %s", EnvQueryDuration, err)
+		}
+		cfg.QueryDuration = d
+	}
+	if v, ok := os.LookupEnv(EnvLogLevel); ok {
+		cfg.LogLevel = v
+	}
+	if v, ok := os.LookupEnv(EnvResources); ok {
+		cfg.Resources = splitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvAccess); ok {
+		cfg.Access = splitList(v)
+	}
+	return cfg, nil
+}
+
+// NatsOptions returns the NATS connection options set by the Config, to pass
+// to Service.ListenAndServe.
+func (cfg Config) NatsOptions() []nats.Option {
+	var opts []nats.Option
+	if cfg.NatsCreds != "" {
+		opts = append(opts, nats.UserCredentials(cfg.NatsCreds))
+	}
+	return opts
+}
+
+// NewServiceFromConfig creates a new Service with the settings of the Config
+// applied. NatsURL and NatsCreds are not used by the service, but are passed to
+// ListenAndServe when starting it.
+//
+// Returns an error if the Config has invalid values.
+func NewServiceFromConfig(cfg Config) (*Service, error) {
+	if !isValidPath(cfg.Name) {
+		return nil, fmt.Errorf("invalid service name: %s", cfg.Name)
+	}
+	if cfg.WorkerCount < 0 {
+		return nil, errors.New("negative worker count")
+	}
+	if cfg.QueryDuration < 0 {
+		return nil, errors.New("negative query duration")
+	}
+	for _, p := range cfg.Resources {
+		if !Pattern(p).IsValid() {
+			return nil, fmt.Errorf("invalid resource pattern: %s", p)
+		}
+	}
+	for _, p := range cfg.Access {
+		if !Pattern(p).IsValid() {
+			return nil, fmt.Errorf("invalid access pattern: %s", p)
+		}
+	}
+	l, err := newLevelLogger(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewService(cfg.Name).SetLogger(l)
+	if cfg.WorkerCount > 0 {
+		s.SetWorkerCount(cfg.WorkerCount)
+	}
+	if cfg.QueryDuration > 0 {
+		s.SetQueryEventDuration(cfg.QueryDuration)
+	}
+	if cfg.Resources != nil || cfg.Access != nil {
+		s.SetOwnedResources(cfg.Resources, cfg.Access)
+	}
+	return s, nil
+}
+
+// newLevelLogger returns a standard logger logging entries of the given level
+// and above, or nil for LogLevelNone.
+func newLevelLogger(level string) (logger.Logger, error) {
+	switch strings.ToLower(level) {
+	case LogLevelTrace:
+		return logger.NewStdLogger().SetTrace(true), nil
+	case "", LogLevelInfo:
+		return logger.NewStdLogger(), nil
+	case LogLevelError:
+		return logger.NewStdLogger().SetInfo(false), nil
+	case LogLevelNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("invalid log level: %s", level)
+}
+
+// splitList splits a comma separated list, trimming whitespace and omitting
+// empty entries.
+func splitList(v string) []string {
+	l := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			l = append(l, s)
+		}
+	}
+	return l
+}
@@ -0,0 +1,113 @@
+package res
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigWithEnv_SetVariables_OverridesValues(t *testing.T) {
+	t.Setenv(EnvServiceName, "test")
+	t.Setenv(EnvWorkerCount, "8")
+	t.Setenv(EnvQueryDuration, "5s")
+	t.Setenv(EnvLogLevel, "error")
+	t.Setenv(EnvResources, "test.>, other.model ,")
+	cfg, err := Config{NatsURL: "nats://foo:4222", WorkerCount: 2}.WithEnv()
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	expected := Config{
+		Name:          "test",
+		NatsURL:       "nats://foo:4222",
+		WorkerCount:   8,
+		QueryDuration: 5 * time.Second,
+		LogLevel:      "error",
+		Resources:     []string{"test.>", "other.model"},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected config:\n%#v\nbut got:\n%#v", expected, cfg)
+	}
+}
+
+func TestConfigWithEnv_InvalidVariable_ReturnsError(t *testing.T) {
+	tbl := []struct {
+		Env   string
+		Value string
+	}{
+		{EnvWorkerCount, "many"},
+		{EnvQueryDuration, "5"},
+	}
+	for _, l := range tbl {
+		t.Run(l.Env, func(t *testing.T) {
+			t.Setenv(l.Env, l.Value)
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Errorf("expected an error, but got none")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_JSONFile_ReturnsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"name":"test","workerCount":4,"queryDuration":"1m","access":[">"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	expected := Config{
+		Name:          "test",
+		NatsURL:       "nats://127.0.0.1:4222",
+		WorkerCount:   4,
+		QueryDuration: time.Minute,
+		Access:        []string{">"},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected config:\n%#v\nbut got:\n%#v", expected, cfg)
+	}
+}
+
+func TestNewServiceFromConfig_ValidConfig_AppliesSettings(t *testing.T) {
+	s, err := NewServiceFromConfig(Config{
+		Name:          "test",
+		WorkerCount:   4,
+		QueryDuration: time.Minute,
+		LogLevel:      LogLevelNone,
+		Resources:     []string{"test.>"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if s.workerCount != 4 {
+		t.Errorf("expected worker count 4, but got %d", s.workerCount)
+	}
+	if s.queryDuration != time.Minute {
+		t.Errorf("expected query duration %s, but got %s", time.Minute, s.queryDuration)
+	}
+	if s.Logger() != nil {
+		t.Errorf("expected no logger, but got %#v", s.Logger())
+	}
+	if !reflect.DeepEqual(s.resetResources, []string{"test.>"}) || s.resetAccess != nil {
+		t.Errorf("expected owned resources [test.>] and no access, but got %v and %v", s.resetResources, s.resetAccess)
+	}
+}
+
+func TestNewServiceFromConfig_InvalidConfig_ReturnsError(t *testing.T) {
+	tbl := []Config{
+		{Name: "te st"},
+		{WorkerCount: -1},
+		{QueryDuration: -time.Second},
+		{LogLevel: "verbose"},
+		{Resources: []string{"test..model"}},
+		{Access: []string{"test.>.model"}},
+	}
+	for i, l := range tbl {
+		if _, err := NewServiceFromConfig(l); err == nil {
+			t.Errorf("expected an error for config #%d, but got none", i+1)
+		}
+	}
+}
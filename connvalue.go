@@ -0,0 +1,149 @@
+package res
+
+import (
+	"sync"
+	"time"
+)
+
+// The default duration connection values are kept after last being set or
+// read.
+const defaultConnectionValueTTL = time.Hour
+
+// connValues holds values stored for client connections, keyed by
+// connection ID.
+type connValues struct {
+	mu sync.Mutex
+	m  map[string]*connEntry
+}
+
+// connEntry is the values of a connection, and the time they expire.
+type connEntry struct {
+	values  map[interface{}]interface{}
+	expires time.Time
+	timer   Timer
+}
+
+// SetConnectionValueTTL sets the duration connection values, set with
+// SetConnectionValue, are kept after the connection's values were last set or
+// read. Default is 1 hour.
+//
+// Panics if d is not greater than zero, or if service is already started.
+func (s *Service) SetConnectionValueTTL(d time.Duration) *Service {
+	if d <= 0 {
+		panic("res: connection value ttl must be greater than zero")
+	}
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.connValueTTL = d
+	return s
+}
+
+// SetConnectionValue stores a value for the key on the client connection with
+// the connection ID, cid. It lets metadata derived from an auth request, such
+// as the user's roles, be read in later access and call requests from the
+// same connection, using ConnectionValue.
+//
+// The values are kept in memory until the TTL, set with
+// SetConnectionValueTTL, has passed without the connection's values being
+// set or read, or until ClearConnectionValues is called, such as when the
+// client has logged out. A nil value deletes the key.
+//
+// Panics if cid is invalid.
+func (s *Service) SetConnectionValue(cid string, key, v interface{}) {
+	if !isValidPart(cid) {
+		panic("res: invalid connection ID")
+	}
+	cv := &s.connValues
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	e := cv.m[cid]
+	if e == nil {
+		if v == nil {
+			return
+		}
+		if cv.m == nil {
+			cv.m = make(map[string]*connEntry)
+		}
+		e = &connEntry{values: make(map[interface{}]interface{}, 1)}
+		cv.m[cid] = e
+		s.touchConnEntry(e)
+		e.timer = s.clock.AfterFunc(s.connValueTTL, func() { s.expireConnEntry(cid, e) })
+	} else {
+		s.touchConnEntry(e)
+	}
+	if v == nil {
+		delete(e.values, key)
+	} else {
+		e.values[key] = v
+	}
+}
+
+// ConnectionValue returns the value stored for the key on the client
+// connection with the connection ID, cid, or nil if no value is stored.
+func (s *Service) ConnectionValue(cid string, key interface{}) interface{} {
+	cv := &s.connValues
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	e := cv.m[cid]
+	if e == nil {
+		return nil
+	}
+	s.touchConnEntry(e)
+	return e.values[key]
+}
+
+// ClearConnectionValues deletes all values stored for the client connection
+// with the connection ID, cid.
+func (s *Service) ClearConnectionValues(cid string) {
+	cv := &s.connValues
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if e := cv.m[cid]; e != nil {
+		e.timer.Stop()
+		delete(cv.m, cid)
+	}
+}
+
+// touchConnEntry extends the expiry time of the connection's values. The
+// connValues mutex must be held.
+func (s *Service) touchConnEntry(e *connEntry) {
+	e.expires = s.clock.Now().Add(s.connValueTTL)
+}
+
+// expireConnEntry deletes the connection's values if they have expired, or
+// schedules a new check at the time they expire.
+func (s *Service) expireConnEntry(cid string, e *connEntry) {
+	cv := &s.connValues
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if cv.m[cid] != e {
+		return
+	}
+	if d := e.expires.Sub(s.clock.Now()); d > 0 {
+		e.timer = s.clock.AfterFunc(d, func() { s.expireConnEntry(cid, e) })
+		return
+	}
+	delete(cv.m, cid)
+}
+
+// SetConnectionValue stores a value for the key on the requesting client
+// connection, to be read in later requests from the same connection. See
+// Service.SetConnectionValue.
+//
+// Only valid for auth and call requests.
+func (r *Request) SetConnectionValue(key, v interface{}) {
+	r.s.SetConnectionValue(r.cid, key, v)
+}
+
+// ConnectionValue returns the value stored for the key on the requesting
+// client connection, or nil if no value is stored. See
+// Service.SetConnectionValue.
+//
+// Only valid for access, auth, call, and new requests.
+func (r *Request) ConnectionValue(key interface{}) interface{} {
+	if r.cid == "" {
+		return nil
+	}
+	return r.s.ConnectionValue(r.cid, key)
+}
@@ -0,0 +1,338 @@
+package res
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Container is a small dependency container used to wire up handlers with
+// the dependencies they need, such as database pools, clients, and
+// configuration.
+//
+// Dependencies are registered by key, either as values with Provide, or as
+// factories with ProvideFunc that are called once, on first Resolve. Values
+// created by factories that implement io.Closer, and functions added with
+// OnClose, are closed in reverse order when the Container is closed.
+//
+// The generic functions ProvideT, ProvideFuncT, ResolveT, and MustResolveT
+// use the type of the dependency as key.
+//
+// A Container is safe for concurrent use. Concurrent calls to Resolve for a
+// key being created wait for its factory to return.
+type Container struct {
+	mu        sync.Mutex
+	values    map[interface{}]interface{}
+	factories map[interface{}]func(*Container) (interface{}, error)
+	resolving map[interface{}]*resolution
+	closers   []func() error
+}
+
+// resolution is a dependency being created by a factory.
+type resolution struct {
+	gid  uint64        // ID of the goroutine calling the factory
+	done chan struct{} // Closed when the factory has returned
+}
+
+// HandlerProvider is a function that creates a handler using the
+// dependencies in the container.
+type HandlerProvider func(c *Container) (Handler, error)
+
+// handlerProvider is a handler provider registered for a pattern.
+type handlerProvider struct {
+	pattern  string
+	provider HandlerProvider
+}
+
+// typeKey is the key used for dependencies provided by type.
+type typeKey[T any] struct{}
+
+// String returns the name of the type.
+func (typeKey[T]) String() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// errDependencyNotFound is returned by Resolve when no dependency is provided
+// for a key.
+var errDependencyNotFound = errors.New("res: dependency not found")
+
+// NewContainer creates a new Container.
+func NewContainer() *Container {
+	return &Container{
+		values:    make(map[interface{}]interface{}),
+		factories: make(map[interface{}]func(*Container) (interface{}, error)),
+		resolving: make(map[interface{}]*resolution),
+	}
+}
+
+// Provide registers a value for the key, replacing any previously provided
+// value or factory. The key must be comparable.
+func (c *Container) Provide(key, v interface{}) *Container {
+	assertKey(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.factories, key)
+	c.values[key] = v
+	return c
+}
+
+// ProvideFunc registers a factory for the key, replacing any previously
+// provided value or factory. The factory is called once, on the first Resolve
+// of the key, and may resolve other dependencies from the container. If the
+// created value implements io.Closer, it is closed when the container is
+// closed. The key must be comparable.
+func (c *Container) ProvideFunc(key interface{}, f func(c *Container) (interface{}, error)) *Container {
+	assertKey(key)
+	if f == nil {
+		panic("res: nil dependency factory")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+	c.factories[key] = f
+	return c
+}
+
+// Resolve returns the dependency for the key, calling its factory if it is
+// not yet created. Returns an error if no dependency is provided for the key,
+// if the factory returns an error, or if the dependency depends on itself.
+func (c *Container) Resolve(key interface{}) (interface{}, error) {
+	gid := goroutineID()
+	c.mu.Lock()
+	for {
+		if v, ok := c.values[key]; ok {
+			c.mu.Unlock()
+			return v, nil
+		}
+		rs, ok := c.resolving[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		// A factory resolving its own key, directly or through other
+		// factories, is called on the same goroutine.
+		if rs.gid == gid {
+			return nil, fmt.Errorf("res: circular dependency: %v", key)
+		}
+		<-rs.done
+		c.mu.Lock()
+	}
+	f, ok := c.factories[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %v", errDependencyNotFound, key)
+	}
+	rs := &resolution{gid: gid, done: make(chan struct{})}
+	c.resolving[key] = rs
+	c.mu.Unlock()
+
+	v, err := c.create(key, f, rs)
+	if err != nil {
+		return nil, fmt.Errorf("res: failed to create %v: %w", key, err)
+	}
+	return v, nil
+}
+
+// create calls the factory of the key and stores the created value, ending
+// the resolution of the key also if the factory panics.
+func (c *Container) create(key interface{}, f func(*Container) (interface{}, error), rs *resolution) (v interface{}, err error) {
+	created := false
+	defer func() {
+		c.mu.Lock()
+		if created && err == nil {
+			c.values[key] = v
+			delete(c.factories, key)
+			if cl, ok := v.(io.Closer); ok {
+				c.closers = append(c.closers, cl.Close)
+			}
+		}
+		delete(c.resolving, key)
+		c.mu.Unlock()
+		close(rs.done)
+	}()
+	v, err = f(c)
+	created = true
+	return v, err
+}
+
+// OnClose adds a function to call when the container is closed. Functions are
+// called in reverse order of being added, interleaved with closing any
+// created io.Closer dependencies.
+func (c *Container) OnClose(f func() error) *Container {
+	if f == nil {
+		panic("res: nil close function")
+	}
+	c.mu.Lock()
+	c.closers = append(c.closers, f)
+	c.mu.Unlock()
+	return c
+}
+
+// Close calls the close functions and closes the created io.Closer
+// dependencies, in reverse order. All are closed even if some fail, and the
+// first error encountered is returned.
+func (c *Container) Close() error {
+	c.mu.Lock()
+	closers := c.closers
+	c.closers = nil
+	c.mu.Unlock()
+
+	var first error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ProvideT registers a value for type T. See Container.Provide.
+func ProvideT[T any](c *Container, v T) *Container {
+	return c.Provide(typeKey[T]{}, v)
+}
+
+// ProvideFuncT registers a factory for type T. See Container.ProvideFunc.
+//
+//	res.ProvideFuncT(c, func(c *res.Container) (*sql.DB, error) {
+//		return sql.Open("postgres", res.MustResolveT[Config](c).DSN)
+//	})
+func ProvideFuncT[T any](c *Container, f func(c *Container) (T, error)) *Container {
+	if f == nil {
+		panic("res: nil dependency factory")
+	}
+	return c.ProvideFunc(typeKey[T]{}, func(c *Container) (interface{}, error) {
+		return f(c)
+	})
+}
+
+// ResolveT returns the dependency of type T. See Container.Resolve.
+func ResolveT[T any](c *Container) (T, error) {
+	var t T
+	v, err := c.Resolve(typeKey[T]{})
+	if err != nil {
+		return t, err
+	}
+	if v == nil {
+		return t, nil
+	}
+	return v.(T), nil
+}
+
+// MustResolveT returns the dependency of type T, and panics on error. It is
+// intended for use within factories and handler providers, where the panic
+// is returned as an error.
+func MustResolveT[T any](c *Container) T {
+	v, err := ResolveT[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// SetContainer sets the dependency container used to resolve handler
+// providers. The container is closed when the service has stopped. If no
+// container is set, an empty one is created on first use.
+//
+// Panics if service is already started.
+func (s *Service) SetContainer(c *Container) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.container = c
+	return s
+}
+
+// Container returns the dependency container of the service.
+func (s *Service) Container() *Container {
+	if s.container == nil {
+		s.container = NewContainer()
+	}
+	return s.container
+}
+
+// HandleProvider registers a handler provider for the resource pattern. The
+// provider is called with the service's container when the service starts,
+// prior to validating listeners and subscribing, and the returned handler is
+// registered for the pattern in the same way as with AddHandler.
+//
+// If a provider returns an error, or panics, the service fails to start.
+//
+//	s.HandleProvider("book.$id", func(c *res.Container) (res.Handler, error) {
+//		db, err := res.ResolveT[*sql.DB](c)
+//		if err != nil {
+//			return res.Handler{}, err
+//		}
+//		return res.Handler{Get: bookGetHandler(db)}, nil
+//	})
+//
+// Panics if service is already started.
+func (s *Service) HandleProvider(pattern string, p HandlerProvider) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if p == nil {
+		panic("res: nil handler provider")
+	}
+	s.providers = append(s.providers, handlerProvider{pattern: pattern, provider: p})
+	return s
+}
+
+// resolveProviders calls the registered handler providers and adds the
+// returned handlers. Each provider is only resolved once, so that a service
+// that failed to start may be started again.
+func (s *Service) resolveProviders() error {
+	if len(s.providers) == 0 {
+		return nil
+	}
+	c := s.Container()
+	for len(s.providers) > 0 {
+		if err := s.providers[0].resolve(s, c); err != nil {
+			return err
+		}
+		s.providers = s.providers[1:]
+	}
+	return nil
+}
+
+// resolve calls the provider and adds the handler, recovering from panics.
+func (hp handlerProvider) resolve(s *Service, c *Container) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok {
+				err = fmt.Errorf("res: failed to provide handler for %s: %w", hp.pattern, e)
+			} else {
+				err = fmt.Errorf("res: failed to provide handler for %s: %v", hp.pattern, v)
+			}
+		}
+	}()
+	h, err := hp.provider(c)
+	if err != nil {
+		return fmt.Errorf("res: failed to provide handler for %s: %w", hp.pattern, err)
+	}
+	s.AddHandler(hp.pattern, h)
+	return nil
+}
+
+// closeContainer closes the service's container, if any, logging any error.
+func (s *Service) closeContainer() error {
+	if s.container == nil {
+		return nil
+	}
+	err := s.container.Close()
+	if err != nil {
+		s.errorf("Error closing container: %s", err)
+	}
+	return err
+}
+
+// assertKey panics if the key is nil or not comparable.
+func assertKey(key interface{}) {
+	if key == nil {
+		panic("res: nil dependency key")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("res: dependency key is not comparable")
+	}
+}
@@ -0,0 +1,40 @@
+package res
+
+import (
+	"sync"
+
+	"github.com/rs/xid"
+)
+
+// HeaderCorrelationID is the NATS message header holding the ID used to trace
+// a request across services. It is not part of the RES protocol, and is only
+// used by go-res services.
+const HeaderCorrelationID = "Correlation-Id"
+
+// correlationID is the correlation ID of a request. If the request has no ID,
+// one is generated on first use.
+type correlationID struct {
+	once sync.Once
+	id   string
+}
+
+// newCorrelationID returns the correlation ID of a request having the ID id,
+// or no ID if id is empty.
+func newCorrelationID(id string) *correlationID {
+	return &correlationID{id: id}
+}
+
+// String returns the correlation ID, generating it if the request has none.
+// A nil correlationID, of a resource not part of a request, returns an empty
+// string.
+func (c *correlationID) String() string {
+	if c == nil {
+		return ""
+	}
+	c.once.Do(func() {
+		if c.id == "" {
+			c.id = xid.New().String()
+		}
+	})
+	return c.id
+}
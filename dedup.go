@@ -0,0 +1,103 @@
+package res
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessDedups holds the recently sent access responses of handlers with
+// DedupAccess set, keyed by resource ID and token.
+type accessDedups struct {
+	mu sync.Mutex
+	m  map[string]*accessDedup
+}
+
+// accessDedup is a shared access response.
+type accessDedup struct {
+	rname   string
+	payload []byte
+}
+
+// DedupAccess deduplicates identical access requests for a resource, with the
+// same token, within the window duration. Once the access handler has
+// responded with a result, that response is sent to all identical requests
+// arriving within the window duration after it, without calling the handler.
+// Error responses, such as access denied or a timeout, are not reused.
+//
+// Shared responses for a resource are discarded on a reaccess event, or a
+// system reset matching the resource.
+//
+// It reduces the load on permission backends when many clients request access
+// at once, such as after a system reset or reconnect. Handlers that set the
+// access based on anything other than the resource ID and the token, such as
+// the connection ID or HTTP headers, should not use DedupAccess.
+func DedupAccess(window time.Duration) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.DedupAccess = window
+	})
+}
+
+// dedupAccess checks if the access request is identical to a recently handled
+// request. It returns true if the request is replied to with the shared
+// response, in which case the access handler should not be called.
+//
+// Only completed responses are shared, so identical requests handled
+// concurrently, such as by a handler with Parallel set, each call the handler.
+func (r *Request) dedupAccess() bool {
+	key := r.rname + "?" + r.query + "\x00" + strconv.FormatBool(r.isHTTP) + "\x00" + string(r.token)
+	ds := &r.s.dedup
+	ds.mu.Lock()
+	d, ok := ds.m[key]
+	ds.mu.Unlock()
+	if !ok {
+		r.dedupKey = key
+		return false
+	}
+	r.s.tracef("Deduplicated access request %s [%s]", r.msg.Subject, r.CorrelationID())
+	r.reply(d.payload)
+	return true
+}
+
+// completeDedup stores the response payload for identical requests until the
+// window duration has passed. Error responses are not stored.
+func (r *Request) completeDedup(payload []byte) {
+	if bytes.HasPrefix(payload, []byte(`{"error"`)) {
+		return
+	}
+	key := r.dedupKey
+	d := &accessDedup{rname: r.rname, payload: payload}
+	ds := &r.s.dedup
+	ds.mu.Lock()
+	if ds.m == nil {
+		ds.m = make(map[string]*accessDedup)
+	}
+	ds.m[key] = d
+	ds.mu.Unlock()
+
+	r.s.clock.AfterFunc(r.h.DedupAccess, func() {
+		ds.mu.Lock()
+		// Skip if the response has been discarded or replaced.
+		if ds.m[key] == d {
+			delete(ds.m, key)
+		}
+		ds.mu.Unlock()
+	})
+}
+
+// clearDedup discards any shared access responses for resources matching any
+// of the patterns.
+func (s *Service) clearDedup(patterns []string) {
+	ds := &s.dedup
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for key, d := range ds.m {
+		for _, p := range patterns {
+			if Pattern(p).Matches(d.rname) {
+				delete(ds.m, key)
+				break
+			}
+		}
+	}
+}
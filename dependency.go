@@ -0,0 +1,102 @@
+package res
+
+// resourceDependency is a dependency of the resources matching a target
+// pattern on the resources matching an item pattern.
+type resourceDependency struct {
+	item   Pattern
+	target Pattern
+}
+
+// DependsOn makes the handler's resources depend on the resources matching any
+// of the full resource patterns, including service name. Whenever a change,
+// add, remove, create, delete, or custom event is sent on a matching resource,
+// a reset event is sent for the dependent resource, making gateways refetch it.
+// Any query variants of the resource are also refetched.
+//
+// Tags are matched by name, and each tag of the handler's pattern must be part
+// of the dependency patterns. A per-entity query collection may depend on the
+// entity's items:
+//
+//	s.Handle("entities.$entityID.guests",
+//		res.GetCollection(getGuests),
+//		res.DependsOn("example.entities.$entityID.guest.$guestID"),
+//	)
+//
+// Panics if a pattern is invalid.
+func DependsOn(patterns ...string) Option {
+	items := make([]Pattern, len(patterns))
+	for i, p := range patterns {
+		items[i] = Pattern(p)
+		if !items[i].IsValid() {
+			panic("res: invalid dependency pattern: " + p)
+		}
+	}
+	return OnRegister(func(s *Service, p Pattern, h Handler) {
+		for _, item := range items {
+			if tag, ok := missingTag(p, item); ok {
+				panic("res: dependency pattern " + string(item) + " missing tag $" + tag + " of " + string(p))
+			}
+		}
+		s.depMu.Lock()
+		for _, item := range items {
+			s.dependencies = append(s.dependencies, resourceDependency{item: item, target: p})
+		}
+		s.depMu.Unlock()
+	})
+}
+
+// missingTag returns the first tag of the target pattern that is not a tag in
+// the item pattern.
+func missingTag(target, item Pattern) (string, bool) {
+	tags := make(map[string]bool)
+	for _, t := range item.tokens() {
+		if len(t) > 1 && t[0] == '$' {
+			tags[t[1:]] = true
+		}
+	}
+	for _, t := range target.tokens() {
+		if len(t) > 1 && t[0] == '$' && !tags[t[1:]] {
+			return t[1:], true
+		}
+	}
+	return "", false
+}
+
+// resetDependents sends a reset event for the resources depending on the
+// resource.
+func (r *resource) resetDependents() {
+	r.s.resetDependents(r.rname)
+}
+
+// resetDependents sends a reset event for the resources depending on the
+// resource name.
+func (s *Service) resetDependents(rname string) {
+	s.depMu.RLock()
+	defer s.depMu.RUnlock()
+	if len(s.dependencies) == 0 {
+		return
+	}
+	var rids []string
+	for _, dep := range s.dependencies {
+		vals, ok := dep.item.Values(rname)
+		if !ok {
+			continue
+		}
+		rid := dep.target.ReplaceTags(vals)
+		if string(rid) == rname || rid.IndexWildcard() >= 0 || containsString(rids, string(rid)) {
+			continue
+		}
+		rids = append(rids, string(rid))
+	}
+	s.reset(rids, nil)
+}
+
+// containsString returns true if the slice contains the string.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
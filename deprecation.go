@@ -0,0 +1,134 @@
+package res
+
+import (
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Deprecation describes a deprecated call or auth method.
+type Deprecation struct {
+	// Message describes the deprecation, such as which method to use instead.
+	Message string
+
+	// Sunset is the time after which the method may be removed. Zero means
+	// no sunset time is set.
+	Sunset time.Time
+
+	calls *int64 // Number of requests for the method since registration
+}
+
+// DeprecationInfo describes a deprecated method of a registered handler, and
+// its usage.
+type DeprecationInfo struct {
+	// Pattern is the full resource pattern of the handler.
+	Pattern Pattern
+
+	// Method is the name of the deprecated method.
+	Method string
+
+	// Message describes the deprecation.
+	Message string
+
+	// Sunset is the time after which the method may be removed. Zero means
+	// no sunset time is set.
+	Sunset time.Time
+
+	// Calls is the number of requests for the method since the handler was
+	// registered.
+	Calls int64
+}
+
+// Deprecated flags the call or auth method as deprecated, to help retire it
+// safely:
+//
+//	s.Handle("user.$id",
+//		res.Call("rename", renameHandler),
+//		res.Deprecated("rename", "Use set instead", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)),
+//	)
+//
+// Each request for the method is logged at the info level, and counted. The
+// usage is available through Service.Deprecations. HTTP-originated requests
+// are responded to with a "Deprecation" header, and a "Sunset" header if the
+// sunset time is not zero.
+func Deprecated(method, message string, sunset time.Time) Option {
+	if method == "" {
+		panic("res: deprecated method must not be empty")
+	}
+	return OptionFunc(func(hs *Handler) {
+		m := make(map[string]Deprecation, len(hs.Deprecations)+1)
+		for k, d := range hs.Deprecations {
+			m[k] = d
+		}
+		m[method] = Deprecation{Message: message, Sunset: sunset}
+		hs.Deprecations = m
+	})
+}
+
+// initDeprecations sets the usage counters of the handler's deprecations.
+func initDeprecations(hs *Handler) {
+	if len(hs.Deprecations) == 0 {
+		return
+	}
+	m := make(map[string]Deprecation, len(hs.Deprecations))
+	for k, d := range hs.Deprecations {
+		d.calls = new(int64)
+		m[k] = d
+	}
+	hs.Deprecations = m
+}
+
+// Deprecations returns the deprecated methods of the registered handlers,
+// including those of mounted muxes, with their usage. The result is sorted
+// by pattern and method.
+func (s *Service) Deprecations() []DeprecationInfo {
+	var infos []DeprecationInfo
+	s.Walk(func(p Pattern, h Handler) {
+		for method, d := range h.Deprecations {
+			info := DeprecationInfo{
+				Pattern: p,
+				Method:  method,
+				Message: d.Message,
+				Sunset:  d.Sunset,
+			}
+			if d.calls != nil {
+				info.Calls = atomic.LoadInt64(d.calls)
+			}
+			infos = append(infos, info)
+		}
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Pattern != infos[j].Pattern {
+			return infos[i].Pattern < infos[j].Pattern
+		}
+		return infos[i].Method < infos[j].Method
+	})
+	return infos
+}
+
+// checkDeprecated logs and counts the request if its method is deprecated,
+// and sets the deprecation response headers for HTTP-originated requests.
+func (r *Request) checkDeprecated() {
+	d, ok := r.h.Deprecations[r.method]
+	if !ok {
+		return
+	}
+	if d.calls != nil {
+		atomic.AddInt64(d.calls, 1)
+	}
+	sunset := ""
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+		r.s.infof("Deprecated method %s.%s called [%s], sunset %s: %s", r.rname, r.method, r.CorrelationID(), sunset, d.Message)
+	} else {
+		r.s.infof("Deprecated method %s.%s called [%s]: %s", r.rname, r.method, r.CorrelationID(), d.Message)
+	}
+	if r.isHTTP {
+		h := r.ResponseHeader()
+		h.Set("Deprecation", "true")
+		if sunset != "" {
+			h.Set("Sunset", sunset)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package res
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+var errNotModelObject = errors.New("res: model value does not marshal into a json object")
+
+// ModelChanges compares the before and after values of a model, as they look
+// when marshaled into json, and returns the changed properties as a map that
+// may be passed to ChangeEvent. Properties missing in the after value are set
+// to DeleteAction. If nothing has changed, an empty map is returned.
+//
+// The values may be structs, maps, or any other value that marshals into a
+// json object. A nil value is treated as a model without properties. Struct
+// fields tagged `res:"private"` are ignored, as by PublicModel.
+func ModelChanges(before, after interface{}) (map[string]interface{}, error) {
+	b, err := modelProps(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := modelProps(after)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(map[string]interface{})
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			ch[k] = DeleteAction
+		}
+	}
+	for k, v := range a {
+		if ov, ok := b[k]; !ok || !jsonEqual(ov, v) {
+			ch[k] = v
+		}
+	}
+	return ch, nil
+}
+
+// DiffModel compares the before and after values of a model in the same way as
+// ModelChanges, and returns the changed properties as a map that may be passed
+// to ChangeEvent.
+//
+// Unlike ModelChanges, property values that are json objects or arrays, other
+// than resource references and data values, are wrapped as data values, as
+// required for model property values by the protocol:
+//
+//	before := map[string]interface{}{"pos": []int{1, 2}}
+//	after := map[string]interface{}{"pos": []int{1, 3}}
+//	ch, _ := res.DiffModel(before, after) // {"pos":{"data":[1,3]}}
+//
+// See the protocol specification for more information:
+//
+//	https://github.com/resgateio/resgate/blob/master/docs/res-protocol.md#values
+func DiffModel(before, after interface{}) (map[string]interface{}, error) {
+	ch, err := ModelChanges(before, after)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ch {
+		if raw, ok := v.(json.RawMessage); ok && !isPropValue(raw) {
+			ch[k] = NewDataValue(raw)
+		}
+	}
+	return ch, nil
+}
+
+// isPropValue returns true if the json value is a valid model property value;
+// a primitive, a resource reference, or a data value.
+func isPropValue(raw json.RawMessage) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	if len(raw) == 0 || (raw[0] != '{' && raw[0] != '[') {
+		return true
+	}
+	if raw[0] == '[' {
+		return false
+	}
+	var m map[string]json.RawMessage
+	if json.Unmarshal(raw, &m) != nil {
+		return false
+	}
+	switch len(m) {
+	case 1:
+		_, isRef := m["rid"]
+		_, isData := m["data"]
+		return isRef || isData
+	case 2:
+		_, isRef := m["rid"]
+		_, isSoft := m["soft"]
+		return isRef && isSoft
+	}
+	return false
+}
+
+// modelProps marshals the model value and returns its properties as raw json,
+// excluding any private fields.
+func modelProps(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if m, ok := v.(map[string]json.RawMessage); ok {
+		return m, nil
+	}
+	dta, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(dta, []byte("null")) {
+		return nil, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(dta, &m); err != nil {
+		return nil, errNotModelObject
+	}
+	for _, name := range privateFields(reflect.TypeOf(v)) {
+		delete(m, name)
+	}
+	return m, nil
+}
+
+// jsonEqual returns true if a and b are equal json values, disregarding
+// whitespace and the order of object keys.
+func jsonEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
@@ -0,0 +1,121 @@
+package res
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// catalogEntry is the default message and HTTP status of an error code.
+type catalogEntry struct {
+	message string
+	status  int
+}
+
+// errorCatalog holds the registered error codes, including the predefined
+// system error codes with the HTTP status used by Resgate. It is shared by all
+// services in the process.
+var errorCatalog = struct {
+	mu sync.RWMutex
+	m  map[string]catalogEntry
+}{m: map[string]catalogEntry{
+	CodeAccessDenied:   {message: ErrAccessDenied.Message, status: http.StatusUnauthorized},
+	CodeInternalError:  {message: ErrInternalError.Message, status: http.StatusInternalServerError},
+	CodeInvalidParams:  {message: ErrInvalidParams.Message, status: http.StatusBadRequest},
+	CodeInvalidQuery:   {message: ErrInvalidQuery.Message, status: http.StatusBadRequest},
+	CodeMethodNotFound: {message: ErrMethodNotFound.Message, status: http.StatusMethodNotAllowed},
+	CodeNotFound:       {message: ErrNotFound.Message, status: http.StatusNotFound},
+	CodeTimeout:        {message: ErrTimeout.Message, status: http.StatusGatewayTimeout},
+}}
+
+// RegisterError registers a custom error code with a default message and an
+// HTTP status, and returns an error with the code and message, to be used as
+// a predefined error:
+//
+//	var ErrOutOfStock = res.RegisterError("shop.outOfStock", "Out of stock", http.StatusConflict)
+//
+// The default message is used for error responses with the code and an empty
+// message, such as sent with ErrorData or NewError. The HTTP status is set as
+// the response status of error responses with the code to HTTP requests,
+// unless a status is set with SetResponseStatus. A zero status sets no
+// status, leaving it to Resgate.
+//
+// The catalog is global to the process, and shared by all services. Error codes
+// should therefore be registered only during package initialization, as in the
+// example above, and not while any service is running, as it changes the
+// responses of services already serving. Use codes prefixed with a namespace
+// unique to the service or package to avoid conflicts.
+//
+// Registering a code again replaces the previous registration. Panics if the
+// code is empty, is a system error code, or if the status is not zero or an
+// HTTP error status (400-599).
+func RegisterError(code, message string, httpStatus int) *Error {
+	if code == "" {
+		panic("res: empty error code")
+	}
+	if strings.HasPrefix(code, "system.") {
+		panic("res: cannot register system error code " + code)
+	}
+	if httpStatus != 0 && (httpStatus < 400 || httpStatus > 599) {
+		panic("res: invalid error http status")
+	}
+	errorCatalog.mu.Lock()
+	errorCatalog.m[code] = catalogEntry{message: message, status: httpStatus}
+	errorCatalog.mu.Unlock()
+	return &Error{Code: code, Message: message}
+}
+
+// NewError returns an error with the code and its registered default
+// message. For codes not registered, the message is the code.
+func NewError(code string) *Error {
+	msg, _ := ErrorMessage(code)
+	if msg == "" {
+		msg = code
+	}
+	return &Error{Code: code, Message: msg}
+}
+
+// ErrorMessage returns the default message of a registered or system error
+// code, and true. For other codes, it returns an empty string and false.
+func ErrorMessage(code string) (string, bool) {
+	errorCatalog.mu.RLock()
+	e, ok := errorCatalog.m[code]
+	errorCatalog.mu.RUnlock()
+	return e.message, ok
+}
+
+// ErrorHTTPStatus returns the HTTP status of a registered or system error
+// code. For other codes, or codes registered without status, it returns
+// http.StatusInternalServerError for system.* codes, and zero otherwise.
+func ErrorHTTPStatus(code string) int {
+	errorCatalog.mu.RLock()
+	e, ok := errorCatalog.m[code]
+	errorCatalog.mu.RUnlock()
+	if !ok && strings.HasPrefix(code, "system.") {
+		return http.StatusInternalServerError
+	}
+	return e.status
+}
+
+// catalogError returns the error with the registered default message if the
+// message is empty, and the meta object with the registered HTTP status of a
+// custom error code for HTTP requests, unless a status is already set.
+func catalogError(e *Error, m *metaObject, isHTTP bool) (*Error, *metaObject) {
+	if e.Message == "" && e.Code != "" {
+		if msg, ok := ErrorMessage(e.Code); ok {
+			e = &Error{Code: e.Code, Message: msg, Data: e.Data}
+		}
+	}
+	// Resgate sets the status of system errors itself
+	if !isHTTP || strings.HasPrefix(e.Code, "system.") || (m != nil && m.Status != 0) {
+		return e, m
+	}
+	if status := ErrorHTTPStatus(e.Code); status != 0 {
+		if m == nil {
+			m = &metaObject{Status: status}
+		} else {
+			m = &metaObject{Header: m.Header, Status: status}
+		}
+	}
+	return e, m
+}
@@ -25,6 +25,22 @@ func InternalError(err error) *Error {
 	return &Error{Code: CodeInternalError, Message: "Internal error: " + err.Error()}
 }
 
+// FieldError describes a validation error of a single field. A list of field
+// errors may be used as Data of an invalid params error, to let clients
+// highlight the failing fields:
+//
+//	r.InvalidParamsData("Invalid user", []res.FieldError{
+//		{Field: "email", Message: "Invalid email address"},
+//	})
+//
+// Tag and Param are set for field errors converted by ValidationError.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Tag     string `json:"tag,omitempty"`
+	Param   string `json:"param,omitempty"`
+}
+
 // Predefined error codes
 const (
 	CodeAccessDenied   = "system.accessDenied"
@@ -0,0 +1,30 @@
+package res_test
+
+import (
+	"fmt"
+
+	res "github.com/jirenius/go-res"
+)
+
+func ExampleRID() {
+	books := res.RID("library", "book")
+
+	fmt.Println(books.Add("42").String())
+	fmt.Println(books.Add(7).Query("lang=en").Ref())
+
+	_, err := books.Add("").Build()
+	fmt.Println(err)
+	// Output:
+	// library.book.42
+	// library.book.7?lang=en
+	// res: empty resource ID segment
+}
+
+func ExampleSplitRID() {
+	segments, query, err := res.SplitRID("library.book.42?lang=en")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(segments, query)
+	// Output: [library book 42] lang=en
+}
@@ -0,0 +1,40 @@
+package res
+
+import "time"
+
+// ExpireAfter makes the handler's resources expire a duration d after their
+// create event, or after their last change, add, or remove event. On expiry,
+// a delete event is sent for the resource, on the resource's worker
+// goroutine, in the same way as calling Resource.DeleteEvent.
+//
+// It is intended for ephemeral resources, such as invitations and one-time
+// links. Expiries are kept in memory, and are lost when the service stops.
+//
+// Panics if d is not greater than zero.
+func ExpireAfter(d time.Duration) Option {
+	if d <= 0 {
+		panic("res: expire duration must be greater than zero")
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.ExpireAfter = d
+	})
+}
+
+// scheduleExpiry schedules the expiry of the resource if its handler has
+// ExpireAfter set, replacing any previously scheduled expiry.
+func (r *resource) scheduleExpiry() {
+	if r.h.ExpireAfter <= 0 {
+		return
+	}
+	r.s.expiries.schedule(r.s, r.rname, r.h.ExpireAfter, "expire", func(r Resource) {
+		r.DeleteEvent()
+	})
+}
+
+// cancelExpiry cancels any scheduled expiry of the resource.
+func (r *resource) cancelExpiry() {
+	if r.h.ExpireAfter <= 0 {
+		return
+	}
+	r.s.expiries.cancel(r.rname)
+}
@@ -0,0 +1,96 @@
+package res
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFlushTimeout is the default timeout when flushing synchronous events,
+// or when calling Flush with a context without deadline.
+const defaultFlushTimeout = 10 * time.Second
+
+// flusher is implemented by connections able to flush buffered messages to
+// the server, such as nats.Conn.
+type flusher interface {
+	FlushWithContext(ctx context.Context) error
+}
+
+// SyncEvents makes events on the handler's resources be published
+// synchronously. After each change, add, remove, create, delete, reaccess, or
+// custom event, the connection is flushed, ensuring the NATS server has
+// received the event before the event method returns, and thereby before any
+// response sent after it. It is intended for critical events, such as on
+// financial transactions, while other events remain asynchronous:
+//
+//	s.Handle("account.$id", res.SyncEvents, /* ... */)
+//
+// Failure to flush is reported as an error through the logger and the
+// OnError callback. Events buffered by ThrottleEvents are not flushed
+// synchronously.
+var SyncEvents = OptionFunc(func(hs *Handler) {
+	hs.SyncEvents = true
+})
+
+// SetFlushTimeout sets the duration to wait for the connection to be flushed
+// after a synchronous event, or when calling Flush with a context without
+// deadline. Default is 10 seconds.
+func (s *Service) SetFlushTimeout(d time.Duration) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if d <= 0 {
+		panic("res: flush timeout must be greater than zero")
+	}
+	s.flushTimeout = d
+	return s
+}
+
+// Flush waits until all published messages, such as events, have been
+// received by the NATS server, or until the context is done. It lets a
+// handler confirm that critical events are flushed before responding:
+//
+//	r.ChangeEvent(map[string]interface{}{"balance": balance})
+//	if err := r.Service().Flush(ctx); err != nil {
+//		r.Error(err)
+//		return
+//	}
+//	r.OK(nil)
+//
+// If the context has no deadline, the flush timeout is used. If the
+// connection has no FlushWithContext method, Flush returns nil immediately.
+// Returns an error if the service is not started.
+func (s *Service) Flush(ctx context.Context) error {
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		return errNotStarted
+	}
+	if s.flusher == nil {
+		return nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.flushTimeoutOrDefault())
+		defer cancel()
+	}
+	return s.flusher.FlushWithContext(ctx)
+}
+
+// flushTimeoutOrDefault returns the flush timeout, or the default timeout if
+// none is set.
+func (s *Service) flushTimeoutOrDefault() time.Duration {
+	if s.flushTimeout > 0 {
+		return s.flushTimeout
+	}
+	return defaultFlushTimeout
+}
+
+// syncEvent flushes the connection after an event if the resource's handler
+// has SyncEvents set.
+func (r *resource) syncEvent() {
+	if !r.h.SyncEvents {
+		return
+	}
+	if err := r.s.Flush(context.Background()); err != nil {
+		r.s.errorf("Failed to flush event on %s: %s", r.rname, err)
+	}
+}
@@ -3,6 +3,7 @@ package res
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -25,23 +26,27 @@ func (r *getRequest) RequireValue() interface{} {
 }
 
 func (r *getRequest) Model(model interface{}) {
-	r.reply()
-	r.value = model
+	if r.reply() {
+		r.value = model
+	}
 }
 
 func (r *getRequest) QueryModel(model interface{}, query string) {
-	r.reply()
-	r.value = model
+	if r.reply() {
+		r.value = model
+	}
 }
 
 func (r *getRequest) Collection(collection interface{}) {
-	r.reply()
-	r.value = collection
+	if r.reply() {
+		r.value = collection
+	}
 }
 
 func (r *getRequest) QueryCollection(collection interface{}, query string) {
-	r.reply()
-	r.value = collection
+	if r.reply() {
+		r.value = collection
+	}
 }
 
 func (r *getRequest) NotFound() {
@@ -56,9 +61,26 @@ func (r *getRequest) InvalidQuery(message string) {
 	}
 }
 
+// QueryValues parses the query and returns the corresponding values. If the
+// query is malformed, a system.invalidQuery response is sent, and the parse
+// error is returned. See Request.QueryValues.
+func (r *getRequest) QueryValues() (url.Values, error) {
+	v, err := url.ParseQuery(r.query)
+	if err != nil {
+		r.InvalidQuery("Invalid query: " + err.Error())
+		return nil, err
+	}
+	return v, nil
+}
+
 func (r *getRequest) Error(err error) {
-	r.reply()
-	r.err = err
+	if r.reply() {
+		r.err = err
+	}
+}
+
+func (r *getRequest) ErrorData(code, message string, data interface{}) {
+	r.Error(&Error{Code: code, Message: message, Data: data})
 }
 
 func (r *getRequest) Timeout(d time.Duration) {
@@ -69,11 +91,23 @@ func (r *getRequest) ForValue() bool {
 	return true
 }
 
-func (r *getRequest) reply() {
+func (r *getRequest) Replied() bool {
+	return r.replied
+}
+
+// reply flags the request as replied, and returns true. If a reply is already
+// made, reply will panic, or log an error and return false if the service has
+// the NoReplyPanic flag set.
+func (r *getRequest) reply() bool {
 	if r.replied {
+		if r.s.noReplyPanic {
+			r.s.errorf("Response already sent on get request %#v", r.rname)
+			return false
+		}
 		panic("res: response already sent on get request")
 	}
 	r.replied = true
+	return true
 }
 
 func (r *getRequest) executeHandler() {
@@ -96,6 +130,12 @@ func (r *getRequest) executeHandler() {
 			}
 			str = e.Message
 		case error:
+			if ve := ValidationError(e); ve != nil && !r.replied {
+				r.Error(ve)
+				// Return without logging as panicing with a validation
+				// error is considered a valid way of rejecting params.
+				return
+			}
 			str = e.Error()
 			if !r.replied {
 				r.Error(ToError(e))
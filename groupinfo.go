@@ -0,0 +1,271 @@
+package res
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// GroupMode tells how requests for the resources of a handler are assigned to
+// worker goroutines.
+type GroupMode int
+
+// Group modes.
+const (
+	// GroupPerResource is used by handlers without a group. Requests for the
+	// same resource are handled serialized, while different resources are
+	// handled in parallel.
+	GroupPerResource GroupMode = iota
+	// GroupByExpression is used by handlers with a group containing
+	// placeholders. Requests for resources with the same group are handled
+	// serialized.
+	GroupByExpression
+	// GroupSingle is used by handlers with a group without placeholders.
+	// Requests for all the handler's resources are handled serialized.
+	GroupSingle
+	// GroupParallel is used by handlers with Parallel set. All requests may
+	// be handled in parallel.
+	GroupParallel
+)
+
+// String returns a description of the group mode.
+func (gm GroupMode) String() string {
+	switch gm {
+	case GroupPerResource:
+		return "per resource"
+	case GroupByExpression:
+		return "by group"
+	case GroupSingle:
+		return "single"
+	case GroupParallel:
+		return "parallel"
+	}
+	return "unknown"
+}
+
+// GroupInfo describes the group assignment of a registered handler, as
+// returned by Mux.Groups.
+type GroupInfo struct {
+	// Pattern is the full resource pattern of the handler.
+	Pattern Pattern
+
+	// Group is the effective group expression, with placeholders written as
+	// ${name}. For handlers without a group, it is the pattern, as each
+	// resource is its own group. Empty for parallel handlers.
+	Group string
+
+	// Mode tells how requests for the handler's resources are assigned to
+	// worker goroutines.
+	Mode GroupMode
+
+	// Shared is the other patterns with a group that may evaluate to the same
+	// group as this one, making their requests share worker goroutine.
+	Shared []Pattern
+}
+
+// groupItem is a part of a group expression, matching either a literal
+// character, or one or more characters of any kind, or of any kind but dots.
+type groupItem struct {
+	c     byte // Literal character. Zero for wildcard items.
+	dots  bool // Wildcard item matches dots
+	multi bool // Wildcard item may match zero or more characters. Only set for items following a single character wildcard item.
+}
+
+// Groups returns the group assignments of the registered handlers, including
+// those of mounted muxes, sorted by pattern. It allows auditing the groups
+// for patterns unintentionally sharing worker goroutines, or being serialized
+// or parallel when not expected to be.
+//
+// Group buckets, set with Service.SetGroupBuckets, are not taken into
+// account.
+func (m *Mux) Groups() []GroupInfo {
+	type entry struct {
+		info  GroupInfo
+		items []groupItem
+	}
+	var es []*entry
+	m.mu.RLock()
+	fp := m.FullPath()
+	traverse(m.root, make([]string, 0, 32), 0, func(n *node, path []string, mountIdx int) {
+		if n.hs == nil {
+			return
+		}
+		p := pathSliceToString(n, path, mountIdx)
+		full := mergePattern(fp, p)
+		e := &entry{info: GroupInfo{Pattern: Pattern(full)}}
+		g := n.hs.group
+		switch {
+		case g == nil:
+			e.info.Mode = GroupPerResource
+			e.info.Group, e.items = patternGroup(full)
+		case len(g) == 0:
+			e.info.Mode = GroupParallel
+		default:
+			e.info.Mode = GroupSingle
+			e.info.Group, e.items = expressionGroup(g, splitPattern(p)[mountIdx:])
+			for _, gp := range g {
+				if gp.str == "" {
+					e.info.Mode = GroupByExpression
+				}
+			}
+		}
+		es = append(es, e)
+	})
+	m.mu.RUnlock()
+
+	sort.Slice(es, func(i, j int) bool { return es[i].info.Pattern < es[j].info.Pattern })
+	for i, a := range es {
+		for _, b := range es[i+1:] {
+			if a.items == nil || b.items == nil {
+				continue
+			}
+			// Resources of different handlers never have the same resource
+			// name, so they cannot share a per resource group.
+			if a.info.Mode == GroupPerResource && b.info.Mode == GroupPerResource {
+				continue
+			}
+			if groupsIntersect(a.items, b.items) {
+				a.info.Shared = append(a.info.Shared, b.info.Pattern)
+				b.info.Shared = append(b.info.Shared, a.info.Pattern)
+			}
+		}
+	}
+
+	infos := make([]GroupInfo, len(es))
+	for i, e := range es {
+		infos[i] = e.info
+	}
+	return infos
+}
+
+// WriteGroups writes the group assignments returned by Groups as a table,
+// with one row for each pattern.
+func (m *Mux) WriteGroups(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATTERN\tMODE\tGROUP\tSHARED WITH")
+	for _, gi := range m.Groups() {
+		shared := make([]string, len(gi.Shared))
+		for i, p := range gi.Shared {
+			shared[i] = string(p)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", gi.Pattern, gi.Mode, gi.Group, strings.Join(shared, ", "))
+	}
+	return tw.Flush()
+}
+
+// patternGroup returns the group expression, and its items, of a handler
+// without a group, where the group is the resource name.
+func patternGroup(pattern string) (string, []groupItem) {
+	var b strings.Builder
+	var items []groupItem
+	for i, t := range splitPattern(pattern) {
+		if i > 0 {
+			b.WriteByte(btsep)
+			items = append(items, groupItem{c: btsep})
+		}
+		switch t[0] {
+		case pmark:
+			b.WriteString("${" + t[1:] + "}")
+			items = append(items, wildItems(false)...)
+		case pwild:
+			b.WriteString(t)
+			items = append(items, wildItems(false)...)
+		case fwild:
+			b.WriteString(t)
+			items = append(items, wildItems(true)...)
+		default:
+			b.WriteString(t)
+			items = append(items, literalItems(t)...)
+		}
+	}
+	return b.String(), items
+}
+
+// expressionGroup returns the group expression, and its items, of a group
+// where placeholders refer to the tokens of the handler's pattern.
+func expressionGroup(g group, tokens []string) (string, []groupItem) {
+	var b strings.Builder
+	var items []groupItem
+	for _, gp := range g {
+		if gp.str != "" {
+			b.WriteString(gp.str)
+			items = append(items, literalItems(gp.str)...)
+			continue
+		}
+		b.WriteString("${" + tokens[gp.idx][1:] + "}")
+		items = append(items, wildItems(false)...)
+	}
+	return b.String(), items
+}
+
+// literalItems returns the items matching the string.
+func literalItems(s string) []groupItem {
+	items := make([]groupItem, len(s))
+	for i := 0; i < len(s); i++ {
+		items[i] = groupItem{c: s[i]}
+	}
+	return items
+}
+
+// wildItems returns the items matching one or more characters, including dots
+// if dots is true.
+func wildItems(dots bool) []groupItem {
+	return []groupItem{{dots: dots}, {dots: dots, multi: true}}
+}
+
+// groupsIntersect returns true if there is a string matched by both group
+// expressions. It explores the product of the two expressions, where a
+// state is a position in each.
+func groupsIntersect(a, b []groupItem) bool {
+	type state struct{ i, j int }
+	seen := make(map[state]bool)
+	stack := []state{{0, 0}}
+	push := func(st state) {
+		if !seen[st] {
+			seen[st] = true
+			stack = append(stack, st)
+		}
+	}
+	for len(stack) > 0 {
+		st := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if st.i == len(a) && st.j == len(b) {
+			return true
+		}
+		// Let multi items match no characters.
+		if st.i < len(a) && a[st.i].multi {
+			push(state{st.i + 1, st.j})
+		}
+		if st.j < len(b) && b[st.j].multi {
+			push(state{st.i, st.j + 1})
+		}
+		if st.i == len(a) || st.j == len(b) || !itemsOverlap(a[st.i], b[st.j]) {
+			continue
+		}
+		// Match a single character on both sides.
+		ni, nj := st.i+1, st.j+1
+		if a[st.i].multi {
+			ni = st.i
+		}
+		if b[st.j].multi {
+			nj = st.j
+		}
+		push(state{ni, nj})
+	}
+	return false
+}
+
+// itemsOverlap returns true if there is a character matched by both items.
+func itemsOverlap(a, b groupItem) bool {
+	switch {
+	case a.c != 0 && b.c != 0:
+		return a.c == b.c
+	case a.c != 0:
+		return b.dots || a.c != btsep
+	case b.c != 0:
+		return a.dots || b.c != btsep
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package res
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// InFlightRequest describes a request being handled, as returned by
+// Service.InFlight.
+type InFlightRequest struct {
+	// Group is the group of the resource, sharing worker goroutine.
+	Group string
+
+	// Pattern is the full resource pattern of the handler.
+	Pattern string
+
+	// ResourceName is the resource name of the request.
+	ResourceName string
+
+	// Type is the request type. Either "access", "get", "call", or "auth".
+	Type string
+
+	// Method is the method of call and auth requests. Empty for other types.
+	Method string
+
+	// Started is the time when the handling started.
+	Started time.Time
+
+	// Duration is the time the request has been handled.
+	Duration time.Duration
+}
+
+// inFlightRequests holds the requests being handled.
+type inFlightRequests struct {
+	mu sync.Mutex
+	m  map[*Request]*inFlightEntry
+}
+
+// inFlightEntry is a request being handled.
+type inFlightEntry struct {
+	pattern string
+	started time.Time
+}
+
+// SetPprofLabels sets whether request handler executions should be tagged
+// with the pprof labels res.pattern, res.type, and res.method, making CPU and
+// goroutine profiles show which handlers are running. Default is false.
+//
+// Panics if service is already started.
+func (s *Service) SetPprofLabels(enable bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.pprofLabels = enable
+	return s
+}
+
+// SetInFlightTracking sets whether the requests being handled should be
+// tracked, to be listed by InFlight. Default is false.
+//
+// Panics if service is already started.
+func (s *Service) SetInFlightTracking(enable bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.trackInFlight = enable
+	return s
+}
+
+// InFlight returns the requests being handled, sorted by group and the time
+// the handling started. It helps diagnosing which resource is blocking a
+// worker goroutine. Returns nil if in-flight tracking is not enabled with
+// SetInFlightTracking.
+func (s *Service) InFlight() []InFlightRequest {
+	if !s.trackInFlight {
+		return nil
+	}
+	fs := &s.inFlight
+	now := s.clock.Now()
+	fs.mu.Lock()
+	list := make([]InFlightRequest, 0, len(fs.m))
+	for r, e := range fs.m {
+		list = append(list, InFlightRequest{
+			Group:        r.group,
+			Pattern:      e.pattern,
+			ResourceName: r.rname,
+			Type:         r.rtype,
+			Method:       r.method,
+			Started:      e.started,
+			Duration:     now.Sub(e.started),
+		})
+	}
+	fs.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Group != list[j].Group {
+			return list[i].Group < list[j].Group
+		}
+		return list[i].Started.Before(list[j].Started)
+	})
+	return list
+}
+
+// WriteInFlight writes the requests returned by InFlight as a table, with one
+// row for each request.
+func (s *Service) WriteInFlight(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tPATTERN\tRESOURCE\tTYPE\tMETHOD\tDURATION")
+	for _, ifr := range s.InFlight() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", ifr.Group, ifr.Pattern, ifr.ResourceName, ifr.Type, ifr.Method, ifr.Duration)
+	}
+	return tw.Flush()
+}
+
+// InFlightHandler returns an http.Handler writing the requests being handled
+// as a plain text table, as done by WriteInFlight. It may be served on a
+// debug endpoint, next to net/http/pprof:
+//
+//	http.Handle("/debug/res/inflight", s.InFlightHandler())
+func (s *Service) InFlightHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		s.WriteInFlight(w)
+	})
+}
+
+// executeTracked executes the request handler, tracking the request as
+// in-flight and setting pprof labels if enabled.
+func (s *Service) executeTracked(r *Request, mh *Match) {
+	if !s.trackInFlight && !s.pprofLabels {
+		r.executeHandler()
+		return
+	}
+	pattern := mh.pattern(r.rname)
+	if s.trackInFlight {
+		fs := &s.inFlight
+		fs.mu.Lock()
+		if fs.m == nil {
+			fs.m = make(map[*Request]*inFlightEntry)
+		}
+		fs.m[r] = &inFlightEntry{pattern: pattern, started: s.clock.Now()}
+		fs.mu.Unlock()
+		defer func() {
+			fs.mu.Lock()
+			delete(fs.m, r)
+			fs.mu.Unlock()
+		}()
+	}
+	if s.pprofLabels {
+		pprof.Do(context.Background(), pprof.Labels("res.pattern", pattern, "res.type", r.rtype, "res.method", r.method), func(context.Context) {
+			r.executeHandler()
+		})
+		return
+	}
+	r.executeHandler()
+}
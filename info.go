@@ -0,0 +1,62 @@
+package res
+
+// ServiceInfo is information about a service, as returned by Service.Info.
+type ServiceInfo struct {
+	// Name is the name of the service.
+	Name string `json:"name"`
+
+	// Version is the version of the service, as set with SetVersion.
+	Version string `json:"version"`
+
+	// Protocol is the supported RES protocol version.
+	Protocol string `json:"protocol"`
+
+	// Patterns is the number of resource patterns with a registered handler.
+	Patterns int `json:"patterns"`
+}
+
+// SetVersion sets the version of the service, such as a release tag or a
+// commit hash. The version is logged when the service starts, and included in
+// Info.
+//
+// Panics if service is already started.
+func (s *Service) SetVersion(v string) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.version = v
+	return s
+}
+
+// Version returns the version set with SetVersion.
+func (s *Service) Version() string {
+	return s.version
+}
+
+// Info returns information about the service.
+func (s *Service) Info() ServiceInfo {
+	patterns := 0
+	s.Walk(func(Pattern, Handler) { patterns++ })
+	return ServiceInfo{
+		Name:     s.Mux.path,
+		Version:  s.version,
+		Protocol: protocolVersion,
+		Patterns: patterns,
+	}
+}
+
+// HandleInfo registers a model resource for the pattern, with the service
+// information returned by Info, letting operators see what is deployed
+// through the RES API itself:
+//
+//	s.HandleInfo("system.info", res.Access(res.AccessGranted))
+//
+// Any options, such as an access handler, are added to the handler. Without
+// one, access to the resource must be granted by another service.
+func (s *Service) HandleInfo(pattern string, hf ...Option) {
+	s.Handle(pattern, append([]Option{
+		GetModel(func(r ModelRequest) {
+			r.Model(s.Info())
+		}),
+	}, hf...)...)
+}
@@ -0,0 +1,36 @@
+/*
+Package ingest maps messages from external sources to resource events, for
+keeping RES resources in sync with upstream systems.
+
+Each message received from a Source is passed to a Mapper, which returns the
+mutations to apply. Each mutation is executed on the worker goroutine of the
+target resource, where the corresponding change, add, or remove event is sent.
+
+A Source may be any message stream, such as a NATS subject or a Kafka topic,
+by implementing the Source interface. NATSSource is provided for NATS
+subjects.
+
+# Usage
+
+Sync book titles from an upstream system:
+
+	ing := ingest.New(s, ingest.NATSSource(s, "inventory.book.updated"),
+		func(m ingest.Message) ([]ingest.Mutation, error) {
+			var ev struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(m.Data, &ev); err != nil {
+				return nil, err
+			}
+			return []ingest.Mutation{
+				ingest.Change("library.book."+ev.ID, map[string]interface{}{"title": ev.Title}),
+			}, nil
+		})
+	s.SetOnServe(func(s *res.Service) {
+		if err := ing.Start(); err != nil {
+			panic(err)
+		}
+	})
+*/
+package ingest
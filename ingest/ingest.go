@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"fmt"
+	"sync"
+
+	res "github.com/jirenius/go-res"
+)
+
+// Op is the type of mutation to apply to a resource.
+type Op int
+
+// Mutation operations.
+const (
+	// OpChange sends a change event on a model.
+	OpChange Op = iota
+	// OpAdd sends an add event on a collection.
+	OpAdd
+	// OpRemove sends a remove event on a collection.
+	OpRemove
+)
+
+// Message is a message received from an external source.
+type Message struct {
+	// Subject is the subject, or topic, the message was received on.
+	Subject string
+
+	// Data is the message payload.
+	Data []byte
+}
+
+// Mutation describes a mutation to apply to a resource.
+type Mutation struct {
+	// RID is the resource ID of the target resource.
+	RID string
+
+	// Op is the type of mutation.
+	Op Op
+
+	// Changed contains the changed model properties. Only valid for OpChange.
+	Changed map[string]interface{}
+
+	// Value is the value to add. Only valid for OpAdd.
+	Value interface{}
+
+	// Idx is the collection index to add or remove a value at. Only valid for
+	// OpAdd and OpRemove.
+	Idx int
+}
+
+// Change returns a mutation sending a change event on a model.
+func Change(rid string, changed map[string]interface{}) Mutation {
+	return Mutation{RID: rid, Op: OpChange, Changed: changed}
+}
+
+// Add returns a mutation sending an add event on a collection.
+func Add(rid string, value interface{}, idx int) Mutation {
+	return Mutation{RID: rid, Op: OpAdd, Value: value, Idx: idx}
+}
+
+// Remove returns a mutation sending a remove event on a collection.
+func Remove(rid string, idx int) Mutation {
+	return Mutation{RID: rid, Op: OpRemove, Idx: idx}
+}
+
+// Mapper maps a message to the mutations to apply. If no mutations are
+// returned, the message is ignored.
+type Mapper func(m Message) ([]Mutation, error)
+
+// Source is an adapter for an external message stream.
+type Source interface {
+	// Subscribe starts delivering messages to the callback, cb. Messages must
+	// be delivered one at a time, in the order they are received.
+	Subscribe(cb func(m Message)) error
+
+	// Close stops delivering messages.
+	Close() error
+}
+
+// Ingester reads messages from a Source and applies the mapped mutations to
+// the resources of a service.
+type Ingester struct {
+	s       *res.Service
+	src     Source
+	mapper  Mapper
+	mu      sync.Mutex
+	onError func(err error)
+}
+
+// New creates a new Ingester applying mutations mapped from the source's
+// messages to resources of the service.
+func New(s *res.Service, src Source, mapper Mapper) *Ingester {
+	return &Ingester{
+		s:      s,
+		src:    src,
+		mapper: mapper,
+	}
+}
+
+// SetOnError sets a function to call when a message fails to be mapped, or a
+// mutation fails to be applied. By default, the error is logged using the
+// service logger.
+func (ing *Ingester) SetOnError(f func(err error)) *Ingester {
+	ing.mu.Lock()
+	ing.onError = f
+	ing.mu.Unlock()
+	return ing
+}
+
+// Start subscribes to the source. The service must be started.
+func (ing *Ingester) Start() error {
+	return ing.src.Subscribe(ing.handle)
+}
+
+// Stop closes the source.
+func (ing *Ingester) Stop() error {
+	return ing.src.Close()
+}
+
+// handle maps a message and applies the mutations.
+func (ing *Ingester) handle(m Message) {
+	muts, err := ing.mapper(m)
+	if err != nil {
+		ing.error(fmt.Errorf("ingest: failed to map message on %s: %s", m.Subject, err))
+		return
+	}
+	for _, mut := range muts {
+		mut := mut
+		err := ing.s.With(mut.RID, func(r res.Resource) {
+			if err := apply(r, mut); err != nil {
+				ing.error(err)
+			}
+		})
+		if err != nil {
+			ing.error(fmt.Errorf("ingest: failed to apply mutation on %s: %s", mut.RID, err))
+		}
+	}
+}
+
+// apply sends the event for the mutation on the resource. Any panic caused by
+// an invalid event is returned as an error.
+func apply(r res.Resource, mut Mutation) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("ingest: failed to apply mutation on %s: %v", mut.RID, v)
+		}
+	}()
+	switch mut.Op {
+	case OpChange:
+		r.ChangeEvent(mut.Changed)
+	case OpAdd:
+		r.AddEvent(mut.Value, mut.Idx)
+	case OpRemove:
+		r.RemoveEvent(mut.Idx)
+	default:
+		return fmt.Errorf("ingest: unknown mutation op %d on %s", mut.Op, mut.RID)
+	}
+	return nil
+}
+
+func (ing *Ingester) error(err error) {
+	ing.mu.Lock()
+	f := ing.onError
+	ing.mu.Unlock()
+	if f != nil {
+		f(err)
+		return
+	}
+	if l := ing.s.Logger(); l != nil {
+		l.Errorf("%s", err)
+	}
+}
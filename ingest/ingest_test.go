@@ -0,0 +1,133 @@
+package ingest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/ingest"
+	"github.com/jirenius/go-res/restest"
+)
+
+// chanSource is a Source delivering messages sent on a channel.
+type chanSource struct {
+	ch chan ingest.Message
+}
+
+func (cs *chanSource) Subscribe(cb func(m ingest.Message)) error {
+	go func() {
+		for m := range cs.ch {
+			cb(m)
+		}
+	}()
+	return nil
+}
+
+func (cs *chanSource) Close() error {
+	close(cs.ch)
+	return nil
+}
+
+func newService() *res.Service {
+	s := res.NewService("test")
+	s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	s.Handle("collection", res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }))
+	return s
+}
+
+func jsonMapper(m ingest.Message) ([]ingest.Mutation, error) {
+	var ev struct {
+		Op    string      `json:"op"`
+		RID   string      `json:"rid"`
+		Value interface{} `json:"value"`
+		Idx   int         `json:"idx"`
+	}
+	if err := json.Unmarshal(m.Data, &ev); err != nil {
+		return nil, err
+	}
+	switch ev.Op {
+	case "change":
+		return []ingest.Mutation{ingest.Change(ev.RID, ev.Value.(map[string]interface{}))}, nil
+	case "add":
+		return []ingest.Mutation{ingest.Add(ev.RID, ev.Value, ev.Idx)}, nil
+	case "remove":
+		return []ingest.Mutation{ingest.Remove(ev.RID, ev.Idx)}, nil
+	}
+	return nil, nil
+}
+
+func TestIngester_WithMappedMutations_SendsEvents(t *testing.T) {
+	s := newService()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	src := &chanSource{ch: make(chan ingest.Message)}
+	ing := ingest.New(s, src, jsonMapper)
+	restest.AssertNoError(t, ing.Start())
+	defer ing.Stop()
+
+	src.ch <- ingest.Message{Data: []byte(`{"op":"change","rid":"test.model","value":{"foo":"bar"}}`)}
+	session.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+	src.ch <- ingest.Message{Data: []byte(`{"op":"add","rid":"test.collection","value":"foo","idx":1}`)}
+	session.GetMsg().AssertAddEvent("test.collection", "foo", 1)
+	src.ch <- ingest.Message{Data: []byte(`{"op":"remove","rid":"test.collection","idx":2}`)}
+	session.GetMsg().AssertRemoveEvent("test.collection", 2)
+}
+
+func TestIngester_WithMapperError_CallsOnError(t *testing.T) {
+	s := newService()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	errCh := make(chan error, 1)
+	src := &chanSource{ch: make(chan ingest.Message)}
+	ing := ingest.New(s, src, func(m ingest.Message) ([]ingest.Mutation, error) {
+		return nil, errors.New("invalid message")
+	}).SetOnError(func(err error) { errCh <- err })
+	restest.AssertNoError(t, ing.Start())
+	defer ing.Stop()
+
+	src.ch <- ingest.Message{Subject: "upstream.event", Data: []byte(`{}`)}
+	select {
+	case err := <-errCh:
+		restest.AssertError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("expected OnError to be called, but it wasn't")
+	}
+	session.AssertNoMsg(10 * time.Millisecond)
+}
+
+func TestIngester_WithUnmatchedRID_CallsOnError(t *testing.T) {
+	s := newService()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	errCh := make(chan error, 1)
+	src := &chanSource{ch: make(chan ingest.Message)}
+	ing := ingest.New(s, src, jsonMapper).SetOnError(func(err error) { errCh <- err })
+	restest.AssertNoError(t, ing.Start())
+	defer ing.Stop()
+
+	src.ch <- ingest.Message{Data: []byte(`{"op":"remove","rid":"test.missing","idx":0}`)}
+	select {
+	case err := <-errCh:
+		restest.AssertError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("expected OnError to be called, but it wasn't")
+	}
+}
+
+func TestNATSSource_WithMessage_SendsEvent(t *testing.T) {
+	s := newService()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	ing := ingest.New(s, ingest.NATSSource(s, "upstream.>"), jsonMapper)
+	restest.AssertNoError(t, ing.Start())
+
+	session.AssertSubscription("upstream.>")
+	session.SendMessage("upstream.model", "", []byte(`{"op":"change","rid":"test.model","value":{"foo":42}}`))
+	session.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+}
@@ -0,0 +1,66 @@
+package ingest
+
+import (
+	"errors"
+	"sync"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// natsSource is a Source reading messages from a NATS subject using the
+// service connection.
+type natsSource struct {
+	s       *res.Service
+	subject string
+	mu      sync.Mutex
+	sub     *nats.Subscription
+	done    chan struct{}
+}
+
+// NATSSource returns a Source reading messages from a NATS subject, using the
+// connection of the service. The subject may contain wildcards.
+func NATSSource(s *res.Service, subject string) Source {
+	return &natsSource{s: s, subject: subject}
+}
+
+// Subscribe subscribes to the subject.
+func (ns *natsSource) Subscribe(cb func(m Message)) error {
+	conn := ns.s.Conn()
+	if conn == nil {
+		return errors.New("ingest: service not started")
+	}
+	ch := make(chan *nats.Msg, 256)
+	sub, err := conn.ChanSubscribe(ns.subject, ch)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	ns.mu.Lock()
+	ns.sub = sub
+	ns.done = done
+	ns.mu.Unlock()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case m := <-ch:
+				cb(Message{Subject: m.Subject, Data: m.Data})
+			}
+		}
+	}()
+	return nil
+}
+
+// Close unsubscribes from the subject.
+func (ns *natsSource) Close() error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.done == nil {
+		return nil
+	}
+	close(ns.done)
+	ns.done = nil
+	return ns.sub.Unsubscribe()
+}
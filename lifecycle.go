@@ -0,0 +1,152 @@
+package res
+
+import (
+	"context"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// runRetryDelay is the delay between attempts to shut down a service that is
+// still starting when the context passed to Run is done.
+const runRetryDelay = 10 * time.Millisecond
+
+// OnStart adds a hook called when the service has connected, but before
+// subscribing to requests and sending the initial system reset event. Hooks
+// are called in the order they were added, after any OnServeBefore callback.
+//
+// If a hook returns an error, no further hooks are called, the service is
+// stopped, and the error is returned by Serve or ListenAndServe.
+//
+// Panics if service is already started.
+func (s *Service) OnStart(f func(*Service) error) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onStart = append(s.onStart, f)
+	return s
+}
+
+// OnReady adds a hook called when the service has subscribed to requests and
+// sent the initial system reset event, after any OnServe callback. Hooks are
+// called in the order they were added.
+//
+// If a hook returns an error, no further hooks are called, the service is
+// stopped, and the error is returned by Serve or ListenAndServe.
+//
+// Panics if service is already started.
+func (s *Service) OnReady(f func(*Service) error) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onReady = append(s.onReady, f)
+	return s
+}
+
+// OnStopping adds a hook called when the service is about to stop, before the
+// connection is closed. Hooks are called in the order they were added, also
+// when startup is aborted.
+//
+// All hooks are called even if one returns an error. Errors are logged, and the
+// first error is returned by Shutdown.
+//
+// Panics if service is already started.
+func (s *Service) OnStopping(f func(*Service) error) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onStopping = append(s.onStopping, f)
+	return s
+}
+
+// OnStopped adds a hook called when the service has stopped, and all workers
+// are done. Hooks are called in the order they were added, also when startup is
+// aborted.
+//
+// All hooks are called even if one returns an error. Errors are logged, and the
+// first error is returned by Shutdown.
+//
+// Panics if service is already started.
+func (s *Service) OnStopped(f func(*Service) error) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onStopped = append(s.onStopped, f)
+	return s
+}
+
+// Run connects to the NATS server at the url and serves requests, using
+// ListenAndServe, until the context is done. It then shuts down the service
+// and waits for it to stop.
+//
+// Run returns the error returned by ListenAndServe, or by Shutdown if the
+// context is done.
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if err := s.Run(ctx, "nats://localhost:4222"); err != nil {
+//		log.Fatal(err)
+//	}
+func (s *Service) Run(ctx context.Context, url string, options ...nats.Option) error {
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe(url, options...) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	for {
+		err := s.Shutdown()
+		if err != errNotStarted {
+			serr := <-done
+			if err == nil {
+				err = serr
+			}
+			return err
+		}
+		// Still starting, or stopped on its own.
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(runRetryDelay):
+		}
+	}
+}
+
+// start calls the OnServeBefore callback and the OnStart hooks, returning the
+// first error encountered.
+func (s *Service) start() error {
+	if s.onServeBefore != nil {
+		if err := s.onServeBefore(s); err != nil {
+			return err
+		}
+	}
+	return s.callHooks(s.onStart)
+}
+
+// callHooks calls the hooks in order, returning on the first error.
+func (s *Service) callHooks(hooks []func(*Service) error) error {
+	for _, f := range hooks {
+		if err := f(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callStopHooks calls all the hooks in order, logging any error, and returns
+// the first error encountered.
+func (s *Service) callStopHooks(hooks []func(*Service) error) error {
+	var first error
+	for _, f := range hooks {
+		if err := f(s); err != nil {
+			s.errorf("Error stopping service: %s", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,121 @@
+package res
+
+import (
+	"fmt"
+)
+
+// ListenerPolicy determines how an error returned by an ErrorListener is
+// handled.
+type ListenerPolicy int
+
+// Listener policies
+const (
+	// ListenerLog logs the error, and lets the remaining listeners be called.
+	ListenerLog ListenerPolicy = iota
+
+	// ListenerRetry calls the listener again, up to three times, before
+	// logging the error.
+	ListenerRetry
+
+	// ListenerVeto calls the listener before the event is applied and sent. An
+	// error vetoes the event, which is neither applied nor sent, and the
+	// event method panics with the error. As the event is not yet applied,
+	// the OldValues of change events, the Value of remove events, and the Data
+	// of delete events are not set.
+	ListenerVeto
+)
+
+// listenerRetries is the number of retries of an ErrorListener with the
+// ListenerRetry policy.
+const listenerRetries = 3
+
+// ErrorListener is an event listener returning an error on failure, handled
+// according to its Policy. A panic in the listener is recovered, and handled
+// as an error.
+type ErrorListener struct {
+	// Policy determines how a returned error is handled.
+	Policy ListenerPolicy
+
+	// Handler is the callback called on events.
+	Handler func(*Event) error
+
+	// Async flags that the listener is called on a dedicated listener worker
+	// instead of the resource's worker goroutine, to not delay requests with
+	// heavyweight listeners, such as for persistence or webhooks. Events of
+	// the same resource are passed to async listeners in the order they
+	// were sent. The listener should not send events, and should treat the
+	// event as read-only.
+	//
+	// Cannot be used with the ListenerVeto policy.
+	Async bool
+}
+
+// vetoEvent calls any listeners with the ListenerVeto policy with the event
+// returned by ev, before it is applied and sent. It panics with the error of
+// the first listener vetoing the event.
+func (r *resource) vetoEvent(ev func() *Event) {
+	var e *Event
+	for _, l := range r.elisteners {
+		if l.Policy != ListenerVeto {
+			continue
+		}
+		if e == nil {
+			e = ev()
+		}
+		if err := callErrorListener(l.Handler, e); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// hasListeners returns true if the resource has any listeners called after
+// an event is sent.
+func (r *resource) hasListeners() bool {
+	return r.listeners != nil || r.elisteners != nil
+}
+
+// callListeners calls the listeners with the sent event.
+func (r *resource) callListeners(ev *Event) {
+	for _, cb := range r.listeners {
+		cb(ev)
+	}
+	for _, l := range r.elisteners {
+		if l.Policy == ListenerVeto {
+			continue
+		}
+		if l.Async {
+			l := l
+			r.s.runListener(r.rname, func() {
+				r.callListener(l, ev)
+			})
+		} else {
+			r.callListener(l, ev)
+		}
+	}
+}
+
+// callListener calls the listener with the event, handling any error
+// according to the listener's policy.
+func (r *resource) callListener(l ErrorListener, ev *Event) {
+	attempts := 1
+	if l.Policy == ListenerRetry {
+		attempts += listenerRetries
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = callErrorListener(l.Handler, ev); err == nil {
+			return
+		}
+	}
+	r.s.errorf("Event listener failed on %s event for %s: %s", ev.Name, r.rname, err)
+}
+
+// callErrorListener calls the listener, returning any panic as an error.
+func callErrorListener(cb func(*Event) error, ev *Event) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("listener panic: %v", v)
+		}
+	}()
+	return cb(ev)
+}
@@ -13,3 +13,13 @@ type Logger interface {
 	// Tracef all network traffic going to and from the service.
 	Tracef(format string, v ...interface{})
 }
+
+// Level represents the level of a log entry.
+type Level int
+
+// Log entry levels
+const (
+	LevelTrace Level = iota
+	LevelInfo
+	LevelError
+)
@@ -0,0 +1,224 @@
+package res
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serviceCounters holds the counters of a service, updated atomically.
+type serviceCounters struct {
+	requests             uint64
+	errors               uint64
+	events               uint64
+	queryRequests        uint64
+	reusedQueryResponses uint64
+	shadowRequests       uint64
+	shadowMismatches     uint64
+}
+
+// Stats holds counters and queue lengths of a service, as returned by
+// Service.Stats.
+type Stats struct {
+	// Requests is the number of responses sent to requests.
+	Requests uint64 `json:"requests"`
+
+	// Errors is the number of error responses sent to requests.
+	Errors uint64 `json:"errors"`
+
+	// Events is the number of events published.
+	Events uint64 `json:"events"`
+
+	// QueryRequests is the number of responses sent to query requests.
+	QueryRequests uint64 `json:"queryRequests"`
+
+	// ReusedQueryResponses is the number of responses sent to query
+	// requests, reusing the response of a previous query request with the
+	// same query, for handlers with ReuseQueryResponses set.
+	ReusedQueryResponses uint64 `json:"reusedQueryResponses"`
+
+	// ShadowRequests is the number of shadowed call requests compared with
+	// the response of an alternate handler or service. See ShadowCall.
+	ShadowRequests uint64 `json:"shadowRequests"`
+
+	// ShadowMismatches is the number of shadowed call requests where the
+	// alternate response differed from the primary response.
+	ShadowMismatches uint64 `json:"shadowMismatches"`
+
+	// QueuedWork is the number of resource worker queues waiting for a
+	// worker.
+	QueuedWork int `json:"queuedWork"`
+
+	// QueuedListeners is the number of asynchronous event listener queues
+	// waiting for a listener worker.
+	QueuedListeners int `json:"queuedListeners"`
+
+	// QueuedQueries is the number of query requests waiting for a query
+	// worker.
+	QueuedQueries int `json:"queuedQueries"`
+}
+
+// Metrics holds the stats of a service, and the rates measured during the
+// last interval, as sent by the resource registered with HandleMetrics.
+type Metrics struct {
+	Stats
+
+	// RequestRate is the number of responses sent per second.
+	RequestRate float64 `json:"requestRate"`
+
+	// ErrorRate is the fraction of the responses that were errors, between 0
+	// and 1.
+	ErrorRate float64 `json:"errorRate"`
+
+	// EventRate is the number of events published per second.
+	EventRate float64 `json:"eventRate"`
+}
+
+// metricsResource is the state of a resource registered with HandleMetrics.
+type metricsResource struct {
+	s        *Service
+	rid      string
+	interval time.Duration
+	mu       sync.Mutex
+	last     Stats     // Stats at the start of the current interval
+	lastTime time.Time // Time of the start of the current interval
+	timer    Timer     // Timer for the end of the current interval. Nil when stopped.
+	current  Metrics   // Metrics sent to clients. Only accessed on the resource's worker goroutine.
+}
+
+// Stats returns the counters and queue lengths of the service. Counters are
+// kept from when the service is created, including any previous runs.
+func (s *Service) Stats() Stats {
+	return Stats{
+		Requests:             atomic.LoadUint64(&s.counters.requests),
+		Errors:               atomic.LoadUint64(&s.counters.errors),
+		Events:               atomic.LoadUint64(&s.counters.events),
+		QueryRequests:        atomic.LoadUint64(&s.counters.queryRequests),
+		ReusedQueryResponses: atomic.LoadUint64(&s.counters.reusedQueryResponses),
+		ShadowRequests:       atomic.LoadUint64(&s.counters.shadowRequests),
+		ShadowMismatches:     atomic.LoadUint64(&s.counters.shadowMismatches),
+		QueuedWork:           queued(s.shards...),
+		QueuedListeners:      queued(s.lshard),
+		QueuedQueries:        queued(s.qshard),
+	}
+}
+
+// queued returns the number of work queues waiting for a worker in the shards.
+func queued(shards ...*workShard) int {
+	n := 0
+	for _, sh := range shards {
+		if sh == nil {
+			continue
+		}
+		sh.mu.Lock()
+		n += len(sh.workqueue)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// countReply counts a published reply, and whether it is an error response.
+func (s *Service) countReply(payload []byte) {
+	atomic.AddUint64(&s.counters.requests, 1)
+	if bytes.HasPrefix(payload, []byte(`{"error"`)) {
+		atomic.AddUint64(&s.counters.errors, 1)
+	}
+}
+
+// HandleMetrics registers a model resource for the pattern, with the service
+// Metrics, letting admin dashboards monitor the service through the RES API.
+// While the service is running, the rates are measured over each interval,
+// and the metrics are updated with a change event at the end of it. Until the
+// first interval has passed, all values are zero:
+//
+//	s.HandleMetrics("system.metrics", 5*time.Second, res.Access(res.AccessGranted))
+//
+// Any options, such as an access handler, are added to the handler. Without
+// one, access to the resource must be granted by another service.
+//
+// Panics if the pattern contains wildcards or placeholders, or if interval
+// is not greater than zero.
+func (s *Service) HandleMetrics(pattern string, interval time.Duration, hf ...Option) {
+	if !Pattern(pattern).IsValid() || Pattern(pattern).IndexWildcard() >= 0 {
+		panic("res: metrics pattern must be a valid resource name")
+	}
+	if interval <= 0 {
+		panic("res: metrics interval must be greater than zero")
+	}
+	m := &metricsResource{
+		s:        s,
+		rid:      mergePattern(s.Mux.FullPath(), pattern),
+		interval: interval,
+	}
+	s.Handle(pattern, append([]Option{
+		GetModel(func(r ModelRequest) {
+			r.Model(m.current)
+		}),
+	}, hf...)...)
+	s.OnReady(func(*Service) error {
+		m.start()
+		return nil
+	})
+	s.OnStopping(func(*Service) error {
+		m.stop()
+		return nil
+	})
+}
+
+// start starts measuring the first interval.
+func (m *metricsResource) start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = m.s.Stats()
+	m.lastTime = m.s.clock.Now()
+	m.timer = m.s.clock.AfterFunc(m.interval, m.tick)
+}
+
+// stop stops measuring.
+func (m *metricsResource) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+// tick ends the current interval, starts the next, and sends a change event
+// with the metrics of the ended interval.
+func (m *metricsResource) tick() {
+	m.mu.Lock()
+	if m.timer == nil {
+		m.mu.Unlock()
+		return
+	}
+	st := m.s.Stats()
+	now := m.s.clock.Now()
+	after := Metrics{Stats: st}
+	if secs := now.Sub(m.lastTime).Seconds(); secs > 0 {
+		after.RequestRate = float64(st.Requests-m.last.Requests) / secs
+		after.EventRate = float64(st.Events-m.last.Events) / secs
+	}
+	if n := st.Requests - m.last.Requests; n > 0 {
+		after.ErrorRate = float64(st.Errors-m.last.Errors) / float64(n)
+	}
+	m.last = st
+	m.lastTime = now
+	m.timer = m.s.clock.AfterFunc(m.interval, m.tick)
+	m.mu.Unlock()
+
+	err := m.s.With(m.rid, func(r Resource) {
+		before := m.current
+		m.current = after
+		ch, err := DiffModel(before, after)
+		if err != nil {
+			m.s.errorf("Error diffing metrics %s: %s", m.rid, err)
+			return
+		}
+		r.ChangeEvent(ch)
+	})
+	if err != nil {
+		m.s.errorf("Error updating metrics %s: %s", m.rid, err)
+	}
+}
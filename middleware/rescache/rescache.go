@@ -0,0 +1,309 @@
+/*
+Package rescache provides a read-through cache for get handlers of resources
+backed by slow external sources, such as third-party HTTP APIs.
+
+Fetched values are served from the cache while fresh. Once a value is stale,
+it is still served while it is revalidated in the background, and a change
+event is sent for models, or a reset event for collections, if the refreshed
+value differs. Values that have been stale for too long are fetched again
+before the get request is responded to.
+
+# Usage
+
+Cache weather reports for a minute, and serve stale reports for up to an hour
+while refreshing:
+
+	weather := rescache.New(func(rid string, params map[string]string) (interface{}, error) {
+		return fetchWeather(params["city"])
+	}).
+		SetTTL(time.Minute).
+		SetStaleTTL(time.Hour)
+
+	s.Handle("weather.$city", res.Model, weather)
+*/
+package rescache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// DefaultTTL is the duration a fetched value is fresh if no TTL is set.
+const DefaultTTL = time.Minute
+
+// Fetcher fetches the value of a resource from the external source. The
+// params are the resource's path parameters.
+//
+// The fetcher is called on the resource's worker goroutine when a value is
+// missing or expired, and on a separate goroutine when a stale value is
+// revalidated. It may return res.ErrNotFound, or any other error to respond
+// with.
+type Fetcher func(rid string, params map[string]string) (interface{}, error)
+
+// Cache is a read-through cache of resource values. It is used as a handler
+// option to set the get handler of a resource.
+//
+// Resources with a query are not cached, and are fetched on each get request.
+type Cache struct {
+	fetch    Fetcher
+	ttl      time.Duration
+	staleTTL time.Duration
+	onError  func(err error)
+	mu       sync.Mutex
+	entries  map[string]*entry
+}
+
+// entry is a cached value.
+type entry struct {
+	value      interface{}
+	fetched    time.Time
+	refreshing bool
+}
+
+// New returns a new Cache fetching values with fetch.
+func New(fetch Fetcher) *Cache {
+	if fetch == nil {
+		panic("rescache: nil fetcher")
+	}
+	return &Cache{
+		fetch:   fetch,
+		ttl:     DefaultTTL,
+		entries: make(map[string]*entry),
+	}
+}
+
+// SetTTL sets the duration a fetched value is fresh, and served without being
+// revalidated. Defaults to DefaultTTL.
+func (c *Cache) SetTTL(d time.Duration) *Cache {
+	c.ttl = d
+	return c
+}
+
+// SetStaleTTL sets the duration, after the value is no longer fresh, that a
+// stale value is served while being revalidated in the background. After
+// that, the value is fetched again before responding. Defaults to zero,
+// meaning stale values are never served.
+func (c *Cache) SetStaleTTL(d time.Duration) *Cache {
+	c.staleTTL = d
+	return c
+}
+
+// SetOnError sets a callback called when a stale value fails to be
+// revalidated, or when change events fail to be created. Defaults to logging
+// the error using the service logger.
+func (c *Cache) SetOnError(f func(err error)) *Cache {
+	c.onError = f
+	return c
+}
+
+// SetOption is to implement the res.Option interface.
+func (c *Cache) SetOption(h *res.Handler) {
+	if h.Get != nil {
+		panic("rescache: get handler already set")
+	}
+	h.Get = c.get
+}
+
+// Invalidate removes the cached values of the resources, causing them to be
+// fetched on next get request.
+func (c *Cache) Invalidate(rids ...string) {
+	c.mu.Lock()
+	for _, rid := range rids {
+		delete(c.entries, rid)
+	}
+	c.mu.Unlock()
+}
+
+// Refresh fetches the values of the cached resources, and sends a change
+// event for models, or a reset event for collections, if the value differs
+// from the cached one. Resources not in the cache are ignored. It may be
+// called periodically to keep resources up to date while clients are
+// subscribed to them, as the gateway will not make get requests for values
+// it already holds.
+//
+// Returns the first error encountered. Refresh must not be called from a
+// worker goroutine.
+func (c *Cache) Refresh(s *res.Service, rids ...string) error {
+	var first error
+	for _, rid := range rids {
+		c.mu.Lock()
+		_, ok := c.entries[rid]
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		ch := make(chan map[string]string, 1)
+		err := s.With(rid, func(r res.Resource) {
+			ch <- r.PathParams()
+		})
+		if err == nil {
+			err = c.refresh(s, rid, <-ch)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// get is the get handler serving cached values.
+func (c *Cache) get(r res.GetRequest) {
+	if r.Query() != "" {
+		v, err := c.fetch(r.ResourceName()+"?"+r.Query(), r.PathParams())
+		c.respond(r, v, err)
+		return
+	}
+	rid := r.ResourceName()
+	now := r.Service().Clock().Now()
+	c.mu.Lock()
+	e, ok := c.entries[rid]
+	if ok {
+		age := now.Sub(e.fetched)
+		if age < c.ttl {
+			c.mu.Unlock()
+			c.respond(r, e.value, nil)
+			return
+		}
+		if age < c.ttl+c.staleTTL {
+			refresh := !e.refreshing
+			e.refreshing = true
+			c.mu.Unlock()
+			if refresh {
+				s, params := r.Service(), r.PathParams()
+				go c.revalidate(s, rid, params)
+			}
+			c.respond(r, e.value, nil)
+			return
+		}
+		delete(c.entries, rid)
+	}
+	c.mu.Unlock()
+
+	v, err := c.fetch(rid, r.PathParams())
+	if err == nil {
+		c.mu.Lock()
+		c.entries[rid] = &entry{value: v, fetched: now}
+		c.mu.Unlock()
+	}
+	c.respond(r, v, err)
+}
+
+// respond responds to the get request with the value or error.
+func (c *Cache) respond(r res.GetRequest, v interface{}, err error) {
+	if err != nil {
+		r.Error(err)
+		return
+	}
+	if r.ResourceType() == res.TypeCollection {
+		r.Collection(v)
+	} else {
+		r.Model(v)
+	}
+}
+
+// revalidate refreshes a stale value, reporting any error.
+func (c *Cache) revalidate(s *res.Service, rid string, params map[string]string) {
+	if err := c.refresh(s, rid, params); err != nil {
+		c.error(s, err)
+	}
+}
+
+// refresh fetches the value of the resource, and updates the cache on the
+// resource's worker goroutine, sending events if the value has changed. If
+// fetching fails, the cached value is kept.
+func (c *Cache) refresh(s *res.Service, rid string, params map[string]string) error {
+	v, err := c.fetch(rid, params)
+	if err != nil {
+		c.mu.Lock()
+		if e, ok := c.entries[rid]; ok {
+			e.refreshing = false
+		}
+		c.mu.Unlock()
+		if errors.Is(err, res.ErrNotFound) {
+			return c.deleted(s, rid)
+		}
+		return fmt.Errorf("rescache: failed to refresh %s: %s", rid, err)
+	}
+	ch := make(chan error, 1)
+	err = s.With(rid, func(r res.Resource) {
+		c.mu.Lock()
+		e, ok := c.entries[rid]
+		c.entries[rid] = &entry{value: v, fetched: s.Clock().Now()}
+		c.mu.Unlock()
+		if !ok {
+			ch <- nil
+			return
+		}
+		ch <- sendChange(r, e.value, v)
+	})
+	if err != nil {
+		return fmt.Errorf("rescache: failed to refresh %s: %s", rid, err)
+	}
+	return <-ch
+}
+
+// deleted removes the cached value of a resource no longer found, and sends
+// a delete event.
+func (c *Cache) deleted(s *res.Service, rid string) error {
+	return s.With(rid, func(r res.Resource) {
+		c.mu.Lock()
+		_, ok := c.entries[rid]
+		delete(c.entries, rid)
+		c.mu.Unlock()
+		if ok {
+			r.DeleteEvent()
+		}
+	})
+}
+
+// sendChange sends a change event for models, or a reset event for
+// collections, if the values differ.
+func sendChange(r res.Resource, before, after interface{}) error {
+	if r.ResourceType() == res.TypeCollection {
+		equal, err := jsonEqual(before, after)
+		if err != nil {
+			return fmt.Errorf("rescache: failed to compare %s: %s", r.ResourceName(), err)
+		}
+		if !equal {
+			r.ResetEvent()
+		}
+		return nil
+	}
+	ch, err := res.DiffModel(before, after)
+	if err != nil {
+		return fmt.Errorf("rescache: failed to compare %s: %s", r.ResourceName(), err)
+	}
+	if len(ch) > 0 {
+		r.ChangeEvent(ch)
+	}
+	return nil
+}
+
+// jsonEqual returns true if the values have the same JSON encoding.
+func jsonEqual(a, b interface{}) (bool, error) {
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return string(da) == string(db), nil
+}
+
+// error calls the OnError callback, or logs the error.
+func (c *Cache) error(s *res.Service, err error) {
+	if c.onError != nil {
+		c.onError(err)
+		return
+	}
+	if l := s.Logger(); l != nil {
+		l.Errorf("%s", err)
+	}
+}
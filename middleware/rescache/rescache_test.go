@@ -0,0 +1,157 @@
+package rescache_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/middleware/rescache"
+	"github.com/jirenius/go-res/restest"
+)
+
+// source is a mock external source, counting fetches.
+type source struct {
+	mu    sync.Mutex
+	value interface{}
+	err   error
+	count int
+}
+
+func (src *source) set(v interface{}, err error) {
+	src.mu.Lock()
+	src.value, src.err = v, err
+	src.mu.Unlock()
+}
+
+func (src *source) fetches() int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.count
+}
+
+func (src *source) fetch(rid string, params map[string]string) (interface{}, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.count++
+	return src.value, src.err
+}
+
+func runCache(t *testing.T, typ res.Option, c *rescache.Cache, cb func(s *restest.Session)) {
+	s := res.NewService("test")
+	s.Handle("model.$id", typ, c)
+	session := restest.NewSession(t, s)
+	defer session.Close()
+	cb(session)
+}
+
+func TestCache_FreshValue_ServesCachedValue(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	runCache(t, res.Model, rescache.New(src.fetch), func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(map[string]interface{}{"temp": 21}, nil)
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		restest.AssertEqualJSON(t, "fetches", src.fetches(), 1)
+	})
+}
+
+func TestCache_StaleValue_ServesStaleValueAndSendsChangeEvent(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20, "wind": 5}}
+	c := rescache.New(src.fetch).SetTTL(0).SetStaleTTL(time.Hour)
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20, "wind": 5})
+		src.set(map[string]interface{}{"temp": 21, "wind": 5}, nil)
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20, "wind": 5})
+		s.GetMsg().AssertChangeEvent("test.model.1", map[string]interface{}{"temp": 21})
+		restest.AssertEqualJSON(t, "fetches", src.fetches(), 2)
+	})
+}
+
+func TestCache_StaleCollection_SendsResetEvent(t *testing.T) {
+	src := &source{value: []interface{}{"a", "b"}}
+	c := rescache.New(src.fetch).SetTTL(0).SetStaleTTL(time.Hour)
+	runCache(t, res.Collection, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertCollection([]interface{}{"a", "b"})
+		src.set([]interface{}{"a", "c"}, nil)
+		s.Get("test.model.1").Response().AssertCollection([]interface{}{"a", "b"})
+		s.GetMsg().AssertSystemReset([]string{"test.model.1"}, nil)
+	})
+}
+
+func TestCache_ExpiredValue_FetchesBeforeResponding(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	c := rescache.New(src.fetch).SetTTL(time.Millisecond)
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(map[string]interface{}{"temp": 21}, nil)
+		time.Sleep(5 * time.Millisecond)
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 21})
+	})
+}
+
+func TestCache_FetchError_RespondsWithError(t *testing.T) {
+	src := &source{err: res.ErrNotFound}
+	runCache(t, res.Model, rescache.New(src.fetch), func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertError(res.ErrNotFound)
+		s.Get("test.model.1").Response().AssertError(res.ErrNotFound)
+		restest.AssertEqualJSON(t, "fetches", src.fetches(), 2)
+	})
+}
+
+func TestCache_RevalidationError_KeepsStaleValue(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	errs := make(chan error, 1)
+	c := rescache.New(src.fetch).
+		SetTTL(0).
+		SetStaleTTL(time.Hour).
+		SetOnError(func(err error) { errs <- err })
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(nil, errors.New("unavailable"))
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		select {
+		case err := <-errs:
+			restest.AssertError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("expected revalidation error, but got none")
+		}
+		src.set(map[string]interface{}{"temp": 21}, nil)
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		s.GetMsg().AssertChangeEvent("test.model.1", map[string]interface{}{"temp": 21})
+	})
+}
+
+func TestCache_Refresh_SendsChangeEvent(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	c := rescache.New(src.fetch).SetTTL(time.Hour)
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(map[string]interface{}{"temp": 21}, nil)
+		restest.AssertNoError(t, c.Refresh(s.Service(), "test.model.1", "test.model.2"))
+		s.GetMsg().AssertChangeEvent("test.model.1", map[string]interface{}{"temp": 21})
+		restest.AssertEqualJSON(t, "fetches", src.fetches(), 2)
+	})
+}
+
+func TestCache_RefreshNotFound_SendsDeleteEvent(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	c := rescache.New(src.fetch).SetTTL(time.Hour)
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(nil, res.ErrNotFound)
+		restest.AssertNoError(t, c.Refresh(s.Service(), "test.model.1"))
+		s.GetMsg().AssertDeleteEvent("test.model.1")
+	})
+}
+
+func TestCache_Invalidate_FetchesOnNextGet(t *testing.T) {
+	src := &source{value: map[string]interface{}{"temp": 20}}
+	c := rescache.New(src.fetch).SetTTL(time.Hour)
+	runCache(t, res.Model, c, func(s *restest.Session) {
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 20})
+		src.set(map[string]interface{}{"temp": 21}, nil)
+		c.Invalidate("test.model.1")
+		s.Get("test.model.1").Response().AssertModel(map[string]interface{}{"temp": 21})
+	})
+}
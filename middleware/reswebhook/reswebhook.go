@@ -0,0 +1,223 @@
+/*
+Package reswebhook provides a listener posting resource events to an HTTP
+endpoint, so that external systems can react to changes without access to
+NATS.
+
+Events are posted as JSON using a POST request. If a Secret is set, the
+request body is signed using HMAC-SHA256, and the signature is set in the
+X-Res-Signature header as:
+
+	sha256=<hex encoded signature>
+
+# Usage
+
+Post change events for books to an endpoint:
+
+	s.AddListener("book.$id", reswebhook.Webhook{}.
+		WithURL("https://example.com/hooks/book").
+		WithEvents("change").
+		WithSecret([]byte("secret")).
+		Listener())
+*/
+package reswebhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+)
+
+// SignatureHeader is the HTTP header containing the payload signature.
+const SignatureHeader = "X-Res-Signature"
+
+// DefaultRetryDelay is the delay before the first retry if RetryDelay is not
+// set. The delay is doubled for each following retry.
+const DefaultRetryDelay = time.Second
+
+// Webhook posts resource events to an HTTP endpoint.
+type Webhook struct {
+	// URL is the endpoint to post events to.
+	URL string
+	// Events is a list of event names to post. If empty, all events are posted.
+	Events []string
+	// Secret is the key used to sign the payload. If nil, no signature is set.
+	Secret []byte
+	// Template returns the value to post for an event. It is called in the
+	// context of the resource emitting the event. Defaults to a Payload value.
+	Template func(ev *res.Event) (interface{}, error)
+	// Retries is the number of times a failed post is retried.
+	Retries int
+	// RetryDelay is the delay before the first retry. The delay is doubled for
+	// each following retry. Defaults to DefaultRetryDelay.
+	RetryDelay time.Duration
+	// Client is the HTTP client used to post events. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+	// OnError is called when an event fails to be posted. Defaults to logging
+	// the error using the service logger.
+	OnError func(err error)
+}
+
+// Payload is the default value posted for an event.
+type Payload = resprot.ListenerEvent
+
+// WithURL returns a new Webhook value with the URL set to url.
+func (wh Webhook) WithURL(url string) Webhook {
+	wh.URL = url
+	return wh
+}
+
+// WithEvents returns a new Webhook value with Events set to events.
+func (wh Webhook) WithEvents(events ...string) Webhook {
+	wh.Events = events
+	return wh
+}
+
+// WithSecret returns a new Webhook value with the Secret set to secret.
+func (wh Webhook) WithSecret(secret []byte) Webhook {
+	wh.Secret = secret
+	return wh
+}
+
+// WithTemplate returns a new Webhook value with the Template set to f.
+func (wh Webhook) WithTemplate(f func(ev *res.Event) (interface{}, error)) Webhook {
+	wh.Template = f
+	return wh
+}
+
+// WithRetries returns a new Webhook value with Retries set to retries, and
+// RetryDelay set to delay.
+func (wh Webhook) WithRetries(retries int, delay time.Duration) Webhook {
+	wh.Retries = retries
+	wh.RetryDelay = delay
+	return wh
+}
+
+// WithClient returns a new Webhook value with the Client set to client.
+func (wh Webhook) WithClient(client *http.Client) Webhook {
+	wh.Client = client
+	return wh
+}
+
+// WithOnError returns a new Webhook value with OnError set to f.
+func (wh Webhook) WithOnError(f func(err error)) Webhook {
+	wh.OnError = f
+	return wh
+}
+
+// Listener returns an event listener posting matching events to the URL. It
+// is to be added using Mux.AddListener, or in Handler.Listeners.
+//
+// Events are posted asynchronously, and may arrive out of order.
+func (wh Webhook) Listener() func(*res.Event) {
+	return func(ev *res.Event) {
+		if !wh.matches(ev.Name) {
+			return
+		}
+		v, err := wh.payload(ev)
+		var data []byte
+		if err == nil {
+			data, err = json.Marshal(v)
+		}
+		if err != nil {
+			wh.error(ev.Resource.Service(), fmt.Errorf("reswebhook: failed to create payload for %s event on %s: %s", ev.Name, ev.Resource.ResourceName(), err))
+			return
+		}
+		s := ev.Resource.Service()
+		go func() {
+			if err := wh.post(data); err != nil {
+				wh.error(s, err)
+			}
+		}()
+	}
+}
+
+// matches returns true if the event name should be posted.
+func (wh Webhook) matches(name string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, e := range wh.Events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// payload returns the value to post for the event.
+func (wh Webhook) payload(ev *res.Event) (interface{}, error) {
+	if wh.Template != nil {
+		return wh.Template(ev)
+	}
+	return resprot.NewListenerEvent(ev), nil
+}
+
+// post sends the data to the URL, retrying on failure.
+func (wh Webhook) post(data []byte) error {
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	delay := wh.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	var err error
+	for i := 0; i <= wh.Retries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = wh.send(client, data); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// send makes a single post request.
+func (wh Webhook) send(client *http.Client, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.Secret != nil {
+		req.Header.Set(SignatureHeader, Sign(wh.Secret, data))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("reswebhook: post to %s responded with status %d", wh.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (wh Webhook) error(s *res.Service, err error) {
+	if wh.OnError != nil {
+		wh.OnError(err)
+		return
+	}
+	if l := s.Logger(); l != nil {
+		l.Errorf("%s", err)
+	}
+}
+
+// Sign returns the signature of the data, as set in the SignatureHeader.
+func Sign(secret, data []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package reswebhook_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/middleware/reswebhook"
+	"github.com/jirenius/go-res/restest"
+)
+
+type post struct {
+	body      string
+	signature string
+}
+
+func newServer(t *testing.T, failures int32) (*httptest.Server, chan post) {
+	ch := make(chan post, 10)
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- post{body: string(body), signature: r.Header.Get(reswebhook.SignatureHeader)}
+	}))
+	return srv, ch
+}
+
+func runWebhook(t *testing.T, wh reswebhook.Webhook, cb func(s *restest.Session)) {
+	s := res.NewService("test")
+	s.Handle("model",
+		res.Call("change", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+			r.OK(nil)
+		}),
+		res.Call("custom", func(r res.CallRequest) {
+			r.Event("custom", map[string]interface{}{"foo": 42})
+			r.OK(nil)
+		}),
+	)
+	s.AddListener("model", wh.Listener())
+	session := restest.NewSession(t, s)
+	defer session.Close()
+	cb(session)
+}
+
+func awaitPost(t *testing.T, ch chan post) post {
+	select {
+	case p := <-ch:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("expected webhook post, but got none")
+	}
+	return post{}
+}
+
+func TestWebhook_ChangeEvent_PostsPayload(t *testing.T) {
+	srv, ch := newServer(t, 0)
+	defer srv.Close()
+	runWebhook(t, reswebhook.Webhook{}.WithURL(srv.URL), func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		req.Response().AssertResult(nil)
+		p := awaitPost(t, ch)
+		restest.AssertEqualJSON(t, "body", p.body, `{"rid":"test.model","event":"change","changed":{"foo":"bar"}}`)
+		restest.AssertEqualJSON(t, "signature", p.signature, "")
+	})
+}
+
+func TestWebhook_WithSecret_SignsPayload(t *testing.T) {
+	srv, ch := newServer(t, 0)
+	defer srv.Close()
+	secret := []byte("secret")
+	runWebhook(t, reswebhook.Webhook{}.WithURL(srv.URL).WithSecret(secret), func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg()
+		req.Response()
+		p := awaitPost(t, ch)
+		restest.AssertEqualJSON(t, "signature", p.signature, reswebhook.Sign(secret, []byte(p.body)))
+	})
+}
+
+func TestWebhook_WithEventFilter_PostsMatchingEvents(t *testing.T) {
+	srv, ch := newServer(t, 0)
+	defer srv.Close()
+	runWebhook(t, reswebhook.Webhook{}.WithURL(srv.URL).WithEvents("custom"), func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg()
+		req.Response()
+		req = s.Call("test.model", "custom", nil)
+		s.GetMsg()
+		req.Response()
+		p := awaitPost(t, ch)
+		restest.AssertEqualJSON(t, "body", p.body, `{"rid":"test.model","event":"custom","payload":{"foo":42}}`)
+	})
+}
+
+func TestWebhook_WithTemplate_PostsTemplatedPayload(t *testing.T) {
+	srv, ch := newServer(t, 0)
+	defer srv.Close()
+	wh := reswebhook.Webhook{}.
+		WithURL(srv.URL).
+		WithTemplate(func(ev *res.Event) (interface{}, error) {
+			return map[string]interface{}{"text": ev.Resource.ResourceName() + " " + ev.Name}, nil
+		})
+	runWebhook(t, wh, func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg()
+		req.Response()
+		p := awaitPost(t, ch)
+		restest.AssertEqualJSON(t, "body", p.body, `{"text":"test.model change"}`)
+	})
+}
+
+func TestWebhook_WithRetries_RetriesFailedPost(t *testing.T) {
+	srv, ch := newServer(t, 2)
+	defer srv.Close()
+	runWebhook(t, reswebhook.Webhook{}.WithURL(srv.URL).WithRetries(2, time.Millisecond), func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg()
+		req.Response()
+		awaitPost(t, ch)
+	})
+}
+
+func TestWebhook_WithFailedPost_CallsOnError(t *testing.T) {
+	srv, _ := newServer(t, 10)
+	defer srv.Close()
+	errCh := make(chan error, 1)
+	wh := reswebhook.Webhook{}.
+		WithURL(srv.URL).
+		WithRetries(1, time.Millisecond).
+		WithOnError(func(err error) { errCh <- err })
+	runWebhook(t, wh, func(s *restest.Session) {
+		req := s.Call("test.model", "change", nil)
+		s.GetMsg()
+		req.Response()
+		select {
+		case err := <-errCh:
+			restest.AssertError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("expected OnError to be called, but it wasn't")
+		}
+	})
+}
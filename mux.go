@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 // Code inspired, and partly borrowed, from SubList in nats-server
@@ -19,13 +20,21 @@ const (
 
 const invalidPattern = "res: invalid pattern"
 
+const muxFrozen = "res: mux is frozen"
+
 // Mux stores handlers and efficiently retrieves them for resource names matching a pattern.
+//
+// Handlers, listeners, and mounted muxes may be added concurrently, but must
+// be added before the mux is frozen. A service freezes its mux when started.
 type Mux struct {
 	path   string
 	root   *node
 	parent *Mux
 	mountp string
-	s      *Service // Registered service
+	s      *Service     // Registered service
+	depth  int          // Number of tokens in path
+	frozen bool         // Flag telling that no handlers, listeners, or muxes may be added
+	mu     sync.RWMutex // Mutex protecting the node tree, including handlers swapped with SwapHandler
 }
 
 // Event represents an event emitted by resource.
@@ -67,29 +76,36 @@ type Event struct {
 
 // Match is a handler matching a resource name.
 type Match struct {
-	Handler   Handler
-	Listeners []func(*Event)
-	Params    map[string]string
-	Group     string
+	Handler        Handler
+	Listeners      []func(*Event)
+	ErrorListeners []ErrorListener
+	Params         map[string]string
+	Group          string
+
+	params      []pathParam // path parameters used to derive Params
+	paramOffset int         // token index offset of params in the resource name
+	hpattern    string      // pattern of the handler, relative to the mux it was added to
 }
 
 // A registered handler
 type regHandler struct {
 	Handler
-	group group
+	group   group
+	pattern string // Pattern relative to the mux the handler was added to
 }
 
 // A node represents one part of the path, and has pointers
 // to the next nodes, including wildcards.
 // Only one instance of handlers may exist per node.
 type node struct {
-	hs        *regHandler // Handlers on this node
-	params    []pathParam // path parameters for the handlers
-	nodes     map[string]*node
-	param     *node
-	wild      *node // Wild card node
-	mounted   bool
-	listeners []func(*Event)
+	hs         *regHandler // Handlers on this node
+	params     []pathParam // path parameters for the handlers
+	nodes      map[string]*node
+	param      *node
+	wild       *node // Wild card node
+	mounted    bool
+	listeners  []func(*Event)
+	elisteners []ErrorListener
 }
 
 // A pathParam represent a parameter part of the resource name.
@@ -101,7 +117,6 @@ type pathParam struct {
 // Matchin handlers instance to a resource name
 type nodeMatch struct {
 	n        *node
-	params   map[string]string
 	mountIdx int
 }
 
@@ -111,9 +126,14 @@ func NewMux(path string) *Mux {
 	if !isValidPath(path) {
 		panic("res: invalid path")
 	}
+	depth := 0
+	if path != "" {
+		depth = strings.Count(path, ".") + 1
+	}
 	return &Mux{
-		path: path,
-		root: &node{},
+		path:  path,
+		depth: depth,
+		root:  &node{},
 	}
 }
 
@@ -135,16 +155,70 @@ func (m *Mux) FullPath() string {
 // Register registers the mux to a service.
 // Will panic if already registered, or mounted to another mux.
 func (m *Mux) Register(s *Service) {
+	m.mu.Lock()
 	if m.parent != nil {
+		m.mu.Unlock()
 		panic("res: already mounted")
 	}
 	if m.s != nil {
+		m.mu.Unlock()
 		panic("res: already registered to a service")
 	}
 	m.s = s
+	m.mu.Unlock()
 	m.callOnRegister()
 }
 
+// Freeze prevents any more handlers, listeners, or muxes from being added to
+// the mux, or to any mux mounted to it. Attempts to add them will panic.
+// Registered handlers may still be replaced using Service.SwapHandler.
+//
+// A service freezes its mux when it is started, making any late registration
+// fail instead of racing with incoming requests.
+func (m *Mux) Freeze() {
+	m.lockTree()
+	m.frozen = true
+	m.unlockTree()
+}
+
+// lockTree locks the mux, and the muxes it is mounted to, for writing. The
+// muxes are locked in order starting from the root mux.
+func (m *Mux) lockTree() {
+	m.mu.RLock()
+	p := m.parent
+	m.mu.RUnlock()
+	if p != nil {
+		// A mounted mux is never unmounted, so the parent cannot change.
+		p.lockTree()
+		m.mu.Lock()
+		return
+	}
+	m.mu.Lock()
+	if m.parent != nil {
+		// Mounted while waiting for the lock
+		m.mu.Unlock()
+		m.lockTree()
+	}
+}
+
+// unlockTree unlocks the muxes locked by lockTree.
+func (m *Mux) unlockTree() {
+	m.mu.Unlock()
+	if m.parent != nil {
+		m.parent.unlockTree()
+	}
+}
+
+// assertNotFrozen panics if the mux, or a mux it is mounted to, is frozen.
+// The muxes must be locked with lockTree.
+func (m *Mux) assertNotFrozen() {
+	for mm := m; mm != nil; mm = mm.parent {
+		if mm.frozen {
+			panic(muxFrozen)
+		}
+	}
+}
+
 // registeredService returns the service registered to the if the mux or
 // an ancenstor of the mux.
 func (m *Mux) registeredService() *Service {
@@ -159,16 +233,28 @@ func (m *Mux) registeredService() *Service {
 // If the mux or its ancestors are not registered to a service, it will
 // do nothing.
 func (m *Mux) callOnRegister() {
+	type registered struct {
+		p  Pattern
+		hs *regHandler
+	}
+	var rs []registered
+	m.mu.RLock()
 	s := m.registeredService()
 	if s == nil {
+		m.mu.RUnlock()
 		return
 	}
 	fp := m.FullPath()
 	traverse(m.root, make([]string, 0, 32), 0, func(n *node, path []string, mountIdx int) {
 		if n.hs != nil && n.hs.OnRegister != nil {
-			n.hs.OnRegister(s, Pattern(mergePattern(fp, pathSliceToString(n, path, mountIdx))), n.hs.Handler)
+			rs = append(rs, registered{Pattern(mergePattern(fp, pathSliceToString(n, path, mountIdx))), n.hs})
 		}
 	})
+	m.mu.RUnlock()
+	// Callbacks are called without holding the lock, as they may add handlers.
+	for _, r := range rs {
+		r.hs.OnRegister(s, r.p, r.hs.Handler)
+	}
 }
 
 // Handle registers the handler functions for the given resource pattern.
@@ -200,6 +286,7 @@ func (m *Mux) Handle(pattern string, hf ...Option) {
 // AddHandler register a handler for the given resource pattern.
 // The pattern used is the same as described for Handle.
 func (m *Mux) AddHandler(pattern string, hs Handler) {
+	initDeprecations(&hs)
 	var g group
 	if hs.Parallel {
 		g = []gpart{}
@@ -209,6 +296,7 @@ func (m *Mux) AddHandler(pattern string, hs Handler) {
 	h := regHandler{
 		Handler: hs,
 		group:   g,
+		pattern: pattern,
 	}
 
 	m.add(pattern, &h)
@@ -217,6 +305,14 @@ func (m *Mux) AddHandler(pattern string, hs Handler) {
 // AddListener adds a listener for events that occurs on resources
 // matching the exact pattern.
 func (m *Mux) AddListener(pattern string, handler func(*Event)) {
+	m.lockTree()
+	defer m.unlockTree()
+	m.assertNotFrozen()
+	m.addListener(pattern, handler)
+}
+
+// addListener adds a listener. The muxes must be locked with lockTree.
+func (m *Mux) addListener(pattern string, handler func(*Event)) {
 	if handler == nil {
 		panic("nil event handler")
 	}
@@ -226,12 +322,53 @@ func (m *Mux) AddListener(pattern string, handler func(*Event)) {
 	n.listeners = append(n.listeners, handler)
 }
 
+// AddErrorListener adds a listener returning errors, for events that occurs on
+// resources matching the exact pattern. Errors are handled according to the
+// listener's Policy.
+func (m *Mux) AddErrorListener(pattern string, l ErrorListener) {
+	m.lockTree()
+	defer m.unlockTree()
+	m.assertNotFrozen()
+	m.addErrorListener(pattern, l)
+}
+
+// addErrorListener adds an error listener. The muxes must be locked with
+// lockTree.
+func (m *Mux) addErrorListener(pattern string, l ErrorListener) {
+	if l.Handler == nil {
+		panic("nil event handler")
+	}
+	if l.Async && l.Policy == ListenerVeto {
+		panic("res: async event listener cannot veto events")
+	}
+
+	n, params := m.fetch(pattern, nil)
+	setAndValidateParams(n, params)
+	n.elisteners = append(n.elisteners, l)
+}
+
 // Mount attaches another Mux at a given path.
 // When mounting, any path set on the sub Mux will be suffixed to the path.
 func (m *Mux) Mount(path string, sub *Mux) {
 	if !isValidPath(path) {
 		panic("res: invalid path")
 	}
+	m.mount(path, sub)
+	sub.callOnRegister()
+}
+
+// mount attaches the sub mux while holding the locks of both muxes.
+func (m *Mux) mount(path string, sub *Mux) {
+	m.lockTree()
+	defer m.unlockTree()
+	for mm := m; mm != nil; mm = mm.parent {
+		if mm == sub {
+			panic("res: attempting to mount mux to itself")
+		}
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	m.assertNotFrozen()
 	if sub.parent != nil {
 		panic("res: already mounted")
 	}
@@ -249,8 +386,6 @@ func (m *Mux) Mount(path string, sub *Mux) {
 	sub.mountp = path
 	sub.root.mounted = true
 	sub.parent = m
-
-	sub.callOnRegister()
 }
 
 // Route create a new Mux and mounts it to the given subpath.
@@ -267,8 +402,10 @@ func (m *Mux) Route(subpath string, fn func(m *Mux)) *Mux {
 // has registered handlers, or panics if a handler is missing.
 func (m *Mux) ValidateListeners() (err error) {
 	var errs []string
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	traverse(m.root, make([]string, 0, 32), 0, func(n *node, path []string, mountIdx int) {
-		if n.hs == nil && n.listeners != nil {
+		if n.hs == nil && (n.listeners != nil || n.elisteners != nil) {
 			errs = append(errs, "no handler registered for pattern: "+mergePattern(m.FullPath(), pathSliceToString(n, path, mountIdx)))
 		}
 	})
@@ -285,6 +422,22 @@ func (m *Mux) add(pattern string, hs *regHandler) {
 		panic(invalidPattern)
 	}
 
+	s, fp := m.insert(pattern, hs)
+
+	// Try call OnRegister callback
+	if hs.OnRegister != nil && s != nil {
+		hs.OnRegister(s, Pattern(mergePattern(fp, pattern)), hs.Handler)
+	}
+}
+
+// insert inserts the handlers and their listeners into the node tree while
+// holding the lock, and returns the registered service and the full path of
+// the mux.
+func (m *Mux) insert(pattern string, hs *regHandler) (*Service, string) {
+	m.lockTree()
+	defer m.unlockTree()
+	m.assertNotFrozen()
+
 	n, params := m.fetch(pattern, nil)
 
 	if n.hs != nil {
@@ -295,16 +448,13 @@ func (m *Mux) add(pattern string, hs *regHandler) {
 
 	// Register listeners
 	for pattern, handler := range hs.Listeners {
-		m.AddListener(pattern, handler)
+		m.addListener(pattern, handler)
 	}
-
-	// Try call OnRegister callback
-	if hs.OnRegister != nil {
-		s := m.registeredService()
-		if s != nil {
-			hs.OnRegister(s, Pattern(mergePattern(m.FullPath(), pattern)), hs.Handler)
-		}
+	for pattern, l := range hs.ErrorListeners {
+		m.addErrorListener(pattern, l)
 	}
+
+	return m.registeredService(), m.FullPath()
 }
 
 // fetch get the node for a given pattern (not including Mux path).
@@ -398,19 +548,50 @@ func (m *Mux) fetch(pattern string, mount *node) (*node, []pathParam) {
 // event listeners, path params, and group ID.
 // Returns the matching handler, or nil if not found.
 func (m *Mux) GetHandler(rname string) *Match {
-	var tokens []string
+	mh := m.match(rname)
+	if mh != nil && len(mh.params) > 0 {
+		mh.Params = pathParamValues(rname, mh.params, mh.paramOffset)
+	}
+	return mh
+}
+
+// tokenPool is a pool of token slices used when matching resource names.
+var tokenPool = sync.Pool{
+	New: func() interface{} {
+		toks := make([]string, 0, 32)
+		return &toks
+	},
+}
+
+// match returns the matching handler for the resource name, or nil if no
+// match is found. Unlike GetHandler, it leaves Params unset, to let the caller
+// derive the path parameters only when needed.
+func (m *Mux) match(rname string) *Match {
+	var mh Match
+	if !m.matchTo(rname, &mh) {
+		return nil
+	}
+	return &mh
+}
+
+// matchTo sets mh to the matching handler for the resource name, and returns
+// true, or returns false if no match is found. It does not allocate unless the
+// handler's group contains placeholders.
+func (m *Mux) matchTo(rname string, mh *Match) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	subrname := rname
 	pl := len(m.path)
 	if pl > 0 {
 		rl := len(rname)
 		if pl == rl {
 			if m.path != rname {
-				return nil
+				return false
 			}
 			subrname = ""
 		} else {
 			if pl > rl || (rname[0:pl] != m.path) || rname[pl] != '.' {
-				return nil
+				return false
 			}
 			subrname = rname[pl+1:]
 		}
@@ -418,17 +599,20 @@ func (m *Mux) GetHandler(rname string) *Match {
 
 	if len(subrname) == 0 {
 		if m.root.hs == nil {
-			return nil
+			return false
 		}
 
-		return &Match{
-			Handler:   m.root.hs.Handler,
-			Listeners: m.root.listeners,
-			Group:     m.root.hs.group.toString(rname, nil),
+		*mh = Match{
+			Handler:        m.root.hs.Handler,
+			Listeners:      m.root.listeners,
+			ErrorListeners: m.root.elisteners,
+			Group:          m.root.hs.group.toString(rname, nil),
 		}
+		return true
 	}
 
-	tokens = make([]string, 0, 32)
+	tp := tokenPool.Get().(*[]string)
+	tokens := (*tp)[:0]
 	start := 0
 	for i := 0; i < len(subrname); i++ {
 		if subrname[i] == btsep {
@@ -440,16 +624,66 @@ func (m *Mux) GetHandler(rname string) *Match {
 
 	var nm nodeMatch
 	matchNode(m.root, tokens, 0, 0, &nm)
-	if nm.n == nil || nm.n.hs == nil {
-		return nil
+	ok := nm.n != nil && nm.n.hs != nil
+	if ok {
+		*mh = Match{
+			Handler:        nm.n.hs.Handler,
+			Listeners:      nm.n.listeners,
+			ErrorListeners: nm.n.elisteners,
+			Group:          nm.n.hs.group.toString(rname, tokens[nm.mountIdx:]),
+			params:         nm.n.params,
+			paramOffset:    nm.mountIdx + m.depth,
+			hpattern:       nm.n.hs.pattern,
+		}
 	}
 
-	return &Match{
-		Handler:   nm.n.hs.Handler,
-		Listeners: nm.n.listeners,
-		Params:    nm.params,
-		Group:     nm.n.hs.group.toString(rname, tokens[nm.mountIdx:]),
+	// Clear the tokens to not keep the resource name alive in the pool.
+	for i := range tokens {
+		tokens[i] = ""
 	}
+	*tp = tokens[:0]
+	tokenPool.Put(tp)
+	return ok
+}
+
+// pattern returns the full pattern of the matched handler for the resource
+// name. As mount paths contain no placeholders, the tokens preceding the
+// handler's mux are the same in the pattern as in the resource name.
+func (mh *Match) pattern(rname string) string {
+	if mh.hpattern == "" {
+		return rname
+	}
+	i := 0
+	for n := mh.paramOffset; n > 0 && i < len(rname); i++ {
+		if rname[i] == btsep {
+			n--
+		}
+	}
+	if i == 0 {
+		return mh.hpattern
+	}
+	return mergePattern(rname[:i-1], mh.hpattern)
+}
+
+// pathParamValues returns a map of path parameter values taken from the
+// resource name tokens.
+func pathParamValues(rname string, params []pathParam, offset int) map[string]string {
+	m := make(map[string]string, len(params))
+	idx := 0
+	start := 0
+	for i := 0; i <= len(rname); i++ {
+		if i < len(rname) && rname[i] != btsep {
+			continue
+		}
+		for _, pp := range params {
+			if pp.idx+offset == idx {
+				m[pp.name] = rname[start:i]
+			}
+		}
+		idx++
+		start = i + 1
+	}
+	return m
 }
 
 func matchNode(l *node, toks []string, i int, mi int, nm *nodeMatch) bool {
@@ -468,14 +702,6 @@ func matchNode(l *node, toks []string, i int, mi int, nm *nodeMatch) bool {
 				if n.hs != nil {
 					nm.n = n
 					nm.mountIdx = mi
-					// Check if we have path parameters for the handlers
-					if len(n.params) > 0 {
-						// Create a map with path parameter values
-						nm.params = make(map[string]string, len(n.params))
-						for _, pp := range n.params {
-							nm.params[pp.name] = toks[pp.idx+mi]
-						}
-					}
 					return true
 				}
 			} else {
@@ -497,13 +723,6 @@ func matchNode(l *node, toks []string, i int, mi int, nm *nodeMatch) bool {
 		n = l.wild
 		nm.n = n
 		nm.mountIdx = mi
-		if len(n.params) > 0 {
-			// Create a map with path parameter values
-			nm.params = make(map[string]string, len(n.params))
-			for _, pp := range n.params {
-				nm.params[pp.name] = toks[pp.idx+mi]
-			}
-		}
 		return true
 	}
 
@@ -536,9 +755,33 @@ func mergePattern(a, b string) string {
 	return a + "." + b
 }
 
+// Walk traverses through the registered handlers, including those of mounted
+// muxes, and calls the callback for each with the full resource pattern,
+// including the mux path. The order of the calls is undefined.
+func (m *Mux) Walk(cb func(pattern Pattern, h Handler)) {
+	type walked struct {
+		p Pattern
+		h Handler
+	}
+	var hs []walked
+	m.mu.RLock()
+	fp := m.FullPath()
+	traverse(m.root, make([]string, 0, 32), 0, func(n *node, path []string, mountIdx int) {
+		if n.hs != nil {
+			hs = append(hs, walked{Pattern(mergePattern(fp, pathSliceToString(n, path, mountIdx))), n.hs.Handler})
+		}
+	})
+	m.mu.RUnlock()
+	for _, w := range hs {
+		cb(w.p, w.h)
+	}
+}
+
 // Contains traverses through the registered handlers to see if
 // any of them matches the predicate test.
 func (m *Mux) Contains(test func(h Handler) bool) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return contains(m.root, test)
 }
 
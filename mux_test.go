@@ -0,0 +1,47 @@
+package res
+
+import (
+	"testing"
+)
+
+func newMatchTestMux() *Mux {
+	m := NewMux("bench")
+	m.Handle("static.model", GetResource(func(r GetRequest) {}))
+	m.Handle("user.$userId.book.$bookId.chapter.$chapterId", GetResource(func(r GetRequest) {}))
+	m.Handle("any.>", GetResource(func(r GetRequest) {}))
+	return m
+}
+
+var matchTestResourceNames = []string{
+	"bench.static.model",
+	"bench.user.1.book.2.chapter.3",
+	"bench.any.foo.bar.baz",
+	"bench.missing.model",
+}
+
+// Test that matchTo does not allocate for handlers without group placeholders.
+func TestMuxMatchTo_WithoutGroupPlaceholders_DoesNotAllocate(t *testing.T) {
+	m := newMatchTestMux()
+	var mh Match
+	for _, rname := range matchTestResourceNames {
+		allocs := testing.AllocsPerRun(100, func() {
+			m.matchTo(rname, &mh)
+		})
+		if allocs != 0 {
+			t.Errorf("expected matching %s to not allocate, but got %v allocations", rname, allocs)
+		}
+	}
+}
+
+func BenchmarkMuxMatchTo(b *testing.B) {
+	m := newMatchTestMux()
+	for _, rname := range matchTestResourceNames {
+		b.Run(rname, func(b *testing.B) {
+			var mh Match
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.matchTo(rname, &mh)
+			}
+		})
+	}
+}
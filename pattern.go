@@ -1,5 +1,7 @@
 package res
 
+import "strings"
+
 // Pattern is a resource pattern that may contain wildcards and tags.
 //
 //	Pattern("example.resource.>") // Full wild card (>) matches anything that follows
@@ -269,3 +271,141 @@ func (p Pattern) IndexWildcard() int {
 	}
 	return -1
 }
+
+// Intersects tests if there is any resource name that matches both the
+// pattern and the pattern o.
+//
+// Behavior is undefined for an invalid pattern.
+func (p Pattern) Intersects(o Pattern) bool {
+	pt := p.tokens()
+	ot := o.tokens()
+	for i := 0; i < len(pt) && i < len(ot); i++ {
+		a, b := pt[i], ot[i]
+		if a == ">" || b == ">" {
+			return true
+		}
+		if !isWildcardToken(a) && !isWildcardToken(b) && a != b {
+			return false
+		}
+	}
+	return len(pt) == len(ot)
+}
+
+// Subsumes tests if all resource names matching the pattern o also match the
+// pattern.
+//
+//	Pattern("test.>").Subsumes("test.model.$id") // true
+//	Pattern("test.*").Subsumes("test.>")         // false
+//
+// Behavior is undefined for an invalid pattern.
+func (p Pattern) Subsumes(o Pattern) bool {
+	pt := p.tokens()
+	ot := o.tokens()
+	for i, a := range pt {
+		if i == len(ot) {
+			return false
+		}
+		b := ot[i]
+		switch {
+		case a == ">":
+			return true
+		case b == ">":
+			return false
+		case isWildcardToken(a):
+		case isWildcardToken(b) || a != b:
+			return false
+		}
+	}
+	return len(pt) == len(ot)
+}
+
+// Rewrite rewrites the resource name, s, matching the pattern, into a resource
+// name matching the pattern to. The tags, wildcards, and full wildcard of to
+// are replaced with the values they match in s:
+//
+//	Pattern("users.$id.*").Rewrite("users.42.info", "accounts.$id.*") // "accounts.42.info", true
+//	Pattern("v1.>").Rewrite("v1.library.book.7", "v2.>")            // "v2.library.book.7", true
+//
+// A tag, $tag, is replaced by the value matched by the tag with the same name.
+// The n:th wildcard, *, is replaced by the value matched by the n:th wildcard
+// of the pattern, and the full wildcard, >, by the value matched by the
+// pattern's full wildcard.
+//
+// The returned bool flag is false if s does not match the pattern, or if to
+// contains a tag or wildcard with no matching value.
+//
+// Behavior is undefined for an invalid pattern or an invalid resource name.
+func (p Pattern) Rewrite(s string, to Pattern) (string, bool) {
+	pt := p.tokens()
+	st := Pattern(s).tokens()
+	var tags map[string]string
+	var stars []string
+	var rest string
+	hasRest := false
+	for i, a := range pt {
+		if i == len(st) {
+			return "", false
+		}
+		switch {
+		case a == ">":
+			rest = strings.Join(st[i:], ".")
+			hasRest = true
+		case a == "*":
+			stars = append(stars, st[i])
+		case a[0] == '$':
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[a[1:]] = st[i]
+		case a != st[i]:
+			return "", false
+		}
+		if hasRest {
+			break
+		}
+	}
+	if !hasRest && len(pt) != len(st) {
+		return "", false
+	}
+
+	tt := to.tokens()
+	out := make([]string, len(tt))
+	for i, b := range tt {
+		switch {
+		case b == ">":
+			if !hasRest {
+				return "", false
+			}
+			out[i] = rest
+		case b == "*":
+			if len(stars) == 0 {
+				return "", false
+			}
+			out[i] = stars[0]
+			stars = stars[1:]
+		case b[0] == '$':
+			v, ok := tags[b[1:]]
+			if !ok {
+				return "", false
+			}
+			out[i] = v
+		default:
+			out[i] = b
+		}
+	}
+	return strings.Join(out, "."), true
+}
+
+// tokens returns the dot separated tokens of the pattern. An empty pattern has
+// no tokens.
+func (p Pattern) tokens() []string {
+	if p == "" {
+		return nil
+	}
+	return strings.Split(string(p), ".")
+}
+
+// isWildcardToken returns true if the pattern token is a wildcard, *, or a tag.
+func isWildcardToken(t string) bool {
+	return t == "*" || t[0] == '$'
+}
@@ -412,3 +412,157 @@ func TestPatternValues_NonMatchingPattern_ReturnsFalse(t *testing.T) {
 		}
 	}
 }
+
+func TestPatternIntersects(t *testing.T) {
+	tbl := []struct {
+		A        Pattern
+		B        Pattern
+		Expected bool
+	}{
+		{"", "", true},
+		{"", "test", false},
+		{"", ">", false},
+		{"test", "test", true},
+		{"test", "foo", false},
+		{"test.model", "test", false},
+		{"test.model", "test.model.foo", false},
+
+		{">", "test", true},
+		{">", "test.model.foo", true},
+		{"test.>", "test", false},
+		{"test.>", "test.model", true},
+		{"test.>", "foo.model", false},
+		{"test.>", "*.model.>", true},
+
+		{"*", "test", true},
+		{"test.*", "test.model", true},
+		{"test.*", "*.model", true},
+		{"test.*", "foo.*", false},
+		{"test.*", "test.model.foo", false},
+		{"test.*.foo", "test.model.*", true},
+		{"test.*.foo", "test.model.bar", false},
+
+		{"test.$id", "test.model", true},
+		{"test.$id", "test.*", true},
+		{"test.$id.foo", "*.$bar.foo", true},
+		{"test.$id.foo", "test.$id.bar", false},
+	}
+
+	for _, r := range tbl {
+		if r.A.Intersects(r.B) != r.Expected {
+			t.Errorf("Expected Pattern(%#v).Intersects(%#v) to return %v", r.A, r.B, r.Expected)
+		}
+		if r.B.Intersects(r.A) != r.Expected {
+			t.Errorf("Expected Pattern(%#v).Intersects(%#v) to return %v", r.B, r.A, r.Expected)
+		}
+	}
+}
+
+func TestPatternSubsumes(t *testing.T) {
+	tbl := []struct {
+		Pattern  Pattern
+		Other    Pattern
+		Expected bool
+	}{
+		{"", "", true},
+		{"", "test", false},
+		{"test", "", false},
+		{"test", "test", true},
+		{"test", "foo", false},
+		{"test.model", "test", false},
+		{"test", "test.model", false},
+
+		{">", "test", true},
+		{">", ">", true},
+		{">", "test.*.>", true},
+		{">", "", false},
+		{"test.>", "test.model", true},
+		{"test.>", "test.>", true},
+		{"test.>", "test.$id.>", true},
+		{"test.>", "test", false},
+		{"test.>", ">", false},
+		{"test.>", "*.model", false},
+
+		{"*", "test", true},
+		{"*", "$id", true},
+		{"*", ">", false},
+		{"test.*", "test.model", true},
+		{"test.*", "test.*", true},
+		{"test.*", "test.>", false},
+		{"test.*", "test.model.foo", false},
+		{"test.model", "test.*", false},
+
+		{"test.$id", "test.model", true},
+		{"test.$id", "test.*", true},
+		{"test.$id", "test.$foo", true},
+		{"test.$id.foo", "test.$id.bar", false},
+		{"test.model", "test.$id", false},
+	}
+
+	for _, r := range tbl {
+		if r.Pattern.Subsumes(r.Other) != r.Expected {
+			t.Errorf("Expected Pattern(%#v).Subsumes(%#v) to return %v", r.Pattern, r.Other, r.Expected)
+		}
+	}
+}
+
+func TestPatternRewrite_MatchingPattern_ReturnsResourceName(t *testing.T) {
+	tbl := []struct {
+		Pattern      Pattern
+		ResourceName string
+		To           Pattern
+		Expected     string
+	}{
+		{"", "", "", ""},
+		{"test", "test", "foo", "foo"},
+		{"test.model", "test.model", "foo.bar", "foo.bar"},
+
+		{"test.$id", "test.42", "foo.$id", "foo.42"},
+		{"test.$id.$name", "test.42.bar", "$name.$id", "bar.42"},
+		{"test.$id", "test.42", "foo.$id.$id", "foo.42.42"},
+
+		{"test.*", "test.model", "foo.*", "foo.model"},
+		{"*.*", "test.model", "*.foo.*", "test.foo.model"},
+		{"*.*", "test.model", "*", "test"},
+
+		{">", "test.model", "foo.>", "foo.test.model"},
+		{"test.>", "test.model.foo", "foo.>", "foo.model.foo"},
+		{"test.$id.>", "test.42.model.foo", "foo.>.$id", "foo.model.foo.42"},
+		{"v1.>", "v1.library.book.7", "v2.>", "v2.library.book.7"},
+	}
+
+	for _, r := range tbl {
+		s, ok := r.Pattern.Rewrite(r.ResourceName, r.To)
+		if !ok {
+			t.Errorf("Pattern(%#v).Rewrite(%#v, %#v) did not return true", r.Pattern, r.ResourceName, r.To)
+		}
+		if s != r.Expected {
+			t.Errorf("Expected Pattern(%#v).Rewrite(%#v, %#v) to return %#v, but it returned %#v", r.Pattern, r.ResourceName, r.To, r.Expected, s)
+		}
+	}
+}
+
+func TestPatternRewrite_InvalidRewrite_ReturnsFalse(t *testing.T) {
+	tbl := []struct {
+		Pattern      Pattern
+		ResourceName string
+		To           Pattern
+	}{
+		// Non-matching resource name
+		{"test", "foo", "bar"},
+		{"test.model", "test", "bar"},
+		{"test.$id", "test.42.foo", "bar.$id"},
+		{"test.>", "test", "bar.>"},
+		// Missing values
+		{"test.$id", "test.42", "bar.$name"},
+		{"test.*", "test.42", "*.*"},
+		{"test.*", "test.42", "bar.>"},
+		{"test.$id", "test.42", "bar.*"},
+	}
+
+	for _, r := range tbl {
+		if _, ok := r.Pattern.Rewrite(r.ResourceName, r.To); ok {
+			t.Errorf("Pattern(%#v).Rewrite(%#v, %#v) did not return false", r.Pattern, r.ResourceName, r.To)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package res
+
+import "strings"
+
+var responsePayloadTooLarge = []byte(`{"error":{"code":"system.internalError","message":"Internal error: response exceeds maximum payload size"}}`)
+
+// payloadLimiter is implemented by connections knowing the maximum payload
+// size accepted by the server, such as nats.Conn.
+type payloadLimiter interface {
+	MaxPayload() int64
+}
+
+// SetMaxPayload sets the maximum size in bytes of published responses and
+// events. Responses exceeding the size are replaced with a
+// system.internalError response, and resource events exceeding it are
+// replaced with a system reset of the resource. In both cases an error
+// including the resource and size is reported through the logger and the
+// OnError callback.
+//
+// Default is 0, meaning the maximum payload of the connection is used, if the
+// connection has a MaxPayload method, such as nats.Conn. If size is less than
+// zero, no limit is used.
+func (s *Service) SetMaxPayload(size int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.maxPayload = size
+	return s
+}
+
+// OversizeFallback sets a callback called when the result of a call or auth
+// request exceeds the maximum payload size. If the callback returns a
+// resource ID, a resource response with a reference to that resource is sent
+// instead of an error. It is intended for calls returning huge collections,
+// letting the client fetch them as a separate resource, such as a query
+// collection returning the result in pages:
+//
+//	res.OversizeFallback(func(r res.Resource) string {
+//		return "library.books?limit=100"
+//	})
+//
+// An empty resource ID results in a system.internalError response.
+func OversizeFallback(cb func(r Resource) string) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.OversizeFallback = cb
+	})
+}
+
+// payloadLimitFor returns the maximum payload size to use for the
+// connection. Zero means no limit.
+func (s *Service) payloadLimitFor(nc Conn) int {
+	if s.maxPayload != 0 {
+		if s.maxPayload < 0 {
+			return 0
+		}
+		return s.maxPayload
+	}
+	if pl, ok := nc.(payloadLimiter); ok {
+		return int(pl.MaxPayload())
+	}
+	return 0
+}
+
+// exceedsPayloadLimit returns true if the size exceeds the maximum payload
+// size.
+func (s *Service) exceedsPayloadLimit(size int) bool {
+	return s.payloadLimit > 0 && size > s.payloadLimit
+}
+
+// oversizedEvent reports an error if the event payload exceeds the maximum
+// payload size, and returns true if so. If the event is a resource event, a
+// system reset is sent for the resource, letting gateways refetch it instead
+// of keeping stale data.
+func (s *Service) oversizedEvent(subj string, payload []byte) bool {
+	if !s.exceedsPayloadLimit(len(payload)) {
+		return false
+	}
+	s.errorf("Error sending event %s: payload size %d exceeds maximum of %d bytes", subj, len(payload), s.payloadLimit)
+	if strings.HasPrefix(subj, "event.") {
+		if idx := strings.LastIndexByte(subj, '.'); idx > len("event.") {
+			s.reset([]string{subj[len("event."):idx]}, nil)
+		}
+	}
+	return true
+}
+
+// oversizedResult tries to respond with a resource response using the
+// handler's OversizeFallback, if the result wire data exceeds the maximum
+// payload size. It returns true if a fallback response was sent.
+func (r *Request) oversizedResult(data []byte) bool {
+	cb := r.h.OversizeFallback
+	if cb == nil || (r.rtype != RequestTypeCall && r.rtype != RequestTypeAuth) {
+		return false
+	}
+	if !r.s.exceedsPayloadLimit(len(data)) {
+		return false
+	}
+	rid := cb(r)
+	if rid == "" {
+		return false
+	}
+	r.s.infof("Result of %s [%s] exceeds maximum payload of %d bytes, responding with resource %s", r.msg.Subject, r.CorrelationID(), r.s.payloadLimit, rid)
+	r.Resource(rid)
+	return true
+}
+
+// oversizedReply returns the payload to send instead of the reply data, if
+// the data exceeds the maximum payload size. Otherwise nil is returned.
+func (r *Request) oversizedReply(data []byte) []byte {
+	if !r.s.exceedsPayloadLimit(len(data)) {
+		return nil
+	}
+	r.s.errorf("Error sending reply %s [%s] for %s: payload size %d exceeds maximum of %d bytes", r.msg.Subject, r.CorrelationID(), r.rname, len(data), r.s.payloadLimit)
+	return responsePayloadTooLarge
+}
@@ -0,0 +1,94 @@
+package res
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Prime gets the values of the resources, through their get handlers, to warm
+// any caches used by the handlers, such as those of stores, before clients
+// request them. The values are fetched on each resource's worker goroutine,
+// and Prime returns once all values are fetched.
+//
+// If an OnPrime callback is set, it is called with each fetched value, on the
+// resource's worker goroutine.
+//
+// Returns an error if the service is not started, if any resource ID is
+// invalid or has no matching handler, or if any value could not be fetched.
+// Prime must not be called from a worker goroutine.
+func (s *Service) Prime(rids ...string) error {
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		return errNotStarted
+	}
+	var mu sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	var wg sync.WaitGroup
+	for _, rid := range rids {
+		if !IsValidRID(rid) {
+			setErr(fmt.Errorf("res: invalid resource ID to prime: %s", rid))
+			continue
+		}
+		rid := rid
+		wg.Add(1)
+		err := s.With(rid, func(r Resource) {
+			defer wg.Done()
+			v, err := r.Value()
+			if err != nil {
+				setErr(fmt.Errorf("res: failed to prime %s: %s", rid, err))
+				return
+			}
+			if s.onPrime != nil {
+				s.onPrime(r, v)
+			}
+		})
+		if err != nil {
+			wg.Done()
+			setErr(fmt.Errorf("res: failed to prime %s: %s", rid, err))
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// SetPrimeOnReset sets resource IDs to prime, using Prime, whenever the service
+// sends a system reset for all resources on start or reconnect. The resources
+// are primed before the reset is sent, to smooth the burst of get requests
+// following it. Errors are logged, and do not prevent the reset.
+func (s *Service) SetPrimeOnReset(rids ...string) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.primeRIDs = rids
+	return s
+}
+
+// SetOnPrime sets a function to call with each value fetched by Prime, on the
+// resource's worker goroutine. It may be used to send events for values
+// changed while the service was disconnected.
+func (s *Service) SetOnPrime(f func(r Resource, v interface{})) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onPrime = f
+	return s
+}
+
+// primeAndResetAll primes the resources set with SetPrimeOnReset, and sends a
+// system reset for all resources.
+func (s *Service) primeAndResetAll() {
+	if len(s.primeRIDs) > 0 {
+		s.infof("Priming %d resources", len(s.primeRIDs))
+		if err := s.Prime(s.primeRIDs...); err != nil {
+			s.errorf("Error priming resources: %s", err)
+		}
+	}
+	s.ResetAll()
+}
@@ -0,0 +1,73 @@
+package res
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// privateNames holds the json names of the private fields of struct types,
+// keyed by type.
+var privateNames sync.Map
+
+// PublicModel returns the model with any struct fields tagged `res:"private"`
+// excluded, as the model is sent in get responses and compared by
+// ModelChanges and DiffModel. It allows the same struct to be used both for
+// persistence and as the model sent to clients:
+//
+//	type User struct {
+//		Name         string `json:"name"`
+//		PasswordHash string `json:"passwordHash" res:"private"`
+//	}
+//
+// If the model is not a struct, or a pointer to a struct, with private
+// fields, the model is returned as is. Otherwise a map of the remaining
+// properties is returned. Only the fields of the model itself, including
+// fields of embedded structs without a json name, are considered.
+func PublicModel(model interface{}) interface{} {
+	if len(privateFields(reflect.TypeOf(model))) == 0 {
+		return model
+	}
+	m, err := modelProps(model)
+	if err != nil || m == nil {
+		return model
+	}
+	return m
+}
+
+// privateFields returns the json names of the fields tagged `res:"private"`
+// for a struct type, or a pointer to a struct type.
+func privateFields(t reflect.Type) []string {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if v, ok := privateNames.Load(t); ok {
+		return v.([]string)
+	}
+	var names []string
+	for _, f := range structFields(t) {
+		if f.private {
+			names = append(names, f.name)
+		}
+	}
+	privateNames.Store(t, names)
+	return names
+}
+
+// isPrivateTag returns true if the res struct tag contains the private option.
+func isPrivateTag(tag string) bool {
+	for tag != "" {
+		var opt string
+		opt, tag, _ = strings.Cut(tag, ",")
+		if opt == "private" {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
@@ -17,35 +19,50 @@ type QueryRequest interface {
 	Resource
 	Model(model interface{})
 	Collection(collection interface{})
+	ChangeEventDiff(before, after interface{}) error
 	NotFound()
 	InvalidQuery(message string)
 	Error(err error)
 	Timeout(d time.Duration)
+	Replied() bool
 }
 
 type queryRequest struct {
 	resource
 	msg     *nats.Msg
 	events  []resEvent
-	replied bool // Flag telling if a reply has been made
+	replied bool   // Flag telling if a reply has been made
+	capture bool   // Flag telling if the reply payload should be kept instead of published
+	payload []byte // Reply payload, if capture is set
 }
 
 type queryEvent struct {
-	r   resource
-	sub *nats.Subscription
-	ch  chan *nats.Msg
-	cb  func(r QueryRequest)
+	r    resource
+	subj string
+	sub  *nats.Subscription
+	ch   chan *nats.Msg
+	cbs  []func(r QueryRequest) // Callbacks called in order. More than one if query events are coalesced
+
+	mu        sync.Mutex        // Mutex protecting responses
+	responses map[string][]byte // Response payloads by query, for handlers with ReuseQueryResponses set
+}
+
+// pendingQueryEvents holds query events of handlers with CoalesceQueryEvents
+// set, that are not yet sent, keyed by resource name.
+type pendingQueryEvents struct {
+	mu sync.Mutex
+	m  map[string]*queryEvent
 }
 
 // Model sends a model response for the query request.
 // The model represents the current state of query model
-// for the given query.
+// for the given query. Struct fields tagged `res:"private"` are excluded.
 // Only valid for a query model resource.
 func (qr *queryRequest) Model(model interface{}) {
 	if qr.h.Type == TypeCollection {
 		panic("res: model response not allowed on query collections")
 	}
-	qr.success(modelResponse{Model: model})
+	qr.success(modelResponse{Model: PublicModel(model)})
 }
 
 // Collection sends a collection response for the query request.
@@ -72,6 +89,36 @@ func (qr *queryRequest) ChangeEvent(ev map[string]interface{}) {
 	qr.events = append(qr.events, resEvent{Event: "change", Data: changeEvent{Values: ev}})
 }
 
+// ChangeEventDiff adds a change event to the query response, containing the
+// properties that differ between the before and after values of the query
+// model, as given by DiffModel. If no property differs, no event is added.
+// Only valid for a query model resource.
+//
+// It is used when a query event affects a query model, to send the
+// difference between the model's value for the query before and after the
+// change:
+//
+//	r.QueryEvent(func(qr res.QueryRequest) {
+//		if qr == nil {
+//			return
+//		}
+//		before, after := oldStats(qr.ParseQuery()), newStats(qr.ParseQuery())
+//		if err := qr.ChangeEventDiff(before, after); err != nil {
+//			qr.Error(err)
+//		}
+//	})
+func (qr *queryRequest) ChangeEventDiff(before, after interface{}) error {
+	if qr.h.Type == TypeCollection {
+		panic("res: change event not allowed on query collections")
+	}
+	ch, err := DiffModel(before, after)
+	if err != nil {
+		return err
+	}
+	qr.ChangeEvent(ch)
+	return nil
+}
+
 // AddEvent adds an add event to the query response,
 // adding the value v at index idx.
 // Only valid for a query collection resource.
@@ -128,18 +175,155 @@ func (qr *queryRequest) Timeout(d time.Duration) {
 	qr.s.rawEvent(qr.msg.Reply, out)
 }
 
-// startQueryListener listens for query requests and passes them on to a worker.
+// Replied returns true if a response has been sent for the query request.
+func (qr *queryRequest) Replied() bool {
+	return qr.replied
+}
+
+// send sends the query event, and starts listening for query requests until
+// the query event duration expires.
+func (qe *queryEvent) send() {
+	qe.r.s.event("event."+qe.r.rname+".query", resQueryEvent{Subject: qe.subj})
+
+	go qe.startQueryListener()
+
+	qe.r.s.addQueryEvent(qe)
+}
+
+// coalesceQueryEvent adds the callback to the pending query event of the
+// resource, if one exists. It returns true if the callback was added.
+func (s *Service) coalesceQueryEvent(rname string, cb func(QueryRequest)) bool {
+	p := &s.pendingQueries
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	qe, ok := p.m[rname]
+	if !ok {
+		return false
+	}
+	qe.cbs = append(qe.cbs, cb)
+	return true
+}
+
+// deferQueryEvent makes the query event pending, and sends it once the work
+// queued on the resource's worker goroutine is done.
+func (s *Service) deferQueryEvent(qe *queryEvent) {
+	p := &s.pendingQueries
+	rname := qe.r.rname
+	p.mu.Lock()
+	if p.m == nil {
+		p.m = make(map[string]*queryEvent)
+	}
+	p.m[rname] = qe
+	p.mu.Unlock()
+
+	s.runWith(qe.r.Group(), func() {
+		p.mu.Lock()
+		delete(p.m, rname)
+		p.mu.Unlock()
+		qe.send()
+	})
+}
+
+// startQueryListener listens for query requests and passes them on to a
+// worker. If the handler has ParallelQueries set, they are passed on to the
+// query workers.
+//
+// If the handler has ReuseQueryResponses set, query requests already waiting
+// in the channel are passed on together as a batch.
 func (qe *queryEvent) startQueryListener() {
 	for m := range qe.ch {
-		m := m
-		qe.r.s.runWith(qe.r.Group(), func() {
-			qe.handleQueryRequest(m)
-		})
+		msgs := []*nats.Msg{m}
+		if qe.r.h.ReuseQueryResponses {
+			msgs = drainQueryRequests(qe.ch, msgs)
+		}
+		cb := func() {
+			qe.handleQueryRequests(msgs)
+		}
+		if qe.r.h.ParallelQueries {
+			qe.r.s.runQuery(cb)
+		} else {
+			qe.r.s.runWith(qe.r.Group(), cb)
+		}
+	}
+}
+
+// drainQueryRequests appends the query requests waiting in the channel to
+// msgs, without blocking.
+func drainQueryRequests(ch chan *nats.Msg, msgs []*nats.Msg) []*nats.Msg {
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, m)
+		default:
+			return msgs
+		}
+	}
+}
+
+// handleQueryRequests is called by the query listener on incoming query
+// requests.
+//
+// If the handler has ReuseQueryResponses set, the callbacks are called once
+// for each distinct query, and the response payload is published to all
+// query requests with the same query, including later ones.
+func (qe *queryEvent) handleQueryRequests(msgs []*nats.Msg) {
+	if !qe.r.h.ReuseQueryResponses {
+		for _, m := range msgs {
+			if qr := qe.newQueryRequest(m); qr != nil {
+				qe.respond(qr)
+			}
+		}
+		return
+	}
+
+	// Group the requests by query, keeping the order of the first request
+	// of each query.
+	var queries []*queryRequest
+	replies := make(map[string][]string)
+	for _, m := range msgs {
+		qr := qe.newQueryRequest(m)
+		if qr == nil {
+			continue
+		}
+		if _, ok := replies[qr.query]; !ok {
+			queries = append(queries, qr)
+		}
+		replies[qr.query] = append(replies[qr.query], m.Reply)
+	}
+
+	s := qe.r.s
+	for _, qr := range queries {
+		qe.mu.Lock()
+		payload, ok := qe.responses[qr.query]
+		qe.mu.Unlock()
+		subjs := replies[qr.query]
+		if ok {
+			atomic.AddUint64(&s.counters.reusedQueryResponses, uint64(len(subjs)))
+		} else {
+			qr.capture = true
+			qe.respond(qr)
+			payload = qr.payload
+			qe.mu.Lock()
+			if qe.responses == nil {
+				qe.responses = make(map[string][]byte)
+			}
+			qe.responses[qr.query] = payload
+			qe.mu.Unlock()
+			atomic.AddUint64(&s.counters.reusedQueryResponses, uint64(len(subjs)-1))
+		}
+		for _, subj := range subjs {
+			s.publishQueryReply(qr.rname, subj, payload)
+		}
 	}
 }
 
-// handleQueryRequest is called by the query listener on incoming query requests.
-func (qe *queryEvent) handleQueryRequest(m *nats.Msg) {
+// newQueryRequest returns a query request for the message. If the message
+// is not a valid query request, an error response is sent, and nil is
+// returned.
+func (qe *queryEvent) newQueryRequest(m *nats.Msg) *queryRequest {
 	s := qe.r.s
 	s.tracef("Q=> %s: %s", qe.r.rname, m.Data)
 
@@ -149,33 +333,40 @@ func (qe *queryEvent) handleQueryRequest(m *nats.Msg) {
 	}
 
 	var rqr resQueryRequest
-	var err error
 	if len(m.Data) > 0 {
-		err = json.Unmarshal(m.Data, &rqr)
+		err := json.Unmarshal(m.Data, &rqr)
 		if err != nil {
 			s.errorf("Error unmarshaling incoming query request: %s", err)
 			qr.error(ToError(err))
-			return
+			return nil
 		}
 	}
 
 	if rqr.Query == "" {
 		s.errorf("Missing query on incoming query request: %s", m.Data)
 		qr.reply(responseMissingQuery)
-		return
+		return nil
 	}
 
 	qr.query = rqr.Query
+	return qr
+}
 
-	qr.executeCallback(qe.cb)
-	if qr.replied {
-		return
+// respond calls the query event callbacks, and replies with the events added
+// to the query request, unless a callback has already replied.
+func (qe *queryEvent) respond(qr *queryRequest) {
+	for _, cb := range qe.cbs {
+		qr.executeCallback(cb)
+		if qr.replied {
+			return
+		}
 	}
 
 	var data []byte
 	if len(qr.events) == 0 {
 		data = responseNoQueryEvents
 	} else {
+		var err error
 		data, err = json.Marshal(successResponse{Result: queryResponse{Events: qr.events}})
 		if err != nil {
 			data = responseInternalError
@@ -248,6 +439,7 @@ func (qr *queryRequest) success(result interface{}) {
 
 // reply sends an encoded payload to as a reply.
 // If a reply is already sent, reply will log an error.
+// If capture is set, the payload is kept instead of sent.
 func (qr *queryRequest) reply(payload []byte) {
 	if qr.replied {
 		qr.s.errorf("Response already sent on query request %s", qr.rname)
@@ -255,9 +447,23 @@ func (qr *queryRequest) reply(payload []byte) {
 	}
 	qr.replied = true
 
-	qr.s.tracef("<=Q %s: %s", qr.rname, payload)
-	err := qr.s.nc.Publish(qr.msg.Reply, payload)
+	if qr.s.exceedsPayloadLimit(len(payload)) {
+		qr.s.errorf("Error sending query reply %s: payload size %d exceeds maximum of %d bytes", qr.rname, len(payload), qr.s.payloadLimit)
+		payload = responsePayloadTooLarge
+	}
+	if qr.capture {
+		qr.payload = payload
+		return
+	}
+	qr.s.publishQueryReply(qr.rname, qr.msg.Reply, payload)
+}
+
+// publishQueryReply publishes a query reply payload to the reply subject.
+func (s *Service) publishQueryReply(rname, subj string, payload []byte) {
+	atomic.AddUint64(&s.counters.queryRequests, 1)
+	s.tracef("<=Q %s: %s", rname, payload)
+	err := s.publish(subj, payload)
 	if err != nil {
-		qr.s.errorf("Error sending query reply %s: %s", qr.rname, err)
+		s.errorf("Error sending query reply %s: %s", rname, err)
 	}
 }
@@ -0,0 +1,287 @@
+package res
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryEventRecord is an outstanding query event, as stored in a
+// QueryEventRegistry.
+type QueryEventRecord struct {
+	// Subject is the subject on which query requests are received.
+	Subject string `json:"subject"`
+	// RID is the resource name of the query resource.
+	RID string `json:"rid"`
+	// Expires is the time when the query event duration expires.
+	Expires time.Time `json:"expires"`
+}
+
+// QueryEventRegistry persists outstanding query events, so that the query
+// resources can be invalidated if the service is restarted before the query
+// events expire. Without a registry, query requests sent to the subjects of a
+// stopped service are never responded to, and gateways may keep stale query
+// results.
+//
+// A registry may be implemented using a JetStream key-value bucket, a
+// database, or a file, as done by FileQueryEventRegistry.
+type QueryEventRegistry interface {
+	// Add adds a query event record.
+	Add(rec QueryEventRecord) error
+
+	// Remove removes the record with the subject. Removing a missing record
+	// is not an error.
+	Remove(subject string) error
+
+	// List returns all records.
+	List() ([]QueryEventRecord, error)
+}
+
+// queryRegistryFlusher is implemented by registries persisting records in the
+// background, such as FileQueryEventRegistry.
+type queryRegistryFlusher interface {
+	Flush() error
+}
+
+// SetQueryEventRegistry sets the registry where outstanding query events are
+// persisted. When the service starts, any unexpired query events in the
+// registry, left by a previous run of the service, are invalidated by
+// sending a system reset for their query resources, and are removed from the
+// registry.
+//
+// Errors storing or reading records are reported through the logger and the
+// OnError callback, without affecting the query events. If the registry has a
+// Flush method, such as FileQueryEventRegistry, it is called on shutdown.
+//
+// Panics if service is already started.
+func (s *Service) SetQueryEventRegistry(reg QueryEventRegistry) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.queryRegistry = reg
+	return s
+}
+
+// registerQueryEvent adds the query event to the registry, if one is set.
+func (s *Service) registerQueryEvent(qe *queryEvent) {
+	if s.queryRegistry == nil {
+		return
+	}
+	err := s.queryRegistry.Add(QueryEventRecord{
+		Subject: qe.subj,
+		RID:     qe.r.rname,
+		Expires: s.clock.Now().Add(s.queryDuration),
+	})
+	if err != nil {
+		s.errorf("Failed to register query event for %s: %s", qe.r.rname, err)
+	}
+}
+
+// unregisterQueryEvent removes the query event from the registry, if one is
+// set.
+func (s *Service) unregisterQueryEvent(qe *queryEvent) {
+	if s.queryRegistry == nil {
+		return
+	}
+	if err := s.queryRegistry.Remove(qe.subj); err != nil {
+		s.errorf("Failed to unregister query event for %s: %s", qe.r.rname, err)
+	}
+}
+
+// flushQueryRegistry waits for the registry to persist any pending records,
+// if it persists them in the background.
+func (s *Service) flushQueryRegistry() {
+	if f, ok := s.queryRegistry.(queryRegistryFlusher); ok {
+		if err := f.Flush(); err != nil {
+			s.errorf("Failed to flush query event registry: %s", err)
+		}
+	}
+}
+
+// invalidateQueryEvents sends a system reset for the query resources of any
+// unexpired query events in the registry, and removes all records.
+//
+// Query resources covered by the owned resource patterns are already reset by
+// the ResetAll sent on start, and are not reset again. The registry only adds
+// a reset for query resources outside the owned patterns, such as those left
+// by a previous run with other owned resources set with SetOwnedResources.
+func (s *Service) invalidateQueryEvents() {
+	if s.queryRegistry == nil {
+		return
+	}
+	recs, err := s.queryRegistry.List()
+	if err != nil {
+		s.errorf("Failed to list query events: %s", err)
+		return
+	}
+	now := s.clock.Now()
+	var rids []string
+	for _, rec := range recs {
+		if rec.Expires.After(now) && IsValidRID(rec.RID) && !s.ownsResource(rec.RID) {
+			rids = append(rids, rec.RID)
+		}
+		if err := s.queryRegistry.Remove(rec.Subject); err != nil {
+			s.errorf("Failed to unregister query event for %s: %s", rec.RID, err)
+		}
+	}
+	if len(rids) > 0 {
+		s.infof("Invalidating %d query events from previous run", len(rids))
+		s.ResetResources(rids...)
+	}
+}
+
+// ownsResource returns true if the resource name is matched by any of the
+// owned resource patterns reset by ResetAll.
+func (s *Service) ownsResource(rname string) bool {
+	for _, p := range s.resetResources {
+		if Pattern(p).Matches(rname) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileQueryEventRegistry is a QueryEventRegistry storing the records as JSON
+// in a file. The records are kept in memory, and the file is rewritten in the
+// background after each change. Changes made while the file is being written
+// are written together in a single rewrite.
+//
+// Adding or removing a record never waits for the file to be written. An error
+// writing the file is returned by the next call to Add, Remove, or Flush.
+type FileQueryEventRegistry struct {
+	path    string
+	mu      sync.Mutex
+	recs    map[string]QueryEventRecord // Records keyed by subject. Nil until read from the file.
+	dirty   bool                        // Flag telling that the records are changed since the last write
+	writing chan struct{}               // Closed when the background write is done. Nil if not writing.
+	err     error                       // Error of the last write, not yet returned
+}
+
+// NewFileQueryEventRegistry returns a registry storing records in the file at
+// path. The file is created when the first record is added.
+func NewFileQueryEventRegistry(path string) *FileQueryEventRegistry {
+	return &FileQueryEventRegistry{path: path}
+}
+
+// Add adds a query event record.
+func (reg *FileQueryEventRegistry) Add(rec QueryEventRecord) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if err := reg.load(); err != nil {
+		return err
+	}
+	reg.recs[rec.Subject] = rec
+	reg.write()
+	return reg.takeErr()
+}
+
+// Remove removes the record with the subject.
+func (reg *FileQueryEventRegistry) Remove(subject string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if err := reg.load(); err != nil {
+		return err
+	}
+	if _, ok := reg.recs[subject]; ok {
+		delete(reg.recs, subject)
+		reg.write()
+	}
+	return reg.takeErr()
+}
+
+// List returns all records, sorted by subject.
+func (reg *FileQueryEventRegistry) List() ([]QueryEventRecord, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if err := reg.load(); err != nil {
+		return nil, err
+	}
+	list := make([]QueryEventRecord, 0, len(reg.recs))
+	for _, rec := range reg.recs {
+		list = append(list, rec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Subject < list[j].Subject })
+	return list, nil
+}
+
+// Flush waits for any pending changes to be written to the file, and returns
+// the error of any failed write.
+func (reg *FileQueryEventRegistry) Flush() error {
+	reg.mu.Lock()
+	for reg.writing != nil {
+		ch := reg.writing
+		reg.mu.Unlock()
+		<-ch
+		reg.mu.Lock()
+	}
+	defer reg.mu.Unlock()
+	return reg.takeErr()
+}
+
+// load reads the records from the file, unless already read. A missing file
+// contains no records.
+func (reg *FileQueryEventRegistry) load() error {
+	if reg.recs != nil {
+		return nil
+	}
+	recs := make(map[string]QueryEventRecord)
+	data, err := os.ReadFile(reg.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &recs); err != nil {
+			return err
+		}
+	}
+	reg.recs = recs
+	return nil
+}
+
+// write marks the records as changed, and starts writing them to the file in
+// the background, unless a write is already in progress.
+func (reg *FileQueryEventRegistry) write() {
+	reg.dirty = true
+	if reg.writing != nil {
+		return
+	}
+	ch := make(chan struct{})
+	reg.writing = ch
+	go func() {
+		defer close(ch)
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		for reg.dirty {
+			reg.dirty = false
+			data, err := json.Marshal(reg.recs)
+			if err == nil {
+				reg.mu.Unlock()
+				err = reg.writeFile(data)
+				reg.mu.Lock()
+			}
+			if err != nil {
+				reg.err = err
+			}
+		}
+		reg.writing = nil
+	}()
+}
+
+// writeFile writes the data to the file, replacing it atomically.
+func (reg *FileQueryEventRegistry) writeFile(data []byte) error {
+	tmp := reg.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, reg.path)
+}
+
+// takeErr returns and clears the error of the last failed write.
+func (reg *FileQueryEventRegistry) takeErr() error {
+	err := reg.err
+	reg.err = nil
+	return err
+}
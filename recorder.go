@@ -0,0 +1,101 @@
+package res
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Record directions.
+const (
+	RecordIn  = "in"  // Message received by the service
+	RecordOut = "out" // Message published by the service
+)
+
+// RecordedMessage is a NATS message recorded by a service with a recorder set
+// using SetRecorder. Each message is written as a single line of JSON.
+type RecordedMessage struct {
+	Time    time.Time       `json:"time"`
+	Dir     string          `json:"dir"`
+	Subject string          `json:"subject"`
+	Reply   string          `json:"reply,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Text    *string         `json:"text,omitempty"` // Set instead of Data if the payload is not valid JSON
+}
+
+// Payload returns the raw payload of the recorded message.
+func (m RecordedMessage) Payload() []byte {
+	if m.Text != nil {
+		return []byte(*m.Text)
+	}
+	return m.Data
+}
+
+// recorder writes recorded messages to a writer.
+type recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// SetRecorder sets a writer to which all inbound requests, and all outbound
+// responses and events are recorded, together with a timestamp. Each message
+// is written as a JSON encoded RecordedMessage, on a line of its own.
+//
+// The recording can be replayed against a service under test using the restest
+// package, to reproduce issues found in production. A nil writer disables
+// recording.
+//
+// Recording is intended for debugging, and adds overhead to each message.
+// Panics if service is already started.
+func (s *Service) SetRecorder(w io.Writer) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if w == nil {
+		s.recorder = nil
+	} else {
+		s.recorder = &recorder{enc: json.NewEncoder(w)}
+	}
+	return s
+}
+
+// record writes a message to the recorder, if one is set.
+func (s *Service) record(dir, subject, reply string, payload []byte) {
+	if s.recorder == nil {
+		return
+	}
+	m := RecordedMessage{
+		Time:    s.clock.Now(),
+		Dir:     dir,
+		Subject: subject,
+		Reply:   reply,
+	}
+	if len(payload) > 0 {
+		if json.Valid(payload) {
+			m.Data = json.RawMessage(payload)
+		} else {
+			text := string(payload)
+			m.Text = &text
+		}
+	}
+	s.recorder.mu.Lock()
+	err := s.recorder.enc.Encode(m)
+	s.recorder.mu.Unlock()
+	if err != nil {
+		s.errorf("Failed to record message %s: %s", subject, err)
+	}
+}
+
+// recordIn records an inbound message.
+func (s *Service) recordIn(m *nats.Msg) {
+	s.record(RecordIn, m.Subject, m.Reply, m.Data)
+}
+
+// publish records and publishes the payload to the given subject.
+func (s *Service) publish(subject string, payload []byte) error {
+	s.record(RecordOut, subject, "", payload)
+	return s.nc.Publish(subject, payload)
+}
@@ -1,12 +1,16 @@
 package res
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
@@ -30,6 +34,16 @@ type Request struct {
 	rheader http.Header
 	status  int
 
+	logStart    time.Time       // Time when handling started. Zero if the request is not logged.
+	autoTimeout *autoTimeout    // Automatic timeout pre-response. Nil if not used.
+	dedupKey    string          // Key of the deduplicated access request sharing the response. Empty if not used.
+	flightKey   string          // Key of the get request flight sharing the response. Empty if not used.
+	acceptGzip  bool            // Flag telling if the request accepts a gzip compressed response
+	capture     func([]byte)    // Function receiving replies instead of them being published. Nil if not used.
+	onReply     func([]byte)    // Function called with the reply payload once published. Nil if not used.
+	dtoken      json.RawMessage // Token decorated by the service's token decorator
+	decorated   bool            // Flag telling if the token has been decorated
+
 	// Fields from the request data
 	cid        string
 	params     json.RawMessage
@@ -47,16 +61,23 @@ type AccessRequest interface {
 	CID() string
 	RawToken() json.RawMessage
 	ParseToken(interface{})
+	ConnectionValue(key interface{}) interface{}
 	IsHTTP() bool
 	SetResponseStatus(code int)
 	ResponseHeader() http.Header
 	Access(get bool, call string)
+	AccessFor(get bool, call string, d time.Duration)
 	AccessDenied()
 	AccessGranted()
+	AccessGrantedFor(d time.Duration)
 	NotFound()
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
+	Replied() bool
 }
 
 // ModelRequest has methods for responding to model get requests.
@@ -66,9 +87,13 @@ type ModelRequest interface {
 	QueryModel(model interface{}, query string)
 	NotFound()
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
 	ForValue() bool
+	Replied() bool
 }
 
 // CollectionRequest has methods for responding to collection get requests.
@@ -78,9 +103,13 @@ type CollectionRequest interface {
 	QueryCollection(collection interface{}, query string)
 	NotFound()
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
 	ForValue() bool
+	Replied() bool
 }
 
 // GetRequest has methods for responding to resource get requests.
@@ -92,9 +121,13 @@ type GetRequest interface {
 	QueryCollection(collection interface{}, query string)
 	NotFound()
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
 	ForValue() bool
+	Replied() bool
 }
 
 // CallRequest has methods for responding to call requests.
@@ -105,18 +138,27 @@ type CallRequest interface {
 	RawParams() json.RawMessage
 	RawToken() json.RawMessage
 	ParseParams(interface{})
+	ParamsDecoder() *json.Decoder
 	ParseToken(interface{})
+	SetConnectionValue(key, v interface{})
+	ConnectionValue(key interface{}) interface{}
 	IsHTTP() bool
 	SetResponseStatus(code int)
 	ResponseHeader() http.Header
 	OK(result interface{})
 	Resource(rid string)
+	ResourceResult(rid string, result interface{})
 	NotFound()
 	MethodNotFound()
 	InvalidParams(message string)
+	InvalidParamsData(message string, data interface{})
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
+	Replied() bool
 }
 
 // NewRequest has methods for responding to new call requests.
@@ -126,14 +168,21 @@ type NewRequest interface {
 	RawParams() json.RawMessage
 	RawToken() json.RawMessage
 	ParseParams(interface{})
+	ParamsDecoder() *json.Decoder
 	ParseToken(interface{})
+	ConnectionValue(key interface{}) interface{}
 	New(rid Ref)
 	NotFound()
 	MethodNotFound()
 	InvalidParams(message string)
+	InvalidParamsData(message string, data interface{})
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
+	Replied() bool
 }
 
 // AuthRequest has methods for responding to auth requests.
@@ -144,7 +193,10 @@ type AuthRequest interface {
 	RawParams() json.RawMessage
 	RawToken() json.RawMessage
 	ParseParams(interface{})
+	ParamsDecoder() *json.Decoder
 	ParseToken(interface{})
+	SetConnectionValue(key, v interface{})
+	ConnectionValue(key interface{}) interface{}
 	Header() map[string][]string
 	Host() string
 	RemoteAddr() string
@@ -154,13 +206,19 @@ type AuthRequest interface {
 	ResponseHeader() http.Header
 	OK(result interface{})
 	Resource(rid string)
+	ResourceResult(rid string, result interface{})
 	NotFound()
 	MethodNotFound()
 	InvalidParams(message string)
+	InvalidParamsData(message string, data interface{})
 	InvalidQuery(message string)
+	BindParams(v interface{}) bool
+	QueryValues() (url.Values, error)
 	Error(err error)
+	ErrorData(code, message string, data interface{})
 	Timeout(d time.Duration)
 	TokenEvent(t interface{})
+	Replied() bool
 }
 
 // Static responses and events
@@ -173,6 +231,7 @@ var (
 	responseInvalidQuery    = []byte(`{"error":{"code":"system.invalidQuery","message":"Invalid query"}}`)
 	responseMissingResponse = []byte(`{"error":{"code":"system.internalError","message":"Internal error: missing response"}}`)
 	responseMissingQuery    = []byte(`{"error":{"code":"system.internalError","message":"Internal error: missing query"}}`)
+	responseServiceStopped  = []byte(`{"error":{"code":"system.internalError","message":"Internal error: service is stopped"}}`)
 	responseAccessGranted   = []byte(`{"result":{"get":true,"call":"*"}}`)
 	responseNoQueryEvents   = []byte(`{"result":{"events":[]}}`)
 	responseSuccess         = []byte(`{"result":null}`)
@@ -215,9 +274,10 @@ func (r *Request) RawParams() json.RawMessage {
 }
 
 // RawToken returns the JSON encoded access token, or nil if the request had no token.
+// If a TokenDecorator is set, the decorated token is returned.
 // Always returns nil for get requests.
 func (r *Request) RawToken() json.RawMessage {
-	return r.token
+	return r.decoratedToken()
 }
 
 // Header returns the HTTP headers sent by client on connect.
@@ -324,9 +384,31 @@ func (r *Request) Resource(rid string) {
 	r.reply(data)
 }
 
+// ResourceResult sends a successful resource response to a request, with an
+// accompanying result. The rid string must be a valid resource ID.
+//
+// Resgate responds to the client with the resource, ignoring the result. The
+// result is available to services making the request directly, such as with
+// resprot.Response.ParseResourceResult.
+//
+// Only valid for call and auth requests.
+func (r *Request) ResourceResult(rid string, result interface{}) {
+	ref := Ref(rid)
+	if !ref.IsValid() {
+		panic("res: invalid resource ID: " + rid)
+	}
+	data, err := json.Marshal(resourceResultResponse{Resource: ref, Result: result, Meta: r.meta()})
+	if err != nil {
+		r.error(ToError(err), nil)
+		return
+	}
+	r.reply(data)
+}
+
 // Error sends a custom error response for the request.
+// Validation errors are sent as system.invalidParams (see ValidationError).
 func (r *Request) Error(err error) {
-	r.error(ToError(err), r.meta())
+	r.error(handlerError(err), r.meta())
 }
 
 // NotFound sends a system.notFound response for the request.
@@ -370,6 +452,25 @@ func (r *Request) InvalidParams(message string) {
 	r.error(err, m)
 }
 
+// InvalidParamsData sends a system.invalidParams response with data, such as
+// a list of FieldError values describing the failing fields. An empty message
+// will default to "Invalid parameters".
+//
+// Only valid for call and auth requests.
+func (r *Request) InvalidParamsData(message string, data interface{}) {
+	if message == "" {
+		message = ErrInvalidParams.Message
+	}
+	r.error(&Error{Code: CodeInvalidParams, Message: message, Data: data}, r.meta())
+}
+
+// ErrorData sends a custom error response with data for the request.
+// An empty message will default to the message registered for the code. See
+// RegisterError.
+func (r *Request) ErrorData(code, message string, data interface{}) {
+	r.error(&Error{Code: code, Message: message, Data: data}, r.meta())
+}
+
 // InvalidQuery sends a system.invalidQuery response.
 // An empty message will default to "Invalid query".
 func (r *Request) InvalidQuery(message string) {
@@ -387,6 +488,23 @@ func (r *Request) InvalidQuery(message string) {
 	r.error(err, m)
 }
 
+// QueryValues parses the query and returns the corresponding values. If the
+// query is malformed, a system.invalidQuery response is sent, and the parse
+// error is returned:
+//
+//	q, err := r.QueryValues()
+//	if err != nil {
+//		return
+//	}
+func (r *Request) QueryValues() (url.Values, error) {
+	v, err := url.ParseQuery(r.query)
+	if err != nil {
+		r.InvalidQuery("Invalid query: " + err.Error())
+		return nil, err
+	}
+	return v, nil
+}
+
 // Access sends a successful response.
 //
 // The get flag tells if the client has access to get (read) the resource.
@@ -403,6 +521,23 @@ func (r *Request) Access(get bool, call string) {
 	r.success(accessResponse{Get: get, Call: call}, r.meta())
 }
 
+// AccessFor sends a successful response in the same way as Access, but includes
+// a hint of the duration for which the access result may be cached by the
+// gateway. The duration is sent in milliseconds. A zero duration means no
+// hint is given.
+//
+// Only valid for access requests.
+func (r *Request) AccessFor(get bool, call string, d time.Duration) {
+	if d < 0 {
+		panic("res: negative access duration")
+	}
+	if !get && call == "" {
+		r.AccessDenied()
+		return
+	}
+	r.success(accessResponse{Get: get, Call: call, Duration: int64(d / time.Millisecond)}, r.meta())
+}
+
 // AccessDenied sends a system.accessDenied response.
 //
 // Only valid for access requests.
@@ -430,8 +565,20 @@ func (r *Request) AccessGranted() {
 	}
 }
 
+// AccessGrantedFor sends a successful response granting full access to the
+// resource, with a hint of the duration for which the access result may be
+// cached by the gateway. Same as calling:
+//
+//	AccessFor(true, "*", d);
+//
+// Only valid for access requests.
+func (r *Request) AccessGrantedFor(d time.Duration) {
+	r.AccessFor(true, "*", d)
+}
+
 // Model sends a successful model response for the get request.
-// The model must marshal into a JSON object.
+// The model must marshal into a JSON object. Struct fields tagged
+// `res:"private"` are excluded, as by PublicModel.
 //
 // Only valid for get requests for a model resource.
 func (r *Request) Model(model interface{}) {
@@ -449,6 +596,11 @@ func (r *Request) QueryModel(model interface{}, query string) {
 // model sends a successful model response for the get request.
 func (r *Request) model(model interface{}, query string) {
 	// [TODO] Marshal model to a json.RawMessage to see if it is a JSON object
+	model = PublicModel(model)
+	r.strictRefs(model)
+	if r.h.Versioned && r.h.VersionProperty != "" {
+		model = versionedModel{prop: r.h.VersionProperty, version: r.s.ResourceVersion(r.rname), model: model}
+	}
 	r.success(modelResponse{Model: model, Query: query}, nil)
 }
 
@@ -471,6 +623,7 @@ func (r *Request) QueryCollection(collection interface{}, query string) {
 // collection sends a successful collection response for the get request.
 func (r *Request) collection(collection interface{}, query string) {
 	// [TODO] Marshal collection to a json.RawMessage to see if it is a JSON array
+	r.strictRefs(collection)
 	r.success(collectionResponse{Collection: collection, Query: query}, nil)
 }
 
@@ -501,14 +654,41 @@ func (r *Request) ParseParams(p interface{}) {
 	}
 }
 
+// ParamsDecoder returns a json.Decoder reading the JSON encoded parameters. It
+// allows large parameters, such as arrays of items to import, to be decoded
+// one item at a time, instead of unmarshaling them all into memory:
+//
+//	dec := r.ParamsDecoder()
+//	if _, err := dec.Token(); err != nil { // Opening bracket
+//		r.InvalidParams(err.Error())
+//		return
+//	}
+//	for dec.More() {
+//		var item Item
+//		if err := dec.Decode(&item); err != nil {
+//			r.InvalidParams(err.Error())
+//			return
+//		}
+//		importItem(item)
+//	}
+//
+// If the request has no parameters, the decoder returns io.EOF on the first
+// read.
+//
+// Only valid for call and auth requests.
+func (r *Request) ParamsDecoder() *json.Decoder {
+	return json.NewDecoder(bytes.NewReader(r.params))
+}
+
 // ParseToken unmarshals the JSON encoded token and stores the result in t.
+// If a TokenDecorator is set, the decorated token is used.
 // If the request has no token, ParseToken does nothing.
 // On any error, ParseToken panics with a system.internalError *Error.
 //
 // Not valid for get requests.
 func (r *Request) ParseToken(t interface{}) {
-	if len(r.token) > 0 {
-		err := json.Unmarshal(r.token, t)
+	if token := r.decoratedToken(); len(token) > 0 {
+		err := json.Unmarshal(token, t)
 		if err != nil {
 			panic(InternalError(err))
 		}
@@ -521,8 +701,8 @@ func (r *Request) Timeout(d time.Duration) {
 	if d < 0 {
 		panic("res: negative timeout duration")
 	}
-	out := []byte(`timeout:"` + strconv.FormatInt(int64(d/time.Millisecond), 10) + `"`)
-	r.s.rawEvent(r.msg.Reply, out)
+	r.stopAutoTimeout()
+	r.sendTimeout(d)
 }
 
 // TokenEvent sends a connection token event that sets the requester's connection access token,
@@ -536,6 +716,11 @@ func (r *Request) TokenEvent(token interface{}) {
 	r.s.event("conn."+r.cid+".token", tokenEvent{Token: token})
 }
 
+// Replied returns true if a response has been sent for the request.
+func (r *Request) Replied() bool {
+	return r.replied
+}
+
 // ForValue is used to tell whether a get request handler is called as a result of Value being
 // called from another handler.
 //
@@ -560,12 +745,17 @@ func (r *Request) success(result interface{}, m *metaObject) {
 		r.error(ToError(err), nil)
 		return
 	}
+	wire, compressed := r.wireData(data)
+	if r.oversizedResult(wire) {
+		return
+	}
 
-	r.reply(data)
+	r.replyData(data, wire, compressed)
 }
 
 // error sends an error response as a reply.
 func (r *Request) error(e *Error, m *metaObject) {
+	e, m = catalogError(e, m, r.isHTTP)
 	data, err := json.Marshal(errorResponse{Error: e, Meta: m})
 	if err != nil {
 		data = responseInternalError
@@ -575,17 +765,103 @@ func (r *Request) error(e *Error, m *metaObject) {
 }
 
 // reply sends an encoded payload to as a reply.
-// If a reply is already sent, reply will panic.
+// If a reply is already sent, reply will panic, or log an error if the service
+// has the NoReplyPanic flag set.
 func (r *Request) reply(payload []byte) {
+	r.replyData(payload, nil, false)
+}
+
+// replyData sends an encoded payload as a reply, using data as the published
+// wire data. If data is nil, it is encoded from the payload.
+func (r *Request) replyData(payload []byte, data []byte, compressed bool) {
 	if r.replied {
+		if r.s.noReplyPanic {
+			r.s.errorf("Response already sent on request %s [%s]", r.msg.Subject, r.CorrelationID())
+			return
+		}
 		panic("res: response already sent on request")
 	}
 	r.replied = true
-	r.s.tracef("<== %s: %s", r.msg.Subject, payload)
-	err := r.s.nc.Publish(r.msg.Reply, payload)
-	if err != nil {
-		r.s.errorf("Error sending reply %s: %s", r.msg.Subject, err)
+	r.stopAutoTimeout()
+	if r.capture != nil {
+		r.capture(payload)
+		return
+	}
+	if data == nil {
+		data, compressed = r.wireData(payload)
+	}
+	if p := r.oversizedReply(data); p != nil {
+		payload, data, compressed = p, p, false
 	}
+	if !r.logStart.IsZero() {
+		r.logSummary(payload)
+	}
+	if r.msg.Reply == "" {
+		// Fire-and-forget call without a reply subject
+		r.s.tracef("<== %s (discarded, no reply subject): %s", r.msg.Subject, payload)
+	} else {
+		r.s.tracef("<== %s: %s", r.msg.Subject, payload)
+		// Record the uncompressed payload to allow replaying the recording.
+		r.s.record(RecordOut, r.msg.Reply, "", payload)
+		err := r.s.publishReply(r.msg.Reply, data, compressed)
+		if err != nil {
+			r.s.errorf("Error sending reply %s [%s]: %s", r.msg.Subject, r.CorrelationID(), err)
+		} else {
+			r.s.countReply(payload)
+		}
+	}
+	if r.dedupKey != "" {
+		r.completeDedup(payload)
+	}
+	if r.flightKey != "" {
+		r.completeFlight(payload)
+	}
+	if r.onReply != nil {
+		r.onReply(payload)
+	}
+}
+
+// exceedsLimits checks if the request params or token exceeds the maximum size
+// set for the service. If so, it replies with an invalid params error and
+// returns true.
+func (r *Request) exceedsLimits() bool {
+	if r.s.maxParamsSize > 0 && len(r.params) > r.s.maxParamsSize {
+		r.error(&Error{Code: CodeInvalidParams, Message: "Params exceed maximum size of " + strconv.Itoa(r.s.maxParamsSize) + " bytes"}, nil)
+		return true
+	}
+	if r.s.maxTokenSize > 0 && len(r.token) > r.s.maxTokenSize {
+		r.error(&Error{Code: CodeInvalidParams, Message: "Token exceeds maximum size of " + strconv.Itoa(r.s.maxTokenSize) + " bytes"}, nil)
+		return true
+	}
+	return false
+}
+
+// logSummary logs a summary of the request and its response payload at the
+// handler's log level.
+func (r *Request) logSummary(payload []byte) {
+	result := "result"
+	if bytes.HasPrefix(payload, []byte(`{"error"`)) {
+		var er struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(payload, &er) == nil {
+			result = er.Error.Code
+		}
+	} else if bytes.HasPrefix(payload, []byte(`{"resource"`)) {
+		result = "resource"
+	}
+	r.s.logf(r.h.LogLevel, "Request %s %s: %s (%s) [%s]%s", r.rtype, r.rname+methodSuffix(r.method), result, r.s.clock.Now().Sub(r.logStart), r.CorrelationID(), formatLabels(r.h.Labels))
+}
+
+// methodSuffix returns the method prefixed with a dot, or an empty string if
+// method is empty.
+func methodSuffix(method string) string {
+	if method == "" {
+		return ""
+	}
+	return "." + method
 }
 
 func (r *Request) executeHandler() {
@@ -608,6 +884,12 @@ func (r *Request) executeHandler() {
 			}
 			str = e.Message
 		case error:
+			if ve := ValidationError(e); ve != nil && !r.replied {
+				r.error(ve, r.meta())
+				// Return without logging as panicing with a validation
+				// error is considered a valid way of rejecting params.
+				return
+			}
 			str = e.Error()
 			if !r.replied {
 				r.error(ToError(e), r.meta())
@@ -624,7 +906,7 @@ func (r *Request) executeHandler() {
 			}
 		}
 
-		r.s.errorf("Error handling request %s: %s\n\t%s", r.msg.Subject, str, string(debug.Stack()))
+		r.s.errorf("Error handling request %s [%s]: %s\n\t%s", r.msg.Subject, r.CorrelationID(), str, string(debug.Stack()))
 	}()
 
 	hs := r.h
@@ -632,7 +914,19 @@ func (r *Request) executeHandler() {
 	switch r.rtype {
 	case "access":
 		if hs.Access == nil {
-			// No handling. Assume the access requests is handled by other services.
+			switch hs.AccessFallthrough {
+			case AccessDeny:
+				r.reply(responseAccessDenied)
+			case AccessNotFound:
+				r.reply(responseNotFound)
+			}
+			// Otherwise no handling. Assume the access requests is handled by other services.
+			return
+		}
+		if r.exceedsLimits() {
+			return
+		}
+		if hs.DedupAccess > 0 && r.dedupAccess() {
 			return
 		}
 		hs.Access(r)
@@ -641,10 +935,19 @@ func (r *Request) executeHandler() {
 			r.reply(responseNotFound)
 			return
 		}
+		// Send buffered events before the response, as it may include them.
+		r.flushThrottled()
 		hs.Get(r)
 	case "call":
+		if r.exceedsLimits() {
+			return
+		}
+		if hs.Shadows != nil {
+			r.setShadow()
+		}
 		if r.method == "new" {
 			if hs.New != nil {
+				r.checkDeprecated()
 				hs.New(r)
 				return
 			}
@@ -660,8 +963,12 @@ func (r *Request) executeHandler() {
 			r.reply(responseMethodNotFound)
 			return
 		}
+		r.checkDeprecated()
 		h(r)
 	case "auth":
+		if r.exceedsLimits() {
+			return
+		}
 		var h AuthHandler
 		if hs.Auth != nil {
 			h = hs.Auth[r.method]
@@ -673,13 +980,35 @@ func (r *Request) executeHandler() {
 			r.reply(responseMethodNotFound)
 			return
 		}
+		r.checkDeprecated()
 		h(r)
 	default:
 		r.s.errorf("Unknown request type: %s", r.Type())
 		return
 	}
 
-	if !r.replied {
+	if !r.replied && r.msg.Reply != "" {
 		r.reply(responseMissingResponse)
 	}
 }
+
+// formatLabels returns the labels as space prefixed key=value pairs, sorted
+// by key. Empty string if there are no labels.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteByte(' ')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package res
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultResetGroupSize is the default number of resources sharing the same
+// parent needed to be grouped into a wildcard pattern by ResetResources.
+const defaultResetGroupSize = 16
+
+// SetResetGroupSize sets the number of resources sharing the same parent,
+// differing only in the last part of the resource name, needed for
+// ResetResources to group them into a single wildcard pattern, such as
+// "library.book.*". A grouped pattern may also reset resources not in the
+// list. Default is 16.
+//
+// If size is zero, the default value is used. If size is less than zero,
+// resources are never grouped.
+func (s *Service) SetResetGroupSize(size int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.resetGroupSize = size
+	return s
+}
+
+// ResetResources sends a system reset for a known set of resources, such as
+// those touched by a bulk update in a backend, where resetting all resources
+// of a pattern would be too broad:
+//
+//	service.ResetResources("library.book.12", "library.book.42", "library.books?limit=10")
+//
+// Any query part of the resource IDs is removed, as system resets match the
+// resource names. Duplicates are removed, and resources sharing the same
+// parent are grouped into a wildcard pattern, once there are as many of
+// them as set with SetResetGroupSize.
+//
+// Panics if any resource ID is invalid.
+func (s *Service) ResetResources(rids ...string) {
+	for _, rid := range rids {
+		if !IsValidRID(rid) {
+			panic("res: invalid resource ID: " + rid)
+		}
+	}
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		s.errorf("Failed to reset: service not started")
+		return
+	}
+
+	size := s.resetGroupSize
+	if size == 0 {
+		size = defaultResetGroupSize
+	}
+	s.reset(resetPatterns(rids, size), nil)
+}
+
+// resetPatterns returns the sorted reset patterns for the resource IDs,
+// grouping resources with the same parent into a wildcard pattern if there
+// are at least groupSize of them. A groupSize less than 1 means no grouping.
+func resetPatterns(rids []string, groupSize int) []string {
+	names := make(map[string]struct{}, len(rids))
+	for _, rid := range rids {
+		if i := strings.IndexByte(rid, '?'); i >= 0 {
+			rid = rid[:i]
+		}
+		names[rid] = struct{}{}
+	}
+
+	if groupSize < 1 {
+		groupSize = len(names) + 1
+	}
+
+	// Count the resources of each parent
+	parents := make(map[string]int)
+	for name := range names {
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			parents[name[:i]]++
+		}
+	}
+
+	patterns := make([]string, 0, len(names))
+	for parent, n := range parents {
+		if n >= groupSize {
+			patterns = append(patterns, parent+".*")
+		}
+	}
+	for name := range names {
+		if i := strings.LastIndexByte(name, '.'); i < 0 || parents[name[:i]] < groupSize {
+			patterns = append(patterns, name)
+		}
+	}
+	sort.Strings(patterns)
+	return patterns
+}
@@ -0,0 +1,37 @@
+/*
+Package resgraphql provides a bridge exposing resources of a res service as a
+GraphQL schema, with queries for getting resources, and subscriptions driven
+by resource events.
+
+The package does not contain a GraphQL server. Instead, it generates the
+schema in the GraphQL schema definition language (SDL), and provides Query and
+Subscribe methods to be called by the resolvers of any GraphQL server
+library.
+
+A field is generated for each exposed resource pattern with a get handler,
+named from the static parts of the pattern, and with an argument for each
+placeholder tag. Patterns with anonymous (*) or full (>) wildcards are not
+exposed.
+
+# Usage
+
+Create the bridge after registering the handlers, and before serving:
+
+	s := res.NewService("library")
+	s.Handle("book.$id", res.GetModel(getBook))
+	b := resgraphql.New(s, resgraphql.Config{
+		Types: map[string]interface{}{
+			"library.book.$id": Book{},
+		},
+	})
+	fmt.Println(b.Schema())
+	// type Query {
+	//   book(id: String!): Book
+	// }
+	// ...
+
+Resolve the book query field:
+
+	v, err := b.Query(ctx, "book", map[string]string{"id": "42"})
+*/
+package resgraphql
@@ -0,0 +1,294 @@
+package resgraphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+)
+
+// EventBufferSize is the size of the channel buffer for each subscription.
+// Events are dropped for subscriptions with a full buffer.
+const EventBufferSize = 64
+
+// Config holds the bridge configuration.
+type Config struct {
+	// Include is a list of full resource patterns, including service name, to
+	// expose. If empty, all resources with a get handler are exposed.
+	Include []string
+
+	// Types maps full resource patterns to a value of the Go type of the
+	// resource, used to generate GraphQL object types. Resources without type
+	// metadata use the JSON scalar type.
+	Types map[string]interface{}
+}
+
+// Field is a GraphQL field exposing a resource pattern.
+type Field struct {
+	// Name is the name of the field.
+	Name string
+
+	// Pattern is the full resource pattern.
+	Pattern res.Pattern
+
+	// Args is the names of the placeholder tags in the pattern.
+	Args []string
+
+	// Type is the GraphQL type of the resource.
+	Type string
+}
+
+// Event is a resource event sent to subscriptions.
+type Event = resprot.ListenerEvent
+
+// Bridge exposes resources of a service as GraphQL fields.
+type Bridge struct {
+	s      *res.Service
+	fields []Field
+	byName map[string]*Field
+	types  map[string]string
+	mu     sync.Mutex
+	subs   map[string]map[chan Event]struct{}
+}
+
+var errUnknownField = errors.New("resgraphql: unknown field")
+
+// New creates a new Bridge for the service, and adds event listeners for the
+// exposed resources.
+//
+// It must be called after all handlers are registered, and before the service
+// is started.
+func New(s *res.Service, cfg Config) *Bridge {
+	b := &Bridge{
+		s:      s,
+		byName: make(map[string]*Field),
+		types:  make(map[string]string),
+		subs:   make(map[string]map[chan Event]struct{}),
+	}
+
+	include := make(map[string]bool, len(cfg.Include))
+	for _, p := range cfg.Include {
+		include[p] = true
+	}
+
+	fp := s.FullPath()
+	var patterns []string
+	htypes := make(map[string]res.ResourceType)
+	s.Walk(func(p res.Pattern, h res.Handler) {
+		if h.Get == nil || (len(include) > 0 && !include[string(p)]) {
+			return
+		}
+		patterns = append(patterns, string(p))
+		htypes[string(p)] = h.Type
+	})
+	sort.Strings(patterns)
+
+	names := make(map[string]bool, len(patterns))
+	for _, p := range patterns {
+		name, args, ok := fieldName(p, fp)
+		if !ok {
+			continue
+		}
+		if names[name] {
+			for i := 2; ; i++ {
+				if n := fmt.Sprintf("%s%d", name, i); !names[n] {
+					name = n
+					break
+				}
+			}
+		}
+		names[name] = true
+		typ := "JSON"
+		if v, ok := cfg.Types[p]; ok {
+			typ = b.typeOf(exportName(name), v)
+		} else if htypes[p] == res.TypeCollection {
+			typ = "[JSON]"
+		}
+		b.fields = append(b.fields, Field{Name: name, Pattern: res.Pattern(p), Args: args, Type: typ})
+		s.AddListener(strings.TrimPrefix(strings.TrimPrefix(p, fp), "."), b.listener)
+	}
+	for i := range b.fields {
+		b.byName[b.fields[i].Name] = &b.fields[i]
+	}
+	return b
+}
+
+// Fields returns the exposed fields, sorted by resource pattern.
+func (b *Bridge) Fields() []Field {
+	fields := make([]Field, len(b.fields))
+	copy(fields, b.fields)
+	return fields
+}
+
+// Schema returns the GraphQL schema in the schema definition language.
+func (b *Bridge) Schema() string {
+	var sb strings.Builder
+	sb.WriteString("scalar JSON\n\n")
+	sb.WriteString("type ResourceEvent {\n  rid: String!\n  event: String!\n  changed: JSON\n  value: JSON\n  idx: Int\n  data: JSON\n  payload: JSON\n}\n")
+
+	names := make([]string, 0, len(b.types))
+	for name := range b.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("\n")
+		sb.WriteString(b.types[name])
+	}
+
+	for _, root := range []string{"Query", "Subscription"} {
+		sb.WriteString("\ntype " + root + " {\n")
+		for _, f := range b.fields {
+			sb.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				sb.WriteString("(")
+				for i, a := range f.Args {
+					if i > 0 {
+						sb.WriteString(", ")
+					}
+					sb.WriteString(a + ": String!")
+				}
+				sb.WriteString(")")
+			}
+			if root == "Query" {
+				sb.WriteString(": " + f.Type + "\n")
+			} else {
+				sb.WriteString(": ResourceEvent\n")
+			}
+		}
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+// Query gets the value of the resource for the field, with the tag values set
+// by args.
+func (b *Bridge) Query(ctx context.Context, field string, args map[string]string) (interface{}, error) {
+	rid, err := b.rid(field, args)
+	if err != nil {
+		return nil, err
+	}
+	type result struct {
+		v   interface{}
+		err error
+	}
+	ch := make(chan result, 1)
+	err = b.s.With(rid, func(r res.Resource) {
+		v, err := r.Value()
+		ch <- result{v, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Subscribe returns a channel on which events for the resource of the field,
+// with the tag values set by args, are sent. The returned function must be
+// called to unsubscribe.
+func (b *Bridge) Subscribe(field string, args map[string]string) (<-chan Event, func(), error) {
+	rid, err := b.rid(field, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan Event, EventBufferSize)
+	b.mu.Lock()
+	m, ok := b.subs[rid]
+	if !ok {
+		m = make(map[chan Event]struct{})
+		b.subs[rid] = m
+	}
+	m[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[rid], ch)
+			if len(b.subs[rid]) == 0 {
+				delete(b.subs, rid)
+			}
+			b.mu.Unlock()
+		})
+	}, nil
+}
+
+// rid returns the resource ID for the field and arguments.
+func (b *Bridge) rid(field string, args map[string]string) (string, error) {
+	f, ok := b.byName[field]
+	if !ok {
+		return "", errUnknownField
+	}
+	for _, a := range f.Args {
+		if args[a] == "" {
+			return "", fmt.Errorf("resgraphql: missing argument %s for field %s", a, field)
+		}
+	}
+	return string(f.Pattern.ReplaceTags(args)), nil
+}
+
+// listener sends the event to all subscriptions for the resource.
+func (b *Bridge) listener(ev *res.Event) {
+	rname := ev.Resource.ResourceName()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.subs[rname]
+	if len(m) == 0 {
+		return
+	}
+	e := resprot.NewListenerEvent(ev)
+	for ch := range m {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// fieldName returns the field name and argument names for a full pattern, or
+// false if the pattern cannot be exposed.
+func fieldName(p, fp string) (string, []string, bool) {
+	if fp != "" {
+		if !strings.HasPrefix(p, fp+".") {
+			return "", nil, false
+		}
+		p = p[len(fp)+1:]
+	}
+	var sb strings.Builder
+	var args []string
+	for _, t := range strings.Split(p, ".") {
+		switch {
+		case t == "*" || t == ">":
+			return "", nil, false
+		case t[0] == '$':
+			args = append(args, t[1:])
+		case sb.Len() == 0:
+			sb.WriteString(t)
+		default:
+			sb.WriteString(exportName(t))
+		}
+	}
+	if sb.Len() == 0 {
+		return "", nil, false
+	}
+	return sb.String(), args, true
+}
+
+// exportName returns the name with the first letter in upper case.
+func exportName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
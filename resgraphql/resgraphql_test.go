@@ -0,0 +1,141 @@
+package resgraphql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resgraphql"
+	"github.com/jirenius/go-res/restest"
+)
+
+type book struct {
+	ID     int      `json:"id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Author author   `json:"author"`
+	secret string
+}
+
+type author struct {
+	Name string `json:"name"`
+}
+
+func newService() *res.Service {
+	s := res.NewService("library")
+	s.Handle("book.$id",
+		res.GetModel(func(r res.ModelRequest) {
+			r.Model(book{ID: 42, Title: "Hobbit"})
+		}),
+		res.Call("rename", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"title": "The Hobbit"})
+			r.OK(nil)
+		}),
+	)
+	s.Handle("books", res.GetCollection(func(r res.CollectionRequest) {
+		r.Collection([]res.Ref{"library.book.42"})
+	}))
+	s.Handle("other.>", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	return s
+}
+
+func TestBridge_Schema_GeneratesSchema(t *testing.T) {
+	b := resgraphql.New(newService(), resgraphql.Config{
+		Types: map[string]interface{}{"library.book.$id": book{}},
+	})
+	expected := `scalar JSON
+
+type ResourceEvent {
+  rid: String!
+  event: String!
+  changed: JSON
+  value: JSON
+  idx: Int
+  data: JSON
+  payload: JSON
+}
+
+type Book {
+  id: Int
+  title: String
+  tags: [String]
+  author: BookAuthor
+}
+
+type BookAuthor {
+  name: String
+}
+
+type Query {
+  book(id: String!): Book
+  books: [JSON]
+}
+
+type Subscription {
+  book(id: String!): ResourceEvent
+  books: ResourceEvent
+}
+`
+	if b.Schema() != expected {
+		t.Fatalf("expected schema:\n%s\nbut got:\n%s", expected, b.Schema())
+	}
+}
+
+func TestBridge_WithInclude_ExposesIncludedPatterns(t *testing.T) {
+	b := resgraphql.New(newService(), resgraphql.Config{
+		Include: []string{"library.books"},
+	})
+	fields := b.Fields()
+	restest.AssertEqualJSON(t, "field count", len(fields), 1)
+	restest.AssertEqualJSON(t, "field name", fields[0].Name, "books")
+}
+
+func TestBridge_Query_ReturnsValue(t *testing.T) {
+	s := newService()
+	b := resgraphql.New(s, resgraphql.Config{})
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	v, err := b.Query(context.Background(), "book", map[string]string{"id": "42"})
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "value", v, book{ID: 42, Title: "Hobbit"})
+}
+
+func TestBridge_QueryWithMissingArgument_ReturnsError(t *testing.T) {
+	b := resgraphql.New(newService(), resgraphql.Config{})
+	_, err := b.Query(context.Background(), "book", nil)
+	restest.AssertError(t, err)
+}
+
+func TestBridge_QueryUnknownField_ReturnsError(t *testing.T) {
+	b := resgraphql.New(newService(), resgraphql.Config{})
+	_, err := b.Query(context.Background(), "unknown", nil)
+	restest.AssertError(t, err)
+}
+
+func TestBridge_Subscribe_ReceivesEvents(t *testing.T) {
+	s := newService()
+	b := resgraphql.New(s, resgraphql.Config{})
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	ch, unsubscribe, err := b.Subscribe("book", map[string]string{"id": "42"})
+	restest.AssertNoError(t, err)
+	defer unsubscribe()
+
+	req := session.Call("library.book.42", "rename", nil)
+	session.GetMsg().AssertChangeEvent("library.book.42", map[string]interface{}{"title": "The Hobbit"})
+	req.Response().AssertResult(nil)
+
+	select {
+	case ev := <-ch:
+		restest.AssertEqualJSON(t, "event", ev, resgraphql.Event{
+			RID:     "library.book.42",
+			Event:   "change",
+			Changed: map[string]interface{}{"title": "The Hobbit"},
+		})
+	case <-time.After(time.Second):
+		t.Fatal("expected event, but got none")
+	}
+}
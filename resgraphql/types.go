@@ -0,0 +1,68 @@
+package resgraphql
+
+import (
+	"reflect"
+	"strings"
+)
+
+// typeOf returns the GraphQL type for the Go value v, generating object types
+// for structs using name as type name.
+func (b *Bridge) typeOf(name string, v interface{}) string {
+	return b.graphqlType(name, reflect.TypeOf(v))
+}
+
+func (b *Bridge) graphqlType(name string, t reflect.Type) string {
+	if t == nil {
+		return "JSON"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "String"
+	case reflect.Bool:
+		return "Boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int"
+	case reflect.Float32, reflect.Float64:
+		return "Float"
+	case reflect.Slice, reflect.Array:
+		return "[" + b.graphqlType(name+"Item", t.Elem()) + "]"
+	case reflect.Struct:
+		return b.objectType(name, t)
+	}
+	return "JSON"
+}
+
+// objectType generates an object type definition for the struct type, and
+// returns its name.
+func (b *Bridge) objectType(name string, t reflect.Type) string {
+	if _, ok := b.types[name]; ok {
+		return name
+	}
+	// Reserve the name to handle recursive types.
+	b.types[name] = ""
+	var sb strings.Builder
+	sb.WriteString("type " + name + " {\n")
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fname := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				fname = n
+			}
+		}
+		sb.WriteString("  " + fname + ": " + b.graphqlType(name+exportName(f.Name), f.Type) + "\n")
+	}
+	sb.WriteString("}\n")
+	b.types[name] = sb.String()
+	return name
+}
@@ -26,13 +26,28 @@ type Resource interface {
 	// Query returns the query part of the resource ID without the question mark separator.
 	Query() string
 
+	// CorrelationID returns the ID used to trace the request being handled
+	// across services. It is taken from the Correlation-Id header of the
+	// request, or generated on first use if the request has none. Empty string
+	// if the resource is not part of a request.
+	CorrelationID() string
+
 	// Group which the resource shares worker goroutine with.
 	// Will be the resource name of no specific group was set.
 	Group() string
 
+	// Labels returns the static labels set on the resource's handler. The
+	// returned map must not be modified.
+	Labels() map[string]string
+
+	// HandlerValue returns the value set for the key on the resource's
+	// handler with the WithValue option, or nil if no value is set.
+	HandlerValue(key interface{}) interface{}
+
 	// ParseQuery parses the query and returns the corresponding values.
 	// It silently discards malformed value pairs.
-	// To check errors use url.ParseQuery(Query()).
+	// To check errors use url.ParseQuery(Query()), or QueryValues on a
+	// request to also respond with system.invalidQuery.
 	ParseQuery() url.Values
 
 	// Value gets the resource value as provided from the Get resource handlers.
@@ -44,6 +59,14 @@ type Resource interface {
 	// Panics if it fails to get the resource value, or no get handler is defined.
 	RequireValue() interface{}
 
+	// WithSibling enqueues the callback, cb, to be called on the worker
+	// goroutine of the resource with resource ID rid, without blocking. If done
+	// is not nil, it is called on this resource's worker goroutine once cb has
+	// returned.
+	// Returns an error, without calling any callback, if there is no matching
+	// handler for rid.
+	WithSibling(rid string, cb func(r Resource), done func()) error
+
 	// Event sends a custom event on the resource.
 	// Will panic if the event is one of the pre-defined or reserved events,
 	// "change", "delete", "add", "remove", "patch", "reaccess", "unsubscribe", or "query".
@@ -104,13 +127,24 @@ type Resource interface {
 
 // resource is the internal implementation of the Resource interface
 type resource struct {
-	rname      string
-	pathParams map[string]string
-	query      string
-	group      string
-	h          Handler
-	listeners  []func(*Event)
-	s          *Service
+	rname         string
+	pathParams    map[string]string
+	params        []pathParam // path parameters used to lazily derive pathParams
+	paramOffset   int         // token index offset of params in the resource name
+	query         string
+	group         string
+	correlation   *correlationID // correlation ID of the request, or nil
+	discardEvents bool           // Events are discarded, as for shadow requests
+	h             Handler
+	listeners     []func(*Event)
+	elisteners    []ErrorListener
+	s             *Service
+}
+
+// CorrelationID returns the ID used to trace the request being handled across
+// services. Empty string if the resource is not part of a request.
+func (r *resource) CorrelationID() string {
+	return r.correlation.String()
 }
 
 // Service returns the service instance
@@ -130,12 +164,15 @@ func (r *resource) ResourceType() ResourceType {
 
 // PathParams returns parameters that are derived from the resource name.
 func (r *resource) PathParams() map[string]string {
+	if r.pathParams == nil && len(r.params) > 0 {
+		r.pathParams = pathParamValues(r.rname, r.params, r.paramOffset)
+	}
 	return r.pathParams
 }
 
 // PathParam returns the parameter derived from the resource name for the key placeholder.
 func (r *resource) PathParam(key string) string {
-	return r.pathParams[key]
+	return r.PathParams()[key]
 }
 
 // Query returns the query part of the resource ID without the question mark separator.
@@ -149,6 +186,16 @@ func (r *resource) Group() string {
 	return r.group
 }
 
+// Labels returns the static labels set on the resource's handler.
+func (r *resource) Labels() map[string]string {
+	return r.h.Labels
+}
+
+// HandlerValue returns the value set for the key on the resource's handler.
+func (r *resource) HandlerValue(key interface{}) interface{} {
+	return r.h.Values[key]
+}
+
 // ParseQuery parses the query and returns the corresponding values.
 // It silently discards malformed value pairs.
 // To check errors use url.ParseQuery.
@@ -176,6 +223,31 @@ func (r *resource) RequireValue() interface{} {
 	return i
 }
 
+// WithSibling enqueues the callback, cb, to be called on the worker goroutine
+// of the resource with resource ID rid, without blocking. If done is not nil,
+// it is called on this resource's worker goroutine once cb has returned.
+//
+// Waiting for cb from within a handler deadlocks if the sibling shares the same
+// group. Using done to continue the work avoids it.
+//
+// Returns an error, without calling any callback, if there is no matching
+// handler for rid.
+func (r *resource) WithSibling(rid string, cb func(r Resource), done func()) error {
+	sr, err := r.s.Resource(rid)
+	if err != nil {
+		return err
+	}
+	sr.(*resource).correlation = r.correlation
+	sr.(*resource).discardEvents = r.discardEvents
+	r.s.runWith(sr.Group(), func() {
+		cb(sr)
+		if done != nil {
+			r.s.runWith(r.Group(), done)
+		}
+	})
+	return nil
+}
+
 // Event sends a custom event on the resource.
 // Will panic if the event is one of the pre-defined or reserved events,
 // "change", "delete", "add", "remove", "patch", "reaccess", "unsubscribe", or "query".
@@ -207,17 +279,21 @@ func (r *resource) Event(event string, payload interface{}) {
 	if !isValidPart(event) {
 		panic(`res: invalid event name`)
 	}
+	if r.discardEvent(event) {
+		return
+	}
 
-	r.s.event("event."+r.rname+"."+event, payload)
-	if r.listeners != nil {
+	r.vetoEvent(func() *Event {
+		return &Event{Name: event, Resource: r, Payload: payload}
+	})
+	r.sendEvent("event."+r.rname+"."+event, payload)
+	if r.hasListeners() {
 		ev := &Event{
 			Name:     event,
 			Resource: r,
 			Payload:  payload,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
@@ -231,9 +307,15 @@ func (r *resource) ChangeEvent(changed map[string]interface{}) {
 	if r.h.Type == TypeCollection {
 		panic("res: change event not allowed on Collections")
 	}
-	if len(changed) == 0 {
+	if len(changed) == 0 || r.discardEvent("change") {
+		return
+	}
+	if changed = r.strictChangeEvent(changed); len(changed) == 0 {
 		return
 	}
+	r.vetoEvent(func() *Event {
+		return &Event{Name: "change", Resource: r, NewValues: changed}
+	})
 	var rev map[string]interface{}
 	var err error
 	if r.h.ApplyChange != nil {
@@ -247,17 +329,21 @@ func (r *resource) ChangeEvent(changed map[string]interface{}) {
 			}
 		}
 	}
-	r.s.event("event."+r.rname+".change", changeEvent{Values: changed})
-	if r.listeners != nil {
+	v := r.incVersion()
+	r.scheduleExpiry()
+	if r.h.Versioned && r.h.VersionProperty != "" {
+		r.sendEvent("event."+r.rname+".change", changeEvent{Values: r.versionChanges(changed, v)})
+	} else {
+		r.sendEvent("event."+r.rname+".change", changeEvent{Values: changed})
+	}
+	if r.hasListeners() {
 		ev := &Event{
 			Name:      "change",
 			Resource:  r,
 			NewValues: changed,
 			OldValues: rev,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
@@ -271,23 +357,30 @@ func (r *resource) AddEvent(v interface{}, idx int) {
 	if idx < 0 {
 		panic("res: add event idx less than zero")
 	}
+	if r.discardEvent("add") {
+		return
+	}
+	r.strictAddEvent(idx)
+	r.vetoEvent(func() *Event {
+		return &Event{Name: "add", Resource: r, Value: v, Idx: idx}
+	})
 	if r.h.ApplyAdd != nil {
 		err := r.h.ApplyAdd(r, v, idx)
 		if err != nil {
 			panic(err)
 		}
 	}
-	r.s.event("event."+r.rname+".add", addEvent{Value: v, Idx: idx})
-	if r.listeners != nil {
+	r.incVersion()
+	r.scheduleExpiry()
+	r.sendEvent("event."+r.rname+".add", addEvent{Value: v, Idx: idx})
+	if r.hasListeners() {
 		ev := &Event{
 			Name:     "add",
 			Resource: r,
 			Value:    v,
 			Idx:      idx,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
@@ -301,6 +394,12 @@ func (r *resource) RemoveEvent(idx int) {
 	if idx < 0 {
 		panic("res: remove event idx less than zero")
 	}
+	if r.discardEvent("remove") {
+		return
+	}
+	r.vetoEvent(func() *Event {
+		return &Event{Name: "remove", Resource: r, Idx: idx}
+	})
 	var err error
 	var v interface{}
 	if r.h.ApplyRemove != nil {
@@ -309,27 +408,36 @@ func (r *resource) RemoveEvent(idx int) {
 			panic(err)
 		}
 	}
-	r.s.event("event."+r.rname+".remove", removeEvent{Idx: idx})
-	if r.listeners != nil {
+	r.incVersion()
+	r.scheduleExpiry()
+	r.sendEvent("event."+r.rname+".remove", removeEvent{Idx: idx})
+	if r.hasListeners() {
 		ev := &Event{
 			Name:     "remove",
 			Resource: r,
 			Value:    v,
 			Idx:      idx,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
 // ReaccessEvent sends a reaccess event.
 func (r *resource) ReaccessEvent() {
+	if r.discardEvent("reaccess") {
+		return
+	}
+	r.s.clearDedup([]string{r.rname})
 	r.s.rawEvent("event."+r.rname+".reaccess", nil)
+	r.syncEvent()
 }
 
 // ResetEvent sends a system.reset event for the specific resource.
 func (r *resource) ResetEvent() {
+	if r.discardEvent("reset") {
+		return
+	}
+	r.incVersion()
 	r.s.Reset([]string{r.ResourceName()}, nil)
 }
 
@@ -337,7 +445,18 @@ func (r *resource) ResetEvent() {
 // provided callback on any query request.
 // The last call to the callback will always be with nil, indicating
 // that the query event duration has expired.
+//
+// If the handler has CoalesceQueryEvents set, the query event is sent once
+// the current work on the resource's worker goroutine is done, and any query
+// events made on the resource before then are coalesced into it.
 func (r *resource) QueryEvent(cb func(QueryRequest)) {
+	if r.discardEvent("query") {
+		cb(nil)
+		return
+	}
+	if r.h.CoalesceQueryEvents && r.s.coalesceQueryEvent(r.rname, cb) {
+		return
+	}
 	qsubj := nats.NewInbox()
 	ch := make(chan *nats.Msg, queryEventChannelSize)
 	sub, err := r.s.nc.ChanSubscribe(qsubj, ch)
@@ -348,43 +467,59 @@ func (r *resource) QueryEvent(cb func(QueryRequest)) {
 	}
 
 	qe := &queryEvent{
-		r:   *r,
-		sub: sub,
-		ch:  ch,
-		cb:  cb,
+		r:    *r,
+		subj: qsubj,
+		sub:  sub,
+		ch:   ch,
+		cbs:  []func(QueryRequest){cb},
 	}
 
-	r.s.event("event."+r.rname+".query", resQueryEvent{Subject: qsubj})
-
-	go qe.startQueryListener()
-
-	r.s.queryTQ.Add(qe)
+	if r.h.CoalesceQueryEvents {
+		r.s.deferQueryEvent(qe)
+		return
+	}
+	qe.send()
 }
 
 // CreateEvent sends a create event for the resource, where data is
 // the created resource data.
 func (r *resource) CreateEvent(data interface{}) {
+	if r.discardEvent("create") {
+		return
+	}
+	r.vetoEvent(func() *Event {
+		return &Event{Name: "create", Resource: r, Data: data}
+	})
 	if r.h.ApplyCreate != nil {
 		err := r.h.ApplyCreate(r, data)
 		if err != nil {
 			panic(err)
 		}
 	}
+	r.incVersion()
+	r.flushThrottled()
 	r.s.rawEvent("event."+r.rname+".create", nil)
-	if r.listeners != nil {
+	r.syncEvent()
+	r.scheduleExpiry()
+	r.resetDependents()
+	if r.hasListeners() {
 		ev := &Event{
 			Name:     "create",
 			Resource: r,
 			Data:     data,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
 // DeleteEvent sends a delete event.
 func (r *resource) DeleteEvent() {
+	if r.discardEvent("delete") {
+		return
+	}
+	r.vetoEvent(func() *Event {
+		return &Event{Name: "delete", Resource: r}
+	})
 	var data interface{}
 	var err error
 	if r.h.ApplyDelete != nil {
@@ -393,16 +528,19 @@ func (r *resource) DeleteEvent() {
 			panic(err)
 		}
 	}
+	r.deleteVersion()
+	r.flushThrottled()
 	r.s.rawEvent("event."+r.rname+".delete", nil)
-	if r.listeners != nil {
+	r.syncEvent()
+	r.cancelExpiry()
+	r.resetDependents()
+	if r.hasListeners() {
 		ev := &Event{
 			Name:     "delete",
 			Resource: r,
 			Data:     data,
 		}
-		for _, cb := range r.listeners {
-			cb(ev)
-		}
+		r.callListeners(ev)
 	}
 }
 
@@ -0,0 +1,70 @@
+package resprot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// maxDecompressedSize is the maximum size of a decompressed response payload.
+const maxDecompressedSize = 64 << 20
+
+// NATS message headers used to negotiate payload compression.
+const (
+	headerContentEncoding = "Content-Encoding"
+	headerAcceptEncoding  = "Accept-Encoding"
+	encodingGzip          = "gzip"
+)
+
+var errDecompressedTooLarge = errors.New("resprot: decompressed payload too large")
+
+// msgPublisher is implemented by connections able to publish messages with
+// headers, such as nats.Conn.
+type msgPublisher interface {
+	PublishMsg(m *nats.Msg) error
+}
+
+// parseCompressedResponse decompresses and unmarshals a response flagged with
+// a Content-Encoding header.
+func parseCompressedResponse(msg *nats.Msg) Response {
+	if enc := msg.Header.Get(headerContentEncoding); enc != encodingGzip {
+		return Response{Error: res.InternalError(errors.New("resprot: unsupported content encoding " + enc))}
+	}
+	data, err := gunzip(msg.Data)
+	if err != nil {
+		return Response{Error: res.InternalError(err)}
+	}
+	return ParseResponse(data)
+}
+
+// gunzip decompresses gzip compressed data, returning an error if it is
+// invalid or exceeds maxDecompressedSize.
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecompressedSize {
+		return nil, errDecompressedTooLarge
+	}
+	return out, nil
+}
+
+// gzipData compresses the data with gzip.
+func gzipData(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	// Writing to a bytes.Buffer never fails.
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	return b.Bytes()
+}
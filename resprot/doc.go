@@ -31,5 +31,13 @@ Call a method:
 		Sum float64 `json:"sum"`
 	}
 	err := response.ParseResult(&result)
+
+Send a connection token event:
+
+	err := resprot.NewTokenEvent(cid, map[string]string{"user": "admin"}).Publish(conn)
+
+Send a gzip compressed request to another go-res service:
+
+	response := resprot.SendCompressedRequest(conn, "get.example.bigmodel", nil, time.Second)
 */
 package resprot
@@ -0,0 +1,198 @@
+package resprot
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/jirenius/go-res"
+)
+
+// Event is an event with a NATS subject and payload, formatted according to
+// the RES Service Protocol. It is created using one of the New...Event
+// functions, and sent using Publish.
+//
+// See:
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#events
+type Event struct {
+	// Subject is the NATS subject of the event.
+	Subject string
+
+	// Payload is the event payload, marshaled into JSON when published. A nil
+	// payload is published as an empty message.
+	Payload interface{}
+}
+
+// ListenerEvent is the JSON representation of a resource event passed to
+// event listeners, used when forwarding events outside of the service.
+type ListenerEvent struct {
+	RID     string                 `json:"rid"`
+	Event   string                 `json:"event"`
+	Changed map[string]interface{} `json:"changed,omitempty"`
+	Value   interface{}            `json:"value,omitempty"`
+	Idx     *int                   `json:"idx,omitempty"`
+	Data    interface{}            `json:"data,omitempty"`
+	Payload interface{}            `json:"payload,omitempty"`
+}
+
+// NewListenerEvent returns the JSON representation of a resource event passed
+// to an event listener. The index is only included for add and remove events.
+func NewListenerEvent(ev *res.Event) ListenerEvent {
+	e := ListenerEvent{
+		RID:     ev.Resource.ResourceName(),
+		Event:   ev.Name,
+		Changed: ev.NewValues,
+		Value:   ev.Value,
+		Data:    ev.Data,
+		Payload: ev.Payload,
+	}
+	if ev.Name == "add" || ev.Name == "remove" {
+		idx := ev.Idx
+		e.Idx = &idx
+	}
+	return e
+}
+
+// TokenResetEvent is the payload of a system token reset event.
+//
+// See:
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-token-reset-event
+type TokenResetEvent struct {
+	TIDs    []string `json:"tids"`
+	Subject string   `json:"subject"`
+}
+
+// NewTokenEvent returns a connection token event that sets the access token of
+// the connection with ID cid. A nil token clears any previously set token.
+//
+// Panics if cid is not a valid connection ID.
+func NewTokenEvent(cid string, token interface{}) Event {
+	return NewTokenEventWithID(cid, "", token)
+}
+
+// NewTokenEventWithID returns a connection token event in the same way as
+// NewTokenEvent, but includes a token ID (tid). An empty token ID is omitted.
+//
+// Panics if cid is not a valid connection ID.
+func NewTokenEventWithID(cid string, tid string, token interface{}) Event {
+	// A connection ID is a single subject token.
+	if strings.ContainsAny(cid, ".?") || !res.IsValidRID(cid) {
+		panic("resprot: invalid connection ID: " + cid)
+	}
+	return Event{
+		Subject: "conn." + cid + ".token",
+		Payload: TokenEvent{Token: token, TID: tid},
+	}
+}
+
+// NewResetEvent returns a system reset event for the resource and access
+// patterns.
+//
+// See:
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-reset-event
+func NewResetEvent(resources []string, access []string) Event {
+	if len(resources) == 0 {
+		resources = nil
+	}
+	if len(access) == 0 {
+		access = nil
+	}
+	return Event{
+		Subject: "system.reset",
+		Payload: ResetEvent{Resources: resources, Access: access},
+	}
+}
+
+// NewTokenResetEvent returns a system token reset event for the token IDs,
+// where subject is the subject that will receive auth requests for any
+// connection with a token matching any of the token IDs.
+//
+// Panics if subject is empty.
+func NewTokenResetEvent(subject string, tids ...string) Event {
+	if subject == "" {
+		panic("resprot: empty token reset subject")
+	}
+	if tids == nil {
+		tids = []string{}
+	}
+	return Event{
+		Subject: "system.tokenReset",
+		Payload: TokenResetEvent{TIDs: tids, Subject: subject},
+	}
+}
+
+// NewChangeEvent returns a model change event for the resource with the
+// resource name rname, where values contains the changed properties.
+//
+// Panics if rname is not a valid resource name.
+func NewChangeEvent(rname string, values map[string]interface{}) Event {
+	return newResourceEvent(rname, "change", ChangeEvent{Values: values})
+}
+
+// NewAddEvent returns a collection add event for the resource with the
+// resource name rname, adding the value at index idx.
+//
+// Panics if rname is not a valid resource name, or if idx is less than zero.
+func NewAddEvent(rname string, value interface{}, idx int) Event {
+	if idx < 0 {
+		panic("resprot: add event idx less than zero")
+	}
+	return newResourceEvent(rname, "add", AddEvent{Value: value, Idx: idx})
+}
+
+// NewRemoveEvent returns a collection remove event for the resource with the
+// resource name rname, removing the value at index idx.
+//
+// Panics if rname is not a valid resource name, or if idx is less than zero.
+func NewRemoveEvent(rname string, idx int) Event {
+	if idx < 0 {
+		panic("resprot: remove event idx less than zero")
+	}
+	return newResourceEvent(rname, "remove", RemoveEvent{Idx: idx})
+}
+
+// NewReaccessEvent returns a reaccess event for the resource with the resource
+// name rname.
+//
+// Panics if rname is not a valid resource name.
+func NewReaccessEvent(rname string) Event {
+	return newResourceEvent(rname, "reaccess", nil)
+}
+
+// NewCustomEvent returns a custom event with the name event for the resource
+// with the resource name rname.
+//
+// Panics if rname is not a valid resource name, or if event is not a valid
+// custom event name, such as the pre-defined or reserved events "change",
+// "delete", "add", "remove", "patch", "reaccess", "unsubscribe", or "query".
+// Use the matching constructor for pre-defined events instead.
+func NewCustomEvent(rname string, event string, payload interface{}) Event {
+	if !res.IsValidEventName(event) {
+		panic("resprot: invalid event name: " + event)
+	}
+	return newResourceEvent(rname, event, payload)
+}
+
+// Publish marshals the event payload and publishes it on the connection.
+func (ev Event) Publish(nc res.Conn) error {
+	var data []byte
+	if ev.Payload != nil {
+		var err error
+		data, err = json.Marshal(ev.Payload)
+		if err != nil {
+			return err
+		}
+	}
+	return nc.Publish(ev.Subject, data)
+}
+
+// newResourceEvent returns an event on the resource, panicking if rname is not
+// a valid resource name.
+func newResourceEvent(rname string, event string, payload interface{}) Event {
+	if strings.IndexByte(rname, '?') != -1 || !res.IsValidRID(rname) {
+		panic("resprot: invalid resource name: " + rname)
+	}
+	return Event{
+		Subject: "event." + rname + "." + event,
+		Payload: payload,
+	}
+}
@@ -14,6 +14,7 @@ import (
 var (
 	errInvalidResponse           = errors.New("invalid response")
 	errResourceResponse          = errors.New("response is a resource response")
+	errResultResponse            = errors.New("response is not a resource response")
 	errInvalidModelResponse      = errors.New("invalid model response")
 	errInvalidCollectionResponse = errors.New("invalid collection response")
 )
@@ -90,6 +91,9 @@ type Request struct {
 type Response struct {
 
 	// Result is the successful result of a request.
+	//
+	// For responses to call and auth requests, it may accompany a resource
+	// reference.
 	Result json.RawMessage `json:"result"`
 
 	// Resource is a reference to a resource.
@@ -243,6 +247,30 @@ func (r Response) ParseResult(v interface{}) error {
 	return nil
 }
 
+// ParseResourceResult returns the resource reference from the response of a
+// successful call or auth request, and unmarshals any accompanying result
+// into v. A nil v ignores the result.
+//
+// Returns an error if the response is not a resource response.
+func (r Response) ParseResourceResult(v interface{}) (res.Ref, error) {
+	if r.Error != nil {
+		return "", r.Error
+	}
+
+	if r.Resource == "" {
+		return "", errResultResponse
+	}
+
+	if v != nil && len(r.Result) > 0 {
+		err := json.Unmarshal(r.Result, v)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return r.Resource, nil
+}
+
 // AccessResult is the result of an access request.
 //
 // See:
@@ -250,6 +278,10 @@ func (r Response) ParseResult(v interface{}) error {
 type AccessResult struct {
 	Get  bool   `json:"get,omitempty"`
 	Call string `json:"call,omitempty"`
+
+	// Duration is a hint of the number of milliseconds the access result may
+	// be cached. Zero means no hint is given.
+	Duration int64 `json:"duration,omitempty"`
 }
 
 // GetResult is the result of a get request.
@@ -277,6 +309,7 @@ type ResetEvent struct {
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#connection-token-event
 type TokenEvent struct {
 	Token interface{} `json:"token"`
+	TID   string      `json:"tid,omitempty"`
 }
 
 // ChangeEvent is the payload of a model change event.
@@ -344,20 +377,69 @@ type QueryResult struct {
 // SendRequest handles pre-responses that may extend timeout. See:
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#pre-response
 func SendRequest(nc res.Conn, subject string, req interface{}, timeout time.Duration, onTimeoutExtend ...func(time.Duration)) Response {
-	var r Response
+	data, err := marshalRequest(req)
+	if err != nil {
+		return Response{Error: res.InternalError(err)}
+	}
+	return sendRequest(nc, subject, data, timeout, onTimeoutExtend)
+}
 
-	// Marshal the request
-	var data []byte
-	if req != nil {
-		dta, err := json.Marshal(req)
-		if err != nil {
-			r.Error = res.InternalError(err)
-			return r
-		}
-		data = dta
-	} else {
-		data = emptyRequest
+// SendCompressedRequest sends a gzip compressed request over NATS and
+// unmarshals the response before returning it.
+//
+// The request is flagged as compressed with the NATS message header
+// "Content-Encoding: gzip", and accepts a compressed response with the header
+// "Accept-Encoding: gzip". The receiving service must be able to decompress
+// the request, which all go-res services are. A response flagged as
+// compressed is decompressed before being parsed. If the connection does not
+// support publishing messages with headers, as nats.Conn does, the request is
+// sent uncompressed. In all other aspects, it behaves as SendRequest.
+//
+// Compression reduces NATS bandwidth for requests and responses with large
+// payloads, such as when transferring large models between services. It must
+// not be used for requests to services not built with go-res.
+func SendCompressedRequest(nc res.Conn, subject string, req interface{}, timeout time.Duration, onTimeoutExtend ...func(time.Duration)) Response {
+	data, err := marshalRequest(req)
+	if err != nil {
+		return Response{Error: res.InternalError(err)}
 	}
+	mp, ok := nc.(msgPublisher)
+	if !ok {
+		return sendRequest(nc, subject, data, timeout, onTimeoutExtend)
+	}
+	return sendRequestWith(nc, func(inbox string) error {
+		return mp.PublishMsg(&nats.Msg{
+			Subject: subject,
+			Reply:   inbox,
+			Header: nats.Header{
+				headerContentEncoding: []string{encodingGzip},
+				headerAcceptEncoding:  []string{encodingGzip},
+			},
+			Data: gzipData(data),
+		})
+	}, timeout, onTimeoutExtend)
+}
+
+// marshalRequest marshals the request, or returns an empty json object if req
+// is nil.
+func marshalRequest(req interface{}) ([]byte, error) {
+	if req == nil {
+		return emptyRequest, nil
+	}
+	return json.Marshal(req)
+}
+
+// sendRequest sends the request payload over NATS and waits for the response.
+func sendRequest(nc res.Conn, subject string, data []byte, timeout time.Duration, onTimeoutExtend []func(time.Duration)) Response {
+	return sendRequestWith(nc, func(inbox string) error {
+		return nc.PublishRequest(subject, inbox, data)
+	}, timeout, onTimeoutExtend)
+}
+
+// sendRequestWith calls publish with a response inbox to send the request,
+// and waits for the response.
+func sendRequestWith(nc res.Conn, publish func(inbox string) error, timeout time.Duration, onTimeoutExtend []func(time.Duration)) Response {
+	var r Response
 
 	// Manually create a response inbox
 	inbox := nats.NewInbox()
@@ -372,7 +454,7 @@ func SendRequest(nc res.Conn, subject string, req interface{}, timeout time.Dura
 	defer sub.Unsubscribe()
 
 	// Publish request
-	err = nc.PublishRequest(subject, inbox, data)
+	err = publish(inbox)
 	if err != nil {
 		r.Error = res.InternalError(err)
 		return r
@@ -389,6 +471,9 @@ func SendRequest(nc res.Conn, subject string, req interface{}, timeout time.Dura
 		case msg := <-ch:
 			// Is the first character a-z or A-Z?
 			// Then it is a pre-response.
+			if msg.Header.Get(headerContentEncoding) != "" {
+				return parseCompressedResponse(msg)
+			}
 			if len(msg.Data) == 0 || (msg.Data[0]|32) < 'a' || (msg.Data[0]|32) > 'z' {
 				return ParseResponse(msg.Data)
 			}
@@ -412,6 +497,48 @@ func SendRequest(nc res.Conn, subject string, req interface{}, timeout time.Dura
 	}
 }
 
+// SendCommand sends a request over NATS without a reply subject, and returns
+// without waiting for any response. It is used for fire-and-forget call
+// requests between internal services. The receiving service must allow them,
+// such as with Service.SetFireAndForgetCalls for go-res services.
+//
+// if req is nil, an empty json object, {}, will be sent as payload instead.
+func SendCommand(nc res.Conn, subject string, req interface{}) error {
+	data, err := marshalRequest(req)
+	if err != nil {
+		return err
+	}
+	return nc.Publish(subject, data)
+}
+
+// SendCorrelatedRequest sends a request over NATS using the connection of the
+// service handling the resource, r, and unmarshals the response before
+// returning it.
+//
+// The correlation ID of r is propagated in the message header
+// "Correlation-Id", to make the request traceable across services. In all
+// other aspects, it behaves as SendRequest.
+func SendCorrelatedRequest(r res.Resource, subject string, req Request, timeout time.Duration, onTimeoutExtend ...func(time.Duration)) Response {
+	nc := r.Service().Conn()
+	id := r.CorrelationID()
+	mp, ok := nc.(msgPublisher)
+	if id == "" || !ok {
+		return SendRequest(nc, subject, req, timeout, onTimeoutExtend...)
+	}
+	data, err := marshalRequest(req)
+	if err != nil {
+		return Response{Error: res.InternalError(err)}
+	}
+	return sendRequestWith(nc, func(inbox string) error {
+		return mp.PublishMsg(&nats.Msg{
+			Subject: subject,
+			Reply:   inbox,
+			Header:  nats.Header{res.HeaderCorrelationID: []string{id}},
+			Data:    data,
+		})
+	}, timeout, onTimeoutExtend)
+}
+
 // UnmarshalDataValue parses the JSON-encoded data and stores the result in the value pointed to by v, similar to json.Unmarshal.
 //
 // If the JSON data starts with an object, UnmarshalDataValue will use the value of the object key "data" to store in v, or will return an error if the object key "data" does not exist.
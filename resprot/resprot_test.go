@@ -1,14 +1,18 @@
 package resprot_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/jirenius/go-res"
 	"github.com/jirenius/go-res/resprot"
 	"github.com/jirenius/go-res/restest"
+	nats "github.com/nats-io/nats.go"
 )
 
 // Test disabled as it might connect to an actual nats instance
@@ -99,6 +103,15 @@ func TestSendRequest_DifferentPayload_SendsExpectedPayload(t *testing.T) {
 	}
 }
 
+func TestSendCommand_WithPayload_PublishesWithoutReply(t *testing.T) {
+	conn := restest.NewMockConn(t, nil)
+	restest.AssertNoError(t, resprot.SendCommand(conn, "call.test.method", json.RawMessage(`{"foo":"bar"}`)))
+	msg := conn.GetMsg().
+		AssertSubject("call.test.method").
+		AssertPayload(json.RawMessage(`{"foo":"bar"}`))
+	restest.AssertEqualJSON(t, "reply subject", msg.Reply, "")
+}
+
 func TestSendRequest_WithBrokenJSON_ReturnsError(t *testing.T) {
 	conn := restest.NewMockConn(t, nil)
 	response := resprot.SendRequest(conn, "call.test.method", json.RawMessage(`[broken}`), time.Second)
@@ -184,6 +197,61 @@ func TestSendRequest_WithResourceResponse_ReturnsResource(t *testing.T) {
 	}
 }
 
+func TestParseResourceResult_WithResourceResponse_ReturnsResourceAndResult(t *testing.T) {
+	table := []struct {
+		ResponsePayload []byte
+		Expected        res.Ref
+		ExpectedResult  interface{}
+	}{
+		{[]byte(`{"resource":{"rid":"test.model"}}`), "test.model", nil},
+		{[]byte(`{"resource":{"rid":"test.model"},"result":null}`), "test.model", nil},
+		{[]byte(`{"resource":{"rid":"test.model"},"result":"foo"}`), "test.model", "foo"},
+		{[]byte(`{"resource":{"rid":"test.model"},"result":{"foo":42}}`), "test.model", json.RawMessage(`{"foo":42}`)},
+	}
+
+	for i, l := range table {
+		l := l
+		ctx := fmt.Sprintf("test #%d", i+1)
+		conn := restest.NewMockConn(t, nil)
+		go func() {
+			msg := conn.GetMsg()
+			conn.RequestRaw(msg.Reply, l.ResponsePayload)
+		}()
+
+		response := resprot.SendRequest(conn, "call.test.method", nil, time.Second)
+
+		var result interface{}
+		rid, err := response.ParseResourceResult(&result)
+		restest.AssertNoError(t, err, ctx)
+		restest.AssertEqualJSON(t, "parsed resource", rid, l.Expected, ctx)
+		restest.AssertEqualJSON(t, "parsed result", result, l.ExpectedResult, ctx)
+	}
+}
+
+func TestParseResourceResult_WithoutResourceResponse_ReturnsError(t *testing.T) {
+	table := []struct {
+		ResponsePayload []byte
+	}{
+		{[]byte(`{"result":"foo"}`)},
+		{[]byte(`{"error":{"code":"custom.error","message":"Custom error"}}`)},
+	}
+
+	for i, l := range table {
+		l := l
+		ctx := fmt.Sprintf("test #%d", i+1)
+		conn := restest.NewMockConn(t, nil)
+		go func() {
+			msg := conn.GetMsg()
+			conn.RequestRaw(msg.Reply, l.ResponsePayload)
+		}()
+
+		response := resprot.SendRequest(conn, "call.test.method", nil, time.Second)
+
+		_, err := response.ParseResourceResult(nil)
+		restest.AssertTrue(t, "ParseResourceResult to return an error", err != nil, ctx)
+	}
+}
+
 func TestParseResult_WithResultResponse_ReturnsResult(t *testing.T) {
 	table := []struct {
 		ResponsePayload []byte
@@ -590,3 +658,135 @@ func TestMarshalDataValue_WithInvalidValue_ReturnsError(t *testing.T) {
 	restest.AssertError(t, err)
 	restest.AssertNil(t, data)
 }
+
+func TestSendCorrelatedRequest_WithinHandler_PropagatesCorrelationID(t *testing.T) {
+	rs := res.NewService("test")
+	rs.Handle("model", res.Call("proxy", func(r res.CallRequest) {
+		response := resprot.SendCorrelatedRequest(r, "call.other.ping", resprot.Request{}, time.Second)
+		if response.HasError() {
+			r.Error(response.Error)
+			return
+		}
+		r.OK(nil)
+	}))
+	s := restest.NewSession(t, rs)
+	defer s.Close()
+
+	inb := s.RequestRawWithHeader("call.test.model.proxy", nats.Header{res.HeaderCorrelationID: {"abc"}}, []byte(`{}`))
+	msg := s.GetMsg().
+		AssertSubject("call.other.ping").
+		AssertPayload(json.RawMessage(`{}`))
+	restest.AssertEqualJSON(t, "Correlation-Id", msg.Header.Get(res.HeaderCorrelationID), "abc")
+	s.RequestRaw(msg.Reply, []byte(`{"result":null}`))
+	s.GetMsg().AssertSubject(inb).AssertResult(nil)
+}
+
+func TestSendCompressedRequest_DecompressesResponse(t *testing.T) {
+	conn := restest.NewMockConn(t, nil)
+	go func() {
+		msg := conn.GetMsg().AssertSubject("call.math.add")
+		restest.AssertEqualJSON(t, "Content-Encoding", msg.Header.Get("Content-Encoding"), "gzip")
+		restest.AssertEqualJSON(t, "Accept-Encoding", msg.Header.Get("Accept-Encoding"), "gzip")
+		zr, err := gzip.NewReader(bytes.NewReader(msg.Data))
+		restest.AssertNoError(t, err)
+		data, err := io.ReadAll(zr)
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "request", json.RawMessage(data), json.RawMessage(`{"params":{"a":5,"b":6}}`))
+
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write([]byte(`{"result":{"sum":11}}`))
+		zw.Close()
+		conn.RequestRawWithHeader(msg.Reply, nats.Header{"Content-Encoding": {"gzip"}}, b.Bytes())
+	}()
+
+	response := resprot.SendCompressedRequest(conn, "call.math.add", resprot.Request{Params: struct {
+		A float64 `json:"a"`
+		B float64 `json:"b"`
+	}{5, 6}}, time.Second)
+
+	var result struct {
+		Sum float64 `json:"sum"`
+	}
+	err := response.ParseResult(&result)
+
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "result", result, json.RawMessage(`{"sum":11}`))
+}
+
+func TestNewEvents(t *testing.T) {
+	tbl := []struct {
+		Event           resprot.Event
+		ExpectedSubject string
+		ExpectedPayload json.RawMessage
+	}{
+		{resprot.NewTokenEvent("cid1", map[string]string{"user": "jane"}), "conn.cid1.token", json.RawMessage(`{"token":{"user":"jane"}}`)},
+		{resprot.NewTokenEvent("cid1", nil), "conn.cid1.token", json.RawMessage(`{"token":null}`)},
+		{resprot.NewTokenEventWithID("cid1", "tid1", "foo"), "conn.cid1.token", json.RawMessage(`{"token":"foo","tid":"tid1"}`)},
+		{resprot.NewResetEvent([]string{"test.>"}, nil), "system.reset", json.RawMessage(`{"resources":["test.>"]}`)},
+		{resprot.NewResetEvent([]string{}, []string{"test.>"}), "system.reset", json.RawMessage(`{"access":["test.>"]}`)},
+		{resprot.NewTokenResetEvent("auth.test.refresh", "tid1", "tid2"), "system.tokenReset", json.RawMessage(`{"tids":["tid1","tid2"],"subject":"auth.test.refresh"}`)},
+		{resprot.NewChangeEvent("test.model", map[string]interface{}{"foo": 42, "bar": res.DeleteAction}), "event.test.model.change", json.RawMessage(`{"values":{"foo":42,"bar":{"action":"delete"}}}`)},
+		{resprot.NewAddEvent("test.collection", res.Ref("test.model"), 1), "event.test.collection.add", json.RawMessage(`{"value":{"rid":"test.model"},"idx":1}`)},
+		{resprot.NewRemoveEvent("test.collection", 0), "event.test.collection.remove", json.RawMessage(`{"idx":0}`)},
+		{resprot.NewCustomEvent("test.model", "foo", map[string]int{"bar": 42}), "event.test.model.foo", json.RawMessage(`{"bar":42}`)},
+	}
+
+	for i, l := range tbl {
+		ctx := fmt.Sprintf("test #%d", i+1)
+		conn := restest.NewMockConn(t, nil)
+		restest.AssertNoError(t, l.Event.Publish(conn), ctx)
+		conn.GetMsg().
+			AssertSubject(l.ExpectedSubject).
+			AssertPayload(l.ExpectedPayload)
+	}
+}
+
+func TestNewReaccessEvent_PublishesEmptyPayload(t *testing.T) {
+	conn := restest.NewMockConn(t, nil)
+	restest.AssertNoError(t, resprot.NewReaccessEvent("test.model").Publish(conn))
+	msg := conn.GetMsg().AssertSubject("event.test.model.reaccess")
+	restest.AssertTrue(t, "payload to be empty", len(msg.Data) == 0)
+}
+
+func TestNewEvents_WithInvalidArguments_Panics(t *testing.T) {
+	tbl := []func(){
+		func() { resprot.NewTokenEvent("", nil) },
+		func() { resprot.NewTokenEvent("foo.bar", nil) },
+		func() { resprot.NewTokenResetEvent("", "tid1") },
+		func() { resprot.NewChangeEvent("test.model?q=foo", nil) },
+		func() { resprot.NewChangeEvent("test..model", nil) },
+		func() { resprot.NewAddEvent("test.collection", nil, -1) },
+		func() { resprot.NewRemoveEvent("test.collection", -1) },
+		func() { resprot.NewCustomEvent("test.model", "foo.bar", nil) },
+		func() { resprot.NewCustomEvent("test.model", "change", nil) },
+		func() { resprot.NewCustomEvent("test.model", "add", nil) },
+		func() { resprot.NewCustomEvent("test.model", "remove", nil) },
+		func() { resprot.NewCustomEvent("test.model", "delete", nil) },
+		func() { resprot.NewCustomEvent("test.model", "reaccess", nil) },
+		func() { resprot.NewCustomEvent("test.model", "unsubscribe", nil) },
+		func() { resprot.NewCustomEvent("test.model", "query", nil) },
+		func() { resprot.NewCustomEvent("test.model", "patch", nil) },
+	}
+	for i, f := range tbl {
+		restest.AssertPanic(t, f, fmt.Sprintf("test #%d", i+1))
+	}
+}
+
+func TestSendCompressedRequest_ResponseExceedingMaxSize_ReturnsError(t *testing.T) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(bytes.Repeat([]byte(" "), 65<<20))
+	zw.Close()
+
+	conn := restest.NewMockConn(t, nil)
+	go func() {
+		msg := conn.GetMsg().AssertSubject("call.math.add")
+		conn.RequestRawWithHeader(msg.Reply, nats.Header{"Content-Encoding": {"gzip"}}, b.Bytes())
+	}()
+
+	response := resprot.SendCompressedRequest(conn, "call.math.add", nil, time.Second)
+
+	restest.AssertTrue(t, "response to have error", response.HasError())
+	restest.AssertEqualJSON(t, "error code", response.Error.Code, res.CodeInternalError)
+}
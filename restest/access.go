@@ -0,0 +1,93 @@
+package restest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	res "github.com/jirenius/go-res"
+)
+
+// AccessCase is an entry in an AccessMatrix, describing the access expected
+// for a token to a resource.
+type AccessCase struct {
+	// Token is the token sent with the access request. Nil means no token.
+	Token interface{}
+	// RID is the resource ID, which may contain a query part.
+	RID string
+	// Get is the expected get access.
+	Get bool
+	// Call is the expected call access, such as "set,delete" or "*".
+	Call string
+}
+
+// AccessMatrix is a table of access cases, asserted with
+// Session.AssertAccessMatrix:
+//
+//	admin := map[string]string{"role": "admin"}
+//	guest := map[string]string{"role": "guest"}
+//	c.AssertAccessMatrix(restest.AccessMatrix{
+//		{Token: admin, RID: "example.model", Get: true, Call: "*"},
+//		{Token: guest, RID: "example.model", Get: true},
+//		{Token: nil, RID: "example.model"},
+//	})
+type AccessMatrix []AccessCase
+
+// AssertAccessMatrix sends an access request for each case in the matrix, and
+// asserts that the responses match the expected access. An access denied
+// error is treated as no get or call access. All cases are sent before
+// failing, and any mismatches are logged as a single fatal error listing each
+// failing case.
+func (s *Session) AssertAccessMatrix(m AccessMatrix) *Session {
+	var failures []string
+	for i, ac := range m {
+		req := DefaultAccessRequest()
+		if ac.Token != nil {
+			req.Token = MockToken(ac.Token)
+		}
+		msg := s.Access(ac.RID, req).Response()
+		get, call, err := accessResult(msg)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("#%d token %s on %s: expected get=%t call=%q, but got error: %s", i+1, formatToken(req.Token), ac.RID, ac.Get, ac.Call, err))
+		} else if get != ac.Get || call != ac.Call {
+			failures = append(failures, fmt.Sprintf("#%d token %s on %s: expected get=%t call=%q, but got get=%t call=%q", i+1, formatToken(req.Token), ac.RID, ac.Get, ac.Call, get, call))
+		}
+	}
+	if len(failures) > 0 {
+		s.t.Fatalf("access matrix failed for %d of %d cases:\n\t%s", len(failures), len(m), strings.Join(failures, "\n\t"))
+	}
+	return s
+}
+
+// accessResult returns the get and call access of an access response. An
+// access denied error results in no access, while any other error is
+// returned.
+func accessResult(m *Msg) (bool, string, error) {
+	var r struct {
+		Result *struct {
+			Get  bool   `json:"get"`
+			Call string `json:"call"`
+		} `json:"result"`
+		Error *res.Error `json:"error"`
+	}
+	if err := json.Unmarshal(m.Data, &r); err != nil {
+		return false, "", err
+	}
+	if r.Error != nil {
+		if r.Error.Code == res.CodeAccessDenied {
+			return false, "", nil
+		}
+		return false, "", r.Error
+	}
+	if r.Result == nil {
+		return false, "", fmt.Errorf("invalid access response: %s", m.Data)
+	}
+	return r.Result.Get, r.Result.Call, nil
+}
+
+func formatToken(token json.RawMessage) string {
+	if token == nil {
+		return "<none>"
+	}
+	return string(token)
+}
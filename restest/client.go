@@ -0,0 +1,135 @@
+package restest
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+)
+
+var cidCounter uint64
+
+// NewCID returns a new mock connection ID, unique within the test binary.
+func NewCID() string {
+	return "mockcid" + strconv.FormatUint(atomic.AddUint64(&cidCounter, 1), 10)
+}
+
+// MockToken returns the JSON encoding of the token, to use as the Token of a
+// Request. Panics if the token cannot be marshaled.
+func MockToken(token interface{}) json.RawMessage {
+	data, err := json.Marshal(token)
+	if err != nil {
+		panic("test: error marshaling token: " + err.Error())
+	}
+	return data
+}
+
+// Client simulates a client connection through a gateway, sending requests
+// with the same connection ID, and with any token set by a connection token
+// event, as Resgate would do.
+//
+//	cl := s.NewClient()
+//	cl.Login("test.auth", "login", map[string]string{"user": "foo"}).
+//		AssertResult(nil)
+//	cl.Call("test.model", "set", nil).
+//		Response().
+//		AssertResult(nil)
+type Client struct {
+	c     *MockConn
+	cid   string
+	token json.RawMessage
+}
+
+// NewClient returns a new Client with a connection ID created by NewCID, and
+// no token.
+func (c *MockConn) NewClient() *Client {
+	return &Client{c: c, cid: NewCID()}
+}
+
+// CID returns the client's connection ID.
+func (cl *Client) CID() string {
+	return cl.cid
+}
+
+// Token returns the client's current token, or nil if no token is set.
+func (cl *Client) Token() json.RawMessage {
+	return cl.token
+}
+
+// SetToken sets the client's token. A nil token clears it.
+func (cl *Client) SetToken(token interface{}) *Client {
+	if token == nil {
+		cl.token = nil
+	} else {
+		cl.token = MockToken(token)
+	}
+	return cl
+}
+
+// Call sends a call request to the service, with the client's connection ID
+// and token. The params are marshaled into the request unless nil.
+func (cl *Client) Call(rid string, method string, params interface{}) *NATSRequest {
+	return cl.c.Call(rid, method, cl.request(DefaultCallRequest(), params))
+}
+
+// Auth sends an auth request to the service, with the client's connection ID
+// and token. The params are marshaled into the request unless nil.
+func (cl *Client) Auth(rid string, method string, params interface{}) *NATSRequest {
+	return cl.c.Auth(rid, method, cl.request(DefaultAuthRequest(), params))
+}
+
+// Access sends an access request to the service, with the client's connection
+// ID and token.
+func (cl *Client) Access(rid string) *NATSRequest {
+	return cl.c.Access(rid, cl.request(DefaultAccessRequest(), nil))
+}
+
+// request sets the client's connection ID and token, and any params, on the
+// request r.
+func (cl *Client) request(r *Request, params interface{}) *Request {
+	r.CID = cl.cid
+	r.Token = cl.token
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			panic("test: error marshaling params: " + err.Error())
+		}
+		r.Params = data
+	}
+	return r
+}
+
+// Login sends an auth request to the service, and returns the response. Any
+// connection token event for the client sent before the response is captured,
+// and the token is used in subsequent requests by the client.
+//
+// If any other message is received before the response, it will log it as a
+// fatal error.
+func (cl *Client) Login(rid string, method string, params interface{}) *Msg {
+	req := cl.Auth(rid, method, params)
+	for {
+		m := cl.c.GetMsg()
+		if m.Subject == req.inb {
+			return m
+		}
+		m.AssertSubject("conn." + cl.cid + ".token")
+		cl.CaptureToken(m)
+	}
+}
+
+// CaptureToken sets the client's token to the token of a connection token
+// event message for the client. It will log a fatal error if the message is
+// not a token event for the client.
+func (cl *Client) CaptureToken(m *Msg) *Client {
+	m.AssertSubject("conn." + cl.cid + ".token")
+	var ev struct {
+		Token json.RawMessage `json:"token"`
+	}
+	if err := json.Unmarshal(m.Data, &ev); err != nil {
+		cl.c.t.Fatalf("error unmarshaling token event: %s", err)
+	}
+	if string(ev.Token) == "null" {
+		ev.Token = nil
+	}
+	cl.token = ev.Token
+	return cl
+}
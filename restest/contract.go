@@ -0,0 +1,391 @@
+package restest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// DefaultContractTimeout is the default duration a ContractRecorder waits for a
+// response to a recorded request.
+const DefaultContractTimeout = 5 * time.Second
+
+// Contract is a consumer-driven contract, holding the requests a consumer
+// makes to a provider service, and the responses it relies on.
+type Contract struct {
+	Consumer     string        `json:"consumer,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request made by a consumer, and the response it received.
+//
+// The response is used as the expected response shape when verifying the
+// provider. A provider satisfies the interaction if its response has the same
+// error code, or if it has all the properties of the recorded response, with
+// the same JSON types. Additional properties are allowed.
+type Interaction struct {
+	Subject  string          `json:"subject"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// ContractRecorder is a res.Conn that records the requests sent over the
+// underlying connection, together with their responses, into a Contract.
+//
+// It is used by consumers to record the requests made using the resprot
+// package:
+//
+//	rec := restest.NewContractRecorder(nc, "consumer")
+//	resprot.SendRequest(rec, "call.library.book.42.set", req, timeout)
+//	rec.Contract().WriteFile("testdata/library.contract.json")
+//
+// A response not received within the timeout, extended by any pre-response,
+// is not recorded.
+type ContractRecorder struct {
+	nc       res.Conn
+	consumer string
+	timeout  time.Duration
+	mu       sync.Mutex
+	pending  map[string]int // Reply inbox to interaction index
+	contract Contract
+	done     chan struct{}
+	closed   bool
+}
+
+// NewContractRecorder returns a new ContractRecorder sending messages over the
+// connection nc, recording a contract for the consumer.
+func NewContractRecorder(nc res.Conn, consumer string) *ContractRecorder {
+	return &ContractRecorder{
+		nc:       nc,
+		consumer: consumer,
+		timeout:  DefaultContractTimeout,
+		pending:  make(map[string]int),
+		contract: Contract{Consumer: consumer, Interactions: []Interaction{}},
+		done:     make(chan struct{}),
+	}
+}
+
+// SetTimeout sets the duration to wait for a response to a recorded request.
+// It should be no shorter than the timeout used when sending the requests.
+// Default is DefaultContractTimeout.
+func (rec *ContractRecorder) SetTimeout(d time.Duration) *ContractRecorder {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.timeout = d
+	return rec
+}
+
+// Contract returns a copy of the contract recorded so far. Requests without a
+// received response are excluded.
+func (rec *ContractRecorder) Contract() Contract {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	c := Contract{Consumer: rec.consumer, Interactions: []Interaction{}}
+	for _, ia := range rec.contract.Interactions {
+		if ia.Response != nil {
+			c.Interactions = append(c.Interactions, ia)
+		}
+	}
+	return c
+}
+
+// Publish publishes the data argument to the given subject.
+func (rec *ContractRecorder) Publish(subject string, payload []byte) error {
+	return rec.nc.Publish(subject, payload)
+}
+
+// PublishRequest publishes a request expecting a response on the reply
+// subject, and records the request.
+func (rec *ContractRecorder) PublishRequest(subject, reply string, data []byte) error {
+	if req, ok := contractPayload(data, nil); ok {
+		rec.mu.Lock()
+		rec.pending[reply] = len(rec.contract.Interactions)
+		rec.contract.Interactions = append(rec.contract.Interactions, Interaction{
+			Subject: subject,
+			Request: req,
+		})
+		rec.mu.Unlock()
+	}
+	return rec.nc.PublishRequest(subject, reply, data)
+}
+
+// ChanSubscribe subscribes to messages matching the subject pattern. Responses
+// to recorded requests are recorded before being passed to ch.
+func (rec *ContractRecorder) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	ich := make(chan *nats.Msg, cap(ch))
+	sub, err := rec.nc.ChanSubscribe(subject, ich)
+	if err != nil {
+		return nil, err
+	}
+	rec.mu.Lock()
+	timeout := rec.timeout
+	rec.mu.Unlock()
+	go rec.forward(subject, ich, ch, timeout)
+	return sub, nil
+}
+
+// ChanQueueSubscribe subscribes to messages matching the subject pattern.
+func (rec *ContractRecorder) ChanQueueSubscribe(subject, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return rec.nc.ChanQueueSubscribe(subject, queue, ch)
+}
+
+// Close stops recording and closes the underlying connection.
+func (rec *ContractRecorder) Close() {
+	rec.mu.Lock()
+	if !rec.closed {
+		rec.closed = true
+		close(rec.done)
+	}
+	rec.mu.Unlock()
+	rec.nc.Close()
+}
+
+// forward passes messages from ich to ch until the recorder is closed, a
+// response to a recorded request is received, or no response is received
+// within the timeout. Pre-responses may extend the timeout.
+func (rec *ContractRecorder) forward(subject string, ich chan *nats.Msg, ch chan *nats.Msg, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer func() {
+		timer.Stop()
+		rec.mu.Lock()
+		delete(rec.pending, subject)
+		rec.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-rec.done:
+			return
+		case <-timer.C:
+			return
+		case msg := <-ich:
+			// Pre-responses start with a letter, and are passed through.
+			if len(msg.Data) > 0 && (msg.Data[0]|32) >= 'a' && (msg.Data[0]|32) <= 'z' {
+				if d, ok := preResponseTimeout(msg.Data); ok && d > timeout {
+					timer.Stop()
+					timer = time.NewTimer(d)
+				}
+				if !rec.pass(ch, msg, timer.C) {
+					return
+				}
+				continue
+			}
+			final := rec.recordResponse(msg)
+			if !rec.pass(ch, msg, timer.C) || final {
+				return
+			}
+		}
+	}
+}
+
+// pass sends the message to ch, and returns true, unless the recorder is
+// closed or the timeout channel fires before ch receives it.
+func (rec *ContractRecorder) pass(ch chan *nats.Msg, msg *nats.Msg, timeout <-chan time.Time) bool {
+	select {
+	case ch <- msg:
+		return true
+	case <-rec.done:
+	case <-timeout:
+	}
+	return false
+}
+
+// preResponseTimeout returns the timeout set by a pre-response.
+func preResponseTimeout(data []byte) (time.Duration, bool) {
+	v, ok := reflect.StructTag(data).Lookup("timeout")
+	if !ok {
+		return 0, false
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// recordResponse records the message as a response, and returns true if it
+// was a response to a recorded request.
+func (rec *ContractRecorder) recordResponse(msg *nats.Msg) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	idx, ok := rec.pending[msg.Subject]
+	if !ok {
+		return false
+	}
+	delete(rec.pending, msg.Subject)
+	if resp, ok := contractPayload(msg.Data, msg.Header); ok {
+		rec.contract.Interactions[idx].Response = resp
+	}
+	return true
+}
+
+// LoadContract reads a contract from a JSON file.
+func LoadContract(path string) (Contract, error) {
+	var c Contract
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// WriteFile writes the contract as indented JSON to a file.
+func (c Contract) WriteFile(path string) error {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// VerifyContract sends the requests of each contract interaction to the
+// service, and asserts that the responses satisfy the recorded responses.
+//
+// Pre-responses sent by the service are ignored.
+func (s *Session) VerifyContract(c Contract) *Session {
+	for _, ia := range c.Interactions {
+		inb := s.RequestRaw(ia.Subject, ia.Request)
+		m := s.GetMsg()
+		for m != nil && m.Subject == inb && len(m.Data) > 0 && (m.Data[0]|32) >= 'a' && (m.Data[0]|32) <= 'z' {
+			m = s.GetMsg()
+		}
+		if m == nil {
+			s.t.Fatalf("expected a response to contract request %s, but the connection is closed", ia.Subject)
+		}
+		m.AssertSubject(inb)
+		if err := MatchContractResponse(ia.Response, m.Data); err != nil {
+			s.t.Fatalf("contract with consumer %q broken for request %s: %s", c.Consumer, ia.Subject, err)
+		}
+	}
+	return s
+}
+
+// MatchContractResponse returns an error if the response payload, actual,
+// does not satisfy the recorded response payload, expected.
+//
+// An error response satisfies an error response with the same error code. Any
+// other response satisfies the expected response if it contains all its object
+// properties, recursively, with the same JSON types. Array items are matched
+// against the first expected item, and null matches any value.
+func MatchContractResponse(expected, actual []byte) error {
+	var e, a map[string]interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		return fmt.Errorf("invalid expected response: %s", err)
+	}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		return fmt.Errorf("invalid response: %s", err)
+	}
+	if eerr, ok := e["error"].(map[string]interface{}); ok {
+		aerr, ok := a["error"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected error %v, but got response: %s", eerr["code"], actual)
+		}
+		if eerr["code"] != aerr["code"] {
+			return fmt.Errorf("expected error code %v, but got %v", eerr["code"], aerr["code"])
+		}
+		return nil
+	}
+	if aerr, ok := a["error"].(map[string]interface{}); ok {
+		return fmt.Errorf("expected successful response, but got error %v", aerr["code"])
+	}
+	return matchShape("", e, a)
+}
+
+// matchShape returns an error if the value a does not have the shape of e.
+func matchShape(path string, e, a interface{}) error {
+	if e == nil {
+		return nil
+	}
+	if jsonType(e) != jsonType(a) {
+		return fmt.Errorf("expected %s at %s, but got %s", jsonType(e), pathString(path), jsonType(a))
+	}
+	switch ev := e.(type) {
+	case map[string]interface{}:
+		av := a.(map[string]interface{})
+		keys := make([]string, 0, len(ev))
+		for k := range ev {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, ok := av[k]
+			if !ok {
+				return fmt.Errorf("missing property %s", pathString(joinPath(path, k)))
+			}
+			if err := matchShape(joinPath(path, k), ev[k], v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(ev) == 0 {
+			return nil
+		}
+		for i, v := range a.([]interface{}) {
+			if err := matchShape(fmt.Sprintf("%s[%d]", path, i), ev[0], v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func joinPath(path, k string) string {
+	if path == "" {
+		return k
+	}
+	return path + "." + k
+}
+
+func pathString(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return path
+}
+
+// contractPayload returns the payload as JSON, decompressing payloads flagged
+// as gzip compressed by the header, or false if it is not valid JSON.
+func contractPayload(data []byte, header nats.Header) (json.RawMessage, bool) {
+	if header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, false
+		}
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || !json.Valid(data) || bytes.Equal(data, []byte("null")) {
+		return nil, false
+	}
+	return json.RawMessage(append([]byte(nil), data...)), true
+}
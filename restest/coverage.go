@@ -0,0 +1,194 @@
+package restest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+)
+
+// Coverage tracks which registered handler methods are invoked by requests
+// during one or more test sessions. A Coverage is shared between sessions by
+// passing it with the WithCoverage option:
+//
+//	var coverage = restest.NewCoverage()
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		if code == 0 {
+//			if uncovered := coverage.Uncovered(); len(uncovered) > 0 {
+//				fmt.Printf("handlers never exercised:\n\t%s\n", strings.Join(uncovered, "\n\t"))
+//				code = 1
+//			}
+//		}
+//		os.Exit(code)
+//	}
+//
+//	func TestGetModel(t *testing.T) {
+//		s := restest.NewSession(t, newService(), restest.WithCoverage(coverage))
+//		defer s.Close()
+//		// ...
+//	}
+//
+// Handler methods are identified by the request type, the full resource
+// pattern, and any method name, such as:
+//
+//	access example.model
+//	get example.model
+//	call example.model.set
+//	auth example.model.login
+type Coverage struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+// NewCoverage returns a new Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{hits: make(map[string]int)}
+}
+
+// WithCoverage sets the Coverage option, to track the handler methods of the
+// service, and which of them are invoked during the session.
+func WithCoverage(c *Coverage) func(*SessionConfig) {
+	return func(cfg *SessionConfig) { cfg.Coverage = c }
+}
+
+// Uncovered returns a sorted list of the handler methods that have never been
+// invoked.
+func (c *Coverage) Uncovered() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var l []string
+	for k, n := range c.hits {
+		if n == 0 {
+			l = append(l, k)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Hits returns the number of times the handler method has been invoked. The
+// method is identified as described for Coverage.
+func (c *Coverage) Hits(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits[method]
+}
+
+// AssertCovered asserts that all tracked handler methods have been invoked at
+// least once, failing the test with a list of those that have not.
+func (c *Coverage) AssertCovered(t testing.TB) {
+	t.Helper()
+	if uncovered := c.Uncovered(); len(uncovered) > 0 {
+		t.Fatalf("expected all handler methods to be exercised, but these were never invoked:\n\t%s", strings.Join(uncovered, "\n\t"))
+	}
+}
+
+// register adds the handler methods of the service, and returns the
+// service's handler patterns, most specific first.
+func (c *Coverage) register(s *res.Service) []res.Pattern {
+	var patterns []res.Pattern
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.Walk(func(p res.Pattern, h res.Handler) {
+		patterns = append(patterns, p)
+		for _, key := range handlerMethods(p, h) {
+			if _, ok := c.hits[key]; !ok {
+				c.hits[key] = 0
+			}
+		}
+	})
+	sort.Slice(patterns, func(i, j int) bool {
+		return moreSpecific(patterns[i], patterns[j])
+	})
+	return patterns
+}
+
+// hit registers an invocation of the handler method, if it is tracked.
+func (c *Coverage) hit(key string) {
+	c.mu.Lock()
+	if n, ok := c.hits[key]; ok {
+		c.hits[key] = n + 1
+	}
+	c.mu.Unlock()
+}
+
+// handlerMethods returns the keys of the handler methods of h.
+func handlerMethods(p res.Pattern, h res.Handler) []string {
+	var keys []string
+	if h.Access != nil {
+		keys = append(keys, coverageKey(res.RequestTypeAccess, p, ""))
+	}
+	if h.Get != nil {
+		keys = append(keys, coverageKey(res.RequestTypeGet, p, ""))
+	}
+	for m := range h.Call {
+		keys = append(keys, coverageKey(res.RequestTypeCall, p, m))
+	}
+	if h.New != nil {
+		keys = append(keys, coverageKey(res.RequestTypeCall, p, "new"))
+	}
+	for m := range h.Auth {
+		keys = append(keys, coverageKey(res.RequestTypeAuth, p, m))
+	}
+	return keys
+}
+
+func coverageKey(rtype string, p res.Pattern, method string) string {
+	if method != "" {
+		return rtype + " " + string(p) + "." + method
+	}
+	return rtype + " " + string(p)
+}
+
+// moreSpecific returns true if pattern a takes precedence over pattern b when
+// both match a resource name. Token by token, a fixed name takes precedence
+// over a placeholder, which takes precedence over a full wildcard.
+func moreSpecific(a, b res.Pattern) bool {
+	at := strings.Split(string(a), ".")
+	bt := strings.Split(string(b), ".")
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		ar, br := tokenRank(at[i]), tokenRank(bt[i])
+		if ar != br {
+			return ar < br
+		}
+	}
+	if len(at) != len(bt) {
+		return len(at) > len(bt)
+	}
+	return a < b
+}
+
+func tokenRank(t string) int {
+	switch {
+	case t == ">":
+		return 2
+	case t == "*" || strings.HasPrefix(t, "$"):
+		return 1
+	}
+	return 0
+}
+
+// coverageTracker tracks the handler methods invoked for a single session.
+type coverageTracker struct {
+	c        *Coverage
+	patterns []res.Pattern
+}
+
+// track registers that a handler is invoked for the request.
+func (ct *coverageTracker) track(r res.Resource) {
+	req, ok := r.(*res.Request)
+	if !ok {
+		return
+	}
+	rname := r.ResourceName()
+	for _, p := range ct.patterns {
+		if p.Matches(rname) {
+			ct.c.hit(coverageKey(req.Type(), p, req.Method()))
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package restest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// update is the -update test flag, telling AssertGolden to write the message
+// payload to the golden file instead of comparing it:
+//
+//	go test ./... -update
+//
+// As restest registers the flag, test packages importing restest must not
+// define their own -update flag.
+var update = flag.Bool("update", false, "update restest golden files")
+
+// AssertGolden asserts that the message payload, including any meta object,
+// matches the JSON content of the golden file at path.
+//
+// If the -update flag is set, the payload is instead written to the golden file,
+// creating any missing directories.
+func (m *Msg) AssertGolden(path string) *Msg {
+	if *update {
+		var b bytes.Buffer
+		if err := json.Indent(&b, m.Data, "", "\t"); err != nil {
+			m.c.t.Fatalf("error indenting payload for golden file %s: %s", path, err)
+		}
+		b.WriteByte('\n')
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			m.c.t.Fatalf("error creating directory for golden file %s: %s", path, err)
+		}
+		if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+			m.c.t.Fatalf("error writing golden file %s: %s", path, err)
+		}
+		return m
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		m.c.t.Fatalf("error reading golden file %s: %s\nrun the test with -update to create it", path, err)
+	}
+	var g interface{}
+	if err := json.Unmarshal(data, &g); err != nil {
+		m.c.t.Fatalf("error unmarshaling golden file %s: %s", path, err)
+	}
+	if !reflect.DeepEqual(g, m.Payload()) {
+		m.c.t.Fatalf("expected message payload to match golden file %s:\n%s\nbut got:\n%s", path, bytes.TrimSpace(data), m.Data)
+	}
+	return m
+}
@@ -0,0 +1,128 @@
+package restest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// MockClock is a res.Clock where time only advances when calling Add or Set,
+// making time dependent behavior of a service deterministic in tests:
+//
+//	clock := restest.NewMockClock(time.Time{})
+//	s.SetClock(clock)
+//	/* ... */
+//	clock.Add(time.Minute) // Calls all timers due within a minute
+type MockClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*mockTimer
+}
+
+// mockTimer is a timer scheduled on a MockClock.
+type mockTimer struct {
+	c   *MockClock
+	at  time.Time
+	seq uint64
+	f   func()
+}
+
+// NewMockClock creates a new MockClock set to the time t.
+func NewMockClock(t time.Time) *MockClock {
+	return &MockClock{now: t}
+}
+
+// Now returns the current time of the clock.
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the clock has advanced by the
+// duration d. The call is made synchronously by Add or Set.
+func (c *MockClock) AfterFunc(d time.Duration, f func()) res.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &mockTimer{c: c, at: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Add advances the clock by the duration d, calling all timers that are due,
+// in order of their scheduled time. Timers scheduled by the called functions
+// are also called if due.
+func (c *MockClock) Add(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set sets the clock to the time t, calling all timers that are due, in
+// order of their scheduled time. Panics if t is before the current time.
+func (c *MockClock) Set(t time.Time) {
+	c.mu.Lock()
+	if t.Before(c.now) {
+		c.mu.Unlock()
+		panic("restest: mock clock cannot move backwards")
+	}
+	for {
+		next := c.nextDue(t)
+		if next == nil {
+			break
+		}
+		c.remove(next)
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.mu.Unlock()
+		next.f()
+		c.mu.Lock()
+	}
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Timers returns the number of pending timers.
+func (c *MockClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// nextDue returns the first timer due at or before t, or nil if there is
+// none.
+func (c *MockClock) nextDue(t time.Time) *mockTimer {
+	sort.Slice(c.timers, func(i, j int) bool {
+		a, b := c.timers[i], c.timers[j]
+		if a.at.Equal(b.at) {
+			return a.seq < b.seq
+		}
+		return a.at.Before(b.at)
+	})
+	if len(c.timers) == 0 || c.timers[0].at.After(t) {
+		return nil
+	}
+	return c.timers[0]
+}
+
+// remove removes the timer, returning true if it was pending.
+func (c *MockClock) remove(t *mockTimer) bool {
+	for i, pt := range c.timers {
+		if pt == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Stop prevents the timer from being called. It returns true if the timer
+// was pending.
+func (t *mockTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.remove(t)
+}
@@ -1,9 +1,11 @@
 package restest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"runtime/pprof"
 	"strings"
@@ -28,6 +30,8 @@ type MockConn struct {
 	// Mock server fields
 	closed               bool
 	failNextSubscription bool
+	failNextFlush        bool
+	flushes              int
 
 	// Real server fields
 	gnatsd *server.Server
@@ -38,6 +42,7 @@ type MockConn struct {
 // MockConnConfig holds MockConn configuration.
 type MockConnConfig struct {
 	UseGnatsd       bool
+	ExposeGnatsd    bool // Listen on all interfaces, to allow connections from containers
 	TimeoutDuration time.Duration
 }
 
@@ -78,6 +83,9 @@ func NewMockConn(t *testing.T, cfg *MockConnConfig) *MockConn {
 	defer gnatsdMutex.Unlock()
 	opts := testOptions
 	testOptions.Port = testOptions.Port%100 + 4301
+	if cfg.ExposeGnatsd {
+		opts.Host = "0.0.0.0"
+	}
 
 	// Set up a real gnatsd server
 	gnatsd := ntest.RunServer(&opts)
@@ -85,11 +93,11 @@ func NewMockConn(t *testing.T, cfg *MockConnConfig) *MockConn {
 		panic("Could not start GNATS queue server")
 	}
 
-	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", opts.Host, opts.Port))
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", testOptions.Host, opts.Port))
 	if err != nil {
 		panic(err)
 	}
-	rc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", opts.Host, opts.Port), nats.NoEcho())
+	rc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", testOptions.Host, opts.Port), nats.NoEcho())
 	if err != nil {
 		panic(err)
 	}
@@ -113,6 +121,15 @@ func NewMockConn(t *testing.T, cfg *MockConnConfig) *MockConn {
 	}
 }
 
+// ServerPort returns the port of the gnatsd server, or 0 if UseGnatsd is not
+// set.
+func (c *MockConn) ServerPort() int {
+	if c.gnatsd == nil {
+		return 0
+	}
+	return c.gnatsd.Addr().(*net.TCPAddr).Port
+}
+
 // StopServer stops the gnatsd server.
 func (c *MockConn) StopServer() {
 	if c.cfg.UseGnatsd {
@@ -161,6 +178,56 @@ func (c *MockConn) PublishRequest(subj, reply string, payload []byte) error {
 	return nil
 }
 
+// PublishMsg publishes the message, including any header.
+func (c *MockConn) PublishMsg(m *nats.Msg) error {
+	if c.cfg.UseGnatsd {
+		return c.nc.PublishMsg(m)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg := &nats.Msg{
+		Subject: m.Subject,
+		Reply:   m.Reply,
+		Header:  m.Header,
+		Data:    m.Data,
+	}
+
+	c.rch <- msg
+
+	return nil
+}
+
+// FlushWithContext flushes published messages to the server. With the mock
+// server, messages are delivered when published, and the flush is only
+// counted.
+func (c *MockConn) FlushWithContext(ctx context.Context) error {
+	if c.cfg.UseGnatsd {
+		return c.nc.FlushWithContext(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failNextFlush {
+		c.failNextFlush = false
+		return errors.New("test: failing flush as requested")
+	}
+	if c.closed {
+		return nats.ErrConnectionClosed
+	}
+	c.flushes++
+	return nil
+}
+
+// FlushCount returns the number of successful flushes made with
+// FlushWithContext on the mock server.
+func (c *MockConn) FlushCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushes
+}
+
 // ChanQueueSubscribe subscribes to messages matching the subject pattern.
 func (c *MockConn) ChanQueueSubscribe(subj, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
 	c.mu.Lock()
@@ -228,9 +295,15 @@ func (c *MockConn) Request(subj string, payload interface{}) *NATSRequest {
 // RequestRaw mocks a raw byte request from NATS and returns the reply inbox
 // used.
 func (c *MockConn) RequestRaw(subj string, data []byte) string {
+	return c.RequestRawWithHeader(subj, nil, data)
+}
+
+// RequestRawWithHeader mocks a raw byte request with a message header from
+// NATS and returns the reply inbox used.
+func (c *MockConn) RequestRawWithHeader(subj string, header nats.Header, data []byte) string {
 	if c.cfg.UseGnatsd {
 		inbox := c.rc.NewRespInbox()
-		err := c.rc.PublishRequest(subj, inbox, data)
+		err := c.rc.PublishMsg(&nats.Msg{Subject: subj, Reply: inbox, Header: header, Data: data})
 		if err != nil {
 			panic("test: error sending request: " + err.Error())
 		}
@@ -238,12 +311,18 @@ func (c *MockConn) RequestRaw(subj string, data []byte) string {
 	}
 
 	inbox := nats.NewInbox()
-	c.SendMessage(subj, inbox, data)
+	c.SendMessageWithHeader(subj, inbox, header, data)
 	return inbox
 }
 
 // SendMessage sends a raw message from nats to the the subscribing client.
 func (c *MockConn) SendMessage(subj string, reply string, data []byte) {
+	c.SendMessageWithHeader(subj, reply, nil, data)
+}
+
+// SendMessageWithHeader sends a raw message with a message header from nats
+// to the subscribing client.
+func (c *MockConn) SendMessageWithHeader(subj string, reply string, header nats.Header, data []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for sub, msub := range c.subs {
@@ -251,6 +330,7 @@ func (c *MockConn) SendMessage(subj string, reply string, data []byte) {
 			msg := nats.Msg{
 				Subject: subj,
 				Reply:   reply,
+				Header:  header,
 				Data:    data,
 				Sub:     sub,
 			}
@@ -348,6 +428,13 @@ func (c *MockConn) FailNextSubscription() {
 	c.failNextSubscription = true
 }
 
+// FailNextFlush flags that the next flush attempt should fail.
+func (c *MockConn) FailNextFlush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failNextFlush = true
+}
+
 // GetParallelMsgs gets n number of published messages where the order is
 // uncertain.
 func (c *MockConn) GetParallelMsgs(n int) ParallelMsgs {
@@ -98,6 +98,16 @@ func (m *Msg) AssertResource(rid string) *Msg {
 	return m
 }
 
+// AssertResourceResult asserts that the response is a resource response with
+// the expected resource ID and accompanying result.
+func (m *Msg) AssertResourceResult(rid string, result interface{}) *Msg {
+	m.AssertNoPath("error")
+	mr := m.PathPayload("resource")
+	AssertEqualJSON(m.c.t, "response resource", mr, res.Ref(rid))
+	AssertEqualJSON(m.c.t, "response result", m.PathPayload("result"), result)
+	return m
+}
+
 // AssertError asserts that the response has the expected error.
 func (m *Msg) AssertError(rerr *res.Error) *Msg {
 	// Assert it is an error
@@ -107,6 +117,16 @@ func (m *Msg) AssertError(rerr *res.Error) *Msg {
 	return m
 }
 
+// AssertErrorData asserts that the response is an error with the expected
+// data, such as a list of res.FieldError values.
+func (m *Msg) AssertErrorData(data interface{}) *Msg {
+	// Assert it is an error
+	m.AssertNoPath("result")
+	md := m.PathPayload("error.data")
+	AssertEqualJSON(m.c.t, "response error data", md, data)
+	return m
+}
+
 // AssertErrorCode asserts that the response has the expected error code.
 func (m *Msg) AssertErrorCode(code string) *Msg {
 	// Assert it is not a successful result
@@ -0,0 +1,147 @@
+package restest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	res "github.com/jirenius/go-res"
+	nats "github.com/nats-io/nats.go"
+)
+
+// Recording is a sequence of messages recorded by a service using
+// res.Service.SetRecorder.
+type Recording []res.RecordedMessage
+
+// LoadRecording reads a recording from a file.
+func LoadRecording(path string) (Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f)
+}
+
+// ReadRecording reads a recording, with one JSON encoded res.RecordedMessage
+// per line.
+func ReadRecording(r io.Reader) (Recording, error) {
+	var rec Recording
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var m res.RecordedMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("invalid recording on line %d: %s", line, err)
+		}
+		if m.Dir != res.RecordIn && m.Dir != res.RecordOut {
+			return nil, fmt.Errorf("invalid recording on line %d: unknown direction %q", line, m.Dir)
+		}
+		rec = append(rec, m)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Replay sends the recorded inbound messages to the service, in recorded order,
+// and asserts that the service publishes the recorded outbound messages.
+//
+// Outbound messages recorded before the first inbound message, such as the
+// system.reset sent on start, are skipped. Reply subjects are replaced with new
+// inboxes, and each run of consecutive outbound messages may be published in
+// any order, as the order of responses to concurrent requests is not
+// deterministic.
+func (s *Session) Replay(rec Recording) *Session {
+	inboxes := make(map[string]string)
+	i := 0
+	// Skip outbound messages prior to the first inbound message
+	for i < len(rec) && rec[i].Dir == res.RecordOut {
+		i++
+	}
+	for i < len(rec) {
+		m := rec[i]
+		if m.Dir == res.RecordIn {
+			reply := m.Reply
+			if reply != "" {
+				inb := nats.NewInbox()
+				inboxes[reply] = inb
+				reply = inb
+			}
+			s.SendMessage(m.Subject, reply, m.Payload())
+			i++
+			continue
+		}
+
+		// Collect the run of outbound messages
+		var expected Recording
+		for i < len(rec) && rec[i].Dir == res.RecordOut {
+			expected = append(expected, rec[i])
+			i++
+		}
+		s.assertReplayed(expected, inboxes)
+	}
+	return s
+}
+
+// assertReplayed gets as many published messages as expected, and asserts that
+// each matches one of the expected messages.
+func (s *Session) assertReplayed(expected Recording, inboxes map[string]string) {
+	matched := make([]bool, len(expected))
+	for range expected {
+		msg := s.GetMsg()
+		if msg == nil {
+			s.t.Fatalf("expected %d more replayed messages, but the connection is closed", len(expected))
+		}
+		found := false
+		for j, e := range expected {
+			if matched[j] {
+				continue
+			}
+			subj := e.Subject
+			if inb, ok := inboxes[subj]; ok {
+				subj = inb
+			}
+			if subj == msg.Subject && replayPayloadEqual(e.Payload(), msg.Data) {
+				matched[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.t.Fatalf("replayed message did not match any recorded message:\n%s: %s\nexpected one of:\n%s", msg.Subject, msg.Data, formatRecording(expected, matched))
+		}
+	}
+}
+
+// replayPayloadEqual returns true if a and b are equal, ignoring JSON
+// formatting.
+func replayPayloadEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+func formatRecording(rec Recording, skip []bool) string {
+	var buf bytes.Buffer
+	for i, m := range rec {
+		if !skip[i] {
+			fmt.Fprintf(&buf, "%s: %s\n", m.Subject, m.Payload())
+		}
+	}
+	return buf.String()
+}
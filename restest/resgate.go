@@ -0,0 +1,264 @@
+package restest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// DefaultResgateImage is the Docker image used for Resgate when no image is
+// set in the ResgateConfig.
+const DefaultResgateImage = "resgateio/resgate:latest"
+
+// DefaultResgateStartTimeout is the duration to wait for Resgate to start
+// serving, when no timeout is set in the ResgateConfig.
+const DefaultResgateStartTimeout = 60 * time.Second
+
+// ResgateConfig holds the configuration for running Resgate in Docker.
+type ResgateConfig struct {
+	// Image is the Docker image. Defaults to DefaultResgateImage.
+	Image string
+	// StartTimeout is the duration to wait for Resgate to start serving.
+	// Defaults to DefaultResgateStartTimeout.
+	StartTimeout time.Duration
+}
+
+// Resgate is a Resgate instance running in a Docker container, connected to
+// the same NATS server as the service under test.
+type Resgate struct {
+	t    *testing.T
+	id   string
+	addr string
+}
+
+// HTTPResponse is a response from the Resgate HTTP API.
+type HTTPResponse struct {
+	t          *testing.T
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// WithResgate sets the Resgate option, to run the service against a real NATS
+// server, and a Resgate instance started in Docker using the default
+// ResgateConfig. Requests may then be sent through the gateway's HTTP API
+// using Session.Resgate:
+//
+//	s := restest.NewSession(t, service, restest.WithResgate)
+//	defer s.Close()
+//	s.Resgate().Get("example.model").
+//		AssertStatus(http.StatusOK).
+//		AssertBody(map[string]interface{}{"message": "Hello"})
+//
+// The test is skipped if Docker is not available, or if the test is run with
+// the -short flag. The Resgate container is removed when the session is
+// closed.
+func WithResgate(cfg *SessionConfig) {
+	WithResgateConfig(ResgateConfig{})(cfg)
+}
+
+// WithResgateConfig sets the Resgate option, using the provided Resgate
+// configuration. See WithResgate.
+func WithResgateConfig(rc ResgateConfig) func(*SessionConfig) {
+	return func(cfg *SessionConfig) {
+		cfg.UseGnatsd = true
+		cfg.ExposeGnatsd = true
+		cfg.Resgate = &rc
+	}
+}
+
+// skipWithoutDocker skips the test if it is run with the -short flag, or if
+// the Docker daemon is not available.
+func skipWithoutDocker(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Resgate integration test in short mode")
+	}
+	if err := exec.Command("docker", "version").Run(); err != nil {
+		t.Skipf("skipping Resgate integration test, docker not available: %s", err)
+	}
+}
+
+// startResgate starts a Resgate container connecting to the NATS server
+// listening on the port, and waits for it to serve HTTP requests.
+func startResgate(t *testing.T, cfg ResgateConfig, natsPort int) *Resgate {
+	image := cfg.Image
+	if image == "" {
+		image = DefaultResgateImage
+	}
+	timeout := cfg.StartTimeout
+	if timeout == 0 {
+		timeout = DefaultResgateStartTimeout
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"--add-host=host.docker.internal:host-gateway",
+		"-p", "127.0.0.1::8080",
+		image,
+		"--nats", fmt.Sprintf("nats://host.docker.internal:%d", natsPort),
+		"--port", "8080",
+	).Output()
+	if err != nil {
+		t.Fatalf("error starting resgate container: %s", commandError(err))
+	}
+	rg := &Resgate{t: t, id: strings.TrimSpace(string(out))}
+
+	out, err = exec.Command("docker", "port", rg.id, "8080/tcp").Output()
+	if err != nil {
+		rg.Stop()
+		t.Fatalf("error getting resgate port: %s", commandError(err))
+	}
+	rg.addr = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(rg.HTTPURL() + "/")
+		if err == nil {
+			resp.Body.Close()
+			return rg
+		}
+		if time.Now().After(deadline) {
+			rg.Stop()
+			t.Fatalf("timeout waiting for resgate to start: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// commandError returns the error with any stderr output of a failed command.
+func commandError(err error) string {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return err.Error() + ": " + strings.TrimSpace(string(ee.Stderr))
+	}
+	return err.Error()
+}
+
+// Resgate returns the Resgate instance of the session. It will log a fatal
+// error if the session was not created with the WithResgate option.
+func (s *Session) Resgate() *Resgate {
+	if s.resgate == nil {
+		s.t.Fatalf("session not created with the WithResgate option")
+	}
+	return s.resgate
+}
+
+// HTTPURL returns the base URL of the Resgate HTTP API, such as
+// "http://127.0.0.1:49153".
+func (rg *Resgate) HTTPURL() string {
+	return "http://" + rg.addr
+}
+
+// WSURL returns the URL of the Resgate WebSocket API, to use with a
+// WebSocket client.
+func (rg *Resgate) WSURL() string {
+	return "ws://" + rg.addr
+}
+
+// Get sends a get request for the resource ID through the Resgate HTTP API.
+func (rg *Resgate) Get(rid string) *HTTPResponse {
+	return rg.request(http.MethodGet, ridToPath(rid), nil)
+}
+
+// Call sends a call request for the resource ID through the Resgate HTTP API.
+// The params are marshaled into the request body unless nil.
+func (rg *Resgate) Call(rid string, method string, params interface{}) *HTTPResponse {
+	var body []byte
+	if params != nil {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			panic("test: error marshaling params: " + err.Error())
+		}
+	}
+	path := ridToPath(rid)
+	q := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, q = path[:i], path[i:]
+	}
+	return rg.request(http.MethodPost, path+"/"+method+q, body)
+}
+
+// Stop removes the Resgate container. It is called when the session is
+// closed.
+func (rg *Resgate) Stop() {
+	if rg.id == "" {
+		return
+	}
+	if err := exec.Command("docker", "rm", "-f", rg.id).Run(); err != nil {
+		rg.t.Logf("error removing resgate container %s: %s", rg.id, err)
+	}
+	rg.id = ""
+}
+
+func (rg *Resgate) request(method string, path string, body []byte) *HTTPResponse {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, rg.HTTPURL()+"/api/"+path, r)
+	if err != nil {
+		rg.t.Fatalf("error creating http request: %s", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		rg.t.Fatalf("error sending http request: %s", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		rg.t.Fatalf("error reading http response: %s", err)
+	}
+	return &HTTPResponse{
+		t:          rg.t,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       data,
+	}
+}
+
+// ridToPath converts a resource ID to a Resgate HTTP API path, replacing dots
+// with slashes while keeping any query.
+func ridToPath(rid string) string {
+	q := ""
+	if i := strings.IndexByte(rid, '?'); i >= 0 {
+		rid, q = rid[:i], rid[i:]
+	}
+	return strings.ReplaceAll(rid, ".", "/") + q
+}
+
+// AssertStatus asserts that the response has the HTTP status code.
+func (r *HTTPResponse) AssertStatus(code int) *HTTPResponse {
+	if r.StatusCode != code {
+		r.t.Fatalf("expected http status %d, but got %d:\n\t%s", code, r.StatusCode, r.Body)
+	}
+	return r
+}
+
+// AssertBody asserts that the response body json marshals into the same
+// value as v.
+func (r *HTTPResponse) AssertBody(v interface{}) *HTTPResponse {
+	var body interface{}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		r.t.Fatalf("error unmarshaling http response body: %s\n\t%s", err, r.Body)
+	}
+	AssertEqualJSON(r.t, "http response body", body, v)
+	return r
+}
+
+// AssertError asserts that the response body is the error, err.
+func (r *HTTPResponse) AssertError(err *res.Error) *HTTPResponse {
+	if r.StatusCode < 400 {
+		r.t.Fatalf("expected an error http status, but got %d:\n\t%s", r.StatusCode, r.Body)
+	}
+	return r.AssertBody(err)
+}
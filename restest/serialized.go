@@ -0,0 +1,104 @@
+package restest
+
+import (
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// SerializedRounds is the number of get requests sent to each resource by
+// AssertSerialized.
+const SerializedRounds = 10
+
+// serializedDelay is the time a tracked handler is held, to widen the window in
+// which overlapping handlers may be detected.
+const serializedDelay = time.Millisecond
+
+// serialTracker tracks the number of concurrently executing handlers for a set
+// of resources.
+type serialTracker struct {
+	mu      sync.Mutex
+	rnames  map[string]bool
+	active  int
+	overlap []string
+}
+
+// AssertSerialized sends concurrent get requests to the given resources, and
+// asserts that the handlers for the resources never run at the same time. It
+// is used to verify that the resources share the same group, and that none of
+// the handlers are set to be Parallel.
+//
+// Each resource is requested SerializedRounds times, and the responses are
+// discarded.
+func (s *Session) AssertSerialized(rids ...string) *Session {
+	st := &serialTracker{rnames: make(map[string]bool, len(rids))}
+	for _, rid := range rids {
+		rname, _ := parseRID(rid)
+		st.rnames[rname] = true
+	}
+
+	s.mu.Lock()
+	s.serial = st
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.serial = nil
+		s.mu.Unlock()
+	}()
+
+	reqs := make(NATSRequests, 0, len(rids)*SerializedRounds)
+	for i := 0; i < SerializedRounds; i++ {
+		for _, rid := range rids {
+			reqs = append(reqs, s.Get(rid))
+		}
+	}
+	for range reqs {
+		reqs.Response(s.MockConn)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.overlap) > 0 {
+		s.t.Fatalf("expected handlers for %v to be serialized, but %s was handled concurrently with another resource", rids, st.overlap[0])
+	}
+	return s
+}
+
+// onHandle is set as the service's OnHandle callback to track handlers during
+// AssertSerialized, and for coverage.
+func (s *Session) onHandle(r res.Resource) func() {
+	if s.coverage != nil {
+		s.coverage.track(r)
+	}
+	s.mu.Lock()
+	st := s.serial
+	s.mu.Unlock()
+	if st == nil {
+		return nil
+	}
+	return st.enter(r.ResourceName())
+}
+
+// enter registers that a handler for the resource name has started, and
+// returns a function to call once it has returned.
+func (st *serialTracker) enter(rname string) func() {
+	st.mu.Lock()
+	if !st.rnames[rname] {
+		st.mu.Unlock()
+		return nil
+	}
+	st.active++
+	if st.active > 1 {
+		st.overlap = append(st.overlap, rname)
+	}
+	st.mu.Unlock()
+
+	time.Sleep(serializedDelay)
+
+	return func() {
+		st.mu.Lock()
+		st.active--
+		st.mu.Unlock()
+	}
+}
@@ -0,0 +1,193 @@
+package restest
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/logger"
+	nats "github.com/nats-io/nats.go"
+)
+
+// WithServices sets the Services option, to host additional services on the
+// same connection as the service under test. Messages published by any of the
+// services are routed to the subscriptions of the others, letting tests cover
+// flows spanning multiple services, such as a resource service calling a
+// central access service:
+//
+//	auth := res.NewService("auth")
+//	// ...
+//	s := restest.NewSession(t, service, restest.WithServices(auth))
+//	defer s.Close()
+//
+// The additional services are started, in order, once the service under test
+// has started, and are shut down when the session is closed. All messages
+// published by the services, including requests and responses between them,
+// are also received by the session.
+func WithServices(services ...*res.Service) func(*SessionConfig) {
+	return func(cfg *SessionConfig) {
+		cfg.Services = append(cfg.Services, services...)
+	}
+}
+
+// Services returns the services of the session, starting with the service
+// under test, followed by any services added with WithServices.
+func (s *Session) Services() []*res.Service {
+	return append([]*res.Service{s.s}, s.others...)
+}
+
+// conn returns the connection to use for a service. Unless a real NATS server
+// is used, services share the MockConn through a routedConn when there are
+// several of them. The primary service's connection closes the MockConn when
+// closed.
+func (s *Session) conn(primary bool) res.Conn {
+	c := s.MockConn
+	if c.cfg.UseGnatsd {
+		if primary {
+			return c
+		}
+		nc, err := nats.Connect(c.gnatsd.ClientURL())
+		if err != nil {
+			panic("test: error connecting to gnatsd: " + err.Error())
+		}
+		return nc
+	}
+	if len(s.cfg.Services) == 0 {
+		return c
+	}
+	return &routedConn{c: c, owner: primary, subs: make(map[*nats.Subscription]string)}
+}
+
+// startServices starts the additional services, awaiting the system.reset of
+// each service unless NoReset is set.
+func (s *Session) startServices() {
+	for _, svc := range s.cfg.Services {
+		s.setOnHandle(svc)
+		if !s.cfg.KeepLogger {
+			svc.SetLogger(logger.NewMemLogger().SetTrace(true).SetFlags(log.Ltime))
+		}
+		conn := s.conn(false)
+		go func(svc *res.Service) {
+			if err := svc.Serve(conn); err != nil {
+				panic("test: failed to start service: " + err.Error())
+			}
+		}(svc)
+		if !s.cfg.NoReset {
+			s.GetMsg().AssertSubject("system.reset")
+		}
+		s.others = append(s.others, svc)
+	}
+}
+
+// shutdownServices shuts down the additional services in reverse order.
+func (s *Session) shutdownServices() {
+	for i := len(s.others) - 1; i >= 0; i-- {
+		svc := s.others[i]
+		ch := make(chan error, 1)
+		go func() {
+			ch <- svc.Shutdown()
+		}()
+		select {
+		case <-ch:
+		case <-time.After(s.cfg.TimeoutDuration):
+			s.t.Fatalf("failed to shutdown service: timeout")
+		}
+	}
+}
+
+// routedConn is the connection of one of several services sharing a mock
+// connection. Published messages are received by the session, and routed to
+// the matching subscriptions of all services.
+type routedConn struct {
+	c      *MockConn
+	owner  bool
+	mu     sync.Mutex
+	subs   map[*nats.Subscription]string
+	closed bool
+}
+
+// Publish publishes the data argument to the given subject.
+func (rc *routedConn) Publish(subj string, payload []byte) error {
+	if rc.isClosed() {
+		return nats.ErrConnectionClosed
+	}
+	if err := rc.c.Publish(subj, payload); err != nil {
+		return err
+	}
+	rc.c.SendMessage(subj, "", payload)
+	return nil
+}
+
+// PublishRequest publishes a request expecting a response on the reply
+// subject.
+func (rc *routedConn) PublishRequest(subj, reply string, payload []byte) error {
+	if rc.isClosed() {
+		return nats.ErrConnectionClosed
+	}
+	if err := rc.c.PublishRequest(subj, reply, payload); err != nil {
+		return err
+	}
+	rc.c.SendMessage(subj, reply, payload)
+	return nil
+}
+
+// PublishMsg publishes the message, including any header.
+func (rc *routedConn) PublishMsg(m *nats.Msg) error {
+	if rc.isClosed() {
+		return nats.ErrConnectionClosed
+	}
+	if err := rc.c.PublishMsg(m); err != nil {
+		return err
+	}
+	rc.c.SendMessageWithHeader(m.Subject, m.Reply, m.Header, m.Data)
+	return nil
+}
+
+// ChanSubscribe subscribes to messages matching the subject pattern.
+func (rc *routedConn) ChanSubscribe(subj string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return rc.ChanQueueSubscribe(subj, "", ch)
+}
+
+// ChanQueueSubscribe subscribes to messages matching the subject pattern.
+func (rc *routedConn) ChanQueueSubscribe(subj, queue string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	sub, err := rc.c.ChanQueueSubscribe(subj, queue, ch)
+	if err != nil {
+		return nil, err
+	}
+	rc.mu.Lock()
+	rc.subs[sub] = subj
+	rc.mu.Unlock()
+	return sub, nil
+}
+
+// Close removes the subscriptions made through the connection, and closes
+// the mock connection if owned.
+func (rc *routedConn) Close() {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return
+	}
+	rc.closed = true
+	subs := rc.subs
+	rc.subs = nil
+	rc.mu.Unlock()
+
+	rc.c.mu.Lock()
+	for sub, subj := range subs {
+		delete(rc.c.subs, sub)
+		delete(rc.c.subStrings, subj)
+	}
+	rc.c.mu.Unlock()
+
+	if rc.owner {
+		rc.c.Close()
+	}
+}
+
+func (rc *routedConn) isClosed() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.closed
+}
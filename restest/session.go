@@ -2,6 +2,7 @@ package restest
 
 import (
 	"log"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,6 +21,11 @@ type Session struct {
 	cfg        *SessionConfig
 	cl         chan struct{}
 	logPrinted bool
+	mu         sync.Mutex
+	serial     *serialTracker
+	coverage   *coverageTracker
+	resgate    *Resgate
+	others     []*res.Service
 }
 
 // SessionConfig represents the configuration for a session.
@@ -31,12 +37,18 @@ type SessionConfig struct {
 	ResetResources   []string
 	ResetAccess      []string
 	FailSubscription bool
+	Coverage         *Coverage
+	Resgate          *ResgateConfig
+	Services         []*res.Service
 	MockConnConfig
 }
 
 // NewSession creates a new Session and connects the service to a mock NATS
 // connection.
 //
+// The service's OnHandle callback will be set to track handlers for
+// AssertSerialized, and for any Coverage set with WithCoverage.
+//
 // A service logger will by default be set to a new MemLogger. To set any other
 // logger, add the option:
 //
@@ -47,6 +59,11 @@ type SessionConfig struct {
 // instance, add the option:
 //
 //	WithGnatsd
+//
+// To test the service through a real Resgate instance running in Docker, add
+// the option:
+//
+//	WithResgate
 func NewSession(t *testing.T, service *res.Service, opts ...func(*SessionConfig)) *Session {
 	cfg := &SessionConfig{
 		MockConnConfig: MockConnConfig{TimeoutDuration: DefaultTimeoutDuration},
@@ -54,6 +71,9 @@ func NewSession(t *testing.T, service *res.Service, opts ...func(*SessionConfig)
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	if cfg.Resgate != nil {
+		skipWithoutDocker(t)
+	}
 
 	c := NewMockConn(t, &cfg.MockConnConfig)
 	s := &Session{
@@ -67,14 +87,21 @@ func NewSession(t *testing.T, service *res.Service, opts ...func(*SessionConfig)
 		c.FailNextSubscription()
 	}
 
+	if cfg.Coverage != nil {
+		s.coverage = &coverageTracker{c: cfg.Coverage, patterns: cfg.Coverage.register(service)}
+	}
+
+	s.setOnHandle(service)
+
 	if !cfg.KeepLogger {
 		service.SetLogger(logger.NewMemLogger().SetTrace(true).SetFlags(log.Ltime))
 	}
 
+	conn := s.conn(true)
 	go func() {
 		defer s.StopServer()
 		defer close(s.cl)
-		if err := s.s.Serve(c); err != nil {
+		if err := s.s.Serve(conn); err != nil {
 			panic("test: failed to start service: " + err.Error())
 		}
 	}()
@@ -92,9 +119,39 @@ func NewSession(t *testing.T, service *res.Service, opts ...func(*SessionConfig)
 		}
 	}
 
+	s.startServices()
+
+	if cfg.Resgate != nil {
+		s.resgate = startResgate(t, *cfg.Resgate, c.ServerPort())
+	}
+
 	return s
 }
 
+// setOnHandle sets the session's OnHandle function on the service, chained
+// with any OnHandle function already set.
+func (s *Session) setOnHandle(service *res.Service) {
+	prev := service.OnHandle()
+	if prev == nil {
+		service.SetOnHandle(s.onHandle)
+		return
+	}
+	service.SetOnHandle(func(r res.Resource) func() {
+		pdone := prev(r)
+		done := s.onHandle(r)
+		if pdone == nil {
+			return done
+		}
+		if done == nil {
+			return pdone
+		}
+		return func() {
+			done()
+			pdone()
+		}
+	})
+}
+
 // Service returns the associated res.Service.
 func (s *Session) Service() *res.Service {
 	return s.s
@@ -115,6 +172,11 @@ func (s *Session) Close() error {
 		s.printLog()
 	}
 
+	if s.resgate != nil {
+		s.resgate.Stop()
+	}
+	s.shutdownServices()
+
 	// Try to shutdown the service
 	ch := make(chan error)
 	go func() {
@@ -176,4 +238,9 @@ func (s *Session) printLog() {
 	if l, ok := s.s.Logger().(*logger.MemLogger); ok {
 		s.t.Logf("Trace log:\n%s", l)
 	}
+	for _, svc := range s.others {
+		if l, ok := svc.Logger().(*logger.MemLogger); ok {
+			s.t.Logf("Trace log of service %s:\n%s", svc.FullPath(), l)
+		}
+	}
 }
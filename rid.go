@@ -0,0 +1,136 @@
+package res
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RIDBuilder builds a resource ID from name segments, validating each segment
+// as it is added. It prevents invalid resource IDs from string concatenation,
+// such as "library.book." + id with an empty id.
+//
+// A RIDBuilder is immutable. Add and Query return a new builder, so a common
+// prefix may be shared:
+//
+//	books := res.RID("library", "book")
+//	rid := books.Add(id).String() // "library.book.42"
+type RIDBuilder struct {
+	segs  []string
+	query string
+	err   error
+}
+
+// RID returns a builder for a resource ID starting with the segments.
+func RID(segments ...string) RIDBuilder {
+	var b RIDBuilder
+	for _, seg := range segments {
+		b = b.Add(seg)
+	}
+	return b
+}
+
+// Add returns a builder with the segment added to the resource name. The
+// segment may be a string, any integer type, or implement fmt.Stringer.
+//
+// A segment that is empty, of any other type, or that contains dots,
+// question marks, wildcard characters, whitespace, or control characters,
+// makes the builder invalid.
+func (b RIDBuilder) Add(segment interface{}) RIDBuilder {
+	if b.err != nil {
+		return b
+	}
+	var seg string
+	switch v := segment.(type) {
+	case string:
+		seg = v
+	case int:
+		seg = strconv.Itoa(v)
+	case int8, int16, int32, int64:
+		seg = fmt.Sprint(v)
+	case uint, uint8, uint16, uint32, uint64:
+		seg = fmt.Sprint(v)
+	case fmt.Stringer:
+		seg = v.String()
+	default:
+		b.err = fmt.Errorf("res: invalid resource ID segment type %T", segment)
+		return b
+	}
+	if err := validateRIDSegment(seg); err != nil {
+		b.err = err
+		return b
+	}
+	segs := make([]string, len(b.segs), len(b.segs)+1)
+	copy(segs, b.segs)
+	b.segs = append(segs, seg)
+	return b
+}
+
+// Query returns a builder with the query part of the resource ID set to q,
+// without the question mark separator. An empty q removes the query.
+func (b RIDBuilder) Query(q string) RIDBuilder {
+	b.query = q
+	return b
+}
+
+// Build returns the resource ID, or an error if any segment was invalid, or
+// if there are no segments.
+func (b RIDBuilder) Build() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	if len(b.segs) == 0 {
+		return "", errors.New("res: resource ID has no segments")
+	}
+	rid := strings.Join(b.segs, ".")
+	if b.query != "" {
+		rid += "?" + b.query
+	}
+	if !IsValidRID(rid) {
+		return "", fmt.Errorf("res: invalid resource ID %#v", rid)
+	}
+	return rid, nil
+}
+
+// String returns the resource ID. Panics if Build returns an error.
+func (b RIDBuilder) String() string {
+	rid, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return rid
+}
+
+// Ref returns a reference to the resource. Panics if Build returns an error.
+func (b RIDBuilder) Ref() Ref {
+	return Ref(b.String())
+}
+
+// SplitRID parses a resource ID into the segments of its resource name, and
+// its query part without the question mark separator. An error is returned if
+// rid is not a valid resource ID.
+//
+//	segs, q, _ := res.SplitRID("library.book.42?fields=title")
+//	// segs: []string{"library", "book", "42"}, q: "fields=title"
+func SplitRID(rid string) ([]string, string, error) {
+	if !IsValidRID(rid) {
+		return nil, "", fmt.Errorf("res: invalid resource ID %#v", rid)
+	}
+	rname, q := parseRID(rid)
+	return strings.Split(rname, "."), q, nil
+}
+
+// validateRIDSegment returns an error if the segment is not a valid part of a
+// resource name.
+func validateRIDSegment(seg string) error {
+	if seg == "" {
+		return errors.New("res: empty resource ID segment")
+	}
+	for _, c := range seg {
+		if c < 33 || c > 126 || c == '.' || c == '?' || c == '*' || c == '>' {
+			return fmt.Errorf("res: invalid resource ID segment %#v", seg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package res
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testStringer struct{}
+
+func (testStringer) String() string { return "stringer" }
+
+func TestRIDBuilder_ValidSegments_ReturnsRID(t *testing.T) {
+	tbl := []struct {
+		Builder  RIDBuilder
+		Expected string
+	}{
+		{RID("library"), "library"},
+		{RID("library", "book"), "library.book"},
+		{RID("library").Add("book").Add(42), "library.book.42"},
+		{RID("library").Add(int64(-1)).Add(uint8(7)), "library.-1.7"},
+		{RID("library").Add(testStringer{}), "library.stringer"},
+		{RID("library", "books").Query("limit=10"), "library.books?limit=10"},
+		{RID("library", "books").Query("limit=10").Query(""), "library.books"},
+	}
+
+	for _, r := range tbl {
+		rid, err := r.Builder.Build()
+		if err != nil {
+			t.Errorf("expected %#v but got error: %s", r.Expected, err)
+			continue
+		}
+		if rid != r.Expected {
+			t.Errorf("expected %#v but got %#v", r.Expected, rid)
+		}
+		if r.Builder.String() != r.Expected {
+			t.Errorf("expected String() to return %#v but got %#v", r.Expected, r.Builder.String())
+		}
+		if r.Builder.Ref() != Ref(r.Expected) {
+			t.Errorf("expected Ref() to return %#v but got %#v", r.Expected, r.Builder.Ref())
+		}
+	}
+}
+
+func TestRIDBuilder_InvalidSegments_ReturnsError(t *testing.T) {
+	tbl := []struct {
+		Builder RIDBuilder
+	}{
+		{RID()},
+		{RID("")},
+		{RID("library").Add("")},
+		{RID("library").Add("book.42")},
+		{RID("library").Add("book?")},
+		{RID("library").Add("*")},
+		{RID("library").Add(">")},
+		{RID("library").Add("foo bar")},
+		{RID("library").Add("räv")},
+		{RID("library").Add(1.5)},
+		{RID("library").Add(nil)},
+		{RID("library").Add("").Add("book")},
+	}
+
+	for i, r := range tbl {
+		if rid, err := r.Builder.Build(); err == nil {
+			t.Errorf("test #%d: expected an error but got %#v", i+1, rid)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("test #%d: expected String() to panic", i+1)
+				}
+			}()
+			_ = r.Builder.String()
+		}()
+	}
+}
+
+func TestRIDBuilder_SharedPrefix_IsNotModified(t *testing.T) {
+	books := RID("library", "book")
+	a := books.Add("a")
+	b := books.Add("b")
+	if a.String() != "library.book.a" || b.String() != "library.book.b" || books.String() != "library.book" {
+		t.Errorf("expected shared prefix builders to be independent, but got %#v, %#v, and %#v", a.String(), b.String(), books.String())
+	}
+}
+
+func TestSplitRID_ValidRID_ReturnsSegmentsAndQuery(t *testing.T) {
+	tbl := []struct {
+		RID              string
+		ExpectedSegments []string
+		ExpectedQuery    string
+	}{
+		{"library", []string{"library"}, ""},
+		{"library.book.42", []string{"library", "book", "42"}, ""},
+		{"library.books?limit=10", []string{"library", "books"}, "limit=10"},
+	}
+
+	for _, r := range tbl {
+		segs, q, err := SplitRID(r.RID)
+		if err != nil {
+			t.Errorf("SplitRID(%#v) returned error: %s", r.RID, err)
+			continue
+		}
+		if !reflect.DeepEqual(segs, r.ExpectedSegments) || q != r.ExpectedQuery {
+			t.Errorf("SplitRID(%#v) expected %#v and %#v, but got %#v and %#v", r.RID, r.ExpectedSegments, r.ExpectedQuery, segs, q)
+		}
+	}
+}
+
+func TestSplitRID_InvalidRID_ReturnsError(t *testing.T) {
+	for _, rid := range []string{"", ".", "library.", "library..book", "library.*", "?q"} {
+		if _, _, err := SplitRID(rid); err == nil {
+			t.Errorf("SplitRID(%#v) expected an error", rid)
+		}
+	}
+}
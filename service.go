@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -23,6 +27,17 @@ const defaultInChannelSize = 1024
 // The default number of workers handling resource requests.
 const defaultWorkerCount = 32
 
+// The size in bytes allowed for request fields other than params and token,
+// when limiting the request payload size.
+const maxRequestOverhead = 64 << 10
+
+// The default number of workers handling asynchronous event listeners.
+const defaultListenerCount = 4
+
+// The default number of workers handling query requests of handlers with
+// ParallelQueries set.
+const defaultQueryWorkerCount = 4
+
 // The default duration for which the service will listen for query requests
 // sent on a query event
 const defaultQueryEventDuration = time.Second * 3
@@ -159,6 +174,120 @@ type Handler struct {
 	// The callback will be called in the context of the resource emitting the
 	// event.
 	Listeners map[string]func(*Event)
+
+	// ErrorListeners is a map of event listeners returning errors, where the
+	// key is the resource pattern being listened on. Errors are handled
+	// according to the listener's Policy.
+	//
+	// The callback will be called in the context of the resource emitting the
+	// event.
+	ErrorListeners map[string]ErrorListener
+
+	// LogLevel is the level at which request summaries are logged. Only used
+	// if LogSampleRate is greater than zero.
+	LogLevel logger.Level
+
+	// LogSampleRate is the fraction of requests, between 0 and 1, for which a
+	// summary of the request and response is logged. Zero means no requests
+	// are logged, and 1 means all requests are logged.
+	LogSampleRate float64
+
+	// AccessFallthrough is the policy for access requests when Access is nil.
+	// Default is AccessSilent, not responding to the request.
+	AccessFallthrough AccessFallthroughPolicy
+
+	// DefaultTimeout is the timeout duration sent in a pre-response at the
+	// start of each request handled by the handler. Zero means no
+	// pre-response is sent.
+	DefaultTimeout time.Duration
+
+	// ParallelQueries is a flag telling that query requests, triggered by
+	// query events on the handler's resources, are handled concurrently by
+	// the query workers, instead of on the resource's worker goroutine.
+	ParallelQueries bool
+
+	// CoalesceQueryEvents is a flag telling that query events on the
+	// handler's resources are sent once the current work on the resource's
+	// worker goroutine is done, coalescing query events made before then
+	// into a single query event.
+	CoalesceQueryEvents bool
+
+	// ReuseQueryResponses is a flag telling that the response to a query
+	// request, triggered by a query event on the handler's resources, is
+	// reused for other query requests with the same query on the same query
+	// event, calling the query event callbacks once for each distinct query.
+	ReuseQueryResponses bool
+
+	// Singleflight is a flag telling that identical get requests, arriving
+	// while a previous one is being handled, share its response.
+	Singleflight bool
+
+	// DedupAccess is the duration during which the response to an access
+	// request is shared with identical access requests, with the same
+	// resource ID and token. Zero means no deduplication.
+	DedupAccess time.Duration
+
+	// Versioned is a flag telling that the version of the handler's resources
+	// is increased on each event applied to them.
+	Versioned bool
+
+	// VersionProperty is the name of the model property containing the
+	// resource version. Only used if Versioned is true. If empty, the version
+	// is not included in model responses and change events.
+	VersionProperty string
+
+	// ThrottleRate is the maximum number of events per second sent for each
+	// of the handler's resources. Zero means no throttling.
+	ThrottleRate float64
+
+	// ThrottleStrategy is the strategy for events exceeding ThrottleRate.
+	ThrottleStrategy ThrottleStrategy
+
+	// SyncEvents is a flag telling that the connection is flushed after each
+	// event on the handler's resources.
+	SyncEvents bool
+
+	// ExpireAfter is the duration after a create event, or after the last
+	// change, add, or remove event, that a delete event is sent for the
+	// handler's resources. Zero means resources never expire.
+	ExpireAfter time.Duration
+
+	// OnUnobserved is a callback called on the resource's worker goroutine
+	// when one of the handler's resources is no longer observed, having had
+	// no get or access request for the UnobservedAfter duration, nor after a
+	// system reset probe. See the OnUnobserved option.
+	OnUnobserved func(r Resource)
+
+	// UnobservedAfter is the duration after the last get or access request
+	// for a resource, that a system reset probe is sent for it, and the
+	// duration after the probe that it is considered unobserved. Zero means
+	// OnUnobserved is never called.
+	UnobservedAfter time.Duration
+
+	// Labels are static labels used to group the handler's requests, such as
+	// by domain area, in request summaries and instrumentation. The labels
+	// are available through Resource.Labels.
+	Labels map[string]string
+
+	// Values are static values, such as configuration, set on the handler
+	// with the WithValue option. The values are available through
+	// Resource.HandlerValue.
+	Values map[interface{}]interface{}
+
+	// Shadows is a map of alternate call handlers or services, where the key
+	// is the method name, called for a sample of call requests to compare
+	// responses.
+	Shadows map[string]Shadow
+
+	// Deprecations is a map of deprecated call and auth methods, where the
+	// key is the method name. Requests for the methods are logged and
+	// counted.
+	Deprecations map[string]Deprecation
+
+	// OversizeFallback is a callback called when the result of a call or auth
+	// request exceeds the maximum payload size, returning the ID of a resource
+	// to respond with instead. An empty string means an error is responded.
+	OversizeFallback func(r Resource) string
 }
 
 const (
@@ -198,26 +327,83 @@ func (h *Handler) Option(hf ...Option) {
 type Service struct {
 	*Mux
 	state          int32
-	nc             Conn                   // NATS Server connection
-	inCh           chan *nats.Msg         // Channel for incoming nats messages
-	rwork          map[string]*work       // map of resource work
-	workqueue      []*work                // Resource work queue.
-	workbuf        []*work                // Underlying buffer of the workqueue
-	workcond       sync.Cond              // Cond waited on by workers and signaled when work is added to workqueue
-	wg             sync.WaitGroup         // WaitGroup for all workers
-	mu             sync.Mutex             // Mutex to protect rwork map
-	logger         logger.Logger          // Logger
-	queueGroup     string                 // Queue group to use with CharQueueSubscribe
-	resetResources []string               // List of resource name patterns used on system.reset for resources. Defaults to serviceName+">"
-	resetAccess    []string               // List of resource name patterns used system.reset for access. Defaults to serviceName+">"
-	queryTQ        *timerqueue.Queue      // Timer queue for query events duration
-	queryDuration  time.Duration          // Duration to listen for query requests on a query event
-	workerCount    int                    // Number of workers handling resource requests
-	inChannelSize  int                    // Size of the in channel receiving messages from NATS Server
-	onServe        func(*Service)         // Handler called after the starting to serve prior to calling system.reset
-	onDisconnect   func(*Service)         // Handler called after the service has been disconnected from NATS server.
-	onReconnect    func(*Service)         // Handler called after the service has reconnected to NATS server and sent a system reset event.
-	onError        func(*Service, string) // Handler called on errors within the service, or incoming messages not complying with the RES protocol.
+	nc             Conn                        // NATS Server connection
+	inCh           chan *nats.Msg              // Channel for incoming nats messages
+	subs           []*nats.Subscription        // Request subscriptions, unsubscribed on shutdown
+	listening      int32                       // Set to 1 once the listener is started. Accessed atomically.
+	listenSynced   chan struct{}               // Signaled by the listener when receiving a nil message from Shutdown
+	shards         []*workShard                // Work shards, each with its own work queue and workers
+	shardNext      uint32                      // Counter used to spread work without worker ID over the shards
+	buckets        []string                    // Worker IDs of the group buckets
+	groupBuckets   int                         // Number of buckets to map groups to. Zero means no buckets are used
+	wg             sync.WaitGroup              // WaitGroup for all workers
+	rawMu          sync.Mutex                  // Mutex to protect rawChs
+	rawChs         []chan *nats.Msg            // Channels for raw subscriptions
+	logger         logger.Logger               // Logger
+	queueGroup     string                      // Queue group to use with CharQueueSubscribe
+	resetResources []string                    // List of resource name patterns used on system.reset for resources. Defaults to serviceName+">"
+	resetAccess    []string                    // List of resource name patterns used system.reset for access. Defaults to serviceName+">"
+	ownedSet       bool                        // Flag telling if resetResources or resetAccess was set explicitly with SetOwnedResources
+	resetGroupSize int                         // Number of resources with the same parent grouped into a pattern by ResetResources. Zero means default.
+	queryTQ        *timerqueue.Queue           // Timer queue for query events duration
+	queryDuration  time.Duration               // Duration to listen for query requests on a query event
+	workerCount    int                         // Number of workers handling resource requests
+	workShards     int                         // Number of shards to split the work queue into
+	listenerCount  int                         // Number of workers handling asynchronous event listeners
+	lshard         *workShard                  // Work shard for asynchronous event listeners
+	queryCount     int                         // Number of workers handling query requests of handlers with ParallelQueries set
+	qshard         *workShard                  // Work shard for query requests of handlers with ParallelQueries set
+	inChannelSize  int                         // Size of the in channel receiving messages from NATS Server
+	maxParamsSize  int                         // Maximum size of request params. Zero means no limit.
+	maxTokenSize   int                         // Maximum size of request tokens. Zero means no limit.
+	compressMin    int                         // Minimum size of responses to compress for compressed requests. Zero means disabled.
+	maxPayload     int                         // Maximum payload size set with SetMaxPayload. Zero means the connection's max payload is used.
+	payloadLimit   int                         // Maximum payload size of published messages. Zero means no limit.
+	flusher        flusher                     // Connection used to flush published messages. Nil if flushing is not supported.
+	flushTimeout   time.Duration               // Timeout when flushing synchronous events. Zero means default.
+	clock          Clock                       // Clock used for timers and time stamps
+	queryRegistry  QueryEventRegistry          // Registry of outstanding query events. Nil means query events are not persisted.
+	pendingQueries pendingQueryEvents          // Query events waiting to be sent, for handlers with CoalesceQueryEvents set
+	version        string                      // Version of the service, set with SetVersion
+	connValues     connValues                  // Values stored for client connections
+	connValueTTL   time.Duration               // Duration connection values are kept after last being set or read
+	counters       serviceCounters             // Counters of requests and events, returned by Stats
+	flights        getFlights                  // Get requests shared by identical requests, for handlers with Singleflight set
+	shutdownGrace  time.Duration               // Duration Shutdown waits for workers before closing the connection
+	connClosed     int32                       // Set to 1 once the connection is closed on shutdown. Accessed atomically.
+	pprofLabels    bool                        // Flag telling if handler executions should be tagged with pprof labels
+	trackInFlight  bool                        // Flag telling if requests being handled should be tracked
+	inFlight       inFlightRequests            // Requests being handled, if tracked
+	strict         bool                        // Flag telling if inconsistencies should be reported as errors
+	external       []Pattern                   // Patterns of resources handled by other services, used in strict mode
+	noReplyPanic   bool                        // Flag telling if duplicate responses should be reported as errors instead of panicking
+	fireAndForget  bool                        // Flag telling if call requests without a reply subject should be handled
+	onServe        func(*Service)              // Handler called after the starting to serve prior to calling system.reset
+	onServeBefore  func(*Service) error        // Handler called after connecting, prior to subscribing. An error aborts startup.
+	onStart        []func(*Service) error      // Hooks called after onServeBefore, prior to subscribing. An error aborts startup.
+	onReady        []func(*Service) error      // Hooks called after onServe. An error aborts startup.
+	onStopping     []func(*Service) error      // Hooks called on shutdown, prior to closing the connection.
+	onStopped      []func(*Service) error      // Hooks called once the service has stopped.
+	onDisconnect   func(*Service)              // Handler called after the service has been disconnected from NATS server.
+	onReconnect    func(*Service)              // Handler called after the service has reconnected to NATS server and sent a system reset event.
+	onError        func(*Service, string)      // Handler called on errors within the service, or incoming messages not complying with the RES protocol.
+	onHandle       func(Resource) func()       // Handler called before a request handler is executed, returning a function called after.
+	onPrime        func(Resource, interface{}) // Handler called with each value fetched by Prime.
+	primeRIDs      []string                    // Resource IDs to prime before a system reset on start and reconnect.
+	tokenDecorator TokenDecorator              // Decorator of request tokens. Nil means tokens are not decorated.
+	recorder       *recorder                   // Recorder of inbound and outbound messages. Nil means no recording.
+	reentrantWith  bool                        // Flag telling if callbacks on the current worker's own group are called directly
+	autoTimeout    time.Duration               // Duration after which a timeout pre-response is sent automatically. Zero means disabled.
+	autoTimeoutExt time.Duration               // Timeout duration sent in automatic timeout pre-responses
+	dedup          accessDedups                // Deduplicated access requests
+	versions       resourceVersions            // Versions of resources with versioning enabled
+	throttles      eventThrottles              // Throttle state of resources with throttled events
+	expiries       resourceTimers              // Pending expiries of resources with handlers having ExpireAfter set
+	observations   resourceObservations        // Pending unobserved callbacks of resources with handlers having OnUnobserved set
+	depMu          sync.RWMutex                // Mutex protecting dependencies
+	dependencies   []resourceDependency        // Dependencies between resources, set with DependsOn
+	container      *Container                  // Dependency container used to resolve handler providers
+	providers      []handlerProvider           // Handler providers not yet resolved
 }
 
 // NewService creates a new Service.
@@ -232,8 +418,14 @@ func NewService(name string) *Service {
 		queueGroup:    name,
 		logger:        logger.NewStdLogger(),
 		queryDuration: defaultQueryEventDuration,
+		connValueTTL:  defaultConnectionValueTTL,
+		shutdownGrace: defaultShutdownGracePeriod,
 		workerCount:   defaultWorkerCount,
+		workShards:    1,
+		listenerCount: defaultListenerCount,
+		queryCount:    defaultQueryWorkerCount,
 		inChannelSize: defaultInChannelSize,
+		clock:         SystemClock,
 	}
 	s.Mux.Register(s)
 	return s
@@ -273,6 +465,100 @@ func (s *Service) SetWorkerCount(count int) *Service {
 	return s
 }
 
+// SetListenerWorkerCount sets the number of workers calling asynchronous event
+// listeners. Default is 4 workers.
+//
+// If count is less or equal to zero, the default value is used.
+func (s *Service) SetListenerWorkerCount(count int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if count <= 0 {
+		count = defaultListenerCount
+	}
+	s.listenerCount = count
+	return s
+}
+
+// SetQueryWorkerCount sets the number of workers handling query requests for
+// resources with handlers having ParallelQueries set. Default is 4 workers.
+//
+// If count is less or equal to zero, the default value is used.
+func (s *Service) SetQueryWorkerCount(count int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if count <= 0 {
+		count = defaultQueryWorkerCount
+	}
+	s.queryCount = count
+	return s
+}
+
+// SetWorkShards sets the number of shards the work queue is split into. Each
+// shard has its own lock, and an even share of the workers. Default is 1 shard.
+//
+// Using multiple shards reduces lock contention for services handling a high
+// rate of requests across many distinct resources. Requests for the same
+// resource or group are always handled by the same shard, but a shard with
+// much work cannot use the idle workers of another shard.
+//
+// If count is less or equal to zero, the default value is used. The number of
+// shards will never exceed the number of workers.
+func (s *Service) SetWorkShards(count int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if count <= 0 {
+		count = 1
+	}
+	s.workShards = count
+	return s
+}
+
+// SetGroupBuckets sets a fixed number of buckets that groups are mapped to by
+// consistent hashing of the group ID, so that changing the number of buckets
+// moves only a minimal share of the groups to other buckets. Requests for groups mapped to the same bucket are
+// handled one at a time, in the order they were received. Default is 0,
+// meaning each group is handled separately.
+//
+// Using buckets bounds the number of work queues for services with a large
+// number of distinct resources, trading strict per-group serialization for
+// per-bucket serialization. Handlers set to be Parallel are not affected.
+//
+// If count is less than zero, 0 is used.
+func (s *Service) SetGroupBuckets(count int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if count < 0 {
+		count = 0
+	}
+	s.groupBuckets = count
+	return s
+}
+
+// SetReentrantWith sets if callbacks passed to With, WithResource, and
+// WithGroup should be called directly when called from the worker goroutine
+// already processing the resource's group, instead of being enqueued. Default
+// is false.
+//
+// Without it, a handler that enqueues a callback on its own group, and then
+// waits for the callback to be called, deadlocks the group, as the callback is
+// not called until the handler has returned. With it enabled, the callback is
+// called before With returns, ahead of any other callbacks queued for the
+// group.
+//
+// Detecting the calling goroutine adds overhead to each call to With on a
+// group with queued work.
+func (s *Service) SetReentrantWith(enable bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.reentrantWith = enable
+	return s
+}
+
 // SetInChannelSize sets the size of the in channel receiving messages from NATS
 // Server. Default is 1024.
 //
@@ -288,6 +574,113 @@ func (s *Service) SetInChannelSize(size int) *Service {
 	return s
 }
 
+// SetMaxParamsSize sets the maximum size in bytes of the params of call and
+// auth requests. Requests with larger params are responded to with a
+// system.invalidParams error without calling the handler. Default is 0,
+// meaning no limit.
+//
+// The limit applies to the params only. If the token size is also limited with
+// SetMaxTokenSize, requests with a payload, before and after decompression,
+// larger than the combined params and token size limits, plus 64 KiB for other
+// request fields, are responded to with a system.invalidParams error before
+// the payload is unmarshaled, protecting the service from unmarshaling
+// excessively large payloads.
+//
+// If size is less than zero, 0 is used.
+func (s *Service) SetMaxParamsSize(size int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if size < 0 {
+		size = 0
+	}
+	s.maxParamsSize = size
+	return s
+}
+
+// requestSizeLimit returns the maximum size of a request payload, derived from
+// the params and token size limits, or 0 unless both are limited. The payload
+// is allowed an additional maxRequestOverhead bytes for the other request
+// fields.
+func (s *Service) requestSizeLimit() int {
+	if s.maxParamsSize == 0 || s.maxTokenSize == 0 {
+		return 0
+	}
+	return s.maxParamsSize + s.maxTokenSize + maxRequestOverhead
+}
+
+// requestTooLargeError returns the error responded with on requests with a
+// payload exceeding the limit.
+func requestTooLargeError(limit int) *Error {
+	return &Error{Code: CodeInvalidParams, Message: "Request exceeds maximum size of " + strconv.Itoa(limit) + " bytes"}
+}
+
+// SetMaxTokenSize sets the maximum size in bytes of the access token of
+// access, call, and auth requests. Requests with a larger token are responded
+// to with a system.invalidParams error without calling the handler. Default is
+// 0, meaning no limit.
+//
+// The limit applies to the token only. If the params size is also limited, the
+// limits are applied to the request payload before it is unmarshaled, as
+// described for SetMaxParamsSize.
+//
+// If size is less than zero, 0 is used.
+func (s *Service) SetMaxTokenSize(size int) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	if size < 0 {
+		size = 0
+	}
+	s.maxTokenSize = size
+	return s
+}
+
+// SetStrict sets strict mode. In strict mode, inconsistencies that are
+// otherwise silently accepted, such as change events on resources with unset
+// type, add events with an index out of bounds for the known collection value,
+// change events with properties not found on a struct model, or responses with
+// resource references not matching any registered handler or external resource
+// pattern, are reported as errors through the logger and the OnError callback.
+//
+// Strict mode is intended for development and staging, as it may call the get
+// handler of a resource to validate events.
+func (s *Service) SetStrict(strict bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.strict = strict
+	return s
+}
+
+// SetNoReplyPanic sets whether calling a response method on a request that has
+// already been responded to should log an error and call the OnError callback,
+// instead of panicking. Default is to panic.
+//
+// Use the Replied method on the request to check if a response has been sent.
+func (s *Service) SetNoReplyPanic(noPanic bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.noReplyPanic = noPanic
+	return s
+}
+
+// SetFireAndForgetCalls sets whether call requests without a reply subject,
+// such as sent with resprot.SendCommand, should be handled instead of being
+// logged as errors. Any response to such a request is discarded, and a
+// handler may return without responding. Default is false.
+//
+// Fire-and-forget calls are not sent by Resgate, but may be used for
+// commands between internal services.
+func (s *Service) SetFireAndForgetCalls(enable bool) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.fireAndForget = enable
+	return s
+}
+
 // SetQueueGroup sets the queue group to use when subscribing to resources. By
 // default it will be the same as the service name.
 //
@@ -304,6 +697,17 @@ func (s *Service) SetOnServe(f func(*Service)) {
 	s.onServe = f
 }
 
+// SetOnServeBefore sets a function to call when the service has connected, but
+// before subscribing to requests and sending the initial system reset event.
+// It is used to bootstrap data or run migrations that must complete before any
+// request is handled.
+//
+// If the function returns an error, the service is stopped, and the error is
+// returned by Serve or ListenAndServe.
+func (s *Service) SetOnServeBefore(f func(*Service) error) {
+	s.onServeBefore = f
+}
+
 // SetOnDisconnect sets a function to call when the service has been
 // disconnected from NATS server.
 func (s *Service) SetOnDisconnect(f func(*Service)) {
@@ -322,6 +726,28 @@ func (s *Service) SetOnError(f func(*Service, string)) {
 	s.onError = f
 }
 
+// SetOnHandle sets a function to call on the worker goroutine before a request
+// handler is executed. If the function returns a non-nil function, it will be
+// called after the handler has returned.
+//
+// It is intended for instrumentation, such as verifying that handlers for
+// resources within the same group never run concurrently, or measuring
+// requests grouped by the handler's labels, available through
+// Resource.Labels.
+func (s *Service) SetOnHandle(f func(r Resource) func()) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.onHandle = f
+	return s
+}
+
+// OnHandle returns the function set with SetOnHandle, or nil if no function is
+// set.
+func (s *Service) OnHandle() func(r Resource) func() {
+	return s.onHandle
+}
+
 // Logger returns the logger.
 func (s *Service) Logger() logger.Logger {
 	return s.logger
@@ -344,6 +770,35 @@ func (s *Service) Conn() Conn {
 	return s.nc
 }
 
+// SubscribeRaw subscribes to a subject that is not part of the RES protocol,
+// such as internal domain events. The callback, cb, is called on the worker
+// goroutine for the group, in the same way as handlers for resources belonging
+// to that group. If group is an empty string, callbacks may be called in
+// parallel.
+//
+// The service must be started, and the subscription lasts until the service
+// is stopped. It may be called from within the OnServe callback.
+func (s *Service) SubscribeRaw(subject, group string, cb func(m *nats.Msg)) error {
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		return errNotStarted
+	}
+	ch := make(chan *nats.Msg, s.inChannelSize)
+	s.rawMu.Lock()
+	defer s.rawMu.Unlock()
+	s.tracef("sub %s", subject)
+	if _, err := s.nc.ChanSubscribe(subject, ch); err != nil {
+		return err
+	}
+	s.rawChs = append(s.rawChs, ch)
+	go func() {
+		for m := range ch {
+			m := m
+			s.runWith(group, func() { cb(m) })
+		}
+	}()
+	return nil
+}
+
 // infof logs a formatted info entry.
 func (s *Service) infof(format string, v ...interface{}) {
 	if s.logger == nil {
@@ -363,6 +818,22 @@ func (s *Service) errorf(format string, v ...interface{}) {
 	}
 }
 
+// logf logs a formatted entry at the given level. Unlike errorf, it does not
+// call the OnError callback.
+func (s *Service) logf(level logger.Level, format string, v ...interface{}) {
+	if s.logger == nil {
+		return
+	}
+	switch level {
+	case logger.LevelError:
+		s.logger.Errorf(format, v...)
+	case logger.LevelInfo:
+		s.logger.Infof(format, v...)
+	default:
+		s.logger.Tracef(format, v...)
+	}
+}
+
 // tracef logs a formatted trace entry.
 func (s *Service) tracef(format string, v ...interface{}) {
 	if s.logger == nil {
@@ -381,6 +852,35 @@ func Access(h AccessHandler) Option {
 	})
 }
 
+// AccessFallthroughPolicy is the policy for access requests to a handler
+// without an access handler.
+type AccessFallthroughPolicy byte
+
+// Access fallthrough policies
+const (
+	// AccessSilent does not respond to the access request, assuming it is
+	// handled by another service.
+	AccessSilent AccessFallthroughPolicy = iota
+	// AccessDeny responds with a system.accessDenied error.
+	AccessDeny
+	// AccessNotFound responds with a system.notFound error.
+	AccessNotFound
+)
+
+// AccessFallthrough sets the policy for access requests when the handler has
+// no access handler. By default, access requests are not responded to, as they
+// are assumed to be handled by another service.
+//
+// Services owning the access of their resources exclusively may use
+// AccessDeny or AccessNotFound to respond without waiting for the gateway to
+// time out the request. A policy other than AccessSilent makes the service
+// take access ownership by default, as if an access handler was set.
+func AccessFallthrough(policy AccessFallthroughPolicy) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.AccessFallthrough = policy
+	})
+}
+
 // GetModel sets a handler for model get requests.
 func GetModel(h ModelHandler) Option {
 	return OptionFunc(func(hs *Handler) {
@@ -534,6 +1034,53 @@ func Parallel(parallel bool) Option {
 	})
 }
 
+// ParallelQueries sets the parallel queries flag. Query requests, triggered by
+// query events on the handler's resources, are handled concurrently by a
+// separate pool of query workers, instead of being serialized with other
+// requests on the resource's worker goroutine. The pool size is set with
+// Service.SetQueryWorkerCount.
+//
+// The query event callback must then be safe for concurrent use, and may be
+// called while other requests or events for the resource are handled. The
+// final call with a nil query request, when the query event expires, is
+// still made on the resource's worker goroutine.
+func ParallelQueries(parallel bool) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.ParallelQueries = parallel
+	})
+}
+
+// CoalesceQueryEvents sets the coalesce query events flag. A query event on
+// one of the handler's resources is then sent once the current work on the
+// resource's worker goroutine, and any work already queued for it, is done.
+// Query events made on the resource before then are coalesced into the same
+// query event, using a single query subject.
+//
+// It reduces the number of query events and query requests for resources
+// with rapidly changing query sources. Each query request calls the
+// callbacks of the coalesced query events in order, adding their events to
+// the same response, until a callback sends a response.
+func CoalesceQueryEvents(coalesce bool) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.CoalesceQueryEvents = coalesce
+	})
+}
+
+// ReuseQueryResponses sets the reuse query responses flag. The query event
+// callbacks are then called once for each distinct query on a query event,
+// and the encoded response is published to all query requests with that
+// query. Query requests waiting to be handled are handled as a batch.
+//
+// It reduces the work for query events on resources with many outstanding
+// queries, such as when several gateways query the same search results. The
+// callbacks must respond the same for the same query. A timeout set with
+// QueryRequest.Timeout only applies to the first query request.
+func ReuseQueryResponses(reuse bool) Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.ReuseQueryResponses = reuse
+	})
+}
+
 // OnRegister sets a callback to be called when the handler is registered to a
 // service.
 //
@@ -553,6 +1100,92 @@ func OnRegister(callback func(service *Service, pattern Pattern, rh Handler)) Op
 	})
 }
 
+// LogRequests sets the level and sample rate for logging request summaries.
+// The summary contains the request type, resource, response result or error
+// code, and the handling duration, but not the full payloads.
+//
+// The sampleRate is the fraction of requests, between 0 and 1, being logged.
+// A rate of 1 logs all requests.
+func LogRequests(level logger.Level, sampleRate float64) Option {
+	if sampleRate < 0 || sampleRate > 1 {
+		panic("res: sample rate must be between 0 and 1")
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.LogLevel = level
+		hs.LogSampleRate = sampleRate
+	})
+}
+
+// Labels adds static labels to the handler, used to group requests in request
+// summaries logged by LogRequests, and in instrumentation such as the
+// OnHandle callback, where they are available through Resource.Labels:
+//
+//	s.Handle("book.$id", res.Labels(map[string]string{"area": "library"}))
+//
+// Labels set by multiple Labels options are merged.
+func Labels(labels map[string]string) Option {
+	return OptionFunc(func(hs *Handler) {
+		m := make(map[string]string, len(hs.Labels)+len(labels))
+		for k, v := range hs.Labels {
+			m[k] = v
+		}
+		for k, v := range labels {
+			m[k] = v
+		}
+		hs.Labels = m
+	})
+}
+
+// WithValue sets a value on the handler for the key, retrievable in the
+// handler's requests through Resource.HandlerValue. It lets a shared handler
+// function serve multiple patterns with different configuration:
+//
+//	type tableKey struct{}
+//
+//	s.Handle("book.$id", res.GetModel(getRow), res.WithValue(tableKey{}, "books"))
+//	s.Handle("author.$id", res.GetModel(getRow), res.WithValue(tableKey{}, "authors"))
+//
+//	func getRow(r res.ModelRequest) {
+//		table := r.HandlerValue(tableKey{}).(string)
+//		// ...
+//	}
+//
+// As with context.WithValue, the key should be of a package-local type to
+// avoid collisions. The key must be comparable.
+func WithValue(key, v interface{}) Option {
+	if key == nil {
+		panic("res: nil handler value key")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("res: handler value key is not comparable")
+	}
+	return OptionFunc(func(hs *Handler) {
+		m := make(map[interface{}]interface{}, len(hs.Values)+1)
+		for k, v := range hs.Values {
+			m[k] = v
+		}
+		m[key] = v
+		hs.Values = m
+	})
+}
+
+// DefaultTimeout sets a timeout duration to send in a pre-response at the
+// start of each request to the handler, before the handler is called. It is
+// intended for handlers known to be slow, such as reports or exports, instead
+// of calling Timeout in each handler.
+//
+// The service's automatic timeout, set with SetAutoTimeout, is not used for
+// the handler's requests. A handler may still call Timeout to set a different
+// duration.
+func DefaultTimeout(d time.Duration) Option {
+	if d < 0 {
+		panic("res: negative timeout duration")
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.DefaultTimeout = d
+	})
+}
+
 // SetReset is an alias for SetOwnedResources.
 //
 // Deprecated: Renamed to SetOwnedResources to match API of similar libraries.
@@ -578,13 +1211,19 @@ func (s *Service) SetReset(resources, access []string) *Service {
 // It will take resource ownership if it has at least one registered handler has
 // a Get, Call, or Auth handler method not being nil. It will take access
 // ownership if it has at least one registered handler with the Access method
-// not being nil.
+// not being nil, or with an AccessFallthrough policy other than AccessSilent.
+//
+// When set, the patterns are validated on each ResetAll. Handlers with
+// patterns not fully covered by any owned pattern, and owned patterns matching
+// no handler, are reported as errors through the logger and the OnError
+// callback.
 //
 // For more details on system reset, see:
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-reset-event
 func (s *Service) SetOwnedResources(resources, access []string) *Service {
 	s.resetResources = resources
 	s.resetAccess = access
+	s.ownedSet = resources != nil || access != nil
 	return s
 }
 
@@ -595,8 +1234,9 @@ func (s *Service) SetOwnedResources(resources, access []string) *Service {
 // In case of disconnect, it will try to reconnect until Close is called, or
 // until successfully reconnecting, upon which Reset will be called.
 //
-// ListenAndServe returns an error if failes to connect or subscribe. Otherwise,
-// nil is returned once the connection is closed using Close.
+// ListenAndServe returns an error if failes to connect or subscribe, or if the
+// OnServeBefore callback returns an error. Otherwise, nil is returned once the
+// connection is closed using Close.
 func (s *Service) ListenAndServe(url string, options ...nats.Option) error {
 	if !atomic.CompareAndSwapInt32(&s.state, stateStopped, stateStarting) {
 		return errNotStopped
@@ -634,8 +1274,9 @@ func (s *Service) ListenAndServe(url string, options ...nats.Option) error {
 // In case of disconnect, it will try to reconnect until Close is called, or
 // until successfully reconnecting, upon which Reset will be called.
 //
-// Serve returns an error if failes to subscribe. Otherwise, nil is returned
-// once the connection is closed.
+// Serve returns an error if failes to subscribe, or if the OnServeBefore
+// callback returns an error. Otherwise, nil is returned once the connection is
+// closed.
 func (s *Service) Serve(conn Conn) error {
 	if !atomic.CompareAndSwapInt32(&s.state, stateStopped, stateStarting) {
 		return errNotStopped
@@ -651,47 +1292,75 @@ func (s *Service) Serve(conn Conn) error {
 }
 
 func (s *Service) serve(nc Conn) error {
-	s.infof("Starting service")
+	if s.version != "" {
+		s.infof("Starting service version %s", s.version)
+	} else {
+		s.infof("Starting service")
+	}
+
+	// Resolve handler providers
+	err := s.resolveProviders()
+	if err != nil {
+		s.closeContainer()
+		return err
+	}
 
 	// Validate that there are resources registered
 	// for all the event listeners.
-	err := s.ValidateListeners()
+	err = s.ValidateListeners()
 	if err != nil {
+		s.closeContainer()
 		return err
 	}
 
+	// Prevent handlers from being added once requests may be handled.
+	s.Mux.Freeze()
+
 	// Initialize fields
 	inCh := make(chan *nats.Msg, s.inChannelSize)
 	workCh := make(chan *work, 1)
+	s.payloadLimit = s.payloadLimitFor(nc)
+	s.flusher, _ = nc.(flusher)
 	s.nc = nc
 	s.inCh = inCh
-	s.workcond = sync.Cond{L: &s.mu}
-	s.workbuf = make([]*work, s.inChannelSize)
-	s.workqueue = s.workbuf[:0]
-	s.rwork = make(map[string]*work, s.inChannelSize)
+	s.subs = nil
+	s.listenSynced = make(chan struct{}, 1)
+	atomic.StoreInt32(&s.listening, 0)
+	atomic.StoreInt32(&s.connClosed, 0)
 	s.queryTQ = timerqueue.New(s.queryEventExpire, s.queryDuration)
 
 	// Start workers
-	s.wg.Add(s.workerCount)
-	for i := 0; i < s.workerCount; i++ {
-		go s.startWorker()
-	}
+	s.startWorkers()
 
 	atomic.StoreInt32(&s.state, stateStarted)
 
+	if err = s.start(); err != nil {
+		s.errorf("Failed to start service: %s", err)
+		s.Shutdown()
+		return err
+	}
+
 	err = s.subscribe()
 	if err != nil {
 		s.errorf("Failed to subscribe: %s", err)
 		go s.Shutdown()
 	} else {
-		// Send a system.reset
-		s.ResetAll()
+		// Prime resources and send a system.reset
+		s.primeAndResetAll()
+		// Invalidate query events of a previous run
+		s.invalidateQueryEvents()
 		// Call onServe callback
 		if s.onServe != nil {
 			s.onServe(s)
 		}
+		if err = s.callHooks(s.onReady); err != nil {
+			s.errorf("Failed to start service: %s", err)
+			s.Shutdown()
+			return err
+		}
 
 		s.infof("Listening for requests")
+		atomic.StoreInt32(&s.listening, 1)
 		s.startListener(inCh)
 	}
 
@@ -700,21 +1369,32 @@ func (s *Service) serve(nc Conn) error {
 
 	// Wait for all workers to be done
 	s.wg.Wait()
+	s.flushQueryRegistry()
 	return nil
 }
 
-// Shutdown closes any existing connection to NATS Server.
-// Returns an error if service is not started.
+// Shutdown closes any existing connection to NATS Server, after unsubscribing
+// to requests and letting the workers finish their queued work within the
+// shutdown grace period. See SetShutdownGracePeriod.
+// Returns an error if service is not started, or the first error returned by
+// any OnStopping or OnStopped hook.
 func (s *Service) Shutdown() error {
 	if !atomic.CompareAndSwapInt32(&s.state, stateStarted, stateStopping) {
 		return errNotStarted
 	}
 
 	s.infof("Stopping service...")
+	err := s.callStopHooks(s.onStopping)
+	// Stop accepting requests, and let workers finish queued work, sending any
+	// events and responses, before closing.
+	s.unsubscribe()
+	s.awaitWork()
+	s.stopWorkers()
 	s.close()
 
 	// Wait for all workers to be done
 	s.wg.Wait()
+	s.flushQueryRegistry()
 
 	s.inCh = nil
 	s.nc = nil
@@ -722,18 +1402,27 @@ func (s *Service) Shutdown() error {
 	atomic.StoreInt32(&s.state, stateStopped)
 
 	s.infof("Stopped")
-	return nil
+	if serr := s.callStopHooks(s.onStopped); err == nil {
+		err = serr
+	}
+	if cerr := s.closeContainer(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 // close calls Close on the NATS connection, and closes the incoming channel
 func (s *Service) close() {
-	s.mu.Lock()
-	s.workqueue = nil
-	s.mu.Unlock()
-	s.workcond.Broadcast()
-
+	atomic.StoreInt32(&s.connClosed, 1)
 	s.nc.Close()
 	close(s.inCh)
+
+	s.rawMu.Lock()
+	for _, ch := range s.rawChs {
+		close(ch)
+	}
+	s.rawChs = nil
+	s.rawMu.Unlock()
 }
 
 // Reset sends a system reset for the provided resource patterns.
@@ -763,6 +1452,8 @@ func (s *Service) reset(resources []string, access []string) {
 		access = nil
 	}
 
+	s.clearDedup(resources)
+	s.clearDedup(access)
 	s.event("system.reset", resetEvent{
 		Resources: resources,
 		Access:    access,
@@ -780,6 +1471,7 @@ func (s *Service) ResetAll() {
 	}
 
 	s.setDefaultOwnership()
+	s.validateOwnership()
 
 	s.reset(s.resetResources, s.resetAccess)
 }
@@ -820,6 +1512,37 @@ func (s *Service) TokenEventWithID(cid string, tokenID string, token interface{}
 	s.event("conn."+cid+".token", tokenEvent{Token: token, TID: tokenID})
 }
 
+// TokenEventAll sends a connection token event, setting the same access token,
+// to each of the connections, discarding any previously set tokens. The
+// connections may be served by different gateways.
+//
+// A nil token clears any previously set token.
+func (s *Service) TokenEventAll(cids []string, token interface{}) {
+	s.TokenEventAllWithID(cids, "", token)
+}
+
+// TokenEventAllWithID sends a connection token event in the same way as
+// TokenEventAll, but includes a token ID (tid). An empty token ID is omitted.
+//
+// Panics if any of the connection IDs is invalid, in which case no event is
+// sent.
+func (s *Service) TokenEventAllWithID(cids []string, tokenID string, token interface{}) {
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		s.errorf("Failed to send token event: service not started")
+		return
+	}
+
+	for _, cid := range cids {
+		if !isValidPart(cid) {
+			panic(`res: invalid connection ID`)
+		}
+	}
+	ev := tokenEvent{Token: token, TID: tokenID}
+	for _, cid := range cids {
+		s.event("conn."+cid+".token", ev)
+	}
+}
+
 // TokenReset sends a token reset event for the provided token IDs.
 //
 // The subject string is a message subject that will receive auth requests for
@@ -856,7 +1579,7 @@ func (s *Service) setDefaultOwnership() {
 
 	if s.resetAccess == nil {
 		if s.Contains(func(h Handler) bool {
-			return h.Access != nil
+			return h.Access != nil || h.AccessFallthrough != AccessSilent
 		}) {
 			s.resetAccess = []string{s.Mux.path, mergePattern(s.Mux.path, ">")}
 		} else {
@@ -865,6 +1588,60 @@ func (s *Service) setDefaultOwnership() {
 	}
 }
 
+// validateOwnership reports, as errors, handlers with patterns not fully
+// covered by any of the owned resource patterns set with SetOwnedResources, and
+// owned resource patterns not matching any handler. Requests for resources not
+// covered by the owned patterns never reach the service.
+//
+// Nothing is validated if the ownership is not set explicitly.
+func (s *Service) validateOwnership() {
+	if !s.ownedSet {
+		return
+	}
+	var resources, access []Pattern
+	s.Walk(func(pattern Pattern, h Handler) {
+		if h.Get != nil || len(h.Call) > 0 || len(h.Auth) > 0 || h.New != nil {
+			resources = append(resources, pattern)
+		}
+		if h.Access != nil || h.AccessFallthrough != AccessSilent {
+			access = append(access, pattern)
+		}
+	})
+	validateOwnedPatterns(s, "resource", s.resetResources, resources)
+	validateOwnedPatterns(s, "access", s.resetAccess, access)
+}
+
+// validateOwnedPatterns reports handler patterns not subsumed by any of the
+// owned patterns, and owned patterns not intersecting any of the handler
+// patterns.
+func validateOwnedPatterns(s *Service, typ string, owned []string, handlers []Pattern) {
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i] < handlers[j] })
+	for _, hp := range handlers {
+		covered := false
+		for _, op := range owned {
+			if Pattern(op).Subsumes(hp) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			s.errorf("Handler pattern %s not fully covered by owned %s patterns %v", hp, typ, owned)
+		}
+	}
+	for _, op := range owned {
+		matched := false
+		for _, hp := range handlers {
+			if hp.Intersects(Pattern(op)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			s.errorf("Owned %s pattern %s matches no registered %s handler", typ, op, typ)
+		}
+	}
+}
+
 // subscribe makes a nats subscription for each required request type, based on
 // the patterns used for ResetAll.
 func (s *Service) subscribe() error {
@@ -887,12 +1664,7 @@ func (s *Service) subscribe() error {
 	for _, p := range s.resetAccess {
 		pattern := "access." + p
 		s.tracef("sub %s", pattern)
-		if s.queueGroup == "" {
-			_, err = s.nc.ChanSubscribe(pattern, s.inCh)
-		} else {
-			_, err = s.nc.ChanQueueSubscribe(pattern, s.queueGroup, s.inCh)
-		}
-		if err != nil {
+		if err = s.chanSubscribe(pattern); err != nil {
 			return err
 		}
 	}
@@ -906,21 +1678,38 @@ next:
 			}
 		}
 		s.tracef("sub %s", pattern)
-		if s.queueGroup == "" {
-			_, err = s.nc.ChanSubscribe(pattern, s.inCh)
-		} else {
-			_, err = s.nc.ChanQueueSubscribe(pattern, s.queueGroup, s.inCh)
-		}
-		if err != nil {
+		if err = s.chanSubscribe(pattern); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// chanSubscribe subscribes to the pattern, sending requests to the in channel,
+// and stores the subscription to unsubscribe on shutdown.
+func (s *Service) chanSubscribe(pattern string) error {
+	var sub *nats.Subscription
+	var err error
+	if s.queueGroup == "" {
+		sub, err = s.nc.ChanSubscribe(pattern, s.inCh)
+	} else {
+		sub, err = s.nc.ChanQueueSubscribe(pattern, s.queueGroup, s.inCh)
+	}
+	if err != nil {
+		return err
+	}
+	s.subs = append(s.subs, sub)
+	return nil
+}
+
 // startListener listens for nats messages and passes them on to a worker.
+// A nil message is sent by Shutdown to sync with the listener.
 func (s *Service) startListener(ch chan *nats.Msg) {
 	for m := range ch {
+		if m == nil {
+			s.listenSynced <- struct{}{}
+			continue
+		}
 		s.handleRequest(m)
 	}
 }
@@ -929,9 +1718,10 @@ func (s *Service) startListener(ch chan *nats.Msg) {
 func (s *Service) handleRequest(m *nats.Msg) {
 	subj := m.Subject
 	s.tracef("==> %s: %s", subj, m.Data)
+	s.recordIn(m)
 
-	// Assert there is a reply subject
-	if m.Reply == "" {
+	// Assert there is a reply subject, unless fire-and-forget calls are allowed
+	if m.Reply == "" && !(s.fireAndForget && strings.HasPrefix(subj, "call.")) {
 		s.errorf("Missing reply subject on request: %s", subj)
 		return
 	}
@@ -960,49 +1750,92 @@ func (s *Service) handleRequest(m *nats.Msg) {
 	}
 
 	group := rname
-	mh := s.GetHandler(rname)
+	mh := s.match(rname)
 	if mh != nil {
 		group = mh.Group
 	}
 
-	s.runWith(group, func() {
-		s.processRequest(m, rtype, rname, method, mh)
-	})
+	if rtype == RequestTypeGet && mh != nil && mh.Handler.Singleflight {
+		key, joined := s.joinFlight(rname, m)
+		if joined {
+			return
+		}
+		if !s.runWith(group, func() {
+			s.processRequest(m, rtype, rname, method, mh, key)
+			s.endFlight(key, func(m *nats.Msg) {
+				s.processRequest(m, rtype, rname, method, mh, "")
+			})
+		}) {
+			s.replyStopped(m)
+		}
+		return
+	}
+
+	if !s.runWith(group, func() {
+		s.processRequest(m, rtype, rname, method, mh, "")
+	}) {
+		s.replyStopped(m)
+	}
 }
 
-// runWith enqueues the callback, cb, to be called by the worker goroutine
-// defined by the worker ID (wid).
-func (s *Service) runWith(wid string, cb func()) {
-	if atomic.LoadInt32(&s.state) != stateStarted {
+// replyStopped replies with an error to a request received once the workers
+// have stopped.
+func (s *Service) replyStopped(m *nats.Msg) {
+	if m.Reply == "" {
 		return
 	}
+	s.rawEvent(m.Reply, responseServiceStopped)
+}
 
-	s.mu.Lock()
+// runWith enqueues the callback, cb, to be called by the worker goroutine
+// defined by the worker ID (wid). It returns false if the callback was not
+// enqueued because the workers are stopped.
+func (s *Service) runWith(wid string, cb func()) bool {
+	if state := atomic.LoadInt32(&s.state); state != stateStarted && state != stateStopping {
+		return false
+	}
+
+	wid = s.bucket(wid)
+	sh := s.shard(wid)
+	sh.mu.Lock()
+	if sh.workqueue == nil {
+		// Workers have stopped
+		sh.mu.Unlock()
+		return false
+	}
 	// Get current work queue for the resource
 	var w *work
 	var ok bool
 	if wid != "" {
-		w, ok = s.rwork[wid]
+		w, ok = sh.rwork[wid]
+	}
+	if ok && s.reentrantWith && w.gid != 0 && w.gid == goroutineID() {
+		// Called from the goroutine processing the work queue. Call it
+		// directly, as enqueuing it would deadlock if the caller waits for it.
+		sh.mu.Unlock()
+		cb()
+		return true
 	}
 	if !ok {
 		// Create a new work queue and pass it to a worker
 		w = &work{
-			s:      s,
+			sh:     sh,
 			wid:    wid,
 			single: [1]func(){cb},
 		}
 		w.queue = w.single[:1]
 		if wid != "" {
-			s.rwork[wid] = w
+			sh.rwork[wid] = w
 		}
-		s.workqueue = append(s.workqueue, w)
-		s.mu.Unlock()
-		s.workcond.Signal()
+		sh.workqueue = append(sh.workqueue, w)
+		sh.mu.Unlock()
+		sh.workcond.Signal()
 	} else {
 		// Append callback to existing work queue
 		w.queue = append(w.queue, cb)
-		s.mu.Unlock()
+		sh.mu.Unlock()
 	}
+	return true
 }
 
 // With matches the resource ID, rid, with the registered Handlers before
@@ -1043,19 +1876,21 @@ func (s *Service) WithGroup(group string, cb func(s *Service)) {
 // returned value from another goroutine may cause race conditions.
 func (s *Service) Resource(rid string) (Resource, error) {
 	rname, q := parseRID(rid)
-	mh := s.GetHandler(rname)
+	mh := s.match(rname)
 	if mh == nil {
 		return nil, fmt.Errorf("res: no matching handlers found for %#v", rid)
 	}
 
 	return &resource{
-		rname:      rname,
-		pathParams: mh.Params,
-		query:      q,
-		group:      mh.Group,
-		s:          s,
-		h:          mh.Handler,
-		listeners:  mh.Listeners,
+		rname:       rname,
+		params:      mh.params,
+		paramOffset: mh.paramOffset,
+		query:       q,
+		group:       mh.Group,
+		s:           s,
+		h:           mh.Handler,
+		listeners:   mh.Listeners,
+		elisteners:  mh.ErrorListeners,
 	}, nil
 }
 
@@ -1067,24 +1902,40 @@ func (s *Service) event(subj string, data interface{}) {
 		return
 	}
 
+	if s.isConnClosed(subj) {
+		return
+	}
 	payload, err := json.Marshal(data)
 	if err == nil {
+		if s.oversizedEvent(subj, payload) {
+			return
+		}
 		s.tracef("<-- %s: %s", subj, payload)
-		err = s.nc.Publish(subj, payload)
+		err = s.publish(subj, payload)
 	}
 	if err != nil {
 		s.errorf("Error sending event %s: %s", subj, err)
+		return
 	}
+	atomic.AddUint64(&s.counters.events, 1)
 }
 
 // rawEvent publishes the payload on a subject, and logs it as an outgoing
 // event.
 func (s *Service) rawEvent(subj string, payload []byte) {
+	if s.isConnClosed(subj) {
+		return
+	}
+	if s.oversizedEvent(subj, payload) {
+		return
+	}
 	s.tracef("<-- %s: %s", subj, payload)
-	err := s.nc.Publish(subj, payload)
+	err := s.publish(subj, payload)
 	if err != nil {
 		s.errorf("Error sending event %s: %s", subj, err)
+		return
 	}
+	atomic.AddUint64(&s.counters.events, 1)
 }
 
 // handleReconnect is called when nats has reconnected.
@@ -1092,7 +1943,7 @@ func (s *Service) rawEvent(subj string, payload []byte) {
 // It calls a system.reset to have the resgates update their caches.
 func (s *Service) handleReconnect(_ *nats.Conn) {
 	s.infof("Reconnected to NATS. Sending reset event.")
-	s.ResetAll()
+	s.primeAndResetAll()
 	if s.onReconnect != nil {
 		s.onReconnect(s)
 	}
@@ -1133,7 +1984,7 @@ func parseRID(rid string) (rname string, q string) {
 }
 
 // processRequest is executed by the worker to process an incoming request.
-func (s *Service) processRequest(m *nats.Msg, rtype, rname, method string, mh *Match) {
+func (s *Service) processRequest(m *nats.Msg, rtype, rname, method string, mh *Match, flightKey string) {
 	var r *Request
 	if mh == nil {
 		r = &Request{resource: resource{s: s}, msg: m}
@@ -1141,9 +1992,38 @@ func (s *Service) processRequest(m *nats.Msg, rtype, rname, method string, mh *M
 		return
 	}
 
+	data := m.Data
+	limit := s.requestSizeLimit()
+	if limit > 0 && len(data) > limit {
+		r = &Request{resource: resource{s: s}, msg: m}
+		r.error(requestTooLargeError(limit), nil)
+		return
+	}
+	switch enc := m.Header.Get(headerContentEncoding); enc {
+	case "":
+	case encodingGzip:
+		var err error
+		data, err = gunzip(data, limit)
+		if err != nil {
+			r = &Request{resource: resource{s: s}, msg: m}
+			if limit > 0 && err == errDecompressedTooLarge {
+				r.error(requestTooLargeError(limit), nil)
+				return
+			}
+			s.errorf("Error decompressing incoming request: %s", err)
+			r.error(ToError(err), nil)
+			return
+		}
+	default:
+		r = &Request{resource: resource{s: s}, msg: m}
+		s.errorf("Unsupported content encoding of incoming request: %s", enc)
+		r.error(&Error{Code: CodeInternalError, Message: "Internal error: unsupported content encoding " + enc}, nil)
+		return
+	}
+
 	var rc resRequest
-	if len(m.Data) > 0 {
-		err := json.Unmarshal(m.Data, &rc)
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &rc)
 		if err != nil {
 			r = &Request{resource: resource{s: s}, msg: m}
 			s.errorf("Error unmarshaling incoming request: %s", err)
@@ -1154,13 +2034,16 @@ func (s *Service) processRequest(m *nats.Msg, rtype, rname, method string, mh *M
 
 	r = &Request{
 		resource: resource{
-			rname:      rname,
-			pathParams: mh.Params,
-			group:      mh.Group,
-			s:          s,
-			h:          mh.Handler,
-			listeners:  mh.Listeners,
-			query:      rc.Query,
+			rname:       rname,
+			params:      mh.params,
+			paramOffset: mh.paramOffset,
+			group:       mh.Group,
+			s:           s,
+			h:           mh.Handler,
+			listeners:   mh.Listeners,
+			elisteners:  mh.ErrorListeners,
+			query:       rc.Query,
+			correlation: newCorrelationID(m.Header.Get(HeaderCorrelationID)),
 		},
 		rtype:      rtype,
 		method:     method,
@@ -1173,15 +2056,53 @@ func (s *Service) processRequest(m *nats.Msg, rtype, rname, method string, mh *M
 		remoteAddr: rc.RemoteAddr,
 		uri:        rc.URI,
 		isHTTP:     rc.IsHTTP,
+		acceptGzip: acceptsGzip(m.Header),
+		flightKey:  flightKey,
 	}
 
-	r.executeHandler()
+	if rtype == RequestTypeGet || rtype == RequestTypeAccess {
+		r.observe()
+	}
+
+	if sr := mh.Handler.LogSampleRate; sr > 0 && (sr >= 1 || rand.Float64() < sr) {
+		r.logStart = s.clock.Now()
+	}
+
+	if s.onHandle != nil {
+		if done := s.onHandle(r); done != nil {
+			defer done()
+		}
+	}
+
+	if d := mh.Handler.DefaultTimeout; d > 0 && (rtype != RequestTypeAccess || mh.Handler.Access != nil) {
+		r.sendTimeout(d)
+	} else if s.autoTimeout > 0 {
+		r.startAutoTimeout()
+		defer r.stopAutoTimeout()
+	}
+
+	s.executeTracked(r, mh)
+}
+
+// addQueryEvent registers the query event, and schedules its expiry after the
+// query event duration. The timer queue is used with the system clock, as it
+// needs only a single timer for all query events.
+func (s *Service) addQueryEvent(qe *queryEvent) {
+	s.registerQueryEvent(qe)
+	if s.clock == SystemClock {
+		s.queryTQ.Add(qe)
+		return
+	}
+	s.clock.AfterFunc(s.queryDuration, func() { s.queryEventExpire(qe) })
 }
 
 func (s *Service) queryEventExpire(v interface{}) {
 	qe := v.(*queryEvent)
 	qe.sub.Drain()
+	s.unregisterQueryEvent(qe)
 	s.runWith(qe.r.Group(), func() {
-		qe.cb(nil)
+		for _, cb := range qe.cbs {
+			cb(nil)
+		}
 	})
 }
@@ -0,0 +1,228 @@
+package res
+
+import (
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// shadowTimeout is the duration to wait for the response of an alternate
+// service to a shadowed request.
+const shadowTimeout = 5 * time.Second
+
+// Shadow is an alternate call handler, or alternate service, called for a
+// sample of the requests to a call method, to validate a rewrite of the method
+// against the current implementation. See ShadowCall and ShadowService.
+type Shadow struct {
+	// Handler is the alternate call handler. Its response is compared with the
+	// response of the primary handler, and never sent.
+	Handler CallHandler
+
+	// Service is the name of an alternate service to send a copy of the
+	// request to, if Handler is nil. Its response is compared with the
+	// response of the primary handler.
+	Service string
+
+	// Rate is the fraction of requests, between 0 and 1, being shadowed.
+	Rate float64
+}
+
+// ShadowCall sets an alternate call handler, h, for the method. For a fraction
+// of the call requests, given by rate, the alternate handler is called with a
+// copy of the request once the primary handler has responded. If the
+// responses differ, the mismatch is reported through the logger and the
+// OnError callback, and counted in the service Stats:
+//
+//	s.Handle("order.$id",
+//		res.Call("checkout", checkout),
+//		res.ShadowCall("checkout", checkoutV2, 0.1),
+//	)
+//
+// The alternate handler is called on the resource's worker goroutine, but
+// asynchronously to the primary handler, with the same correlation ID. Any
+// events it sends are discarded, but other side effects, such as writes to a
+// store, are not prevented.
+//
+// The rate must be between 0 and 1.
+func ShadowCall(method string, h CallHandler, rate float64) Option {
+	if h == nil {
+		panic("res: nil shadow handler")
+	}
+	return shadowOption(method, Shadow{Handler: h, Rate: rate})
+}
+
+// ShadowService sets an alternate service for the method. For a fraction of
+// the call requests, given by rate, a copy of the request is sent to the
+// alternate service once the primary handler has responded, with the service
+// name of the resource replaced by service, and with the same headers and
+// correlation ID. If the responses differ, the mismatch is reported in the
+// same way as for ShadowCall:
+//
+//	s.Handle("order.$id",
+//		res.Call("checkout", checkout),
+//		res.ShadowService("checkout", "orders-v2", 0.1),
+//	)
+//
+// The rate must be between 0 and 1.
+func ShadowService(method string, service string, rate float64) Option {
+	if !isValidPart(service) {
+		panic("res: invalid shadow service name: " + service)
+	}
+	return shadowOption(method, Shadow{Service: service, Rate: rate})
+}
+
+func shadowOption(method string, sh Shadow) Option {
+	if method != "*" && !isValidPart(method) {
+		panic("res: invalid method name: " + method)
+	}
+	if sh.Rate < 0 || sh.Rate > 1 {
+		panic("res: sample rate must be between 0 and 1")
+	}
+	return OptionFunc(func(hs *Handler) {
+		if hs.Shadows == nil {
+			hs.Shadows = make(map[string]Shadow)
+		}
+		if _, ok := hs.Shadows[method]; ok {
+			panic("res: multiple shadow handlers for method " + method)
+		}
+		hs.Shadows[method] = sh
+	})
+}
+
+// setShadow sets the request to be shadowed once replied, if the method has a
+// shadow handler and the request is sampled.
+func (r *Request) setShadow() {
+	sh, ok := r.h.Shadows[r.method]
+	if !ok {
+		sh, ok = r.h.Shadows["*"]
+	}
+	if !ok || sh.Rate <= 0 || (sh.Rate < 1 && rand.Float64() >= sh.Rate) {
+		return
+	}
+	r.onReply = func(payload []byte) {
+		if sh.Handler == nil {
+			go r.shadowService(sh.Service, payload)
+			return
+		}
+		r.s.runWith(r.group, func() {
+			r.shadow(sh, payload)
+		})
+	}
+}
+
+// shadow calls the shadow handler with a copy of the request, and compares its
+// response with the primary response. Events sent by the shadow handler are
+// discarded.
+func (r *Request) shadow(sh Shadow, primary []byte) {
+	h := r.h
+	h.Call = map[string]CallHandler{r.method: sh.Handler}
+	h.New = nil
+	h.Shadows = nil
+	h.LogSampleRate = 0
+	sr := &Request{
+		resource:   r.resource,
+		rtype:      r.rtype,
+		method:     r.method,
+		msg:        r.msg,
+		cid:        r.cid,
+		params:     r.params,
+		token:      r.token,
+		dtoken:     r.dtoken,
+		decorated:  r.decorated,
+		header:     r.header,
+		host:       r.host,
+		remoteAddr: r.remoteAddr,
+		uri:        r.uri,
+		isHTTP:     r.isHTTP,
+	}
+	sr.h = h
+	sr.correlation = r.correlation
+	sr.discardEvents = true
+	var result []byte
+	sr.capture = func(payload []byte) {
+		result = payload
+	}
+	sr.executeHandler()
+	r.compareShadow(primary, result)
+}
+
+// shadowService sends a copy of the request to the alternate service, and
+// compares its response with the primary response.
+func (r *Request) shadowService(service string, primary []byte) {
+	subj := "call." + service
+	if rest := r.s.relativeName(r.rname); rest != "" {
+		subj += "." + rest
+	}
+	subj += "." + r.method
+
+	inbox := nats.NewInbox()
+	ch := make(chan *nats.Msg, 1)
+	sub, err := r.s.nc.ChanSubscribe(inbox, ch)
+	if err != nil {
+		r.s.errorf("Error subscribing to shadow response for %s [%s]: %s", subj, r.CorrelationID(), err)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	// Compare uncompressed responses, and keep the correlation ID.
+	header := nats.Header{HeaderCorrelationID: []string{r.CorrelationID()}}
+	for k, v := range r.msg.Header {
+		if k != headerAcceptEncoding && k != HeaderCorrelationID {
+			header[k] = v
+		}
+	}
+	if mp, ok := r.s.nc.(msgPublisher); ok {
+		err = mp.PublishMsg(&nats.Msg{Subject: subj, Reply: inbox, Header: header, Data: r.msg.Data})
+	} else {
+		err = r.s.nc.PublishRequest(subj, inbox, r.msg.Data)
+	}
+	if err != nil {
+		r.s.errorf("Error sending shadow request %s [%s]: %s", subj, r.CorrelationID(), err)
+		return
+	}
+
+	timeout := make(chan struct{})
+	t := r.s.clock.AfterFunc(shadowTimeout, func() { close(timeout) })
+	defer t.Stop()
+	select {
+	case m := <-ch:
+		r.compareShadow(primary, m.Data)
+	case <-timeout:
+		r.s.errorf("Shadow request %s [%s] timed out", subj, r.CorrelationID())
+	}
+}
+
+// compareShadow compares the shadow response with the primary response,
+// reporting any mismatch.
+func (r *Request) compareShadow(primary, shadow []byte) {
+	atomic.AddUint64(&r.s.counters.shadowRequests, 1)
+	if !jsonEqual(primary, shadow) {
+		atomic.AddUint64(&r.s.counters.shadowMismatches, 1)
+		r.s.errorf("Shadow response mismatch for %s [%s]:\n\tprimary: %s\n\tshadow:  %s", r.msg.Subject, r.CorrelationID(), primary, shadow)
+	}
+}
+
+// discardEvent returns true if events on the resource are discarded, as for
+// shadow requests, logging the discarded event.
+func (r *resource) discardEvent(event string) bool {
+	if !r.discardEvents {
+		return false
+	}
+	r.s.tracef("Discarded shadow event %s on %s [%s]", event, r.rname, r.CorrelationID())
+	return true
+}
+
+// relativeName returns the resource name without the service name prefix.
+func (s *Service) relativeName(rname string) string {
+	p := s.Path()
+	switch {
+	case p == "":
+		return rname
+	case rname == p:
+		return ""
+	}
+	return strings.TrimPrefix(rname, p+".")
+}
@@ -0,0 +1,108 @@
+package res
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The default duration Shutdown waits for workers to finish their queued work
+// before closing the connection.
+const defaultShutdownGracePeriod = time.Second * 5
+
+// SetShutdownGracePeriod sets the duration Shutdown waits for the workers to
+// finish their queued work before closing the connection. On shutdown, the
+// service first unsubscribes to requests, and any request received once the
+// workers have stopped gets an internal error response. Events and responses
+// sent by handlers and listeners during the grace period are flushed before
+// the connection is closed. Default is 5 seconds.
+//
+// Events sent once the connection is closed are not published. Instead, they
+// are reported as errors through the logger and the OnError callback,
+// including the resource name. A zero or negative duration closes the
+// connection without waiting.
+//
+// Panics if service is already started.
+func (s *Service) SetShutdownGracePeriod(d time.Duration) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.shutdownGrace = d
+	return s
+}
+
+// unsubscribe unsubscribes to all requests, for the service to stop accepting
+// new requests on shutdown.
+func (s *Service) unsubscribe() {
+	for _, sub := range s.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			s.tracef("Failed to unsubscribe %s: %s", sub.Subject, err)
+		}
+	}
+}
+
+// awaitWork waits for the listener to pass on any requests received before
+// unsubscribing, and for the workers to finish all queued work, for at most
+// the shutdown grace period.
+//
+// A timer of the time package is used instead of the service clock, as a mock
+// clock would otherwise prevent the service from stopping.
+func (s *Service) awaitWork() {
+	if s.shutdownGrace <= 0 {
+		return
+	}
+	t := time.NewTimer(s.shutdownGrace)
+	defer t.Stop()
+	if atomic.LoadInt32(&s.listening) == 1 {
+		select {
+		case s.inCh <- nil:
+		case <-t.C:
+			s.errorf("Shutdown grace period of %s expired with requests still pending", s.shutdownGrace)
+			return
+		}
+		select {
+		case <-s.listenSynced:
+		case <-t.C:
+			s.errorf("Shutdown grace period of %s expired with requests still pending", s.shutdownGrace)
+			return
+		}
+	}
+	s.drainWorkers()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-t.C:
+		s.errorf("Shutdown grace period of %s expired with work still in progress", s.shutdownGrace)
+	}
+}
+
+// isConnClosed reports if the connection is closed on shutdown. If so, it
+// reports the event on the subject as dropped, and returns true.
+func (s *Service) isConnClosed(subj string) bool {
+	if atomic.LoadInt32(&s.connClosed) == 0 {
+		return false
+	}
+	if rname := eventResourceName(subj); rname != "" {
+		s.errorf("Failed to send event %s on %s: service is stopped", subj, rname)
+	} else {
+		s.errorf("Failed to send event %s: service is stopped", subj)
+	}
+	return true
+}
+
+// eventResourceName returns the resource name of a resource event subject,
+// or an empty string for any other subject.
+func eventResourceName(subj string) string {
+	if !strings.HasPrefix(subj, "event.") {
+		return ""
+	}
+	rname := subj[len("event."):]
+	if i := strings.LastIndexByte(rname, '.'); i > 0 {
+		return rname[:i]
+	}
+	return ""
+}
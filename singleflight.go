@@ -0,0 +1,95 @@
+package res
+
+import (
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// getFlights holds the get requests of handlers with Singleflight set that
+// are being handled, keyed by resource name and request data.
+type getFlights struct {
+	mu sync.Mutex
+	m  map[string]*getFlight
+}
+
+// getFlight is a get request being handled, with the identical requests
+// waiting for its response.
+type getFlight struct {
+	waiters []*nats.Msg
+}
+
+// Singleflight makes identical get requests for a resource, arriving while a
+// previous one is being handled or waiting to be handled, share the response
+// of that request. The get handler is called, and the response marshaled,
+// only once.
+//
+// It reduces the load on databases when many gateways request the same
+// resource at once, such as after a system reset. Any error response is
+// also shared.
+func Singleflight() Option {
+	return OptionFunc(func(hs *Handler) {
+		hs.Singleflight = true
+	})
+}
+
+// joinFlight adds the get request to an identical request being handled, and
+// returns true. Otherwise it starts a new flight, and returns false with the
+// key to pass on to the request.
+func (s *Service) joinFlight(rname string, m *nats.Msg) (string, bool) {
+	key := rname + "\x00" + string(m.Data)
+	fs := &s.flights
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if f, ok := fs.m[key]; ok {
+		f.waiters = append(f.waiters, m)
+		s.tracef("Joined in-flight get request %s", m.Subject)
+		return "", true
+	}
+	if fs.m == nil {
+		fs.m = make(map[string]*getFlight)
+	}
+	fs.m[key] = &getFlight{}
+	return key, false
+}
+
+// takeFlight removes the flight, and returns the requests waiting for it, or
+// nil if the flight is already removed.
+func (s *Service) takeFlight(key string) *getFlight {
+	fs := &s.flights
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f := fs.m[key]
+	delete(fs.m, key)
+	return f
+}
+
+// completeFlight sends the reply payload to the requests waiting for the
+// response. The payload is sent uncompressed, as the waiting requests may not
+// accept a compressed response.
+func (r *Request) completeFlight(payload []byte) {
+	f := r.s.takeFlight(r.flightKey)
+	if f == nil {
+		return
+	}
+	for _, m := range f.waiters {
+		r.s.tracef("<== %s: %s", m.Subject, payload)
+		if err := r.s.publish(m.Reply, payload); err != nil {
+			r.s.errorf("Error sending reply %s: %s", m.Subject, err)
+			continue
+		}
+		r.s.countReply(payload)
+	}
+}
+
+// endFlight handles the requests waiting for a flight where no response was
+// sent, as if they had arrived separately.
+func (s *Service) endFlight(key string, process func(m *nats.Msg)) {
+	f := s.takeFlight(key)
+	if f == nil {
+		return
+	}
+	for _, m := range f.waiters {
+		process(m)
+	}
+}
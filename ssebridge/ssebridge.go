@@ -0,0 +1,231 @@
+/*
+Package ssebridge provides an HTTP handler streaming resource events as
+Server-Sent Events (SSE), for read-only access from browsers and monitoring
+dashboards without deploying Resgate.
+
+Clients select the resources to stream using one or more rid query
+parameters. Each resource ID must match one of the patterns exposed by the
+bridge. For each resource, the current value is first sent as a "value" event,
+followed by the resource events as they occur, with the event name as SSE event
+type:
+
+	event: change
+	data: {"rid":"library.book.42","event":"change","changed":{"title":"The Hobbit"}}
+
+# Usage
+
+Expose book resources on /events:
+
+	s.Handle("book.$id", res.GetModel(getBook))
+	b := ssebridge.New(s, "book.$id")
+	http.Handle("/events", b)
+	go http.ListenAndServe(":8080", nil)
+	s.ListenAndServe("nats://localhost:4222")
+
+Stream a book using:
+
+	curl -N "http://localhost:8080/events?rid=library.book.42"
+*/
+package ssebridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+)
+
+// EventBufferSize is the size of the channel buffer for each client. Events are
+// dropped for clients with a full buffer.
+const EventBufferSize = 64
+
+// Event is the data sent for each resource event.
+type Event = resprot.ListenerEvent
+
+// message is a single SSE message.
+type message struct {
+	event string
+	data  []byte
+}
+
+// Bridge is an http.Handler streaming resource events as Server-Sent Events.
+type Bridge struct {
+	s        *res.Service
+	patterns []res.Pattern
+	mu       sync.Mutex
+	clients  map[string]map[chan message]struct{}
+}
+
+// New creates a new Bridge exposing resources matching the patterns, and adds
+// event listeners for them. The patterns are relative to the service, in the
+// same way as for Handle, and must match registered handlers.
+//
+// It must be called after the handlers are registered, and before the service
+// is started.
+func New(s *res.Service, patterns ...string) *Bridge {
+	b := &Bridge{
+		s:       s,
+		clients: make(map[string]map[chan message]struct{}),
+	}
+	fp := s.FullPath()
+	for _, p := range patterns {
+		s.AddListener(p, b.listener)
+		if fp != "" {
+			p = fp + "." + p
+		}
+		b.patterns = append(b.patterns, res.Pattern(p))
+	}
+	return b
+}
+
+// ServeHTTP streams the events of the resources given by the rid query
+// parameters.
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	rids := r.URL.Query()["rid"]
+	if len(rids) == 0 {
+		http.Error(w, "missing rid query parameter", http.StatusBadRequest)
+		return
+	}
+	for _, rid := range rids {
+		if !b.exposed(rid) {
+			http.Error(w, fmt.Sprintf("resource %s not found", rid), http.StatusNotFound)
+			return
+		}
+	}
+
+	ch := make(chan message, EventBufferSize)
+	b.subscribe(rids, ch)
+	defer b.unsubscribe(rids, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Send the current values.
+	for _, rid := range rids {
+		if err := b.writeValue(r.Context(), w, rid); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m := <-ch:
+			if err := writeMessage(w, m); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// exposed returns true if the resource ID matches an exposed pattern.
+func (b *Bridge) exposed(rid string) bool {
+	if strings.IndexByte(rid, '?') >= 0 {
+		return false
+	}
+	for _, p := range b.patterns {
+		if p.Matches(rid) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValue writes a value event with the current value of the resource. It
+// returns the context error if the context is done before the value is
+// retrieved.
+func (b *Bridge) writeValue(ctx context.Context, w http.ResponseWriter, rid string) error {
+	type valueResult struct {
+		v   interface{}
+		err error
+	}
+	ch := make(chan valueResult, 1)
+	err := b.s.With(rid, func(r res.Resource) {
+		v, err := r.Value()
+		ch <- valueResult{v, err}
+	})
+	if err != nil {
+		return err
+	}
+	var result valueResult
+	select {
+	case result = <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	ev := Event{RID: rid, Event: "value", Value: result.v}
+	if result.err != nil {
+		ev = Event{RID: rid, Event: "error", Data: res.ToError(result.err)}
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, message{event: ev.Event, data: data})
+}
+
+func (b *Bridge) subscribe(rids []string, ch chan message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, rid := range rids {
+		m, ok := b.clients[rid]
+		if !ok {
+			m = make(map[chan message]struct{})
+			b.clients[rid] = m
+		}
+		m[ch] = struct{}{}
+	}
+}
+
+func (b *Bridge) unsubscribe(rids []string, ch chan message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, rid := range rids {
+		delete(b.clients[rid], ch)
+		if len(b.clients[rid]) == 0 {
+			delete(b.clients, rid)
+		}
+	}
+}
+
+// listener sends the event to all clients streaming the resource.
+func (b *Bridge) listener(ev *res.Event) {
+	rname := ev.Resource.ResourceName()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.clients[rname]
+	if len(m) == 0 {
+		return
+	}
+	data, err := json.Marshal(resprot.NewListenerEvent(ev))
+	if err != nil {
+		return
+	}
+	msg := message{event: ev.Name, data: data}
+	for ch := range m {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func writeMessage(w http.ResponseWriter, m message) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.event, m.data)
+	return err
+}
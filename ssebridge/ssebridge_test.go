@@ -0,0 +1,132 @@
+package ssebridge_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/ssebridge"
+)
+
+func newService() *res.Service {
+	s := res.NewService("test")
+	s.Handle("model.$id",
+		res.GetModel(func(r res.ModelRequest) {
+			r.Model(map[string]interface{}{"foo": "bar"})
+		}),
+		res.Call("set", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"foo": "baz"})
+			r.OK(nil)
+		}),
+	)
+	s.Handle("hidden", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	return s
+}
+
+// readMessage reads a single SSE message, returning the event and data lines.
+func readMessage(t *testing.T, r *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			data = line[len("data: "):]
+		}
+	}
+}
+
+func TestBridge_StreamResource_SendsValueAndEvents(t *testing.T) {
+	s := newService()
+	srv := httptest.NewServer(ssebridge.New(s, "model.$id"))
+	defer srv.Close()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	resp, err := http.Get(srv.URL + "?rid=test.model.42")
+	restest.AssertNoError(t, err)
+	defer resp.Body.Close()
+	restest.AssertEqualJSON(t, "status", resp.StatusCode, http.StatusOK)
+	restest.AssertEqualJSON(t, "content type", resp.Header.Get("Content-Type"), "text/event-stream")
+
+	r := bufio.NewReader(resp.Body)
+	event, data := readMessage(t, r)
+	restest.AssertEqualJSON(t, "event", event, "value")
+	restest.AssertEqualJSON(t, "data", data, `{"rid":"test.model.42","event":"value","value":{"foo":"bar"}}`)
+
+	req := session.Call("test.model.42", "set", nil)
+	session.GetMsg().AssertChangeEvent("test.model.42", map[string]interface{}{"foo": "baz"})
+	req.Response().AssertResult(nil)
+
+	event, data = readMessage(t, r)
+	restest.AssertEqualJSON(t, "event", event, "change")
+	restest.AssertEqualJSON(t, "data", data, `{"rid":"test.model.42","event":"change","changed":{"foo":"baz"}}`)
+}
+
+func TestBridge_StreamNotExposedResource_RespondsNotFound(t *testing.T) {
+	s := newService()
+	srv := httptest.NewServer(ssebridge.New(s, "model.$id"))
+	defer srv.Close()
+	session := restest.NewSession(t, s)
+	defer session.Close()
+
+	resp, err := http.Get(srv.URL + "?rid=test.hidden")
+	restest.AssertNoError(t, err)
+	resp.Body.Close()
+	restest.AssertEqualJSON(t, "status", resp.StatusCode, http.StatusNotFound)
+}
+
+func TestBridge_MissingRID_RespondsBadRequest(t *testing.T) {
+	s := newService()
+	srv := httptest.NewServer(ssebridge.New(s, "model.$id"))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	restest.AssertNoError(t, err)
+	resp.Body.Close()
+	restest.AssertEqualJSON(t, "status", resp.StatusCode, http.StatusBadRequest)
+}
+
+func TestBridge_RequestCanceledWhileGettingValue_Returns(t *testing.T) {
+	s := res.NewService("test")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+		close(started)
+		<-release
+		r.Model(map[string]interface{}{"foo": "bar"})
+	}))
+	b := ssebridge.New(s, "model")
+	session := restest.NewSession(t, s)
+	defer session.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/?rid=test.model", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		b.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected ServeHTTP to return when the request is canceled")
+	}
+}
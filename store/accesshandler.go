@@ -0,0 +1,252 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// ACL is implemented by access control documents, stored in a Store, that
+// grant access to resources.
+type ACL interface {
+	// Access returns the access granted for the access request. The get flag
+	// and call string have the same meaning as for res.AccessRequest.Access.
+	Access(r res.AccessRequest) (get bool, call string)
+}
+
+// AccessHandler is a res.Service handler that grants access to resources based
+// on access control documents read from a Store.
+//
+// The documents are cached, and when a document is changed in the store, a
+// reaccess event is sent for each resource whose access was granted or denied
+// using it. This allows permissions to be edited live, for instance by serving
+// the documents as models using a Handler with the same Store. Resources
+// without access requests for the EvictAfter duration are no longer tracked.
+type AccessHandler struct {
+	// Store containing the access control documents.
+	Store Store
+	// Transformer used to get the ID of the document for a resource with
+	// RIDToID, and to transform the stored document with Transform. If nil,
+	// the resource name is used as ID.
+	Transformer Transformer
+	// Access returns the access granted by the document, acl, for the access
+	// request. If nil, the documents must implement ACL.
+	Access func(r res.AccessRequest, acl interface{}) (get bool, call string)
+	// EvictAfter is the duration without any access request for a resource,
+	// after which it is no longer tracked, and its document is evicted from
+	// the cache if no other resource uses it (see res.OnUnobserved). Defaults
+	// to DefaultEvictAfter.
+	EvictAfter time.Duration
+}
+
+var _ res.Option = AccessHandler{}
+
+type accessHandler struct {
+	s      *res.Service
+	st     Store
+	trans  Transformer
+	access func(r res.AccessRequest, acl interface{}) (get bool, call string)
+
+	mu      sync.Mutex
+	cache   map[string]*aclEntry
+	ids     map[string]string // Document IDs keyed by the names of the resources using them
+	version uint64            // Incremented on each store change
+}
+
+// aclEntry is a cached access control document, and the names of the resources
+// whose access was granted or denied using it.
+type aclEntry struct {
+	acl    interface{} // nil if not found
+	rnames map[string]struct{}
+}
+
+var errNotACL = res.InternalError(errors.New("access control document does not implement ACL"))
+
+// WithStore returns a new AccessHandler value with Store set to store.
+func (ah AccessHandler) WithStore(store Store) AccessHandler {
+	ah.Store = store
+	return ah
+}
+
+// WithTransformer returns a new AccessHandler value with Transformer set to
+// transformer.
+func (ah AccessHandler) WithTransformer(transformer Transformer) AccessHandler {
+	ah.Transformer = transformer
+	return ah
+}
+
+// WithAccess returns a new AccessHandler value with Access set to access.
+func (ah AccessHandler) WithAccess(access func(r res.AccessRequest, acl interface{}) (get bool, call string)) AccessHandler {
+	ah.Access = access
+	return ah
+}
+
+// WithEvictAfter returns a new AccessHandler value with EvictAfter set to d.
+func (ah AccessHandler) WithEvictAfter(d time.Duration) AccessHandler {
+	ah.EvictAfter = d
+	return ah
+}
+
+// SetOption is to implement the res.Option interface
+func (ah AccessHandler) SetOption(h *res.Handler) {
+	if ah.Store == nil {
+		panic("no Store is set")
+	}
+	o := &accessHandler{
+		st:     ah.Store,
+		trans:  ah.Transformer,
+		access: ah.Access,
+		cache:  make(map[string]*aclEntry),
+		ids:    make(map[string]string),
+	}
+	evictAfter := ah.EvictAfter
+	if evictAfter <= 0 {
+		evictAfter = DefaultEvictAfter
+	}
+	h.Option(
+		res.Access(o.handleAccess),
+		res.OnRegister(o.onRegister),
+		res.OnUnobserved(evictAfter, o.evict),
+	)
+	o.st.OnChange(o.changeHandler)
+}
+
+func (o *accessHandler) onRegister(s *res.Service, p res.Pattern, h res.Handler) {
+	o.s = s
+}
+
+func (o *accessHandler) handleAccess(r res.AccessRequest) {
+	id := r.ResourceName()
+	if o.trans != nil {
+		id = o.trans.RIDToID(id, r.PathParams())
+		if id == "" {
+			r.AccessDenied()
+			return
+		}
+	}
+
+	acl, err := o.getACL(id, r.ResourceName())
+	if err != nil {
+		r.Error(err)
+		return
+	}
+	if acl == nil {
+		r.AccessDenied()
+		return
+	}
+	if o.access != nil {
+		r.Access(o.access(r, acl))
+		return
+	}
+	a, ok := acl.(ACL)
+	if !ok {
+		r.Error(errNotACL)
+		return
+	}
+	r.Access(a.Access(r))
+}
+
+// getACL returns the document with the given ID, reading it from the store
+// unless it is cached, and adds rname to the resources using the document. A
+// nil value is returned if the document is not found.
+func (o *accessHandler) getACL(id string, rname string) (interface{}, error) {
+	for {
+		o.mu.Lock()
+		if e, ok := o.cache[id]; ok {
+			e.rnames[rname] = struct{}{}
+			o.ids[rname] = id
+			o.mu.Unlock()
+			return e.acl, nil
+		}
+		ver := o.version
+		o.mu.Unlock()
+
+		acl, err := o.readACL(id)
+		if err != nil {
+			return nil, err
+		}
+
+		o.mu.Lock()
+		// Retry if the store was changed while reading the document.
+		if o.version != ver {
+			o.mu.Unlock()
+			continue
+		}
+		o.cache[id] = &aclEntry{
+			acl:    acl,
+			rnames: map[string]struct{}{rname: {}},
+		}
+		o.ids[rname] = id
+		o.mu.Unlock()
+		return acl, nil
+	}
+}
+
+// readACL reads and transforms the document from the store.
+func (o *accessHandler) readACL(id string) (interface{}, error) {
+	txn := o.st.Read(id)
+	defer txn.Close()
+
+	v, err := txn.Value()
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if o.trans != nil {
+		v, err = o.trans.Transform(id, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// evict stops tracking a resource no longer observed, and removes the document
+// it used from the cache, unless used by other resources.
+func (o *accessHandler) evict(r res.Resource) {
+	rname := r.ResourceName()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id, ok := o.ids[rname]
+	if !ok {
+		return
+	}
+	delete(o.ids, rname)
+	if e, ok := o.cache[id]; ok {
+		delete(e.rnames, rname)
+		if len(e.rnames) == 0 {
+			delete(o.cache, id)
+		}
+	}
+}
+
+func (o *accessHandler) changeHandler(id string, before, after interface{}) {
+	o.mu.Lock()
+	o.version++
+	e, ok := o.cache[id]
+	delete(o.cache, id)
+	if ok {
+		for rname := range e.rnames {
+			if o.ids[rname] == id {
+				delete(o.ids, rname)
+			}
+		}
+	}
+	o.mu.Unlock()
+	if !ok || o.s == nil {
+		return
+	}
+
+	for rname := range e.rnames {
+		r, err := o.s.Resource(rname)
+		if err != nil {
+			o.s.Logger().Errorf("error getting resource %s: %s", rname, err)
+			continue
+		}
+		r.ReaccessEvent()
+	}
+}
@@ -0,0 +1,383 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// Aggregate is an aggregate function over the values in a query result. The
+// aggregate is the sum of the contribution of each value.
+type Aggregate struct {
+	// Value returns the contribution of a value to the aggregate.
+	Value func(v interface{}) float64
+}
+
+// Count returns an Aggregate counting the values in a query result.
+func Count() Aggregate {
+	return Aggregate{Value: func(interface{}) float64 { return 1 }}
+}
+
+// Sum returns an Aggregate summing a number, returned by f, for each value in a
+// query result.
+func Sum(f func(v interface{}) float64) Aggregate {
+	return Aggregate{Value: f}
+}
+
+// AggregateHandler is a res.Service handler for get requests of model
+// resources, with properties aggregating the results of a query to an
+// underlying QueryStore, such as counts and sums. It listens to changes in the
+// QueryStore, and updates the aggregates incrementally, sending change events
+// when they change.
+//
+// The query results must be a []string or []res.Ref slice of store IDs.
+type AggregateHandler struct {
+	// A QueryStore from where to fetch the IDs of the values to aggregate.
+	QueryStore QueryStore
+	// Store from where to read the values. Required unless only Count is used.
+	Store Store
+	// RequestHandler transforms an external request and path param values into
+	// a query that can be handled by the QueryStore.
+	RequestHandler func(rname string, pathParams map[string]string) (url.Values, error)
+	// Aggregates maps model property names to aggregate functions.
+	Aggregates map[string]Aggregate
+	// AffectedResources is called on query change, and should return a list of
+	// resources affected by the change.
+	//
+	// This is only required if the resource contains path parameters.
+	AffectedResources func(res.Pattern, QueryChange) []string
+	// EvictAfter is the duration without any get or access request for a
+	// resource, after which its aggregates are evicted from memory (see
+	// res.OnUnobserved). Defaults to DefaultEvictAfter.
+	EvictAfter time.Duration
+}
+
+var _ res.Option = AggregateHandler{}
+
+type aggregateHandler struct {
+	s       *res.Service
+	pattern res.Pattern
+	qs      QueryStore
+	st      Store
+	rh      func(string, map[string]string) (url.Values, error)
+	props   []string
+	aggs    []Aggregate
+	ar      func(res.Pattern, QueryChange) []string
+	mu      sync.Mutex
+	version uint64 // Incremented on each query change
+	results map[string]*aggregateResult
+}
+
+// aggregateResult holds the aggregates for a resource, and the contribution of
+// each value in the query result.
+type aggregateResult struct {
+	q       url.Values
+	totals  []float64
+	members map[string][]float64
+}
+
+// WithQueryStore returns a new AggregateHandler value with QueryStore set to
+// qstore.
+func (ah AggregateHandler) WithQueryStore(qstore QueryStore) AggregateHandler {
+	ah.QueryStore = qstore
+	return ah
+}
+
+// WithStore returns a new AggregateHandler value with Store set to store.
+func (ah AggregateHandler) WithStore(store Store) AggregateHandler {
+	ah.Store = store
+	return ah
+}
+
+// WithRequestHandler returns a new AggregateHandler value with RequestHandler
+// set to f.
+func (ah AggregateHandler) WithRequestHandler(f func(rname string, pathParams map[string]string) (url.Values, error)) AggregateHandler {
+	ah.RequestHandler = f
+	return ah
+}
+
+// WithAggregate returns a new AggregateHandler value with the aggregate added
+// for the property prop.
+func (ah AggregateHandler) WithAggregate(prop string, agg Aggregate) AggregateHandler {
+	aggs := make(map[string]Aggregate, len(ah.Aggregates)+1)
+	for k, v := range ah.Aggregates {
+		aggs[k] = v
+	}
+	aggs[prop] = agg
+	ah.Aggregates = aggs
+	return ah
+}
+
+// WithAffectedResources returns a new AggregateHandler value with
+// AffectedResources set to f.
+func (ah AggregateHandler) WithAffectedResources(f func(res.Pattern, QueryChange) []string) AggregateHandler {
+	ah.AffectedResources = f
+	return ah
+}
+
+// WithEvictAfter returns a new AggregateHandler value with EvictAfter set to
+// d.
+func (ah AggregateHandler) WithEvictAfter(d time.Duration) AggregateHandler {
+	ah.EvictAfter = d
+	return ah
+}
+
+// SetOption is to implement the res.Option interface.
+func (ah AggregateHandler) SetOption(h *res.Handler) {
+	if ah.QueryStore == nil {
+		panic("no QueryStore is set")
+	}
+	if len(ah.Aggregates) == 0 {
+		panic("no Aggregates are set")
+	}
+	o := &aggregateHandler{
+		qs:      ah.QueryStore,
+		st:      ah.Store,
+		rh:      ah.RequestHandler,
+		ar:      ah.AffectedResources,
+		results: make(map[string]*aggregateResult),
+	}
+	for prop := range ah.Aggregates {
+		o.props = append(o.props, prop)
+	}
+	sort.Strings(o.props)
+	for _, prop := range o.props {
+		agg := ah.Aggregates[prop]
+		if agg.Value == nil {
+			panic("no Value set for aggregate " + prop)
+		}
+		o.aggs = append(o.aggs, agg)
+	}
+	evictAfter := ah.EvictAfter
+	if evictAfter <= 0 {
+		evictAfter = DefaultEvictAfter
+	}
+	h.Option(
+		res.GetModel(o.getModel),
+		res.OnRegister(o.onRegister),
+		res.OnUnobserved(evictAfter, o.evict),
+	)
+	o.qs.OnQueryChange(o.changeHandler)
+}
+
+func (o *aggregateHandler) onRegister(s *res.Service, p res.Pattern, h res.Handler) {
+	if p.IndexWildcard() >= 0 && o.ar == nil {
+		panic("AggregateHandler requires an AffectedResources callback when handling resources with tags or wildcards: " + string(p))
+	}
+	o.s = s
+	o.pattern = p
+}
+
+func (o *aggregateHandler) getModel(r res.ModelRequest) {
+	rname := r.ResourceName()
+	o.mu.Lock()
+	ar, ok := o.results[rname]
+	if ok {
+		m := o.model(ar.totals)
+		o.mu.Unlock()
+		r.Model(m)
+		return
+	}
+	o.mu.Unlock()
+
+	var q url.Values
+	if o.rh != nil {
+		var err error
+		q, err = o.rh(rname, r.PathParams())
+		if err != nil {
+			r.Error(err)
+			return
+		}
+	}
+	for {
+		o.mu.Lock()
+		ver := o.version
+		o.mu.Unlock()
+
+		ar, err := o.aggregate(q)
+		if err != nil {
+			r.Error(err)
+			return
+		}
+
+		o.mu.Lock()
+		// Keep any result computed by a concurrent get request.
+		if prev, ok := o.results[rname]; ok {
+			ar = prev
+		} else if o.version != ver {
+			// Retry if the query store was changed while aggregating.
+			o.mu.Unlock()
+			continue
+		} else {
+			o.results[rname] = ar
+		}
+		m := o.model(ar.totals)
+		o.mu.Unlock()
+		r.Model(m)
+		return
+	}
+}
+
+// evict removes the aggregates of a resource no longer observed.
+func (o *aggregateHandler) evict(r res.Resource) {
+	o.mu.Lock()
+	delete(o.results, r.ResourceName())
+	o.mu.Unlock()
+}
+
+// aggregate queries the QueryStore and computes the aggregates from scratch.
+func (o *aggregateHandler) aggregate(q url.Values) (*aggregateResult, error) {
+	result, err := o.qs.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	switch v := result.(type) {
+	case []string:
+		ids = v
+	case []res.Ref:
+		ids = make([]string, len(v))
+		for i, ref := range v {
+			ids[i] = string(ref)
+		}
+	default:
+		return nil, res.InternalError(fmt.Errorf("invalid aggregate query result type %T", result))
+	}
+
+	ar := &aggregateResult{
+		q:       q,
+		totals:  make([]float64, len(o.aggs)),
+		members: make(map[string][]float64, len(ids)),
+	}
+	for _, id := range ids {
+		var v interface{}
+		if o.st != nil {
+			txn := o.st.Read(id)
+			v, err = txn.Value()
+			txn.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		c := o.contributions(v)
+		ar.members[id] = c
+		for i, n := range c {
+			ar.totals[i] += n
+		}
+	}
+	return ar, nil
+}
+
+func (o *aggregateHandler) changeHandler(qc QueryChange) {
+	o.mu.Lock()
+	o.version++
+	o.mu.Unlock()
+	if o.ar != nil {
+		for _, rid := range o.ar(o.pattern, qc) {
+			o.update(rid, qc)
+		}
+	} else {
+		o.update(string(o.pattern), qc)
+	}
+}
+
+// update applies the change to the aggregates of the resource, and sends a
+// change event if any aggregate changed. Resources not yet requested are
+// ignored.
+func (o *aggregateHandler) update(rid string, qc QueryChange) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ar, ok := o.results[rid]
+	if !ok {
+		return
+	}
+
+	evs, reset, err := qc.Events(ar.q)
+	if err != nil {
+		o.errorf("AggregateHandler encountered error getting events for resource %s: %s", rid, err)
+		return
+	}
+
+	var totals []float64
+	if reset {
+		nar, err := o.aggregate(ar.q)
+		if err != nil {
+			o.errorf("AggregateHandler encountered error aggregating resource %s: %s", rid, err)
+			delete(o.results, rid)
+			return
+		}
+		totals = ar.totals
+		o.results[rid] = nar
+		ar = nar
+	} else {
+		totals = make([]float64, len(ar.totals))
+		copy(totals, ar.totals)
+		id := qc.ID()
+		_, isMember := ar.members[id]
+		for _, ev := range evs {
+			switch ev.Name {
+			case "add":
+				isMember = true
+			case "remove":
+				isMember = false
+			}
+		}
+		// Replace the contributions of the previous value with the new.
+		if prev, ok := ar.members[id]; ok {
+			for i, n := range prev {
+				ar.totals[i] -= n
+			}
+			delete(ar.members, id)
+		}
+		if isMember && qc.After() != nil {
+			c := o.contributions(qc.After())
+			ar.members[id] = c
+			for i, n := range c {
+				ar.totals[i] += n
+			}
+		}
+	}
+
+	changed := make(map[string]interface{})
+	for i, prop := range o.props {
+		if totals[i] != ar.totals[i] {
+			changed[prop] = ar.totals[i]
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	r, err := o.s.Resource(rid)
+	if err != nil {
+		o.errorf("AggregateHandler encountered error getting resource %s: %s", rid, err)
+		return
+	}
+	r.ChangeEvent(changed)
+}
+
+func (o *aggregateHandler) contributions(v interface{}) []float64 {
+	c := make([]float64, len(o.aggs))
+	for i, agg := range o.aggs {
+		c[i] = agg.Value(v)
+	}
+	return c
+}
+
+func (o *aggregateHandler) model(totals []float64) map[string]interface{} {
+	m := make(map[string]interface{}, len(o.props))
+	for i, prop := range o.props {
+		m[prop] = totals[i]
+	}
+	return m
+}
+
+func (o *aggregateHandler) errorf(format string, v ...interface{}) {
+	l := o.s.Logger()
+	if l != nil {
+		l.Errorf(format, v...)
+	}
+}
@@ -0,0 +1,269 @@
+package badgerstore
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger"
+)
+
+// RebuildProgress describes the progress of a background index rebuild.
+type RebuildProgress struct {
+	// Indexed is the number of stored values indexed.
+	Indexed int
+	// Added is the number of missing index entries added.
+	Added int
+	// Swept is the number of index entries verified against the stored values.
+	Swept int
+	// Removed is the number of stale index entries removed.
+	Removed int
+	// Done is true once the rebuild has completed or failed.
+	Done bool
+	// Err is the error causing the rebuild to fail, if any.
+	Err error
+}
+
+// IndexEntry identifies an index entry.
+type IndexEntry struct {
+	// Index is the name of the index.
+	Index string
+	// Key is the index value, as returned by the Index Key callback.
+	Key string
+	// ID is the ID of the indexed resource.
+	ID string
+}
+
+// IndexReport is the result of an index consistency check.
+type IndexReport struct {
+	// Missing contains index entries missing for stored values.
+	Missing []IndexEntry
+	// Stale contains index entries not matching any stored value.
+	Stale []IndexEntry
+}
+
+// Consistent returns true if no index entries are missing or stale.
+func (r IndexReport) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Stale) == 0
+}
+
+// rebuildBatchSize is the maximum number of values, or index entries, handled
+// in a single transaction when scanning the indexes.
+const rebuildBatchSize = 1000
+
+// indexScan scans the stored values and index entries, optionally fixing any
+// inconsistencies.
+type indexScan struct {
+	qs       *QueryStore
+	fix      bool
+	progress func(RebuildProgress)
+	p        RebuildProgress
+	report   IndexReport
+}
+
+// RebuildIndexesAsync rebuilds the indexes in the background, without
+// dropping the current index entries. Missing entries are added for all
+// stored values, after which the index entries are swept and stale entries
+// removed.
+//
+// The work is done in batches, interleaved with index updates of changed
+// values, so that queries and writes are served during the rebuild, with
+// queries possibly returning incomplete results until the rebuild is done.
+//
+// The progress callback, if not nil, is called after each batch, and a final
+// time with Done set. The returned channel receives the result once the
+// rebuild is done.
+func (qs *QueryStore) RebuildIndexesAsync(progress func(RebuildProgress)) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		sc := indexScan{qs: qs, fix: true, progress: progress}
+		err := sc.run()
+		sc.p.Done = true
+		sc.p.Err = err
+		sc.reportProgress()
+		ch <- err
+	}()
+	return ch
+}
+
+// CheckIndexes checks the consistency between the stored values and the
+// index entries, and returns a report of missing and stale entries. No entries
+// are modified.
+//
+// The check is done in batches in the same way as RebuildIndexesAsync. Values
+// changed during the check may be reported as inconsistent.
+func (qs *QueryStore) CheckIndexes() (IndexReport, error) {
+	sc := indexScan{qs: qs}
+	if err := sc.run(); err != nil {
+		return IndexReport{}, err
+	}
+	return sc.report, nil
+}
+
+// run scans all stored values, and then all index entries.
+func (sc *indexScan) run() error {
+	prefix := []byte(sc.qs.st.prefix)
+	for seek := prefix; seek != nil; {
+		err := sc.batch(func(txn *badger.Txn) (err error) {
+			seek, err = sc.scanValues(txn, prefix, seek)
+			return
+		})
+		if err != nil {
+			return err
+		}
+		sc.reportProgress()
+	}
+	for _, idx := range sc.qs.idxs {
+		prefix := idx.getQuery(nil)
+		for seek := prefix; seek != nil; {
+			err := sc.batch(func(txn *badger.Txn) (err error) {
+				seek, err = sc.sweepIndex(txn, idx, prefix, seek)
+				return
+			})
+			if err != nil {
+				return err
+			}
+			sc.reportProgress()
+		}
+	}
+	return nil
+}
+
+// batch calls cb with a new transaction on the indexing queue, to not
+// interleave with index updates, and waits for it to complete.
+func (sc *indexScan) batch(cb func(txn *badger.Txn) error) error {
+	done := make(chan error, 1)
+	sc.qs.tq.Do(func() {
+		done <- sc.qs.st.DB.Update(cb)
+	})
+	return <-done
+}
+
+func (sc *indexScan) reportProgress() {
+	if sc.progress != nil {
+		sc.progress(sc.p)
+	}
+}
+
+// scanValues ensures index entries exists for a batch of stored values,
+// starting at the seek key. It returns the key to seek for the next batch, or
+// nil if there are no more values.
+func (sc *indexScan) scanValues(txn *badger.Txn, prefix, seek []byte) ([]byte, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	n := 0
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		if n == rebuildBatchSize {
+			return item.KeyCopy(nil), nil
+		}
+		n++
+		key := item.Key()
+		if !sc.qs.isValueKey(key) || isExpired(item) {
+			continue
+		}
+		v, err := sc.qs.st.unmarshalItem(item)
+		if err != nil {
+			return nil, err
+		}
+		rname := item.KeyCopy(nil)[len(prefix):]
+		for _, idx := range sc.qs.idxs {
+			iv := idx.Key(v)
+			if iv == nil {
+				continue
+			}
+			k := idx.getKey(rname, iv)
+			_, err := txn.Get(k)
+			if err == nil {
+				continue
+			}
+			if err != badger.ErrKeyNotFound {
+				return nil, err
+			}
+			sc.report.Missing = append(sc.report.Missing, IndexEntry{Index: idx.Name, Key: string(iv), ID: string(rname)})
+			if sc.fix {
+				if err := txn.Set(k, nil); err != nil {
+					return nil, err
+				}
+				sc.p.Added++
+			}
+		}
+		sc.p.Indexed++
+	}
+	return nil, nil
+}
+
+// sweepIndex verifies a batch of index entries against the stored values,
+// starting at the seek key. It returns the key to seek for the next batch, or
+// nil if there are no more entries.
+func (sc *indexScan) sweepIndex(txn *badger.Txn, idx Index, prefix, seek []byte) ([]byte, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	n := 0
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		if n == rebuildBatchSize {
+			return item.KeyCopy(nil), nil
+		}
+		n++
+		k := item.KeyCopy(nil)
+		var iv, rname []byte
+		if i := bytes.LastIndexByte(k, idSeparator); i >= len(prefix) {
+			iv, rname = k[len(prefix):i], k[i+1:]
+		}
+		ok, err := sc.qs.isValidEntry(txn, idx, iv, rname)
+		if err != nil {
+			return nil, err
+		}
+		sc.p.Swept++
+		if ok {
+			continue
+		}
+		sc.report.Stale = append(sc.report.Stale, IndexEntry{Index: idx.Name, Key: string(iv), ID: string(rname)})
+		if sc.fix {
+			if err := txn.Delete(k); err != nil {
+				return nil, err
+			}
+			sc.p.Removed++
+		}
+	}
+	return nil, nil
+}
+
+// isValidEntry returns true if the stored value for the resource name, rname,
+// exists and has the index value iv.
+func (qs *QueryStore) isValidEntry(txn *badger.Txn, idx Index, iv, rname []byte) (bool, error) {
+	if rname == nil {
+		return false, nil
+	}
+	item, err := txn.Get(append([]byte(qs.st.prefix), rname...))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if isExpired(item) {
+		return false, nil
+	}
+	v, err := qs.st.unmarshalItem(item)
+	if err != nil {
+		return false, err
+	}
+	k := idx.Key(v)
+	return k != nil && bytes.Equal(k, iv), nil
+}
+
+// isValueKey returns true if the key is not an index entry or a store
+// flag, such as the init key. It is needed when the store has no prefix.
+func (qs *QueryStore) isValueKey(key []byte) bool {
+	if len(key) > 0 && key[0] == '$' {
+		return false
+	}
+	for _, idx := range qs.idxs {
+		if bytes.HasPrefix(key, idx.getQuery(nil)) {
+			return false
+		}
+	}
+	return true
+}
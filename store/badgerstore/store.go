@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger"
 	res "github.com/jirenius/go-res"
@@ -27,9 +29,18 @@ type Store struct {
 	useMarshal   bool
 	beforeChange []func(id string, before, after interface{}) error
 	onChange     []func(id string, before, after interface{})
+	ttl          func(id string, v interface{}) time.Duration
+	dispatch     func(id string, v interface{}, expire func())
+	mu           sync.Mutex
+	timers       map[string]*time.Timer
 }
 
-var _ store.Store = &Store{}
+var _ store.ExpiringStore = &Store{}
+
+// expireGrace is the number of seconds an expired value is kept in the
+// database, for the store to delete it and trigger the OnChange callbacks,
+// before BadgerDB discards it.
+const expireGrace = 5 * 60
 
 type readTxn struct {
 	st     *Store
@@ -83,6 +94,70 @@ func (st *Store) SetType(typ interface{}) *Store {
 	return st
 }
 
+// SetTTL sets the time to live for all values written to the store. Once a
+// value has expired, it is deleted and the OnChange callbacks are called with
+// the after-value set to nil. A duration of zero or less means the values
+// never expire.
+//
+// The TTL is set on create and update, and has a precision of one second.
+func (st *Store) SetTTL(d time.Duration) *Store {
+	if d <= 0 {
+		st.ttl = nil
+	} else {
+		st.ttl = func(string, interface{}) time.Duration { return d }
+	}
+	return st
+}
+
+// SetTTLFunc sets a callback that returns the time to live for a value, v,
+// written to the store with the resource ID, id. A returned duration of zero or
+// less means the value never expires. See SetTTL.
+func (st *Store) SetTTLFunc(cb func(id string, v interface{}) time.Duration) *Store {
+	st.ttl = cb
+	return st
+}
+
+// SetExpireDispatch sets the function used to dispatch the deletion of an
+// expired value. It is called with the ID and value of the expired resource,
+// and must call expire on the goroutine where change events for the resource
+// are to be sent. If no dispatch function is set, expire is called on the
+// timer's goroutine.
+//
+// A store.Handler using the store sets the dispatch function on registration.
+func (st *Store) SetExpireDispatch(dispatch func(id string, v interface{}, expire func())) {
+	st.dispatch = dispatch
+}
+
+// ScheduleExpiry schedules the deletion of all expiring values in the store.
+// It should be called on startup, after the service has been started, for
+// values written by a previous process to expire. Values expired for more than
+// five minutes are discarded by BadgerDB without triggering the OnChange
+// callbacks.
+func (st *Store) ScheduleExpiry() error {
+	expires := make(map[string]uint64)
+	err := st.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(st.prefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if exp := item.ExpiresAt(); exp != 0 {
+				expires[string(item.Key()[len(prefix):])] = exp - expireGrace
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, exp := range expires {
+		st.schedule(id, exp)
+	}
+	return nil
+}
+
 // Type returns a zero-value of the type used by the store for unmarshaling
 // values.
 func (st *Store) Type() interface{} {
@@ -191,13 +266,19 @@ func (wt writeTxn) Create(v interface{}) error {
 		return fmt.Errorf("create value is of type %s, expected type %s", vv.Type().String(), t.String())
 	}
 
+	var expired interface{}
+	var exp uint64
 	err := wt.st.DB.Update(func(txn *badger.Txn) error {
-		// Validate that the resource doesn't exist
-		_, err := txn.Get(wt.rname)
+		// Validate that the resource doesn't exist, or has expired
+		item, err := txn.Get(wt.rname)
 		if err == nil {
-			return fmt.Errorf("cannot create because value for %s already exists", wt.id)
-		}
-		if err != badger.ErrKeyNotFound {
+			if !isExpired(item) {
+				return fmt.Errorf("cannot create because value for %s already exists", wt.id)
+			}
+			if expired, err = wt.st.unmarshalItem(item); err != nil {
+				return err
+			}
+		} else if err != badger.ErrKeyNotFound {
 			return err
 		}
 
@@ -208,12 +289,17 @@ func (wt writeTxn) Create(v interface{}) error {
 		}
 
 		// Marshal the value and store it in the database
-		return wt.st.setValue(txn, wt.rname, v)
+		exp, err = wt.st.setValue(txn, wt.rname, wt.id, v)
+		return err
 	})
 	if err != nil {
 		return err
 	}
 
+	wt.st.schedule(wt.id, exp)
+	if expired != nil {
+		wt.st.callOnChange(wt.id, expired, nil)
+	}
 	wt.st.callOnChange(wt.id, nil, v)
 	return nil
 }
@@ -231,6 +317,7 @@ func (wt writeTxn) Update(v interface{}) error {
 		return fmt.Errorf("update value is of type %s, expected type %s", vv.Type().String(), t.String())
 	}
 	var before interface{}
+	var exp uint64
 	err := wt.st.DB.Update(func(txn *badger.Txn) error {
 		var err error
 		// Get before value
@@ -250,7 +337,8 @@ func (wt writeTxn) Update(v interface{}) error {
 		}
 
 		// Marshal new value and update
-		return wt.st.setValue(txn, wt.rname, v)
+		exp, err = wt.st.setValue(txn, wt.rname, wt.id, v)
+		return err
 	})
 	if err != nil {
 		if err == badger.ErrKeyNotFound {
@@ -259,6 +347,7 @@ func (wt writeTxn) Update(v interface{}) error {
 		return err
 	}
 
+	wt.st.schedule(wt.id, exp)
 	wt.st.callOnChange(wt.id, before, v)
 	return nil
 }
@@ -301,6 +390,7 @@ func (wt writeTxn) Delete() error {
 		return err
 	}
 
+	wt.st.schedule(wt.id, 0)
 	wt.st.callOnChange(wt.id, before, nil)
 	return nil
 }
@@ -320,7 +410,8 @@ func (st *Store) OnChange(cb func(id string, before, after interface{})) {
 // (where <prefix> is the set prefix), to mark the store as initialized.
 func (st *Store) Init(cb func(add func(id string, v interface{})) error) error {
 	created := make(map[string]interface{})
-	return st.DB.Update(func(txn *badger.Txn) error {
+	expires := make(map[string]uint64)
+	err := st.DB.Update(func(txn *badger.Txn) error {
 		var err error
 		initKey := []byte(`$` + st.prefix + `init`)
 		// Check init flag key
@@ -376,10 +467,12 @@ func (st *Store) Init(cb func(add func(id string, v interface{})) error) error {
 			if err != badger.ErrKeyNotFound {
 				return err
 			}
-			if err := st.setValue(txn, rname, v); err != nil {
+			exp, err := st.setValue(txn, rname, id, v)
+			if err != nil {
 				return err
 			}
 			created[id] = v
+			expires[id] = exp
 		}
 
 		// Call OnChange callback
@@ -390,9 +483,17 @@ func (st *Store) Init(cb func(add func(id string, v interface{})) error) error {
 		// Set init flag key
 		return txn.Set(initKey, nil)
 	})
+	if err != nil {
+		return err
+	}
+	for id, exp := range expires {
+		st.schedule(id, exp)
+	}
+	return nil
 }
 
-// getValue gets a value from the database and unmarshals it.
+// getValue gets a value from the database and unmarshals it. An expired value
+// is treated as not found.
 func (st *Store) getValue(txn *badger.Txn, key []byte) (interface{}, error) {
 	item, err := txn.Get(key)
 	if err != nil {
@@ -401,8 +502,16 @@ func (st *Store) getValue(txn *badger.Txn, key []byte) (interface{}, error) {
 		}
 		return nil, err
 	}
+	if isExpired(item) {
+		return nil, res.ErrNotFound
+	}
+	return st.unmarshalItem(item)
+}
+
+// unmarshalItem unmarshals the value of a database item.
+func (st *Store) unmarshalItem(item *badger.Item) (interface{}, error) {
 	var v interface{}
-	if err = item.Value(func(dta []byte) error {
+	if err := item.Value(func(dta []byte) error {
 		t := st.t
 		if t == nil {
 			t = interfaceMapType
@@ -428,6 +537,13 @@ func (st *Store) getValue(txn *badger.Txn, key []byte) (interface{}, error) {
 	return v, nil
 }
 
+// isExpired returns true if the item has expired, but is still kept by
+// BadgerDB during the grace period.
+func isExpired(item *badger.Item) bool {
+	exp := item.ExpiresAt()
+	return exp != 0 && exp-expireGrace <= uint64(time.Now().Unix())
+}
+
 // BeforeChange adds a listener callback that is called before a value is
 // created, updated, or deleted from the database.
 //
@@ -436,8 +552,9 @@ func (st *Store) BeforeChange(cb func(id string, before, after interface{}) erro
 	st.beforeChange = append(st.beforeChange, cb)
 }
 
-// setValue marshals a value and updates the database.
-func (st *Store) setValue(txn *badger.Txn, key []byte, v interface{}) error {
+// setValue marshals a value and updates the database. It returns the time, in
+// Unix seconds, when the value expires, or 0 if it never expires.
+func (st *Store) setValue(txn *badger.Txn, key []byte, id string, v interface{}) (uint64, error) {
 	var err error
 	var dta []byte
 	if st.useMarshal {
@@ -446,9 +563,125 @@ func (st *Store) setValue(txn *badger.Txn, key []byte, v interface{}) error {
 		dta, err = json.Marshal(v)
 	}
 	if err != nil {
+		return 0, err
+	}
+	e := badger.NewEntry(key, dta)
+	exp := st.expiresAt(id, v)
+	if exp != 0 {
+		// Let BadgerDB keep the value during a grace period, to allow the
+		// store to delete it and call the OnChange callbacks.
+		e.ExpiresAt = exp + expireGrace
+	}
+	return exp, txn.SetEntry(e)
+}
+
+// expiresAt returns the time, in Unix seconds rounded up, when a value written
+// now expires, or 0 if it never expires.
+func (st *Store) expiresAt(id string, v interface{}) uint64 {
+	if st.ttl == nil {
+		return 0
+	}
+	d := st.ttl(id, v)
+	if d <= 0 {
+		return 0
+	}
+	t := time.Now().Add(d)
+	exp := t.Unix()
+	if t.Nanosecond() > 0 {
+		exp++
+	}
+	return uint64(exp)
+}
+
+// schedule sets a timer to expire the value for the resource ID, id, at exp,
+// in Unix seconds, replacing any previous timer. If exp is 0, any previous
+// timer is stopped.
+func (st *Store) schedule(id string, exp uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if t, ok := st.timers[id]; ok {
+		t.Stop()
+		delete(st.timers, id)
+	}
+	if exp == 0 {
+		return
+	}
+	if st.timers == nil {
+		st.timers = make(map[string]*time.Timer)
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(time.Unix(int64(exp), 0)), func() {
+		st.mu.Lock()
+		if st.timers[id] != t {
+			st.mu.Unlock()
+			return
+		}
+		delete(st.timers, id)
+		st.mu.Unlock()
+		st.expire(id)
+	})
+	st.timers[id] = t
+}
+
+// expire dispatches the deletion of the value for the resource ID, id, if it
+// has expired.
+func (st *Store) expire(id string) {
+	var v interface{}
+	var exp uint64
+	err := st.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(st.prefix + id))
+		if err != nil {
+			return err
+		}
+		if !isExpired(item) {
+			// Not yet expired, such as by clock adjustments.
+			if exp = item.ExpiresAt(); exp != 0 {
+				exp -= expireGrace
+			}
+			return nil
+		}
+		v, err = st.unmarshalItem(item)
 		return err
+	})
+	if err != nil {
+		return
+	}
+	if v == nil {
+		st.schedule(id, exp)
+		return
+	}
+	if st.dispatch != nil {
+		st.dispatch(id, v, func() { st.deleteExpired(id) })
+	} else {
+		st.deleteExpired(id)
+	}
+}
+
+// deleteExpired deletes the value for the resource ID, id, if it has expired,
+// and calls the OnChange callbacks.
+func (st *Store) deleteExpired(id string) {
+	st.kl.Lock(id)
+	defer st.kl.Unlock(id)
+	rname := []byte(st.prefix + id)
+	var before interface{}
+	err := st.DB.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(rname)
+		if err != nil {
+			return err
+		}
+		// Skip if the value has been replaced since it expired.
+		if !isExpired(item) {
+			return nil
+		}
+		if before, err = st.unmarshalItem(item); err != nil {
+			return err
+		}
+		return txn.Delete(rname)
+	})
+	if err != nil || before == nil {
+		return
 	}
-	return txn.Set(key, dta)
+	st.callOnChange(id, before, nil)
 }
 
 // callOnChange loops through OnChange listeners and calls them.
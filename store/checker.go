@@ -0,0 +1,305 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	res "github.com/jirenius/go-res"
+)
+
+// DefaultCheckInterval is the interval between check runs of a Checker with
+// no Interval set.
+const DefaultCheckInterval = time.Minute
+
+// Checker periodically samples resources, and compares the value in a Store
+// with the value served by the resource's get handler, and optionally with
+// the value cached by the gateway. It is used to catch bugs where the events
+// sent and the persisted values have diverged.
+//
+// The stored and served values are compared on the resource's worker
+// goroutine, so that no change is applied in between. Values are compared by
+// their JSON encoding.
+type Checker struct {
+	// Service is the service serving the resources.
+	Service *res.Service
+
+	// Store is the store containing the resources.
+	Store Store
+
+	// Transformer, if not nil, transforms the resource IDs to store IDs, and
+	// the stored values to the values served.
+	Transformer Transformer
+
+	// RIDs returns the resource IDs to sample from in a check run.
+	RIDs func() ([]string, error)
+
+	// SampleSize is the maximum number of resources randomly sampled in each
+	// check run. Zero means all resources are checked.
+	SampleSize int
+
+	// Interval is the duration between check runs started with Start.
+	// Defaults to DefaultCheckInterval.
+	Interval time.Duration
+
+	// Gateway, if not nil, returns the value of a resource as cached by the
+	// gateway, such as by making an HTTP get request to Resgate. The value is
+	// compared with the served value. As the request is made outside of the
+	// resource's worker goroutine, a concurrent change may be reported as
+	// drift.
+	Gateway func(rid string) (interface{}, error)
+
+	// OnDrift is called with each detected drift. If nil, drifts are logged
+	// as errors using the service's logger.
+	OnDrift func(Drift)
+
+	mu    sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+	stats CheckStats
+}
+
+// Drift describes a resource with a value that differs between the store, the
+// get handler, and the gateway.
+type Drift struct {
+	// RID is the resource ID.
+	RID string
+	// Stored is the transformed stored value. Nil if not found.
+	Stored interface{}
+	// Served is the value served by the get handler. Nil if not found.
+	Served interface{}
+	// Cached is the value cached by the gateway. Nil if not checked, or if
+	// not found.
+	Cached interface{}
+	// Gateway is true if the drift is between the served value and the value
+	// cached by the gateway, rather than between the stored and served value.
+	Gateway bool
+}
+
+// CheckStats holds the statistics of a Checker.
+type CheckStats struct {
+	// Runs is the number of completed check runs.
+	Runs int
+	// Checked is the number of checked resources.
+	Checked int
+	// Drifted is the number of detected drifts.
+	Drifted int
+	// Failed is the number of resources that could not be checked.
+	Failed int
+}
+
+// Start starts checking in the background, until Stop is called. Calling
+// Start on a started Checker does nothing.
+func (c *Checker) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	c.stop, c.done = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := c.Check(); err != nil {
+					c.Service.Logger().Errorf("Consistency check failed: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking in the background, and waits for any ongoing check run
+// to complete.
+func (c *Checker) Stop() {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Stats returns the statistics of the checks made.
+func (c *Checker) Stats() CheckStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Check makes a single check run of a sample of the resources, and returns
+// any detected drifts. Resources that could not be checked are logged as
+// errors. An error is returned if the resource IDs could not be retrieved.
+//
+// Check must not be called from a worker goroutine.
+func (c *Checker) Check() ([]Drift, error) {
+	rids, err := c.RIDs()
+	if err != nil {
+		return nil, err
+	}
+	if c.SampleSize > 0 && len(rids) > c.SampleSize {
+		sample := make([]string, c.SampleSize)
+		for i, j := range rand.Perm(len(rids))[:c.SampleSize] {
+			sample[i] = rids[j]
+		}
+		rids = sample
+	}
+
+	var drifts []Drift
+	var failed int
+	for _, rid := range rids {
+		d, err := c.checkResource(rid)
+		if err != nil {
+			failed++
+			c.Service.Logger().Errorf("Consistency check of %s failed: %s", rid, err)
+			continue
+		}
+		if d != nil {
+			drifts = append(drifts, *d)
+			c.report(*d)
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Runs++
+	c.stats.Checked += len(rids) - failed
+	c.stats.Drifted += len(drifts)
+	c.stats.Failed += failed
+	c.mu.Unlock()
+	return drifts, nil
+}
+
+// report calls OnDrift with the drift, or logs it if OnDrift is nil.
+func (c *Checker) report(d Drift) {
+	if c.OnDrift != nil {
+		c.OnDrift(d)
+		return
+	}
+	if d.Gateway {
+		c.Service.Logger().Errorf("Drift detected for %s: served value %s, gateway value %s", d.RID, jsonString(d.Served), jsonString(d.Cached))
+	} else {
+		c.Service.Logger().Errorf("Drift detected for %s: stored value %s, served value %s", d.RID, jsonString(d.Stored), jsonString(d.Served))
+	}
+}
+
+// checkResource compares the values of a single resource. It returns a nil
+// drift if the values are equal.
+func (c *Checker) checkResource(rid string) (*Drift, error) {
+	type result struct {
+		stored interface{}
+		served interface{}
+		err    error
+	}
+	ch := make(chan result, 1)
+	err := c.Service.With(rid, func(r res.Resource) {
+		var rs result
+		rs.stored, rs.err = c.storedValue(r)
+		if rs.err == nil {
+			rs.served, rs.err = servedValue(r)
+		}
+		ch <- rs
+	})
+	if err != nil {
+		return nil, err
+	}
+	rs := <-ch
+	if rs.err != nil {
+		return nil, rs.err
+	}
+	if !reflect.DeepEqual(rs.stored, rs.served) {
+		return &Drift{RID: rid, Stored: rs.stored, Served: rs.served}, nil
+	}
+	if c.Gateway == nil {
+		return nil, nil
+	}
+	v, err := c.Gateway(rid)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	cached, err := normalizeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(rs.served, cached) {
+		return &Drift{RID: rid, Stored: rs.stored, Served: rs.served, Cached: cached, Gateway: true}, nil
+	}
+	return nil, nil
+}
+
+// storedValue returns the normalized transformed value of the resource in
+// the store, or nil if not found.
+func (c *Checker) storedValue(r res.Resource) (interface{}, error) {
+	id := r.ResourceName()
+	if c.Transformer != nil {
+		id = c.Transformer.RIDToID(id, r.PathParams())
+		if id == "" {
+			return nil, nil
+		}
+	}
+	txn := c.Store.Read(id)
+	defer txn.Close()
+	v, err := txn.Value()
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if c.Transformer != nil {
+		if v, err = c.Transformer.Transform(id, v); err != nil {
+			return nil, err
+		}
+	}
+	return normalizeValue(v)
+}
+
+// servedValue returns the normalized value served by the get handler, or nil
+// if not found.
+func servedValue(r res.Resource) (interface{}, error) {
+	v, err := r.Value()
+	if err != nil {
+		if res.ToError(err).Code == res.CodeNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return normalizeValue(v)
+}
+
+// normalizeValue returns the value as unmarshaled from its JSON encoding, to
+// compare values of different types.
+func normalizeValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var nv interface{}
+	err = json.Unmarshal(data, &nv)
+	return nv, err
+}
+
+// jsonString returns the JSON encoding of a normalized value.
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -2,6 +2,7 @@ package mockstore
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/jirenius/go-res/store"
 )
@@ -15,6 +16,8 @@ type QueryStore struct {
 
 	// OnQuery handles calls to Query.
 	OnQuery func(q url.Values) (interface{}, error)
+
+	sc script
 }
 
 // Assert *QueryStore implements the store.QueryStore interface.
@@ -47,9 +50,25 @@ func NewQueryStore(cb func(q url.Values) (interface{}, error)) *QueryStore {
 // Query returns a collection of references to store ID's matching
 // the query. If error is non-nil the reference slice is nil.
 func (qs *QueryStore) Query(q url.Values) (interface{}, error) {
+	if err := qs.sc.run(OpQuery); err != nil {
+		return nil, err
+	}
 	return qs.OnQuery(q)
 }
 
+// SetLatency sets a delay added to each Query call.
+func (qs *QueryStore) SetLatency(d time.Duration) *QueryStore {
+	qs.sc.setLatency(d)
+	return qs
+}
+
+// FailNext queues errors to be returned by the next calls to Query, in the
+// given order, without calling OnQuery.
+func (qs *QueryStore) FailNext(errs ...error) *QueryStore {
+	qs.sc.failNext(OpQuery, errs)
+	return qs
+}
+
 // OnQueryChange adds a listener callback that is triggered using the
 // TriggerQueryChange.
 func (qs *QueryStore) OnQueryChange(cb func(store.QueryChange)) {
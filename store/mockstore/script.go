@@ -0,0 +1,60 @@
+package mockstore
+
+import (
+	"sync"
+	"time"
+)
+
+// Op is a store operation that may be scripted to fail.
+type Op string
+
+// Store operations.
+const (
+	OpExists Op = "exists"
+	OpValue  Op = "value"
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+	OpQuery  Op = "query"
+)
+
+// script holds scripted failures and latency for a mock store.
+type script struct {
+	mu       sync.Mutex
+	latency  time.Duration
+	failures map[Op][]error
+}
+
+// setLatency sets the delay added to each operation.
+func (sc *script) setLatency(d time.Duration) {
+	sc.mu.Lock()
+	sc.latency = d
+	sc.mu.Unlock()
+}
+
+// failNext queues errors to be returned by the next calls to the operation.
+func (sc *script) failNext(op Op, errs []error) {
+	sc.mu.Lock()
+	if sc.failures == nil {
+		sc.failures = make(map[Op][]error)
+	}
+	sc.failures[op] = append(sc.failures[op], errs...)
+	sc.mu.Unlock()
+}
+
+// run waits for any scripted latency, and returns the next queued error for
+// the operation, or nil if no error is queued.
+func (sc *script) run(op Op) error {
+	sc.mu.Lock()
+	d := sc.latency
+	var err error
+	if errs := sc.failures[op]; len(errs) > 0 {
+		err = errs[0]
+		sc.failures[op] = errs[1:]
+	}
+	sc.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+	return err
+}
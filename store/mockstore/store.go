@@ -3,6 +3,7 @@ package mockstore
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/jirenius/go-res/store"
 )
@@ -48,6 +49,8 @@ type Store struct {
 	// or an error. Default behavior is to delete the Resources value if it
 	// exists, or return store.ErrNotFound if not found.
 	OnDelete func(st *Store, id string) (interface{}, error)
+
+	sc script
 }
 
 // Assert *Store implements the store.Store interface.
@@ -79,6 +82,22 @@ func (st *Store) Add(id string, v interface{}) *Store {
 	return st
 }
 
+// SetLatency sets a delay added to each Exists, Value, Create, Update, and
+// Delete call.
+func (st *Store) SetLatency(d time.Duration) *Store {
+	st.sc.setLatency(d)
+	return st
+}
+
+// FailNext queues errors to be returned by the next calls to the operation,
+// op, in the given order. A scripted error is returned before any OnX
+// override or Resources lookup is made. For OpExists, any error results in
+// Exists returning false.
+func (st *Store) FailNext(op Op, errs ...error) *Store {
+	st.sc.failNext(op, errs)
+	return st
+}
+
 // Read makes a read-lock for the resource that lasts until Close is called.
 func (st *Store) Read(id string) store.ReadTxn {
 	st.RLock()
@@ -118,6 +137,10 @@ func (rt readTxn) Exists() bool {
 		return false
 	}
 
+	if rt.st.sc.run(OpExists) != nil {
+		return false
+	}
+
 	if rt.st.OnExists != nil {
 		return rt.st.OnExists(rt.st, rt.id)
 	}
@@ -134,6 +157,10 @@ func (rt readTxn) Value() (interface{}, error) {
 		return nil, store.ErrNotFound
 	}
 
+	if err := rt.st.sc.run(OpValue); err != nil {
+		return nil, err
+	}
+
 	if rt.st.OnValue != nil {
 		return rt.st.OnValue(rt.st, rt.id)
 	}
@@ -165,7 +192,10 @@ func (wt writeTxn) Create(v interface{}) error {
 		}
 	}
 
-	var err error
+	err := wt.st.sc.run(OpCreate)
+	if err != nil {
+		return err
+	}
 	if wt.st.OnCreate != nil {
 		err = wt.st.OnCreate(wt.st, wt.id, v)
 	} else {
@@ -197,6 +227,10 @@ func (wt writeTxn) Update(v interface{}) error {
 		return store.ErrNotFound
 	}
 
+	if err := wt.st.sc.run(OpUpdate); err != nil {
+		return err
+	}
+
 	var err error
 	var before interface{}
 	var ok bool
@@ -228,6 +262,10 @@ func (wt writeTxn) Delete() error {
 		return store.ErrNotFound
 	}
 
+	if err := wt.st.sc.run(OpDelete); err != nil {
+		return err
+	}
+
 	var err error
 	var before interface{}
 	var ok bool
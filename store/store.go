@@ -2,6 +2,7 @@ package store
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/jirenius/go-res"
 )
@@ -12,6 +13,10 @@ var (
 	ErrDuplicate = &res.Error{Code: res.CodeInvalidParams, Message: "Duplicate resource"}
 )
 
+// DefaultEvictAfter is the duration a resource may be unobserved before the
+// handlers caching data for it, with no EvictAfter set, evict the data.
+const DefaultEvictAfter = 10 * time.Minute
+
 // Store is a CRUD interface for storing resources of a specific type. The
 // resources are identified by a unique ID string.
 //
@@ -48,6 +53,20 @@ type Store interface {
 	OnChange(func(id string, before, after interface{}))
 }
 
+// ExpiringStore is a Store where values may expire, and be deleted outside of
+// any write transaction. A Handler using an ExpiringStore sets the expire
+// dispatch function on registration, to have expired values deleted, and
+// delete events sent, on the worker goroutine of the resource.
+type ExpiringStore interface {
+	Store
+
+	// SetExpireDispatch sets a function that is called with the ID and value
+	// of an expired resource. The function must call expire, which deletes the
+	// value and triggers the OnChange callbacks, on the goroutine where change
+	// events for the resource are to be sent.
+	SetExpireDispatch(dispatch func(id string, v interface{}, expire func()))
+}
+
 // ReadTxn represents a read transaction.
 type ReadTxn interface {
 	// ID returns the ID string of the resource.
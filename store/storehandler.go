@@ -69,6 +69,9 @@ func (sh Handler) SetOption(h *res.Handler) {
 		res.OnRegister(o.onRegister),
 	)
 	o.st.OnChange(o.changeHandler)
+	if es, ok := o.st.(ExpiringStore); ok {
+		es.SetExpireDispatch(o.expireDispatch)
+	}
 }
 
 func (o *storeHandler) onRegister(s *res.Service, p res.Pattern, h res.Handler) {
@@ -131,6 +134,35 @@ func (o *storeHandler) getResource(r res.GetRequest) {
 	}
 }
 
+// expireDispatch calls expire on the worker goroutine of the resource with an
+// expired value.
+func (o *storeHandler) expireDispatch(id string, v interface{}, expire func()) {
+	if o.s == nil {
+		expire()
+		return
+	}
+	rid := id
+	if o.trans != nil {
+		tv, err := o.trans.Transform(id, v)
+		if err != nil {
+			expire()
+			return
+		}
+		rid = o.trans.IDToRID(id, tv, o.p)
+		if rid == "" {
+			expire()
+			return
+		}
+	}
+	err := o.s.With(rid, func(r res.Resource) {
+		expire()
+	})
+	if err != nil {
+		o.s.Logger().Errorf("error getting resource %s: %s", rid, err)
+		expire()
+	}
+}
+
 func (o *storeHandler) changeHandler(id string, before, after interface{}) {
 	var err error
 	rid := id
@@ -196,14 +228,14 @@ func (o *storeHandler) changeHandler(id string, before, after interface{}) {
 }
 
 // modelDiff produces change event by comparing before and after value, as they
-// look when marshaled into json.
+// look when marshaled into json, excluding private fields.
 func modelDiff(r res.Resource, before, after interface{}) error {
 	var beforeMap, afterMap map[string]Value
 	var ok bool
 
 	// Convert before and after value to map[string]Value
 	if beforeMap, ok = before.(map[string]Value); !ok {
-		beforeDta, err := json.Marshal(before)
+		beforeDta, err := json.Marshal(res.PublicModel(before))
 		if err != nil {
 			return err
 		}
@@ -212,7 +244,7 @@ func modelDiff(r res.Resource, before, after interface{}) error {
 		}
 	}
 	if afterMap, ok = after.(map[string]Value); !ok {
-		afterDta, err := json.Marshal(after)
+		afterDta, err := json.Marshal(res.PublicModel(after))
 		if err != nil {
 			return err
 		}
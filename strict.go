@@ -0,0 +1,173 @@
+package res
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SetExternalResources declares full resource patterns, including service
+// name, of resources handled by other services. In strict mode, resource
+// references in model and collection responses are validated to match either
+// a handler registered to the service, or an external resource pattern.
+//
+// Panics if a pattern is invalid, or if the service is already started.
+func (s *Service) SetExternalResources(patterns ...string) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	ps := make([]Pattern, len(patterns))
+	for i, p := range patterns {
+		ps[i] = Pattern(p)
+		if !ps[i].IsValid() {
+			panic("res: invalid external resource pattern: " + p)
+		}
+	}
+	s.external = ps
+	return s
+}
+
+// strictChangeEvent validates a change event in strict mode, reporting any
+// inconsistencies as errors. It returns the changed values without any
+// properties of private fields, which are rejected to not be sent to clients.
+func (r *resource) strictChangeEvent(changed map[string]interface{}) map[string]interface{} {
+	if !r.s.strict {
+		return changed
+	}
+	if r.h.Type == TypeUnset {
+		r.s.errorf("Strict: change event on resource %s with unset resource type", r.rname)
+	}
+	v, ok := r.strictValue()
+	if !ok {
+		return changed
+	}
+	fields, ok := jsonFieldNames(reflect.TypeOf(v))
+	if !ok {
+		return changed
+	}
+	var public map[string]interface{}
+	for k := range changed {
+		private, ok := fields[k]
+		if !ok {
+			r.s.errorf("Strict: change event on resource %s has property %#v not found in model type %T", r.rname, k, v)
+		} else if private {
+			r.s.errorf("Strict: change event on resource %s has private property %#v of model type %T", r.rname, k, v)
+			if public == nil {
+				public = make(map[string]interface{}, len(changed))
+				for k, v := range changed {
+					if !fields[k] {
+						public[k] = v
+					}
+				}
+			}
+		}
+	}
+	if public != nil {
+		return public
+	}
+	return changed
+}
+
+// strictAddEvent validates an add event in strict mode, reporting any
+// inconsistencies as errors.
+func (r *resource) strictAddEvent(idx int) {
+	if !r.s.strict {
+		return
+	}
+	v, ok := r.strictValue()
+	if !ok {
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return
+	}
+	if idx > rv.Len() {
+		r.s.errorf("Strict: add event on resource %s has idx %d out of bounds for collection of length %d", r.rname, idx, rv.Len())
+	}
+}
+
+// strictRefs validates, in strict mode, that the resource references in a
+// model or collection response refer to resources handled by the service, or
+// matching an external resource pattern, reporting any other as errors.
+func (r *Request) strictRefs(v interface{}) {
+	if !r.s.strict {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	var values []json.RawMessage
+	var m map[string]json.RawMessage
+	if json.Unmarshal(data, &m) == nil {
+		for _, v := range m {
+			values = append(values, v)
+		}
+	} else if json.Unmarshal(data, &values) != nil {
+		return
+	}
+	for _, v := range values {
+		if len(v) == 0 || v[0] != '{' {
+			continue
+		}
+		var ref struct {
+			RID *string `json:"rid"`
+		}
+		if json.Unmarshal(v, &ref) != nil || ref.RID == nil {
+			continue
+		}
+		rname := *ref.RID
+		if i := strings.IndexByte(rname, '?'); i >= 0 {
+			rname = rname[:i]
+		}
+		if !r.s.isKnownResource(rname) {
+			r.s.errorf("Strict: response on resource %s has reference to %s not matching any registered or external resource pattern", r.rname, *ref.RID)
+		}
+	}
+}
+
+// isKnownResource returns true if the resource name matches a handler
+// registered to the service, or an external resource pattern.
+func (s *Service) isKnownResource(rname string) bool {
+	if s.match(rname) != nil {
+		return true
+	}
+	for _, p := range s.external {
+		if p.Matches(rname) {
+			return true
+		}
+	}
+	return false
+}
+
+// strictValue returns the resource value as provided by the get handler, if
+// one is defined. The returned bool is false if the value is not known.
+func (r *resource) strictValue() (interface{}, bool) {
+	if r.h.Get == nil {
+		return nil, false
+	}
+	v, err := r.Value()
+	if err != nil || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// jsonFieldNames returns the json names of a struct type, or a pointer to a
+// struct type, mapped to true if the field is tagged `res:"private"`. The
+// returned bool is false if t is not a struct.
+func jsonFieldNames(t reflect.Type) (map[string]bool, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	sfs := structFields(t)
+	fields := make(map[string]bool, len(sfs))
+	for _, f := range sfs {
+		fields[f.name] = f.private
+	}
+	return fields, true
+}
@@ -0,0 +1,132 @@
+package res
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// SwapHandler atomically replaces the handler registered for the pattern with
+// hs, such as when switching between a blue and a green implementation at
+// runtime. The pattern is the same as used when registering the handler with
+// Handle or AddHandler, and must use the same placeholder names.
+//
+// Requests matched after the swap are handled by the new handler, while
+// requests already queued or being handled complete with the previous one.
+// Once all work queued at the time of the swap is done, a system reset event is
+// sent for the pattern, for gateways to discard any cached responses from the
+// previous handler.
+//
+// Any OnRegister callback of hs is called before SwapHandler returns. The new
+// handler cannot have Listeners, while listeners of the previous handler are
+// kept.
+//
+// Returns an error if no handler is registered for the pattern.
+func (s *Service) SwapHandler(pattern string, hs Handler) error {
+	if !Pattern(pattern).IsValid() {
+		panic(invalidPattern)
+	}
+	if len(hs.Listeners) > 0 || len(hs.ErrorListeners) > 0 {
+		return errors.New("res: swapped handler cannot have listeners")
+	}
+	initDeprecations(&hs)
+	var g group
+	if hs.Parallel {
+		g = []gpart{}
+	} else {
+		g = parseGroup(hs.Group, pattern)
+	}
+
+	if err := s.Mux.swap(pattern, &regHandler{Handler: hs, group: g, pattern: pattern}); err != nil {
+		return err
+	}
+
+	fp := Pattern(mergePattern(s.Mux.FullPath(), pattern))
+	if hs.OnRegister != nil {
+		hs.OnRegister(s, fp, hs)
+	}
+
+	if atomic.LoadInt32(&s.state) == stateStarted {
+		rp := string(fp.replace(func(string) (string, bool) { return "*", true }))
+		s.afterWork(func() {
+			s.reset([]string{rp}, []string{rp})
+		})
+	}
+	return nil
+}
+
+// swap replaces the handlers registered for the pattern while holding the lock.
+func (m *Mux) swap(pattern string, hs *regHandler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, params := m.find(pattern)
+	if n == nil || n.hs == nil {
+		return fmt.Errorf("res: no handler registered for pattern %s", mergePattern(m.path, pattern))
+	}
+	if !equalParams(n.params, params) {
+		return fmt.Errorf("res: placeholders of pattern %s mismatch those of the registered handler", mergePattern(m.path, pattern))
+	}
+	n.hs = hs
+	return nil
+}
+
+// find returns the node and path parameters for a pattern, without creating
+// any missing nodes. Returns a nil node if the pattern has no node.
+func (m *Mux) find(pattern string) (*node, []pathParam) {
+	var params []pathParam
+	n := m.root
+	mountIdx := 0
+	for i, t := range splitPattern(pattern) {
+		if n.mounted {
+			mountIdx = i
+		}
+		switch t[0] {
+		case pmark, pwild:
+			if t[0] == pmark {
+				params = append(params, pathParam{name: t[1:], idx: i - mountIdx})
+			}
+			n = n.param
+		case fwild:
+			n = n.wild
+		default:
+			n = n.nodes[t]
+		}
+		if n == nil {
+			return nil, nil
+		}
+	}
+	return n, params
+}
+
+// equalParams returns true if the path parameters are equal.
+func equalParams(a, b []pathParam) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, p := range a {
+		if p != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// afterWork calls cb once all work queued at the time of the call is done. If
+// there is no queued work, cb is called directly.
+func (s *Service) afterWork(cb func()) {
+	remaining := int32(1)
+	done := func() {
+		if atomic.AddInt32(&remaining, -1) == 0 {
+			cb()
+		}
+	}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, w := range sh.rwork {
+			atomic.AddInt32(&remaining, 1)
+			w.queue = append(w.queue, done)
+		}
+		sh.mu.Unlock()
+	}
+	done()
+}
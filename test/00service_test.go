@@ -1,13 +1,22 @@
 package test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
 	"testing"
 	"time"
 
 	res "github.com/jirenius/go-res"
 	"github.com/jirenius/go-res/logger"
 	"github.com/jirenius/go-res/restest"
+	"github.com/nats-io/nats-server/v2/server"
+	ntest "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
 )
 
 // TestService is the doc.go usage example
@@ -91,6 +100,56 @@ func TestServiceSetOwnedResources(t *testing.T) {
 	}, nil, restest.WithReset(resources, access))
 }
 
+// Test that SetOwnedResources reports no errors when the owned resources cover
+// all handlers.
+func TestServiceSetOwnedResources_CoveringHandlers_ReportsNoErrors(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	resources := []string{"test.model.>"}
+	access := []string{"test.>"}
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) {
+			mu.Lock()
+			errs = append(errs, msg)
+			mu.Unlock()
+		})
+		s.Handle("model.$id", res.Access(res.AccessGranted), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.SetOwnedResources(resources, access)
+	}, func(s *restest.Session) {
+		mu.Lock()
+		defer mu.Unlock()
+		restest.AssertEqualJSON(t, "errors", errs, nil)
+	}, restest.WithReset(resources, access))
+}
+
+// Test that SetOwnedResources reports handlers not covered by the owned
+// resources, and owned resources without handlers, as errors.
+func TestServiceSetOwnedResources_MismatchingHandlers_ReportsErrors(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	resources := []string{"test.model.foo", "test.other.>"}
+	access := []string{"test.model.>"}
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) {
+			mu.Lock()
+			errs = append(errs, msg)
+			mu.Unlock()
+		})
+		s.Handle("model.$id", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.Handle("collection", res.Access(res.AccessGranted))
+		s.SetOwnedResources(resources, access)
+	}, func(s *restest.Session) {
+		mu.Lock()
+		defer mu.Unlock()
+		restest.AssertEqualJSON(t, "errors", errs, []string{
+			"Handler pattern test.model.$id not fully covered by owned resource patterns [test.model.foo test.other.>]",
+			"Owned resource pattern test.other.> matches no registered resource handler",
+			"Handler pattern test.collection not fully covered by owned access patterns [test.model.>]",
+			"Owned access pattern test.model.> matches no registered access handler",
+		})
+	}, restest.WithReset(resources, access))
+}
+
 // Test that TokenEvent sends a connection token event.
 func TestServiceTokenEvent_WithObjectToken_SendsToken(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -142,6 +201,42 @@ func TestServiceTokenEventWithID_WithNilToken_SendsNilToken(t *testing.T) {
 	})
 }
 
+// Test that TokenEventAll sends a connection token event to each connection.
+func TestServiceTokenEventAll_WithObjectToken_SendsTokens(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().TokenEventAll([]string{"foo", "bar"}, mock.Token)
+		s.GetMsg().AssertTokenEvent("foo", mock.Token)
+		s.GetMsg().AssertTokenEvent("bar", mock.Token)
+	})
+}
+
+// Test that TokenEventAllWithID sends a connection token event with token ID to
+// each connection.
+func TestServiceTokenEventAllWithID_WithNilToken_SendsNilTokens(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().TokenEventAllWithID([]string{"foo", "bar"}, "baz", nil)
+		s.GetMsg().AssertTokenEventWithID("foo", "baz", nil)
+		s.GetMsg().AssertTokenEventWithID("bar", "baz", nil)
+	})
+}
+
+// Test that TokenEventAll with an invalid cid causes panic without sending any
+// event.
+func TestServiceTokenEventAll_WithInvalidCID_CausesPanic(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().TokenEventAll([]string{"foo", "invalid.*.cid"}, nil)
+		})
+		s.AssertNoMsg(timeoutDuration)
+	})
+}
+
 // Test that TokenEvent with an invalid cid causes panic.
 func TestServiceTokenEvent_WithInvalidCID_CausesPanic(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -192,6 +287,45 @@ func TestServiceReset(t *testing.T) {
 	}
 }
 
+// Test that OnServeBefore is called before subscribing and OnServe
+func TestServiceSetOnServeBefore_ValidCallback_IsCalledBeforeOnServe(t *testing.T) {
+	ch := make(chan string, 2)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.SetOnServeBefore(func(s *res.Service) error {
+			ch <- "before"
+			return nil
+		})
+		s.SetOnServe(func(s *res.Service) {
+			ch <- "serve"
+		})
+	}, func(s *restest.Session) {
+		for _, expected := range []string{"before", "serve"} {
+			select {
+			case v := <-ch:
+				restest.AssertEqualJSON(t, "callback", v, expected)
+			case <-time.After(timeoutDuration):
+				t.Fatalf("expected %s callback to be called, but it wasn't", expected)
+			}
+		}
+	})
+}
+
+// Test that an error returned by OnServeBefore aborts startup
+func TestServiceSetOnServeBefore_ReturnsError_ServeReturnsError(t *testing.T) {
+	rs := res.NewService("test")
+	rs.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	rs.SetLogger(nil)
+	rs.SetOnServeBefore(func(s *res.Service) error {
+		return errors.New("bootstrap failed")
+	})
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	c.AssertNoSubscription("get.test.>")
+	restest.AssertTrue(t, "connection to be closed", c.IsClosed())
+	restest.AssertError(t, rs.Shutdown())
+}
+
 func TestServiceSetOnServe_ValidCallback_IsCalledOnServe(t *testing.T) {
 	ch := make(chan bool)
 	runTest(t, func(s *res.Service) {
@@ -412,3 +546,501 @@ func TestServiceWithParallel_WithMultipleCallsOnSameResource_CallsCallbacksInPar
 		}
 	})
 }
+
+// Test ServiceSetOnHandle panics when called after starting service
+func TestServiceSetOnHandle_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetOnHandle(nil)
+		})
+	})
+}
+
+// Test that an OnHandle function set before starting a test session is still
+// called, along with its returned function
+func TestServiceSetOnHandle_WithSession_IsCalled(t *testing.T) {
+	called := make(chan string, 1)
+	doneCalled := make(chan struct{}, 1)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.SetOnHandle(func(r res.Resource) func() {
+			called <- r.ResourceName()
+			return func() { doneCalled <- struct{}{} }
+		})
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+		restest.AssertEqualJSON(t, "resource name", <-called, "test.model")
+		<-doneCalled
+	})
+}
+
+// Test that handlers for resources in the same group are serialized
+func TestServiceWithGroup_WithConcurrentRequests_HandlersAreSerialized(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id",
+			res.Group("models"),
+			res.GetResource(func(r res.GetRequest) { r.NotFound() }),
+		)
+	}, func(s *restest.Session) {
+		s.AssertSerialized("test.model.foo", "test.model.bar", "test.model.baz")
+	})
+}
+
+// Test that handlers for a single resource are serialized
+func TestService_WithConcurrentRequestsOnSameResource_HandlersAreSerialized(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.AssertSerialized("test.model")
+	})
+}
+
+// Test that AssertSerialized fails for resources handled concurrently. The
+// assertion is run in a subprocess, as a failing assertion fails the test.
+func TestAssertSerialized_WithConcurrentHandlers_Fails(t *testing.T) {
+	if os.Getenv("TEST_ASSERT_SERIALIZED_FAILS") == "1" {
+		barStarted := make(chan struct{})
+		var once sync.Once
+		runTest(t, func(s *res.Service) {
+			s.Handle("model.$id", res.GetResource(func(r res.GetRequest) {
+				switch r.PathParam("id") {
+				case "foo":
+					// Wait for bar to be handled concurrently.
+					select {
+					case <-barStarted:
+					case <-time.After(timeoutDuration):
+					}
+				case "bar":
+					once.Do(func() { close(barStarted) })
+				}
+				r.NotFound()
+			}))
+		}, func(s *restest.Session) {
+			s.AssertSerialized("test.model.foo", "test.model.bar")
+		})
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAssertSerialized_WithConcurrentHandlers_Fails$")
+	cmd.Env = append(os.Environ(), "TEST_ASSERT_SERIALIZED_FAILS=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	restest.AssertTrue(t, "test to fail", errors.As(err, &exitErr), string(out))
+	restest.AssertTrue(t, "output to report concurrent handlers", bytes.Contains(out, []byte("to be serialized")), string(out))
+}
+
+// Test ServiceSetWorkShards panics when called after starting service
+func TestServiceSetWorkShards_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetWorkShards(4)
+		})
+	})
+}
+
+// Test ServiceSetWorkShards with more shards than workers does not panic
+func TestServiceSetWorkShards_MoreShardsThanWorkers_DoesNotPanic(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetWorkerCount(2)
+		s.SetWorkShards(8)
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+	})
+}
+
+// Test that handlers for resources in the same group are serialized when
+// using multiple work shards
+func TestServiceWithGroup_WithWorkShards_HandlersAreSerialized(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetWorkShards(4)
+		s.Handle("model.$id",
+			res.Group("models"),
+			res.GetResource(func(r res.GetRequest) { r.NotFound() }),
+		)
+	}, func(s *restest.Session) {
+		s.AssertSerialized("test.model.foo", "test.model.bar", "test.model.baz")
+	})
+}
+
+// Test ServiceSetGroupBuckets panics when called after starting service
+func TestServiceSetGroupBuckets_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetGroupBuckets(4)
+		})
+	})
+}
+
+// Test that handlers for resources mapped to the same group bucket are
+// serialized
+func TestServiceSetGroupBuckets_WithSingleBucket_HandlersAreSerialized(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetGroupBuckets(1)
+		s.SetWorkShards(4)
+		s.Handle("model.$id", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.AssertSerialized("test.model.foo", "test.model.bar", "test.model.baz")
+	})
+}
+
+// Test that the group of a resource is unaffected by group buckets
+func TestServiceSetGroupBuckets_Group_ReturnsGroup(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetGroupBuckets(2)
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			restest.AssertEqualJSON(t, "Group", r.Group(), "test.model.foo")
+			r.NotFound()
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model.foo").
+			Response().
+			AssertError(res.ErrNotFound)
+	})
+}
+
+// Test ServiceSubscribeRaw calls the callback on the group's worker goroutine
+func TestServiceSubscribeRaw_WithMessage_CallsCallback(t *testing.T) {
+	ch := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().SubscribeRaw("domain.events", "test.model", func(m *nats.Msg) {
+			ch <- string(m.Data)
+		}))
+		s.AssertSubscription("domain.events")
+		s.SendMessage("domain.events", "", []byte(`{"foo":"bar"}`))
+		select {
+		case data := <-ch:
+			restest.AssertEqualJSON(t, "data", data, `{"foo":"bar"}`)
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected SubscribeRaw callback to be called, but it wasn't")
+		}
+	})
+}
+
+// Test ServiceSubscribeRaw returns an error when the service is not started
+func TestServiceSubscribeRaw_NotStarted_ReturnsError(t *testing.T) {
+	s := res.NewService("test")
+	restest.AssertError(t, s.SubscribeRaw("domain.events", "", func(m *nats.Msg) {}))
+}
+
+func recorderHandlers(s *res.Service) {
+	s.Handle("model",
+		res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		res.Call("set", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"string": "bar"})
+			r.OK(nil)
+		}),
+	)
+}
+
+// Test SetRecorder records inbound requests and outbound responses and events
+func TestServiceSetRecorder_WithRequests_RecordsMessages(t *testing.T) {
+	var buf bytes.Buffer
+	runTest(t, func(s *res.Service) {
+		recorderHandlers(s)
+		s.SetRecorder(&buf)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response()
+		req := s.Call("test.model", "set", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"string": "bar"})
+		req.Response()
+	})
+
+	rec, err := restest.ReadRecording(&buf)
+	restest.AssertNoError(t, err)
+	expected := []struct {
+		Dir     string
+		Subject string
+	}{
+		{res.RecordOut, "system.reset"},
+		{res.RecordIn, "get.test.model"},
+		{res.RecordOut, rec[1].Reply},
+		{res.RecordIn, "call.test.model.set"},
+		{res.RecordOut, "event.test.model.change"},
+		{res.RecordOut, rec[3].Reply},
+	}
+	if len(rec) != len(expected) {
+		t.Fatalf("expected %d recorded messages, but got %d", len(expected), len(rec))
+	}
+	for i, e := range expected {
+		if rec[i].Dir != e.Dir || rec[i].Subject != e.Subject {
+			t.Errorf("expected recorded message %d to be %s %s, but got %s %s", i, e.Dir, e.Subject, rec[i].Dir, rec[i].Subject)
+		}
+		if rec[i].Time.IsZero() {
+			t.Errorf("expected recorded message %d to have a timestamp", i)
+		}
+	}
+	restest.AssertEqualJSON(t, "event payload", rec[4].Data, json.RawMessage(`{"values":{"string":"bar"}}`))
+}
+
+// Test that a recording can be replayed against a service
+func TestServiceSetRecorder_ReplayRecording_MatchesMessages(t *testing.T) {
+	var buf bytes.Buffer
+	runTest(t, func(s *res.Service) {
+		recorderHandlers(s)
+		s.SetRecorder(&buf)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response()
+		req := s.Call("test.model", "set", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"string": "bar"})
+		req.Response()
+	})
+
+	rec, err := restest.ReadRecording(&buf)
+	restest.AssertNoError(t, err)
+	runTest(t, recorderHandlers, func(s *restest.Session) {
+		s.Replay(rec)
+	})
+}
+
+// Test SetRecorder panics if service is started
+func TestServiceSetRecorder_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetRecorder(nil)
+		})
+	})
+}
+
+// Test ReadRecording returns an error on invalid lines
+func TestReadRecording_InvalidLine_ReturnsError(t *testing.T) {
+	_, err := restest.ReadRecording(bytes.NewBufferString(`{"dir":"in","subject":"get.test.model"}` + "\n" + `{"dir":"sideways"}`))
+	restest.AssertError(t, err)
+}
+
+// Test that With called from a handler on its own group calls the callback
+// directly when SetReentrantWith is enabled
+func TestServiceSetReentrantWith_WithOnOwnGroup_CallsCallbackDirectly(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetReentrantWith(true)
+		s.Handle("model.$id", res.Group("models"), res.Call("method", func(r res.CallRequest) {
+			called := make(chan struct{})
+			restest.AssertNoError(t, r.Service().With("test.model.bar", func(_ res.Resource) {
+				close(called)
+			}))
+			select {
+			case <-called:
+				r.OK(nil)
+			case <-time.After(timeoutDuration):
+				r.Error(res.ErrTimeout)
+			}
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model.foo", "method", nil).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+// Test that With called from a handler on its own group enqueues the callback
+// by default
+func TestServiceSetReentrantWith_Disabled_EnqueuesCallback(t *testing.T) {
+	ch := make(chan string, 2)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			restest.AssertNoError(t, r.Service().With("test.model", func(_ res.Resource) {
+				ch <- "callback"
+			}))
+			ch <- "handler"
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "first", <-ch, "handler")
+		restest.AssertEqualJSON(t, "second", <-ch, "callback")
+	})
+}
+
+// Test that With called from another goroutine is enqueued even when
+// SetReentrantWith is enabled
+func TestServiceSetReentrantWith_WithFromOtherGoroutine_EnqueuesCallback(t *testing.T) {
+	ch := make(chan string, 2)
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetReentrantWith(true)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			go func() {
+				restest.AssertNoError(t, r.Service().With("test.model", func(_ res.Resource) {
+					ch <- "callback"
+				}))
+				close(release)
+			}()
+			<-release
+			ch <- "handler"
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "first", <-ch, "handler")
+		restest.AssertEqualJSON(t, "second", <-ch, "callback")
+	})
+}
+
+// Test SetReentrantWith panics if service is started
+func TestServiceSetReentrantWith_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetReentrantWith(true)
+		})
+	})
+}
+
+// Test that lifecycle hooks are called in order
+func TestServiceLifecycleHooks_StartAndShutdown_CalledInOrder(t *testing.T) {
+	ch := make(chan string, 10)
+	hook := func(name string) func(*res.Service) error {
+		return func(*res.Service) error {
+			ch <- name
+			return nil
+		}
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.SetOnServeBefore(hook("serveBefore"))
+		s.OnStart(hook("start1")).OnStart(hook("start2"))
+		s.SetOnServe(func(*res.Service) { ch <- "serve" })
+		s.OnReady(hook("ready"))
+		s.OnStopping(hook("stopping"))
+		s.OnStopped(hook("stopped"))
+	}, nil)
+	close(ch)
+	var called []string
+	for name := range ch {
+		called = append(called, name)
+	}
+	restest.AssertEqualJSON(t, "hooks", called, []string{"serveBefore", "start1", "start2", "serve", "ready", "stopping", "stopped"})
+}
+
+// Test that an error returned by an OnStart hook aborts startup
+func TestServiceOnStart_ReturnsError_AbortsStartup(t *testing.T) {
+	var called []string
+	rs := res.NewService("test")
+	rs.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	rs.SetLogger(nil)
+	rs.OnStart(func(*res.Service) error { return errors.New("start failed") })
+	rs.OnStart(func(*res.Service) error { called = append(called, "start"); return nil })
+	rs.OnReady(func(*res.Service) error { called = append(called, "ready"); return nil })
+	rs.OnStopping(func(*res.Service) error { called = append(called, "stopping"); return nil })
+	rs.OnStopped(func(*res.Service) error { called = append(called, "stopped"); return nil })
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	c.AssertNoSubscription("get.test.>")
+	restest.AssertTrue(t, "connection to be closed", c.IsClosed())
+	restest.AssertEqualJSON(t, "hooks", called, []string{"stopping", "stopped"})
+}
+
+// Test that an error returned by an OnReady hook stops the service
+func TestServiceOnReady_ReturnsError_StopsService(t *testing.T) {
+	rs := res.NewService("test")
+	rs.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	rs.SetLogger(nil)
+	rs.OnReady(func(*res.Service) error { return errors.New("ready failed") })
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	c.AssertSubscription("get.test.>")
+	restest.AssertTrue(t, "connection to be closed", c.IsClosed())
+}
+
+// Test that errors returned by OnStopping and OnStopped hooks are returned by
+// Shutdown, after calling all hooks
+func TestServiceOnStopping_ReturnsError_ShutdownReturnsFirstError(t *testing.T) {
+	var called []string
+	errFirst := errors.New("first")
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.SetLogger(nil)
+		s.OnStopping(func(*res.Service) error { called = append(called, "stopping1"); return errFirst })
+		s.OnStopping(func(*res.Service) error { called = append(called, "stopping2"); return nil })
+		s.OnStopped(func(*res.Service) error { called = append(called, "stopped"); return errors.New("second") })
+	}, func(s *restest.Session) {
+		err := s.Service().Shutdown()
+		if err != errFirst {
+			t.Errorf("expected Shutdown to return %v, but got %v", errFirst, err)
+		}
+		restest.AssertEqualJSON(t, "hooks", called, []string{"stopping1", "stopping2", "stopped"})
+	}, restest.WithKeepLogger)
+}
+
+// Test lifecycle hooks panic if service is started
+func TestServiceLifecycleHooks_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		f := func(*res.Service) error { return nil }
+		restest.AssertPanic(t, func() { s.Service().OnStart(f) })
+		restest.AssertPanic(t, func() { s.Service().OnReady(f) })
+		restest.AssertPanic(t, func() { s.Service().OnStopping(f) })
+		restest.AssertPanic(t, func() { s.Service().OnStopped(f) })
+	})
+}
+
+// Test that Run serves until the context is done
+func TestServiceRun_ContextCanceled_StopsService(t *testing.T) {
+	opts := ntest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	gnatsd := ntest.RunServer(&opts)
+	defer gnatsd.Shutdown()
+
+	ready := make(chan struct{})
+	stopped := make(chan struct{})
+	rs := res.NewService("test")
+	rs.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	rs.SetLogger(nil)
+	rs.OnReady(func(*res.Service) error { close(ready); return nil })
+	rs.OnStopped(func(*res.Service) error { close(stopped); return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rs.Run(ctx, gnatsd.ClientURL()) }()
+
+	select {
+	case <-ready:
+	case <-time.After(timeoutDuration):
+		t.Fatal("expected service to be ready, but it wasn't")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		restest.AssertNoError(t, err)
+	case <-time.After(timeoutDuration):
+		t.Fatal("expected Run to return, but it didn't")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("expected OnStopped hook to be called")
+	}
+}
+
+// Test that Run returns the startup error
+func TestServiceRun_StartupError_ReturnsError(t *testing.T) {
+	opts := ntest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	gnatsd := ntest.RunServer(&opts)
+	defer gnatsd.Shutdown()
+
+	rs := res.NewService("test")
+	rs.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	rs.SetLogger(nil)
+	rs.OnStart(func(*res.Service) error { return errors.New("start failed") })
+	restest.AssertError(t, rs.Run(context.Background(), gnatsd.ClientURL()))
+}
@@ -2,7 +2,9 @@ package test
 
 import (
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jirenius/go-res"
 	"github.com/jirenius/go-res/restest"
@@ -34,6 +36,49 @@ func TestAccessGranted(t *testing.T) {
 	})
 }
 
+// Test that access granted response with duration is sent when calling
+// AccessGrantedFor
+func TestAccessGrantedFor(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			r.AccessGrantedFor(5 * time.Second)
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", nil).
+			Response().
+			AssertAccess(true, "*").
+			AssertPathPayload("result.duration", 5000)
+	})
+}
+
+// Test that access response with duration is sent when calling AccessFor
+func TestAccessFor(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			r.AccessFor(true, "bar", 1500*time.Millisecond)
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", nil).
+			Response().
+			AssertAccess(true, "bar").
+			AssertPathPayload("result.duration", 1500)
+	})
+}
+
+// Test that AccessFor without get or call access responds with
+// system.accessDenied
+func TestAccessFor_WithNoAccess_RespondsWithAccessDenied(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			r.AccessFor(false, "", time.Second)
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", nil).
+			Response().
+			AssertError(res.ErrAccessDenied)
+	})
+}
+
 // Test that system.accessDenied response is sent when calling AccessDenied
 func TestAccessDenied(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -262,3 +307,215 @@ func TestAccessRequestGetters(t *testing.T) {
 			Response()
 	})
 }
+
+// Test that DedupAccess calls the access handler once for identical access
+// requests within the window.
+func TestDedupAccess_IdenticalRequests_CallsHandlerOnce(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DedupAccess(time.Second),
+			res.Access(func(r res.AccessRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Access(true, "foo")
+			}),
+		)
+	}, func(s *restest.Session) {
+		for i := 0; i < 3; i++ {
+			s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		}
+		restest.AssertTrue(t, "handler to be called once", atomic.LoadInt32(&calls) == 1)
+	})
+}
+
+// Test that DedupAccess calls the access handler for each access request with
+// a different token or query.
+func TestDedupAccess_DifferentRequests_CallsHandlerForEach(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DedupAccess(time.Second),
+			res.Access(func(r res.AccessRequest) {
+				atomic.AddInt32(&calls, 1)
+				var tok struct {
+					User string `json:"user"`
+				}
+				r.ParseToken(&tok)
+				r.Access(true, tok.User)
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "jane")
+		s.Access("test.model", userToken("john")).Response().AssertAccess(true, "john")
+		s.Access("test.model?q=foo", userToken("jane")).Response().AssertAccess(true, "jane")
+		restest.AssertTrue(t, "handler to be called three times", atomic.LoadInt32(&calls) == 3)
+	})
+}
+
+// Test that DedupAccess calls the access handler again once the window has
+// passed.
+func TestDedupAccess_AfterWindow_CallsHandlerAgain(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DedupAccess(time.Millisecond*10),
+			res.Access(func(r res.AccessRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Access(true, "foo")
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		time.Sleep(time.Millisecond * 50)
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+	})
+}
+
+// Test that DedupAccess calls the access handler again for an identical
+// request when the previous one was responded to with an error.
+func TestDedupAccess_ErrorResponse_CallsHandlerAgain(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DedupAccess(time.Second),
+			res.Access(func(r res.AccessRequest) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					r.Error(res.ErrTimeout)
+					return
+				}
+				r.Access(true, "foo")
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertError(res.ErrTimeout)
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+	})
+}
+
+// Test that DedupAccess calls the access handler again after a reaccess event
+// or a system reset for the resource.
+func TestDedupAccess_ReaccessOrReset_CallsHandlerAgain(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DedupAccess(time.Minute),
+			res.Access(func(r res.AccessRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Access(true, "foo")
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ReaccessEvent()
+		}))
+		s.GetMsg().AssertReaccessEvent("test.model")
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		s.Service().Reset(nil, []string{"test.>"})
+		s.GetMsg().AssertSystemReset(nil, []string{"test.>"})
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertTrue(t, "handler to be called three times", atomic.LoadInt32(&calls) == 3)
+	})
+}
+
+// Test that the window of a discarded access response does not discard a
+// response shared after it.
+func TestDedupAccess_EarlierWindowEnds_KeepsLaterResponse(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.DedupAccess(time.Second),
+			res.Access(func(r res.AccessRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Access(true, "foo")
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ReaccessEvent()
+		}))
+		s.GetMsg().AssertReaccessEvent("test.model")
+		clock.Add(time.Second / 2)
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		clock.Add(time.Second / 2)
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+		clock.Add(time.Second / 2)
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "foo")
+		restest.AssertTrue(t, "handler to be called three times", atomic.LoadInt32(&calls) == 3)
+	})
+}
+
+// Test that access requests are not deduplicated without DedupAccess.
+func TestAccess_WithoutDedupAccess_CallsHandlerForEach(t *testing.T) {
+	var calls int32
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			atomic.AddInt32(&calls, 1)
+			r.AccessGranted()
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "*")
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "*")
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+	})
+}
+
+// Test that an access request with a token exceeding the max token size is
+// responded to with an invalid params error without calling the handler.
+func TestAccessRequest_TokenExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxTokenSize(10)
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			t.Errorf("expected handler not to be called")
+			r.AccessGranted()
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that AccessFallthrough responds to access requests for handlers without
+// an access handler according to the policy.
+func TestAccessFallthrough_WithPolicy_RespondsAccordingToPolicy(t *testing.T) {
+	tbl := []struct {
+		Policy   res.AccessFallthroughPolicy
+		Expected *res.Error
+	}{
+		{res.AccessDeny, res.ErrAccessDenied},
+		{res.AccessNotFound, res.ErrNotFound},
+	}
+	for _, l := range tbl {
+		runTest(t, func(s *res.Service) {
+			s.Handle("model",
+				res.AccessFallthrough(l.Policy),
+				res.GetResource(func(r res.GetRequest) { r.NotFound() }),
+			)
+		}, func(s *restest.Session) {
+			s.Access("test.model", nil).
+				Response().
+				AssertError(l.Expected)
+		}, restest.WithReset([]string{"test", "test.>"}, []string{"test", "test.>"}))
+	}
+}
+
+// Test that access requests for handlers without an access handler are not
+// responded to by default.
+func TestAccessFallthrough_Default_DoesNotRespond(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+		s.Handle("other", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		s.Access("test.model", nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
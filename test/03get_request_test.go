@@ -35,6 +35,19 @@ func TestGetModel(t *testing.T) {
 	})
 }
 
+// Test that the model get response matches the golden file
+func TestGetModel_MatchesGoldenFile(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.foo", res.GetModel(func(r res.ModelRequest) {
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model.foo").
+			Response().
+			AssertGolden("testdata/get_model.json")
+	})
+}
+
 // Test that the collection is sent on get request
 func TestGetCollection(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -180,6 +193,24 @@ func TestGetCollectionError(t *testing.T) {
 	})
 }
 
+// Test that calling ErrorData on a model get request results in given error with data
+func TestGetModelErrorData(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.ErrorData("custom.error", mock.ErrorMessage, mock.Result)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(&res.Error{
+				Code:    "custom.error",
+				Message: mock.ErrorMessage,
+				Data:    mock.Result,
+			}).
+			AssertErrorData(mock.Result)
+	})
+}
+
 // Test calling InvalidQuery with no message on an model get request results in system.invalidQuery
 func TestModelInvalidQuery_EmptyMessage(t *testing.T) {
 	runTest(t, func(s *res.Service) {
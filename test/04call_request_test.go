@@ -1,6 +1,10 @@
 package test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -62,6 +66,34 @@ func TestCallResource_WithValidRID_SendsResourceResponse(t *testing.T) {
 	})
 }
 
+// Test call ResourceResult response with valid resource ID
+func TestCallResourceResult_WithValidRID_SendsResourceResultResponse(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.ResourceResult("test.foo", mock.Result)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResourceResult("test.foo", mock.Result)
+	})
+}
+
+// Test call ResourceResult response with invalid resource ID causes panic
+func TestCallResourceResult_WithInvalidRID_CausesPanic(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			restest.AssertPanicNoRecover(t, func() {
+				r.ResourceResult("test..foo", mock.Result)
+			})
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
 // Test call Resource response with invalid resource ID causes panic
 func TestCallResource_WithInvalidRID_CausesPanic(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -132,6 +164,43 @@ func TestCallInvalidParams_CustomMessage(t *testing.T) {
 	})
 }
 
+// Test calling InvalidParamsData with no message on a call request results in system.invalidParams with data
+func TestCallInvalidParamsData_EmptyMessage(t *testing.T) {
+	fieldErrors := []res.FieldError{{Field: "email", Message: "Invalid email address"}}
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.InvalidParamsData("", fieldErrors)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertError(&res.Error{
+				Code:    res.CodeInvalidParams,
+				Message: res.ErrInvalidParams.Message,
+				Data:    fieldErrors,
+			}).
+			AssertErrorData(json.RawMessage(`[{"field":"email","message":"Invalid email address"}]`))
+	})
+}
+
+// Test calling InvalidParamsData on a call request results in system.invalidParams with data
+func TestCallInvalidParamsData_CustomMessage(t *testing.T) {
+	fieldErrors := []res.FieldError{{Field: "name", Message: "Name is required"}}
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.InvalidParamsData(mock.ErrorMessage, fieldErrors)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertError(&res.Error{
+				Code:    res.CodeInvalidParams,
+				Message: mock.ErrorMessage,
+				Data:    fieldErrors,
+			})
+	})
+}
+
 // Test calling InvalidQuery with no message on a call request results in system.invalidQuery
 func TestCallInvalidQuery_EmptyMessage(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -174,6 +243,20 @@ func TestCallError(t *testing.T) {
 	})
 }
 
+// Test calling ErrorData on a call request results in given error with data
+func TestCallErrorData(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.ErrorData("custom.error", mock.ErrorMessage, mock.Result)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertErrorCode("custom.error").
+			AssertErrorData(mock.Result)
+	})
+}
+
 // Test calling RawParams on a call request with parameters
 func TestCallRawParams(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -372,6 +455,109 @@ func TestCallRequestTimeout(t *testing.T) {
 	})
 }
 
+// Test that SetAutoTimeout sends a pre-response for slow handlers
+func TestCallRequest_WithAutoTimeoutAndSlowHandler_SendsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetAutoTimeout(time.Millisecond*10, time.Second*42)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			<-release
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		req.Response().AssertRawPayload([]byte(`timeout:"42000"`))
+		close(release)
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that SetAutoTimeout sends no pre-response for fast handlers
+func TestCallRequest_WithAutoTimeoutAndFastHandler_SendsNoTimeout(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetAutoTimeout(time.Millisecond*10, time.Second*42)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		s.AssertNoMsg(time.Millisecond * 30)
+	})
+}
+
+// Test that SetAutoTimeout sends no pre-response if the handler calls Timeout
+func TestCallRequest_WithAutoTimeoutAndManualTimeout_SendsManualTimeoutOnly(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetAutoTimeout(time.Millisecond*10, time.Second*42)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.Timeout(time.Second * 5)
+			time.Sleep(time.Millisecond * 30)
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		req.Response().AssertRawPayload([]byte(`timeout:"5000"`))
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that DefaultTimeout sends a pre-response before the handler is called
+func TestCallRequest_WithDefaultTimeout_SendsTimeout(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.DefaultTimeout(time.Second*42),
+			res.Call("method", func(r res.CallRequest) {
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		req.Response().AssertRawPayload([]byte(`timeout:"42000"`))
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that DefaultTimeout replaces the automatic timeout pre-response
+func TestCallRequest_WithDefaultTimeoutAndAutoTimeout_SendsDefaultTimeoutOnly(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetAutoTimeout(time.Millisecond*10, time.Second*42)
+		s.Handle("model",
+			res.DefaultTimeout(time.Second*5),
+			res.Call("method", func(r res.CallRequest) {
+				time.Sleep(time.Millisecond * 30)
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		req.Response().AssertRawPayload([]byte(`timeout:"5000"`))
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that DefaultTimeout panics on negative durations
+func TestDefaultTimeout_NegativeDuration_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.DefaultTimeout(-time.Second)
+	})
+}
+
+// Test that SetAutoTimeout panics on invalid durations, or if service is started
+func TestServiceSetAutoTimeout_InvalidOrAfterStart_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.NewService("test").SetAutoTimeout(time.Second, time.Second)
+	})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetAutoTimeout(time.Second, time.Minute)
+		})
+	})
+}
+
 // Test that Timeout panics if duration is less than zero
 func TestCallRequestTimeoutWithDurationLessThanZero(t *testing.T) {
 	runTest(t, func(s *res.Service) {
@@ -457,6 +643,45 @@ func TestCall_WithMultipleResponses_CausesPanic(t *testing.T) {
 	})
 }
 
+// Test that multiple responses to call request calls OnError instead of
+// panicking when NoReplyPanic is set.
+func TestCall_WithMultipleResponsesAndNoReplyPanic_CallsOnError(t *testing.T) {
+	ch := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetNoReplyPanic(true)
+		s.SetOnError(func(_ *res.Service, msg string) { ch <- msg })
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+			r.MethodNotFound()
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", mock.Request()).
+			Response().
+			AssertResult(nil)
+		select {
+		case <-ch:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected OnError callback to be called, but it wasn't")
+		}
+		s.AssertNoMsg(0)
+	})
+}
+
+// Test that Replied returns true only after a response is sent.
+func TestCall_Replied_ReturnsReplyState(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			restest.AssertTrue(t, "Replied to return false before response", !r.Replied())
+			r.OK(nil)
+			restest.AssertTrue(t, "Replied to return true after response", r.Replied())
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", mock.Request()).
+			Response().
+			AssertResult(nil)
+	})
+}
+
 func TestCallRequest_InvalidJSON_RespondsWithInternalError(t *testing.T) {
 	runTest(t, func(s *res.Service) {
 		s.Handle("model.foo",
@@ -482,3 +707,143 @@ func TestCallRequest_WithEmptyRequestPayload_ReturnsResult(t *testing.T) {
 			AssertResult(nil)
 	})
 }
+
+// Test that a call request with params exceeding the max params size is
+// responded to with an invalid params error without calling the handler.
+func TestCallRequest_ParamsExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(10)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Params: json.RawMessage(`{"foo":"bar baz"}`)}).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that a call request with params within the max params size is handled.
+func TestCallRequest_ParamsWithinMaxSize_CallsHandler(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(20)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Params: json.RawMessage(`{"foo":"bar baz"}`)}).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+// Test that a call request with a token exceeding the max token size is
+// responded to with an invalid params error without calling the handler.
+func TestCallRequest_TokenExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxTokenSize(10)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Token: json.RawMessage(`{"user":"jane"}`)}).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that a request with a payload exceeding the combined size limits is
+// responded to with an invalid params error before the payload is unmarshaled.
+func TestCallRequest_PayloadExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(10)
+		s.SetMaxTokenSize(10)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		// Broken JSON would otherwise cause an internal error on unmarshal
+		payload := append(bytes.Repeat([]byte(" "), 100<<10), mock.BrokenJSON...)
+		inb := s.RequestRaw("call.test.model.method", payload)
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that a get request with a payload exceeding the combined size limits is
+// responded to with an invalid params error.
+func TestGetRequest_PayloadExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(10)
+		s.SetMaxTokenSize(10)
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			t.Errorf("expected handler not to be called")
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		payload := append(bytes.Repeat([]byte(" "), 100<<10), []byte(`{}`)...)
+		inb := s.RequestRaw("get.test.model", payload)
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that a call request with a large token is handled when only the params
+// size is limited.
+func TestCallRequest_LargeTokenWithOnlyMaxParamsSize_CallsHandler(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(20)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		token := json.RawMessage(`{"data":"` + strings.Repeat("a", 100<<10) + `"}`)
+		s.Call("test.model", "method", &restest.Request{Params: json.RawMessage(`{"foo":"bar"}`), Token: token}).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+// Test that ParamsDecoder decodes array params one item at a time.
+func TestCallRequest_ParamsDecoder_DecodesItems(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			dec := r.ParamsDecoder()
+			_, err := dec.Token()
+			restest.AssertNoError(t, err)
+			sum := 0
+			for dec.More() {
+				var item struct {
+					Value int `json:"value"`
+				}
+				restest.AssertNoError(t, dec.Decode(&item))
+				sum += item.Value
+			}
+			r.OK(sum)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Params: json.RawMessage(`[{"value":1},{"value":2},{"value":3}]`)}).
+			Response().
+			AssertResult(6)
+	})
+}
+
+// Test that ParamsDecoder returns io.EOF when the request has no params.
+func TestCallRequest_ParamsDecoderWithoutParams_ReturnsEOF(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			_, err := r.ParamsDecoder().Token()
+			restest.AssertTrue(t, "error to be io.EOF", err == io.EOF)
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+	})
+}
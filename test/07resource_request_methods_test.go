@@ -3,10 +3,13 @@ package test
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	res "github.com/jirenius/go-res"
 	"github.com/jirenius/go-res/restest"
+	nats "github.com/nats-io/nats.go"
 )
 
 var resourceRequestTestTbl = []struct {
@@ -142,3 +145,244 @@ func TestParseQuery(t *testing.T) {
 		})
 	}
 }
+
+// Test QueryValues method on get requests returns the query values.
+func TestQueryValues_GetRequestWithValidQuery_ReturnsValues(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			q, err := r.QueryValues()
+			restest.AssertNoError(t, err)
+			r.QueryModel(map[string]interface{}{"foo": q.Get("foo"), "bar": q["bar"]}, "foo=1")
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model?foo=1&bar=2&bar=3").
+			Response().
+			AssertModel(map[string]interface{}{"foo": "1", "bar": []string{"2", "3"}})
+	})
+}
+
+// Test QueryValues method on get requests responds with invalid query on a
+// malformed query.
+func TestQueryValues_GetRequestWithMalformedQuery_RespondsWithInvalidQuery(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			q, err := r.QueryValues()
+			restest.AssertError(t, err)
+			restest.AssertTrue(t, "values to be nil", q == nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model?foo=%zz").
+			Response().
+			AssertErrorCode(res.CodeInvalidQuery)
+	})
+}
+
+// Test QueryValues method on call and access requests responds with invalid
+// query on a malformed query.
+func TestQueryValues_CallAndAccessRequestWithMalformedQuery_RespondsWithInvalidQuery(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Access(func(r res.AccessRequest) {
+				if _, err := r.QueryValues(); err == nil {
+					r.AccessGranted()
+				}
+			}),
+			res.Call("method", func(r res.CallRequest) {
+				if _, err := r.QueryValues(); err == nil {
+					r.OK(nil)
+				}
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model?foo=%zz", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidQuery)
+		s.Access("test.model?foo=%zz", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidQuery)
+		s.Call("test.model?foo=bar", "method", nil).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+// Test that CorrelationID returns the correlation ID of the request header
+func TestCorrelationID_WithCorrelationIDInRequest_ReturnsID(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(r.CorrelationID())
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", nats.Header{res.HeaderCorrelationID: {"abc"}}, []byte(`{}`))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertResult("abc")
+	})
+}
+
+// Test that CorrelationID returns a generated ID if the request has none
+func TestCorrelationID_WithoutCorrelationIDInRequest_ReturnsGeneratedID(t *testing.T) {
+	ch := make(chan string, 2)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			ch <- r.CorrelationID()
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response()
+		s.Get("test.model").Response()
+		a, b := <-ch, <-ch
+		restest.AssertTrue(t, "correlation ID to be set", a != "")
+		restest.AssertTrue(t, "correlation IDs to be unique", a != b)
+	})
+}
+
+// Test that CorrelationID returns empty string for resources not part of a request
+func TestCorrelationID_UsingWith_ReturnsEmptyString(t *testing.T) {
+	runTestAsync(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session, done func()) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			restest.AssertEqualJSON(t, "CorrelationID", r.CorrelationID(), "")
+			done()
+		}))
+	})
+}
+
+// Test that errors logged while handling a request include the correlation ID
+func TestCorrelationID_WithPanickingHandler_IncludedInOnError(t *testing.T) {
+	ch := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { ch <- msg })
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			panic("boom")
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", nats.Header{res.HeaderCorrelationID: {"abc"}}, []byte(`{}`))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInternalError)
+		select {
+		case msg := <-ch:
+			restest.AssertTrue(t, "OnError message to contain correlation ID", strings.Contains(msg, "[abc]"))
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected OnError callback to be called, but it wasn't")
+		}
+	})
+}
+
+// Test that WithSibling calls the callback with the sibling resource, and then
+// the done callback, after the handler has returned
+func TestWithSibling_WithMatchingResource_CallsCallbacksInOrder(t *testing.T) {
+	ch := make(chan string, 3)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Group("shared"), res.Call("method", func(r res.CallRequest) {
+			restest.AssertNoError(t, r.WithSibling("test.sibling.42", func(sr res.Resource) {
+				ch <- "callback " + sr.ResourceName() + " " + sr.PathParam("id")
+			}, func() {
+				ch <- "done"
+			}))
+			ch <- "handler"
+			r.OK(nil)
+		}))
+		s.Handle("sibling.$id", res.Group("shared"), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		for _, expected := range []string{"handler", "callback test.sibling.42 42", "done"} {
+			select {
+			case v := <-ch:
+				restest.AssertEqualJSON(t, "callback", v, expected)
+			case <-time.After(timeoutDuration):
+				t.Fatalf("expected %s to be called, but it wasn't", expected)
+			}
+		}
+	})
+}
+
+// Test that WithSibling with a nil done callback only calls the callback
+func TestWithSibling_WithoutDone_CallsCallback(t *testing.T) {
+	ch := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Group("shared"), res.Call("method", func(r res.CallRequest) {
+			restest.AssertNoError(t, r.WithSibling("test.sibling", func(sr res.Resource) {
+				ch <- sr.ResourceName()
+			}, nil))
+			r.OK(nil)
+		}))
+		s.Handle("sibling", res.Group("shared"), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		select {
+		case v := <-ch:
+			restest.AssertEqualJSON(t, "resource name", v, "test.sibling")
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected callback to be called, but it wasn't")
+		}
+	})
+}
+
+// Test that WithSibling returns an error if no handler matches the resource ID
+func TestWithSibling_WithNoMatchingHandler_ReturnsError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			err := r.WithSibling("test.missing", func(res.Resource) {
+				t.Error("expected callback not to be called")
+			}, func() {
+				t.Error("expected done not to be called")
+			})
+			restest.AssertError(t, err)
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+type tableKey struct{}
+
+type pageSizeKey struct{}
+
+// Test that HandlerValue returns the values set with WithValue for each pattern.
+func TestHandlerValue_SharedHandler_ReturnsPatternValue(t *testing.T) {
+	getRow := func(r res.ModelRequest) {
+		r.Model(map[string]interface{}{
+			"table":    r.HandlerValue(tableKey{}),
+			"pageSize": r.HandlerValue(pageSizeKey{}),
+		})
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("book.$id", res.GetModel(getRow), res.WithValue(tableKey{}, "books"), res.WithValue(pageSizeKey{}, 10))
+		s.Handle("author.$id", res.GetModel(getRow), res.WithValue(tableKey{}, "authors"))
+	}, func(s *restest.Session) {
+		s.Get("test.book.1").
+			Response().
+			AssertModel(map[string]interface{}{"table": "books", "pageSize": 10})
+		s.Get("test.author.1").
+			Response().
+			AssertModel(map[string]interface{}{"table": "authors", "pageSize": nil})
+	})
+}
+
+// Test that HandlerValue is available using With.
+func TestHandlerValue_UsingWith_ReturnsValue(t *testing.T) {
+	runTestAsync(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }), res.WithValue(tableKey{}, "models"))
+	}, func(s *restest.Session, done func()) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			restest.AssertEqualJSON(t, "HandlerValue", r.HandlerValue(tableKey{}), "models")
+			done()
+		}))
+	})
+}
+
+// Test that WithValue panics on invalid keys.
+func TestWithValue_InvalidKey_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.WithValue(nil, "foo") })
+	restest.AssertPanic(t, func() { res.WithValue([]string{"foo"}, "foo") })
+}
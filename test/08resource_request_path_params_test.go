@@ -49,3 +49,120 @@ func TestPathParamsUsingWith(t *testing.T) {
 		})
 	}
 }
+
+// Test PathParams method returns parameters derived from the resource ID for
+// handlers on a mounted Mux.
+func TestPathParamsOnMountedMux(t *testing.T) {
+	for _, l := range resourceRequestPathParamsTestTbl {
+		runTest(t, func(s *res.Service) {
+			m := res.NewMux("")
+			m.Handle(l.Pattern, res.GetModel(func(r res.ModelRequest) {
+				restest.AssertEqualJSON(t, "PathParams", r.PathParams(), l.Expected)
+				for k, v := range l.Expected {
+					restest.AssertEqualJSON(t, "PathParam", r.PathParam(k), v)
+				}
+				r.NotFound()
+			}))
+			s.Mount("sub", m)
+		}, func(s *restest.Session) {
+			s.Get("test.sub." + l.ResourceName[len("test."):]).
+				Response().
+				AssertError(res.ErrNotFound)
+		})
+	}
+}
+
+// Test BindParams binds path and query parameters with type conversion.
+func TestBindParams_WithValidParams_BindsStruct(t *testing.T) {
+	type params struct {
+		ID     int      `path:"id"`
+		Org    string   `path:"org"`
+		Limit  uint8    `query:"limit"`
+		Active bool     `query:"active"`
+		Tags   []string `query:"tag"`
+		Other  string
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("org.$org.user.$id", res.GetModel(func(r res.ModelRequest) {
+			p := params{Limit: 10}
+			restest.AssertTrue(t, "BindParams to return true", r.BindParams(&p))
+			restest.AssertEqualJSON(t, "params", p, params{ID: 42, Org: "acme", Limit: 10, Active: true, Tags: []string{"a", "b"}})
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.org.acme.user.42?active=true&tag=a&tag=b").
+			Response().
+			AssertModel(mock.Model)
+	})
+}
+
+// Test BindParams responds with not found on path parameter conversion
+// failure.
+func TestBindParams_WithInvalidPathParam_RespondsWithNotFound(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("user.$id", res.GetModel(func(r res.ModelRequest) {
+			var p struct {
+				ID int `path:"id"`
+			}
+			restest.AssertTrue(t, "BindParams to return false", !r.BindParams(&p))
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.user.foo").
+			Response().
+			AssertError(res.ErrNotFound)
+	})
+}
+
+// Test BindParams responds with invalid query on query parameter conversion
+// failure.
+func TestBindParams_WithInvalidQueryParam_RespondsWithInvalidQuery(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("user.$id", res.Call("method", func(r res.CallRequest) {
+			var p struct {
+				ID    int   `path:"id"`
+				Limit []int `query:"limit"`
+			}
+			restest.AssertTrue(t, "BindParams to return false", !r.BindParams(&p))
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.user.42?limit=1&limit=foo", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidQuery)
+	})
+}
+
+// Test BindParams responds with invalid query on a malformed query, in the
+// same way as QueryValues.
+func TestBindParams_WithMalformedQuery_RespondsWithInvalidQuery(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("user.$id", res.Call("method", func(r res.CallRequest) {
+			var p struct {
+				Limit int `query:"limit"`
+			}
+			restest.AssertTrue(t, "BindParams to return false", !r.BindParams(&p))
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.user.42?limit=10&tag=%zz", "method", nil).
+			Response().
+			AssertError(&res.Error{Code: res.CodeInvalidQuery, Message: `Invalid query: invalid URL escape "%zz"`})
+	})
+}
+
+// Test BindParams panics when binding a path parameter missing from the
+// pattern.
+func TestBindParams_WithMissingPathParam_CausesPanic(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("user.$id", res.GetModel(func(r res.ModelRequest) {
+			var p struct {
+				Org string `path:"org"`
+			}
+			restest.AssertPanicNoRecover(t, func() {
+				r.BindParams(&p)
+			})
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.user.42").
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
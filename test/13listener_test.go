@@ -2,8 +2,10 @@ package test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	res "github.com/jirenius/go-res"
 	"github.com/jirenius/go-res/restest"
@@ -401,3 +403,278 @@ func TestListenerDeleteEvent_WithoutApplyDelete_CallsListener(t *testing.T) {
 			AssertResult(nil)
 	})
 }
+
+func TestErrorListener_LogPolicyWithError_SendsEventAndCallsListenerOnce(t *testing.T) {
+	called := 0
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": 42})
+				r.OK(nil)
+			}),
+		)
+		s.AddErrorListener("model", res.ErrorListener{
+			Policy: res.ListenerLog,
+			Handler: func(ev *res.Event) error {
+				called++
+				return errors.New("listener error")
+			},
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().
+			AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "called", called, 1)
+	})
+}
+
+func TestErrorListener_RetryPolicyWithError_RetriesListener(t *testing.T) {
+	called := 0
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": 42})
+				r.OK(nil)
+			}),
+			res.OptionFunc(func(hs *res.Handler) {
+				hs.ErrorListeners = map[string]res.ErrorListener{
+					"model": {
+						Policy: res.ListenerRetry,
+						Handler: func(ev *res.Event) error {
+							called++
+							if called < 3 {
+								return errors.New("listener error")
+							}
+							return nil
+						},
+					},
+				}
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().
+			AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "called", called, 3)
+	})
+}
+
+func TestErrorListener_ListenerPanics_RecoversAndCallsRemainingListeners(t *testing.T) {
+	called := 0
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": 42})
+				r.OK(nil)
+			}),
+		)
+		s.AddErrorListener("model", res.ErrorListener{
+			Handler: func(ev *res.Event) error {
+				panic("listener panic")
+			},
+		})
+		s.AddErrorListener("model", res.ErrorListener{
+			Handler: func(ev *res.Event) error {
+				called++
+				return nil
+			},
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().
+			AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "called", called, 1)
+	})
+}
+
+func TestErrorListener_VetoPolicyWithError_EventNotSentOrApplied(t *testing.T) {
+	vetoErr := &res.Error{Code: "test.vetoed", Message: "Vetoed"}
+	applied := false
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": 42})
+				r.OK(nil)
+			}),
+			res.ApplyChange(func(re res.Resource, changed map[string]interface{}) (map[string]interface{}, error) {
+				applied = true
+				return nil, nil
+			}),
+		)
+		s.AddErrorListener("model", res.ErrorListener{
+			Policy: res.ListenerVeto,
+			Handler: func(ev *res.Event) error {
+				restest.AssertEqualJSON(t, "ev.Name", ev.Name, "change")
+				restest.AssertEqualJSON(t, "ev.NewValues", ev.NewValues, map[string]interface{}{"foo": 42})
+				return vetoErr
+			},
+		})
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertError(vetoErr)
+		restest.AssertTrue(t, "change not applied", !applied)
+	})
+}
+
+func TestErrorListener_VetoPolicyWithoutError_SendsEvent(t *testing.T) {
+	called := 0
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": 42})
+				restest.AssertEqualJSON(t, "called", called, 1)
+				r.OK(nil)
+			}),
+		)
+		s.AddErrorListener("model", res.ErrorListener{
+			Policy: res.ListenerVeto,
+			Handler: func(ev *res.Event) error {
+				called++
+				return nil
+			},
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().
+			AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().
+			AssertResult(nil)
+	})
+}
+
+func TestErrorListener_Async_CalledInOrderWithoutBlockingRequest(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	var values []interface{}
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				for i := 1; i <= 3; i++ {
+					r.ChangeEvent(map[string]interface{}{"foo": i})
+				}
+				r.OK(nil)
+			}),
+		)
+		s.AddErrorListener("model", res.ErrorListener{
+			Async: true,
+			Handler: func(ev *res.Event) error {
+				<-release
+				values = append(values, ev.NewValues["foo"])
+				if len(values) == 3 {
+					close(done)
+				}
+				return nil
+			},
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		for i := 1; i <= 3; i++ {
+			s.GetMsg().
+				AssertChangeEvent("test.model", map[string]interface{}{"foo": i})
+		}
+		req.Response().
+			AssertResult(nil)
+		close(release)
+		select {
+		case <-done:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected async listener to be called")
+		}
+		restest.AssertEqualJSON(t, "values", values, []int{1, 2, 3})
+	})
+}
+
+func TestAddErrorListener_AsyncVeto_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		s := res.NewService("test")
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {}))
+		s.AddErrorListener("model", res.ErrorListener{
+			Policy:  res.ListenerVeto,
+			Async:   true,
+			Handler: func(ev *res.Event) error { return nil },
+		})
+	})
+}
+
+type lentEvent struct {
+	UserID string `json:"userId"`
+}
+
+func (ev lentEvent) Validate() error {
+	if ev.UserID == "" {
+		return errors.New("missing userId")
+	}
+	return nil
+}
+
+func TestListenerT_EventT_CallsListenerWithTypedPayload(t *testing.T) {
+	var payloads []lentEvent
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				res.EventT(r, "lent", lentEvent{UserID: "42"})
+				r.Event("other", lentEvent{UserID: "13"})
+				r.OK(nil)
+			}),
+		)
+		res.AddListenerT(s.Mux, "model", "lent", func(r res.Resource, ev lentEvent) {
+			restest.AssertEqualJSON(t, "r.ResourceName", r.ResourceName(), "test.model")
+			payloads = append(payloads, ev)
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertCustomEvent("test.model", "lent", lentEvent{UserID: "42"})
+		s.GetMsg().AssertCustomEvent("test.model", "other", lentEvent{UserID: "13"})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "payloads", payloads, []lentEvent{{UserID: "42"}})
+	})
+}
+
+func TestListenerT_UntypedPayload_DecodesPayload(t *testing.T) {
+	var payloads []lentEvent
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.Event("lent", map[string]interface{}{"userId": "42"})
+				r.Event("lent", json.RawMessage(`{"userId":"13"}`))
+				r.OK(nil)
+			}),
+		)
+		res.AddListenerT(s.Mux, "model", "lent", func(r res.Resource, ev lentEvent) {
+			payloads = append(payloads, ev)
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertEventName("test.model", "lent")
+		s.GetMsg().AssertEventName("test.model", "lent")
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "payloads", payloads, []lentEvent{{UserID: "42"}, {UserID: "13"}})
+	})
+}
+
+func TestListenerT_InvalidPayload_PanicsOnEventT(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				restest.AssertPanic(t, func() {
+					res.EventT(r, "lent", lentEvent{})
+				})
+				restest.AssertPanic(t, func() {
+					res.EventT(r, "invalid", func() {})
+				})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+	})
+}
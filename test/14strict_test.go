@@ -0,0 +1,187 @@
+package test
+
+import (
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a change event on a resource with unset type calls OnError in
+// strict mode.
+func TestStrict_ChangeEventOnUnsetType_CallsOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 1)
+	})
+}
+
+// Test that a change event with a property not found on a struct model calls
+// OnError in strict mode.
+func TestStrict_ChangeEventWithUnknownField_CallsOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": "bar", "unknown": 42})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar", "unknown": 42})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 1)
+	})
+}
+
+// Test that a change event with a property of a private field is rejected,
+// calling OnError and not sending the property, in strict mode.
+func TestStrict_ChangeEventWithPrivateField_IsRejected(t *testing.T) {
+	type user struct {
+		Name         string `json:"name"`
+		PasswordHash string `json:"passwordHash" res:"private"`
+	}
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(user{Name: "jane"}) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"passwordHash": "secret"})
+				r.ChangeEvent(map[string]interface{}{"name": "john", "passwordHash": "secret"})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"name": "john"})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 2)
+	})
+}
+
+// Test that an add event with idx out of bounds calls OnError in strict mode.
+func TestStrict_AddEventOutOfBounds_CallsOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("collection",
+			res.GetCollection(func(r res.CollectionRequest) { r.Collection(mock.Collection) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.AddEvent("foo", len(mock.Collection)+1)
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.collection", "method", nil)
+		s.GetMsg().AssertAddEvent("test.collection", "foo", len(mock.Collection)+1)
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 1)
+	})
+}
+
+// Test that valid events do not call OnError in strict mode.
+func TestStrict_ValidEvents_DoesNotCallOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 0)
+	})
+}
+
+// Test that inconsistencies are not reported when strict mode is not set.
+func TestStrict_NotSet_DoesNotCallOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": 42})
+		req.Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "error count", len(errs), 0)
+	})
+}
+
+// Test that references in responses to registered or external resources do
+// not call OnError in strict mode.
+func TestStrict_ResponseWithKnownRefs_DoesNotCallOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetExternalResources("other.>")
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			r.Model(map[string]interface{}{
+				"self":  res.Ref("test.model.42?q=foo"),
+				"other": res.SoftRef("other.model.42"),
+				"data":  res.NewDataValue(map[string]string{"rid": "test.unknown"}),
+			})
+		}))
+		s.Handle("collection", res.GetCollection(func(r res.CollectionRequest) {
+			r.Collection([]res.Ref{"test.model.1", "other.model.2"})
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model.42").Response()
+		s.Get("test.collection").Response()
+		restest.AssertEqualJSON(t, "error count", len(errs), 0)
+	})
+}
+
+// Test that references in responses to unknown resources call OnError in
+// strict mode.
+func TestStrict_ResponseWithUnknownRefs_CallsOnError(t *testing.T) {
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetStrict(true)
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			r.Model(map[string]interface{}{"ref": res.Ref("test.modl.42")})
+		}))
+		s.Handle("collection", res.GetCollection(func(r res.CollectionRequest) {
+			r.Collection([]res.Ref{"test.model.1", "library.bok.42"})
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model.42").Response()
+		s.Get("test.collection").Response()
+		restest.AssertEqualJSON(t, "error count", len(errs), 2)
+	})
+}
+
+// Test that SetExternalResources panics on an invalid pattern.
+func TestSetExternalResources_InvalidPattern_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.NewService("test").SetExternalResources("other..model")
+	})
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/logger"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that LogRequests with sample rate 1 logs a summary of every request.
+func TestLogRequests_WithFullSampleRate_LogsSummary(t *testing.T) {
+	l := logger.NewMemLogger()
+	runTest(t, func(s *res.Service) {
+		s.SetLogger(l)
+		s.Handle("model",
+			res.LogRequests(logger.LevelInfo, 1),
+			res.GetModel(func(r res.ModelRequest) { r.NotFound() }),
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+		log := l.String()
+		restest.AssertTrue(t, "log to contain call summary", strings.Contains(log, "Request call test.model.method: result"), log)
+		restest.AssertTrue(t, "log to contain get summary", strings.Contains(log, "Request get test.model: system.notFound"), log)
+	}, restest.WithKeepLogger)
+}
+
+// Test that LogRequests with sample rate 0 logs no summaries.
+func TestLogRequests_WithZeroSampleRate_LogsNothing(t *testing.T) {
+	l := logger.NewMemLogger()
+	runTest(t, func(s *res.Service) {
+		s.SetLogger(l)
+		s.Handle("model",
+			res.LogRequests(logger.LevelInfo, 0),
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		log := l.String()
+		restest.AssertTrue(t, "log not to contain call summary", !strings.Contains(log, "Request call"), log)
+	}, restest.WithKeepLogger)
+}
+
+// Test that LogRequests panics on invalid sample rate.
+func TestLogRequests_WithInvalidSampleRate_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.LogRequests(logger.LevelInfo, 1.5) })
+	restest.AssertPanic(t, func() { res.LogRequests(logger.LevelInfo, -0.5) })
+}
+
+// Test that request summaries include the handler's labels.
+func TestLogRequests_WithLabels_LogsLabels(t *testing.T) {
+	l := logger.NewMemLogger()
+	runTest(t, func(s *res.Service) {
+		s.SetLogger(l)
+		s.Handle("model",
+			res.LogRequests(logger.LevelInfo, 1),
+			res.Labels(map[string]string{"team": "core", "area": "library"}),
+			res.GetModel(func(r res.ModelRequest) { r.NotFound() }),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+		log := l.String()
+		restest.AssertTrue(t, "log to contain labels", strings.Contains(log, "] area=library team=core"), log)
+	}, restest.WithKeepLogger)
+}
+
+// Test that Labels options are merged and available on the resource.
+func TestLabels_MultipleOptions_MergesLabels(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Labels(map[string]string{"area": "library", "team": "core"}),
+			res.Labels(map[string]string{"team": "books"}),
+			res.GetModel(func(r res.ModelRequest) {
+				restest.AssertEqualJSON(t, "labels", r.Labels(), map[string]string{"area": "library", "team": "books"})
+				r.NotFound()
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+	})
+}
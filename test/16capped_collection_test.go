@@ -0,0 +1,106 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that AddCapped sends add events, and remove events at the head once
+// the length limit is exceeded.
+func TestCappedCollection_AddCapped_RemovesHead(t *testing.T) {
+	cc := res.NewCappedCollection(2, 0)
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", cc)
+	}, func(s *restest.Session) {
+		for _, v := range []string{"foo", "bar", "baz"} {
+			v := v
+			restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+				restest.AssertNoError(t, cc.AddCapped(r, v))
+			}))
+		}
+		s.GetMsg().AssertAddEvent("test.collection", "foo", 0)
+		s.GetMsg().AssertAddEvent("test.collection", "bar", 1)
+		s.GetMsg().AssertAddEvent("test.collection", "baz", 2)
+		s.GetMsg().AssertRemoveEvent("test.collection", 0)
+		s.Get("test.collection").
+			Response().
+			AssertCollection(json.RawMessage(`["bar","baz"]`))
+	})
+}
+
+// Test that a capped collection loads persisted values, trimmed by age, and
+// saves them on change.
+func TestCappedCollection_WithLoadAndSave_PersistsValues(t *testing.T) {
+	savedCh := make(chan []res.CappedValue, 1)
+	cc := res.NewCappedCollection(0, time.Hour)
+	cc.Load = func(rname string) ([]res.CappedValue, error) {
+		restest.AssertEqualJSON(t, "rname", rname, "test.collection")
+		return []res.CappedValue{
+			{Value: "old", Time: time.Now().Add(-2 * time.Hour)},
+			{Value: "foo", Time: time.Now().Add(-time.Minute)},
+		}, nil
+	}
+	cc.Save = func(rname string, values []res.CappedValue) error {
+		savedCh <- values
+		return nil
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", cc)
+	}, func(s *restest.Session) {
+		s.Get("test.collection").
+			Response().
+			AssertCollection(json.RawMessage(`["foo"]`))
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			restest.AssertNoError(t, cc.AddCapped(r, "bar"))
+		}))
+		s.GetMsg().AssertAddEvent("test.collection", "bar", 1)
+		saved := <-savedCh
+		restest.AssertEqualJSON(t, "saved values", len(saved), 2)
+		restest.AssertEqualJSON(t, "last saved value", saved[1].Value, "bar")
+	})
+}
+
+// Test that Trim removes expired values from the head.
+func TestCappedCollection_Trim_RemovesExpiredValues(t *testing.T) {
+	cc := res.NewCappedCollection(0, 50*time.Millisecond)
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", cc)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			restest.AssertNoError(t, cc.AddCapped(r, "foo"))
+		}))
+		s.GetMsg().AssertAddEvent("test.collection", "foo", 0)
+		time.Sleep(60 * time.Millisecond)
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			restest.AssertNoError(t, cc.Trim(r))
+			restest.AssertNoError(t, cc.Trim(r))
+		}))
+		s.GetMsg().AssertRemoveEvent("test.collection", 0)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a failing Load responds with the error.
+func TestCappedCollection_LoadError_RespondsWithError(t *testing.T) {
+	cc := res.NewCappedCollection(10, 0)
+	cc.Load = func(rname string) ([]res.CappedValue, error) {
+		return nil, res.ErrTimeout
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", cc)
+	}, func(s *restest.Session) {
+		s.Get("test.collection").
+			Response().
+			AssertError(res.ErrTimeout)
+	})
+}
+
+// Test that NewCappedCollection panics on negative limits.
+func TestNewCappedCollection_NegativeLimit_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.NewCappedCollection(-1, 0) })
+	restest.AssertPanic(t, func() { res.NewCappedCollection(0, -time.Second) })
+}
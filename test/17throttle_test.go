@@ -0,0 +1,131 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that ThrottleBatch sends the first event immediately, and merges
+// consecutive change events exceeding the rate into one.
+func TestThrottleEvents_Batch_MergesChangeEvents(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ThrottleEvents(20, res.ThrottleBatch), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2, "bar": "a"})
+			r.ChangeEvent(map[string]interface{}{"foo": 3})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":3,"bar":"a"}`))
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that ThrottleBatch sends buffered collection events in order.
+func TestThrottleEvents_Batch_KeepsEventOrder(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", res.ThrottleEvents(20, res.ThrottleBatch), res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			r.AddEvent("foo", 0)
+			r.AddEvent("bar", 1)
+			r.RemoveEvent(0)
+			r.Event("custom", map[string]int{"foo": 42})
+		}))
+		s.GetMsg().AssertAddEvent("test.collection", "foo", 0)
+		s.GetMsg().AssertAddEvent("test.collection", "bar", 1)
+		s.GetMsg().AssertRemoveEvent("test.collection", 0)
+		s.GetMsg().AssertEvent("test.collection", restest.Event{Name: "custom", Payload: map[string]int{"foo": 42}})
+	})
+}
+
+// Test that ThrottleSample drops events exceeding the rate, and sends a reset
+// event for the resource.
+func TestThrottleEvents_Sample_SendsResetEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ThrottleEvents(20, res.ThrottleSample), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2})
+			r.ChangeEvent(map[string]interface{}{"foo": 3})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a delete event flushes buffered events before being sent.
+func TestThrottleEvents_DeleteEvent_FlushesBufferedEvents(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ThrottleEvents(1, res.ThrottleBatch), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2})
+			r.DeleteEvent()
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":2}`))
+		s.GetMsg().AssertDeleteEvent("test.model")
+	})
+}
+
+// Test that ThrottleBatch sends buffered events before responding to a get
+// request for the resource.
+func TestThrottleEvents_BatchWithGetRequest_SendsBufferedEventsBeforeResponse(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model", res.ThrottleEvents(1, res.ThrottleBatch), res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		req := s.Get("test.model")
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":2}`))
+		req.Response().AssertModel(mock.Model)
+		clock.Add(time.Second)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that buffered events are sent at the end of the throttle interval on
+// the resource's worker goroutine, waiting for any work in progress.
+func TestThrottleEvents_IntervalEnd_SendsBufferedEventsOnWorker(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model", res.ThrottleEvents(1, res.ThrottleBatch), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+			r.Event("custom", nil)
+		}))
+		clock.Add(time.Second)
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":2}`))
+		s.GetMsg().AssertEventName("test.model", "custom")
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that ThrottleEvents panics on an invalid rate.
+func TestThrottleEvents_InvalidRate_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.ThrottleEvents(0, res.ThrottleSample) })
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that events on an item reset the dependent collection with matching
+// tags.
+func TestDependsOn_ItemEvent_ResetsDependentResource(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("entity.$entityID.guest.$guestID", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+		s.Handle("entity.$entityID.guests",
+			res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+			res.DependsOn("test.entity.$entityID.guest.$guestID"),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.entity.42.guest.7", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"name": "foo"})
+		}))
+		s.GetMsg().AssertChangeEvent("test.entity.42.guest.7", json.RawMessage(`{"name":"foo"}`))
+		s.GetMsg().AssertSystemReset([]string{"test.entity.42.guests"}, nil)
+
+		restest.AssertNoError(t, s.Service().With("test.entity.42.guest.7", func(r res.Resource) {
+			r.DeleteEvent()
+		}))
+		s.GetMsg().AssertDeleteEvent("test.entity.42.guest.7")
+		s.GetMsg().AssertSystemReset([]string{"test.entity.42.guests"}, nil)
+	})
+}
+
+// Test that events on resources not matching a dependency pattern do not
+// reset any resource.
+func TestDependsOn_UnrelatedEvent_SendsNoReset(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("entity.$entityID.guest.$guestID", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+		s.Handle("entity.$entityID.info", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+		s.Handle("entity.$entityID.guests",
+			res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+			res.DependsOn("test.entity.$entityID.guest.$guestID"),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.entity.42.info", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"name": "foo"})
+		}))
+		s.GetMsg().AssertChangeEvent("test.entity.42.info", json.RawMessage(`{"name":"foo"}`))
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a dependency on multiple patterns resets the dependent resource
+// once per event.
+func TestDependsOn_MultiplePatterns_ResetsOnce(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("entity.$entityID.guest.$guestID", res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }))
+		s.Handle("entity.$entityID.summary",
+			res.GetModel(func(r res.ModelRequest) { r.NotFound() }),
+			res.DependsOn("test.entity.$entityID.guest.$guestID", "test.entity.$entityID.*.$guestID"),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.entity.1.guest.2", func(r res.Resource) {
+			r.AddEvent("foo", 0)
+		}))
+		s.GetMsg().AssertAddEvent("test.entity.1.guest.2", "foo", 0)
+		s.GetMsg().AssertSystemReset([]string{"test.entity.1.summary"}, nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that throttled events dropped within a throttle interval do not reset
+// dependent resources until the interval ends.
+func TestDependsOn_ThrottledEvents_ResetsOnlyForSentEvents(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("entity.$entityID.guest.$guestID",
+			res.ThrottleEvents(20, res.ThrottleSample),
+			res.GetModel(func(r res.ModelRequest) { r.NotFound() }),
+		)
+		s.Handle("entity.$entityID.guests",
+			res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+			res.DependsOn("test.entity.$entityID.guest.$guestID"),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.entity.42.guest.7", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"name": "foo"})
+			r.ChangeEvent(map[string]interface{}{"name": "bar"})
+			r.ChangeEvent(map[string]interface{}{"name": "baz"})
+		}))
+		s.GetMsg().AssertChangeEvent("test.entity.42.guest.7", json.RawMessage(`{"name":"foo"}`))
+		s.GetMsg().AssertSystemReset([]string{"test.entity.42.guests"}, nil)
+		// Dropped events are handled at the end of the interval
+		s.GetMsg().AssertSystemReset([]string{"test.entity.42.guest.7"}, nil)
+		s.GetMsg().AssertSystemReset([]string{"test.entity.42.guests"}, nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that handlers with dependencies may be registered concurrently.
+func TestDependsOn_ConcurrentRegistration_RegistersAll(t *testing.T) {
+	s := res.NewService("test")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Handle("entity.$entityID.list"+strconv.Itoa(i),
+				res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+				res.DependsOn("test.entity.$entityID.guest.$guestID"),
+			)
+		}(i)
+	}
+	wg.Wait()
+	s.Handle("entity.$entityID.guest.$guestID", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	session := restest.NewSession(t, s)
+	defer session.Close()
+	restest.AssertNoError(t, s.With("test.entity.42.guest.7", func(r res.Resource) {
+		r.ChangeEvent(map[string]interface{}{"name": "foo"})
+	}))
+	session.GetMsg().AssertChangeEvent("test.entity.42.guest.7", json.RawMessage(`{"name":"foo"}`))
+	msg := session.GetMsg().AssertSubject("system.reset")
+	var ev struct {
+		Resources []string `json:"resources"`
+	}
+	restest.AssertNoError(t, json.Unmarshal(msg.Data, &ev))
+	restest.AssertEqualJSON(t, "reset resource count", len(ev.Resources), 10)
+}
+
+// Test that DependsOn panics when the dependency pattern is missing a tag of
+// the handler pattern.
+func TestDependsOn_MissingTag_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		s := res.NewService("test")
+		s.Handle("entity.$entityID.guests", res.DependsOn("test.guest.$guestID"))
+	})
+}
+
+// Test that DependsOn panics on an invalid pattern.
+func TestDependsOn_InvalidPattern_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.DependsOn("test..guest")
+	})
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func registerCoverageHandlers(s *res.Service) {
+	s.Handle("model.$id",
+		res.Access(res.AccessGranted),
+		res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		res.Call("set", func(r res.CallRequest) { r.OK(nil) }),
+		res.Auth("login", func(r res.AuthRequest) { r.OK(nil) }),
+	)
+	s.Handle("model.foo",
+		res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+	)
+}
+
+// Test that Coverage lists the handler methods never invoked.
+func TestCoverage_PartiallyExercised_ReturnsUncovered(t *testing.T) {
+	c := restest.NewCoverage()
+	runTest(t, registerCoverageHandlers, func(s *restest.Session) {
+		s.Get("test.model.42").Response()
+		s.Get("test.model.foo").Response()
+		s.Call("test.model.42", "set", nil).Response()
+	}, restest.WithCoverage(c))
+	restest.AssertEqualJSON(t, "uncovered", c.Uncovered(), []string{
+		"access test.model.$id",
+		"auth test.model.$id.login",
+	})
+	restest.AssertEqualJSON(t, "get hits", c.Hits("get test.model.$id"), 1)
+	restest.AssertEqualJSON(t, "specific get hits", c.Hits("get test.model.foo"), 1)
+}
+
+// Test that Coverage tracks handler methods across multiple sessions.
+func TestCoverage_MultipleSessions_CombinesCoverage(t *testing.T) {
+	c := restest.NewCoverage()
+	runTest(t, registerCoverageHandlers, func(s *restest.Session) {
+		s.Get("test.model.42").Response()
+		s.Get("test.model.foo").Response()
+		s.Access("test.model.42", nil).Response()
+	}, restest.WithCoverage(c))
+	runTest(t, registerCoverageHandlers, func(s *restest.Session) {
+		s.Get("test.model.42").Response()
+		s.Call("test.model.42", "set", nil).Response()
+		s.Auth("test.model.42", "login", nil).Response()
+	}, restest.WithCoverage(c))
+	restest.AssertEqualJSON(t, "uncovered", c.Uncovered(), nil)
+	restest.AssertEqualJSON(t, "get hits", c.Hits("get test.model.$id"), 2)
+	c.AssertCovered(t)
+}
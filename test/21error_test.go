@@ -2,6 +2,7 @@ package test
 
 import (
 	"errors"
+	"net/http"
 	"testing"
 
 	res "github.com/jirenius/go-res"
@@ -34,3 +35,77 @@ func TestErrorMethod(t *testing.T) {
 	}
 	restest.AssertEqualJSON(t, "Error", e.Error(), mock.ErrorMessage)
 }
+
+// Test RegisterError returns an error with the code and message, and
+// registers the message and HTTP status.
+func TestRegisterError_CustomCode_RegistersMessageAndStatus(t *testing.T) {
+	e := res.RegisterError("test.catalog.registered", "Registered error", http.StatusConflict)
+	restest.AssertEqualJSON(t, "Error", e, &res.Error{Code: "test.catalog.registered", Message: "Registered error"})
+	msg, ok := res.ErrorMessage("test.catalog.registered")
+	restest.AssertTrue(t, "error code to be registered", ok)
+	restest.AssertEqualJSON(t, "ErrorMessage", msg, "Registered error")
+	restest.AssertEqualJSON(t, "ErrorHTTPStatus", res.ErrorHTTPStatus("test.catalog.registered"), http.StatusConflict)
+	restest.AssertEqualJSON(t, "NewError", res.NewError("test.catalog.registered"), e)
+}
+
+// Test ErrorHTTPStatus returns the status of system error codes, and zero
+// for unregistered custom codes.
+func TestErrorHTTPStatus_UnregisteredCodes_ReturnsDefaultStatus(t *testing.T) {
+	restest.AssertEqualJSON(t, "system.notFound status", res.ErrorHTTPStatus(res.CodeNotFound), http.StatusNotFound)
+	restest.AssertEqualJSON(t, "system.unknown status", res.ErrorHTTPStatus("system.unknown"), http.StatusInternalServerError)
+	restest.AssertEqualJSON(t, "custom status", res.ErrorHTTPStatus("test.catalog.unregistered"), 0)
+	restest.AssertEqualJSON(t, "NewError", res.NewError("test.catalog.unregistered"), &res.Error{Code: "test.catalog.unregistered", Message: "test.catalog.unregistered"})
+}
+
+// Test RegisterError panics on system error codes and invalid status.
+func TestRegisterError_InvalidRegistration_CausesPanic(t *testing.T) {
+	restest.AssertPanic(t, func() { res.RegisterError("", "Empty", 0) })
+	restest.AssertPanic(t, func() { res.RegisterError(res.CodeNotFound, "Not found", http.StatusNotFound) })
+	restest.AssertPanic(t, func() { res.RegisterError("test.catalog.invalid", "Invalid", http.StatusOK) })
+}
+
+// Test that an error response with a registered code uses the default
+// message, and the registered status for HTTP requests.
+func TestRegisterError_ErrorResponse_UsesMessageAndStatus(t *testing.T) {
+	res.RegisterError("test.catalog.response", "Catalog error", http.StatusConflict)
+	for _, isHTTP := range []bool{false, true} {
+		runTest(t, func(s *res.Service) {
+			s.Handle("model", res.Call("method", func(r res.CallRequest) {
+				r.ErrorData("test.catalog.response", "", nil)
+			}))
+		}, func(s *restest.Session) {
+			req := mock.DefaultRequest()
+			req.IsHTTP = isHTTP
+			expected := map[string]interface{}{
+				"error": map[string]interface{}{"code": "test.catalog.response", "message": "Catalog error"},
+			}
+			if isHTTP {
+				expected["meta"] = map[string]interface{}{"status": http.StatusConflict}
+			}
+			s.Call("test.model", "method", req).
+				Response().
+				AssertPayload(expected)
+		})
+	}
+}
+
+// Test that a response status set with SetResponseStatus takes precedence
+// over the registered status.
+func TestRegisterError_WithResponseStatus_UsesResponseStatus(t *testing.T) {
+	e := res.RegisterError("test.catalog.status", "Catalog error", http.StatusConflict)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.SetResponseStatus(http.StatusTeapot)
+			r.Error(e)
+		}))
+	}, func(s *restest.Session) {
+		req := mock.DefaultRequest()
+		req.IsHTTP = true
+		s.Call("test.model", "method", req).
+			Response().
+			AssertPayload(map[string]interface{}{
+				"error": e,
+				"meta":  map[string]interface{}{"status": http.StatusTeapot},
+			})
+	})
+}
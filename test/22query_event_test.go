@@ -3,6 +3,7 @@ package test
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -160,6 +161,28 @@ func TestQueryRequestResponse(t *testing.T) {
 			},
 			json.RawMessage(`{"events":[]}`),
 		},
+		{
+			"foo=change_diff",
+			func(r res.QueryRequest) {
+				if r != nil {
+					err := r.ChangeEventDiff(
+						map[string]interface{}{"a": 1, "b": "x", "d": nil},
+						map[string]interface{}{"a": 2, "b": "x", "c": true},
+					)
+					restest.AssertNoError(t, err)
+				}
+			},
+			json.RawMessage(`{"events":[{"event":"change","data":{"values":{"a":2,"c":true,"d":{"action":"delete"}}}}]}`),
+		},
+		{
+			"foo=change_diff_equal",
+			func(r res.QueryRequest) {
+				if r != nil {
+					restest.AssertNoError(t, r.ChangeEventDiff(mock.Model, mock.Model))
+				}
+			},
+			json.RawMessage(`{"events":[]}`),
+		},
 		{
 			"foo=add",
 			func(r res.QueryRequest) {
@@ -590,3 +613,80 @@ func TestInvalidQueryResponse(t *testing.T) {
 		close(ch)
 	}, restest.WithGnatsd)
 }
+
+// Test ModelChanges returns the changed properties of a model.
+func TestModelChanges(t *testing.T) {
+	type book struct {
+		Title  string  `json:"title"`
+		Author *string `json:"author,omitempty"`
+		Owner  res.Ref `json:"owner"`
+	}
+	author := "Jules Verne"
+	tbl := []struct {
+		Before   interface{}
+		After    interface{}
+		Expected json.RawMessage
+	}{
+		{nil, nil, json.RawMessage(`{}`)},
+		{nil, map[string]interface{}{"foo": "bar"}, json.RawMessage(`{"foo":"bar"}`)},
+		{map[string]interface{}{"foo": "bar"}, nil, json.RawMessage(`{"foo":{"action":"delete"}}`)},
+		{map[string]interface{}{"foo": "bar"}, map[string]interface{}{"foo": "bar"}, json.RawMessage(`{}`)},
+		{map[string]interface{}{"foo": 1}, map[string]interface{}{"foo": 1.0}, json.RawMessage(`{}`)},
+		{book{"Dracula", nil, "library.user.1"}, book{"Dracula", nil, "library.user.1"}, json.RawMessage(`{}`)},
+		{book{"Dracula", nil, "library.user.1"}, book{"Around the World", &author, "library.user.2"}, json.RawMessage(`{"title":"Around the World","author":"Jules Verne","owner":{"rid":"library.user.2"}}`)},
+		{book{"Dracula", &author, "library.user.1"}, book{"Dracula", nil, "library.user.1"}, json.RawMessage(`{"author":{"action":"delete"}}`)},
+	}
+	for i, l := range tbl {
+		ch, err := res.ModelChanges(l.Before, l.After)
+		restest.AssertNoError(t, err, fmt.Sprintf("test #%d", i+1))
+		restest.AssertEqualJSON(t, fmt.Sprintf("changes of test #%d", i+1), ch, l.Expected)
+	}
+}
+
+// Test ModelChanges returns an error for values that are not json objects.
+func TestModelChanges_WithNonObjectValue_ReturnsError(t *testing.T) {
+	_, err := res.ModelChanges([]int{1, 2}, nil)
+	restest.AssertError(t, err)
+	_, err = res.ModelChanges(nil, "foo")
+	restest.AssertError(t, err)
+	_, err = res.ModelChanges(nil, func() {})
+	restest.AssertError(t, err)
+}
+
+// Test DiffModel returns the changed properties of a model, with nested values
+// wrapped as data values.
+func TestDiffModel(t *testing.T) {
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	type shape struct {
+		Name  string                   `json:"name"`
+		Pos   point                    `json:"pos"`
+		Tags  []string                 `json:"tags,omitempty"`
+		Owner *res.SoftRef             `json:"owner,omitempty"`
+		Meta  res.DataValue[[]float64] `json:"meta"`
+	}
+	owner := res.SoftRef("library.user.1")
+	tbl := []struct {
+		Before   interface{}
+		After    interface{}
+		Expected json.RawMessage
+	}{
+		{nil, nil, json.RawMessage(`{}`)},
+		{shape{Name: "foo"}, shape{Name: "foo"}, json.RawMessage(`{}`)},
+		{shape{Name: "foo"}, shape{Name: "bar"}, json.RawMessage(`{"name":"bar"}`)},
+		{shape{Pos: point{1, 2}}, shape{Pos: point{1, 3}}, json.RawMessage(`{"pos":{"data":{"x":1,"y":3}}}`)},
+		{shape{}, shape{Tags: []string{"a"}}, json.RawMessage(`{"tags":{"data":["a"]}}`)},
+		{shape{Tags: []string{"a"}}, shape{}, json.RawMessage(`{"tags":{"action":"delete"}}`)},
+		{shape{}, shape{Owner: &owner}, json.RawMessage(`{"owner":{"rid":"library.user.1","soft":true}}`)},
+		{shape{}, shape{Meta: res.NewDataValue([]float64{1.5})}, json.RawMessage(`{"meta":{"data":[1.5]}}`)},
+		{map[string]interface{}{"ref": res.Ref("library.user.1")}, map[string]interface{}{"ref": res.Ref("library.user.2")}, json.RawMessage(`{"ref":{"rid":"library.user.2"}}`)},
+		{nil, map[string]interface{}{"obj": map[string]string{"rid": "foo", "x": "y"}}, json.RawMessage(`{"obj":{"data":{"rid":"foo","x":"y"}}}`)},
+	}
+	for i, l := range tbl {
+		ch, err := res.DiffModel(l.Before, l.After)
+		restest.AssertNoError(t, err, fmt.Sprintf("test #%d", i+1))
+		restest.AssertEqualJSON(t, fmt.Sprintf("changes of test #%d", i+1), ch, l.Expected)
+	}
+}
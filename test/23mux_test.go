@@ -768,6 +768,26 @@ func TestContainsWithSinglePath(t *testing.T) {
 	}
 }
 
+// Test Walk calls the callback for all handlers, including mounted ones.
+func TestWalk_WithMountedMux_CallsCallbackForEachHandler(t *testing.T) {
+	m := res.NewMux("test")
+	m.Handle("model.$id")
+	m.Handle("collection")
+	sub := res.NewMux("")
+	sub.Handle("model.>")
+	m.Mount("sub", sub)
+
+	patterns := make(map[string]bool)
+	m.Walk(func(p res.Pattern, h res.Handler) {
+		patterns[string(p)] = true
+	})
+	restest.AssertEqualJSON(t, "patterns", patterns, map[string]bool{
+		"test.model.$id":   true,
+		"test.collection":  true,
+		"test.sub.model.>": true,
+	})
+}
+
 // Test Contains with overlapping handler paths.
 func TestContainsWithOverlappingPaths(t *testing.T) {
 	tbl := []struct {
@@ -0,0 +1,258 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+type changeBook struct {
+	ID     int     `json:"id"`
+	Title  string  `json:"title"`
+	Author *string `json:"author,omitempty"`
+	Pages  *int    `json:"pages,omitempty"`
+	Secret string  `json:"-"`
+}
+
+type changeBookChange struct {
+	Title  *string `json:"title,omitempty"`
+	Author *string `json:"author,omitempty"`
+	Pages  *int    `json:"pages,omitempty"`
+}
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+
+// Test that Deleted returns the same sentinel for the same type.
+func TestDeleted_SameType_ReturnsSameSentinel(t *testing.T) {
+	restest.AssertTrue(t, "same sentinel for same type", res.Deleted[string]() == res.Deleted[string]())
+	restest.AssertTrue(t, "sentinel not to be nil", res.Deleted[int]() != nil)
+}
+
+// Test ChangeValues converts a change struct into a change map.
+func TestChangeValues(t *testing.T) {
+	type embedded struct {
+		Note *string `json:"note,omitempty"`
+	}
+	type withEmbedded struct {
+		embedded
+		Count  int `json:"count"`
+		hidden int
+		Skip   *int `json:"-"`
+	}
+
+	tbl := []struct {
+		Value    interface{}
+		Expected json.RawMessage
+	}{
+		{changeBookChange{}, json.RawMessage(`{}`)},
+		{changeBookChange{Title: strPtr("Dracula")}, json.RawMessage(`{"title":"Dracula"}`)},
+		{&changeBookChange{Title: strPtr("Dracula"), Author: res.Deleted[string]()}, json.RawMessage(`{"title":"Dracula","author":{"action":"delete"}}`)},
+		{changeBookChange{Pages: res.Deleted[int](), Author: strPtr("")}, json.RawMessage(`{"author":"","pages":{"action":"delete"}}`)},
+		{withEmbedded{embedded: embedded{Note: strPtr("foo")}, Count: 2, hidden: 3, Skip: intPtr(4)}, json.RawMessage(`{"note":"foo","count":2}`)},
+	}
+	for i, l := range tbl {
+		ch, err := res.ChangeValues(l.Value)
+		restest.AssertNoError(t, err, fmt.Sprintf("test #%d", i+1))
+		restest.AssertEqualJSON(t, fmt.Sprintf("changes of test #%d", i+1), ch, l.Expected)
+	}
+}
+
+// Test ChangeValues returns an error for values that are not structs.
+func TestChangeValues_WithInvalidValue_ReturnsError(t *testing.T) {
+	for i, v := range []interface{}{nil, "foo", (*changeBookChange)(nil), map[string]interface{}{}} {
+		_, err := res.ChangeValues(v)
+		restest.AssertError(t, err, fmt.Sprintf("test #%d", i+1))
+	}
+}
+
+// Test ApplyModelChange applies changes and returns revert values.
+func TestApplyModelChange(t *testing.T) {
+	tbl := []struct {
+		Model        changeBook
+		Changes      map[string]interface{}
+		Expected     json.RawMessage
+		ExpectedRev  json.RawMessage
+		ExpectedNote string
+	}{
+		{
+			changeBook{ID: 1, Title: "Dracula"},
+			map[string]interface{}{"title": "Dracula"},
+			json.RawMessage(`{"id":1,"title":"Dracula"}`),
+			json.RawMessage(`{}`),
+			"unchanged value",
+		},
+		{
+			changeBook{ID: 1, Title: "Dracula"},
+			map[string]interface{}{"title": "Emma", "author": "Jane Austen"},
+			json.RawMessage(`{"id":1,"title":"Emma","author":"Jane Austen"}`),
+			json.RawMessage(`{"title":"Dracula","author":{"action":"delete"}}`),
+			"set values",
+		},
+		{
+			changeBook{ID: 1, Title: "Dracula", Author: strPtr("Bram Stoker")},
+			map[string]interface{}{"author": res.DeleteAction},
+			json.RawMessage(`{"id":1,"title":"Dracula"}`),
+			json.RawMessage(`{"author":"Bram Stoker"}`),
+			"delete pointer field",
+		},
+		{
+			changeBook{ID: 1, Title: "Dracula"},
+			map[string]interface{}{"author": res.DeleteAction},
+			json.RawMessage(`{"id":1,"title":"Dracula"}`),
+			json.RawMessage(`{}`),
+			"delete missing field",
+		},
+		{
+			changeBook{ID: 1, Title: "Dracula"},
+			map[string]interface{}{"title": res.DeleteAction},
+			json.RawMessage(`{"id":1,"title":""}`),
+			json.RawMessage(`{"title":"Dracula"}`),
+			"delete non-pointer field",
+		},
+		{
+			changeBook{ID: 1, Title: "Dracula", Pages: intPtr(418)},
+			map[string]interface{}{"id": float64(2), "pages": float64(418)},
+			json.RawMessage(`{"id":2,"title":"Dracula","pages":418}`),
+			json.RawMessage(`{"id":1}`),
+			"converted values",
+		},
+	}
+	for _, l := range tbl {
+		m := l.Model
+		rev, err := res.ApplyModelChange(&m, l.Changes)
+		restest.AssertNoError(t, err, l.ExpectedNote)
+		restest.AssertEqualJSON(t, "model", m, l.Expected, l.ExpectedNote)
+		restest.AssertEqualJSON(t, "revert", rev, l.ExpectedRev, l.ExpectedNote)
+	}
+}
+
+// Test ApplyModelChange returns an error without applying any change on
+// invalid changes or models.
+func TestApplyModelChange_WithInvalidChanges_ReturnsError(t *testing.T) {
+	m := changeBook{ID: 1, Title: "Dracula"}
+	_, err := res.ApplyModelChange(&m, map[string]interface{}{"title": "Emma", "unknown": 1})
+	restest.AssertError(t, err)
+	_, err = res.ApplyModelChange(&m, map[string]interface{}{"title": "Emma", "pages": "many"})
+	restest.AssertError(t, err)
+	restest.AssertEqualJSON(t, "model", m, json.RawMessage(`{"id":1,"title":"Dracula"}`))
+	_, err = res.ApplyModelChange(m, map[string]interface{}{"title": "Emma"})
+	restest.AssertError(t, err)
+	_, err = res.ApplyModelChange((*changeBook)(nil), map[string]interface{}{"title": "Emma"})
+	restest.AssertError(t, err)
+}
+
+// Test typed change helpers used with ChangeEvent and ApplyChange.
+func TestChangeValues_WithApplyModelChange_SendsEventWithOldValues(t *testing.T) {
+	book := changeBook{ID: 42, Title: "Dracula", Author: strPtr("Bram Stoker")}
+	var oldValues map[string]interface{}
+	runTest(t, func(s *res.Service) {
+		s.Handle("book",
+			res.GetModel(func(r res.ModelRequest) { r.Model(book) }),
+			res.ApplyChange(func(r res.Resource, ch map[string]interface{}) (map[string]interface{}, error) {
+				return res.ApplyModelChange(&book, ch)
+			}),
+			res.Call("set", func(r res.CallRequest) {
+				ch, err := res.ChangeValues(changeBookChange{Title: strPtr("Emma"), Author: res.Deleted[string]()})
+				if err != nil {
+					r.Error(err)
+					return
+				}
+				r.ChangeEvent(ch)
+				r.OK(nil)
+			}),
+		)
+		s.AddListener("book", func(ev *res.Event) {
+			oldValues = ev.OldValues
+		})
+	}, func(s *restest.Session) {
+		req := s.Call("test.book", "set", nil)
+		s.GetMsg().AssertChangeEvent("test.book", json.RawMessage(`{"title":"Emma","author":{"action":"delete"}}`))
+		req.Response().AssertResult(nil)
+		s.Get("test.book").Response().AssertModel(json.RawMessage(`{"id":42,"title":"Emma"}`))
+		restest.AssertEqualJSON(t, "old values", oldValues, json.RawMessage(`{"title":"Dracula","author":"Bram Stoker"}`))
+	})
+}
+
+// Test ChangeBuilder builds valid change maps.
+func TestChangeBuilder_Build(t *testing.T) {
+	tbl := []struct {
+		Builder  *res.ChangeBuilder
+		Expected json.RawMessage
+	}{
+		{res.NewChange(), json.RawMessage(`{}`)},
+		{res.NewChange().Set("title", "Dracula"), json.RawMessage(`{"title":"Dracula"}`)},
+		{res.NewChange().Set("pages", 418).Set("read", true).Set("note", nil), json.RawMessage(`{"pages":418,"read":true,"note":null}`)},
+		{res.NewChange().Set("title", strPtr("Dracula")), json.RawMessage(`{"title":"Dracula"}`)},
+		{res.NewChange().Delete("author"), json.RawMessage(`{"author":{"action":"delete"}}`)},
+		{res.NewChange().Ref("owner", "library.user.42"), json.RawMessage(`{"owner":{"rid":"library.user.42"}}`)},
+		{res.NewChange().SoftRef("owner", "library.user.42"), json.RawMessage(`{"owner":{"rid":"library.user.42","soft":true}}`)},
+		{res.NewChange().Set("owner", res.Ref("library.user.42")), json.RawMessage(`{"owner":{"rid":"library.user.42"}}`)},
+		{res.NewChange().Set("tags", res.NewDataValue([]string{"horror"})), json.RawMessage(`{"tags":{"data":["horror"]}}`)},
+		{res.NewChange().Set("title", "Dracula").Set("title", "Emma"), json.RawMessage(`{"title":"Emma"}`)},
+		{res.NewChange().Set("author", "Bram Stoker").Delete("author"), json.RawMessage(`{"author":{"action":"delete"}}`)},
+	}
+	for i, l := range tbl {
+		ch, err := l.Builder.Build()
+		restest.AssertNoError(t, err, fmt.Sprintf("test #%d", i+1))
+		restest.AssertNoError(t, l.Builder.Err(), fmt.Sprintf("test #%d", i+1))
+		restest.AssertEqualJSON(t, fmt.Sprintf("changes of test #%d", i+1), ch, l.Expected)
+	}
+}
+
+// Test ChangeBuilder returns an error on invalid keys or values.
+func TestChangeBuilder_WithInvalidChange_ReturnsError(t *testing.T) {
+	tbl := []*res.ChangeBuilder{
+		res.NewChange().Set("", "Dracula"),
+		res.NewChange().Delete(""),
+		res.NewChange().Set("tags", []string{"horror"}),
+		res.NewChange().Set("book", changeBook{ID: 1}),
+		res.NewChange().Set("meta", map[string]interface{}{"foo": "bar"}),
+		res.NewChange().Set("fn", func() {}),
+		res.NewChange().Set("owner", res.Ref("library..user")),
+		res.NewChange().Ref("owner", "library.user.*"),
+		res.NewChange().SoftRef("owner", ""),
+		res.NewChange().Set("tags", []string{"horror"}).Set("title", "Dracula"),
+	}
+	for i, b := range tbl {
+		ch, err := b.Build()
+		restest.AssertError(t, err, fmt.Sprintf("test #%d", i+1))
+		restest.AssertError(t, b.Err(), fmt.Sprintf("test #%d", i+1))
+		restest.AssertTrue(t, "change map to be nil", ch == nil, fmt.Sprintf("test #%d", i+1))
+	}
+}
+
+// Test ChangeBuilder.Send sends a change event.
+func TestChangeBuilder_Send_SendsChangeEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			if err := res.NewChange().Set("foo", "baz").Delete("bar").SoftRef("ref", "test.model.42").Send(r); err != nil {
+				r.Error(err)
+				return
+			}
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":"baz","bar":{"action":"delete"},"ref":{"rid":"test.model.42","soft":true}}`))
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test ChangeBuilder.Send with an invalid change sends no event.
+func TestChangeBuilder_SendWithInvalidChange_SendsNoEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			if err := res.NewChange().Set("foo", []int{1}).Send(r); err != nil {
+				r.Error(res.ToError(err))
+				return
+			}
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).Response().AssertErrorCode(res.CodeInternalError)
+	})
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func newTokenManagerTest(t *testing.T, cb func(tm *res.TokenManager, s *restest.Session)) {
+	var tm *res.TokenManager
+	runTest(t, func(s *res.Service) {
+		tm = res.NewTokenManager(s, "auth.test.refresh")
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		cb(tm, s)
+	})
+}
+
+// Test that NewTokenManager panics on invalid subject.
+func TestNewTokenManager_WithInvalidSubject_CausesPanic(t *testing.T) {
+	for _, subject := range []string{"", "auth..refresh", "auth.>"} {
+		restest.AssertPanic(t, func() {
+			res.NewTokenManager(res.NewService("test"), subject)
+		}, subject)
+	}
+}
+
+// Test that Issue sends a token event with ID and tracks the token.
+func TestTokenManagerIssue_SendsTokenEventWithID(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.Issue("foo", "tid1", mock.Token)
+		s.GetMsg().AssertTokenEventWithID("foo", "tid1", mock.Token)
+		token, ok := tm.Token("tid1")
+		restest.AssertTrue(t, "token to be tracked", ok)
+		restest.AssertEqualJSON(t, "token", token, mock.Token)
+		_, ok = tm.Token("tid2")
+		restest.AssertTrue(t, "unknown token not to be tracked", !ok)
+	})
+}
+
+// Test that Issue panics on invalid connection ID.
+func TestTokenManagerIssue_WithInvalidCID_CausesPanic(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			tm.Issue("invalid.*.cid", "tid1", mock.Token)
+		})
+		restest.AssertEqualJSON(t, "token IDs", tm.TokenIDs(), []string{})
+	})
+}
+
+// Test that IssueFor sends a token event to the connection of the auth request.
+func TestTokenManagerIssueFor_SendsTokenEventWithID(t *testing.T) {
+	var tm *res.TokenManager
+	runTest(t, func(s *res.Service) {
+		tm = res.NewTokenManager(s, "auth.test.refresh")
+		s.Handle("model", res.Auth("method", func(r res.AuthRequest) {
+			tm.IssueFor(r, "tid1", mock.Token)
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Auth("test.model", "method", nil)
+		s.GetMsg().AssertTokenEventWithID(mock.CID, "tid1", mock.Token)
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that Update sends token events to all connections of the token.
+func TestTokenManagerUpdate_SendsTokenEventsToConnections(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.Issue("foo", "tid1", mock.Token)
+		tm.Issue("bar", "tid1", mock.Token)
+		tm.Issue("baz", "tid2", mock.Token)
+		for i := 0; i < 3; i++ {
+			s.GetMsg()
+		}
+		newToken := json.RawMessage(`{"user":"jane"}`)
+		restest.AssertTrue(t, "update to return true", tm.Update("tid1", newToken))
+		s.GetMsg().AssertTokenEventWithID("bar", "tid1", newToken)
+		s.GetMsg().AssertTokenEventWithID("foo", "tid1", newToken)
+		s.AssertNoMsg(timeoutDuration)
+		token, _ := tm.Token("tid1")
+		restest.AssertEqualJSON(t, "token", token, newToken)
+	})
+}
+
+// Test that Update of an unknown token sends no event.
+func TestTokenManagerUpdate_UnknownTokenID_ReturnsFalse(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		restest.AssertTrue(t, "update to return false", !tm.Update("tid1", mock.Token))
+		s.AssertNoMsg(timeoutDuration)
+	})
+}
+
+// Test that Revoke clears the tokens without sending a token reset event.
+func TestTokenManagerRevoke_ClearsTokens(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.Issue("foo", "tid1", mock.Token)
+		tm.Issue("bar", "tid2", mock.Token)
+		tm.Issue("baz", "tid3", mock.Token)
+		for i := 0; i < 3; i++ {
+			s.GetMsg()
+		}
+		tm.Revoke("tid1", "tid2", "tid4")
+		s.GetMsg().AssertTokenEvent("foo", nil)
+		s.GetMsg().AssertTokenEvent("bar", nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+		restest.AssertEqualJSON(t, "token IDs", tm.TokenIDs(), []string{"tid3"})
+	})
+}
+
+// Test that Forget stops sending token events to the connection.
+func TestTokenManagerForget_StopsTrackingConnection(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.Issue("foo", "tid1", mock.Token)
+		tm.Issue("bar", "tid1", mock.Token)
+		s.GetMsg()
+		s.GetMsg()
+		tm.Forget("foo")
+		tm.Update("tid1", nil)
+		s.GetMsg().AssertTokenEventWithID("bar", "tid1", nil)
+		s.AssertNoMsg(timeoutDuration)
+		restest.AssertEqualJSON(t, "token IDs", tm.TokenIDs(), []string{"tid1"})
+	})
+}
+
+// Test that ResetAll sends a token reset event for all tracked tokens.
+func TestTokenManagerResetAll_SendsTokenReset(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.Issue("foo", "tid2", mock.Token)
+		tm.Issue("bar", "tid1", mock.Token)
+		s.GetMsg()
+		s.GetMsg()
+		tm.ResetAll()
+		s.GetMsg().
+			AssertSubject("system.tokenReset").
+			AssertPayload(json.RawMessage(`{"tids":["tid1","tid2"],"subject":"auth.test.refresh"}`))
+	})
+}
+
+// Test that Reset without tracked tokens sends no event.
+func TestTokenManagerResetAll_WithoutTokens_SendsNoEvent(t *testing.T) {
+	newTokenManagerTest(t, func(tm *res.TokenManager, s *restest.Session) {
+		tm.ResetAll()
+		s.AssertNoMsg(timeoutDuration)
+	})
+}
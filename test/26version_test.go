@@ -0,0 +1,134 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that events on a versioned resource increase the resource version.
+func TestVersioned_Events_IncreasesVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned(""), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+		s.Handle("collection", res.Versioned(""), res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertEqualJSON(t, "initial version", s.Service().ResourceVersion("test.model"), 0)
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":42}`))
+		restest.AssertEqualJSON(t, "model version", s.Service().ResourceVersion("test.model"), 1)
+
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			r.AddEvent("foo", 0)
+			r.RemoveEvent(0)
+		}))
+		s.GetMsg().AssertAddEvent("test.collection", "foo", 0)
+		s.GetMsg().AssertRemoveEvent("test.collection", 0)
+		restest.AssertEqualJSON(t, "collection version", s.Service().ResourceVersion("test.collection"), 2)
+	})
+}
+
+// Test that a delete event discards the version of a versioned resource.
+func TestVersioned_DeleteEvent_DiscardsVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned(""), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+			r.DeleteEvent()
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":42}`))
+		s.GetMsg().AssertEventName("test.model", "delete")
+		restest.AssertEqualJSON(t, "version", s.Service().ResourceVersion("test.model"), 0)
+	})
+}
+
+// Test that events on a resource without versioning do not set a version.
+func TestVersioned_WithoutVersioned_KeepsVersionZero(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":42}`))
+		restest.AssertEqualJSON(t, "version", s.Service().ResourceVersion("test.model"), 0)
+	})
+}
+
+// Test that a change event fully reverted by ApplyChange does not increase the
+// version.
+func TestVersioned_NoChangeApplied_KeepsVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned(""), res.GetModel(func(r res.ModelRequest) { r.NotFound() }), res.ApplyChange(func(r res.Resource, ch map[string]interface{}) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		}))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+		}))
+		s.AssertNoMsg(timeoutDuration / 10)
+		restest.AssertEqualJSON(t, "version", s.Service().ResourceVersion("test.model"), 0)
+	})
+}
+
+// Test that the version property is included in model get responses and change
+// events.
+func TestVersioned_WithProperty_IncludesVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned("_v"), res.GetModel(func(r res.ModelRequest) {
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"_v":0,"id":42,"foo":"bar"}`))
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": "baz"})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"_v":1,"foo":"baz"}`))
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"_v":1,"id":42,"foo":"bar"}`))
+	})
+}
+
+// Test that the version property is added to an empty model.
+func TestVersioned_WithPropertyOnEmptyModel_IncludesVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned("version"), res.GetModel(func(r res.ModelRequest) {
+			r.Model(struct{}{})
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"version":0}`))
+	})
+}
+
+// Test that SetResourceVersion only increases the version.
+func TestSetResourceVersion(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned(""), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().SetResourceVersion("test.model", 10)
+		restest.AssertEqualJSON(t, "version after set", s.Service().ResourceVersion("test.model"), 10)
+		s.Service().SetResourceVersion("test.model", 5)
+		restest.AssertEqualJSON(t, "version after lower set", s.Service().ResourceVersion("test.model"), 10)
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 42})
+		}))
+		s.GetMsg()
+		restest.AssertEqualJSON(t, "version after event", s.Service().ResourceVersion("test.model"), 11)
+	})
+}
+
+// Test that Versioned panics on an invalid property name.
+func TestVersioned_InvalidProperty_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.Versioned("foo.bar")
+	})
+}
@@ -0,0 +1,208 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	nats "github.com/nats-io/nats.go"
+)
+
+func gzipBytes(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+// gzipHeader is the header of a compressed request accepting a compressed
+// response.
+var gzipHeader = nats.Header{"Content-Encoding": {"gzip"}, "Accept-Encoding": {"gzip"}}
+
+func gunzipBytes(t *testing.T, data []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	restest.AssertNoError(t, err)
+	out, err := io.ReadAll(zr)
+	restest.AssertNoError(t, err)
+	return out
+}
+
+// Test that a compressed request is decompressed before being handled, and
+// replied to with an uncompressed response when compression is disabled.
+func TestCompressedRequest_WithoutCompression_RespondsUncompressed(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			var p struct {
+				Value int `json:"value"`
+			}
+			r.ParseParams(&p)
+			r.OK(p.Value)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes([]byte(`{"params":{"value":42}}`)))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertResult(42)
+	})
+}
+
+// Test that a compressed request is replied to with a compressed response
+// when the response exceeds the compression minimum size.
+func TestCompressedRequest_WithCompression_RespondsCompressed(t *testing.T) {
+	long := strings.Repeat("foo", 100)
+	runTest(t, func(s *res.Service) {
+		s.SetCompression(100)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(long)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes([]byte(`{}`)))
+		msg := s.GetMsg().AssertSubject(inb)
+		restest.AssertEqualJSON(t, "Content-Encoding", msg.Header.Get("Content-Encoding"), "gzip")
+		restest.AssertEqualJSON(t, "response", json.RawMessage(gunzipBytes(t, msg.Data)), json.RawMessage(`{"result":"`+long+`"}`))
+	})
+}
+
+// Test that a service with a recorder set responds compressed, uses the
+// connection it is served on, and records the uncompressed response.
+func TestCompressedRequest_WithRecorder_RespondsCompressed(t *testing.T) {
+	long := strings.Repeat("foo", 100)
+	var buf bytes.Buffer
+	runTest(t, func(s *res.Service) {
+		s.SetCompression(100)
+		s.SetRecorder(&buf)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(long)
+		}))
+	}, func(s *restest.Session) {
+		restest.AssertTrue(t, "Conn to return the served connection", s.Service().Conn() == res.Conn(s.MockConn))
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes([]byte(`{}`)))
+		msg := s.GetMsg().AssertSubject(inb)
+		restest.AssertEqualJSON(t, "Content-Encoding", msg.Header.Get("Content-Encoding"), "gzip")
+	})
+	rec, err := restest.ReadRecording(&buf)
+	restest.AssertNoError(t, err)
+	last := rec[len(rec)-1]
+	restest.AssertEqualJSON(t, "recorded direction", last.Dir, res.RecordOut)
+	restest.AssertEqualJSON(t, "recorded response", last.Data, json.RawMessage(`{"result":"`+long+`"}`))
+}
+
+// Test that a compressed request is replied to with an uncompressed response
+// when the response is smaller than the compression minimum size.
+func TestCompressedRequest_WithSmallResponse_RespondsUncompressed(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetCompression(100)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK("foo")
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes([]byte(`{}`)))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertResult("foo")
+	})
+}
+
+// Test that an uncompressed request is replied to with an uncompressed
+// response even when compression is enabled.
+func TestUncompressedRequest_WithCompression_RespondsUncompressed(t *testing.T) {
+	long := strings.Repeat("foo", 100)
+	runTest(t, func(s *res.Service) {
+		s.SetCompression(100)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(long)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(long)
+	})
+}
+
+// Test that an invalid compressed request is responded to with an error.
+func TestCompressedRequest_InvalidGzip_RespondsWithInternalError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, []byte{0x1f, 0x8b, 0x00})
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that a compressed request decompressing to a payload exceeding the
+// combined size limits is responded to with an invalid params error.
+func TestCompressedRequest_DecompressedExceedingMaxSize_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxParamsSize(10)
+		s.SetMaxTokenSize(10)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		payload := append(bytes.Repeat([]byte(" "), 1<<20), []byte(`{}`)...)
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes(payload))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInvalidParams)
+	})
+}
+
+// Test that a compressed request not accepting a compressed response is
+// replied to with an uncompressed response.
+func TestCompressedRequest_WithoutAcceptEncoding_RespondsUncompressed(t *testing.T) {
+	long := strings.Repeat("foo", 100)
+	runTest(t, func(s *res.Service) {
+		s.SetCompression(100)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(long)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", nats.Header{"Content-Encoding": {"gzip"}}, gzipBytes([]byte(`{}`)))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertResult(long)
+	})
+}
+
+// Test that a request with an unsupported content encoding is responded to
+// with an error.
+func TestCompressedRequest_UnsupportedEncoding_RespondsWithInternalError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", nats.Header{"Content-Encoding": {"snappy"}}, []byte(`{}`))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that a request payload resembling gzip data, without a Content-Encoding
+// header, is not decompressed.
+func TestRequest_GzipPayloadWithoutHeader_IsNotDecompressed(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Errorf("expected handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		inb := s.RequestRaw("call.test.model.method", gzipBytes([]byte(`{}`)))
+		s.GetMsg().
+			AssertSubject(inb).
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
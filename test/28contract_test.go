@@ -0,0 +1,107 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+	"github.com/jirenius/go-res/restest"
+)
+
+// recordContract records a contract by sending a call request using resprot,
+// and responding with the response payload.
+func recordContract(t *testing.T, subject string, params interface{}, response string) restest.Contract {
+	c := restest.NewMockConn(t, nil)
+	rec := restest.NewContractRecorder(c, "consumer")
+	defer rec.Close()
+
+	ch := make(chan resprot.Response)
+	go func() {
+		ch <- resprot.SendRequest(rec, subject, resprot.Request{Params: params}, timeoutDuration)
+	}()
+	m := c.GetMsg().AssertSubject(subject)
+	c.SendMessage(m.Reply, "", []byte(response))
+	<-ch
+	return rec.Contract()
+}
+
+// Test that ContractRecorder records requests and responses sent using resprot.
+func TestContractRecorder_SendRequest_RecordsInteraction(t *testing.T) {
+	ct := recordContract(t, "call.test.model.method", map[string]int{"foo": 42}, `{"result":{"bar":"baz"}}`)
+	restest.AssertEqualJSON(t, "consumer", ct.Consumer, "consumer")
+	restest.AssertEqualJSON(t, "interactions", len(ct.Interactions), 1)
+	ia := ct.Interactions[0]
+	restest.AssertEqualJSON(t, "subject", ia.Subject, "call.test.model.method")
+	restest.AssertEqualJSON(t, "request", ia.Request, json.RawMessage(`{"params":{"foo":42}}`))
+	restest.AssertEqualJSON(t, "response", ia.Response, json.RawMessage(`{"result":{"bar":"baz"}}`))
+}
+
+// Test that ContractRecorder stops waiting for a response when the request
+// times out, and does not record a late response.
+func TestContractRecorder_SendRequestTimeout_StopsRecording(t *testing.T) {
+	c := restest.NewMockConn(t, nil)
+	rec := restest.NewContractRecorder(c, "consumer").SetTimeout(10 * time.Millisecond)
+	defer rec.Close()
+
+	resp := resprot.SendRequest(rec, "call.test.model.method", nil, 10*time.Millisecond)
+	restest.AssertErrorCode(t, resp.Error, res.CodeTimeout)
+	m := c.GetMsg().AssertSubject("call.test.model.method")
+	time.Sleep(20 * time.Millisecond)
+	c.SendMessage(m.Reply, "", []byte(`{"result":null}`))
+	restest.AssertEqualJSON(t, "interactions", len(rec.Contract().Interactions), 0)
+}
+
+// Test that a recorded contract is satisfied by a provider service.
+func TestVerifyContract_WithMatchingProvider_Passes(t *testing.T) {
+	ct := recordContract(t, "call.test.model.method", nil, `{"result":{"bar":"baz","list":[1,2]}}`)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(map[string]interface{}{"bar": "qux", "list": []int{3}, "extra": true})
+		}))
+	}, func(s *restest.Session) {
+		s.VerifyContract(ct)
+	})
+}
+
+// Test that a contract written to file can be loaded.
+func TestContract_WriteFileAndLoad(t *testing.T) {
+	ct := recordContract(t, "call.test.model.method", nil, `{"error":{"code":"system.notFound","message":"Not found"}}`)
+	path := filepath.Join(t.TempDir(), "contract.json")
+	restest.AssertNoError(t, ct.WriteFile(path))
+	loaded, err := restest.LoadContract(path)
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "contract", loaded, ct)
+}
+
+// Test MatchContractResponse with matching and breaking responses.
+func TestMatchContractResponse(t *testing.T) {
+	tbl := []struct {
+		Expected string
+		Actual   string
+		Match    bool
+	}{
+		{`{"result":{"foo":"bar"}}`, `{"result":{"foo":"baz"}}`, true},
+		{`{"result":{"foo":"bar"}}`, `{"result":{"foo":"bar","extra":1}}`, true},
+		{`{"result":{"foo":null}}`, `{"result":{"foo":42}}`, true},
+		{`{"result":{"list":[{"id":1}]}}`, `{"result":{"list":[{"id":2},{"id":3}]}}`, true},
+		{`{"result":{"list":[]}}`, `{"result":{"list":["foo"]}}`, true},
+		{`{"resource":{"rid":"test.model"}}`, `{"resource":{"rid":"test.other"}}`, true},
+		{`{"error":{"code":"system.notFound","message":"Not found"}}`, `{"error":{"code":"system.notFound","message":"Missing"}}`, true},
+		{`{"result":{"foo":"bar"}}`, `{"result":{}}`, false},
+		{`{"result":{"foo":"bar"}}`, `{"result":{"foo":42}}`, false},
+		{`{"result":{"list":[{"id":1}]}}`, `{"result":{"list":[{"id":"2"}]}}`, false},
+		{`{"result":{"foo":"bar"}}`, `{"resource":{"rid":"test.model"}}`, false},
+		{`{"result":{"foo":"bar"}}`, `{"error":{"code":"system.notFound","message":"Not found"}}`, false},
+		{`{"error":{"code":"system.notFound","message":"Not found"}}`, `{"error":{"code":"system.invalidParams","message":"Invalid parameters"}}`, false},
+		{`{"error":{"code":"system.notFound","message":"Not found"}}`, `{"result":null}`, false},
+	}
+
+	for i, l := range tbl {
+		err := restest.MatchContractResponse([]byte(l.Expected), []byte(l.Actual))
+		restest.AssertTrue(t, fmt.Sprintf("match to be %v", l.Match), (err == nil) == l.Match, "test entry #", i, ": ", err)
+	}
+}
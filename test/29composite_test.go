@@ -0,0 +1,134 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func fetchProps(props map[string]interface{}, err error) func(res.ModelRequest) (map[string]interface{}, error) {
+	return func(res.ModelRequest) (map[string]interface{}, error) {
+		return props, err
+	}
+}
+
+// Test that a composed model merges the properties of all sources.
+func TestComposedModel_MultipleSources_MergesProperties(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.ComposedModel{
+			{Name: "profile", Fetch: func(r res.ModelRequest) (map[string]interface{}, error) {
+				return map[string]interface{}{"id": r.PathParam("id"), "name": "foo"}, nil
+			}},
+			{Name: "status", Fetch: fetchProps(map[string]interface{}{"status": "online"}, nil)},
+		})
+	}, func(s *restest.Session) {
+		s.Get("test.model.42").
+			Response().
+			AssertModel(json.RawMessage(`{"id":"42","name":"foo","status":"online"}`))
+	})
+}
+
+// Test that a composed model responds with not found if no source has any
+// properties.
+func TestComposedModel_NoProperties_RespondsNotFound(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ComposedModel{
+			{Name: "profile", Fetch: fetchProps(nil, nil)},
+		})
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(res.ErrNotFound)
+	})
+}
+
+// Test composed model source failure policies.
+func TestComposedModel_SourceFailure_AppliesPolicy(t *testing.T) {
+	tbl := []struct {
+		Policy   res.SourcePolicy
+		Expected interface{}
+	}{
+		{res.SourceRequired, res.ErrTimeout},
+		{res.SourceOptional, json.RawMessage(`{"name":"foo"}`)},
+		{res.SourceNullable, json.RawMessage(`{"name":"foo","status":null,"since":null}`)},
+	}
+
+	for _, l := range tbl {
+		runTest(t, func(s *res.Service) {
+			s.Handle("model", res.ComposedModel{
+				{Name: "profile", Fetch: fetchProps(map[string]interface{}{"name": "foo"}, nil)},
+				{Name: "status", Fetch: fetchProps(nil, res.ErrTimeout), OnFailure: l.Policy, Props: []string{"status", "since"}},
+			})
+		}, func(s *restest.Session) {
+			resp := s.Get("test.model").Response()
+			if err, ok := l.Expected.(*res.Error); ok {
+				resp.AssertError(err)
+			} else {
+				resp.AssertModel(l.Expected)
+			}
+		})
+	}
+}
+
+// Test that a composed model with a non-res error responds with an internal
+// error for a required source.
+func TestComposedModel_RequiredSourceError_RespondsInternalError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ComposedModel{
+			{Name: "profile", Fetch: fetchProps(nil, errors.New("db down"))},
+		})
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that a watching source sends change events on update.
+func TestComposedModel_WatchUpdate_SendsChangeEvent(t *testing.T) {
+	ch := make(chan func(string, map[string]interface{}), 1)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.ComposedModel{
+			{Name: "status", Fetch: fetchProps(nil, nil), Watch: func(update func(string, map[string]interface{})) {
+				ch <- update
+			}},
+		})
+	}, func(s *restest.Session) {
+		update := <-ch
+		update("test.model.42", map[string]interface{}{"status": "away"})
+		s.GetMsg().AssertChangeEvent("test.model.42", json.RawMessage(`{"status":"away"}`))
+	})
+}
+
+// Test that a watching source is watched only once when the service is served
+// again.
+func TestComposedModel_ServedAgain_WatchesOnce(t *testing.T) {
+	var count int
+	rs := res.NewService("test")
+	rs.SetLogger(nil)
+	rs.Handle("model", res.ComposedModel{
+		{Name: "status", Fetch: fetchProps(nil, nil), Watch: func(func(string, map[string]interface{})) {
+			count++
+		}},
+	})
+	ready := make(chan struct{}, 1)
+	rs.OnReady(func(*res.Service) error { ready <- struct{}{}; return nil })
+	for i := 0; i < 2; i++ {
+		c := restest.NewMockConn(t, nil)
+		go func() { _ = rs.Serve(c) }()
+		<-ready
+		restest.AssertNoError(t, rs.Shutdown())
+	}
+	restest.AssertEqualJSON(t, "watch count", count, 1)
+}
+
+// Test that ComposedModel panics when a source has no Fetch function.
+func TestComposedModel_MissingFetch_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		s := res.NewService("test")
+		s.Handle("model", res.ComposedModel{{Name: "profile"}})
+	})
+}
@@ -160,6 +160,23 @@ var testSetModelTbl = []struct {
 	{json.RawMessage(`{"data":{"data":"foo"}}`), json.RawMessage(`{}`), json.RawMessage(`{"data":{"action":"delete"}}`)},
 }
 
+func TestStoreHandler_GetModelWithScriptedFailure_ReturnsError(t *testing.T) {
+	st := newRIDStore().FailNext(mockstore.OpValue, mock.CustomError)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Model,
+			store.Handler{}.WithStore(st),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertError(mock.CustomError)
+		s.Get("test.model").
+			Response().
+			AssertModel(mock.Model)
+	})
+}
+
 func TestStoreHandler_UpdateModel_ExpectedEvent(t *testing.T) {
 	for i, l := range testSetModelTbl {
 		test := fmt.Sprintf("test #%d", i)
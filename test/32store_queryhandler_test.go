@@ -35,6 +35,29 @@ func TestStoreQueryHandler_GetWithRequestHandlerNoPathParams_QueriesQueryStore(t
 	})
 }
 
+func TestStoreQueryHandler_GetWithScriptedFailure_ReturnsError(t *testing.T) {
+	qst := mockstore.NewQueryStore(func(query url.Values) (interface{}, error) {
+		return mock.Model, nil
+	}).FailNext(mock.CustomError)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.foo",
+			res.Model,
+			store.QueryHandler{}.
+				WithQueryStore(qst).
+				WithRequestHandler(func(resourceName string, pathParams map[string]string) (url.Values, error) {
+					return nil, nil
+				}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model.foo").
+			Response().
+			AssertError(mock.CustomError)
+		s.Get("test.model.foo").
+			Response().
+			AssertModel(mock.Model)
+	})
+}
+
 func TestStoreQueryHandler_GetWithRequestHandlerAndPathParams_QueriesQueryStore(t *testing.T) {
 	qst := mockstore.NewQueryStore(func(query url.Values) (interface{}, error) {
 		restest.AssertEqualJSON(t, "query", query, url.Values{"id": {"foo"}})
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/store"
+	"github.com/jirenius/go-res/store/mockstore"
+)
+
+// testACL is an access control document granting calls to users by user ID.
+type testACL struct {
+	Users map[string]string `json:"users"`
+}
+
+func (acl testACL) Access(r res.AccessRequest) (bool, string) {
+	var tok struct {
+		User string `json:"user"`
+	}
+	r.ParseToken(&tok)
+	call, ok := acl.Users[tok.User]
+	return ok, call
+}
+
+func userToken(user string) *restest.Request {
+	return &restest.Request{Token: json.RawMessage(`{"user":"` + user + `"}`)}
+}
+
+func newACLStore() *mockstore.Store {
+	return mockstore.NewStore().
+		Add("test.model", testACL{Users: map[string]string{"jane": "set", "john": ""}})
+}
+
+// Test that AccessHandler grants access based on the stored document.
+func TestStoreAccessHandler_Access_GrantsAccessFromDocument(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", store.AccessHandler{}.WithStore(newACLStore()))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "set")
+		s.Access("test.model", userToken("john")).Response().AssertAccess(true, "")
+		s.Access("test.model", userToken("joe")).Response().AssertError(res.ErrAccessDenied)
+	})
+}
+
+// Test that AccessHandler denies access if the document is missing.
+func TestStoreAccessHandler_MissingDocument_DeniesAccess(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", store.AccessHandler{}.WithStore(newACLStore()))
+	}, func(s *restest.Session) {
+		s.Access("test.model.42", userToken("jane")).Response().AssertError(res.ErrAccessDenied)
+	})
+}
+
+// Test that AccessHandler responds with an error on store read errors.
+func TestStoreAccessHandler_StoreError_ReturnsError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", store.AccessHandler{}.WithStore(newACLStore().FailNext(mockstore.OpValue, mock.CustomError)))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertError(mock.CustomError)
+	})
+}
+
+// Test that AccessHandler uses the Transformer to get the document ID, and the
+// Access function to get the access.
+func TestStoreAccessHandler_WithTransformerAndAccess_GrantsAccess(t *testing.T) {
+	st := mockstore.NewStore().Add("42", []string{"jane"})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", store.AccessHandler{}.
+			WithStore(st).
+			WithTransformer(store.IDTransformer("id", nil)).
+			WithAccess(func(r res.AccessRequest, acl interface{}) (bool, string) {
+				var tok struct {
+					User string `json:"user"`
+				}
+				r.ParseToken(&tok)
+				for _, u := range acl.([]string) {
+					if u == tok.User {
+						return true, "*"
+					}
+				}
+				return false, ""
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Access("test.model.42", userToken("jane")).Response().AssertAccess(true, "*")
+		s.Access("test.model.42", userToken("john")).Response().AssertError(res.ErrAccessDenied)
+	})
+}
+
+// Test that AccessHandler responds with an error if the document does not
+// implement ACL, and no Access function is set.
+func TestStoreAccessHandler_DocumentNotACL_ReturnsInternalError(t *testing.T) {
+	st := mockstore.NewStore().Add("test.model", mock.Model)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", store.AccessHandler{}.WithStore(st))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that AccessHandler caches documents, and sends a reaccess event when the
+// document changes.
+func TestStoreAccessHandler_DocumentChanged_SendsReaccessEvent(t *testing.T) {
+	st := newACLStore()
+	reads := 0
+	st.OnValue = func(st *mockstore.Store, id string) (interface{}, error) {
+		reads++
+		v, ok := st.Resources[id]
+		if !ok {
+			return nil, store.ErrNotFound
+		}
+		return v, nil
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", store.AccessHandler{}.WithStore(st))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "set")
+		s.Access("test.model", userToken("john")).Response().AssertAccess(true, "")
+		restest.AssertTrue(t, "document to be read once", reads == 1)
+
+		func() {
+			txn := st.Write("test.model")
+			defer txn.Close()
+			restest.AssertNoError(t, txn.Update(testACL{Users: map[string]string{"john": "*"}}))
+		}()
+		s.GetMsg().AssertReaccessEvent("test.model")
+
+		s.Access("test.model", userToken("jane")).Response().AssertError(res.ErrAccessDenied)
+		s.Access("test.model", userToken("john")).Response().AssertAccess(true, "*")
+		restest.AssertTrue(t, "document to be read twice", reads == 2)
+	})
+}
+
+// Test that AccessHandler sends no reaccess event when a document not yet used
+// is changed.
+func TestStoreAccessHandler_UnusedDocumentChanged_SendsNoEvent(t *testing.T) {
+	st := newACLStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", store.AccessHandler{}.WithStore(st))
+	}, func(s *restest.Session) {
+		func() {
+			txn := st.Write("test.model")
+			defer txn.Close()
+			restest.AssertNoError(t, txn.Update(testACL{}))
+		}()
+		s.AssertNoMsg(timeoutDuration)
+	})
+}
+
+// Test that AccessHandler stops tracking resources without access requests,
+// evicting their documents from the cache.
+func TestStoreAccessHandler_Unobserved_EvictsDocument(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	st := newACLStore()
+	reads := 0
+	st.OnValue = func(st *mockstore.Store, id string) (interface{}, error) {
+		reads++
+		return st.Resources[id], nil
+	}
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model", store.AccessHandler{}.WithStore(st).WithEvictAfter(time.Minute))
+	}, func(s *restest.Session) {
+		s.Access("test.model", userToken("jane")).Response().AssertAccess(true, "set")
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset(nil, []string{"test.model"})
+		clock.Add(time.Minute)
+		// Wait for the unobserved callback on the resource's worker
+		done := make(chan struct{})
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) { close(done) }))
+		<-done
+		// Changes are not tracked for evicted documents
+		func() {
+			txn := st.Write("test.model")
+			defer txn.Close()
+			restest.AssertNoError(t, txn.Update(testACL{Users: map[string]string{"john": "*"}}))
+		}()
+		s.AssertNoMsg(timeoutDuration / 10)
+		s.Access("test.model", userToken("john")).Response().AssertAccess(true, "*")
+		restest.AssertTrue(t, "document to be read twice", reads == 2)
+	})
+}
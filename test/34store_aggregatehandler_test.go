@@ -0,0 +1,199 @@
+package test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/store"
+	"github.com/jirenius/go-res/store/mockstore"
+)
+
+type aggregateItem struct {
+	Amount float64 `json:"amount"`
+}
+
+func newAggregateStores() (*mockstore.Store, *mockstore.QueryStore) {
+	st := mockstore.NewStore().
+		Add("a", aggregateItem{Amount: 10}).
+		Add("b", aggregateItem{Amount: 5}).
+		Add("c", aggregateItem{Amount: 100})
+	qst := mockstore.NewQueryStore(func(q url.Values) (interface{}, error) {
+		return []string{"a", "b"}, nil
+	})
+	return st, qst
+}
+
+func newAggregateHandler(st *mockstore.Store, qst *mockstore.QueryStore) store.AggregateHandler {
+	return store.AggregateHandler{}.
+		WithQueryStore(qst).
+		WithStore(st).
+		WithAggregate("count", store.Count()).
+		WithAggregate("total", store.Sum(func(v interface{}) float64 {
+			return v.(aggregateItem).Amount
+		}))
+}
+
+func addEvent(id string) func(url.Values) ([]store.ResultEvent, bool, error) {
+	return func(url.Values) ([]store.ResultEvent, bool, error) {
+		return []store.ResultEvent{{Name: "add", Idx: 0, Value: id}}, false, nil
+	}
+}
+
+func removeEvent(id string) func(url.Values) ([]store.ResultEvent, bool, error) {
+	return func(url.Values) ([]store.ResultEvent, bool, error) {
+		return []store.ResultEvent{{Name: "remove", Idx: 0, Value: id}}, false, nil
+	}
+}
+
+func TestStoreAggregateHandler_Get_ReturnsAggregates(t *testing.T) {
+	st, qst := newAggregateStores()
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", newAggregateHandler(st, qst))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").
+			Response().
+			AssertModel(json.RawMessage(`{"count":2,"total":15}`))
+	})
+}
+
+func TestStoreAggregateHandler_QueryChange_UpdatesIncrementally(t *testing.T) {
+	tbl := []struct {
+		Change   mockstore.QueryChange
+		Expected json.RawMessage
+	}{
+		// Added value
+		{mockstore.QueryChange{IDValue: "c", AfterValue: aggregateItem{Amount: 100}, OnEvents: addEvent("c")}, json.RawMessage(`{"count":3,"total":115}`)},
+		// Removed value
+		{mockstore.QueryChange{IDValue: "a", BeforeValue: aggregateItem{Amount: 10}, AfterValue: aggregateItem{Amount: 10}, OnEvents: removeEvent("a")}, json.RawMessage(`{"count":1,"total":5}`)},
+		// Deleted value
+		{mockstore.QueryChange{IDValue: "a", BeforeValue: aggregateItem{Amount: 10}, OnEvents: removeEvent("a")}, json.RawMessage(`{"count":1,"total":5}`)},
+		// Changed member value
+		{mockstore.QueryChange{IDValue: "b", BeforeValue: aggregateItem{Amount: 5}, AfterValue: aggregateItem{Amount: 7}}, json.RawMessage(`{"total":17}`)},
+		// Moved member value
+		{mockstore.QueryChange{IDValue: "b", BeforeValue: aggregateItem{Amount: 5}, AfterValue: aggregateItem{Amount: 7}, OnEvents: func(url.Values) ([]store.ResultEvent, bool, error) {
+			return []store.ResultEvent{{Name: "remove", Idx: 1, Value: "b"}, {Name: "add", Idx: 0, Value: "b"}}, false, nil
+		}}, json.RawMessage(`{"total":17}`)},
+	}
+
+	for _, l := range tbl {
+		st, qst := newAggregateStores()
+		runTest(t, func(s *res.Service) {
+			s.Handle("stats", newAggregateHandler(st, qst))
+		}, func(s *restest.Session) {
+			s.Get("test.stats").Response()
+			qst.TriggerQueryChange(l.Change)
+			s.GetMsg().AssertChangeEvent("test.stats", l.Expected)
+		})
+	}
+}
+
+func TestStoreAggregateHandler_QueryChangeNotAffectingAggregates_SendsNoEvent(t *testing.T) {
+	st, qst := newAggregateStores()
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", newAggregateHandler(st, qst))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").Response()
+		// Change of a value not in the result
+		qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "c", BeforeValue: aggregateItem{Amount: 100}, AfterValue: aggregateItem{Amount: 200}})
+		// Change of a member not affecting the sum
+		qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "a", BeforeValue: aggregateItem{Amount: 10}, AfterValue: aggregateItem{Amount: 10}})
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+func TestStoreAggregateHandler_QueryChangeWithReset_Recomputes(t *testing.T) {
+	st, qst := newAggregateStores()
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", newAggregateHandler(st, qst))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").Response()
+		qst.OnQuery = func(q url.Values) (interface{}, error) {
+			return []res.Ref{"a", "b", "c"}, nil
+		}
+		qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "c", OnEvents: func(url.Values) ([]store.ResultEvent, bool, error) {
+			return nil, true, nil
+		}})
+		s.GetMsg().AssertChangeEvent("test.stats", json.RawMessage(`{"count":3,"total":115}`))
+		s.Get("test.stats").
+			Response().
+			AssertModel(json.RawMessage(`{"count":3,"total":115}`))
+	})
+}
+
+func TestStoreAggregateHandler_QueryChangeBeforeGet_SendsNoEvent(t *testing.T) {
+	st, qst := newAggregateStores()
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", newAggregateHandler(st, qst))
+	}, func(s *restest.Session) {
+		qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "c", AfterValue: aggregateItem{Amount: 100}, OnEvents: addEvent("c")})
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+func TestStoreAggregateHandler_QueryChangeDuringGet_RecomputesAggregates(t *testing.T) {
+	st, qst := newAggregateStores()
+	ids := []string{"a", "b"}
+	qst.OnQuery = func(q url.Values) (interface{}, error) {
+		result := ids
+		if len(ids) == 2 {
+			// Change the result after it is read, but before it is cached.
+			ids = []string{"a", "b", "c"}
+			qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "c", AfterValue: aggregateItem{Amount: 100}, OnEvents: addEvent("c")})
+		}
+		return result, nil
+	}
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", newAggregateHandler(st, qst))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").
+			Response().
+			AssertModel(json.RawMessage(`{"count":3,"total":115}`))
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+func TestStoreAggregateHandler_Unobserved_EvictsAggregates(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	st, qst := newAggregateStores()
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("stats", newAggregateHandler(st, qst).WithEvictAfter(time.Minute))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").Response()
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset([]string{"test.stats"}, nil)
+		clock.Add(time.Minute)
+		// Wait for the unobserved callback on the resource's worker
+		done := make(chan struct{})
+		restest.AssertNoError(t, s.Service().With("test.stats", func(r res.Resource) { close(done) }))
+		<-done
+		qst.OnQuery = func(q url.Values) (interface{}, error) {
+			return []string{"a", "b", "c"}, nil
+		}
+		// Changes are not tracked for evicted aggregates
+		qst.TriggerQueryChange(mockstore.QueryChange{IDValue: "c", AfterValue: aggregateItem{Amount: 100}, OnEvents: addEvent("c")})
+		s.AssertNoMsg(timeoutDuration / 10)
+		s.Get("test.stats").
+			Response().
+			AssertModel(json.RawMessage(`{"count":3,"total":115}`))
+	})
+}
+
+func TestStoreAggregateHandler_InvalidQueryResult_ReturnsInternalError(t *testing.T) {
+	qst := mockstore.NewQueryStore(func(q url.Values) (interface{}, error) {
+		return mock.Model, nil
+	})
+	runTest(t, func(s *res.Service) {
+		s.Handle("stats", store.AggregateHandler{}.
+			WithQueryStore(qst).
+			WithAggregate("count", store.Count()))
+	}, func(s *restest.Session) {
+		s.Get("test.stats").
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
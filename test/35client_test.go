@@ -0,0 +1,79 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func registerClientHandlers(s *res.Service) {
+	s.Handle("auth",
+		res.Auth("login", func(r res.AuthRequest) {
+			var p struct {
+				User string `json:"user"`
+			}
+			r.ParseParams(&p)
+			r.TokenEvent(map[string]string{"user": p.User})
+			r.OK(nil)
+		}),
+		res.Auth("logout", func(r res.AuthRequest) {
+			r.TokenEvent(nil)
+			r.OK(nil)
+		}),
+	)
+	s.Handle("model",
+		res.Access(func(r res.AccessRequest) {
+			var t struct {
+				User string `json:"user"`
+			}
+			r.ParseToken(&t)
+			r.Access(t.User != "", "")
+		}),
+		res.Call("whoami", func(r res.CallRequest) {
+			var t struct {
+				User string `json:"user"`
+			}
+			r.ParseToken(&t)
+			r.OK(map[string]string{"cid": r.CID(), "user": t.User})
+		}),
+	)
+}
+
+// Test that a client attaches the token from a login to subsequent requests.
+func TestClient_Login_AttachesToken(t *testing.T) {
+	runTest(t, registerClientHandlers, func(s *restest.Session) {
+		cl := s.NewClient()
+		cl.Access("test.model").
+			Response().
+			AssertError(res.ErrAccessDenied)
+		cl.Login("test.auth", "login", map[string]string{"user": "foo"}).
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "token", cl.Token(), json.RawMessage(`{"user":"foo"}`))
+		cl.Access("test.model").
+			Response().
+			AssertAccess(true, "")
+		cl.Call("test.model", "whoami", nil).
+			Response().
+			AssertResult(map[string]string{"cid": cl.CID(), "user": "foo"})
+	})
+}
+
+// Test that a client clears its token on a null token event.
+func TestClient_Logout_ClearsToken(t *testing.T) {
+	runTest(t, registerClientHandlers, func(s *restest.Session) {
+		cl := s.NewClient().SetToken(map[string]string{"user": "foo"})
+		cl.Login("test.auth", "logout", nil).
+			AssertResult(nil)
+		restest.AssertTrue(t, "token to be cleared", cl.Token() == nil)
+		cl.Access("test.model").
+			Response().
+			AssertError(res.ErrAccessDenied)
+	})
+}
+
+// Test that NewCID returns unique connection IDs.
+func TestNewCID_ReturnsUniqueIDs(t *testing.T) {
+	restest.AssertTrue(t, "connection IDs to be unique", restest.NewCID() != restest.NewCID())
+}
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func registerAccessMatrixHandlers(s *res.Service) {
+	s.Handle("model.$id", res.Access(func(r res.AccessRequest) {
+		var t struct {
+			Role string `json:"role"`
+		}
+		r.ParseToken(&t)
+		switch t.Role {
+		case "admin":
+			r.AccessGranted()
+		case "guest":
+			r.Access(true, "")
+		default:
+			r.AccessDenied()
+		}
+	}))
+}
+
+// Test that AssertAccessMatrix passes when all cases match.
+func TestAssertAccessMatrix_MatchingCases_Passes(t *testing.T) {
+	admin := map[string]string{"role": "admin"}
+	guest := map[string]string{"role": "guest"}
+	runTest(t, registerAccessMatrixHandlers, func(s *restest.Session) {
+		s.AssertAccessMatrix(restest.AccessMatrix{
+			{Token: admin, RID: "test.model.42", Get: true, Call: "*"},
+			{Token: guest, RID: "test.model.42", Get: true},
+			{Token: nil, RID: "test.model.42?q=foo"},
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a shadow handler with a matching response reports no error.
+func TestShadowCall_MatchingResponse_DoesNotCallOnError(t *testing.T) {
+	var errs []string
+	called := make(chan struct{}, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { errs = append(errs, msg) })
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(map[string]int{"a": 1, "b": 2}) }),
+			res.ShadowCall("method", func(r res.CallRequest) {
+				r.OK(map[string]int{"b": 2, "a": 1})
+				called <- struct{}{}
+			}, 1),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(map[string]int{"a": 1, "b": 2})
+		<-called
+		s.AssertNoMsg(timeoutDuration / 10)
+		restest.AssertEqualJSON(t, "error count", len(errs), 0)
+	})
+}
+
+// Test that a shadow handler with a differing response reports the mismatch
+// without sending the shadow response.
+func TestShadowCall_MismatchingResponse_CallsOnError(t *testing.T) {
+	errs := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { errs <- msg })
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK("foo") }),
+			res.ShadowCall("*", func(r res.CallRequest) {
+				r.Timeout(timeoutDuration)
+				r.OK("bar")
+			}, 1),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult("foo")
+		msg := <-errs
+		restest.AssertTrue(t, "error to contain both responses", strings.Contains(msg, `"foo"`) && strings.Contains(msg, `"bar"`), msg)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a shadow handler with zero rate is never called.
+func TestShadowCall_ZeroRate_IsNotCalled(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+			res.ShadowCall("method", func(r res.CallRequest) {
+				t.Error("expected shadow handler not to be called")
+			}, 0),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that events sent by a shadow handler are discarded, and that the
+// shadow request has the correlation ID of the primary request.
+func TestShadowCall_WithEvents_DiscardsEvents(t *testing.T) {
+	correlation := make(chan string, 2)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				correlation <- r.CorrelationID()
+				r.OK(nil)
+			}),
+			res.ShadowCall("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+				r.Event("custom", nil)
+				r.OK(nil)
+				correlation <- r.CorrelationID()
+			}, 1),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult(nil)
+		primary, shadow := <-correlation, <-correlation
+		restest.AssertEqualJSON(t, "shadow correlation ID", shadow, primary)
+		s.AssertNoMsg(timeoutDuration / 10)
+		restest.AssertEqualJSON(t, "shadow requests", s.Service().Stats().ShadowRequests, 1)
+	})
+}
+
+// Test that a shadow service is sent a copy of the request, and that a
+// differing response is reported and counted.
+func TestShadowService_MismatchingResponse_CallsOnError(t *testing.T) {
+	errs := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { errs <- msg })
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK("foo") }),
+			res.ShadowService("method", "testv2", 1),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Params: json.RawMessage(`{"value":42}`)}).
+			Response().
+			AssertResult("foo")
+		req := s.GetMsg().AssertSubject("call.testv2.model.method")
+		restest.AssertEqualJSON(t, "shadow request params", req.PathPayload("params"), map[string]int{"value": 42})
+		s.SendMessage(req.Reply, "", []byte(`{"result":"bar"}`))
+		msg := <-errs
+		restest.AssertTrue(t, "error to contain both responses", strings.Contains(msg, `"foo"`) && strings.Contains(msg, `"bar"`), msg)
+		stats := s.Service().Stats()
+		restest.AssertEqualJSON(t, "shadow requests", stats.ShadowRequests, 1)
+		restest.AssertEqualJSON(t, "shadow mismatches", stats.ShadowMismatches, 1)
+	})
+}
+
+// Test that ShadowCall panics on invalid arguments.
+func TestShadowCall_InvalidArguments_Panics(t *testing.T) {
+	h := func(r res.CallRequest) { r.OK(nil) }
+	restest.AssertPanic(t, func() { res.ShadowCall("foo.bar", h, 1) })
+	restest.AssertPanic(t, func() { res.ShadowCall("method", nil, 1) })
+	restest.AssertPanic(t, func() { res.ShadowCall("method", h, 1.5) })
+	restest.AssertPanic(t, func() { res.ShadowService("method", "foo.bar", 1) })
+	restest.AssertPanic(t, func() {
+		res.NewService("test").Handle("model", res.ShadowCall("method", h, 1), res.ShadowCall("method", h, 1))
+	})
+}
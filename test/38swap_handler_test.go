@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+func modelHandler(model interface{}) res.Handler {
+	return res.Handler{
+		Type: res.TypeModel,
+		Get: func(r res.GetRequest) {
+			r.Model(model)
+		},
+		Access: res.AccessGranted,
+	}
+}
+
+// Test that SwapHandler replaces the handler and sends a system reset.
+func TestSwapHandler_RegisteredPattern_ReplacesHandler(t *testing.T) {
+	tbl := []struct {
+		Pattern string
+		RID     string
+		Reset   string
+	}{
+		{"model", "test.model", "test.model"},
+		{"model.$id", "test.model.42", "test.model.*"},
+		{"model.>", "test.model.42.bar", "test.model.>"},
+	}
+
+	for _, l := range tbl {
+		runTest(t, func(s *res.Service) {
+			s.AddHandler(l.Pattern, modelHandler(map[string]string{"color": "blue"}))
+		}, func(s *restest.Session) {
+			s.Get(l.RID).
+				Response().
+				AssertModel(json.RawMessage(`{"color":"blue"}`))
+			restest.AssertNoError(t, s.Service().SwapHandler(l.Pattern, modelHandler(map[string]string{"color": "green"})))
+			s.GetMsg().AssertSystemReset([]string{l.Reset}, []string{l.Reset})
+			s.Get(l.RID).
+				Response().
+				AssertModel(json.RawMessage(`{"color":"green"}`))
+		})
+	}
+}
+
+// Test that SwapHandler sends the system reset once in-flight requests are
+// handled.
+func TestSwapHandler_InFlightRequest_SendsResetAfterResponse(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			close(started)
+			<-release
+			r.Model(map[string]string{"color": "blue"})
+		}))
+	}, func(s *restest.Session) {
+		req := s.Get("test.model")
+		<-started
+		restest.AssertNoError(t, s.Service().SwapHandler("model", modelHandler(map[string]string{"color": "green"})))
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		req.Response().AssertModel(json.RawMessage(`{"color":"blue"}`))
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, []string{"test.model"})
+	})
+}
+
+// Test that SwapHandler calls the OnRegister callback of the new handler.
+func TestSwapHandler_WithOnRegister_CallsOnRegister(t *testing.T) {
+	var pattern res.Pattern
+	runTest(t, func(s *res.Service) {
+		s.AddHandler("model.$id", modelHandler(nil))
+	}, func(s *restest.Session) {
+		h := modelHandler(nil)
+		h.OnRegister = func(_ *res.Service, p res.Pattern, _ res.Handler) { pattern = p }
+		restest.AssertNoError(t, s.Service().SwapHandler("model.$id", h))
+		s.GetMsg().AssertSubject("system.reset")
+		restest.AssertEqualJSON(t, "pattern", pattern, "test.model.$id")
+	})
+}
+
+// Test that SwapHandler returns an error on invalid swaps.
+func TestSwapHandler_InvalidSwap_ReturnsError(t *testing.T) {
+	listener := modelHandler(nil)
+	listener.Listeners = map[string]func(*res.Event){"test.other": func(*res.Event) {}}
+	tbl := []struct {
+		Pattern string
+		Handler res.Handler
+	}{
+		{"other", modelHandler(nil)},
+		{"model", modelHandler(nil)},
+		{"model.$id.bar", modelHandler(nil)},
+		{"model.$name.foo", modelHandler(nil)},
+		{"model.$id.foo", listener},
+	}
+
+	for _, l := range tbl {
+		runTest(t, func(s *res.Service) {
+			s.AddHandler("model.$id.foo", modelHandler(nil))
+		}, func(s *restest.Session) {
+			err := s.Service().SwapHandler(l.Pattern, l.Handler)
+			restest.AssertTrue(t, "error to be returned for pattern "+l.Pattern, err != nil)
+			s.AssertNoMsg(timeoutDuration / 10)
+		})
+	}
+}
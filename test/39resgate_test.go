@@ -0,0 +1,38 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a model can be fetched and called through a real Resgate instance.
+func TestResgate_GetAndCallModel_ThroughHTTPAPI(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Access(res.AccessGranted),
+			res.GetModel(func(r res.ModelRequest) {
+				r.Model(mock.Model)
+			}),
+			res.Call("method", func(r res.CallRequest) {
+				var p struct {
+					Foo string `json:"foo"`
+				}
+				r.ParseParams(&p)
+				r.OK(map[string]string{"foo": p.Foo})
+			}),
+		)
+	}, func(s *restest.Session) {
+		rg := s.Resgate()
+		rg.Get("test.model").
+			AssertStatus(http.StatusOK).
+			AssertBody(mock.Model)
+		rg.Call("test.model", "method", map[string]string{"foo": "bar"}).
+			AssertStatus(http.StatusOK).
+			AssertBody(map[string]string{"foo": "bar"})
+		rg.Call("test.model", "missing", nil).
+			AssertError(res.ErrMethodNotFound)
+	}, restest.WithResgate)
+}
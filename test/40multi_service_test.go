@@ -0,0 +1,100 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/resprot"
+	"github.com/jirenius/go-res/restest"
+)
+
+// newAuthService returns a central access service granting access to
+// connections with an admin token.
+func newAuthService() *res.Service {
+	auth := res.NewService("auth")
+	auth.Handle("perm",
+		res.Call("check", func(r res.CallRequest) {
+			var p struct {
+				Role string `json:"role"`
+			}
+			r.ParseParams(&p)
+			r.OK(map[string]bool{"granted": p.Role == "admin"})
+		}),
+	)
+	return auth
+}
+
+// newAccessService registers a model with an access handler calling the auth
+// service.
+func newAccessService(s *res.Service) {
+	s.Handle("model",
+		res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		res.Access(func(r res.AccessRequest) {
+			var tok struct {
+				Role string `json:"role"`
+			}
+			r.ParseToken(&tok)
+			var result struct {
+				Granted bool `json:"granted"`
+			}
+			resp := resprot.SendRequest(r.Service().Conn(), "call.auth.perm.check", resprot.Request{Params: tok}, timeoutDuration)
+			if err := resp.ParseResult(&result); err != nil {
+				r.Error(err)
+				return
+			}
+			if result.Granted {
+				r.AccessGranted()
+			} else {
+				r.AccessDenied()
+			}
+		}),
+	)
+}
+
+func TestServices_AccessViaOtherService_RoutesRequests(t *testing.T) {
+	for _, tc := range []struct {
+		Role    string
+		Granted bool
+	}{
+		{"admin", true},
+		{"guest", false},
+	} {
+		runTest(t, newAccessService, func(s *restest.Session) {
+			req := restest.DefaultAccessRequest()
+			req.Token = json.RawMessage(`{"role":"` + tc.Role + `"}`)
+			inb := s.Access("test.model", req)
+			s.GetMsg().
+				AssertSubject("call.auth.perm.check").
+				AssertPayload(json.RawMessage(`{"params":{"role":"` + tc.Role + `"}}`))
+			s.GetMsg().
+				AssertResult(map[string]bool{"granted": tc.Granted})
+			if tc.Granted {
+				inb.Response().AssertAccess(true, "*")
+			} else {
+				inb.Response().AssertError(res.ErrAccessDenied)
+			}
+		}, restest.WithServices(newAuthService()))
+	}
+}
+
+func TestServices_Services_ReturnsAllServices(t *testing.T) {
+	auth := newAuthService()
+	runTest(t, newAccessService, func(s *restest.Session) {
+		services := s.Services()
+		restest.AssertEqualJSON(t, "len(services)", len(services), 2)
+		restest.AssertTrue(t, "first service to be the service under test", services[0] == s.Service())
+		restest.AssertTrue(t, "second service to be the auth service", services[1] == auth)
+	}, restest.WithServices(auth))
+}
+
+func TestServices_WithGnatsd_RoutesRequests(t *testing.T) {
+	runTest(t, newAccessService, func(s *restest.Session) {
+		req := restest.DefaultAccessRequest()
+		req.Token = json.RawMessage(`{"role":"admin"}`)
+		inb := s.Access("test.model", req)
+		s.GetMsg().AssertSubject("call.auth.perm.check")
+		s.GetMsg().AssertResult(map[string]bool{"granted": true})
+		inb.Response().AssertAccess(true, "*")
+	}, restest.WithServices(newAuthService()), restest.WithGnatsd)
+}
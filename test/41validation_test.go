@@ -0,0 +1,115 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// fieldError mimics the validator.FieldError of go-playground/validator.
+type fieldError struct {
+	field string
+	tag   string
+	param string
+}
+
+func (fe fieldError) Field() string { return fe.field }
+func (fe fieldError) Tag() string   { return fe.tag }
+func (fe fieldError) Param() string { return fe.param }
+func (fe fieldError) Error() string {
+	return fmt.Sprintf("Field validation for '%s' failed on the '%s' tag", fe.field, fe.tag)
+}
+
+// validationErrors mimics the validator.ValidationErrors of go-playground/validator.
+type validationErrors []fieldError
+
+func (ve validationErrors) Error() string { return "validation failed" }
+
+var testValidationErrors = validationErrors{
+	{field: "name", tag: "required"},
+	{field: "age", tag: "max", param: "130"},
+}
+
+var testFieldErrors = []res.FieldError{
+	{Field: "name", Message: "Field validation for 'name' failed on the 'required' tag", Tag: "required"},
+	{Field: "age", Message: "Field validation for 'age' failed on the 'max' tag", Tag: "max", Param: "130"},
+}
+
+// Test ValidationError converts validation errors to system.invalidParams with field errors.
+func TestValidationError_WithValidationErrors_ReturnsInvalidParams(t *testing.T) {
+	table := []struct {
+		Err      error
+		Expected []res.FieldError
+	}{
+		{testValidationErrors, testFieldErrors},
+		{testValidationErrors[0], testFieldErrors[:1]},
+		{fmt.Errorf("wrapped: %w", testValidationErrors), testFieldErrors},
+	}
+	for i, l := range table {
+		e := res.ValidationError(l.Err)
+		restest.AssertTrue(t, fmt.Sprintf("error not nil for test #%d", i), e != nil)
+		restest.AssertEqualJSON(t, fmt.Sprintf("error for test #%d", i), e, &res.Error{
+			Code:    res.CodeInvalidParams,
+			Message: res.ErrInvalidParams.Message,
+			Data:    l.Expected,
+		})
+	}
+}
+
+// Test ValidationError returns nil for errors not being validation errors.
+func TestValidationError_WithOtherErrors_ReturnsNil(t *testing.T) {
+	for i, err := range []error{nil, errors.New("foo"), validationErrors{}} {
+		restest.AssertTrue(t, fmt.Sprintf("nil error for test #%d", i), res.ValidationError(err) == nil)
+	}
+}
+
+// Test ToError does not convert validation errors to system.invalidParams.
+func TestToError_WithValidationErrors_ReturnsInternalError(t *testing.T) {
+	e := res.ToError(testValidationErrors)
+	restest.AssertEqualJSON(t, "error code", e.Code, res.CodeInternalError)
+}
+
+// Test returning validation errors with Error on a call request responds with system.invalidParams.
+func TestCallError_WithValidationErrors_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.Error(testValidationErrors)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams).
+			AssertErrorData(testFieldErrors)
+	})
+}
+
+// Test panicking with validation errors in a call request responds with system.invalidParams.
+func TestCallPanic_WithValidationErrors_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			panic(testValidationErrors)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams).
+			AssertErrorData(testFieldErrors)
+	})
+}
+
+// Test panicking with a wrapped validation error in an auth request responds with system.invalidParams.
+func TestAuthPanic_WithWrappedValidationError_RespondsWithInvalidParams(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Auth("method", func(r res.AuthRequest) {
+			panic(fmt.Errorf("invalid login: %w", testValidationErrors[0]))
+		}))
+	}, func(s *restest.Session) {
+		s.Auth("test.model", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInvalidParams).
+			AssertErrorData(testFieldErrors[:1])
+	})
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+var testSunset = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Test that a HTTP-originated call to a deprecated method gets deprecation headers in meta.
+func TestDeprecated_HTTPCall_RespondsWithDeprecationHeaders(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+			res.Deprecated("method", "Use other method", testSunset),
+		)
+	}, func(s *restest.Session) {
+		req := mock.DefaultRequest()
+		req.IsHTTP = true
+		s.Call("test.model", "method", req).
+			Response().
+			AssertPayload(map[string]interface{}{
+				"result": nil,
+				"meta": map[string]interface{}{
+					"header": map[string][]string{
+						"Deprecation": {"true"},
+						"Sunset":      {"Wed, 02 Jan 2030 03:04:05 GMT"},
+					},
+				},
+			})
+	})
+}
+
+// Test that a deprecated method without sunset time only gets the Deprecation header.
+func TestDeprecated_HTTPCallWithoutSunset_RespondsWithDeprecationHeader(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Auth("method", func(r res.AuthRequest) { r.OK(nil) }),
+			res.Deprecated("method", "Use other method", time.Time{}),
+		)
+	}, func(s *restest.Session) {
+		req := mock.DefaultRequest()
+		req.IsHTTP = true
+		s.Auth("test.model", "method", req).
+			Response().
+			AssertPayload(map[string]interface{}{
+				"result": nil,
+				"meta": map[string]interface{}{
+					"header": map[string][]string{
+						"Deprecation": {"true"},
+					},
+				},
+			})
+	})
+}
+
+// Test that a non-HTTP call to a deprecated method gets no meta.
+func TestDeprecated_NonHTTPCall_RespondsWithoutMeta(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+			res.Deprecated("method", "Use other method", testSunset),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertPayload(map[string]interface{}{"result": nil})
+	})
+}
+
+// Test that Deprecations returns the deprecated methods with their usage.
+func TestDeprecated_Deprecations_ReturnsUsage(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+			res.Call("other", func(r res.CallRequest) { r.OK(nil) }),
+			res.New(func(r res.NewRequest) { r.New(res.Ref("test.model.new")) }),
+			res.Deprecated("other", "Use method", time.Time{}),
+			res.Deprecated("new", "Use create", testSunset),
+		)
+	}, func(s *restest.Session) {
+		for i := 0; i < 2; i++ {
+			s.Call("test.model", "other", nil).Response()
+		}
+		s.Call("test.model", "method", nil).Response()
+		s.Call("test.model", "new", nil).Response()
+		restest.AssertEqualJSON(t, "deprecations", s.Service().Deprecations(), []res.DeprecationInfo{
+			{Pattern: "test.model", Method: "new", Message: "Use create", Sunset: testSunset, Calls: 1},
+			{Pattern: "test.model", Method: "other", Message: "Use method", Calls: 2},
+		})
+	})
+}
+
+// Test that Deprecated panics on an empty method.
+func TestDeprecated_EmptyMethod_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() {
+		res.Deprecated("", "Use other method", testSunset)
+	})
+}
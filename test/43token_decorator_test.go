@@ -0,0 +1,132 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// permissionDecorator resolves the role of the token to permissions, counting
+// the calls.
+func permissionDecorator(calls *int) res.TokenDecorator {
+	return func(r res.Resource, token json.RawMessage) (interface{}, error) {
+		*calls++
+		var t struct {
+			Role string `json:"role"`
+		}
+		if token != nil {
+			if err := json.Unmarshal(token, &t); err != nil {
+				return nil, err
+			}
+		}
+		perms := []string{}
+		if t.Role == "admin" {
+			perms = append(perms, "read", "write")
+		}
+		return map[string]interface{}{"role": t.Role, "permissions": perms}, nil
+	}
+}
+
+// Test that ParseToken uses the decorated token, calling the decorator once per request.
+func TestTokenDecorator_ParseToken_UsesDecoratedToken(t *testing.T) {
+	calls := 0
+	runTest(t, func(s *res.Service) {
+		s.SetTokenDecorator(permissionDecorator(&calls))
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			var t1, t2 struct {
+				Permissions []string `json:"permissions"`
+			}
+			r.ParseToken(&t1)
+			r.ParseToken(&t2)
+			r.OK(map[string]interface{}{"first": t1.Permissions, "second": t2.Permissions})
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Token: json.RawMessage(`{"role":"admin"}`)}).
+			Response().
+			AssertResult(map[string]interface{}{
+				"first":  []string{"read", "write"},
+				"second": []string{"read", "write"},
+			})
+		restest.AssertEqualJSON(t, "decorator calls", calls, 1)
+	})
+}
+
+// Test that RawToken returns the decorated token on an access request.
+func TestTokenDecorator_AccessRequestRawToken_ReturnsDecoratedToken(t *testing.T) {
+	calls := 0
+	runTest(t, func(s *res.Service) {
+		s.SetTokenDecorator(permissionDecorator(&calls))
+		s.Handle("model", res.Access(func(r res.AccessRequest) {
+			var t struct {
+				Role string `json:"role"`
+			}
+			r.ParseToken(&t)
+			if string(r.RawToken()) != `{"permissions":[],"role":"user"}` {
+				r.AccessDenied()
+				return
+			}
+			r.AccessGranted()
+		}))
+	}, func(s *restest.Session) {
+		s.Access("test.model", &restest.Request{Token: json.RawMessage(`{"role":"user"}`)}).
+			Response().
+			AssertAccess(true, "*")
+		restest.AssertEqualJSON(t, "decorator calls", calls, 1)
+	})
+}
+
+// Test that the decorator is called with a nil token for requests without token.
+func TestTokenDecorator_RequestWithoutToken_CallsDecoratorWithNil(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetTokenDecorator(func(r res.Resource, token json.RawMessage) (interface{}, error) {
+			if token != nil {
+				return nil, errors.New("unexpected token")
+			}
+			return json.RawMessage(`{"anonymous":true}`), nil
+		})
+		s.Handle("model", res.Auth("method", func(r res.AuthRequest) {
+			r.OK(r.RawToken())
+		}))
+	}, func(s *restest.Session) {
+		s.Auth("test.model", "method", nil).
+			Response().
+			AssertResult(map[string]interface{}{"anonymous": true})
+	})
+}
+
+// Test that the decorator is not called when the handler does not use the token.
+func TestTokenDecorator_TokenNotUsed_DecoratorNotCalled(t *testing.T) {
+	calls := 0
+	runTest(t, func(s *res.Service) {
+		s.SetTokenDecorator(permissionDecorator(&calls))
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Token: json.RawMessage(`{"role":"admin"}`)}).
+			Response().
+			AssertResult(nil)
+		restest.AssertEqualJSON(t, "decorator calls", calls, 0)
+	})
+}
+
+// Test that a decorator error is responded with as an error.
+func TestTokenDecorator_DecoratorError_RespondsWithError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetTokenDecorator(func(r res.Resource, token json.RawMessage) (interface{}, error) {
+			return nil, res.ErrAccessDenied
+		})
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			var t interface{}
+			r.ParseToken(&t)
+			r.OK(t)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", &restest.Request{Token: json.RawMessage(`{"role":"admin"}`)}).
+			Response().
+			AssertError(res.ErrAccessDenied)
+	})
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+const testMaxPayload = 100
+
+var oversizedValue = strings.Repeat("x", testMaxPayload)
+
+// Test that a call response exceeding the max payload is replaced with an internal error, reported through OnError.
+func TestMaxPayload_OversizedCallResponse_RespondsWithInternalError(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.SetOnError(func(_ *res.Service, msg string) {
+			mu.Lock()
+			errs = append(errs, msg)
+			mu.Unlock()
+		})
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK(oversizedValue)
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertError(&res.Error{Code: res.CodeInternalError, Message: "Internal error: response exceeds maximum payload size"})
+		mu.Lock()
+		defer mu.Unlock()
+		restest.AssertEqualJSON(t, "number of errors", len(errs), 1)
+		restest.AssertTrue(t, "error includes resource", strings.Contains(errs[0], "test.model"))
+		restest.AssertTrue(t, "error includes size", strings.Contains(errs[0], "exceeds maximum of 100 bytes"))
+	})
+}
+
+// Test that a get response exceeding the max payload is replaced with an internal error.
+func TestMaxPayload_OversizedGetResponse_RespondsWithInternalError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.Model(map[string]interface{}{"value": oversizedValue})
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that a response within the max payload is sent as is.
+func TestMaxPayload_ResponseWithinLimit_RespondsWithResult(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.OK("small")
+		}))
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResult("small")
+	})
+}
+
+// Test that an event exceeding the max payload is replaced with a system reset of the resource.
+func TestMaxPayload_OversizedEvent_SendsSystemReset(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.Event("foo", map[string]interface{}{"value": oversizedValue})
+			r.Event("bar", map[string]interface{}{"value": "small"})
+		})
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, nil)
+		s.GetMsg().AssertCustomEvent("test.model", "bar", map[string]interface{}{"value": "small"})
+	})
+}
+
+// Test that OversizeFallback responds with a resource response on an oversized call result.
+func TestOversizeFallback_OversizedCallResult_RespondsWithResource(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.OK([]string{oversizedValue})
+			}),
+			res.OversizeFallback(func(r res.Resource) string {
+				return "test.collection?limit=10"
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertResource("test.collection?limit=10")
+	})
+}
+
+// Test that OversizeFallback returning an empty string responds with an internal error.
+func TestOversizeFallback_EmptyResourceID_RespondsWithInternalError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.OK([]string{oversizedValue})
+			}),
+			res.OversizeFallback(func(r res.Resource) string { return "" }),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+	})
+}
+
+// Test that OversizeFallback is not used when the compressed call result is within the max payload.
+func TestOversizeFallback_CompressedResultWithinLimit_RespondsCompressed(t *testing.T) {
+	long := strings.Repeat("x", 10*testMaxPayload)
+	runTest(t, func(s *res.Service) {
+		s.SetMaxPayload(testMaxPayload)
+		s.SetCompression(testMaxPayload)
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) {
+				r.OK(long)
+			}),
+			res.OversizeFallback(func(r res.Resource) string {
+				return "test.collection?limit=10"
+			}),
+		)
+	}, func(s *restest.Session) {
+		inb := s.RequestRawWithHeader("call.test.model.method", gzipHeader, gzipBytes([]byte(`{}`)))
+		msg := s.GetMsg().AssertSubject(inb)
+		restest.AssertEqualJSON(t, "Content-Encoding", msg.Header.Get("Content-Encoding"), "gzip")
+		restest.AssertEqualJSON(t, "response", json.RawMessage(gunzipBytes(t, msg.Data)), json.RawMessage(`{"result":"`+long+`"}`))
+	})
+}
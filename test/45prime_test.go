@@ -0,0 +1,73 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that Prime gets the values of the resources through the get handlers.
+func TestPrime_ValidResources_CallsGetHandlers(t *testing.T) {
+	var mu sync.Mutex
+	var gets []string
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			mu.Lock()
+			gets = append(gets, r.ResourceName())
+			mu.Unlock()
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		err := s.Service().Prime("test.model.1", "test.model.2")
+		restest.AssertNoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		restest.AssertEqualJSON(t, "number of gets", len(gets), 2)
+	})
+}
+
+// Test that Prime calls the OnPrime callback with each value.
+func TestPrime_WithOnPrime_CallsCallbackWithValue(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetOnPrime(func(r res.Resource, v interface{}) {
+			r.Event("primed", v)
+		})
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().Prime("test.model"))
+		s.GetMsg().AssertCustomEvent("test.model", "primed", mock.Model)
+	})
+}
+
+// Test that Prime returns an error for resources that could not be fetched.
+func TestPrime_InvalidResources_ReturnsError(t *testing.T) {
+	for _, rid := range []string{"test.model.notfound", "test.missing", "test..model"} {
+		runTest(t, func(s *res.Service) {
+			s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+				r.NotFound()
+			}))
+		}, func(s *restest.Session) {
+			restest.AssertTrue(t, "error on prime", s.Service().Prime(rid) != nil)
+		}, restest.WithTest(rid))
+	}
+}
+
+// Test that the resources set with SetPrimeOnReset are primed before the system reset on start.
+func TestSetPrimeOnReset_OnStart_PrimesBeforeReset(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetPrimeOnReset("test.model")
+		s.SetOnPrime(func(r res.Resource, v interface{}) {
+			r.Event("primed", v)
+		})
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.GetMsg().AssertCustomEvent("test.model", "primed", mock.Model)
+		s.GetMsg().AssertSubject("system.reset")
+	}, restest.WithoutReset)
+}
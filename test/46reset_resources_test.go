@@ -0,0 +1,80 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that ResetResources sends a system reset with the resource names, removing queries and duplicates.
+func TestResetResources_ResourceIDs_SendsSystemReset(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().ResetResources("test.model.2", "test.model.1", "test.models?limit=10", "test.models?limit=20", "test.model.1")
+		s.GetMsg().AssertSystemReset([]string{"test.model.1", "test.model.2", "test.models"}, nil)
+	})
+}
+
+// Test that ResetResources groups resources sharing the same parent into a wildcard pattern.
+func TestResetResources_ManySiblings_GroupsIntoPattern(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetResetGroupSize(3)
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().ResetResources("test.model.1", "test.model.2", "test.model.3", "test.other.1", "test.other.2", "test")
+		s.GetMsg().AssertSystemReset([]string{"test", "test.model.*", "test.other.1", "test.other.2"}, nil)
+	})
+}
+
+// Test that ResetResources with default group size groups siblings once there are 16 of them.
+func TestResetResources_DefaultGroupSize_GroupsAtSixteen(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		var rids []string
+		for i := 0; i < 15; i++ {
+			rids = append(rids, fmt.Sprintf("test.model.%d", i))
+		}
+		s.Service().ResetResources(rids...)
+		msg := s.GetMsg()
+		restest.AssertEqualJSON(t, "number of resources", len(msg.PathPayload("resources").([]interface{})), 15)
+		s.Service().ResetResources(append(rids, "test.model.15")...)
+		s.GetMsg().AssertSystemReset([]string{"test.model.*"}, nil)
+	})
+}
+
+// Test that ResetResources with a negative group size never groups resources.
+func TestResetResources_NegativeGroupSize_DoesNotGroup(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetResetGroupSize(-1)
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().ResetResources("test.model.1", "test.model.2")
+		s.GetMsg().AssertSystemReset([]string{"test.model.1", "test.model.2"}, nil)
+	})
+}
+
+// Test that ResetResources with no resource IDs sends no system reset.
+func TestResetResources_NoResourceIDs_SendsNothing(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().ResetResources()
+		s.Service().ResetResources("test.model.1")
+		s.GetMsg().AssertSystemReset([]string{"test.model.1"}, nil)
+	})
+}
+
+// Test that ResetResources panics on an invalid resource ID.
+func TestResetResources_InvalidResourceID_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().ResetResources("test.model.*")
+		})
+	})
+}
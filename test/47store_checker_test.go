@@ -0,0 +1,145 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/store"
+	"github.com/jirenius/go-res/store/mockstore"
+)
+
+var checkerRIDs = func() ([]string, error) {
+	return []string{"test.model.1", "test.model.2"}, nil
+}
+
+// newCheckerStore returns a store with the models served by newCheckerHandler.
+func newCheckerStore() *mockstore.Store {
+	return mockstore.NewStore().
+		Add("test.model.1", map[string]interface{}{"id": 1, "name": "foo"}).
+		Add("test.model.2", map[string]interface{}{"id": 2, "name": "bar"})
+}
+
+// Test that Check reports no drift when the served values match the store.
+func TestChecker_ConsistentValues_ReportsNoDrift(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.Model, store.Handler{Store: st})
+	}, func(s *restest.Session) {
+		c := &store.Checker{Service: s.Service(), Store: st, RIDs: checkerRIDs}
+		drifts, err := c.Check()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "drifts", drifts, nil)
+		restest.AssertEqualJSON(t, "stats", c.Stats(), store.CheckStats{Runs: 1, Checked: 2})
+	})
+}
+
+// Test that Check reports drift when the get handler serves a value differing from the store.
+func TestChecker_DivergingServedValue_ReportsDrift(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			if r.PathParam("id") == "2" {
+				r.Model(map[string]interface{}{"id": 2, "name": "baz"})
+				return
+			}
+			r.Model(map[string]interface{}{"id": 1, "name": "foo"})
+		}))
+	}, func(s *restest.Session) {
+		var reported []store.Drift
+		c := &store.Checker{
+			Service: s.Service(),
+			Store:   st,
+			RIDs:    checkerRIDs,
+			OnDrift: func(d store.Drift) { reported = append(reported, d) },
+		}
+		drifts, err := c.Check()
+		restest.AssertNoError(t, err)
+		expected := []store.Drift{{
+			RID:    "test.model.2",
+			Stored: map[string]interface{}{"id": 2, "name": "bar"},
+			Served: map[string]interface{}{"id": 2, "name": "baz"},
+		}}
+		restest.AssertEqualJSON(t, "drifts", drifts, expected)
+		restest.AssertEqualJSON(t, "reported drifts", reported, expected)
+		restest.AssertEqualJSON(t, "stats", c.Stats(), store.CheckStats{Runs: 1, Checked: 2, Drifted: 1})
+	})
+}
+
+// Test that Check reports drift when the gateway value differs from the served value.
+func TestChecker_DivergingGatewayValue_ReportsDrift(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.Model, store.Handler{Store: st})
+	}, func(s *restest.Session) {
+		c := &store.Checker{
+			Service: s.Service(),
+			Store:   st,
+			RIDs:    checkerRIDs,
+			OnDrift: func(store.Drift) {},
+			Gateway: func(rid string) (interface{}, error) {
+				if rid == "test.model.1" {
+					return map[string]interface{}{"id": 1, "name": "old"}, nil
+				}
+				return map[string]interface{}{"id": 2, "name": "bar"}, nil
+			},
+		}
+		drifts, err := c.Check()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "drifts", drifts, []store.Drift{{
+			RID:     "test.model.1",
+			Stored:  map[string]interface{}{"id": 1, "name": "foo"},
+			Served:  map[string]interface{}{"id": 1, "name": "foo"},
+			Cached:  map[string]interface{}{"id": 1, "name": "old"},
+			Gateway: true,
+		}})
+	})
+}
+
+// Test that Check samples at most SampleSize resources.
+func TestChecker_SampleSize_ChecksSample(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.Model, store.Handler{Store: st})
+	}, func(s *restest.Session) {
+		c := &store.Checker{Service: s.Service(), Store: st, RIDs: checkerRIDs, SampleSize: 1}
+		_, err := c.Check()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "stats", c.Stats(), store.CheckStats{Runs: 1, Checked: 1})
+	})
+}
+
+// Test that Check returns the error of the RIDs callback.
+func TestChecker_RIDsError_ReturnsError(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.Model, store.Handler{Store: st})
+	}, func(s *restest.Session) {
+		c := &store.Checker{
+			Service: s.Service(),
+			Store:   st,
+			RIDs:    func() ([]string, error) { return nil, errors.New("failed") },
+		}
+		_, err := c.Check()
+		restest.AssertTrue(t, "error returned", err != nil)
+	})
+}
+
+// Test that Start runs checks periodically until stopped.
+func TestChecker_Start_ChecksPeriodically(t *testing.T) {
+	st := newCheckerStore()
+	runTest(t, func(s *res.Service) {
+		s.Handle("model.$id", res.Model, store.Handler{Store: st})
+	}, func(s *restest.Session) {
+		c := &store.Checker{Service: s.Service(), Store: st, RIDs: checkerRIDs, Interval: time.Millisecond}
+		c.Start()
+		deadline := time.Now().Add(timeoutDuration)
+		for c.Stats().Runs < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		c.Stop()
+		restest.AssertTrue(t, "at least two runs", c.Stats().Runs >= 2)
+	})
+}
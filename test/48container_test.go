@@ -0,0 +1,188 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+type testConfig struct {
+	Name string
+}
+
+type testPool struct {
+	name   string
+	closed *[]string
+}
+
+func (p *testPool) Close() error {
+	*p.closed = append(*p.closed, p.name)
+	return nil
+}
+
+// Test that a handler provider is resolved on start using dependencies from the container.
+func TestHandleProvider_WithDependencies_ServesResource(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		res.ProvideT(s.Container(), testConfig{Name: "foo"})
+		s.HandleProvider("model", func(c *res.Container) (res.Handler, error) {
+			cfg, err := res.ResolveT[testConfig](c)
+			if err != nil {
+				return res.Handler{}, err
+			}
+			return res.Handler{Get: func(r res.GetRequest) {
+				r.Model(map[string]interface{}{"name": cfg.Name})
+			}}, nil
+		})
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(map[string]interface{}{"name": "foo"})
+	})
+}
+
+// Test that a factory is called once, and that created io.Closer values and
+// OnClose functions are closed in reverse order when the service stops.
+func TestContainer_ServiceStopped_ClosesInReverseOrder(t *testing.T) {
+	var closed []string
+	var created int
+	runTest(t, func(s *res.Service) {
+		c := res.NewContainer()
+		c.OnClose(func() error { closed = append(closed, "first"); return nil })
+		res.ProvideFuncT(c, func(c *res.Container) (*testPool, error) {
+			created++
+			return &testPool{name: "pool", closed: &closed}, nil
+		})
+		s.SetContainer(c)
+		for _, pattern := range []string{"model.a", "model.b"} {
+			s.HandleProvider(pattern, func(c *res.Container) (res.Handler, error) {
+				res.MustResolveT[*testPool](c)
+				return res.Handler{Get: func(r res.GetRequest) { r.NotFound() }}, nil
+			})
+		}
+	}, func(s *restest.Session) {
+		restest.AssertEqualJSON(t, "created", created, 1)
+		restest.AssertEqualJSON(t, "closed", closed, nil)
+	})
+	restest.AssertEqualJSON(t, "closed", closed, []string{"pool", "first"})
+}
+
+// Test that an error returned by a handler provider aborts startup, and closes the container.
+func TestHandleProvider_ReturnsError_AbortsStartup(t *testing.T) {
+	var closed bool
+	rs := res.NewService("test")
+	rs.SetLogger(nil)
+	rs.Container().OnClose(func() error { closed = true; return nil })
+	rs.HandleProvider("model", func(c *res.Container) (res.Handler, error) {
+		return res.Handler{}, errors.New("provider failed")
+	})
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	c.AssertNoSubscription("get.test.>")
+	restest.AssertTrue(t, "container to be closed", closed)
+}
+
+// Test that a handler provider panicking on a missing dependency aborts startup.
+func TestHandleProvider_MissingDependency_AbortsStartup(t *testing.T) {
+	rs := res.NewService("test")
+	rs.SetLogger(nil)
+	rs.HandleProvider("model", func(c *res.Container) (res.Handler, error) {
+		res.MustResolveT[testConfig](c)
+		return res.Handler{Get: func(r res.GetRequest) { r.NotFound() }}, nil
+	})
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	c.AssertNoSubscription("get.test.>")
+}
+
+// Test that Resolve returns the value provided for a key.
+func TestContainerResolve_ProvidedKey_ReturnsValue(t *testing.T) {
+	c := res.NewContainer().Provide("dsn", "postgres://localhost")
+	v, err := c.Resolve("dsn")
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "value", v, "postgres://localhost")
+}
+
+// Test that Resolve returns an error for a key with no dependency.
+func TestContainerResolve_MissingKey_ReturnsError(t *testing.T) {
+	_, err := res.NewContainer().Resolve("dsn")
+	restest.AssertError(t, err)
+}
+
+// Test that Resolve returns an error for a dependency depending on itself.
+func TestContainerResolve_CircularDependency_ReturnsError(t *testing.T) {
+	c := res.NewContainer()
+	c.ProvideFunc("a", func(c *res.Container) (interface{}, error) { return c.Resolve("b") })
+	c.ProvideFunc("b", func(c *res.Container) (interface{}, error) { return c.Resolve("a") })
+	_, err := c.Resolve("a")
+	restest.AssertError(t, err)
+}
+
+// Test that concurrent Resolve calls for a key call its factory once, and
+// return the same value without a circular dependency error.
+func TestContainerResolve_Concurrent_CallsFactoryOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	c := res.NewContainer()
+	c.ProvideFunc("pool", func(c *res.Container) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "pool", nil
+	})
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Resolve("pool")
+			if err == nil && v != "pool" {
+				err = errors.New("unexpected value")
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(timeoutDuration / 10)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		restest.AssertNoError(t, err)
+	}
+	restest.AssertEqualJSON(t, "factory calls", atomic.LoadInt32(&calls), 1)
+}
+
+// Test that a service failing to validate its listeners closes the container.
+func TestServe_InvalidListener_ClosesContainer(t *testing.T) {
+	var closed bool
+	rs := res.NewService("test")
+	rs.SetLogger(nil)
+	rs.Container().OnClose(func() error { closed = true; return nil })
+	rs.AddListener("missing", func(ev *res.Event) {})
+	c := restest.NewMockConn(t, nil)
+	restest.AssertError(t, rs.Serve(c))
+	restest.AssertTrue(t, "container to be closed", closed)
+}
+
+// Test that Provide panics on a key that is not comparable.
+func TestContainerProvide_InvalidKey_Panics(t *testing.T) {
+	c := res.NewContainer()
+	restest.AssertPanic(t, func() { c.Provide(nil, 1) })
+	restest.AssertPanic(t, func() { c.Provide([]string{"a"}, 1) })
+}
+
+// Test that HandleProvider and SetContainer panic if the service is already started.
+func TestHandleProvider_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().HandleProvider("other", func(c *res.Container) (res.Handler, error) { return res.Handler{}, nil })
+		})
+		restest.AssertPanic(t, func() { s.Service().SetContainer(res.NewContainer()) })
+	})
+}
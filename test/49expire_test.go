@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a created resource with ExpireAfter set is deleted after the duration.
+func TestExpireAfter_CreateEvent_SendsDeleteEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ExpireAfter(10*time.Millisecond), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(mock.Model)
+		})
+		s.GetMsg().AssertCreateEvent("test.model")
+		s.GetMsg().AssertDeleteEvent("test.model")
+	})
+}
+
+// Test that a changed resource with ExpireAfter set is deleted after the duration.
+func TestExpireAfter_ChangeEvent_SendsDeleteEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ExpireAfter(10*time.Millisecond), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+		})
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		s.GetMsg().AssertDeleteEvent("test.model")
+	})
+}
+
+// Test that an event on a resource with ExpireAfter set postpones the expiry.
+func TestExpireAfter_LaterEvent_PostponesExpiry(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ExpireAfter(50*time.Millisecond), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(mock.Model)
+		})
+		s.GetMsg().AssertCreateEvent("test.model")
+		time.Sleep(30 * time.Millisecond)
+		s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+		})
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		s.AssertNoMsg(30 * time.Millisecond)
+		s.GetMsg().AssertDeleteEvent("test.model")
+	})
+}
+
+// Test that a delete event on a resource with ExpireAfter set cancels the expiry.
+func TestExpireAfter_DeleteEvent_CancelsExpiry(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.ExpireAfter(10*time.Millisecond), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(mock.Model)
+			r.DeleteEvent()
+		})
+		s.GetMsg().AssertCreateEvent("test.model")
+		s.GetMsg().AssertDeleteEvent("test.model")
+		s.AssertNoMsg(30 * time.Millisecond)
+	})
+}
+
+// Test that resources without ExpireAfter set never expire.
+func TestExpireAfter_NotSet_DoesNotExpire(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(mock.Model)
+		})
+		s.GetMsg().AssertCreateEvent("test.model")
+		s.AssertNoMsg(30 * time.Millisecond)
+	})
+}
+
+// Test that ExpireAfter panics on a duration not greater than zero.
+func TestExpireAfter_InvalidDuration_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.ExpireAfter(0) })
+}
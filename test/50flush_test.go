@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that Flush flushes the connection.
+func TestFlush_StartedService_FlushesConnection(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().Flush(context.Background()))
+		restest.AssertEqualJSON(t, "flush count", s.FlushCount(), 1)
+	})
+}
+
+// Test that Flush returns an error if flushing fails.
+func TestFlush_FailingFlush_ReturnsError(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.FailNextFlush()
+		restest.AssertError(t, s.Service().Flush(context.Background()))
+	})
+}
+
+// Test that Flush returns an error if the service is not started.
+func TestFlush_NotStarted_ReturnsError(t *testing.T) {
+	restest.AssertError(t, res.NewService("test").Flush(context.Background()))
+}
+
+// Test that events on resources with SyncEvents set are flushed before the call response is sent.
+func TestSyncEvents_ChangeEvent_FlushesBeforeResponse(t *testing.T) {
+	called := make(chan struct{}, 1)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.SyncEvents,
+			res.Call("method", func(r res.CallRequest) {
+				r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+				r.Event("custom", nil)
+				called <- struct{}{}
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		<-called
+		restest.AssertEqualJSON(t, "flush count", s.FlushCount(), 2)
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		s.GetMsg().AssertEventName("test.model", "custom")
+		req.Response().AssertResult(nil)
+	})
+}
+
+// Test that events on resources without SyncEvents set are not flushed.
+func TestSyncEvents_NotSet_DoesNotFlush(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": "bar"})
+		})
+		s.GetMsg().AssertChangeEvent("test.model", map[string]interface{}{"foo": "bar"})
+		restest.AssertEqualJSON(t, "flush count", s.FlushCount(), 0)
+	})
+}
+
+// Test that a failed flush of a synchronous event is reported as an error.
+func TestSyncEvents_FailingFlush_ReportsError(t *testing.T) {
+	errs := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) { errs <- msg })
+		s.Handle("model", res.SyncEvents, res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.FailNextFlush()
+		s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(nil)
+		})
+		s.GetMsg().AssertCreateEvent("test.model")
+		select {
+		case <-errs:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected flush error, but got none")
+		}
+	})
+}
+
+// Test that SetFlushTimeout panics on a timeout not greater than zero.
+func TestSetFlushTimeout_InvalidTimeout_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.NewService("test").SetFlushTimeout(0) })
+}
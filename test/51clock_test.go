@@ -0,0 +1,130 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a service uses the system clock by default.
+func TestClock_Default_IsSystemClock(t *testing.T) {
+	restest.AssertTrue(t, "clock to be SystemClock", res.NewService("test").Clock() == res.SystemClock)
+}
+
+// Test that SetClock panics on a nil clock, or if the service is started.
+func TestSetClock_InvalidUse_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.NewService("test").SetClock(nil) })
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() { s.Service().SetClock(restest.NewMockClock(time.Time{})) })
+	})
+}
+
+// Test that ExpireAfter uses the service clock.
+func TestClock_ExpireAfter_ExpiresWhenClockAdvances(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model", res.ExpireAfter(time.Hour), res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.CreateEvent(mock.Model)
+		}))
+		s.GetMsg().AssertCreateEvent("test.model")
+		clock.Add(time.Hour - time.Second)
+		s.AssertNoMsg(timeoutDuration / 10)
+		clock.Add(time.Second)
+		s.GetMsg().AssertDeleteEvent("test.model")
+	})
+}
+
+// Test that ThrottleEvents uses the service clock.
+func TestClock_ThrottleEvents_SendsBufferedEventsWhenClockAdvances(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model", res.ThrottleEvents(1, res.ThrottleBatch), res.GetModel(func(r res.ModelRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+			r.ChangeEvent(map[string]interface{}{"foo": 2})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		s.AssertNoMsg(timeoutDuration / 10)
+		clock.Add(time.Second)
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":2}`))
+	})
+}
+
+// Test that query event expiration uses the service clock.
+func TestClock_QueryEvent_ExpiresWhenClockAdvances(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	expired := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.QueryEvent(func(r res.QueryRequest) {
+					if r == nil {
+						close(expired)
+					}
+				})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertEventName("test.model", "query")
+		req.Response()
+		restest.AssertEqualJSON(t, "pending timers", clock.Timers(), 1)
+		clock.Add(3 * time.Second)
+		select {
+		case <-expired:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected query event to expire")
+		}
+	})
+}
+
+// Test that CappedCollection uses the service clock for the age limit.
+func TestClock_CappedCollection_TrimsValuesWhenClockAdvances(t *testing.T) {
+	clock := restest.NewMockClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cc := res.NewCappedCollection(0, time.Minute)
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("collection", cc)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			restest.AssertNoError(t, cc.AddCapped(r, "foo"))
+		}))
+		s.GetMsg().AssertAddEvent("test.collection", "foo", 0)
+		clock.Add(time.Minute + time.Second)
+		restest.AssertNoError(t, s.Service().With("test.collection", func(r res.Resource) {
+			restest.AssertNoError(t, cc.Trim(r))
+		}))
+		s.GetMsg().AssertRemoveEvent("test.collection", 0)
+	})
+}
+
+// Test that MockClock calls timers in order of their scheduled time, and not after being stopped.
+func TestMockClock_Add_CallsDueTimersInOrder(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	var called []string
+	clock.AfterFunc(2*time.Second, func() { called = append(called, "b") })
+	clock.AfterFunc(time.Second, func() {
+		called = append(called, "a")
+		clock.AfterFunc(time.Second, func() { called = append(called, "c") })
+	})
+	stopped := clock.AfterFunc(time.Second, func() { called = append(called, "stopped") })
+	clock.AfterFunc(3*time.Second, func() { called = append(called, "d") })
+	restest.AssertTrue(t, "stop to return true", stopped.Stop())
+	clock.Add(2 * time.Second)
+	restest.AssertEqualJSON(t, "called", called, []string{"a", "b", "c"})
+	restest.AssertEqualJSON(t, "now", clock.Now(), time.Time{}.Add(2*time.Second))
+	restest.AssertEqualJSON(t, "pending timers", clock.Timers(), 1)
+}
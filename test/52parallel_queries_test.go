@@ -0,0 +1,74 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that query requests for a handler with ParallelQueries set are handled
+// while the resource's worker goroutine is busy.
+func TestParallelQueries_BusyGroup_HandlesQueryRequest(t *testing.T) {
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetQueryWorkerCount(2)
+		s.Handle("model",
+			res.ParallelQueries(true),
+			res.GetModel(func(r res.ModelRequest) {
+				r.Model(mock.Model)
+			}),
+			res.Call("method", func(r res.CallRequest) {
+				r.QueryEvent(func(qr res.QueryRequest) {
+					if qr != nil {
+						qr.ChangeEvent(map[string]interface{}{"foo": "bar"})
+					}
+				})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		// Block the resource's worker goroutine
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		s.QueryRequest(subj, mock.Query).
+			Response().
+			AssertResult(json.RawMessage(`{"events":[{"event":"change","data":{"values":{"foo":"bar"}}}]}`))
+		close(release)
+	}, restest.WithGnatsd)
+}
+
+// Test that query requests for a handler without ParallelQueries set wait for
+// the resource's worker goroutine.
+func TestParallelQueries_NotSet_WaitsForGroup(t *testing.T) {
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) {
+				r.Model(mock.Model)
+			}),
+			res.Call("method", func(r res.CallRequest) {
+				r.QueryEvent(func(qr res.QueryRequest) {})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		qreq := s.QueryRequest(subj, mock.Query)
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		qreq.Response().AssertResult(json.RawMessage(`{"events":[]}`))
+	}, restest.WithGnatsd)
+}
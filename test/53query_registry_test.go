@@ -0,0 +1,122 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a query event is added to the registry, and removed once expired.
+func TestQueryEventRegistry_QueryEvent_AddsAndRemovesRecord(t *testing.T) {
+	clock := restest.NewMockClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	reg := res.NewFileQueryEventRegistry(filepath.Join(t.TempDir(), "queries.json"))
+	expired := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.SetQueryEventRegistry(reg)
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.QueryEvent(func(r res.QueryRequest) {
+					if r == nil {
+						close(expired)
+					}
+				})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		recs, err := reg.List()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "records", recs, []res.QueryEventRecord{{
+			Subject: subj,
+			RID:     "test.model",
+			Expires: clock.Now().Add(3 * time.Second),
+		}})
+		clock.Add(3 * time.Second)
+		select {
+		case <-expired:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected query event to expire")
+		}
+		recs, err = reg.List()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "records", recs, []res.QueryEventRecord{})
+	})
+}
+
+// Test that unexpired query events in the registry, for query resources not
+// covered by the owned resources, are invalidated with a system reset on
+// start, and that all records are removed.
+func TestQueryEventRegistry_Start_ResetsUnexpiredQueryResources(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	reg := res.NewFileQueryEventRegistry(filepath.Join(t.TempDir(), "queries.json"))
+	restest.AssertNoError(t, reg.Add(res.QueryEventRecord{Subject: "_INBOX.1", RID: "old.books", Expires: now.Add(time.Second)}))
+	restest.AssertNoError(t, reg.Add(res.QueryEventRecord{Subject: "_INBOX.2", RID: "old.users", Expires: now.Add(-time.Second)}))
+	restest.AssertNoError(t, reg.Add(res.QueryEventRecord{Subject: "_INBOX.3", RID: "old.authors", Expires: now.Add(time.Second)}))
+	restest.AssertNoError(t, reg.Add(res.QueryEventRecord{Subject: "_INBOX.4", RID: "test.books", Expires: now.Add(time.Second)}))
+	runTest(t, func(s *res.Service) {
+		s.SetClock(restest.NewMockClock(now))
+		s.SetQueryEventRegistry(reg)
+		s.Handle(">", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.GetMsg().AssertSystemReset([]string{"old.authors", "old.books"}, nil)
+		recs, err := reg.List()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "records", recs, []res.QueryEventRecord{})
+	})
+}
+
+// Test that no system reset is sent on start if the registry has no unexpired query events.
+func TestQueryEventRegistry_StartWithoutRecords_SendsNoReset(t *testing.T) {
+	reg := res.NewFileQueryEventRegistry(filepath.Join(t.TempDir(), "queries.json"))
+	runTest(t, func(s *res.Service) {
+		s.SetQueryEventRegistry(reg)
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that FileQueryEventRegistry removes records, ignoring missing ones.
+func TestFileQueryEventRegistry_Remove_RemovesRecord(t *testing.T) {
+	reg := res.NewFileQueryEventRegistry(filepath.Join(t.TempDir(), "queries.json"))
+	rec := res.QueryEventRecord{Subject: "_INBOX.1", RID: "test.books", Expires: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	restest.AssertNoError(t, reg.Add(rec))
+	restest.AssertNoError(t, reg.Remove("_INBOX.2"))
+	recs, err := reg.List()
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "records", recs, []res.QueryEventRecord{rec})
+	restest.AssertNoError(t, reg.Remove("_INBOX.1"))
+	recs, err = reg.List()
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "records", recs, []res.QueryEventRecord{})
+}
+
+// Test that FileQueryEventRegistry writes the records to the file in the
+// background, to be read by a later registry using the same file.
+func TestFileQueryEventRegistry_Flush_WritesRecordsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	reg := res.NewFileQueryEventRegistry(path)
+	expires := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var recs []res.QueryEventRecord
+	for i := 1; i <= 10; i++ {
+		rec := res.QueryEventRecord{Subject: fmt.Sprintf("_INBOX.%02d", i), RID: "test.books", Expires: expires}
+		restest.AssertNoError(t, reg.Add(rec))
+		recs = append(recs, rec)
+	}
+	restest.AssertNoError(t, reg.Remove("_INBOX.01"))
+	restest.AssertNoError(t, reg.Flush())
+
+	list, err := res.NewFileQueryEventRegistry(path).List()
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "records", list, recs[1:])
+}
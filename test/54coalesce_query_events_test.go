@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that query events made during the same work on a resource with
+// CoalesceQueryEvents set are sent as a single query event, calling all
+// callbacks on query requests and on expiry.
+func TestCoalesceQueryEvents_MultipleQueryEvents_SendsSingleQueryEvent(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	var expired []string
+	done := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.CoalesceQueryEvents(true),
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.QueryEvent(func(qr res.QueryRequest) {
+				if qr == nil {
+					expired = append(expired, "foo")
+					return
+				}
+				qr.ChangeEvent(map[string]interface{}{"foo": 1})
+			})
+			r.QueryEvent(func(qr res.QueryRequest) {
+				if qr == nil {
+					expired = append(expired, "bar")
+					close(done)
+					return
+				}
+				qr.ChangeEvent(map[string]interface{}{"bar": 2})
+			})
+		}))
+		var subj string
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		s.AssertNoMsg(timeoutDuration / 10)
+		s.QueryRequest(subj, mock.Query).
+			Response().
+			AssertResult(json.RawMessage(`{"events":[{"event":"change","data":{"values":{"foo":1}}},{"event":"change","data":{"values":{"bar":2}}}]}`))
+		clock.Add(3 * time.Second)
+		select {
+		case <-done:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected query event to expire")
+		}
+		restest.AssertEqualJSON(t, "expired", expired, []string{"foo", "bar"})
+	}, restest.WithGnatsd)
+}
+
+// Test that a query request stops calling coalesced callbacks once a
+// callback has sent a response.
+func TestCoalesceQueryEvents_CallbackResponds_SkipsRemainingCallbacks(t *testing.T) {
+	called := false
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.CoalesceQueryEvents(true),
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.QueryEvent(func(qr res.QueryRequest) {
+				if qr != nil {
+					qr.NotFound()
+				}
+			})
+			r.QueryEvent(func(qr res.QueryRequest) {
+				if qr != nil {
+					called = true
+				}
+			})
+		}))
+		var subj string
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		s.QueryRequest(subj, mock.Query).
+			Response().
+			AssertError(res.ErrNotFound)
+		restest.AssertTrue(t, "second callback not to be called", !called)
+	}, restest.WithGnatsd)
+}
+
+// Test that a query event made after a coalesced query event is sent, is
+// sent as a new query event.
+func TestCoalesceQueryEvents_QueryEventAfterSent_SendsNewQueryEvent(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.CoalesceQueryEvents(true),
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		)
+	}, func(s *restest.Session) {
+		var subj1, subj2 string
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.QueryEvent(func(qr res.QueryRequest) {})
+		}))
+		s.GetMsg().AssertQueryEvent("test.model", &subj1)
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.QueryEvent(func(qr res.QueryRequest) {})
+		}))
+		s.GetMsg().AssertQueryEvent("test.model", &subj2)
+		restest.AssertTrue(t, "query subjects to differ", subj1 != subj2)
+	})
+}
+
+// Test that query events on a resource without CoalesceQueryEvents set are
+// sent as separate query events.
+func TestCoalesceQueryEvents_NotSet_SendsSeparateQueryEvents(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.QueryEvent(func(qr res.QueryRequest) {})
+			r.QueryEvent(func(qr res.QueryRequest) {})
+		}))
+		s.GetMsg().AssertQueryEvent("test.model", nil)
+		s.GetMsg().AssertQueryEvent("test.model", nil)
+	})
+}
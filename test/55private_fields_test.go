@@ -0,0 +1,122 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+	"github.com/jirenius/go-res/store"
+	"github.com/jirenius/go-res/store/mockstore"
+)
+
+type privateUser struct {
+	privateAudit
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	PasswordHash string `json:"passwordHash" res:"private"`
+}
+
+type privateAudit struct {
+	CreatedBy string `json:"createdBy" res:"private"`
+	Note      string `json:"note"`
+}
+
+var privateUserValue = privateUser{
+	privateAudit: privateAudit{CreatedBy: "admin", Note: "new"},
+	ID:           42,
+	Name:         "Jane",
+	PasswordHash: "secret",
+}
+
+// Test that PublicModel excludes private fields, including those of embedded
+// structs.
+func TestPublicModel_WithPrivateFields_ExcludesPrivateFields(t *testing.T) {
+	restest.AssertEqualJSON(t, "public model", res.PublicModel(privateUserValue), json.RawMessage(`{"id":42,"name":"Jane","note":"new"}`))
+	restest.AssertEqualJSON(t, "public model", res.PublicModel(&privateUserValue), json.RawMessage(`{"id":42,"name":"Jane","note":"new"}`))
+}
+
+// Test that PublicModel returns values without private fields as is.
+func TestPublicModel_WithoutPrivateFields_ReturnsModel(t *testing.T) {
+	restest.AssertTrue(t, "model to be returned as is", res.PublicModel(mock.Model) == mock.Model)
+	restest.AssertTrue(t, "nil to be returned", res.PublicModel(nil) == nil)
+	var p *privateUser
+	restest.AssertTrue(t, "nil pointer to be returned as is", res.PublicModel(p) == p)
+}
+
+// Test that model get responses exclude private fields.
+func TestPrivateFields_GetModel_ExcludesPrivateFields(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.Model(&privateUserValue)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"id":42,"name":"Jane","note":"new"}`))
+	})
+}
+
+// Test that private fields are excluded from versioned model get responses.
+func TestPrivateFields_GetVersionedModel_ExcludesPrivateFields(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.Versioned("version"), res.GetModel(func(r res.ModelRequest) {
+			r.Model(privateUserValue)
+		}))
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"version":0,"id":42,"name":"Jane","note":"new"}`))
+	})
+}
+
+// Test that DiffModel ignores changes to private fields.
+func TestPrivateFields_DiffModel_IgnoresPrivateFields(t *testing.T) {
+	after := privateUserValue
+	after.PasswordHash = "changed"
+	after.CreatedBy = "changed"
+	after.Name = "John"
+	ch, err := res.DiffModel(privateUserValue, after)
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "changes", ch, json.RawMessage(`{"name":"John"}`))
+}
+
+// Test that ChangeValues ignores private fields, and that ApplyModelChange
+// does not allow changing them.
+func TestPrivateFields_ChangeValuesAndApply_IgnorePrivateFields(t *testing.T) {
+	ch, err := res.ChangeValues(privateUserValue)
+	restest.AssertNoError(t, err)
+	restest.AssertEqualJSON(t, "changes", ch, json.RawMessage(`{"id":42,"name":"Jane","note":"new"}`))
+	u := privateUserValue
+	_, err = res.ApplyModelChange(&u, map[string]interface{}{"passwordHash": "changed"})
+	restest.AssertTrue(t, "error applying change to private field", err != nil)
+	restest.AssertEqualJSON(t, "password hash", u.PasswordHash, "secret")
+}
+
+// Test that a store handler excludes private fields from get responses and
+// change events, while the store keeps them.
+func TestPrivateFields_StoreHandler_ExcludesPrivateFields(t *testing.T) {
+	st := mockstore.NewStore().Add("test.model", privateUserValue)
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Model,
+			store.Handler{}.WithStore(st),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").
+			Response().
+			AssertModel(json.RawMessage(`{"id":42,"name":"Jane","note":"new"}`))
+		updated := privateUserValue
+		updated.PasswordHash = "changed"
+		updated.Name = "John"
+		func() {
+			txn := st.Write("test.model")
+			defer txn.Close()
+			restest.AssertNoError(t, txn.Update(updated))
+		}()
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"name":"John"}`))
+		v, err := st.Read("test.model").Value()
+		restest.AssertNoError(t, err)
+		restest.AssertEqualJSON(t, "stored password hash", v.(privateUser).PasswordHash, "changed")
+	})
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that handlers, listeners, and muxes cannot be added to a frozen mux,
+// or to a mux mounted to it.
+func TestMuxFreeze_AddAfterFreeze_Panics(t *testing.T) {
+	m := res.NewMux("test")
+	sub := res.NewMux("")
+	sub.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	m.Mount("sub", sub)
+	m.Freeze()
+	restest.AssertPanic(t, func() { m.Handle("model", res.GetResource(func(r res.GetRequest) {})) })
+	restest.AssertPanic(t, func() { sub.Handle("other", res.GetResource(func(r res.GetRequest) {})) })
+	restest.AssertPanic(t, func() { sub.AddListener("model", func(ev *res.Event) {}) })
+	restest.AssertPanic(t, func() { m.Mount("other", res.NewMux("")) })
+	restest.AssertTrue(t, "registered handler to be found", m.GetHandler("test.sub.model") != nil)
+}
+
+// Test that freezing a mounted mux does not freeze the mux it is mounted to.
+func TestMuxFreeze_FreezeMountedMux_ParentNotFrozen(t *testing.T) {
+	m := res.NewMux("test")
+	sub := res.NewMux("")
+	m.Mount("sub", sub)
+	sub.Freeze()
+	restest.AssertPanic(t, func() { sub.Handle("model", res.GetResource(func(r res.GetRequest) {})) })
+	m.Handle("model", res.GetResource(func(r res.GetRequest) {}))
+	restest.AssertTrue(t, "handler to be found", m.GetHandler("test.model") != nil)
+}
+
+// Test that adding a handler to a started service panics.
+func TestMuxFreeze_HandleAfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() { s.Service().Handle("other", res.GetResource(func(r res.GetRequest) {})) })
+	})
+}
+
+// Test that mounting a mux to itself, or to a mux mounted to it, panics.
+func TestMux_MountToItself_Panics(t *testing.T) {
+	m := res.NewMux("")
+	sub := res.NewMux("")
+	m.Mount("sub", sub)
+	restest.AssertPanic(t, func() { m.Mount("self", m) })
+	restest.AssertPanic(t, func() { sub.Mount("parent", m) })
+}
+
+// Test that handlers, listeners, and muxes may be added concurrently.
+func TestMux_ConcurrentRegistration_RegistersAll(t *testing.T) {
+	const count = 20
+	m := res.NewMux("test")
+	sub := res.NewMux("")
+	var wg sync.WaitGroup
+	wg.Add(count * 3)
+	for i := 0; i < count; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			m.Handle(fmt.Sprintf("model.%d", i), res.GetResource(func(r res.GetRequest) {}))
+			m.AddListener(fmt.Sprintf("model.%d", i), func(ev *res.Event) {})
+		}()
+		go func() {
+			defer wg.Done()
+			sub.Handle(fmt.Sprintf("model.%d", i), res.GetResource(func(r res.GetRequest) {}))
+		}()
+		go func() {
+			defer wg.Done()
+			m.Mount(fmt.Sprintf("mounted.%d", i), res.NewMux(""))
+		}()
+	}
+	m.Mount("sub", sub)
+	wg.Wait()
+	for i := 0; i < count; i++ {
+		restest.AssertTrue(t, "handler to be found", m.GetHandler(fmt.Sprintf("test.model.%d", i)) != nil)
+		restest.AssertTrue(t, "handler to have a listener", len(m.GetHandler(fmt.Sprintf("test.model.%d", i)).Listeners) == 1)
+		restest.AssertTrue(t, "mounted handler to be found", m.GetHandler(fmt.Sprintf("test.sub.model.%d", i)) != nil)
+	}
+	restest.AssertNoError(t, m.ValidateListeners())
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/logger"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that Info returns the service name, version, protocol version, and
+// number of registered patterns.
+func TestInfo_WithVersion_ReturnsInfo(t *testing.T) {
+	s := res.NewService("test").SetVersion("1.2.0")
+	s.Handle("model", res.GetResource(func(r res.GetRequest) {}))
+	s.Handle("collection", res.GetResource(func(r res.GetRequest) {}))
+	restest.AssertEqualJSON(t, "version", s.Version(), "1.2.0")
+	restest.AssertEqualJSON(t, "info", s.Info(), res.ServiceInfo{
+		Name:     "test",
+		Version:  "1.2.0",
+		Protocol: s.ProtocolVersion(),
+		Patterns: 2,
+	})
+}
+
+// Test that HandleInfo registers a model resource with the service information.
+func TestHandleInfo_GetInfo_ReturnsInfoModel(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.SetVersion("1.2.0")
+		s.Handle("model", res.GetResource(func(r res.GetRequest) {}))
+		s.HandleInfo("system.info", res.Access(res.AccessGranted))
+	}, func(s *restest.Session) {
+		s.Get("test.system.info").
+			Response().
+			AssertModel(json.RawMessage(`{"name":"test","version":"1.2.0","protocol":"` + s.Service().ProtocolVersion() + `","patterns":2}`))
+		s.Access("test.system.info", nil).
+			Response().
+			AssertAccess(true, "*")
+	})
+}
+
+// Test that the version is logged when the service starts.
+func TestSetVersion_Start_LogsVersion(t *testing.T) {
+	l := logger.NewMemLogger()
+	runTest(t, func(s *res.Service) {
+		s.SetLogger(l)
+		s.SetVersion("1.2.0")
+		s.Handle("model", res.GetResource(func(r res.GetRequest) {}))
+	}, func(s *restest.Session) {
+		log := l.String()
+		restest.AssertTrue(t, "log to contain version", strings.Contains(log, "Starting service version 1.2.0"), log)
+	}, restest.WithKeepLogger)
+}
+
+// Test that SetVersion panics if the service is started.
+func TestSetVersion_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) {}))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() { s.Service().SetVersion("1.2.0") })
+	})
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+type connRoleKey struct{}
+
+// Test that a connection value set on an auth request is read on later
+// access and call requests from the same connection only.
+func TestConnectionValue_SetOnAuth_ReadOnAccessAndCall(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Auth("login", func(r res.AuthRequest) {
+				r.SetConnectionValue(connRoleKey{}, "admin")
+				r.OK(nil)
+			}),
+			res.Access(func(r res.AccessRequest) {
+				if r.ConnectionValue(connRoleKey{}) == "admin" {
+					r.AccessGranted()
+				} else {
+					r.AccessDenied()
+				}
+			}),
+			res.Call("role", func(r res.CallRequest) {
+				r.OK(r.ConnectionValue(connRoleKey{}))
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Auth("test.model", "login", &restest.Request{CID: "cid1"}).
+			Response().
+			AssertResult(nil)
+		s.Access("test.model", &restest.Request{CID: "cid1"}).
+			Response().
+			AssertAccess(true, "*")
+		s.Access("test.model", &restest.Request{CID: "cid2"}).
+			Response().
+			AssertError(res.ErrAccessDenied)
+		s.Call("test.model", "role", &restest.Request{CID: "cid1"}).
+			Response().
+			AssertResult("admin")
+		s.Call("test.model", "role", &restest.Request{CID: "cid2"}).
+			Response().
+			AssertResult(nil)
+	})
+}
+
+// Test that connection values expire once the TTL has passed since they were
+// last set or read.
+func TestConnectionValue_TTLPassed_ValuesExpire(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	s := res.NewService("test").SetClock(clock).SetConnectionValueTTL(time.Minute)
+	s.SetConnectionValue("cid1", "foo", 42)
+	clock.Add(40 * time.Second)
+	restest.AssertEqualJSON(t, "value", s.ConnectionValue("cid1", "foo"), 42)
+	clock.Add(40 * time.Second)
+	restest.AssertEqualJSON(t, "value", s.ConnectionValue("cid1", "foo"), 42)
+	clock.Add(time.Minute)
+	restest.AssertEqualJSON(t, "value", s.ConnectionValue("cid1", "foo"), nil)
+	restest.AssertEqualJSON(t, "pending timers", clock.Timers(), 0)
+}
+
+// Test that ClearConnectionValues deletes all values of the connection, and
+// that setting a nil value deletes the key.
+func TestConnectionValue_Clear_DeletesValues(t *testing.T) {
+	s := res.NewService("test")
+	s.SetConnectionValue("cid1", "foo", 42)
+	s.SetConnectionValue("cid1", "bar", "baz")
+	s.SetConnectionValue("cid2", "foo", 7)
+	s.SetConnectionValue("cid1", "bar", nil)
+	restest.AssertEqualJSON(t, "deleted value", s.ConnectionValue("cid1", "bar"), nil)
+	s.ClearConnectionValues("cid1")
+	restest.AssertEqualJSON(t, "cleared value", s.ConnectionValue("cid1", "foo"), nil)
+	restest.AssertEqualJSON(t, "other connection value", s.ConnectionValue("cid2", "foo"), 7)
+}
+
+// Test that SetConnectionValue panics on an invalid connection ID, and that
+// SetConnectionValueTTL panics on an invalid duration.
+func TestConnectionValue_InvalidUse_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.NewService("test").SetConnectionValue("invalid.cid", "foo", 42) })
+	restest.AssertPanic(t, func() { res.NewService("test").SetConnectionValueTTL(0) })
+}
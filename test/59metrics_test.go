@@ -0,0 +1,60 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that Stats counts responses, error responses, and events.
+func TestStats_RequestsAndEvents_Counted(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response()
+		s.Call("test.model", "method", nil).Response()
+		s.Call("test.model", "missing", nil).Response()
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.ChangeEvent(map[string]interface{}{"foo": 1})
+		}))
+		s.GetMsg().AssertChangeEvent("test.model", json.RawMessage(`{"foo":1}`))
+		st := s.Service().Stats()
+		restest.AssertEqualJSON(t, "requests", st.Requests, 3)
+		restest.AssertEqualJSON(t, "errors", st.Errors, 1)
+		// Initial system reset and change event
+		restest.AssertEqualJSON(t, "events", st.Events, 2)
+	})
+}
+
+// Test that the metrics resource is updated with a change event at the end of
+// each interval.
+func TestHandleMetrics_IntervalPassed_SendsChangeEvent(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.HandleMetrics("system.metrics", time.Second)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) { r.OK(nil) }))
+	}, func(s *restest.Session) {
+		s.Get("test.system.metrics").
+			Response().
+			AssertModel(json.RawMessage(`{"requests":0,"errors":0,"events":0,"queryRequests":0,"reusedQueryResponses":0,"shadowRequests":0,"shadowMismatches":0,"queuedWork":0,"queuedListeners":0,"queuedQueries":0,"requestRate":0,"errorRate":0,"eventRate":0}`))
+		s.Call("test.model", "method", nil).Response()
+		s.Call("test.model", "missing", nil).Response()
+		clock.Add(time.Second)
+		s.GetMsg().AssertChangeEvent("test.system.metrics", json.RawMessage(`{"requests":3,"errors":1,"events":1,"requestRate":3,"errorRate":0.3333333333333333}`))
+		clock.Add(time.Second)
+		s.GetMsg().AssertChangeEvent("test.system.metrics", json.RawMessage(`{"events":2,"requestRate":0,"errorRate":0,"eventRate":1}`))
+	})
+}
+
+// Test that HandleMetrics panics on invalid arguments.
+func TestHandleMetrics_InvalidArguments_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.NewService("test").HandleMetrics("system.$id", time.Second) })
+	restest.AssertPanic(t, func() { res.NewService("test").HandleMetrics("system.metrics", 0) })
+}
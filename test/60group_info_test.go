@@ -0,0 +1,63 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that Groups reports the group expression and mode of each pattern,
+// flagging patterns sharing groups.
+func TestGroups_RegisteredHandlers_ReturnsGroupInfo(t *testing.T) {
+	m := res.NewMux("test")
+	get := res.GetResource(func(r res.GetRequest) {})
+	m.Handle("user.$id", get)
+	m.Handle("user.$id.settings", get, res.Group("test.user.${id}"))
+	m.Handle("profile.$pid", get, res.Group("${pid}"))
+	m.Handle("config", get, res.Group("global"))
+	m.Handle("log.>", get, res.Group("global"))
+	m.Handle("search", get, res.Parallel(true))
+	m.Route("sub", func(sub *res.Mux) {
+		sub.Handle("item.$id", get, res.Group("item.${id}"))
+	})
+
+	restest.AssertEqualJSON(t, "groups", m.Groups(), []res.GroupInfo{
+		{Pattern: "test.config", Group: "global", Mode: res.GroupSingle, Shared: []res.Pattern{"test.log.>", "test.profile.$pid"}},
+		{Pattern: "test.log.>", Group: "global", Mode: res.GroupSingle, Shared: []res.Pattern{"test.config", "test.profile.$pid"}},
+		{Pattern: "test.profile.$pid", Group: "${pid}", Mode: res.GroupByExpression, Shared: []res.Pattern{"test.config", "test.log.>"}},
+		{Pattern: "test.search", Mode: res.GroupParallel},
+		{Pattern: "test.sub.item.$id", Group: "item.${id}", Mode: res.GroupByExpression},
+		{Pattern: "test.user.$id", Group: "test.user.${id}", Mode: res.GroupPerResource, Shared: []res.Pattern{"test.user.$id.settings"}},
+		{Pattern: "test.user.$id.settings", Group: "test.user.${id}", Mode: res.GroupByExpression, Shared: []res.Pattern{"test.user.$id"}},
+	})
+}
+
+// Test that groups with placeholders that cannot contain dots do not share
+// groups with expressions requiring dots.
+func TestGroups_PlaceholderAndDottedGroup_NotShared(t *testing.T) {
+	m := res.NewMux("")
+	get := res.GetResource(func(r res.GetRequest) {})
+	m.Handle("a.$id", get, res.Group("${id}"))
+	m.Handle("b", get, res.Group("x.y"))
+	for _, gi := range m.Groups() {
+		restest.AssertTrue(t, "no shared groups", len(gi.Shared) == 0, gi)
+	}
+}
+
+// Test that WriteGroups writes a row for each pattern.
+func TestWriteGroups_RegisteredHandlers_WritesTable(t *testing.T) {
+	m := res.NewMux("test")
+	get := res.GetResource(func(r res.GetRequest) {})
+	m.Handle("model", get, res.Group("shared"))
+	m.Handle("collection", get, res.Group("shared"))
+	var b bytes.Buffer
+	restest.AssertNoError(t, m.WriteGroups(&b))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	restest.AssertEqualJSON(t, "lines", len(lines), 3)
+	restest.AssertTrue(t, "header", strings.HasPrefix(lines[0], "PATTERN"), lines[0])
+	restest.AssertTrue(t, "collection row", strings.Contains(lines[1], "test.collection") && strings.HasSuffix(lines[1], "test.model"), lines[1])
+	restest.AssertTrue(t, "model row", strings.Contains(lines[2], "single") && strings.HasSuffix(lines[2], "test.collection"), lines[2])
+}
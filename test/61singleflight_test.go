@@ -0,0 +1,134 @@
+package test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that identical get requests, arriving while the first one waits to be
+// handled, share a single handler call and response.
+func TestSingleflight_IdenticalGetRequests_CallsHandlerOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Singleflight(),
+			res.GetModel(func(r res.ModelRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Model(mock.Model)
+			}),
+		)
+	}, func(s *restest.Session) {
+		// Block the resource's worker goroutine
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		reqs := restest.NATSRequests{
+			s.Get("test.model"),
+			s.Get("test.model"),
+			s.Get("test.model"),
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		for i := len(reqs); i > 0; i-- {
+			reqs.
+				Response(s.MockConn).
+				AssertModel(mock.Model)
+		}
+		restest.AssertTrue(t, "handler to be called once", atomic.LoadInt32(&calls) == 1)
+	})
+}
+
+// Test that get requests with different queries do not share a response.
+func TestSingleflight_DifferentQueries_CallsHandlerForEach(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Singleflight(),
+			res.GetModel(func(r res.ModelRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Model(mock.Model)
+			}),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		reqs := restest.NATSRequests{
+			s.Get("test.model?q=foo"),
+			s.Get("test.model?q=bar"),
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		for i := len(reqs); i > 0; i-- {
+			reqs.Response(s.MockConn)
+		}
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+	})
+}
+
+// Test that an error response is shared by the identical get requests.
+func TestSingleflight_ErrorResponse_SharesError(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Singleflight(),
+			res.GetModel(func(r res.ModelRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.NotFound()
+			}),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		reqs := restest.NATSRequests{
+			s.Get("test.model"),
+			s.Get("test.model"),
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		for i := len(reqs); i > 0; i-- {
+			reqs.
+				Response(s.MockConn).
+				AssertError(res.ErrNotFound)
+		}
+		restest.AssertTrue(t, "handler to be called once", atomic.LoadInt32(&calls) == 1)
+	})
+}
+
+// Test that identical get requests for a handler without Singleflight each
+// call the handler.
+func TestSingleflight_NotSet_CallsHandlerForEach(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) {
+				atomic.AddInt32(&calls, 1)
+				r.Model(mock.Model)
+			}),
+		)
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		reqs := restest.NATSRequests{
+			s.Get("test.model"),
+			s.Get("test.model"),
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+		close(release)
+		for i := len(reqs); i > 0; i-- {
+			reqs.
+				Response(s.MockConn).
+				AssertModel(mock.Model)
+		}
+		restest.AssertTrue(t, "handler to be called twice", atomic.LoadInt32(&calls) == 2)
+	})
+}
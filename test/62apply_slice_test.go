@@ -0,0 +1,127 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// applySliceHandlers returns ApplyAddSlice and ApplyRemoveSlice options
+// storing the collection in items.
+func applySliceHandlers(items *[]string) []res.Option {
+	get := func(r res.Resource) ([]string, error) { return *items, nil }
+	set := func(r res.Resource, v []string) error { *items = v; return nil }
+	return []res.Option{
+		res.ApplyAddSlice(get, set),
+		res.ApplyRemoveSlice(get, set),
+	}
+}
+
+// Test that ApplyAddSlice inserts the value at the event index.
+func TestApplyAddSlice_AddEvent_InsertsValue(t *testing.T) {
+	tbl := []struct {
+		Value    interface{}
+		Idx      int
+		Expected []string
+	}{
+		{"foo", 0, []string{"foo", "a", "b"}},
+		{"foo", 1, []string{"a", "foo", "b"}},
+		{"foo", 2, []string{"a", "b", "foo"}},
+		{json.RawMessage(`"foo"`), 1, []string{"a", "foo", "b"}},
+	}
+	for _, l := range tbl {
+		items := []string{"a", "b"}
+		runTest(t, func(s *res.Service) {
+			s.Handle("collection", append(applySliceHandlers(&items),
+				res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+				res.Call("method", func(r res.CallRequest) {
+					r.AddEvent(l.Value, l.Idx)
+					r.OK(nil)
+				}),
+			)...)
+		}, func(s *restest.Session) {
+			req := s.Call("test.collection", "method", nil)
+			s.GetMsg().AssertEventName("test.collection", "add")
+			req.Response().AssertResult(nil)
+			restest.AssertEqualJSON(t, "items", items, l.Expected)
+		})
+	}
+}
+
+// Test that ApplyAddSlice responds with an error for an index out of range,
+// without changing the collection.
+func TestApplyAddSlice_IndexOutOfRange_RespondsWithError(t *testing.T) {
+	items := []string{"a", "b"}
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", append(applySliceHandlers(&items),
+			res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+			res.Call("method", func(r res.CallRequest) {
+				r.AddEvent("foo", 3)
+				r.OK(nil)
+			}),
+		)...)
+	}, func(s *restest.Session) {
+		s.Call("test.collection", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+		restest.AssertEqualJSON(t, "items", items, []string{"a", "b"})
+	})
+}
+
+// Test that ApplyRemoveSlice removes the value at the event index, passing it
+// to the event listeners.
+func TestApplyRemoveSlice_RemoveEvent_RemovesValue(t *testing.T) {
+	tbl := []struct {
+		Idx      int
+		Removed  string
+		Expected []string
+	}{
+		{0, "a", []string{"b", "c"}},
+		{1, "b", []string{"a", "c"}},
+		{2, "c", []string{"a", "b"}},
+	}
+	for _, l := range tbl {
+		items := []string{"a", "b", "c"}
+		var removed interface{}
+		runTest(t, func(s *res.Service) {
+			s.Handle("collection", append(applySliceHandlers(&items),
+				res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+				res.Call("method", func(r res.CallRequest) {
+					r.RemoveEvent(l.Idx)
+					r.OK(nil)
+				}),
+			)...)
+			s.AddListener("collection", func(ev *res.Event) {
+				removed = ev.Value
+			})
+		}, func(s *restest.Session) {
+			req := s.Call("test.collection", "method", nil)
+			s.GetMsg().AssertEventName("test.collection", "remove")
+			req.Response().AssertResult(nil)
+			restest.AssertEqualJSON(t, "items", items, l.Expected)
+			restest.AssertEqualJSON(t, "removed", removed, l.Removed)
+		})
+	}
+}
+
+// Test that ApplyRemoveSlice responds with an error for an index out of
+// range.
+func TestApplyRemoveSlice_IndexOutOfRange_RespondsWithError(t *testing.T) {
+	items := []string{"a", "b"}
+	runTest(t, func(s *res.Service) {
+		s.Handle("collection", append(applySliceHandlers(&items),
+			res.GetCollection(func(r res.CollectionRequest) { r.NotFound() }),
+			res.Call("method", func(r res.CallRequest) {
+				r.RemoveEvent(2)
+				r.OK(nil)
+			}),
+		)...)
+	}, func(s *restest.Session) {
+		s.Call("test.collection", "method", nil).
+			Response().
+			AssertErrorCode(res.CodeInternalError)
+		restest.AssertEqualJSON(t, "items", items, []string{"a", "b"})
+	})
+}
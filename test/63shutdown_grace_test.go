@@ -0,0 +1,158 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that events sent by work in progress when shutting down are published
+// before the connection is closed.
+func TestShutdownGracePeriod_WorkInProgress_PublishesEvent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			close(started)
+			<-release
+			r.Event("custom", mock.Result)
+			// Keep the work in progress until the event is received
+			<-received
+		}))
+		<-started
+		stopped := make(chan error)
+		go func() { stopped <- s.Service().Shutdown() }()
+		time.Sleep(timeoutDuration / 10)
+		close(release)
+		s.GetMsg().AssertEventName("test.model", "custom")
+		close(received)
+		select {
+		case err := <-stopped:
+			restest.AssertNoError(t, err)
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected service to stop")
+		}
+	})
+}
+
+// Test that events sent once the connection is closed are reported as errors
+// with the resource name, instead of being published.
+func TestShutdownGracePeriod_EventAfterClose_ReportsError(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	errCh := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetShutdownGracePeriod(0)
+		s.SetOnError(func(_ *res.Service, msg string) {
+			errCh <- msg
+		})
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			close(started)
+			<-release
+			r.Event("custom", mock.Result)
+		}))
+		<-started
+		stopped := make(chan error)
+		go func() { stopped <- s.Service().Shutdown() }()
+		time.Sleep(timeoutDuration / 10)
+		close(release)
+		select {
+		case msg := <-errCh:
+			restest.AssertTrue(t, "error to contain resource name", strings.Contains(msg, "test.model"))
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected event to be reported as error")
+		}
+		select {
+		case err := <-stopped:
+			restest.AssertNoError(t, err)
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected service to stop")
+		}
+	})
+}
+
+// Test that requests queued behind work in progress when shutting down are
+// handled and responded to before the connection is closed.
+func TestShutdownGracePeriod_QueuedRequest_IsHandled(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			r.Model(mock.Model)
+			// Keep the work in progress until the response is received
+			<-received
+		}))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			close(started)
+			<-release
+		}))
+		<-started
+		req := s.Get("test.model")
+		stopped := make(chan error)
+		go func() { stopped <- s.Service().Shutdown() }()
+		time.Sleep(timeoutDuration / 10)
+		close(release)
+		req.Response().AssertModel(mock.Model)
+		close(received)
+		select {
+		case err := <-stopped:
+			restest.AssertNoError(t, err)
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected service to stop")
+		}
+	})
+}
+
+// Test that the shutdown grace period expires when a mock clock is used.
+func TestShutdownGracePeriod_WithMockClock_Expires(t *testing.T) {
+	release := make(chan struct{})
+	errCh := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetClock(restest.NewMockClock(time.Time{}))
+		s.SetShutdownGracePeriod(timeoutDuration / 10)
+		s.SetOnError(func(_ *res.Service, msg string) {
+			errCh <- msg
+		})
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		stopped := make(chan error)
+		go func() { stopped <- s.Service().Shutdown() }()
+		select {
+		case msg := <-errCh:
+			restest.AssertTrue(t, "error to mention grace period", strings.Contains(msg, "grace period"))
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected shutdown grace period to expire")
+		}
+		close(release)
+		select {
+		case err := <-stopped:
+			restest.AssertNoError(t, err)
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected service to stop")
+		}
+	})
+}
+
+// Test that SetShutdownGracePeriod panics if the service is started.
+func TestSetShutdownGracePeriod_AfterStart_CausesPanic(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetResource(func(r res.GetRequest) { r.NotFound() }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() {
+			s.Service().SetShutdownGracePeriod(time.Second)
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that a call request without a reply subject is handled, without
+// sending a response, when fire-and-forget calls are allowed.
+func TestFireAndForgetCalls_CallWithoutReply_CallsHandler(t *testing.T) {
+	called := make(chan interface{}, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetFireAndForgetCalls(true)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			var p interface{}
+			r.ParseParams(&p)
+			called <- p
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.SendMessage("call.test.model.method", "", []byte(`{"params":{"foo":"bar"}}`))
+		select {
+		case p := <-called:
+			restest.AssertEqualJSON(t, "params", p, map[string]interface{}{"foo": "bar"})
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected call handler to be called")
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a fire-and-forget call handler may return without responding.
+func TestFireAndForgetCalls_NoResponse_SendsNoMessage(t *testing.T) {
+	called := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetFireAndForgetCalls(true)
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			r.Timeout(timeoutDuration)
+			close(called)
+		}))
+	}, func(s *restest.Session) {
+		s.SendMessage("call.test.model.method", "", nil)
+		select {
+		case <-called:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected call handler to be called")
+		}
+		s.AssertNoMsg(timeoutDuration / 10)
+	})
+}
+
+// Test that a call request without a reply subject is reported as an error,
+// without calling the handler, by default.
+func TestFireAndForgetCalls_NotSet_ReportsError(t *testing.T) {
+	errCh := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetOnError(func(_ *res.Service, msg string) {
+			errCh <- msg
+		})
+		s.Handle("model", res.Call("method", func(r res.CallRequest) {
+			t.Error("expected call handler not to be called")
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		s.SendMessage("call.test.model.method", "", nil)
+		select {
+		case msg := <-errCh:
+			restest.AssertEqualJSON(t, "error", msg, "Missing reply subject on request: call.test.model.method")
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected error to be reported")
+		}
+	})
+}
+
+// Test that get requests without a reply subject are reported as errors,
+// also when fire-and-forget calls are allowed.
+func TestFireAndForgetCalls_GetWithoutReply_ReportsError(t *testing.T) {
+	errCh := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetFireAndForgetCalls(true)
+		s.SetOnError(func(_ *res.Service, msg string) {
+			errCh <- msg
+		})
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) {
+			t.Error("expected get handler not to be called")
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		s.SendMessage("get.test.model", "", nil)
+		select {
+		case msg := <-errCh:
+			restest.AssertEqualJSON(t, "error", msg, "Missing reply subject on request: get.test.model")
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected error to be reported")
+		}
+	})
+}
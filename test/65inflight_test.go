@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that InFlight returns nil when in-flight tracking is not enabled.
+func TestInFlight_NotEnabled_ReturnsNil(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }))
+	}, func(s *restest.Session) {
+		restest.AssertTrue(t, "InFlight to return nil", s.Service().InFlight() == nil)
+	})
+}
+
+// Test that InFlight lists a request while its handler is executing, and that
+// it is removed once the handler returns.
+func TestInFlight_WithBlockingHandler_ListsRequest(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetInFlightTracking(true)
+		s.Handle("model.$id", res.Call("method", func(r res.CallRequest) {
+			close(started)
+			<-release
+			r.OK(nil)
+		}))
+	}, func(s *restest.Session) {
+		req := s.Call("test.model.42", "method", nil)
+		<-started
+		list := s.Service().InFlight()
+		restest.AssertEqualJSON(t, "in-flight count", len(list), 1)
+		ifr := list[0]
+		restest.AssertEqualJSON(t, "Group", ifr.Group, "test.model.42")
+		restest.AssertEqualJSON(t, "Pattern", ifr.Pattern, "test.model.$id")
+		restest.AssertEqualJSON(t, "ResourceName", ifr.ResourceName, "test.model.42")
+		restest.AssertEqualJSON(t, "Type", ifr.Type, "call")
+		restest.AssertEqualJSON(t, "Method", ifr.Method, "method")
+		restest.AssertTrue(t, "Started to be set", !ifr.Started.IsZero())
+
+		var buf bytes.Buffer
+		restest.AssertNoError(t, s.Service().WriteInFlight(&buf))
+		out := buf.String()
+		restest.AssertTrue(t, "WriteInFlight to write header", strings.HasPrefix(out, "GROUP"))
+		restest.AssertTrue(t, "WriteInFlight to write pattern", strings.Contains(out, "test.model.$id"))
+
+		close(release)
+		req.Response().AssertResult(nil)
+		// The request is removed after the response is sent
+		deadline := time.Now().Add(timeoutDuration)
+		for len(s.Service().InFlight()) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expected in-flight request to be removed")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+// Test that handler executions are tagged with pprof labels when enabled.
+func TestSetPprofLabels_WithBlockingHandler_SetsLabels(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	labels := make(chan map[string]string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetPprofLabels(true)
+		s.Handle("model.$id", res.GetModel(func(r res.ModelRequest) {
+			close(started)
+			<-release
+			r.Model(mock.Model)
+		}))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().With("test.model.42", func(r res.Resource) {
+			m := make(map[string]string)
+			pprof.ForLabels(context.Background(), func(key, value string) bool {
+				m[key] = value
+				return true
+			})
+			labels <- m
+		}))
+		restest.AssertEqualJSON(t, "labels without request", <-labels, map[string]string{})
+
+		req := s.Get("test.model.42")
+		<-started
+		var buf bytes.Buffer
+		restest.AssertNoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+		restest.AssertTrue(t, "goroutine profile to contain pattern label", strings.Contains(buf.String(), `"res.pattern":"test.model.$id"`))
+		restest.AssertTrue(t, "goroutine profile to contain type label", strings.Contains(buf.String(), `"res.type":"get"`))
+		close(release)
+		req.Response().AssertModel(mock.Model)
+	})
+}
+
+// Test that SetPprofLabels and SetInFlightTracking panics when called after
+// the service has started.
+func TestInFlightSetters_AfterStart_Panics(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }))
+	}, func(s *restest.Session) {
+		restest.AssertPanic(t, func() { s.Service().SetPprofLabels(true) })
+		restest.AssertPanic(t, func() { s.Service().SetInFlightTracking(true) })
+	})
+}
+
+// Test that InFlight lists the handler pattern, and not the resource name, for
+// a handler replaced with SwapHandler.
+func TestInFlight_AfterSwapHandler_ListsPattern(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.SetInFlightTracking(true)
+		s.Handle("model.$id", res.Call("method", func(r res.CallRequest) { r.OK(nil) }))
+	}, func(s *restest.Session) {
+		restest.AssertNoError(t, s.Service().SwapHandler("model.$id", res.Handler{
+			Call: map[string]res.CallHandler{
+				"method": func(r res.CallRequest) {
+					close(started)
+					<-release
+					r.OK(nil)
+				},
+			},
+		}))
+		s.GetMsg().AssertSystemReset([]string{"test.model.*"}, []string{"test.model.*"})
+		req := s.Call("test.model.42", "method", nil)
+		<-started
+		list := s.Service().InFlight()
+		restest.AssertEqualJSON(t, "in-flight count", len(list), 1)
+		restest.AssertEqualJSON(t, "Pattern", list[0].Pattern, "test.model.$id")
+		close(release)
+		req.Response().AssertResult(nil)
+	})
+}
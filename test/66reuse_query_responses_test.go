@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// queryCallCounter counts query event callback calls by query.
+type queryCallCounter struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func (c *queryCallCounter) inc(q string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]int)
+	}
+	c.m[q]++
+}
+
+func (c *queryCallCounter) counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m
+}
+
+// reuseQueryResponsesHandler returns a handler for a model resource sending
+// a query event on calls to method, with a callback responding with the
+// query.
+func reuseQueryResponsesHandler(c *queryCallCounter, reuse bool) []res.Option {
+	return []res.Option{
+		res.ReuseQueryResponses(reuse),
+		res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+		res.Call("method", func(r res.CallRequest) {
+			r.QueryEvent(func(qr res.QueryRequest) {
+				if qr == nil {
+					return
+				}
+				c.inc(qr.Query())
+				qr.ChangeEvent(map[string]interface{}{"query": qr.Query()})
+			})
+			r.OK(nil)
+		}),
+	}
+}
+
+// Test that query requests with the same query, for a handler with
+// ReuseQueryResponses set, call the query event callback once and get the
+// same response.
+func TestReuseQueryResponses_SameQuery_CallsCallbackOnce(t *testing.T) {
+	var c queryCallCounter
+	release := make(chan struct{})
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", reuseQueryResponsesHandler(&c, true)...)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		// Block the resource's worker goroutine while query requests arrive
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			<-release
+		}))
+		reqs := restest.NATSRequests{
+			s.QueryRequest(subj, "q=foo"),
+			s.QueryRequest(subj, "q=bar"),
+			s.QueryRequest(subj, "q=foo"),
+		}
+		close(release)
+		// Responses are sent grouped by query, in undetermined order
+		results := make(map[string]int)
+		for i := 0; i < len(reqs); i++ {
+			results[string(reqs.Response(s.MockConn).Data)]++
+		}
+		restest.AssertEqualJSON(t, "responses", results, map[string]int{
+			`{"result":{"events":[{"event":"change","data":{"values":{"query":"q=foo"}}}]}}`: 2,
+			`{"result":{"events":[{"event":"change","data":{"values":{"query":"q=bar"}}}]}}`: 1,
+		})
+		// A later query request reuses the response
+		s.QueryRequest(subj, "q=bar").
+			Response().
+			AssertResult(json.RawMessage(`{"events":[{"event":"change","data":{"values":{"query":"q=bar"}}}]}`))
+
+		restest.AssertEqualJSON(t, "callback calls", c.counts(), map[string]int{"q=foo": 1, "q=bar": 1})
+		st := s.Service().Stats()
+		restest.AssertEqualJSON(t, "QueryRequests", st.QueryRequests, 4)
+		restest.AssertEqualJSON(t, "ReusedQueryResponses", st.ReusedQueryResponses, 2)
+	}, restest.WithGnatsd)
+}
+
+// Test that an error response to a query request, for a handler with
+// ReuseQueryResponses set, is reused for query requests with the same query.
+func TestReuseQueryResponses_ErrorResponse_ReusesError(t *testing.T) {
+	var c queryCallCounter
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.ReuseQueryResponses(true),
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.Call("method", func(r res.CallRequest) {
+				r.QueryEvent(func(qr res.QueryRequest) {
+					if qr == nil {
+						return
+					}
+					c.inc(qr.Query())
+					qr.InvalidQuery("")
+				})
+				r.OK(nil)
+			}),
+		)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		s.QueryRequest(subj, mock.Query).Response().AssertError(res.ErrInvalidQuery)
+		s.QueryRequest(subj, mock.Query).Response().AssertError(res.ErrInvalidQuery)
+		restest.AssertEqualJSON(t, "callback calls", c.counts(), map[string]int{mock.Query: 1})
+	}, restest.WithGnatsd)
+}
+
+// Test that query requests with the same query, for a handler without
+// ReuseQueryResponses set, call the query event callback for each request.
+func TestReuseQueryResponses_NotSet_CallsCallbackForEachRequest(t *testing.T) {
+	var c queryCallCounter
+	runTest(t, func(s *res.Service) {
+		s.Handle("model", reuseQueryResponsesHandler(&c, false)...)
+	}, func(s *restest.Session) {
+		var subj string
+		req := s.Call("test.model", "method", nil)
+		s.GetMsg().AssertQueryEvent("test.model", &subj)
+		req.Response()
+		for i := 0; i < 2; i++ {
+			s.QueryRequest(subj, "q=foo").
+				Response().
+				AssertResult(json.RawMessage(`{"events":[{"event":"change","data":{"values":{"query":"q=foo"}}}]}`))
+		}
+		restest.AssertEqualJSON(t, "callback calls", c.counts(), map[string]int{"q=foo": 2})
+		st := s.Service().Stats()
+		restest.AssertEqualJSON(t, "QueryRequests", st.QueryRequests, 2)
+		restest.AssertEqualJSON(t, "ReusedQueryResponses", st.ReusedQueryResponses, 0)
+	}, restest.WithGnatsd)
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	res "github.com/jirenius/go-res"
+	"github.com/jirenius/go-res/restest"
+)
+
+// Test that OnUnobserved is called for a resource without requests during
+// the unobserved duration, and without a refetch after the reset probe.
+func TestOnUnobserved_NoRequestsDuringDuration_CallsCallback(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	called := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model.$id",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.OnUnobserved(time.Minute, func(r res.Resource) {
+				called <- r.ResourceName()
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model.42").Response().AssertModel(mock.Model)
+		restest.AssertEqualJSON(t, "Observed", s.Service().Observed(), []string{"test.model.42"})
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset([]string{"test.model.42"}, nil)
+		select {
+		case <-called:
+			t.Fatal("expected unobserved callback not to be called before the probe duration")
+		case <-time.After(timeoutDuration / 10):
+		}
+		clock.Add(time.Minute)
+		select {
+		case rname := <-called:
+			restest.AssertEqualJSON(t, "resource name", rname, "test.model.42")
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected unobserved callback to be called")
+		}
+		restest.AssertEqualJSON(t, "Observed", s.Service().Observed(), []string{})
+	})
+}
+
+// Test that a get or access request for a resource with OnUnobserved set
+// postpones the callback.
+func TestOnUnobserved_LaterRequest_PostponesCallback(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	called := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.Access(res.AccessGranted),
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.OnUnobserved(time.Minute, func(r res.Resource) {
+				called <- r.ResourceName()
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response().AssertModel(mock.Model)
+		clock.Add(30 * time.Second)
+		s.Access("test.model", nil).Response().AssertResult(json.RawMessage(`{"get":true,"call":"*"}`))
+		clock.Add(30 * time.Second)
+		select {
+		case <-called:
+			t.Fatal("expected unobserved callback not to be called")
+		case <-time.After(timeoutDuration / 10):
+		}
+		clock.Add(30 * time.Second)
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, []string{"test.model"})
+		clock.Add(time.Minute)
+		select {
+		case <-called:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected unobserved callback to be called")
+		}
+	})
+}
+
+// Test that call requests do not make a resource with OnUnobserved set
+// observed.
+func TestOnUnobserved_CallRequest_DoesNotObserve(t *testing.T) {
+	runTest(t, func(s *res.Service) {
+		s.Handle("model",
+			res.Call("method", func(r res.CallRequest) { r.OK(nil) }),
+			res.OnUnobserved(time.Minute, func(r res.Resource) {}),
+		)
+	}, func(s *restest.Session) {
+		s.Call("test.model", "method", nil).Response().AssertResult(nil)
+		restest.AssertEqualJSON(t, "Observed", s.Service().Observed(), []string{})
+	})
+}
+
+// Test that multiple OnUnobserved options call all callbacks in order.
+func TestOnUnobserved_MultipleCallbacks_CallsAllInOrder(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	done := make(chan []string, 1)
+	var calls []string
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.OnUnobserved(time.Hour, func(r res.Resource) { calls = append(calls, "foo") }),
+			res.OnUnobserved(time.Minute, func(r res.Resource) {
+				calls = append(calls, "bar")
+				done <- calls
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response().AssertModel(mock.Model)
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, nil)
+		clock.Add(time.Minute)
+		select {
+		case c := <-done:
+			restest.AssertEqualJSON(t, "calls", c, []string{"foo", "bar"})
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected unobserved callbacks to be called")
+		}
+	})
+}
+
+// Test that a resource kept subscribed without further requests gets a system
+// reset probe, that the get request of the gateway fetching it again keeps it
+// observed without calling the callback, and that the next probe is delayed.
+func TestOnUnobserved_SubscribedWithoutRequests_IsObservedOnRefetchAfterProbe(t *testing.T) {
+	clock := restest.NewMockClock(time.Time{})
+	called := make(chan string, 1)
+	runTest(t, func(s *res.Service) {
+		s.SetClock(clock)
+		s.Handle("model",
+			res.GetModel(func(r res.ModelRequest) { r.Model(mock.Model) }),
+			res.OnUnobserved(time.Minute, func(r res.Resource) {
+				called <- r.ResourceName()
+			}),
+		)
+	}, func(s *restest.Session) {
+		s.Get("test.model").Response().AssertModel(mock.Model)
+		// Events do not make the resource observed
+		restest.AssertNoError(t, s.Service().With("test.model", func(r res.Resource) {
+			r.Event("custom", nil)
+		}))
+		s.GetMsg().AssertEventName("test.model", "custom")
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, nil)
+		restest.AssertEqualJSON(t, "Observed", s.Service().Observed(), []string{})
+		// The gateway still subscribing fetches the resource again
+		s.Get("test.model").Response().AssertModel(mock.Model)
+		restest.AssertEqualJSON(t, "Observed", s.Service().Observed(), []string{"test.model"})
+		// The next probe is sent after twice the duration
+		clock.Add(time.Minute)
+		select {
+		case <-called:
+			t.Fatal("expected unobserved callback not to be called")
+		case <-time.After(timeoutDuration / 10):
+		}
+		clock.Add(time.Minute)
+		s.GetMsg().AssertSystemReset([]string{"test.model"}, nil)
+		clock.Add(time.Minute)
+		select {
+		case <-called:
+		case <-time.After(timeoutDuration):
+			t.Fatal("expected unobserved callback to be called")
+		}
+	})
+}
+
+// Test that OnUnobserved panics on invalid arguments.
+func TestOnUnobserved_InvalidArguments_Panics(t *testing.T) {
+	restest.AssertPanic(t, func() { res.OnUnobserved(0, func(r res.Resource) {}) })
+	restest.AssertPanic(t, func() { res.OnUnobserved(time.Minute, nil) })
+}
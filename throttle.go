@@ -0,0 +1,182 @@
+package res
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ThrottleStrategy is the strategy for handling events exceeding the rate set
+// with ThrottleEvents.
+type ThrottleStrategy int
+
+// Throttle strategies.
+const (
+	// ThrottleSample drops excess events, and sends a reset event for the
+	// resource once the rate allows, making gateways fetch the latest state.
+	// The get handler must always return the current state.
+	ThrottleSample ThrottleStrategy = iota
+	// ThrottleBatch buffers excess events, and sends them in order once the
+	// rate allows. Consecutive change events are merged into one. Buffered
+	// events are sent before responding to a get request for the resource, as
+	// the response may already include their effect.
+	ThrottleBatch
+)
+
+// eventThrottles holds the throttle state of resources with throttled events,
+// keyed by resource name.
+type eventThrottles struct {
+	mu sync.Mutex
+	m  map[string]*eventThrottle
+}
+
+// eventThrottle is the state of a resource within a throttle interval.
+type eventThrottle struct {
+	pending []throttledEvent
+	dropped bool
+}
+
+// throttledEvent is a buffered event.
+type throttledEvent struct {
+	subj string
+	data interface{}
+}
+
+// ThrottleEvents limits the rate of change, add, remove, and custom events
+// sent for each of the handler's resources to maxPerSecond, protecting
+// gateways and clients from high-frequency updates, such as on sensor-like
+// models. Events exceeding the rate are handled according to strategy.
+//
+// The events are still applied, and passed to any listeners, when they occur.
+//
+// Panics if maxPerSecond is not greater than zero.
+func ThrottleEvents(maxPerSecond float64, strategy ThrottleStrategy) Option {
+	if maxPerSecond <= 0 {
+		panic("res: throttle rate must be greater than zero")
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.ThrottleRate = maxPerSecond
+		hs.ThrottleStrategy = strategy
+	})
+}
+
+// sendEvent sends an event on the resource, throttled if the handler has a
+// throttle rate set, flushes it if the handler has SyncEvents set, and resets
+// any resources depending on it if the event was sent.
+func (r *resource) sendEvent(subj string, data interface{}) {
+	if r.h.ThrottleRate > 0 && !r.s.throttleEvent(r.rname, r.h, subj, data) {
+		return
+	}
+	r.s.event(subj, data)
+	r.syncEvent()
+	r.resetDependents()
+}
+
+// throttleEvent returns true if the event is to be sent immediately, as the
+// resource is not within a throttle interval, starting a new interval.
+// Otherwise the event is buffered or dropped, to be handled at the end of the
+// interval, and false is returned.
+func (s *Service) throttleEvent(rname string, h Handler, subj string, data interface{}) bool {
+	t := &s.throttles
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.m == nil {
+		t.m = make(map[string]*eventThrottle)
+	}
+	et, ok := t.m[rname]
+	if !ok {
+		t.m[rname] = &eventThrottle{}
+		s.startThrottleInterval(rname, h.ThrottleRate)
+		return true
+	}
+	if h.ThrottleStrategy != ThrottleBatch {
+		et.dropped = true
+		return false
+	}
+	// Merge consecutive change events.
+	if l := len(et.pending); l > 0 {
+		if prev, ok := et.pending[l-1].data.(changeEvent); ok && et.pending[l-1].subj == subj {
+			if next, ok := data.(changeEvent); ok {
+				values := make(map[string]interface{}, len(prev.Values)+len(next.Values))
+				for k, v := range prev.Values {
+					values[k] = v
+				}
+				for k, v := range next.Values {
+					values[k] = v
+				}
+				et.pending[l-1].data = changeEvent{Values: values}
+				return false
+			}
+		}
+	}
+	et.pending = append(et.pending, throttledEvent{subj: subj, data: data})
+	return false
+}
+
+// startThrottleInterval starts a timer ending the throttle interval of the
+// resource on its worker goroutine. If the service is stopped, or the
+// resource no longer has a handler, the resource is no longer throttled.
+func (s *Service) startThrottleInterval(rname string, rate float64) {
+	d := time.Duration(float64(time.Second) / rate)
+	s.clock.AfterFunc(d, func() {
+		if atomic.LoadInt32(&s.state) == stateStarted {
+			if err := s.With(rname, func(r Resource) { s.endThrottleInterval(rname, rate) }); err == nil {
+				return
+			}
+		}
+		t := &s.throttles
+		t.mu.Lock()
+		delete(t.m, rname)
+		t.mu.Unlock()
+	})
+}
+
+// endThrottleInterval sends any buffered events, or a reset event if events
+// were dropped, starting a new interval. If there are none, the resource is no
+// longer throttled. The events are sent after releasing the lock.
+func (s *Service) endThrottleInterval(rname string, rate float64) {
+	t := &s.throttles
+	t.mu.Lock()
+	et := t.m[rname]
+	if et == nil {
+		t.mu.Unlock()
+		return
+	}
+	if (!et.dropped && len(et.pending) == 0) || atomic.LoadInt32(&s.state) != stateStarted {
+		delete(t.m, rname)
+		t.mu.Unlock()
+		return
+	}
+	t.m[rname] = &eventThrottle{}
+	s.startThrottleInterval(rname, rate)
+	t.mu.Unlock()
+
+	if et.dropped {
+		s.reset([]string{rname}, nil)
+	} else {
+		for _, ev := range et.pending {
+			s.event(ev.subj, ev.data)
+		}
+	}
+	s.resetDependents(rname)
+}
+
+// flushThrottled sends any buffered events of the resource immediately, to
+// keep event order when sending events that are not throttled.
+func (r *resource) flushThrottled() {
+	if r.h.ThrottleRate <= 0 {
+		return
+	}
+	t := &r.s.throttles
+	t.mu.Lock()
+	var pending []throttledEvent
+	if et := t.m[r.rname]; et != nil {
+		pending = et.pending
+		et.pending = nil
+	}
+	t.mu.Unlock()
+
+	for _, ev := range pending {
+		r.s.event(ev.subj, ev.data)
+	}
+}
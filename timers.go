@@ -0,0 +1,80 @@
+package res
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resourceTimers holds pending timers keyed by resource name, where each
+// resource has at most one timer. Scheduling a timer for a resource replaces
+// any timer previously scheduled for it.
+type resourceTimers struct {
+	mu sync.Mutex
+	m  map[string]*resourceTimer
+}
+
+// resourceTimer is a scheduled timer of a resource.
+type resourceTimer struct {
+	timer Timer
+}
+
+// schedule schedules f to be called on the resource's worker goroutine after
+// the duration d, replacing any timer previously scheduled for the resource.
+// The op describes the callback in error logs.
+func (rt *resourceTimers) schedule(s *Service, rname string, d time.Duration, op string, f func(r Resource)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.m == nil {
+		rt.m = make(map[string]*resourceTimer)
+	}
+	if prev, ok := rt.m[rname]; ok {
+		prev.timer.Stop()
+	}
+	t := &resourceTimer{}
+	rt.m[rname] = t
+	t.timer = s.clock.AfterFunc(d, func() { rt.fire(s, rname, t, op, f) })
+}
+
+// cancel stops any timer scheduled for the resource.
+func (rt *resourceTimers) cancel(rname string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if t, ok := rt.m[rname]; ok {
+		t.timer.Stop()
+		delete(rt.m, rname)
+	}
+}
+
+// fire calls f with the resource on its worker goroutine, unless the timer
+// has been replaced or canceled, or the service is not started.
+func (rt *resourceTimers) fire(s *Service, rname string, t *resourceTimer, op string, f func(r Resource)) {
+	rt.mu.Lock()
+	if rt.m[rname] != t {
+		rt.mu.Unlock()
+		return
+	}
+	delete(rt.m, rname)
+	rt.mu.Unlock()
+
+	if atomic.LoadInt32(&s.state) != stateStarted {
+		return
+	}
+	err := s.With(rname, func(r Resource) {
+		// Skip if a new timer was scheduled after the timer fired.
+		if !rt.has(rname) {
+			f(r)
+		}
+	})
+	if err != nil {
+		s.errorf("Failed to %s %s: %s", op, rname, err)
+	}
+}
+
+// has returns true if a timer is scheduled for the resource.
+func (rt *resourceTimers) has(rname string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	_, ok := rt.m[rname]
+	return ok
+}
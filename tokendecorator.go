@@ -0,0 +1,65 @@
+package res
+
+import (
+	"encoding/json"
+)
+
+// TokenDecorator enriches or normalizes the access token of a request, such as
+// by resolving role IDs to permissions from a cache. It is called with the
+// resource of the request and the raw token, which is nil if the request has
+// no token.
+//
+// The returned value is used as the request's token. A json.RawMessage is used
+// as is, while any other value is marshaled into JSON. A nil value means the
+// request has no token.
+type TokenDecorator func(r Resource, token json.RawMessage) (interface{}, error)
+
+// SetTokenDecorator sets a decorator called for access, call, and auth
+// requests the first time the handler calls RawToken or ParseToken. The
+// decorated token is cached for the remainder of the request.
+//
+// If the decorator returns an error, RawToken and ParseToken panic with the
+// error converted using ToError, responding to the request with the error.
+func (s *Service) SetTokenDecorator(d TokenDecorator) *Service {
+	if s.nc != nil {
+		panic(serviceAlreadyStarted)
+	}
+	s.tokenDecorator = d
+	return s
+}
+
+// decoratedToken returns the token of the request, decorated by the
+// service's token decorator if one is set.
+func (r *Request) decoratedToken() json.RawMessage {
+	if r.s.tokenDecorator == nil {
+		return r.token
+	}
+	if !r.decorated {
+		r.dtoken = r.decorateToken()
+		r.decorated = true
+	}
+	return r.dtoken
+}
+
+// decorateToken calls the token decorator, panicking with an *Error on
+// failure.
+func (r *Request) decorateToken() json.RawMessage {
+	v, err := r.s.tokenDecorator(r, r.token)
+	if err != nil {
+		panic(ToError(err))
+	}
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		return t
+	}
+	dt, err := json.Marshal(v)
+	if err != nil {
+		panic(InternalError(err))
+	}
+	if string(dt) == "null" {
+		return nil
+	}
+	return dt
+}
@@ -0,0 +1,181 @@
+package res
+
+import (
+	"sort"
+	"sync"
+)
+
+// TokenManager keeps track of access tokens issued with a token ID (tid), and
+// the connections they were issued to. It allows tokens to be updated,
+// revoked, or reset by ID across all gateways.
+//
+// A token reset makes each gateway send an auth request to the manager's
+// subject for every connection with a token matching the reset token IDs. The
+// auth handler for that subject should then issue a new token, or clear it:
+//
+//	tm := res.NewTokenManager(s, "auth.auth.refresh")
+//	s.Handle("auth", res.Auth("refresh", func(r res.AuthRequest) {
+//		var tok struct{ TID string `json:"tid"` }
+//		r.ParseToken(&tok)
+//		if token, ok := tm.Token(tok.TID); ok {
+//			tm.IssueFor(r, tok.TID, token)
+//		} else {
+//			r.TokenEvent(nil)
+//		}
+//		r.OK(nil)
+//	}))
+//
+// A TokenManager is safe for concurrent use.
+type TokenManager struct {
+	s       *Service
+	subject string
+	mu      sync.Mutex
+	tokens  map[string]*issuedToken
+}
+
+// issuedToken is a token issued by a TokenManager, and the connections it was
+// issued to.
+type issuedToken struct {
+	token interface{}
+	cids  map[string]struct{}
+}
+
+// NewTokenManager returns a new TokenManager that sends token events using the
+// service, s. The subject is the message subject that receives auth requests
+// when tokens are reset. See Service.TokenReset.
+//
+// Panics if the subject is invalid.
+func NewTokenManager(s *Service, subject string) *TokenManager {
+	if subject == "" || !isValidPath(subject) {
+		panic(`res: invalid token reset subject`)
+	}
+	return &TokenManager{
+		s:       s,
+		subject: subject,
+		tokens:  make(map[string]*issuedToken),
+	}
+}
+
+// Issue sends a token event with the token ID to the connection, cid, and
+// tracks the token by its ID. If a token is already tracked with the ID, it is
+// replaced, but no event is sent to its other connections. Use Update for that.
+//
+// Panics if cid is invalid.
+func (tm *TokenManager) Issue(cid string, tokenID string, token interface{}) {
+	if !isValidPart(cid) {
+		panic(`res: invalid connection ID`)
+	}
+	tm.mu.Lock()
+	it, ok := tm.tokens[tokenID]
+	if !ok {
+		it = &issuedToken{cids: make(map[string]struct{}, 1)}
+		tm.tokens[tokenID] = it
+	}
+	it.token = token
+	it.cids[cid] = struct{}{}
+	tm.mu.Unlock()
+
+	tm.s.TokenEventWithID(cid, tokenID, token)
+}
+
+// IssueFor issues the token to the connection of the auth request, r, in the
+// same way as Issue.
+func (tm *TokenManager) IssueFor(r AuthRequest, tokenID string, token interface{}) {
+	tm.Issue(r.CID(), tokenID, token)
+}
+
+// Token returns the token issued with the token ID. The returned bool is false
+// if no token is tracked with the ID.
+func (tm *TokenManager) Token(tokenID string) (interface{}, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	it, ok := tm.tokens[tokenID]
+	if !ok {
+		return nil, false
+	}
+	return it.token, true
+}
+
+// TokenIDs returns the IDs of all tracked tokens, sorted.
+func (tm *TokenManager) TokenIDs() []string {
+	tm.mu.Lock()
+	ids := make([]string, 0, len(tm.tokens))
+	for id := range tm.tokens {
+		ids = append(ids, id)
+	}
+	tm.mu.Unlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// Update replaces the token tracked by the token ID, and sends a token event
+// with the new token to all connections it has been issued to. The returned
+// bool is false if no token is tracked with the ID, in which case nothing is
+// sent.
+func (tm *TokenManager) Update(tokenID string, token interface{}) bool {
+	tm.mu.Lock()
+	it, ok := tm.tokens[tokenID]
+	var cids []string
+	if ok {
+		it.token = token
+		cids = it.connIDs()
+	}
+	tm.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	tm.s.TokenEventAllWithID(cids, tokenID, token)
+	return true
+}
+
+// Revoke stops tracking the tokens with the given IDs, and sends token events
+// clearing the tokens to all connections they have been issued to. To also
+// have gateways reauthenticate connections not tracked by the manager, such
+// as forgotten ones, use Reset.
+func (tm *TokenManager) Revoke(tokenID ...string) {
+	var cids []string
+	tm.mu.Lock()
+	for _, id := range tokenID {
+		if it, ok := tm.tokens[id]; ok {
+			cids = append(cids, it.connIDs()...)
+			delete(tm.tokens, id)
+		}
+	}
+	tm.mu.Unlock()
+
+	tm.s.TokenEventAll(cids, nil)
+}
+
+// Forget stops tracking the connection, cid, for all tokens. It should be
+// called when a connection is known to be closed. Tokens are still tracked
+// after their last connection is forgotten.
+func (tm *TokenManager) Forget(cid string) {
+	tm.mu.Lock()
+	for _, it := range tm.tokens {
+		delete(it.cids, cid)
+	}
+	tm.mu.Unlock()
+}
+
+// Reset sends a token reset event for the token IDs, making all gateways send
+// auth requests to the manager's subject for connections with a token matching
+// any of the IDs. The token IDs do not need to be tracked by the manager.
+func (tm *TokenManager) Reset(tokenID ...string) {
+	tm.s.TokenReset(tm.subject, tokenID...)
+}
+
+// ResetAll sends a token reset event for all tracked token IDs.
+func (tm *TokenManager) ResetAll() {
+	tm.Reset(tm.TokenIDs()...)
+}
+
+// connIDs returns the connection IDs the token has been issued to, sorted.
+func (it *issuedToken) connIDs() []string {
+	cids := make([]string, 0, len(it.cids))
+	for cid := range it.cids {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+	return cids
+}
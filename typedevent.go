@@ -0,0 +1,83 @@
+package res
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EventValidator is implemented by custom event payloads that validate
+// themselves when sent with EventT.
+type EventValidator interface {
+	Validate() error
+}
+
+// EventT sends a custom event with a typed payload on the resource, in the
+// same way as Resource.Event. The payload is validated before the event is
+// sent: EventT panics if the payload cannot be marshaled into JSON, or if it
+// implements EventValidator and Validate returns an error.
+//
+//	type BookLent struct {
+//		UserID string `json:"userId"`
+//	}
+//
+//	res.EventT(r, "lent", BookLent{UserID: "42"})
+func EventT[T any](r Resource, event string, payload T) {
+	if v, ok := interface{}(payload).(EventValidator); ok {
+		if err := v.Validate(); err != nil {
+			panic(fmt.Sprintf("res: invalid %s event payload: %s", event, err))
+		}
+	}
+	if _, err := json.Marshal(payload); err != nil {
+		panic(fmt.Sprintf("res: invalid %s event payload: %s", event, err))
+	}
+	r.Event(event, payload)
+}
+
+// AddListenerT adds a listener for custom events with the event name, that
+// occurs on resources matching the exact pattern. The listener is called
+// with the payload decoded into T:
+//
+//	res.AddListenerT(s.Mux, "book.$id", "lent", func(r res.Resource, ev BookLent) {
+//		log.Printf("%s lent by %s", r.ResourceName(), ev.UserID)
+//	})
+//
+// A payload of type T, such as sent with EventT, is passed as is. Any other
+// payload is converted into T by its JSON encoding. Payloads that cannot be
+// decoded are reported as errors, without calling the listener.
+func AddListenerT[T any](m *Mux, pattern, event string, cb func(r Resource, payload T)) {
+	if cb == nil {
+		panic("nil event handler")
+	}
+	m.AddListener(pattern, func(ev *Event) {
+		if ev.Name != event {
+			return
+		}
+		v, err := decodePayload[T](ev.Payload)
+		if err != nil {
+			ev.Resource.Service().errorf("Error decoding %s event payload for %s: %s", event, ev.Resource.ResourceName(), err)
+			return
+		}
+		cb(ev.Resource, v)
+	})
+}
+
+// decodePayload returns the payload as type T, converting it through its
+// JSON encoding if it is of a different type.
+func decodePayload[T any](payload interface{}) (T, error) {
+	if v, ok := payload.(T); ok {
+		return v, nil
+	}
+	var v T
+	var data []byte
+	switch p := payload.(type) {
+	case json.RawMessage:
+		data = p
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return v, err
+		}
+	}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
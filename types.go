@@ -131,6 +131,27 @@ func (r SoftRef) IsValid() bool {
 	return IsValidRID(string(r))
 }
 
+// reservedEventNames are the pre-defined or reserved event names that may not
+// be used for custom events.
+var reservedEventNames = map[string]bool{
+	"change":      true,
+	"delete":      true,
+	"add":         true,
+	"remove":      true,
+	"patch":       true,
+	"reaccess":    true,
+	"unsubscribe": true,
+	"query":       true,
+}
+
+// IsValidEventName returns true if the event name is valid for a custom event,
+// otherwise false. The pre-defined or reserved events, "change", "delete",
+// "add", "remove", "patch", "reaccess", "unsubscribe", and "query", are not
+// valid custom event names.
+func IsValidEventName(event string) bool {
+	return isValidPart(event) && !reservedEventNames[event]
+}
+
 // IsValidRID returns true if the resource ID is valid, otherwise false.
 func IsValidRID(rid string) bool {
 	start := true
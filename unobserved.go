@@ -0,0 +1,168 @@
+package res
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxUnobservedBackoff is the maximum factor of the unobserved duration that
+// the interval between reset probes of a still subscribed resource grows to.
+const maxUnobservedBackoff = 16
+
+// resourceObservations holds the observed resources of handlers having
+// OnUnobserved set, keyed by resource name.
+type resourceObservations struct {
+	timers resourceTimers
+	mu     sync.Mutex
+	m      map[string]*observation
+}
+
+// observation is the observation state of a resource.
+type observation struct {
+	interval time.Duration // Duration without requests before a reset probe
+	probing  bool          // Flag telling that a reset probe is awaiting a refetch
+}
+
+// OnUnobserved sets a callback to be called when one of the handler's
+// resources is no longer observed, letting the handler release per-resource
+// caches, watchers, and upstream subscriptions:
+//
+//	s.Handle("ticker.$symbol",
+//		res.GetModel(getTicker),
+//		res.OnUnobserved(10*time.Minute, func(r res.Resource) {
+//			upstream.Unsubscribe(r.PathParam("symbol"))
+//		}),
+//	)
+//
+// As the RES protocol has no notification of gateways unsubscribing a
+// resource, observation is tracked by the get and access requests received
+// for it. Events sent on the resource do not make it observed. The callback is
+// called on the resource's worker goroutine. A later request for the resource
+// makes it observed again, and may be used to recreate what was released.
+//
+// Gateways, such as Resgate, cache subscribed resources without fetching them
+// again, so a resource with live subscribers may have no new clients or access
+// checks. To tell such a resource apart from an unobserved one, a system reset
+// event is sent as a probe when the duration d has passed, resetting the
+// resource if the handler has a get handler, and access to the resource if it
+// has an access handler. Gateways still having the resource cached request it
+// again, making it observed without calling the callback, while gateways
+// without it ignore the event. The callback is called only if the resource is
+// not requested within another duration d after the probe. For each probe
+// answered by a new request, the time until the next probe doubles, up to 16
+// times d, to limit the resets of resources that stay subscribed.
+//
+// If a callback is already set, the new callback will be called after the
+// previous one, and d replaces the previous duration.
+//
+// Panics if d is not greater than zero, or if callback is nil.
+func OnUnobserved(d time.Duration, callback func(r Resource)) Option {
+	if d <= 0 {
+		panic("res: unobserved duration must be greater than zero")
+	}
+	if callback == nil {
+		panic("res: nil unobserved callback")
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.UnobservedAfter = d
+		if hs.OnUnobserved != nil {
+			prevcb := hs.OnUnobserved
+			hs.OnUnobserved = func(r Resource) {
+				prevcb(r)
+				callback(r)
+			}
+		} else {
+			hs.OnUnobserved = callback
+		}
+	})
+}
+
+// observe marks the resource as observed if its handler has OnUnobserved
+// set, scheduling a reset probe and replacing any previously scheduled probe
+// or callback.
+func (r *resource) observe() {
+	d := r.h.UnobservedAfter
+	if r.h.OnUnobserved == nil || d <= 0 {
+		return
+	}
+	s, rname, cb := r.s, r.rname, r.h.OnUnobserved
+	// Probe gateways that may have cached the resource, or access to it.
+	var resources, access []string
+	if r.h.Get != nil {
+		resources = []string{rname}
+	}
+	if r.h.Access != nil {
+		access = []string{rname}
+	}
+	o := &s.observations
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.m == nil {
+		o.m = make(map[string]*observation)
+	}
+	obs, ok := o.m[rname]
+	if !ok {
+		obs = &observation{interval: d}
+		o.m[rname] = obs
+	} else if obs.probing {
+		// The resource was fetched again after a reset probe, and is still
+		// subscribed.
+		obs.probing = false
+		obs.interval *= 2
+		if max := d * maxUnobservedBackoff; obs.interval > max {
+			obs.interval = max
+		}
+	}
+	o.timers.schedule(s, rname, obs.interval, "probe unobserved", func(r Resource) {
+		s.probeUnobserved(rname, resources, access, d, cb)
+	})
+}
+
+// probeUnobserved sends a system reset for the resource, or access to it, to
+// have any gateway still subscribing to it request it again, and schedules the
+// unobserved callback unless it does.
+func (s *Service) probeUnobserved(rname string, resources, access []string, d time.Duration, cb func(Resource)) {
+	o := &s.observations
+	o.mu.Lock()
+	obs, ok := o.m[rname]
+	// Skip if the resource was observed after the timer fired.
+	if !ok || o.timers.has(rname) {
+		o.mu.Unlock()
+		return
+	}
+	obs.probing = true
+	o.timers.schedule(s, rname, d, "call unobserved callback for", func(r Resource) {
+		o.mu.Lock()
+		obs, ok := o.m[rname]
+		ok = ok && obs.probing && !o.timers.has(rname)
+		if ok {
+			delete(o.m, rname)
+		}
+		o.mu.Unlock()
+		if ok {
+			cb(r)
+		}
+	})
+	o.mu.Unlock()
+
+	s.reset(resources, access)
+}
+
+// Observed returns the resource names of the resources currently observed,
+// for handlers with OnUnobserved set. The resources are those with a get or
+// access request received within the unobserved duration of the handler,
+// excluding those awaiting a refetch after a reset probe.
+func (s *Service) Observed() []string {
+	o := &s.observations
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rnames := make([]string, 0, len(o.m))
+	for rname, obs := range o.m {
+		if !obs.probing {
+			rnames = append(rnames, rname)
+		}
+	}
+	sort.Strings(rnames)
+	return rnames
+}
@@ -0,0 +1,84 @@
+package res
+
+import (
+	"errors"
+	"reflect"
+)
+
+// FieldValidationError is implemented by validation errors of a single field.
+// It matches the validator.FieldError of github.com/go-playground/validator,
+// without the package having to be imported.
+type FieldValidationError interface {
+	error
+	// Field returns the name of the failing field, using the tag name if one
+	// is registered with the validator.
+	Field() string
+	// Tag returns the validation tag that failed, such as "required".
+	Tag() string
+	// Param returns the parameter of the tag, such as "10" for "max=10".
+	Param() string
+}
+
+var fieldValidationErrorType = reflect.TypeOf((*FieldValidationError)(nil)).Elem()
+
+// ValidationError converts a validation error into a system.invalidParams
+// error, with Data containing a []FieldError describing the failing fields.
+// The error may be, or wrap, a single FieldValidationError, or a slice of
+// them, such as validator.ValidationErrors. Returns nil if err is not a
+// validation error.
+//
+// Validation errors passed to Error, or panicked, from a handler are
+// responded with as invalid parameters:
+//
+//	if err := validate.Struct(params); err != nil {
+//		panic(err)
+//	}
+func ValidationError(err error) *Error {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if fes := fieldErrors(err); fes != nil {
+			return &Error{Code: CodeInvalidParams, Message: ErrInvalidParams.Message, Data: fes}
+		}
+	}
+	return nil
+}
+
+// fieldErrors returns the field errors of a single FieldValidationError, or a
+// non-empty slice of them. Returns nil if err is neither.
+func fieldErrors(err error) []FieldError {
+	if fe, ok := err.(FieldValidationError); ok {
+		return []FieldError{toFieldError(fe)}
+	}
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Slice || v.Len() == 0 || !v.Type().Elem().Implements(fieldValidationErrorType) {
+		return nil
+	}
+	fes := make([]FieldError, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		fe, ok := v.Index(i).Interface().(FieldValidationError)
+		if !ok {
+			return nil
+		}
+		fes = append(fes, toFieldError(fe))
+	}
+	return fes
+}
+
+// handlerError converts an error from a handler to an *Error, responding to
+// validation errors with system.invalidParams.
+func handlerError(err error) *Error {
+	if _, ok := err.(*Error); !ok {
+		if ve := ValidationError(err); ve != nil {
+			return ve
+		}
+	}
+	return ToError(err)
+}
+
+func toFieldError(fe FieldValidationError) FieldError {
+	return FieldError{
+		Field:   fe.Field(),
+		Message: fe.Error(),
+		Tag:     fe.Tag(),
+		Param:   fe.Param(),
+	}
+}
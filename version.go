@@ -0,0 +1,135 @@
+package res
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// resourceVersions holds the versions of resources with versioning enabled,
+// keyed by resource name.
+type resourceVersions struct {
+	mu sync.Mutex
+	m  map[string]uint64
+}
+
+// versionedModel is a model response with the resource version included as a
+// property.
+type versionedModel struct {
+	prop    string
+	version uint64
+	model   interface{}
+}
+
+// Versioned enables versioning of the handler's resources. The version of a
+// resource is a number, starting at 0, that is increased by one for each
+// change, add, remove, and create event applied to the resource, and for each
+// reset event sent on it. The current version is read with
+// Service.ResourceVersion. A delete event discards the version, and a resource
+// created again after being deleted starts at 0.
+//
+// If prop is not empty, the version is included in model get responses as a
+// property with that name, and as a changed value in all change events,
+// allowing clients to detect conflicts. The model must not have a property
+// with the same name.
+func Versioned(prop string) Option {
+	if prop != "" && !isValidPart(prop) {
+		panic("res: invalid version property name: " + prop)
+	}
+	return OptionFunc(func(hs *Handler) {
+		hs.Versioned = true
+		hs.VersionProperty = prop
+	})
+}
+
+// ResourceVersion returns the version of the resource with the resource name
+// rname, without any query. Returns 0 if no events have been applied to the
+// resource, or if the resource has no versioning.
+func (s *Service) ResourceVersion(rname string) uint64 {
+	s.versions.mu.Lock()
+	defer s.versions.mu.Unlock()
+	return s.versions.m[rname]
+}
+
+// SetResourceVersion sets the version of the resource with the resource name
+// rname. It is intended for stores persisting versions across restarts.
+//
+// Versions never decrease, and if v is less than or equal to the current
+// version, SetResourceVersion does nothing.
+func (s *Service) SetResourceVersion(rname string, v uint64) {
+	s.versions.mu.Lock()
+	defer s.versions.mu.Unlock()
+	if v <= s.versions.m[rname] {
+		return
+	}
+	if s.versions.m == nil {
+		s.versions.m = make(map[string]uint64)
+	}
+	s.versions.m[rname] = v
+}
+
+// incVersion increases the version of the resource if it has versioning
+// enabled, and returns the new version.
+func (r *resource) incVersion() uint64 {
+	if !r.h.Versioned {
+		return 0
+	}
+	vs := &r.s.versions
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.m == nil {
+		vs.m = make(map[string]uint64)
+	}
+	v := vs.m[r.rname] + 1
+	vs.m[r.rname] = v
+	return v
+}
+
+// deleteVersion discards the version of a deleted resource, if it has
+// versioning enabled.
+func (r *resource) deleteVersion() {
+	if !r.h.Versioned {
+		return
+	}
+	vs := &r.s.versions
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	delete(vs.m, r.rname)
+}
+
+// versionChanges returns the changes with the version property set to the
+// version v. The changes map is not modified.
+func (r *resource) versionChanges(changes map[string]interface{}, v uint64) map[string]interface{} {
+	ch := make(map[string]interface{}, len(changes)+1)
+	for k, val := range changes {
+		ch[k] = val
+	}
+	ch[r.h.VersionProperty] = v
+	return ch
+}
+
+// MarshalJSON makes versionedModel implement the json.Marshaler interface.
+func (m versionedModel) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(m.model)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' {
+		return nil, errors.New("res: versioned model must marshal into a json object")
+	}
+	key, _ := json.Marshal(m.prop)
+	var b bytes.Buffer
+	b.Grow(len(data) + len(key) + 24)
+	b.WriteByte('{')
+	b.Write(key)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatUint(m.version, 10))
+	if len(bytes.TrimSpace(data[1:len(data)-1])) > 0 {
+		b.WriteByte(',')
+	}
+	b.Write(data[1:])
+	return b.Bytes(), nil
+}
@@ -1,34 +1,263 @@
 package res
 
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
 type work struct {
-	s      *Service
+	sh     *workShard
 	wid    string // Worker ID for the work queue
+	gid    uint64 // ID of the goroutine processing the queue. Only set if reentrantWith is enabled.
 	single [1]func()
 	queue  []func() // Callback queue
 }
 
+// workShard holds the work queues for a subset of worker IDs, and is processed
+// by its own set of workers.
+type workShard struct {
+	mu        sync.Mutex       // Mutex to protect rwork map and workqueue
+	rwork     map[string]*work // map of resource work
+	workqueue []*work          // Resource work queue.
+	workbuf   []*work          // Underlying buffer of the workqueue
+	workcond  sync.Cond        // Cond waited on by workers and signaled when work is added to workqueue
+	drain     bool             // Flag telling workers to stop once the workqueue is empty and no work is active
+	active    int              // Number of workers processing work
+}
+
+// newWorkShard creates a new work shard with a queue buffer of the given size.
+func newWorkShard(size int) *workShard {
+	sh := &workShard{
+		workbuf: make([]*work, size),
+		rwork:   make(map[string]*work, size),
+	}
+	sh.workqueue = sh.workbuf[:0]
+	sh.workcond = sync.Cond{L: &sh.mu}
+	return sh
+}
+
+// startWorkers creates the work shards and starts the workers, distributing
+// them evenly over the shards.
+func (s *Service) startWorkers() {
+	s.buckets = nil
+	if s.groupBuckets > 0 {
+		s.buckets = make([]string, s.groupBuckets)
+		for i := range s.buckets {
+			// Prefixed with a null character to avoid collision with any group.
+			s.buckets[i] = "\x00bucket." + strconv.Itoa(i)
+		}
+	}
+	count := s.workShards
+	if count > s.workerCount {
+		count = s.workerCount
+	}
+	s.shards = make([]*workShard, count)
+	s.wg.Add(s.workerCount)
+	for i := range s.shards {
+		sh := newWorkShard(s.inChannelSize/count + 1)
+		s.shards[i] = sh
+		workers := s.workerCount / count
+		if i < s.workerCount%count {
+			workers++
+		}
+		for j := 0; j < workers; j++ {
+			go s.startWorker(sh)
+		}
+	}
+	s.lshard = newWorkShard(s.inChannelSize)
+	s.wg.Add(s.listenerCount)
+	for i := 0; i < s.listenerCount; i++ {
+		go s.startWorker(s.lshard)
+	}
+	s.qshard = newWorkShard(s.inChannelSize)
+	s.wg.Add(s.queryCount)
+	for i := 0; i < s.queryCount; i++ {
+		go s.startWorker(s.qshard)
+	}
+}
+
+// drainWorkers signals all workers to stop once all queued work is done.
+func (s *Service) drainWorkers() {
+	for _, sh := range s.allShards() {
+		sh.mu.Lock()
+		sh.drain = true
+		sh.mu.Unlock()
+		sh.workcond.Broadcast()
+	}
+}
+
+// stopWorkers signals all workers to stop once their current work is done,
+// discarding any queued work. Listener workers are allowed to finish queued
+// work.
+func (s *Service) stopWorkers() {
+	for _, sh := range s.allShards() {
+		sh.mu.Lock()
+		if sh == s.lshard {
+			sh.drain = true
+		} else {
+			sh.workqueue = nil
+		}
+		sh.mu.Unlock()
+		sh.workcond.Broadcast()
+	}
+}
+
+// allShards returns all work shards, including the listener and query shards.
+func (s *Service) allShards() []*workShard {
+	shs := make([]*workShard, 0, len(s.shards)+2)
+	shs = append(shs, s.shards...)
+	return append(shs, s.lshard, s.qshard)
+}
+
+// shard returns the work shard for the worker ID. Work without a worker ID is
+// spread over the shards in turn.
+func (s *Service) shard(wid string) *workShard {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	if wid == "" {
+		return s.shards[atomic.AddUint32(&s.shardNext, 1)%uint32(len(s.shards))]
+	}
+	return s.shards[hashString(wid)%uint32(len(s.shards))]
+}
+
+// bucket returns the worker ID of the group bucket for the worker ID, or the
+// worker ID itself if group buckets are not used.
+func (s *Service) bucket(wid string) string {
+	if len(s.buckets) == 0 || wid == "" {
+		return wid
+	}
+	return s.buckets[jumpHash(uint64(hashString(wid)), len(s.buckets))]
+}
+
+// jumpHash returns the bucket, in the range [0, n), of the key, using jump
+// consistent hashing. When the number of buckets changes from n to n+1, only
+// about 1/(n+1) of the keys are moved, all to the new bucket.
+//
+// See: https://arxiv.org/abs/1406.2294
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// hashString returns the FNV-1a hash of the string.
+func hashString(str string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(str); i++ {
+		h ^= uint32(str[i])
+		h *= 16777619
+	}
+	return h
+}
+
 // startWorker starts a new resource worker that will listen for resources to
 // process requests on.
-func (s *Service) startWorker() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *Service) startWorker(sh *workShard) {
+	var gid uint64
+	if s.reentrantWith {
+		gid = goroutineID()
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 	defer s.wg.Done()
 	// workqueue being nil signals we the service is closing
-	for s.workqueue != nil {
-		for len(s.workqueue) == 0 {
-			s.workcond.Wait()
-			if s.workqueue == nil {
+	for sh.workqueue != nil {
+		for len(sh.workqueue) == 0 {
+			if sh.drain && sh.active == 0 {
+				sh.workqueue = nil
+				sh.workcond.Broadcast()
+				return
+			}
+			sh.workcond.Wait()
+			if sh.workqueue == nil {
 				return
 			}
 		}
-		w := s.workqueue[0]
-		if len(s.workqueue) == 1 {
-			s.workqueue = s.workbuf[:0]
+		w := sh.workqueue[0]
+		if len(sh.workqueue) == 1 {
+			sh.workqueue = sh.workbuf[:0]
 		} else {
-			s.workqueue = s.workqueue[1:]
+			sh.workqueue = sh.workqueue[1:]
 		}
+		w.gid = gid
+		sh.active++
 		w.processQueue()
+		sh.active--
+	}
+}
+
+// runListener enqueues the callback, cb, to be called by an asynchronous
+// event listener worker. Callbacks for the same resource name, rname, are
+// called in order.
+func (s *Service) runListener(rname string, cb func()) {
+	sh := s.lshard
+	if sh == nil {
+		return
+	}
+	sh.mu.Lock()
+	if sh.workqueue == nil {
+		// Listener workers have stopped
+		sh.mu.Unlock()
+		return
+	}
+	if w, ok := sh.rwork[rname]; ok {
+		w.queue = append(w.queue, cb)
+		sh.mu.Unlock()
+		return
+	}
+	w := &work{
+		sh:     sh,
+		wid:    rname,
+		single: [1]func(){cb},
+	}
+	w.queue = w.single[:1]
+	sh.rwork[rname] = w
+	sh.workqueue = append(sh.workqueue, w)
+	sh.mu.Unlock()
+	sh.workcond.Signal()
+}
+
+// runQuery enqueues the callback, cb, to be called by a query worker.
+// Callbacks are called concurrently, in no particular order.
+func (s *Service) runQuery(cb func()) {
+	sh := s.qshard
+	if sh == nil {
+		return
+	}
+	sh.mu.Lock()
+	if sh.workqueue == nil {
+		// Query workers have stopped
+		sh.mu.Unlock()
+		return
+	}
+	w := &work{
+		sh:     sh,
+		single: [1]func(){cb},
+	}
+	w.queue = w.single[:1]
+	sh.workqueue = append(sh.workqueue, w)
+	sh.mu.Unlock()
+	sh.workcond.Signal()
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the header
+// of its stack trace: "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
 	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
 }
 
 func (w *work) processQueue() {
@@ -37,13 +266,13 @@ func (w *work) processQueue() {
 
 	for len(w.queue) > idx {
 		f = w.queue[idx]
-		w.s.mu.Unlock()
+		w.sh.mu.Unlock()
 		idx++
 		f()
-		w.s.mu.Lock()
+		w.sh.mu.Lock()
 	}
 	// Work complete. Delete if it has a work ID.
 	if w.wid != "" {
-		delete(w.s.rwork, w.wid)
+		delete(w.sh.rwork, w.wid)
 	}
 }
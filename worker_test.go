@@ -0,0 +1,31 @@
+package res
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Test jumpHash returns buckets within range, and only moves keys to the new
+// bucket when the number of buckets increases.
+func TestJumpHash(t *testing.T) {
+	for n := 1; n < 32; n++ {
+		moved := 0
+		for i := 0; i < 1000; i++ {
+			key := uint64(hashString("group." + strconv.Itoa(i)))
+			b := jumpHash(key, n)
+			if b < 0 || b >= n {
+				t.Fatalf("expected bucket for key %d to be in range [0, %d), but got %d", key, n, b)
+			}
+			nb := jumpHash(key, n+1)
+			if nb != b {
+				if nb != n {
+					t.Fatalf("expected key %d to move from bucket %d to new bucket %d, but moved to %d", key, b, n, nb)
+				}
+				moved++
+			}
+		}
+		if max := 2 * 1000 / (n + 1); moved > max+20 {
+			t.Errorf("expected at most about %d of 1000 keys to move going from %d to %d buckets, but %d moved", 1000/(n+1), n, n+1, moved)
+		}
+	}
+}